@@ -0,0 +1,144 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/lerndmina/SSH-Tunnel/internal/audit"
+	"github.com/lerndmina/SSH-Tunnel/internal/backup"
+	"github.com/lerndmina/SSH-Tunnel/internal/config"
+	"github.com/spf13/cobra"
+)
+
+// newBackupCreateCommand creates the backup create command
+func newBackupCreateCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "create",
+		Short: "Create backup",
+		Long: `Archive the tunnel configurations, defaults.yaml and settings.yaml into the
+backups directory of the config directory.
+
+--tunnel backs up only the named tunnels, without defaults and settings.
+--include-keys adds the SSH key files the tunnels use that are within the
+home directory.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			configPath := config.GetManager().GetConfigPath()
+			path, err := backup.Create(configPath, backup.Dir(configPath), backup.ManualPrefix, time.Now(), backupOptions(cmd))
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "✓ Created backup %s\n", path)
+			return nil
+		},
+	}
+
+	addBackupSelectionFlags(cmd)
+	return cmd
+}
+
+// addBackupSelectionFlags adds the flags choosing what a backup or restore
+// covers
+func addBackupSelectionFlags(cmd *cobra.Command) {
+	cmd.Flags().StringArray("tunnel", nil, "Only include this tunnel (repeatable)")
+	cmd.Flags().Bool("include-keys", false, "Include the tunnels' SSH key files")
+}
+
+// backupOptions returns the backup selection given by a command's flags
+func backupOptions(cmd *cobra.Command) backup.Options {
+	tunnels, _ := cmd.Flags().GetStringArray("tunnel")
+	includeKeys, _ := cmd.Flags().GetBool("include-keys")
+	return backup.Options{Tunnels: tunnels, IncludeKeys: includeKeys, Store: config.GetManager().Store()}
+}
+
+// newBackupRestoreCommand creates the backup restore command
+func newBackupRestoreCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "restore <backup-file>",
+		Short: "Restore from backup",
+		Long: `Restore the configuration files in a backup archive, replacing the current
+copies. The archive is checked against its .sha256 file and every file in it
+against the archive's manifest first; nothing is restored if any of them do
+not match. The archive may be given by path or by its name in 'backup list'.
+
+--tunnel restores only the named tunnels and leaves every other file alone.
+Key files are only restored with --include-keys, and never over a different
+existing key. Keys are restored to the same place in the current user's home
+directory; keys outside the home directory are not backed up.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			configManager := config.GetManager()
+			archive := resolveBackup(configManager.GetConfigPath(), args[0])
+
+			restored, err := backup.Restore(archive, configManager.GetConfigPath(), backupOptions(cmd))
+			configManager.Audit().Log(audit.ActionConfigRestore, "", map[string]string{
+				"archive": archive,
+				"files":   strings.Join(restored, ","),
+			}, err)
+			if err != nil {
+				return fmt.Errorf("failed to restore backup: %w", err)
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "✓ Restored %d files from %s\n", len(restored), archive)
+			return nil
+		},
+	}
+
+	addBackupSelectionFlags(cmd)
+	return cmd
+}
+
+// resolveBackup returns the path of a backup given by path or by name in
+// the backup directory
+func resolveBackup(configPath, arg string) string {
+	if _, err := os.Stat(arg); err == nil || strings.ContainsRune(arg, filepath.Separator) {
+		return config.ExpandPath(arg)
+	}
+	return filepath.Join(backup.Dir(configPath), arg)
+}
+
+// newBackupListCommand creates the backup list command
+func newBackupListCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List backups",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			backups, err := backup.List(backup.Dir(config.GetManager().GetConfigPath()))
+			if err != nil {
+				return err
+			}
+			printBackups(cmd.OutOrStdout(), backups)
+			return nil
+		},
+	}
+}
+
+// printBackups prints one line per backup archive, flagging archives that
+// fail their checksum
+func printBackups(w io.Writer, backups []backup.Info) {
+	if len(backups) == 0 {
+		fmt.Fprintln(w, "No backups found.")
+		return
+	}
+
+	fmt.Fprintf(w, "%-36s %-20s %-8s %10s  %s\n", "NAME", "CREATED", "KIND", "SIZE", "CHECKSUM")
+	for _, b := range backups {
+		kind := "manual"
+		if b.Auto {
+			kind = "auto"
+		}
+		checksum := "ok"
+		if err := backup.CheckArchive(b.Path); errors.Is(err, backup.ErrChecksumMismatch) {
+			checksum = "MISMATCH"
+		} else if err != nil {
+			checksum = "unverified"
+		}
+		fmt.Fprintf(w, "%-36s %-20s %-8s %10d  %s\n", b.Name, b.Time.Format("2006-01-02 15:04:05"), kind, b.Size, checksum)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// defaultParallel is how many tunnels bulk commands act on at once
+const defaultParallel = 4
+
+// runBulk calls op for every name, with at most parallel calls running at
+// once; a parallel of 1 runs them one after another. Every name is tried
+// even if some fail. The errors are returned as "name: error" lines, in the
+// order of names.
+func runBulk(names []string, parallel int, op func(name string) error) []string {
+	if parallel < 1 {
+		parallel = 1
+	}
+
+	errs := make([]error, len(names))
+	var g errgroup.Group
+	g.SetLimit(parallel)
+	for i, name := range names {
+		g.Go(func() error {
+			errs[i] = op(name)
+			return nil
+		})
+	}
+	g.Wait()
+
+	var failures []string
+	for i, err := range errs {
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", names[i], err))
+		}
+	}
+	return failures
+}
+
+// checkParallel returns an error unless parallel is a usable --parallel value
+func checkParallel(parallel int) error {
+	if parallel < 1 {
+		return fmt.Errorf("--parallel must be at least 1")
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunBulkLimitsConcurrency(t *testing.T) {
+	names := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+	for _, parallel := range []int{1, 3} {
+		t.Run(fmt.Sprint(parallel), func(t *testing.T) {
+			var running, peak atomic.Int32
+			var calls atomic.Int32
+			failures := runBulk(names, parallel, func(name string) error {
+				calls.Add(1)
+				n := running.Add(1)
+				defer running.Add(-1)
+				for {
+					p := peak.Load()
+					if n <= p || peak.CompareAndSwap(p, n) {
+						break
+					}
+				}
+				time.Sleep(20 * time.Millisecond)
+				if name == "c" {
+					return fmt.Errorf("refused")
+				}
+				return nil
+			})
+
+			assert.Equal(t, int32(len(names)), calls.Load(), "every tunnel must be tried")
+			assert.Equal(t, int32(parallel), peak.Load())
+			assert.Equal(t, []string{"c: refused"}, failures)
+		})
+	}
+}
@@ -1,8 +1,13 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"regexp"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/lerndmina/SSH-Tunnel/internal/config"
 	"github.com/lerndmina/SSH-Tunnel/internal/interactive"
@@ -30,10 +35,14 @@ func newSetupCommand() *cobra.Command {
 		Short: "Setup a new SSH tunnel",
 		Long:  `Interactive setup wizard for creating a new SSH tunnel configuration`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return interactive.StartInteractiveMode()
+			timeout, _ := cmd.Flags().GetDuration("timeout")
+			keyType, _ := cmd.Flags().GetString("force-key-type")
+			return interactive.StartInteractiveModeWithOptions(interactive.Options{Timeout: timeout, KeyType: keyType})
 		},
 	}
 
+	cmd.Flags().Duration("timeout", 0, "SSH connection timeout (default: 10s for tests, 30s for key deployment)")
+	cmd.Flags().String("force-key-type", "", "Generate keys of this type (ed25519, ecdsa or rsa) without asking")
 	return cmd
 }
 
@@ -42,43 +51,40 @@ func newListCommand() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "list",
 		Short: "List all configured tunnels",
-		Long:  `Display a list of all configured SSH tunnels with their status`,
+		Long: `Display a list of all configured SSH tunnels with their status.
+
+--output csv prints the list as CSV with a header row, for spreadsheets.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			output, _ := cmd.Flags().GetString("output")
+			if err := checkOutput(output, "table", "csv"); err != nil {
+				return err
+			}
 			configManager := config.GetManager()
-			configs := configManager.ListConfigs()
+			configs, filtered := selectTunnels(cmd, configManager)
+			entries := listEntries(tunnel.NewManager(), configManager, configs)
 
-			if len(configs) == 0 {
-				fmt.Println("No tunnels configured. Run 'ssh-tunnel setup' to create one.")
-				return nil
+			if output == "csv" {
+				// An empty list is still a CSV file with its header
+				return writeListCSV(os.Stdout, entries)
 			}
 
-			fmt.Printf("%-20s %-15s %-20s %-10s\n", "NAME", "LOCAL_PORT", "REMOTE_HOST", "STATUS")
-			fmt.Println(strings.Repeat("-", 70))
-
-			tunnelManager := tunnel.NewManager()
-			for _, name := range configs {
-				cfg, err := configManager.GetConfig(name)
-				if err != nil {
-					fmt.Printf("%-20s %-15s %-20s %-10s\n", name, "ERROR", "ERROR", "ERROR")
-					continue
-				}
-
-				status := "stopped"
-				if tunnelStatus, err := tunnelManager.GetStatus(name); err == nil && tunnelStatus != nil {
-					status = tunnelStatus.Status.String()
-				}
+			if len(configs) == 0 && filtered {
+				fmt.Println("No tunnels match the given filters.")
+				return nil
+			}
 
-				fmt.Printf("%-20s %-15s %-20s %-10s\n", 
-					name, 
-					fmt.Sprintf("%d", cfg.LocalServer.ReversePort), 
-					fmt.Sprintf("%s:%d", cfg.CloudServer.IP, cfg.CloudServer.Port),
-					status)
+			if len(configs) == 0 {
+				fmt.Println("No tunnels configured. Run 'ssh-tunnel setup' to create one.")
+				return nil
 			}
 
+			writeListTable(os.Stdout, entries)
 			return nil
 		},
 	}
 
+	addFilterFlags(cmd, "Only list")
+	cmd.Flags().StringP("output", "o", "table", "Output format: table or csv")
 	return cmd
 }
 
@@ -87,49 +93,102 @@ func newStartCommand() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "start [tunnel-name]",
 		Short: "Start SSH tunnel(s)",
-		Long:  `Start one or more SSH tunnels by name, or all tunnels if no name provided`,
+		Long: `Start an SSH tunnel by name. Without a name, the active tunnel (see
+'ssh-tunnel use') is started, or all tunnels if none is active.
+
+--local-forward adds a forward to a single tunnel for this run only, on top
+of its configured ones, e.g. --local-forward 8080:db.internal:5432.
+--remote-forward likewise opens an extra port on the cloud server, e.g.
+--remote-forward 9000:localhost:3000 exposes local port 3000 as port 9000.
+Neither is saved to the tunnel's configuration.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			tunnelManager := tunnel.NewManager()
 			configManager := config.GetManager()
+			ttl, _ := cmd.Flags().GetDuration("ttl")
+			wait, _ := cmd.Flags().GetBool("wait")
+			waitTimeout, _ := cmd.Flags().GetDuration("wait-timeout")
+			remoteCheck, _ := cmd.Flags().GetBool("remote-forward-check")
+			tunnelManager.SetRemoteForwardCheck(remoteCheck)
+			parallel, _ := cmd.Flags().GetInt("parallel")
+			if err := checkParallel(parallel); err != nil {
+				return err
+			}
+			args, err := selectArgs(cmd, configManager, tunnelManager, args)
+			if err != nil {
+				return err
+			}
 			
-			all, _ := cmd.Flags().GetBool("all")
+			configs, single, err := tunnelTargets(cmd, configManager, args)
+			if err != nil {
+				return err
+			}
+			if err := setAdHocForwards(cmd, tunnelManager, single); err != nil {
+				return err
+			}
+
+			events := tunnelManager.Subscribe()
+			defer tunnelManager.Unsubscribe(events)
 			
-			if all || len(args) == 0 {
-				// Start all tunnels
-				configs := configManager.ListConfigs()
+			if !single {
+				// Start all tunnels, or all tunnels matching --profile/--tag
 				if len(configs) == 0 {
 					fmt.Println("No tunnels configured. Run 'ssh-tunnel setup' to create one.")
 					return nil
 				}
 				
-				var errors []string
-				for _, name := range configs {
-					if err := tunnelManager.Start(name); err != nil {
-						errors = append(errors, fmt.Sprintf("%s: %v", name, err))
-					} else {
-						fmt.Printf("✓ Started tunnel: %s\n", name)
+				// A group starts with its first tunnel
+				targets, members := groupTargets(configManager, configs)
+				var mu sync.Mutex
+				var started []string
+				errors := runBulk(targets, parallel, func(name string) error {
+					if err := tunnelManager.StartWithTTL(cmd.Context(), name, ttl); err != nil {
+						return err
 					}
-				}
+					if err := waitForTunnel(cmd.Context(), tunnelManager, name, wait, waitTimeout); err != nil {
+						return err
+					}
+					for _, member := range members[name] {
+						fmt.Printf("✓ Started tunnel: %s\n", member)
+					}
+					mu.Lock()
+					started = append(started, members[name]...)
+					mu.Unlock()
+					return nil
+				})
 				
+				// Tunnels that did start still stop on time
+				waitErr := waitForExpiry(cmd.Context(), tunnelManager, events, started)
 				if len(errors) > 0 {
 					return fmt.Errorf("failed to start some tunnels:\n%s", strings.Join(errors, "\n"))
 				}
 				
-				return nil
+				return waitErr
 			}
 			
 			// Start specific tunnel
-			tunnelName := args[0]
-			if err := tunnelManager.Start(tunnelName); err != nil {
+			tunnelName := configs[0]
+			if err := tunnelManager.StartWithTTL(cmd.Context(), tunnelName, ttl); err != nil {
 				return fmt.Errorf("failed to start tunnel '%s': %w", tunnelName, err)
 			}
+			if err := waitForTunnel(cmd.Context(), tunnelManager, tunnelName, wait, waitTimeout); err != nil {
+				return err
+			}
 			
 			fmt.Printf("✓ Started tunnel: %s\n", tunnelName)
-			return nil
+			return waitForExpiry(cmd.Context(), tunnelManager, events, configs)
 		},
 	}
 
 	cmd.Flags().Bool("all", false, "Start all configured tunnels")
+	cmd.Flags().Bool("wait", false, "Wait until the reverse port is confirmed up on the cloud server")
+	cmd.Flags().Duration("wait-timeout", 30*time.Second, "How long --wait waits before failing")
+	cmd.Flags().Bool("remote-forward-check", false, "With --wait, also confirm the reverse port reaches the local SSH server")
+	cmd.Flags().Duration("ttl", 0, "Stop the tunnel automatically after this long, e.g. 2h (default service.max_lifetime); the command waits until then")
+	cmd.Flags().Int("parallel", defaultParallel, "Start at most this many tunnels at once; 1 starts them one by one")
+	cmd.Flags().StringArray("local-forward", nil, "Extra local forward for this run only, [bind_address:]port:host:hostport (repeatable)")
+	cmd.Flags().StringArray("remote-forward", nil, "Extra remote forward for this run only, [bind_address:]port:host:hostport with port on the cloud server (repeatable)")
+	addSelectFlag(cmd)
+	addFilterFlags(cmd, "Start")
 	return cmd
 }
 
@@ -138,29 +197,46 @@ func newStopCommand() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "stop [tunnel-name]",
 		Short: "Stop SSH tunnel(s)",
-		Long:  `Stop one or more SSH tunnels by name, or all tunnels if no name provided`,
+		Long: `Stop an SSH tunnel by name. Without a name, the active tunnel (see
+'ssh-tunnel use') is stopped, or all tunnels if none is active.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			tunnelManager := tunnel.NewManager()
 			configManager := config.GetManager()
 			
-			all, _ := cmd.Flags().GetBool("all")
+			force, _ := cmd.Flags().GetBool("force")
+			parallel, _ := cmd.Flags().GetInt("parallel")
+			if err := checkParallel(parallel); err != nil {
+				return err
+			}
+			args, err := selectArgs(cmd, configManager, tunnelManager, args)
+			if err != nil {
+				return err
+			}
+			configs, single, err := tunnelTargets(cmd, configManager, args)
+			if err != nil {
+				return err
+			}
 			
-			if all || len(args) == 0 {
-				// Stop all tunnels
-				configs := configManager.ListConfigs()
+			if !single {
+				// Stop all tunnels, or all tunnels matching --profile/--tag
 				if len(configs) == 0 {
 					fmt.Println("No tunnels configured.")
 					return nil
 				}
 				
-				var errors []string
-				for _, name := range configs {
-					if err := tunnelManager.Stop(name); err != nil {
-						errors = append(errors, fmt.Sprintf("%s: %v", name, err))
-					} else {
-						fmt.Printf("✓ Stopped tunnel: %s\n", name)
+				// A group stops with its first tunnel
+				targets, members := groupTargets(configManager, configs)
+				errors := runBulk(targets, parallel, func(name string) error {
+					if err := stopTunnel(tunnelManager, name, force); err != nil {
+						return err
 					}
-				}
+					for _, member := range members[name] {
+						if member != name {
+							fmt.Printf("✓ Stopped tunnel: %s\n", member)
+						}
+					}
+					return nil
+				})
 				
 				if len(errors) > 0 {
 					return fmt.Errorf("failed to stop some tunnels:\n%s", strings.Join(errors, "\n"))
@@ -170,32 +246,92 @@ func newStopCommand() *cobra.Command {
 			}
 			
 			// Stop specific tunnel
-			tunnelName := args[0]
-			if err := tunnelManager.Stop(tunnelName); err != nil {
+			tunnelName := configs[0]
+			if err := stopTunnel(tunnelManager, tunnelName, force); err != nil {
 				return fmt.Errorf("failed to stop tunnel '%s': %w", tunnelName, err)
 			}
-			
-			fmt.Printf("✓ Stopped tunnel: %s\n", tunnelName)
 			return nil
 		},
 	}
 
 	cmd.Flags().Bool("all", false, "Stop all configured tunnels")
+	cmd.Flags().Bool("force", false, "Also kill SSH processes for the tunnel started elsewhere, e.g. by a crashed manager")
+	cmd.Flags().Int("parallel", defaultParallel, "Stop at most this many tunnels at once; 1 stops them one by one")
+	addSelectFlag(cmd)
+	addFilterFlags(cmd, "Stop")
 	return cmd
 }
 
+// waitForTunnel waits for a started tunnel to become healthy if wait is
+// set, stopping it again if it does not within timeout
+func waitForTunnel(ctx context.Context, tunnelManager *tunnel.Manager, name string, wait bool, timeout time.Duration) error {
+	if !wait {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if err := tunnelManager.WaitReady(ctx, name); err != nil {
+		// Don't leave a half-working tunnel behind; it may have stopped
+		// already, in which case Stop fails harmlessly
+		_ = tunnelManager.Stop(name)
+		return err
+	}
+	return nil
+}
+
+// stopTunnel stops a tunnel, killing orphaned SSH processes if force is set
+func stopTunnel(tunnelManager *tunnel.Manager, name string, force bool) error {
+	if !force {
+		if err := tunnelManager.Stop(name); err != nil {
+			return err
+		}
+		fmt.Printf("✓ Stopped tunnel: %s\n", name)
+		return nil
+	}
+
+	killed, err := tunnelManager.ForceStop(name)
+	if err != nil {
+		return err
+	}
+	if len(killed) > 0 {
+		fmt.Printf("✓ Stopped tunnel: %s (killed SSH processes %v)\n", name, killed)
+	} else {
+		fmt.Printf("✓ Stopped tunnel: %s\n", name)
+	}
+	return nil
+}
+
 // newRestartCommand creates the restart command
 func newRestartCommand() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "restart [tunnel-name]",
 		Short: "Restart SSH tunnel(s)",
-		Long:  `Restart one or more SSH tunnels by name, or all tunnels if no name provided`,
+		Long: `Restart an SSH tunnel by name. Without a name, the active tunnel (see
+'ssh-tunnel use') is restarted, or all tunnels if none is active. A tunnel
+an earlier 'start' left running is stopped through its lock file; one run
+by another live process, such as the daemon, is left to that process.
+
+With --on-change the command starts the tunnel (or all tunnels with --all)
+and keeps running, watching the tunnel config files. Whenever a tunnel's YAML
+file changes, the tunnel is restarted with the new config once the file has
+been left alone for --debounce. A config that fails to load or validate is
+logged and the tunnel keeps running with its old config.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return fmt.Errorf("restart command not yet implemented")
+			onChange, _ := cmd.Flags().GetBool("on-change")
+			if !onChange {
+				return runRestart(cmd, args)
+			}
+			return runRestartOnChange(cmd, args)
 		},
 	}
 
 	cmd.Flags().Bool("all", false, "Restart all configured tunnels")
+	cmd.Flags().Bool("on-change", false, "Keep running and restart tunnels when their config files change")
+	cmd.Flags().Duration("debounce", defaultRestartDebounce, "With --on-change, how long a config file must stay unchanged before restarting")
+	cmd.Flags().Int("parallel", defaultParallel, "Restart at most this many tunnels at once; 1 restarts them one by one")
+	addSelectFlag(cmd)
 	return cmd
 }
 
@@ -204,81 +340,71 @@ func newStatusCommand() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "status [tunnel-name]",
 		Short: "Show tunnel status",
-		Long:  `Display the status of one or more SSH tunnels`,
+		Long: `Display the status of one or more SSH tunnels.
+
+With --watch the display refreshes continuously, showing reconnect attempts,
+the next retry time and the last error while a tunnel is flapping.
+
+--output wide adds the start date and time, SSH process ID, cloud endpoint,
+reverse and SOCKS ports, reconnect count and last error to the table of
+tunnels.
+
+--output csv prints the wide table as CSV with a header row, for
+spreadsheets.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			tunnelManager := tunnel.NewManager()
 			configManager := config.GetManager()
 			
 			all, _ := cmd.Flags().GetBool("all")
-			
-			if all || len(args) == 0 {
-				// Show status for all tunnels
-				configs := configManager.ListConfigs()
-				if len(configs) == 0 {
-					fmt.Println("No tunnels configured.")
-					return nil
+			watch, _ := cmd.Flags().GetBool("watch")
+			interval, _ := cmd.Flags().GetDuration("interval")
+			output, _ := cmd.Flags().GetString("output")
+			if err := checkOutput(output, "table", "wide", "csv"); err != nil {
+				return err
+			}
+			configs, filtered := selectTunnels(cmd, configManager)
+
+			if output == "csv" {
+				if watch {
+					return fmt.Errorf("--watch cannot be used with --output csv")
 				}
-				
-				fmt.Printf("%-20s %-15s %-15s %-20s\n", "NAME", "STATUS", "UPTIME", "DETAILS")
-				fmt.Println(strings.Repeat("-", 75))
-				
-				for _, name := range configs {
-					status, err := tunnelManager.GetStatus(name)
-					if err != nil {
-						fmt.Printf("%-20s %-15s %-15s %-20s\n", name, "ERROR", "-", err.Error())
-						continue
-					}
-					
-					uptime := "-"
-					if status != nil && !status.StartTime.IsZero() {
-						uptime = status.StartTime.Format("15:04:05")
-					}
-					
-					details := "-"
-					if status != nil && status.Error != nil {
-						details = status.Error.Error()
+				if !all && !filtered && len(args) > 0 {
+					configs = args[:1]
+				}
+				return writeStatusCSV(os.Stdout, statusRows(tunnelManager, configManager, configs), true)
+			}
+
+			render := func() error {
+				if all || filtered || len(args) == 0 {
+					// Show status for all tunnels, or those matching --profile/--tag
+					if len(configs) == 0 && filtered {
+						fmt.Println("No tunnels match the given filters.")
+						return nil
 					}
-					
-					statusStr := "stopped"
-					if status != nil {
-						statusStr = status.Status.String()
+					if len(configs) == 0 {
+						fmt.Println("No tunnels configured.")
+						return nil
 					}
-					
-					fmt.Printf("%-20s %-15s %-15s %-20s\n", name, statusStr, uptime, details)
+					printStatusTable(os.Stdout, tunnelManager, configManager, configs, output == "wide")
+					return nil
 				}
-				
-				return nil
-			}
-			
-			// Show status for specific tunnel
-			tunnelName := args[0]
-			status, err := tunnelManager.GetStatus(tunnelName)
-			if err != nil {
-				return fmt.Errorf("failed to get status for tunnel '%s': %w", tunnelName, err)
+
+				// Show status for specific tunnel
+				return printStatusDetail(os.Stdout, tunnelManager, args[0])
 			}
-			
-			fmt.Printf("Tunnel: %s\n", tunnelName)
-			if status != nil {
-				fmt.Printf("Status: %s\n", status.Status.String())
-				if !status.StartTime.IsZero() {
-					fmt.Printf("Started: %s\n", status.StartTime.Format("2006-01-02 15:04:05"))
-				}
-				if !status.LastHealthCheck.IsZero() {
-					fmt.Printf("Last Health Check: %s\n", status.LastHealthCheck.Format("2006-01-02 15:04:05"))
-				}
-				if status.Error != nil {
-					fmt.Printf("Error: %s\n", status.Error.Error())
-				}
-			} else {
-				fmt.Println("Status: stopped")
+
+			if !watch {
+				return render()
 			}
-			
-			return nil
+			return watchStatus(cmd.Context(), interval, render)
 		},
 	}
 
 	cmd.Flags().Bool("all", false, "Show status for all tunnels")
+	addFilterFlags(cmd, "Show status for")
 	cmd.Flags().Bool("watch", false, "Watch status continuously")
+	cmd.Flags().Duration("interval", 2*time.Second, "Refresh interval for --watch")
+	cmd.Flags().StringP("output", "o", "table", "Output format: table, wide or csv")
 	return cmd
 }
 
@@ -287,14 +413,55 @@ func newLogsCommand() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "logs [tunnel-name]",
 		Short: "Show tunnel logs",
-		Long:  `Display logs for one or more SSH tunnels`,
+		Long: `Display the SSH output captured for a tunnel.
+
+Each line is tagged with a severity (info/warn/error) based on known SSH
+messages. Use --raw to print the captured output untouched.
+
+--grep keeps only lines matching a regular expression, and combines with
+--follow to tail just those lines:
+
+  ssh-tunnel logs home -f --grep 'error|refused'
+
+With --select instead of a name, the tunnel is picked from a list.`,
+		Args: cobra.MaximumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return fmt.Errorf("logs command not yet implemented")
+			configManager := config.GetManager()
+			args, err := selectArgs(cmd, configManager, tunnel.NewManagerWithConfig(configManager), args)
+			if err != nil {
+				return err
+			}
+			if len(args) == 0 {
+				return fmt.Errorf("specify a tunnel name, or --select to pick one")
+			}
+			tunnelName := args[0]
+			if _, err := configManager.GetConfig(tunnelName); err != nil {
+				return err
+			}
+
+			follow, _ := cmd.Flags().GetBool("follow")
+			lines, _ := cmd.Flags().GetInt("lines")
+			raw, _ := cmd.Flags().GetBool("raw")
+			pattern, _ := cmd.Flags().GetString("grep")
+
+			var grep *regexp.Regexp
+			if pattern != "" {
+				var err error
+				if grep, err = regexp.Compile(pattern); err != nil {
+					return fmt.Errorf("invalid --grep pattern: %w", err)
+				}
+			}
+
+			logFile := tunnel.LogFile(configManager.GetConfigPath(), tunnelName)
+			return showLogs(cmd.Context(), os.Stdout, logFile, lines, follow, raw, grep)
 		},
 	}
 
 	cmd.Flags().BoolP("follow", "f", false, "Follow log output")
 	cmd.Flags().IntP("lines", "n", 50, "Number of lines to show")
+	cmd.Flags().Bool("raw", false, "Print captured output without severity tags")
+	cmd.Flags().String("grep", "", "Only show lines matching this regular expression")
+	addSelectFlag(cmd)
 	return cmd
 }
 
@@ -335,6 +502,12 @@ func newConfigCommand() *cobra.Command {
 				return fmt.Errorf("config delete not yet implemented")
 			},
 		},
+		newConfigDiffCommand(),
+		newConfigSetCommand(),
+		newConfigGetCommand(),
+		newConfigImportCommand(),
+		newConfigExportCommand(),
+		newConfigLintCommand(),
 	)
 
 	return cmd
@@ -349,27 +522,9 @@ func newBackupCommand() *cobra.Command {
 	}
 
 	cmd.AddCommand(
-		&cobra.Command{
-			Use:   "create",
-			Short: "Create backup",
-			RunE: func(cmd *cobra.Command, args []string) error {
-				return fmt.Errorf("backup create not yet implemented")
-			},
-		},
-		&cobra.Command{
-			Use:   "restore [backup-file]",
-			Short: "Restore from backup",
-			RunE: func(cmd *cobra.Command, args []string) error {
-				return fmt.Errorf("backup restore not yet implemented")
-			},
-		},
-		&cobra.Command{
-			Use:   "list",
-			Short: "List backups",
-			RunE: func(cmd *cobra.Command, args []string) error {
-				return fmt.Errorf("backup list not yet implemented")
-			},
-		},
+		newBackupCreateCommand(),
+		newBackupRestoreCommand(),
+		newBackupListCommand(),
 	)
 
 	return cmd
@@ -393,48 +548,72 @@ func newMonitorCommand() *cobra.Command {
 // newDiagnosticsCommand creates the diagnostics command
 func newDiagnosticsCommand() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:   "diagnostics [tunnel-name]",
-		Short: "Run diagnostics on tunnels",
-		Long:  `Run comprehensive diagnostics on SSH tunnels to identify issues`,
+		Use:     "diagnostics [tunnel-name]",
+		Aliases: []string{"doctor"},
+		Short:   "Run diagnostics on tunnels",
+		Long: `Run comprehensive diagnostics on SSH tunnels to identify issues.
+
+The command exits nonzero if any critical check fails. With --json the
+results are printed as JSON for scripts and configuration management: each
+check has an id, ok flag, severity and, when it fails, a hint on fixing it.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return fmt.Errorf("diagnostics command not yet implemented")
-		},
-	}
+			configManager := config.GetManager()
 
-	cmd.Flags().Bool("performance", false, "Include performance tests")
-	cmd.Flags().Bool("connectivity", false, "Test connectivity only")
-	return cmd
-}
+			names := args
+			if len(names) == 0 {
+				names = configManager.ListConfigs()
+			}
+			if len(names) == 0 {
+				fmt.Println("No tunnels configured. Run 'ssh-tunnel setup' to create one.")
+				return nil
+			}
 
-// newRemoteSetupCommand creates the remote setup command
-func newRemoteSetupCommand() *cobra.Command {
-	cmd := &cobra.Command{
-		Use:   "remote-setup [flags] <host>",
-		Short: "Setup a remote server for SSH tunneling",
-		Long: `Deploy and run the remote setup script on a cloud server to prepare it for SSH tunneling.
-
-This command will:
-- Copy the remote setup script to the target server
-- Run the script to install required packages
-- Configure SSH daemon for secure tunneling
-- Setup firewall rules and security measures
-- Create a dedicated tunnel user
-
-Examples:
-  ssh-tunnel remote-setup 1.2.3.4
-  ssh-tunnel remote-setup --user ubuntu --key ~/.ssh/id_rsa.pub server.example.com`,
-		Args: cobra.ExactArgs(1),
-		RunE: func(cmd *cobra.Command, args []string) error {
-			return fmt.Errorf("remote-setup command not yet implemented")
+			opts := diagnosticsOptions{}
+			opts.performance, _ = cmd.Flags().GetBool("performance")
+			opts.connectivityOnly, _ = cmd.Flags().GetBool("connectivity")
+			opts.timeout, _ = cmd.Flags().GetDuration("timeout")
+			opts.socksURL, _ = cmd.Flags().GetString("socks-url")
+			opts.remoteForward, _ = cmd.Flags().GetBool("remote-forward-check")
+			asJSON, _ := cmd.Flags().GetBool("json")
+
+			var reports []diagnosticsReport
+			for _, name := range names {
+				cfg, err := configManager.GetConfig(name)
+				if err != nil {
+					return err
+				}
+
+				if !asJSON {
+					fmt.Printf("Diagnostics for tunnel: %s\n", name)
+				}
+				report := diagnosticsReport{tunnel: name, checks: runDiagnostics(cfg, opts)}
+				if !asJSON {
+					for _, check := range report.checks {
+						printDiagnosticCheck(check)
+					}
+					fmt.Println()
+				}
+				reports = append(reports, report)
+			}
+
+			if asJSON {
+				if err := writeDiagnosticsJSON(cmd.OutOrStdout(), reports); err != nil {
+					return err
+				}
+			}
+			if failures := diagnosticsFailures(reports); failures > 0 {
+				return fmt.Errorf("diagnostics found %d problem(s)", failures)
+			}
+			return nil
 		},
 	}
 
-	cmd.Flags().StringP("user", "u", "root", "SSH user for connecting to remote server")
-	cmd.Flags().StringP("key", "k", "", "Path to public key file to deploy")
-	cmd.Flags().StringP("tunnel-user", "t", "tunneluser", "Username to create for tunnel connections")
-	cmd.Flags().IntP("port", "p", 22, "SSH port on remote server")
-	cmd.Flags().Bool("dry-run", false, "Show what would be done without executing")
-
+	cmd.Flags().Bool("performance", false, "Include performance tests")
+	cmd.Flags().Bool("connectivity", false, "Test connectivity only")
+	cmd.Flags().Duration("timeout", 0, "SSH connection timeout (default 10s)")
+	cmd.Flags().String("socks-url", "", "URL to fetch through the SOCKS proxy (default socks_check_url)")
+	cmd.Flags().Bool("remote-forward-check", false, "Check from the cloud server that the reverse port reaches the local SSH server")
+	cmd.Flags().Bool("json", false, "Print the results as JSON with an id, severity and fix hint for each check")
 	return cmd
 }
 
@@ -461,13 +640,8 @@ func newTemplateCommand() *cobra.Command {
 				return fmt.Errorf("template show not yet implemented")
 			},
 		},
-		&cobra.Command{
-			Use:   "apply [template-name] [tunnel-name]",
-			Short: "Apply template to create new tunnel",
-			RunE: func(cmd *cobra.Command, args []string) error {
-				return fmt.Errorf("template apply not yet implemented")
-			},
-		},
+		newTemplateApplyCommand(),
+		newTemplateRenderCommand(),
 	)
 
 	return cmd
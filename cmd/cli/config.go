@@ -0,0 +1,383 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/lerndmina/SSH-Tunnel/internal/config"
+	"github.com/lerndmina/SSH-Tunnel/internal/ssh"
+	"github.com/spf13/cobra"
+)
+
+// newConfigDiffCommand creates the config diff command
+func newConfigDiffCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "diff <tunnel-a> [tunnel-b]",
+		Short: "Show field-level differences between configurations",
+		Long: `Compare two tunnel configurations field by field, ignoring timestamps
+and key order.
+
+With --backup, <tunnel-a> is compared against a saved copy of a tunnel
+configuration file instead of a second tunnel.`,
+		Args: cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			backup, _ := cmd.Flags().GetString("backup")
+			if backup == "" && len(args) != 2 {
+				return fmt.Errorf("specify two tunnels, or one tunnel and --backup <file>")
+			}
+			if backup != "" && len(args) != 1 {
+				return fmt.Errorf("--backup compares a single tunnel against the file")
+			}
+
+			configManager := config.GetManager()
+			a, err := configManager.GetConfig(args[0])
+			if err != nil {
+				return err
+			}
+
+			var b *config.Config
+			labelB := backup
+			if backup != "" {
+				b, err = config.ReadConfigFile(config.ExpandPath(backup))
+			} else {
+				labelB = args[1]
+				b, err = configManager.GetConfig(args[1])
+			}
+			if err != nil {
+				return err
+			}
+
+			diffs, err := config.DiffConfigs(a, b)
+			if err != nil {
+				return err
+			}
+
+			printConfigDiff(os.Stdout, args[0], labelB, diffs)
+			return nil
+		},
+	}
+
+	cmd.Flags().String("backup", "", "Compare against a saved configuration file")
+	return cmd
+}
+
+// newConfigSetCommand creates the config set command
+func newConfigSetCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "set <tunnel-name> <path>=<value>...",
+		Short: "Set configuration fields",
+		Long: `Set one or more fields of a tunnel configuration without opening an editor.
+
+Fields are named by their YAML path, e.g. ssh.compression or
+performance.keep_alive_interval; a field name that is unique across sections,
+like reverse_port, may be used on its own. Items of lists are addressed by
+index, e.g. local_server.local_forwards[0].local_port, and list values such as
+tags are comma-separated.
+
+Values are checked against the field's type and the result is validated
+before anything is saved. Values inherited from defaults.yaml stay inherited.`,
+		Example: `  ssh-tunnel config set home ssh.compression=true
+  ssh-tunnel config set home performance.keep_alive_interval=15 reverse_port=2223`,
+		Args: cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			updates := make([]config.FieldUpdate, 0, len(args)-1)
+			for _, arg := range args[1:] {
+				update, err := config.ParseFieldUpdate(arg)
+				if err != nil {
+					return err
+				}
+				updates = append(updates, update)
+			}
+
+			if _, err := config.GetManager().SetFields(args[0], updates); err != nil {
+				return err
+			}
+
+			fmt.Printf("Updated %d field(s) of '%s'\n", len(updates), args[0])
+			return nil
+		},
+	}
+}
+
+// newConfigGetCommand creates the config get command
+func newConfigGetCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "get <tunnel-name> [path]",
+		Short: "Print a configuration field",
+		Long: `Print the value of a single field of a tunnel's effective configuration,
+with nothing else on the line, so it can be captured by a shell:
+
+  PORT=$(ssh-tunnel config get home reverse_port)
+
+Fields are named as for config set. With --all, every field is printed as
+<path>=<value>, one per line.`,
+		Args: cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			all, _ := cmd.Flags().GetBool("all")
+			if all == (len(args) == 2) {
+				return fmt.Errorf("specify a field path or --all")
+			}
+
+			cfg, err := config.GetManager().GetConfig(args[0])
+			if err != nil {
+				return err
+			}
+
+			if all {
+				for _, field := range cfg.Fields() {
+					fmt.Printf("%s=%s\n", field.Path, field.Value)
+				}
+				return nil
+			}
+
+			value, err := cfg.GetField(args[1])
+			if err != nil {
+				return err
+			}
+			fmt.Println(value)
+			return nil
+		},
+	}
+
+	cmd.Flags().Bool("all", false, "Print every field as <path>=<value>")
+	return cmd
+}
+
+// newConfigImportCommand creates the config import command
+func newConfigImportCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "import <file>|-",
+		Short: "Import tunnel configurations from YAML",
+		Long: `Import tunnel configurations from a YAML file, or from standard input
+with "-". The file may hold a single configuration or several, one per YAML
+document separated by "---", such as the output of config export.
+
+Every configuration is validated before any is saved, so a bad document
+imports nothing. Existing tunnels are only replaced with --overwrite.
+
+With --generate-key, key files the configurations reference that do not
+exist yet are generated, and their public keys printed for deployment.`,
+		Example: `  ssh-tunnel config import tunnels.yaml
+  git show main:tunnels/home.yaml | ssh-tunnel config import - --overwrite
+  ssh-tunnel config import tunnels.yaml --generate-key`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			overwrite, _ := cmd.Flags().GetBool("overwrite")
+			keyType, err := generateKeyType(cmd)
+			if err != nil {
+				return err
+			}
+
+			in := cmd.InOrStdin()
+			if args[0] != "-" {
+				file, err := os.Open(config.ExpandPath(args[0]))
+				if err != nil {
+					return fmt.Errorf("failed to open %s: %w", args[0], err)
+				}
+				defer file.Close()
+				in = file
+			}
+
+			return importConfigs(cmd.OutOrStdout(), config.GetManager(), in, overwrite, keyType)
+		},
+	}
+
+	cmd.Flags().Bool("overwrite", false, "Replace tunnels that already exist")
+	addGenerateKeyFlags(cmd)
+	return cmd
+}
+
+// newConfigExportCommand creates the config export command
+func newConfigExportCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "export [tunnel-name...]",
+		Short: "Export tunnel configurations as YAML",
+		Long: `Print tunnel configurations as YAML that config import reads back, one
+document per tunnel. Name the tunnels to export, or use --all for every
+tunnel in the current profile.
+
+Key file paths are specific to the machine the keys live on; --no-keys leaves
+them out so the importing machine's defaults.yaml supplies its own. Key files
+themselves are never exported; use backup create --include-keys for those.`,
+		Example: `  ssh-tunnel config export home > home.yaml
+  ssh-tunnel config export --all --no-keys > tunnels.yaml`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			all, _ := cmd.Flags().GetBool("all")
+			noKeys, _ := cmd.Flags().GetBool("no-keys")
+			if all == (len(args) > 0) {
+				return fmt.Errorf("specify tunnel names or --all")
+			}
+			return exportConfigs(cmd.OutOrStdout(), config.GetManager(), args, noKeys)
+		},
+	}
+
+	cmd.Flags().Bool("all", false, "Export every tunnel")
+	cmd.Flags().Bool("no-keys", false, "Leave out key file paths")
+	return cmd
+}
+
+// newConfigLintCommand creates the config lint command
+func newConfigLintCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "lint",
+		Short: "Check tunnel configurations for conflicts",
+		Long: `Check all tunnel configurations against each other and warn about
+tunnels that would conflict if run together: tunnels listening on the same
+port of the same cloud server, with a reverse port or remote forward, tunnels
+listening on the same local port, with a local forward or SOCKS proxy, and
+tunnels sharing a service name. Members of a group that connect to different
+cloud servers, as different users or with different keys are reported too.
+
+Exits nonzero if there are warnings, so it can gate deployments.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return lintConfigs(cmd.OutOrStdout(), config.GetManager())
+		},
+	}
+}
+
+// lintConfigs prints warnings about conflicting tunnel configurations,
+// returning an error if there are any
+func lintConfigs(out io.Writer, configManager *config.Manager) error {
+	names := configManager.ListConfigs()
+	sort.Strings(names)
+
+	configs := make([]*config.Config, 0, len(names))
+	for _, name := range names {
+		cfg, err := configManager.GetConfig(name)
+		if err != nil {
+			return err
+		}
+		configs = append(configs, cfg)
+	}
+
+	warnings := config.LintConfigs(configs)
+	if len(warnings) == 0 {
+		fmt.Fprintf(out, "✓ No conflicts between %d tunnel(s)\n", len(configs))
+		return nil
+	}
+	for _, warning := range warnings {
+		fmt.Fprintf(out, "Warning: %s\n", warning)
+	}
+	return fmt.Errorf("found %d conflict(s)", len(warnings))
+}
+
+// exportConfigs writes the named tunnels' configurations, or every tunnel's
+// if names is empty, as a YAML stream
+func exportConfigs(out io.Writer, configManager *config.Manager, names []string, noKeys bool) error {
+	if len(names) == 0 {
+		names = configManager.ListConfigs()
+		sort.Strings(names)
+		if len(names) == 0 {
+			return fmt.Errorf("no tunnels configured")
+		}
+	}
+
+	configs := make([]*config.Config, 0, len(names))
+	for _, name := range names {
+		cfg, err := configManager.GetConfig(name)
+		if err != nil {
+			return err
+		}
+		configs = append(configs, cfg)
+	}
+	return config.ExportConfigs(out, configs, noKeys)
+}
+
+// importConfigs saves the tunnel configurations read from in, refusing to
+// replace existing tunnels unless overwrite is set. Every configuration is
+// validated before any is saved, and missing keys are generated with keyType
+// only once all are saved. If saving or generating fails, the tunnels saved
+// are restored or deleted and the keys generated removed.
+func importConfigs(out io.Writer, configManager *config.Manager, in io.Reader, overwrite bool, keyType string) (err error) {
+	configs, err := configManager.DecodeConfigs(in)
+	if err != nil {
+		return err
+	}
+
+	previous := make(map[string]*config.Config)
+	for _, cfg := range configs {
+		if err := cfg.Validate(); err != nil {
+			return fmt.Errorf("invalid configuration '%s': %w", cfg.TunnelName, err)
+		}
+		existing, err := configManager.GetConfig(cfg.TunnelName)
+		if err != nil {
+			continue
+		}
+		if !overwrite {
+			return fmt.Errorf("tunnel '%s' already exists (use --overwrite to replace it)", cfg.TunnelName)
+		}
+		previous[cfg.TunnelName] = existing
+	}
+
+	var saved, keys []string
+	defer func() {
+		if err != nil {
+			err = errors.Join(err, rollbackImport(configManager, saved, previous, keys))
+		}
+	}()
+
+	for _, cfg := range configs {
+		if err := configManager.SaveConfig(cfg); err != nil {
+			return err
+		}
+		saved = append(saved, cfg.TunnelName)
+	}
+	if keyType != "" {
+		km := ssh.NewKeyManager()
+		for _, cfg := range configs {
+			generated, err := generateMissingKeys(out, km, cfg, keyType)
+			keys = append(keys, generated...)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, cfg := range configs {
+		fmt.Fprintf(out, "✓ Imported tunnel '%s'\n", cfg.TunnelName)
+	}
+	return nil
+}
+
+// rollbackImport undoes a failed import: the tunnels saved are restored to
+// their previous configurations, or deleted if they were new, and the
+// generated key pairs are removed
+func rollbackImport(configManager *config.Manager, saved []string, previous map[string]*config.Config, keys []string) error {
+	errs := []error{removeKeyPairs(keys)}
+	for _, name := range saved {
+		if cfg, ok := previous[name]; ok {
+			errs = append(errs, configManager.SaveConfig(cfg))
+		} else {
+			errs = append(errs, configManager.DeleteConfig(name))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("failed to roll back the import: %w", err)
+	}
+	return nil
+}
+
+// printConfigDiff prints a field-level diff: "-" fields only in a, "+" only
+// in b, and "~" fields whose values differ
+func printConfigDiff(w io.Writer, labelA, labelB string, diffs []config.FieldDiff) {
+	if len(diffs) == 0 {
+		fmt.Fprintf(w, "No differences between %s and %s\n", labelA, labelB)
+		return
+	}
+
+	fmt.Fprintf(w, "--- %s\n+++ %s\n", labelA, labelB)
+	for _, d := range diffs {
+		switch {
+		case d.New == nil:
+			fmt.Fprintf(w, "- %s: %v\n", d.Path, d.Old)
+		case d.Old == nil:
+			fmt.Fprintf(w, "+ %s: %v\n", d.Path, d.New)
+		default:
+			fmt.Fprintf(w, "~ %s: %v → %v\n", d.Path, d.Old, d.New)
+		}
+	}
+}
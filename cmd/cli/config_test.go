@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lerndmina/SSH-Tunnel/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const multiDocConfigs = `tunnel_name: home
+cloud_server:
+  ip: 203.0.113.1
+  user: ubuntu
+local_server:
+  reverse_port: 2222
+---
+tunnel_name: office
+cloud_server:
+  ip: 203.0.113.2
+  user: admin
+local_server:
+  reverse_port: 2223
+---
+`
+
+func TestImportMultiDocumentConfigs(t *testing.T) {
+	configManager, err := config.NewManager(t.TempDir())
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	require.NoError(t, importConfigs(&out, configManager, strings.NewReader(multiDocConfigs), false, ""))
+	assert.Contains(t, out.String(), "Imported tunnel 'home'")
+	assert.Contains(t, out.String(), "Imported tunnel 'office'")
+
+	home, err := configManager.GetConfig("home")
+	require.NoError(t, err)
+	assert.Equal(t, "203.0.113.1", home.CloudServer.IP)
+	assert.Equal(t, 2222, home.LocalServer.ReversePort)
+
+	office, err := configManager.GetConfig("office")
+	require.NoError(t, err)
+	assert.Equal(t, "admin", office.CloudServer.User)
+
+	// Importing again replaces nothing without --overwrite
+	err = importConfigs(&out, configManager, strings.NewReader(multiDocConfigs), false, "")
+	assert.ErrorContains(t, err, "already exists")
+
+	changed := strings.Replace(multiDocConfigs, "203.0.113.2", "198.51.100.7", 1)
+	require.NoError(t, importConfigs(&out, configManager, strings.NewReader(changed), true, ""))
+	office, err = configManager.GetConfig("office")
+	require.NoError(t, err)
+	assert.Equal(t, "198.51.100.7", office.CloudServer.IP)
+}
+
+func TestImportRejectsInvalidDocumentBeforeSaving(t *testing.T) {
+	configManager, err := config.NewManager(t.TempDir())
+	require.NoError(t, err)
+
+	input := multiDocConfigs + "cloud_server:\n  ip: 203.0.113.3\n"
+	err = importConfigs(&bytes.Buffer{}, configManager, strings.NewReader(input), false, "")
+	assert.ErrorContains(t, err, "document 3: tunnel_name is required")
+	assert.Empty(t, configManager.ListConfigs())
+
+	err = importConfigs(&bytes.Buffer{}, configManager, strings.NewReader("tunnel_name: ../escape\n"), false, "")
+	assert.ErrorContains(t, err, "invalid tunnel_name")
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	source, err := config.NewManager(t.TempDir())
+	require.NoError(t, err)
+	require.NoError(t, importConfigs(&bytes.Buffer{}, source, strings.NewReader(multiDocConfigs), false, ""))
+	home, err := source.GetConfig("home")
+	require.NoError(t, err)
+	home.SSH.PrivateKeyPath = "/home/pi/.ssh/cloud_server_key"
+	home.Tags = []string{"lab"}
+	require.NoError(t, source.SaveConfig(home))
+
+	var exported bytes.Buffer
+	require.NoError(t, exportConfigs(&exported, source, nil, false))
+
+	target, err := config.NewManager(t.TempDir())
+	require.NoError(t, err)
+	require.NoError(t, importConfigs(&bytes.Buffer{}, target, &exported, false, ""))
+
+	names := target.ListConfigs()
+	assert.ElementsMatch(t, []string{"home", "office"}, names)
+	for _, name := range names {
+		want, err := source.GetConfig(name)
+		require.NoError(t, err)
+		got, err := target.GetConfig(name)
+		require.NoError(t, err)
+		diffs, err := config.DiffConfigs(want, got)
+		require.NoError(t, err)
+		assert.Empty(t, diffs, name)
+	}
+}
+
+func TestExportWithoutKeys(t *testing.T) {
+	configManager, err := config.NewManager(t.TempDir())
+	require.NoError(t, err)
+	require.NoError(t, importConfigs(&bytes.Buffer{}, configManager, strings.NewReader(multiDocConfigs), false, ""))
+	home, err := configManager.GetConfig("home")
+	require.NoError(t, err)
+	home.SSH.PrivateKeyPath = "/home/pi/.ssh/cloud_server_key"
+	require.NoError(t, configManager.SaveConfig(home))
+
+	var out bytes.Buffer
+	require.NoError(t, exportConfigs(&out, configManager, []string{"home"}, true))
+	assert.NotContains(t, out.String(), "private_key_path")
+	assert.NotContains(t, out.String(), "natted_key_path")
+	assert.Contains(t, out.String(), "tunnel_name: home")
+	assert.NotContains(t, out.String(), "---")
+}
+
+func TestConfigLintWarnsAboutCollisions(t *testing.T) {
+	configManager, err := config.NewManager(t.TempDir())
+	require.NoError(t, err)
+	var out bytes.Buffer
+	require.NoError(t, importConfigs(&out, configManager, strings.NewReader(multiDocConfigs), false, ""))
+
+	out.Reset()
+	require.NoError(t, lintConfigs(&out, configManager))
+	assert.Contains(t, out.String(), "No conflicts")
+
+	clash := &config.Config{TunnelName: "home-copy"}
+	clash.CloudServer.IP = "203.0.113.1"
+	clash.LocalServer.ReversePort = 2222
+	require.NoError(t, configManager.SaveConfig(clash))
+
+	out.Reset()
+	err = lintConfigs(&out, configManager)
+	assert.EqualError(t, err, "found 1 conflict(s)")
+	assert.Contains(t, out.String(), "remote endpoint 203.0.113.1:2222 is used by several tunnels: home, home-copy")
+}
+
+func TestImportGeneratesMissingKeys(t *testing.T) {
+	configManager, err := config.NewManager(t.TempDir())
+	require.NoError(t, err)
+
+	keyDir := t.TempDir()
+	existing := filepath.Join(keyDir, "existing_key")
+	require.NoError(t, os.WriteFile(existing, []byte("existing private key"), 0600))
+	missing := filepath.Join(keyDir, "keys", "missing_key")
+
+	input := fmt.Sprintf(`tunnel_name: home
+cloud_server:
+  ip: 203.0.113.1
+  user: ubuntu
+local_server:
+  reverse_port: 2222
+ssh:
+  private_key_path: %s
+  natted_key_path: %s
+`, missing, existing)
+
+	var out bytes.Buffer
+	require.NoError(t, importConfigs(&out, configManager, strings.NewReader(input), false, "ed25519"))
+
+	// The missing key is created with its public key printed
+	pubKey, err := os.ReadFile(missing + ".pub")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(pubKey), "ssh-ed25519 "))
+	assert.Contains(t, out.String(), "Generated ed25519 key "+missing)
+	assert.Contains(t, out.String(), "authorized_keys of ubuntu@203.0.113.1")
+	assert.Contains(t, out.String(), strings.TrimSpace(string(pubKey)))
+
+	// The existing one is untouched
+	data, err := os.ReadFile(existing)
+	require.NoError(t, err)
+	assert.Equal(t, "existing private key", string(data))
+	assert.NoFileExists(t, existing+".pub")
+	assert.NotContains(t, out.String(), existing)
+}
+
+func TestImportRollsBackWhenKeyGenerationFails(t *testing.T) {
+	configManager, err := config.NewManager(t.TempDir())
+	require.NoError(t, err)
+	require.NoError(t, importConfigs(&bytes.Buffer{}, configManager, strings.NewReader(multiDocConfigs), false, ""))
+
+	keyDir := t.TempDir()
+	generated := filepath.Join(keyDir, "home_key")
+	// A link into a missing directory, which the key cannot be written through
+	unwritable := filepath.Join(keyDir, "lab_key")
+	require.NoError(t, os.Symlink(filepath.Join(keyDir, "missing", "lab_key"), unwritable))
+
+	// home is replaced and gets a new key; lab's key cannot be written
+	input := fmt.Sprintf(`tunnel_name: home
+cloud_server:
+  ip: 198.51.100.7
+local_server:
+  reverse_port: 2222
+ssh:
+  private_key_path: %s
+---
+tunnel_name: lab
+cloud_server:
+  ip: 198.51.100.8
+local_server:
+  reverse_port: 2224
+ssh:
+  private_key_path: %s
+`, generated, unwritable)
+
+	var out bytes.Buffer
+	err = importConfigs(&out, configManager, strings.NewReader(input), true, "ed25519")
+	assert.ErrorContains(t, err, "failed to generate key")
+	assert.NotContains(t, out.String(), "Imported tunnel")
+
+	home, err := configManager.GetConfig("home")
+	require.NoError(t, err)
+	assert.Equal(t, "203.0.113.1", home.CloudServer.IP, "home is restored")
+	_, err = configManager.GetConfig("lab")
+	assert.Error(t, err, "lab is removed again")
+	assert.NoFileExists(t, generated)
+	assert.NoFileExists(t, generated+".pub")
+	_, err = os.Lstat(unwritable)
+	assert.NoError(t, err, "the link is left alone")
+}
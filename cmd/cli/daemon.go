@@ -0,0 +1,332 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+
+	"github.com/coreos/go-systemd/v22/daemon"
+	"github.com/lerndmina/SSH-Tunnel/internal/backup"
+	"github.com/lerndmina/SSH-Tunnel/internal/config"
+	"github.com/lerndmina/SSH-Tunnel/internal/tunnel"
+	"github.com/lerndmina/SSH-Tunnel/pkg/logger"
+	"github.com/spf13/cobra"
+)
+
+// newDaemonCommand creates the daemon command
+func newDaemonCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "daemon",
+		Short: "Run tunnels in the foreground as a service",
+		Long: `Start tunnels and keep them supervised until the process is stopped
+with SIGINT or SIGTERM, then stop them. Installed services run this command.
+
+SIGHUP reloads the configuration: tunnels whose config changed are
+restarted, removed tunnels are stopped and the rest are left alone.
+
+Without --tunnel, every configured tunnel is started, including tunnels
+added before a reload.
+
+If daemon.health_port is set in settings.yaml, the daemon serves /healthz
+(200 while it is up) and /readyz (200 once every tunnel is running, 503
+otherwise) on that port, each with a JSON summary of the tunnels.
+
+Under systemd the daemon reports READY=1 once its tunnels are started and
+sends watchdog heartbeats at half the unit's WatchdogSec, so a hung daemon
+is restarted. The systemd units ssh-tunnel installs set Type=notify and
+WatchdogSec=30. If automatic backups are configured in settings.yaml, the
+daemon also takes them.
+
+Tunnels with service.health_check_interval set are health checked that
+often and reconnected when a check fails; --remote-forward-check adds the
+check that the reverse port reaches the local SSH server.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			names, _ := cmd.Flags().GetStringArray("tunnel")
+			configManager := config.GetManager()
+			all := len(names) == 0
+			if all {
+				names = configManager.ListConfigs()
+			}
+
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			reload := make(chan os.Signal, 1)
+			signal.Notify(reload, syscall.SIGHUP)
+			defer signal.Stop(reload)
+
+			tunnelManager := tunnel.NewManagerWithConfig(configManager)
+			remoteCheck, _ := cmd.Flags().GetBool("remote-forward-check")
+			tunnelManager.SetRemoteForwardCheck(remoteCheck)
+
+			return runDaemon(ctx, configManager, tunnelManager, names, all, reload)
+		},
+	}
+
+	cmd.Flags().StringArray("tunnel", nil, "Tunnel to run (repeatable; default all)")
+	cmd.Flags().Bool("remote-forward-check", false, "Also confirm the reverse port reaches the local SSH server in periodic health checks")
+	return cmd
+}
+
+// daemonTunnels is the part of tunnel.Manager the daemon uses
+type daemonTunnels interface {
+	tunnelStatuses
+	StartContext(ctx context.Context, tunnelName string) error
+	Stop(tunnelName string) error
+}
+
+// runDaemon starts the named tunnels and any automatic backups, reloads the
+// configuration on every signal from reload, and stops the tunnels again
+// once ctx is done. With all set, tunnels added before a reload are started
+// too.
+func runDaemon(ctx context.Context, configManager *config.Manager, tunnels daemonTunnels, names []string, all bool, reload <-chan os.Signal) error {
+	settings, err := config.LoadSettings(configManager.GetConfigPath())
+	if err != nil {
+		return err
+	}
+
+	if addr := settings.Daemon.HealthAddr(); addr != "" {
+		if err := serveHealth(ctx, addr, healthHandler(tunnels, daemonTunnelNames(configManager, names, all))); err != nil {
+			return err
+		}
+	}
+
+	// running holds the config each running tunnel was started with
+	running := make(map[string]*config.Config)
+	var failures []string
+	for _, name := range names {
+		if _, ok := running[name]; ok {
+			continue // Started with its group
+		}
+		if _, err := startDaemonTunnel(ctx, configManager, tunnels, running, name); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", name, err))
+		}
+	}
+
+	if len(running) == 0 && !settings.Backup.Enabled() {
+		if len(failures) > 0 {
+			return fmt.Errorf("no tunnels started:\n%s", strings.Join(failures, "\n"))
+		}
+		return fmt.Errorf("nothing to run: no tunnels configured and automatic backups are off")
+	}
+
+	if settings.Backup.Enabled() {
+		scheduler := backup.NewScheduler(configManager.GetConfigPath(), settings.Backup)
+		scheduler.Store = configManager.Store()
+		go scheduler.Run(ctx)
+	}
+
+	// Heartbeats come from this loop, so systemd restarts a daemon that
+	// hangs in it
+	notifier := newSystemdNotifier()
+	notifier.notify(daemon.SdNotifyReady)
+	heartbeat, stopHeartbeat := notifier.heartbeats()
+	defer stopHeartbeat()
+
+	for done := false; !done; {
+		select {
+		case <-ctx.Done():
+			done = true
+		case <-reload:
+			// The unit is Type=notify, not notify-reload, so systemd is not
+			// told of reloads
+			reloadDaemon(ctx, configManager, tunnels, running, all)
+		case <-heartbeat:
+			notifier.notify(daemon.SdNotifyWatchdog)
+		}
+	}
+
+	notifier.notify(daemon.SdNotifyStopping)
+
+	for _, name := range sortedKeys(running) {
+		if _, ok := running[name]; !ok {
+			continue // Stopped with its group
+		}
+		members, err := stopDaemonTunnel(tunnels, running, name)
+		if err != nil {
+			logger.Warnf("Failed to stop tunnel '%s': %v", name, err)
+			continue
+		}
+		for _, member := range members {
+			logger.Infof("Stopped tunnel: %s", member)
+		}
+	}
+	return nil
+}
+
+// startDaemonTunnel starts a tunnel, along with the rest of its group, and
+// records the config each tunnel started with. It returns the names of the
+// tunnels started.
+func startDaemonTunnel(ctx context.Context, configManager *config.Manager, tunnels daemonTunnels, running map[string]*config.Config, name string) ([]string, error) {
+	var configs []*config.Config
+	cfg, err := configManager.GetConfig(name)
+	if err == nil {
+		configs = []*config.Config{cfg}
+		if cfg.Group != "" {
+			configs, err = configManager.GroupConfigs(cfg.Group)
+		}
+	}
+	if err == nil {
+		err = tunnels.StartContext(ctx, name)
+	}
+	if err != nil {
+		logger.Errorf("Failed to start tunnel '%s': %v", name, err)
+		return nil, err
+	}
+
+	started := make([]string, len(configs))
+	for i, cfg := range configs {
+		logger.Infof("Started tunnel: %s", cfg.TunnelName)
+		running[cfg.TunnelName] = cfg
+		started[i] = cfg.TunnelName
+	}
+	return started, nil
+}
+
+// stopDaemonTunnel stops a running tunnel, along with the rest of the group
+// it started in, and forgets them. It returns the names of the tunnels
+// stopped.
+func stopDaemonTunnel(tunnels daemonTunnels, running map[string]*config.Config, name string) ([]string, error) {
+	members := runningGroup(running, name)
+	for _, member := range members {
+		delete(running, member)
+	}
+	return members, tunnels.Stop(name)
+}
+
+// runningGroup returns the names of the running tunnels that started in the
+// same group as a running tunnel, or just the tunnel if it is in none
+func runningGroup(running map[string]*config.Config, name string) []string {
+	group := running[name].Group
+	if group == "" {
+		return []string{name}
+	}
+	var members []string
+	for _, member := range sortedKeys(running) {
+		if running[member].Group == group {
+			members = append(members, member)
+		}
+	}
+	return members
+}
+
+// daemonConfigChanged reports whether a running tunnel's config was changed
+// or removed since it started
+func daemonConfigChanged(configManager *config.Manager, running map[string]*config.Config, name string) bool {
+	cfg, err := configManager.GetConfig(name)
+	return err != nil || !config.SameContent(running[name], cfg)
+}
+
+// reloadDaemon reloads the configuration and brings the running tunnels in
+// line with it: changed tunnels are restarted, removed ones stopped and, with
+// all set, new ones started. If the configuration cannot be reloaded, the
+// tunnels keep running as they are.
+func reloadDaemon(ctx context.Context, configManager *config.Manager, tunnels daemonTunnels, running map[string]*config.Config, all bool) {
+	logger.Infof("Reloading configuration")
+	if err := configManager.Reload(); err != nil {
+		logger.Errorf("Failed to reload configuration, keeping the running tunnels: %v", err)
+		return
+	}
+
+	// A group shares one SSH process, so it is restarted as a whole when any
+	// of its tunnels changed
+	var restarted, started, stopped, unchanged, failed []string
+	handled := make(map[string]bool)
+	for _, name := range sortedKeys(running) {
+		if handled[name] {
+			continue
+		}
+		members := runningGroup(running, name)
+		for _, member := range members {
+			handled[member] = true
+		}
+		if !slices.ContainsFunc(members, func(member string) bool {
+			return daemonConfigChanged(configManager, running, member)
+		}) {
+			unchanged = append(unchanged, members...)
+			continue
+		}
+
+		if _, err := stopDaemonTunnel(tunnels, running, name); err != nil {
+			logger.Warnf("Error stopping tunnel '%s' for restart: %v", name, err)
+		}
+		for _, member := range members {
+			if _, err := configManager.GetConfig(member); err != nil {
+				stopped = append(stopped, member)
+				continue
+			}
+			if _, ok := running[member]; ok {
+				restarted = append(restarted, member) // Started with its group
+				continue
+			}
+			names, err := startDaemonTunnel(ctx, configManager, tunnels, running, member)
+			if err != nil {
+				failed = append(failed, member)
+				continue
+			}
+			for _, startedName := range names {
+				handled[startedName] = true
+				if !slices.Contains(members, startedName) {
+					started = append(started, startedName)
+				} else if startedName == member {
+					restarted = append(restarted, member)
+				}
+			}
+		}
+	}
+
+	if all {
+		names := configManager.ListConfigs()
+		slices.Sort(names)
+		for _, name := range names {
+			if _, ok := running[name]; ok || slices.Contains(failed, name) {
+				continue
+			}
+			names, err := startDaemonTunnel(ctx, configManager, tunnels, running, name)
+			if err != nil {
+				failed = append(failed, name)
+				continue
+			}
+			started = append(started, names...)
+		}
+	}
+
+	logger.Infof("Reload complete: %d restarted %v, %d started %v, %d stopped %v, %d unchanged, %d failed %v",
+		len(restarted), restarted, len(started), started, len(stopped), stopped, len(unchanged), len(failed), failed)
+}
+
+// daemonTunnelNames returns a function listing the tunnels the daemon is
+// meant to run, for the health endpoint: every configured tunnel with all
+// set, otherwise those of names that are still configured
+func daemonTunnelNames(configManager *config.Manager, names []string, all bool) func() []string {
+	return func() []string {
+		if all {
+			configured := configManager.ListConfigs()
+			slices.Sort(configured)
+			return configured
+		}
+
+		var configured []string
+		for _, name := range names {
+			if _, err := configManager.GetConfig(name); err == nil {
+				configured = append(configured, name)
+			}
+		}
+		return configured
+	}
+}
+
+// sortedKeys returns the names of the running tunnels in order
+func sortedKeys(running map[string]*config.Config) []string {
+	names := make([]string, 0, len(running))
+	for name := range running {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/lerndmina/SSH-Tunnel/internal/config"
+	"github.com/lerndmina/SSH-Tunnel/internal/tunnel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeTunnels records the tunnels the daemon starts and stops, and reports
+// the statuses it is given
+type fakeTunnels struct {
+	mu       sync.Mutex
+	calls    []string
+	statuses map[string]tunnel.Status
+}
+
+func (f *fakeTunnels) StartContext(ctx context.Context, name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, "start "+name)
+	return nil
+}
+
+func (f *fakeTunnels) Stop(name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, "stop "+name)
+	return nil
+}
+
+func (f *fakeTunnels) GetStatus(name string) (*tunnel.TunnelStatus, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	status := tunnel.StatusStopped
+	if s, ok := f.statuses[name]; ok {
+		status = s
+	}
+	return &tunnel.TunnelStatus{Name: name, Status: status}, nil
+}
+
+func (f *fakeTunnels) recorded() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.calls...)
+}
+
+func TestDaemonReloadRestartsChangedTunnels(t *testing.T) {
+	dir := t.TempDir()
+	cm, err := config.NewManager(dir)
+	require.NoError(t, err)
+	for _, name := range []string{"home", "lab", "office"} {
+		cfg := &config.Config{TunnelName: name, CreatedAt: time.Now()}
+		cfg.CloudServer.IP = "203.0.113.1"
+		require.NoError(t, cm.SaveConfig(cfg))
+	}
+
+	tunnels := &fakeTunnels{}
+	reload := make(chan os.Signal, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- runDaemon(ctx, cm, tunnels, []string{"home", "lab", "office"}, true, reload)
+	}()
+	require.Eventually(t, func() bool { return len(tunnels.recorded()) == 3 }, time.Second, 10*time.Millisecond)
+
+	// Edit one tunnel, save another unchanged, remove a third and add a new
+	// one, as another process would
+	editor, err := config.NewManager(dir)
+	require.NoError(t, err)
+	home, err := editor.GetConfig("home")
+	require.NoError(t, err)
+	require.NoError(t, editor.SaveConfig(home))
+	lab, err := editor.GetConfig("lab")
+	require.NoError(t, err)
+	lab.CloudServer.IP = "203.0.113.2"
+	require.NoError(t, editor.SaveConfig(lab))
+	require.NoError(t, editor.DeleteConfig("office"))
+	require.NoError(t, editor.SaveConfig(&config.Config{TunnelName: "vpn", CreatedAt: time.Now()}))
+
+	reload <- syscall.SIGHUP
+	require.Eventually(t, func() bool { return len(tunnels.recorded()) == 7 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{
+		"start home", "start lab", "start office",
+		"stop lab", "start lab", "stop office", "start vpn",
+	}, tunnels.recorded())
+
+	// A reload with nothing changed touches nothing
+	reload <- syscall.SIGHUP
+	time.Sleep(100 * time.Millisecond)
+	assert.Len(t, tunnels.recorded(), 7)
+
+	cancel()
+	require.NoError(t, <-done)
+	assert.ElementsMatch(t, []string{"stop home", "stop lab", "stop vpn"}, tunnels.recorded()[7:])
+}
+
+func TestDaemonRunsGroupsTogether(t *testing.T) {
+	dir := t.TempDir()
+	cm, err := config.NewManager(dir)
+	require.NoError(t, err)
+	for _, name := range []string{"db", "home", "web"} {
+		cfg := &config.Config{TunnelName: name, CreatedAt: time.Now()}
+		cfg.CloudServer.IP = "203.0.113.1"
+		if name != "home" {
+			cfg.Group = "office"
+		}
+		require.NoError(t, cm.SaveConfig(cfg))
+	}
+
+	tunnels := &fakeTunnels{}
+	reload := make(chan os.Signal, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- runDaemon(ctx, cm, tunnels, []string{"db", "home", "web"}, true, reload)
+	}()
+
+	// The group starts once, with its first tunnel
+	require.Eventually(t, func() bool { return len(tunnels.recorded()) == 2 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"start db", "start home"}, tunnels.recorded())
+
+	// Changing one tunnel in the group restarts the whole group
+	editor, err := config.NewManager(dir)
+	require.NoError(t, err)
+	web, err := editor.GetConfig("web")
+	require.NoError(t, err)
+	web.LocalServer.ReversePort = 2224
+	require.NoError(t, editor.SaveConfig(web))
+
+	reload <- syscall.SIGHUP
+	require.Eventually(t, func() bool { return len(tunnels.recorded()) == 4 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"stop db", "start db"}, tunnels.recorded()[2:])
+
+	// Both tunnels of the group are recorded with their new configs, so a
+	// second reload leaves them alone
+	reload <- syscall.SIGHUP
+	time.Sleep(100 * time.Millisecond)
+	assert.Len(t, tunnels.recorded(), 4)
+
+	cancel()
+	require.NoError(t, <-done)
+	assert.ElementsMatch(t, []string{"stop db", "stop home"}, tunnels.recorded()[4:])
+}
+
+func TestDaemonNotifiesSystemd(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socketPath, Net: "unixgram"})
+	require.NoError(t, err)
+	defer conn.Close()
+	t.Setenv("NOTIFY_SOCKET", socketPath)
+	t.Setenv("WATCHDOG_USEC", "100000")
+
+	messages := make(chan string, 16)
+	go func() {
+		buf := make([]byte, 256)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				return
+			}
+			messages <- string(buf[:n])
+		}
+	}()
+	next := func() string {
+		select {
+		case msg := <-messages:
+			return msg
+		case <-time.After(2 * time.Second):
+			t.Fatal("no notification from the daemon")
+			return ""
+		}
+	}
+
+	cm, err := config.NewManager(t.TempDir())
+	require.NoError(t, err)
+	require.NoError(t, cm.SaveConfig(&config.Config{TunnelName: "home", CreatedAt: time.Now()}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	reload := make(chan os.Signal, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- runDaemon(ctx, cm, &fakeTunnels{}, []string{"home"}, false, reload)
+	}()
+
+	assert.Equal(t, "READY=1", next())
+	// Heartbeats come at half of WatchdogSec, and reloads are not reported
+	assert.Equal(t, "WATCHDOG=1", next())
+	reload <- syscall.SIGHUP
+	assert.Equal(t, "WATCHDOG=1", next())
+	assert.Equal(t, "WATCHDOG=1", next())
+
+	cancel()
+	require.NoError(t, <-done)
+	for msg := next(); msg != "STOPPING=1"; msg = next() {
+		assert.Equal(t, "WATCHDOG=1", msg)
+	}
+}
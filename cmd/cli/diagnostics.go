@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/lerndmina/SSH-Tunnel/internal/config"
+	"github.com/lerndmina/SSH-Tunnel/internal/ssh"
+	"github.com/lerndmina/SSH-Tunnel/internal/tunnel"
+)
+
+// diagnosticsOptions controls which diagnostic checks are run
+type diagnosticsOptions struct {
+	performance      bool
+	connectivityOnly bool
+	timeout          time.Duration
+	socksURL         string
+	remoteForward    bool
+}
+
+// Severities of diagnostic checks. A failed critical check makes the
+// diagnostics command fail; info checks only report measurements.
+const (
+	severityCritical = "critical"
+	severityInfo     = "info"
+)
+
+// diagnosticCheck is the outcome of a single diagnostic check
+type diagnosticCheck struct {
+	// id identifies the kind of check for scripts, e.g. "ssh_auth"
+	id       string
+	name     string
+	severity string
+	detail   string
+	err      error
+	// hint suggests how to fix the problem if the check fails
+	hint string
+}
+
+// critical reports whether the check failed and must fail the command
+func (c diagnosticCheck) critical() bool {
+	return c.err != nil && c.severity != severityInfo
+}
+
+// runDiagnostics runs the diagnostic checks for a tunnel configuration
+func runDiagnostics(cfg *config.Config, opts diagnosticsOptions) []diagnosticCheck {
+	keyManager := ssh.NewKeyManager()
+	keyManager.SetTimeout(opts.timeout)
+	keyManager.SetAlgorithms(sshAlgorithms(cfg))
+	keyManager.SetBindAddress(cfg.SSH.BindAddress)
+	keyManager.SetKnownHostsFile(config.ExpandPath(cfg.SSH.KnownHostsFile))
+	keyManager.SetInsecureSkipHostKeyCheck(cfg.SSH.InsecureSkipHostKeyCheck)
+
+	timeout := opts.timeout
+	if timeout <= 0 {
+		timeout = ssh.DefaultConnectTimeout
+	}
+
+	var checks []diagnosticCheck
+	target, err := tunnel.ResolveNativeTarget(cfg)
+	if err != nil {
+		return append(checks, diagnosticCheck{
+			id:       "ssh_config_file",
+			name:     "SSH config file readable (" + cfg.SSH.ConfigFile + ")",
+			severity: severityCritical,
+			err:      err,
+			hint:     "Check that ssh.config_file exists and defines the cloud server's Host",
+		})
+	}
+	address := net.JoinHostPort(target.Host, strconv.Itoa(target.Port))
+
+	// Network reachability of the cloud server
+	start := time.Now()
+	conn, err := keyManager.DialTCP(address, timeout)
+	reachability := diagnosticCheck{
+		id:       "cloud_reachable",
+		name:     "Cloud server reachable (" + address + ")",
+		severity: severityCritical,
+		hint:     "Check the cloud server address and port, and that no firewall blocks the connection",
+	}
+	if err != nil {
+		reachability.err = err
+	} else {
+		conn.Close()
+		reachability.detail = fmt.Sprintf("%dms", time.Since(start).Milliseconds())
+	}
+	checks = append(checks, reachability)
+
+	if opts.connectivityOnly {
+		return checks
+	}
+
+	// Local SOCKS proxy, reported separately from the reverse forward
+	if cfg.LocalServer.SOCKSPort > 0 {
+		checks = append(checks, socksDiagnostic(cfg, opts, timeout))
+	}
+
+	// Private key validity
+	keyPath := target.KeyPath
+	keyCheck := diagnosticCheck{
+		id:       "private_key",
+		name:     "Private key valid (" + keyPath + ")",
+		severity: severityCritical,
+		hint:     "Check that ssh.private_key_path points to a readable private key with mode 0600",
+	}
+	keyCheck.err = keyManager.ValidateKey(keyPath)
+	checks = append(checks, keyCheck)
+	if keyCheck.err != nil || reachability.err != nil {
+		return checks
+	}
+
+	// SSH authentication
+	start = time.Now()
+	authCheck := diagnosticCheck{
+		id:       "ssh_auth",
+		name:     "SSH authentication as " + target.User,
+		severity: severityCritical,
+		hint:     "Authorize the tunnel's public key on the cloud server, e.g. with 'ssh-tunnel remote-setup --key'",
+	}
+	remote, err := keyManager.ProbeRemote(target.Host, target.User, keyPath, target.Port)
+	elapsed := time.Since(start)
+	if authCheck.err = err; err == nil {
+		authCheck.detail = remote.String()
+		if !remote.LoggedInAs(target.User) {
+			authCheck.detail += fmt.Sprintf(", not %s", target.User)
+		}
+	}
+	checks = append(checks, authCheck)
+
+	if opts.remoteForward && authCheck.err == nil {
+		checks = append(checks, remoteForwardDiagnostic(cfg, timeout))
+	}
+
+	if opts.performance && authCheck.err == nil {
+		checks = append(checks, diagnosticCheck{
+			id:       "ssh_setup_time",
+			name:     "SSH connection setup time",
+			severity: severityInfo,
+			detail:   fmt.Sprintf("%dms", elapsed.Milliseconds()),
+		})
+	}
+
+	return checks
+}
+
+// socksDiagnostic checks that the tunnel's SOCKS proxy completes a SOCKS5
+// handshake and, if a check URL is configured, can fetch it
+func socksDiagnostic(cfg *config.Config, opts diagnosticsOptions, timeout time.Duration) diagnosticCheck {
+	proxyAddr := tunnel.SOCKSAddress(cfg.LocalServer.SOCKSBindAddr, cfg.LocalServer.SOCKSPort)
+	checkURL := cfg.LocalServer.SOCKSCheckURL
+	if opts.socksURL != "" {
+		checkURL = opts.socksURL
+	}
+
+	check := diagnosticCheck{
+		id:       "socks_proxy",
+		name:     "SOCKS proxy working (" + proxyAddr + ")",
+		severity: severityCritical,
+		hint:     "Start the tunnel, and check local_server.socks_port and socks_check_url",
+	}
+	if checkURL != "" {
+		check.name = fmt.Sprintf("SOCKS proxy working (%s, fetching %s)", proxyAddr, checkURL)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	start := time.Now()
+	if err := tunnel.CheckSOCKS(ctx, proxyAddr, checkURL); err != nil {
+		check.err = err
+	} else {
+		check.detail = fmt.Sprintf("%dms", time.Since(start).Milliseconds())
+	}
+	return check
+}
+
+// remoteForwardDiagnostic checks from the cloud server that the reverse port
+// reaches the local SSH server, which only works while the tunnel is up
+func remoteForwardDiagnostic(cfg *config.Config, timeout time.Duration) diagnosticCheck {
+	check := diagnosticCheck{
+		id:       "remote_forward",
+		name:     fmt.Sprintf("Reverse port %d reaches local SSH server", cfg.LocalServer.ReversePort),
+		severity: severityCritical,
+		hint:     "Start the tunnel, and check that AllowTcpForwarding is enabled on the cloud server and the local sshd is running",
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	banner, err := tunnel.RemoteForwardCheck(ctx, cfg)
+	if err != nil {
+		check.err = err
+	} else {
+		check.detail = banner
+	}
+	return check
+}
+
+// printDiagnosticCheck prints a single diagnostic result
+func printDiagnosticCheck(check diagnosticCheck) {
+	switch {
+	case check.err != nil:
+		fmt.Printf("  ✗ %s: %v\n", check.name, check.err)
+	case check.detail != "":
+		fmt.Printf("  ✓ %s (%s)\n", check.name, check.detail)
+	default:
+		fmt.Printf("  ✓ %s\n", check.name)
+	}
+}
+
+// diagnosticsReport holds the checks run for one tunnel
+type diagnosticsReport struct {
+	tunnel string
+	checks []diagnosticCheck
+}
+
+// diagnosticsFailures counts the failed critical checks in reports
+func diagnosticsFailures(reports []diagnosticsReport) int {
+	failures := 0
+	for _, report := range reports {
+		for _, check := range report.checks {
+			if check.critical() {
+				failures++
+			}
+		}
+	}
+	return failures
+}
+
+// diagnosticCheckJSON is a check in the JSON output of diagnostics
+type diagnosticCheckJSON struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	OK       bool   `json:"ok"`
+	Severity string `json:"severity"`
+	Detail   string `json:"detail,omitempty"`
+	Error    string `json:"error,omitempty"`
+	Hint     string `json:"hint,omitempty"`
+}
+
+// diagnosticsReportJSON is one tunnel's checks in the JSON output
+type diagnosticsReportJSON struct {
+	Tunnel string                `json:"tunnel"`
+	OK     bool                  `json:"ok"`
+	Checks []diagnosticCheckJSON `json:"checks"`
+}
+
+// writeDiagnosticsJSON writes the reports as a JSON object with an overall
+// ok flag and each tunnel's checks. Hints are only included for failed
+// checks.
+func writeDiagnosticsJSON(w io.Writer, reports []diagnosticsReport) error {
+	out := struct {
+		OK      bool                    `json:"ok"`
+		Tunnels []diagnosticsReportJSON `json:"tunnels"`
+	}{OK: diagnosticsFailures(reports) == 0, Tunnels: []diagnosticsReportJSON{}}
+
+	for _, report := range reports {
+		r := diagnosticsReportJSON{Tunnel: report.tunnel, OK: true, Checks: []diagnosticCheckJSON{}}
+		for _, check := range report.checks {
+			c := diagnosticCheckJSON{
+				ID:       check.id,
+				Name:     check.name,
+				OK:       check.err == nil,
+				Severity: check.severity,
+				Detail:   check.detail,
+			}
+			if check.err != nil {
+				c.Error = check.err.Error()
+				c.Hint = check.hint
+			}
+			if check.critical() {
+				r.OK = false
+			}
+			r.Checks = append(r.Checks, c)
+		}
+		out.Tunnels = append(out.Tunnels, r)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
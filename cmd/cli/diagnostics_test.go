@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/lerndmina/SSH-Tunnel/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// closedPort returns a local port nothing is listening on
+func closedPort(t *testing.T) int {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := listener.Addr().(*net.TCPAddr).Port
+	require.NoError(t, listener.Close())
+	return port
+}
+
+func TestDiagnosticsJSONReportsFailedCheck(t *testing.T) {
+	cfg := &config.Config{TunnelName: "home"}
+	cfg.CloudServer = config.CloudServerConfig{IP: "127.0.0.1", Port: closedPort(t), User: "tunnel"}
+
+	reports := []diagnosticsReport{
+		{tunnel: "home", checks: runDiagnostics(cfg, diagnosticsOptions{connectivityOnly: true, timeout: time.Second})},
+		{tunnel: "lab", checks: []diagnosticCheck{{id: "ssh_setup_time", name: "SSH connection setup time", severity: severityInfo, detail: "42ms"}}},
+	}
+
+	var out bytes.Buffer
+	require.NoError(t, writeDiagnosticsJSON(&out, reports))
+
+	var result struct {
+		OK      bool `json:"ok"`
+		Tunnels []struct {
+			Tunnel string                   `json:"tunnel"`
+			OK     bool                     `json:"ok"`
+			Checks []map[string]interface{} `json:"checks"`
+		} `json:"tunnels"`
+	}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &result))
+	assert.False(t, result.OK)
+	require.Len(t, result.Tunnels, 2)
+
+	home := result.Tunnels[0]
+	assert.Equal(t, "home", home.Tunnel)
+	assert.False(t, home.OK)
+	require.Len(t, home.Checks, 1)
+	check := home.Checks[0]
+	assert.Equal(t, "cloud_reachable", check["id"])
+	assert.Equal(t, false, check["ok"])
+	assert.Equal(t, severityCritical, check["severity"])
+	assert.NotEmpty(t, check["error"])
+	assert.NotEmpty(t, check["hint"])
+
+	lab := result.Tunnels[1]
+	assert.True(t, lab.OK)
+	assert.Equal(t, map[string]interface{}{
+		"id": "ssh_setup_time", "name": "SSH connection setup time", "ok": true, "severity": "info", "detail": "42ms",
+	}, lab.Checks[0])
+
+	// The command fails, so exits nonzero, on the critical failure alone
+	assert.Equal(t, 1, diagnosticsFailures(reports))
+	assert.Zero(t, diagnosticsFailures(reports[1:]))
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/lerndmina/SSH-Tunnel/internal/config"
+	"github.com/spf13/cobra"
+)
+
+// addFilterFlags registers the --profile and --tag flags used to select a
+// group of tunnels
+func addFilterFlags(cmd *cobra.Command, verb string) {
+	cmd.Flags().String("profile", "", verb+" tunnels in this profile")
+	cmd.Flags().StringArray("tag", nil, verb+" tunnels with this tag; repeat to require several, separate with commas to allow any")
+}
+
+// selectTunnels returns the names of configured tunnels matching the command's
+// --profile and --tag flags, sorted, and whether any filter was given
+func selectTunnels(cmd *cobra.Command, configManager *config.Manager) ([]string, bool) {
+	profile, _ := cmd.Flags().GetString("profile")
+	tags, _ := cmd.Flags().GetStringArray("tag")
+
+	var names []string
+	for _, name := range configManager.ListConfigs() {
+		cfg, err := configManager.GetConfig(name)
+		if err != nil {
+			continue
+		}
+		if profile != "" && cfg.Profile != profile {
+			continue
+		}
+		if !cfg.MatchesTags(tags) {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names, profile != "" || len(tags) > 0
+}
+
+// tunnelTargets returns the tunnels a start or stop command acts on: those
+// matching --all, --profile or --tag; else the named tunnel; else the active
+// tunnel, if one is set; else every tunnel. single reports whether one
+// tunnel was chosen by name or as the active tunnel.
+func tunnelTargets(cmd *cobra.Command, configManager *config.Manager, args []string) ([]string, bool, error) {
+	all, _ := cmd.Flags().GetBool("all")
+	names, filtered := selectTunnels(cmd, configManager)
+
+	switch {
+	case filtered && len(names) == 0:
+		return nil, false, fmt.Errorf("no tunnels match the given filters")
+	case all || filtered:
+		return names, false, nil
+	case len(args) > 0:
+		return args[:1], true, nil
+	}
+
+	active, err := configManager.GetActiveConfig()
+	if errors.Is(err, config.ErrNoActiveConfig) {
+		return names, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return []string{active.TunnelName}, true, nil
+}
+
+// groupMembers returns the names of the tunnels that start and stop
+// together with a tunnel: its group, or else just the tunnel itself
+func groupMembers(configManager *config.Manager, name string) []string {
+	cfg, err := configManager.GetConfig(name)
+	if err != nil || cfg.Group == "" {
+		return []string{name}
+	}
+	members, err := configManager.GroupConfigs(cfg.Group)
+	if err != nil {
+		return []string{name}
+	}
+	names := make([]string, len(members))
+	for i, member := range members {
+		names[i] = member.TunnelName
+	}
+	return names
+}
+
+// groupTargets drops the tunnels of names in the group of an earlier one, as
+// starting or stopping one tunnel in a group acts on the whole group. It
+// returns the tunnels left and, for each, the tunnels it acts on.
+func groupTargets(configManager *config.Manager, names []string) ([]string, map[string][]string) {
+	var targets []string
+	members := make(map[string][]string)
+	covered := make(map[string]bool)
+	for _, name := range names {
+		if covered[name] {
+			continue
+		}
+		targets = append(targets, name)
+		members[name] = groupMembers(configManager, name)
+		for _, member := range members[name] {
+			covered[member] = true
+		}
+	}
+	return targets, members
+}
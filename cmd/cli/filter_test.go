@@ -0,0 +1,86 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/lerndmina/SSH-Tunnel/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTargetsConfig returns a config manager holding the named tunnels
+func newTargetsConfig(t *testing.T, names ...string) *config.Manager {
+	configManager, err := config.NewManager(t.TempDir())
+	require.NoError(t, err)
+	for _, name := range names {
+		require.NoError(t, configManager.SaveConfig(&config.Config{TunnelName: name, Tags: []string{"lab"}}))
+	}
+	return configManager
+}
+
+func TestStartWithoutArgsTargetsActiveTunnel(t *testing.T) {
+	configManager := newTargetsConfig(t, "home", "work")
+	require.NoError(t, configManager.SetActiveConfig("work"))
+
+	cmd := newStartCommand()
+	require.NoError(t, cmd.ParseFlags(nil))
+
+	names, single, err := tunnelTargets(cmd, configManager, nil)
+	require.NoError(t, err)
+	assert.True(t, single)
+	assert.Equal(t, []string{"work"}, names)
+
+	// A name on the command line wins over the active tunnel
+	names, single, err = tunnelTargets(cmd, configManager, []string{"home"})
+	require.NoError(t, err)
+	assert.True(t, single)
+	assert.Equal(t, []string{"home"}, names)
+}
+
+func TestStartAllIgnoresActiveTunnel(t *testing.T) {
+	configManager := newTargetsConfig(t, "home", "work")
+	require.NoError(t, configManager.SetActiveConfig("work"))
+
+	for _, flags := range [][]string{{"--all"}, {"--tag", "lab"}} {
+		cmd := newStartCommand()
+		require.NoError(t, cmd.ParseFlags(flags))
+
+		names, single, err := tunnelTargets(cmd, configManager, nil)
+		require.NoError(t, err)
+		assert.False(t, single, flags)
+		assert.Equal(t, []string{"home", "work"}, names, flags)
+	}
+}
+
+func TestStartWithoutActiveTunnelTargetsAll(t *testing.T) {
+	configManager := newTargetsConfig(t, "home", "work")
+
+	cmd := newStopCommand()
+	require.NoError(t, cmd.ParseFlags(nil))
+
+	names, single, err := tunnelTargets(cmd, configManager, nil)
+	require.NoError(t, err)
+	assert.False(t, single)
+	assert.Equal(t, []string{"home", "work"}, names)
+
+	require.NoError(t, cmd.ParseFlags([]string{"--tag", "prod"}))
+	_, _, err = tunnelTargets(cmd, configManager, nil)
+	assert.Error(t, err)
+}
+
+func TestGroupTargetsActOnceForEachGroup(t *testing.T) {
+	configManager := newTargetsConfig(t, "home")
+	for _, name := range []string{"db", "web"} {
+		require.NoError(t, configManager.SaveConfig(&config.Config{TunnelName: name, Group: "office"}))
+	}
+
+	targets, members := groupTargets(configManager, []string{"db", "home", "web"})
+	assert.Equal(t, []string{"db", "home"}, targets)
+	assert.Equal(t, []string{"db", "web"}, members["db"])
+	assert.Equal(t, []string{"home"}, members["home"])
+
+	// Selecting one tunnel of a group acts on the whole group
+	targets, members = groupTargets(configManager, []string{"web"})
+	assert.Equal(t, []string{"web"}, targets)
+	assert.Equal(t, []string{"db", "web"}, members["web"])
+}
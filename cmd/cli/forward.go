@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/lerndmina/SSH-Tunnel/internal/config"
+	"github.com/lerndmina/SSH-Tunnel/internal/tunnel"
+	"github.com/spf13/cobra"
+)
+
+// setAdHocForwards parses the --local-forward and --remote-forward flags
+// and adds the forwards to the tunnels tunnelManager starts. They are only
+// allowed when starting a single tunnel, since the ports could be bound
+// only once.
+func setAdHocForwards(cmd *cobra.Command, tunnelManager *tunnel.Manager, single bool) error {
+	localSpecs, _ := cmd.Flags().GetStringArray("local-forward")
+	remoteSpecs, _ := cmd.Flags().GetStringArray("remote-forward")
+	if len(localSpecs) == 0 && len(remoteSpecs) == 0 {
+		return nil
+	}
+	if !single {
+		return fmt.Errorf("--local-forward and --remote-forward can only be used when starting a single tunnel")
+	}
+
+	localForwards := make([]config.ForwardConfig, 0, len(localSpecs))
+	for _, spec := range localSpecs {
+		forward, err := config.ParseForwardSpec(spec)
+		if err != nil {
+			return fmt.Errorf("--local-forward: %w", err)
+		}
+		localForwards = append(localForwards, forward)
+	}
+
+	remoteForwards := make([]config.RemoteForwardConfig, 0, len(remoteSpecs))
+	for _, spec := range remoteSpecs {
+		forward, err := config.ParseRemoteForwardSpec(spec)
+		if err != nil {
+			return fmt.Errorf("--remote-forward: %w", err)
+		}
+		remoteForwards = append(remoteForwards, forward)
+	}
+
+	tunnelManager.SetLocalForwards(localForwards)
+	tunnelManager.SetRemoteForwards(remoteForwards)
+	return nil
+}
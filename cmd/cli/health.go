@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/lerndmina/SSH-Tunnel/internal/tunnel"
+	"github.com/lerndmina/SSH-Tunnel/pkg/logger"
+)
+
+// healthShutdownTimeout bounds how long the health endpoint waits for
+// requests in flight when the daemon stops
+const healthShutdownTimeout = 5 * time.Second
+
+// tunnelStatuses is the part of tunnel.Manager the health endpoint uses
+type tunnelStatuses interface {
+	GetStatus(tunnelName string) (*tunnel.TunnelStatus, error)
+}
+
+// tunnelHealth is one tunnel's entry in a health response
+type tunnelHealth struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Ready  bool   `json:"ready"`
+}
+
+// healthResponse is the JSON body of /healthz and /readyz
+type healthResponse struct {
+	Status  string         `json:"status"`
+	Tunnels []tunnelHealth `json:"tunnels"`
+}
+
+// healthHandler serves the daemon's health endpoints. /healthz answers 200
+// whenever the daemon is up; /readyz answers 200 only once every tunnel
+// listed by names is running, and 503 otherwise. Both list each tunnel's
+// state.
+func healthHandler(tunnels tunnelStatuses, names func() []string) http.Handler {
+	summary := func() ([]tunnelHealth, bool) {
+		entries := []tunnelHealth{}
+		ready := true
+		for _, name := range names() {
+			entry := tunnelHealth{Name: name, Status: tunnel.StatusStopped.String()}
+			if status, err := tunnels.GetStatus(name); err == nil && status != nil {
+				entry.Status = status.Status.String()
+				entry.Ready = status.Status == tunnel.StatusRunning
+			}
+			ready = ready && entry.Ready
+			entries = append(entries, entry)
+		}
+		return entries, ready
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		entries, _ := summary()
+		writeHealth(w, http.StatusOK, healthResponse{Status: "ok", Tunnels: entries})
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		entries, ready := summary()
+		if !ready {
+			writeHealth(w, http.StatusServiceUnavailable, healthResponse{Status: "not ready", Tunnels: entries})
+			return
+		}
+		writeHealth(w, http.StatusOK, healthResponse{Status: "ready", Tunnels: entries})
+	})
+	return mux
+}
+
+// writeHealth writes a health response as JSON
+func writeHealth(w http.ResponseWriter, code int, resp healthResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// serveHealth listens on addr and serves handler until ctx is done. The
+// listener is opened before returning, so a port already in use is
+// reported at once.
+func serveHealth(ctx context.Context, addr string, handler http.Handler) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to start health endpoint: %w", err)
+	}
+
+	server := &http.Server{Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Errorf("Health endpoint failed: %v", err)
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), healthShutdownTimeout)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	logger.Infof("Serving /healthz and /readyz on http://%s", listener.Addr())
+	return nil
+}
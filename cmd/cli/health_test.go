@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lerndmina/SSH-Tunnel/internal/tunnel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// getHealth requests path from handler and decodes the response
+func getHealth(t *testing.T, handler http.Handler, path string) (int, healthResponse) {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	var resp healthResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	return rec.Code, resp
+}
+
+func TestHealthHandlerMixedStates(t *testing.T) {
+	tunnels := &fakeTunnels{statuses: map[string]tunnel.Status{
+		"home":   tunnel.StatusRunning,
+		"office": tunnel.StatusReconnecting,
+	}}
+	names := []string{"home", "office", "lab"}
+	handler := healthHandler(tunnels, func() []string { return names })
+
+	want := []tunnelHealth{
+		{Name: "home", Status: "running", Ready: true},
+		{Name: "office", Status: "reconnecting"},
+		{Name: "lab", Status: "stopped"},
+	}
+
+	// The daemon is alive even though not every tunnel is up
+	code, resp := getHealth(t, handler, "/healthz")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "ok", resp.Status)
+	assert.Equal(t, want, resp.Tunnels)
+
+	code, resp = getHealth(t, handler, "/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "not ready", resp.Status)
+	assert.Equal(t, want, resp.Tunnels)
+
+	// Ready once every tunnel runs
+	names = []string{"home"}
+	code, resp = getHealth(t, handler, "/readyz")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "ready", resp.Status)
+	assert.Equal(t, []tunnelHealth{{Name: "home", Status: "running", Ready: true}}, resp.Tunnels)
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/lerndmina/SSH-Tunnel/internal/config"
+	"github.com/lerndmina/SSH-Tunnel/internal/ssh"
+	"github.com/spf13/cobra"
+)
+
+// newHostsCommand creates the hosts command
+func newHostsCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "hosts",
+		Short: "Manage trusted host keys",
+		Long: `Commands for managing the known_hosts file that holds the cloud server
+host keys trusted during setup, without editing it by hand.
+
+The file is ~/.ssh/known_hosts unless --file names another, such as a
+tunnel's ssh.known_hosts_file.`,
+	}
+
+	cmd.PersistentFlags().String("file", "", "known_hosts file (default ~/.ssh/known_hosts)")
+	cmd.AddCommand(
+		newHostsListCommand(),
+		newHostsRemoveCommand(),
+		newHostsHashCommand(),
+	)
+
+	return cmd
+}
+
+// knownHostsPath returns the known_hosts file named by --file, or the
+// user's default one
+func knownHostsPath(cmd *cobra.Command) (string, error) {
+	if path, _ := cmd.Flags().GetString("file"); path != "" {
+		return config.ExpandPath(path), nil
+	}
+	return ssh.DefaultKnownHostsFile()
+}
+
+// newHostsListCommand creates the hosts list command
+func newHostsListCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List trusted hosts and their key fingerprints",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path, err := knownHostsPath(cmd)
+			if err != nil {
+				return err
+			}
+			hosts, err := ssh.ListKnownHosts(path)
+			if err != nil {
+				return err
+			}
+			if len(hosts) == 0 {
+				fmt.Fprintf(cmd.OutOrStdout(), "No trusted hosts in %s\n", path)
+				return nil
+			}
+			printKnownHosts(cmd.OutOrStdout(), hosts)
+			return nil
+		},
+	}
+}
+
+// printKnownHosts prints known_hosts entries as a table. Hashed host names
+// cannot be shown, only counted.
+func printKnownHosts(w io.Writer, hosts []ssh.KnownHost) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "LINE\tHOST\tTYPE\tFINGERPRINT")
+	for _, host := range hosts {
+		var names []string
+		hashed := 0
+		for _, name := range host.Hosts {
+			if strings.HasPrefix(name, "|") {
+				hashed++
+				continue
+			}
+			names = append(names, name)
+		}
+		if hashed > 0 {
+			names = append(names, fmt.Sprintf("(%d hashed)", hashed))
+		}
+		if host.Marker != "" {
+			names = append([]string{host.Marker}, names...)
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", host.Line, strings.Join(names, " "), host.KeyType, host.Fingerprint)
+	}
+	tw.Flush()
+}
+
+// newHostsRemoveCommand creates the hosts remove command
+func newHostsRemoveCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "remove <host>[:port]",
+		Short: "Forget a host's key",
+		Long: `Remove a host's entries from known_hosts, hashed ones included, e.g.
+after the cloud server was rebuilt and presents a new key. The next setup
+asks to trust the new key.`,
+		Example: `  ssh-tunnel hosts remove 203.0.113.1
+  ssh-tunnel hosts remove 203.0.113.1:2222`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path, err := knownHostsPath(cmd)
+			if err != nil {
+				return err
+			}
+			removed, err := ssh.RemoveKnownHost(path, args[0])
+			if err != nil {
+				return err
+			}
+			if removed == 0 {
+				return fmt.Errorf("no entries for %s in %s", args[0], path)
+			}
+			entries := "entries"
+			if removed == 1 {
+				entries = "entry"
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "✓ Removed %d %s for %s from %s\n", removed, entries, args[0], path)
+			return nil
+		},
+	}
+}
+
+// newHostsHashCommand creates the hosts hash command
+func newHostsHashCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "hash",
+		Short: "Hash the host names in known_hosts",
+		Long: `Replace the host names in known_hosts with hashes, as ssh-keygen -H does,
+so the file does not reveal which servers you connect to. Hashed entries
+keep working for ssh and for this tool, and hosts remove still finds them.
+Wildcard patterns are left as they are.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path, err := knownHostsPath(cmd)
+			if err != nil {
+				return err
+			}
+			hashed, err := ssh.HashKnownHosts(path)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "✓ Hashed %d host name(s) in %s\n", hashed, path)
+			return nil
+		},
+	}
+}
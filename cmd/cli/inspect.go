@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/lerndmina/SSH-Tunnel/internal/config"
+	"github.com/lerndmina/SSH-Tunnel/internal/tunnel"
+	"github.com/spf13/cobra"
+)
+
+// newInspectCommand creates the inspect command
+func newInspectCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "inspect <tunnel-name>",
+		Short: "Show a tunnel's effective configuration and SSH command",
+		Long: `Show the configuration a tunnel will actually run with, after defaults.yaml
+is merged and paths are expanded, followed by the exact ssh command.
+
+Each value is annotated with where it came from: unmarked values are set in
+the tunnel's own file, (defaults.yaml) values are inherited, and (default)
+values were not set anywhere. Nothing is changed.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			configManager := config.GetManager()
+			cfg, err := configManager.GetConfig(args[0])
+			if err != nil {
+				return err
+			}
+
+			fields, err := configManager.InspectConfig(args[0])
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Effective configuration for '%s':\n\n", cfg.TunnelName)
+			printInspectedFields(os.Stdout, fields)
+
+			sshCfg := cfg
+			fmt.Println("\nSSH command:")
+			if cfg.Group != "" {
+				members, err := configManager.GroupConfigs(cfg.Group)
+				if err != nil {
+					return err
+				}
+				if sshCfg, err = config.MergeGroup(cfg.Group, members); err != nil {
+					return err
+				}
+				names := make([]string, len(members))
+				for i, member := range members {
+					names[i] = member.TunnelName
+				}
+				fmt.Printf("  (shared by group '%s': %s)\n", cfg.Group, strings.Join(names, ", "))
+			}
+			fmt.Printf("  ssh %s\n", quoteArgs(tunnel.BuildSSHArgs(sshCfg)))
+			return nil
+		},
+	}
+}
+
+// printInspectedFields writes effective configuration values, one per line,
+// annotated with their source
+func printInspectedFields(w io.Writer, fields []config.InspectedField) {
+	width := 0
+	for _, field := range fields {
+		if len(field.Path) > width {
+			width = len(field.Path)
+		}
+	}
+
+	for _, field := range fields {
+		var notes []string
+		if field.Source != config.SourceConfig {
+			notes = append(notes, field.Source)
+		}
+		if field.Unexpanded != "" {
+			notes = append(notes, "from "+field.Unexpanded)
+		}
+
+		value := fmt.Sprint(field.Value)
+		if value == "" {
+			value = `""`
+		}
+
+		line := fmt.Sprintf("  %-*s  %s", width, field.Path, value)
+		if len(notes) > 0 {
+			line += "  (" + strings.Join(notes, ", ") + ")"
+		}
+		fmt.Fprintln(w, line)
+	}
+}
+
+// quoteArgs joins command arguments, quoting those the shell would split
+func quoteArgs(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if arg == "" || strings.ContainsAny(arg, " \t\"'$\\*?") {
+			quoted[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+		} else {
+			quoted[i] = arg
+		}
+	}
+	return strings.Join(quoted, " ")
+}
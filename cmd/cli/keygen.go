@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/lerndmina/SSH-Tunnel/internal/config"
+	"github.com/lerndmina/SSH-Tunnel/internal/ssh"
+	"github.com/spf13/cobra"
+)
+
+// defaultGenerateKeyType is the key type --generate-key creates unless
+// --key-type is given
+const defaultGenerateKeyType = "ed25519"
+
+// addGenerateKeyFlags adds the --generate-key and --key-type flags
+func addGenerateKeyFlags(cmd *cobra.Command) {
+	cmd.Flags().Bool("generate-key", false, "Generate key pairs for key files the configuration references that do not exist")
+	cmd.Flags().String("key-type", defaultGenerateKeyType, "Type of key --generate-key creates (ed25519, ecdsa or rsa)")
+}
+
+// generateKeyType returns the key type to generate missing keys with, or ""
+// if --generate-key is not set
+func generateKeyType(cmd *cobra.Command) (string, error) {
+	if generate, _ := cmd.Flags().GetBool("generate-key"); !generate {
+		return "", nil
+	}
+	keyType, _ := cmd.Flags().GetString("key-type")
+	if err := ssh.CheckKeyType(keyType); err != nil {
+		return "", err
+	}
+	return keyType, nil
+}
+
+// generateMissingKeys creates a key pair of keyType for each of the
+// tunnel's key files that does not exist yet and prints the public key to
+// deploy. Existing key files are left alone. It returns the private key
+// paths of the pairs it created, even when it fails part way.
+func generateMissingKeys(out io.Writer, km *ssh.KeyManager, cfg *config.Config, keyType string) ([]string, error) {
+	keys := []struct {
+		path   string
+		deploy string
+	}{
+		{cfg.SSH.PrivateKeyPath, fmt.Sprintf("authorized_keys of %s@%s", cfg.CloudServer.User, cfg.CloudServer.IP)},
+		{cfg.SSH.NattedKeyPath, "the local server's authorized_keys"},
+	}
+
+	var generated []string
+	for _, key := range keys {
+		if key.path == "" {
+			continue
+		}
+		path := config.ExpandPath(key.path)
+		if slices.Contains(generated, path) {
+			continue
+		}
+		if _, err := os.Stat(path); err == nil || !os.IsNotExist(err) {
+			continue
+		}
+
+		// Listed even if it fails, as the private key may be written already
+		generated = append(generated, path)
+		if err := km.GenerateKeyPair(keyType, path, ssh.DefaultKeyComment(cfg.TunnelName)); err != nil {
+			return generated, fmt.Errorf("failed to generate key %s for tunnel '%s': %w", path, cfg.TunnelName, err)
+		}
+
+		pubKey, err := os.ReadFile(path + ".pub")
+		if err != nil {
+			return generated, fmt.Errorf("failed to read public key: %w", err)
+		}
+		fmt.Fprintf(out, "✓ Generated %s key %s for tunnel '%s'\n", keyType, path, cfg.TunnelName)
+		fmt.Fprintf(out, "  Add its public key to %s:\n  %s\n", key.deploy, strings.TrimSpace(string(pubKey)))
+	}
+	return generated, nil
+}
+
+// removeKeyPairs removes the key pairs at the private key paths. Only
+// regular files are removed, never a link or directory that was in the way.
+func removeKeyPairs(paths []string) error {
+	var errs []error
+	for _, path := range paths {
+		for _, file := range []string{path, path + ".pub"} {
+			if info, err := os.Lstat(file); err != nil || !info.Mode().IsRegular() {
+				continue
+			}
+			if err := os.Remove(file); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
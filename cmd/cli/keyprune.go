@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/lerndmina/SSH-Tunnel/internal/config"
+	"github.com/mitchellh/go-homedir"
+	"github.com/spf13/cobra"
+)
+
+// newKeysPruneCommand creates the keys prune command
+func newKeysPruneCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Delete key files no tunnel uses any more",
+		Long: `Find key files in ~/.ssh named the way this tool names them
+(cloud_server_key, natted_server_key_<tunnel>, <tunnel>_key_natted) that no
+tunnel in any profile refers to, and delete them with their .pub and
+-cert.pub files after confirmation. Certificates a tunnel uses, or whose key
+is used, are kept. Other files are never touched. Use --dry-run to only list them.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dryRun, _ := cmd.Flags().GetBool("dry-run")
+			yes, _ := cmd.Flags().GetBool("yes")
+
+			basePath, err := configBasePath(cmd)
+			if err != nil {
+				return err
+			}
+			home, err := homedir.Dir()
+			if err != nil {
+				return fmt.Errorf("failed to get home directory: %w", err)
+			}
+
+			referenced, err := referencedKeys(basePath, config.GetManager())
+			if err != nil {
+				return fmt.Errorf("not pruning keys: %w", err)
+			}
+			orphans, err := orphanedKeys(filepath.Join(home, ".ssh"), referenced)
+			if err != nil {
+				return err
+			}
+
+			out := cmd.OutOrStdout()
+			if len(orphans) == 0 {
+				fmt.Fprintln(out, "No orphaned key files found.")
+				return nil
+			}
+			fmt.Fprintln(out, "Key files not used by any tunnel:")
+			for _, path := range orphans {
+				fmt.Fprintf(out, "  %s\n", path)
+			}
+			if dryRun {
+				return nil
+			}
+			if !yes && !confirm(cmd.InOrStdin(), fmt.Sprintf("\nDelete these %d files?", len(orphans))) {
+				fmt.Fprintln(out, "Nothing deleted.")
+				return nil
+			}
+
+			return deleteKeys(out, orphans)
+		},
+	}
+
+	cmd.Flags().Bool("dry-run", false, "List orphaned key files without deleting them")
+	cmd.Flags().BoolP("yes", "y", false, "Delete without asking for confirmation")
+	return cmd
+}
+
+// referencedKeys returns the cleaned paths of the key and certificate files
+// referred to by
+// the tunnels and defaults of every profile, and by the tunnels of active,
+// the configuration in use, which may be kept elsewhere, as with
+// --config-file. Tunnels are read through a config manager, so keys set in
+// the defaults count too. A config that cannot be read is an error, since
+// the keys it uses would look orphaned.
+func referencedKeys(basePath string, active *config.Manager) (map[string]bool, error) {
+	profiles, err := config.ListProfiles(basePath)
+	if err != nil {
+		return nil, err
+	}
+
+	referenced := make(map[string]bool)
+	refer := func(cfg *config.Config) {
+		for _, keyPath := range []string{cfg.SSH.PrivateKeyPath, cfg.SSH.NattedKeyPath, cfg.SSH.CertificatePath} {
+			if keyPath != "" {
+				referenced[filepath.Clean(config.ExpandPath(keyPath))] = true
+			}
+		}
+	}
+
+	var managers []*config.Manager
+	if active != nil {
+		managers = append(managers, active)
+	}
+	for _, profile := range profiles {
+		dir := config.ProfilePath(basePath, profile)
+		defaultsPath := filepath.Join(dir, config.DefaultsFile)
+		if _, err := os.Stat(defaultsPath); err == nil {
+			defaults, err := config.ReadConfigFile(defaultsPath)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", defaultsPath, err)
+			}
+			refer(defaults)
+		}
+
+		manager, err := config.NewManager(dir)
+		if err != nil {
+			return nil, fmt.Errorf("profile '%s': %w", profile, err)
+		}
+		managers = append(managers, manager)
+	}
+
+	for _, manager := range managers {
+		// Loading skips configs that fail to read; reloading reports them
+		if err := manager.Reload(); err != nil {
+			return nil, err
+		}
+		for _, name := range manager.ListConfigs() {
+			cfg, err := manager.GetConfig(name)
+			if err != nil {
+				return nil, err
+			}
+			refer(cfg)
+		}
+	}
+	return referenced, nil
+}
+
+// isToolKeyName reports whether a private key file name follows one of the
+// naming conventions of keys this tool creates
+func isToolKeyName(name string) bool {
+	return name == "cloud_server_key" ||
+		(strings.HasPrefix(name, "natted_server_key_") && len(name) > len("natted_server_key_")) ||
+		(strings.HasSuffix(name, "_key_natted") && len(name) > len("_key_natted"))
+}
+
+// orphanedKeys returns the key files in dir named like the tool's keys whose
+// private key is not referenced, including their .pub and -cert.pub files,
+// sorted. A certificate that is referenced itself is kept.
+func orphanedKeys(dir string, referenced map[string]bool) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", dir, err)
+	}
+
+	var orphans []string
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		name := entry.Name()
+		keyName := strings.TrimSuffix(name, ".pub")
+		if strings.HasSuffix(name, "-cert.pub") {
+			// ssh-keygen names a key's certificate after it
+			keyName = strings.TrimSuffix(name, "-cert.pub")
+		}
+		if !isToolKeyName(keyName) {
+			continue
+		}
+
+		path := filepath.Join(dir, name)
+		privateKey := filepath.Join(dir, keyName)
+		if !referenced[filepath.Clean(privateKey)] && !referenced[filepath.Clean(path)] {
+			orphans = append(orphans, path)
+		}
+	}
+	sort.Strings(orphans)
+	return orphans, nil
+}
+
+// deleteKeys removes key files, reporting each one
+func deleteKeys(w io.Writer, paths []string) error {
+	var failed []string
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", path, err))
+			continue
+		}
+		fmt.Fprintf(w, "✓ Deleted %s\n", path)
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to delete some key files:\n%s", strings.Join(failed, "\n"))
+	}
+	return nil
+}
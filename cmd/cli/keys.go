@@ -0,0 +1,234 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/lerndmina/SSH-Tunnel/internal/audit"
+	"github.com/lerndmina/SSH-Tunnel/internal/config"
+	"github.com/lerndmina/SSH-Tunnel/internal/ssh"
+	"github.com/lerndmina/SSH-Tunnel/internal/tunnel"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// newKeysCommand creates the keys command
+func newKeysCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "keys",
+		Short: "Manage SSH keys",
+		Long:  `Commands for managing the SSH keys used by tunnels`,
+	}
+
+	cmd.AddCommand(
+		newKeysListCommand(),
+		newKeysPruneCommand(),
+		newKeysDeployCommand(),
+		newKeysConvertCommand(),
+	)
+
+	return cmd
+}
+
+// newKeysListCommand creates the keys list command
+func newKeysListCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the key files each tunnel uses",
+		Long: `List the cloud and natted key files of every tunnel with their type and
+SHA256 fingerprint, flagging key files that are missing or unreadable.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			entries := listKeys(config.GetManager())
+			if asJSON, _ := cmd.Flags().GetBool("json"); asJSON {
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.SetIndent("", "  ")
+				return enc.Encode(entries)
+			}
+			printKeyList(cmd.OutOrStdout(), entries)
+			return nil
+		},
+	}
+
+	cmd.Flags().Bool("json", false, "Print the list as JSON")
+	return cmd
+}
+
+// keyEntry is a key file used by a tunnel
+type keyEntry struct {
+	Tunnel      string `json:"tunnel"`
+	Role        string `json:"role"`
+	Path        string `json:"path"`
+	Type        string `json:"type,omitempty"`
+	Bits        int    `json:"bits,omitempty"`
+	Fingerprint string `json:"fingerprint,omitempty"`
+	// Problem is set when the key file is missing or unreadable
+	Problem string `json:"problem,omitempty"`
+}
+
+// listKeys returns the key files of every configured tunnel
+func listKeys(configManager *config.Manager) []keyEntry {
+	names := configManager.ListConfigs()
+	sort.Strings(names)
+
+	entries := []keyEntry{}
+	for _, name := range names {
+		cfg, err := configManager.GetConfig(name)
+		if err != nil {
+			continue
+		}
+
+		for _, key := range []struct{ role, path string }{
+			{"cloud", cfg.SSH.PrivateKeyPath},
+			{"natted", cfg.SSH.NattedKeyPath},
+		} {
+			if key.path == "" {
+				continue
+			}
+			entry := keyEntry{Tunnel: name, Role: key.role, Path: config.ExpandPath(key.path)}
+
+			if file, err := os.Open(entry.Path); os.IsNotExist(err) {
+				entry.Problem = "missing"
+			} else if err != nil {
+				entry.Problem = "unreadable: " + err.Error()
+			} else {
+				file.Close()
+			}
+
+			info, err := ssh.Fingerprint(entry.Path)
+			if err == nil {
+				entry.Type, entry.Bits, entry.Fingerprint = info.Type, info.Bits, info.Fingerprint
+			} else if entry.Problem == "" {
+				entry.Problem = err.Error()
+			}
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// printKeyList prints one line per key file
+func printKeyList(w io.Writer, entries []keyEntry) {
+	if len(entries) == 0 {
+		fmt.Fprintln(w, "No tunnels configured.")
+		return
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TUNNEL\tROLE\tPATH\tTYPE\tFINGERPRINT\tSTATUS")
+	for _, e := range entries {
+		keyType, fingerprint, status := "-", "-", "ok"
+		if e.Type != "" {
+			keyType = e.Type
+			if e.Bits > 0 {
+				keyType = fmt.Sprintf("%s (%d)", e.Type, e.Bits)
+			}
+			fingerprint = e.Fingerprint
+		}
+		if e.Problem != "" {
+			status = oneLine(e.Problem)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", e.Tunnel, e.Role, e.Path, keyType, fingerprint, status)
+	}
+	tw.Flush()
+}
+
+// newKeysDeployCommand creates the keys deploy command
+func newKeysDeployCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "deploy <tunnel-name>",
+		Short: "Deploy a tunnel's public key to its cloud server",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.GetManager().GetConfig(args[0])
+			if err != nil {
+				return err
+			}
+
+			timeout, _ := cmd.Flags().GetDuration("timeout")
+			options := cfg.SSH.AuthorizedKeyOptions
+			if cmd.Flags().Changed("options") {
+				options, _ = cmd.Flags().GetString("options")
+			}
+			if restrict, _ := cmd.Flags().GetBool("restrict"); restrict {
+				options = ssh.RestrictedKeyOptions
+			}
+
+			keyManager := ssh.NewKeyManager()
+			keyManager.SetTimeout(timeout)
+			keyManager.SetAlgorithms(sshAlgorithms(cfg))
+			keyManager.SetBindAddress(cfg.SSH.BindAddress)
+
+			target, err := tunnel.ResolveNativeTarget(cfg)
+			if err != nil {
+				return err
+			}
+
+			err = keyManager.DeployPublicKey(target.Host, target.Port, target.User, target.KeyPath, options)
+			config.GetManager().Audit().Log(audit.ActionKeyDeploy, cfg.TunnelName, map[string]string{
+				"host": fmt.Sprintf("%s@%s:%d", target.User, target.Host, target.Port),
+				"key":  target.KeyPath + ".pub",
+			}, err)
+			if err != nil {
+				return fmt.Errorf("failed to deploy key for tunnel '%s': %w", cfg.TunnelName, err)
+			}
+
+			fmt.Printf("✓ Deployed public key to %s@%s\n", target.User, target.Host)
+			return nil
+		},
+	}
+
+	cmd.Flags().Duration("timeout", 0, "SSH connection timeout (default 30s)")
+	cmd.Flags().String("options", "", "authorized_keys options to prefix the key with (default from tunnel config)")
+	cmd.Flags().Bool("restrict", false, "Limit the key to port forwarding ("+ssh.RestrictedKeyOptions+")")
+	return cmd
+}
+
+// sshAlgorithms returns the algorithm restrictions of a tunnel configuration
+// for native SSH connections
+func sshAlgorithms(cfg *config.Config) ssh.Algorithms {
+	return ssh.Algorithms{
+		Ciphers:      cfg.SSH.CipherList(),
+		MACs:         cfg.SSH.MACList(),
+		KeyExchanges: cfg.SSH.KexList(),
+	}
+}
+
+// newKeysConvertCommand creates the keys convert command
+func newKeysConvertCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "convert <in> <out>",
+		Short: "Convert a private key between formats",
+		Long: `Convert a private key to OpenSSH or PKCS#8 PEM format, preserving its type.
+
+The input may be an OpenSSH, PEM (PKCS#1/PKCS#8/SEC1) or PuTTY .ppk key.
+Encrypted keys prompt for their passphrase. The converted key is written
+unencrypted, along with its public key at <out>.pub.`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			format, _ := cmd.Flags().GetString("format")
+
+			keyManager := ssh.NewKeyManager()
+			if err := keyManager.ConvertKey(args[0], args[1], format, promptPassphrase); err != nil {
+				return fmt.Errorf("failed to convert key: %w", err)
+			}
+
+			fmt.Printf("✓ Converted %s to %s (%s)\n", args[0], args[1], format)
+			return nil
+		},
+	}
+
+	cmd.Flags().String("format", ssh.KeyFormatOpenSSH, "Output format (openssh|pkcs8)")
+	return cmd
+}
+
+// promptPassphrase reads a key passphrase from the terminal without echo
+func promptPassphrase() ([]byte, error) {
+	fmt.Fprint(os.Stderr, "Enter passphrase: ")
+	defer fmt.Fprintln(os.Stderr)
+	return term.ReadPassword(int(os.Stdin.Fd()))
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lerndmina/SSH-Tunnel/internal/config"
+	"github.com/lerndmina/SSH-Tunnel/internal/ssh"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListKeys(t *testing.T) {
+	keyDir := t.TempDir()
+	keyManager := ssh.NewKeyManager()
+	cloudKey := filepath.Join(keyDir, "cloud_server_key")
+	nattedKey := filepath.Join(keyDir, "natted_server_key_home")
+	require.NoError(t, keyManager.GenerateKeyPair("ed25519", cloudKey, ""))
+	require.NoError(t, keyManager.GenerateKeyPair("rsa", nattedKey, ""))
+	brokenKey := filepath.Join(keyDir, "broken")
+	require.NoError(t, os.WriteFile(brokenKey, []byte("not a key"), 0600))
+
+	configManager, err := config.NewManager(t.TempDir())
+	require.NoError(t, err)
+	require.NoError(t, configManager.SaveConfig(&config.Config{
+		TunnelName: "home",
+		SSH:        config.SSHConfig{PrivateKeyPath: cloudKey, NattedKeyPath: nattedKey},
+	}))
+	require.NoError(t, configManager.SaveConfig(&config.Config{
+		TunnelName: "work",
+		SSH:        config.SSHConfig{PrivateKeyPath: filepath.Join(keyDir, "gone"), NattedKeyPath: brokenKey},
+	}))
+
+	cloudInfo, err := ssh.Fingerprint(cloudKey)
+	require.NoError(t, err)
+
+	entries := listKeys(configManager)
+	require.Len(t, entries, 4)
+	assert.Equal(t, keyEntry{Tunnel: "home", Role: "cloud", Path: cloudKey, Type: "ssh-ed25519", Bits: 256, Fingerprint: cloudInfo.Fingerprint}, entries[0])
+	assert.Equal(t, "ssh-rsa", entries[1].Type)
+	assert.Empty(t, entries[1].Problem)
+	assert.Equal(t, "missing", entries[2].Problem)
+	assert.Contains(t, entries[3].Problem, "invalid SSH private key")
+
+	var out bytes.Buffer
+	printKeyList(&out, entries)
+	lines := strings.Split(strings.TrimRight(out.String(), "\n"), "\n")
+	require.Len(t, lines, 5)
+	assert.Contains(t, lines[1], cloudInfo.Fingerprint)
+	assert.True(t, strings.HasSuffix(lines[1], "ok"))
+	assert.True(t, strings.HasSuffix(lines[3], "missing"))
+
+	data, err := json.Marshal(entries)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"fingerprint":"`+cloudInfo.Fingerprint+`"`)
+	assert.Contains(t, string(data), `"problem":"missing"`)
+}
+
+func TestOrphanedKeys(t *testing.T) {
+	basePath := t.TempDir()
+	sshDir := t.TempDir()
+	for _, name := range []string{
+		"cloud_server_key", "cloud_server_key.pub",
+		"natted_server_key_home", "natted_server_key_home.pub",
+		"natted_server_key_old", "natted_server_key_old.pub",
+		"lab_key_natted",
+		"natted_server_key_client", // used by a tunnel in another profile
+		"id_ed25519", "id_ed25519.pub", "github_key", "known_hosts",
+	} {
+		require.NoError(t, os.WriteFile(filepath.Join(sshDir, name), []byte("key"), 0600))
+	}
+
+	defaultProfile, err := config.NewManager(basePath)
+	require.NoError(t, err)
+	require.NoError(t, defaultProfile.SaveConfig(&config.Config{
+		TunnelName: "home",
+		SSH: config.SSHConfig{
+			PrivateKeyPath: filepath.Join(sshDir, "cloud_server_key"),
+			NattedKeyPath:  filepath.Join(sshDir, "natted_server_key_home"),
+		},
+	}))
+	require.NoError(t, config.CreateProfile(basePath, "client"))
+	clientProfile, err := config.NewManager(config.ProfilePath(basePath, "client"))
+	require.NoError(t, err)
+	require.NoError(t, clientProfile.SaveConfig(&config.Config{
+		TunnelName: "client",
+		SSH:        config.SSHConfig{NattedKeyPath: filepath.Join(sshDir, "natted_server_key_client")},
+	}))
+
+	// The configuration in use is read from a single file
+	active, err := config.NewManager(basePath)
+	require.NoError(t, err)
+	require.NoError(t, active.UseConfigFile(filepath.Join(t.TempDir(), "tunnels.yaml"), nil))
+	require.NoError(t, active.SaveConfig(&config.Config{
+		TunnelName: "lab",
+		SSH:        config.SSHConfig{NattedKeyPath: filepath.Join(sshDir, "lab_key_natted")},
+	}))
+
+	referenced, err := referencedKeys(basePath, active)
+	require.NoError(t, err)
+	orphans, err := orphanedKeys(sshDir, referenced)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(sshDir, "natted_server_key_old"),
+		filepath.Join(sshDir, "natted_server_key_old.pub"),
+	}, orphans)
+
+	var out bytes.Buffer
+	require.NoError(t, deleteKeys(&out, orphans))
+	assert.NoFileExists(t, filepath.Join(sshDir, "natted_server_key_old"))
+	assert.FileExists(t, filepath.Join(sshDir, "natted_server_key_home"))
+	assert.FileExists(t, filepath.Join(sshDir, "github_key"))
+}
+
+func TestOrphanedKeysKeepsCertificatesInUse(t *testing.T) {
+	basePath := t.TempDir()
+	sshDir := t.TempDir()
+	for _, name := range []string{
+		"natted_server_key_home", "natted_server_key_home.pub", "natted_server_key_home-cert.pub",
+		"natted_server_key_old", "natted_server_key_old-cert.pub",
+		"natted_server_key_signed-cert.pub", // named as a certificate by a tunnel
+	} {
+		require.NoError(t, os.WriteFile(filepath.Join(sshDir, name), []byte("key"), 0600))
+	}
+
+	manager, err := config.NewManager(basePath)
+	require.NoError(t, err)
+	require.NoError(t, manager.SaveConfig(&config.Config{
+		TunnelName: "home",
+		SSH:        config.SSHConfig{NattedKeyPath: filepath.Join(sshDir, "natted_server_key_home")},
+	}))
+	require.NoError(t, manager.SaveConfig(&config.Config{
+		TunnelName: "signed",
+		SSH:        config.SSHConfig{CertificatePath: filepath.Join(sshDir, "natted_server_key_signed-cert.pub")},
+	}))
+
+	referenced, err := referencedKeys(basePath, nil)
+	require.NoError(t, err)
+	orphans, err := orphanedKeys(sshDir, referenced)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(sshDir, "natted_server_key_old"),
+		filepath.Join(sshDir, "natted_server_key_old-cert.pub"),
+	}, orphans)
+}
+
+func TestReferencedKeysRefusesUnreadableConfig(t *testing.T) {
+	basePath := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(basePath, "tunnels"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(basePath, "tunnels", "bad.yaml"), []byte("ssh: [\n"), 0600))
+
+	_, err := referencedKeys(basePath, nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/lerndmina/SSH-Tunnel/internal/config"
+	"github.com/lerndmina/SSH-Tunnel/internal/tunnel"
+)
+
+// listEntry is one tunnel's line in the list output
+type listEntry struct {
+	name       string
+	localPort  string
+	remoteHost string
+	status     string
+	tags       string
+}
+
+// listHeader is the header of the list output
+var listHeader = []string{"NAME", "LOCAL_PORT", "REMOTE_HOST", "STATUS", "TAGS"}
+
+// fields returns the entry's values for the columns of listHeader
+func (e listEntry) fields() []string {
+	return []string{e.name, e.localPort, e.remoteHost, e.status, e.tags}
+}
+
+// listEntries looks up the config and status of each named tunnel. Tunnels
+// whose config cannot be loaded are listed with ERROR in every column.
+func listEntries(tunnelManager *tunnel.Manager, configManager *config.Manager, names []string) []listEntry {
+	entries := make([]listEntry, 0, len(names))
+	for _, name := range names {
+		cfg, err := configManager.GetConfig(name)
+		if err != nil {
+			entries = append(entries, listEntry{name: name, localPort: "ERROR", remoteHost: "ERROR", status: "ERROR", tags: "-"})
+			continue
+		}
+
+		status := "stopped"
+		if tunnelStatus, err := tunnelManager.GetStatus(name); err == nil && tunnelStatus != nil {
+			status = tunnelStatus.Status.String()
+		}
+
+		tags := "-"
+		if len(cfg.Tags) > 0 {
+			tags = strings.Join(cfg.Tags, ",")
+		}
+
+		entries = append(entries, listEntry{
+			name:       name,
+			localPort:  strconv.Itoa(cfg.LocalServer.ReversePort),
+			remoteHost: fmt.Sprintf("%s:%d", cfg.CloudServer.IP, cfg.CloudServer.Port),
+			status:     status,
+			tags:       tags,
+		})
+	}
+	return entries
+}
+
+// writeListTable writes the list of tunnels as a table
+func writeListTable(w io.Writer, entries []listEntry) {
+	fmt.Fprintf(w, "%-20s %-15s %-20s %-10s %s\n", listHeader[0], listHeader[1], listHeader[2], listHeader[3], listHeader[4])
+	fmt.Fprintln(w, strings.Repeat("-", 85))
+
+	for _, e := range entries {
+		fmt.Fprintf(w, "%-20s %-15s %-20s %-10s %s\n", e.name, e.localPort, e.remoteHost, e.status, e.tags)
+	}
+}
+
+// writeListCSV writes the list of tunnels as CSV with a header row
+func writeListCSV(w io.Writer, entries []listEntry) error {
+	records := [][]string{listHeader}
+	for _, e := range entries {
+		records = append(records, e.fields())
+	}
+	return writeCSV(w, records)
+}
+
+// writeCSV writes records as CSV, quoting fields that contain commas,
+// quotes or line breaks
+func writeCSV(w io.Writer, records [][]string) error {
+	cw := csv.NewWriter(w)
+	if err := cw.WriteAll(records); err != nil {
+		return fmt.Errorf("failed to write CSV: %w", err)
+	}
+	return nil
+}
+
+// checkOutput returns an error unless output is one of the formats a
+// command's --output flag accepts
+func checkOutput(output string, formats ...string) error {
+	if slices.Contains(formats, output) {
+		return nil
+	}
+	use := strings.Join(formats, " or ")
+	if len(formats) > 2 {
+		use = strings.Join(formats[:len(formats)-1], ", ") + " or " + formats[len(formats)-1]
+	}
+	return fmt.Errorf("unknown output format '%s' (use %s)", output, use)
+}
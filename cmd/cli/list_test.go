@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"testing"
+
+	"github.com/lerndmina/SSH-Tunnel/internal/config"
+	"github.com/lerndmina/SSH-Tunnel/internal/tunnel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListCSV(t *testing.T) {
+	configManager, err := config.NewManager(t.TempDir())
+	require.NoError(t, err)
+	home := &config.Config{TunnelName: "home", Tags: []string{"prod", "eu"}}
+	home.CloudServer = config.CloudServerConfig{IP: "203.0.113.1", Port: 22}
+	home.LocalServer.ReversePort = 2222
+	require.NoError(t, configManager.SaveConfig(home))
+
+	entries := listEntries(tunnel.NewManagerWithConfig(configManager), configManager, []string{"home", "missing"})
+	var out bytes.Buffer
+	require.NoError(t, writeListCSV(&out, entries))
+	assert.Contains(t, out.String(), `"prod,eu"`, "fields with commas must be quoted")
+
+	records, err := csv.NewReader(&out).ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{
+		{"NAME", "LOCAL_PORT", "REMOTE_HOST", "STATUS", "TAGS"},
+		{"home", "2222", "203.0.113.1:22", "stopped", "prod,eu"},
+		{"missing", "ERROR", "ERROR", "ERROR", "-"},
+	}, records)
+}
+
+func TestCheckOutput(t *testing.T) {
+	assert.NoError(t, checkOutput("csv", "table", "csv"))
+	assert.EqualError(t, checkOutput("json", "table", "csv"), "unknown output format 'json' (use table or csv)")
+	assert.EqualError(t, checkOutput("json", "table", "wide", "csv"), "unknown output format 'json' (use table, wide or csv)")
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/lerndmina/SSH-Tunnel/internal/tunnel"
+)
+
+// logFollowInterval is how often a followed log file is polled for new output
+const logFollowInterval = 500 * time.Millisecond
+
+// showLogs prints the last n lines of a tunnel log file, optionally following
+// it. If grep is set, only lines it matches are printed or counted.
+func showLogs(ctx context.Context, w io.Writer, logFile string, n int, follow, raw bool, grep *regexp.Regexp) error {
+	file, err := os.Open(logFile)
+	if err != nil {
+		if os.IsNotExist(err) && !follow {
+			fmt.Fprintln(w, "No logs captured yet for this tunnel.")
+			return nil
+		}
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	defer file.Close()
+
+	lines, err := tailLines(file, n, grep)
+	if err != nil {
+		return fmt.Errorf("failed to read log file: %w", err)
+	}
+	for _, line := range lines {
+		printLogLine(w, line, raw)
+	}
+
+	if !follow {
+		return nil
+	}
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	reader := bufio.NewReader(file)
+	var partial string
+	for {
+		line, err := reader.ReadString('\n')
+		partial += line
+		if err == nil {
+			if line := strings.TrimRight(partial, "\n"); grep == nil || grep.MatchString(line) {
+				printLogLine(w, line, raw)
+			}
+			partial = ""
+			continue
+		}
+		if err != io.EOF {
+			return fmt.Errorf("failed to read log file: %w", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(logFollowInterval):
+		}
+	}
+}
+
+// tailLines returns the last n lines read from r that grep matches, or of all
+// lines if grep is nil, leaving r at its end
+func tailLines(r io.Reader, n int, grep *regexp.Regexp) ([]string, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if grep != nil && !grep.MatchString(scanner.Text()) {
+			continue
+		}
+		lines = append(lines, scanner.Text())
+		if n > 0 && len(lines) > n {
+			lines = lines[1:]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return lines, nil
+}
+
+// printLogLine prints a captured SSH line, tagged with its severity unless raw
+func printLogLine(w io.Writer, line string, raw bool) {
+	if raw {
+		fmt.Fprintln(w, line)
+		return
+	}
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	level := strings.ToUpper(tunnel.ClassifySSHLine(line).String())
+	fmt.Fprintf(w, "%-7s %s\n", level, line)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const sampleLog = `Authenticated to 203.0.113.1 ([203.0.113.1]:22) using "publickey".
+connect_to localhost port 22: failed.
+Warning: remote port forwarding failed for listen port 2222
+Connection refused
+Transferred: sent 3024, received 2912 bytes
+`
+
+func TestShowLogsGrep(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "home.log")
+	require.NoError(t, os.WriteFile(logFile, []byte(sampleLog), 0600))
+
+	var out bytes.Buffer
+	err := showLogs(context.Background(), &out, logFile, 50, false, true, regexp.MustCompile("failed|refused"))
+	require.NoError(t, err)
+	assert.Equal(t, "connect_to localhost port 22: failed.\n"+
+		"Warning: remote port forwarding failed for listen port 2222\n"+
+		"Connection refused\n", out.String())
+
+	// -n counts matching lines, not lines read
+	out.Reset()
+	err = showLogs(context.Background(), &out, logFile, 1, false, true, regexp.MustCompile("failed|refused"))
+	require.NoError(t, err)
+	assert.Equal(t, "Connection refused\n", out.String())
+}
+
+func TestShowLogsGrepFollow(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "home.log")
+	require.NoError(t, os.WriteFile(logFile, nil, 0600))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var out bytes.Buffer
+	done := make(chan error, 1)
+	go func() {
+		done <- showLogs(ctx, &out, logFile, 50, true, true, regexp.MustCompile("refused"))
+	}()
+
+	file, err := os.OpenFile(logFile, os.O_APPEND|os.O_WRONLY, 0600)
+	require.NoError(t, err)
+	_, err = file.WriteString(sampleLog)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	time.Sleep(2 * logFollowInterval)
+	cancel()
+	require.NoError(t, <-done)
+	assert.Equal(t, "Connection refused\n", out.String())
+}
@@ -3,9 +3,11 @@ package main
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 
 	"github.com/lerndmina/SSH-Tunnel/internal/config"
 	"github.com/lerndmina/SSH-Tunnel/internal/interactive"
+	"github.com/lerndmina/SSH-Tunnel/internal/ssh"
 	"github.com/lerndmina/SSH-Tunnel/pkg/logger"
 	"github.com/spf13/cobra"
 )
@@ -26,6 +28,11 @@ func main() {
 func newRootCommand() *cobra.Command {
 	var configPath string
 	var verbose bool
+	var noColor bool
+	var configFile string
+	var configURL string
+	var identity string
+	var insecure bool
 
 	rootCmd := &cobra.Command{
 		Use:   "ssh-tunnel",
@@ -45,12 +52,63 @@ Features:
 			if verbose {
 				logger.SetLevel(logger.DebugLevel)
 			}
+			color := !noColor && logger.ColorAllowed(os.Stdout)
+			logger.SetColor(color)
+			interactive.SetColor(color)
 
-			// Load configuration
-			if err := config.Initialize(configPath); err != nil {
+			ssh.SkipAllHostKeyChecks(insecure)
+			if insecure {
+				logger.Warnf("INSECURE: --insecure turns off host key verification; connections are open to man-in-the-middle attacks")
+			}
+
+			// Load configuration from the active profile
+			basePath, err := configBasePath(cmd)
+			if err != nil {
+				return err
+			}
+			profilePath, err := config.ActiveProfilePath(basePath)
+			if err != nil {
+				return err
+			}
+			if err := config.Initialize(profilePath); err != nil {
 				return fmt.Errorf("failed to initialize configuration: %w", err)
 			}
 
+			if configURL == "" {
+				configURL = os.Getenv("SSH_TUNNEL_CONFIG_URL")
+			}
+			if configFile != "" && configURL != "" {
+				return fmt.Errorf("--config-file and --config-url cannot be used together")
+			}
+
+			// Remote store, cached in the profile directory for when the
+			// remote cannot be reached
+			if configURL != "" {
+				cache := config.NewFileStore(filepath.Join(profilePath, "remote-cache"))
+				store, err := config.NewHTTPStore(configURL, os.Getenv("SSH_TUNNEL_CONFIG_TOKEN"), cache)
+				if err != nil {
+					return err
+				}
+				if err := config.GetManager().UseStore(store); err != nil {
+					return fmt.Errorf("failed to load tunnel configs from %s: %w", configURL, err)
+				}
+			}
+
+			// Single-file mode, possibly encrypted
+			if configFile != "" {
+				if identity == "" {
+					identity = os.Getenv("SSH_TUNNEL_IDENTITY")
+				}
+				path := config.ExpandPath(configFile)
+				cipher, err := config.CipherForFile(path, identity)
+				if err != nil {
+					return err
+				}
+				if err := config.GetManager().UseConfigFile(path, cipher); err != nil {
+					return fmt.Errorf("failed to load %s: %w", configFile, err)
+				}
+			}
+
 			return nil
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
@@ -64,8 +122,13 @@ Features:
 	}
 
 	// Global flags
-	rootCmd.PersistentFlags().StringVarP(&configPath, "config", "c", "", "config file path")
+	rootCmd.PersistentFlags().StringVarP(&configPath, "config", "c", "", "base config directory (default ~/.ssh-tunnel-manager)")
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "verbose output")
+	rootCmd.PersistentFlags().BoolVar(&noColor, "no-color", false, "disable colored output")
+	rootCmd.PersistentFlags().StringVar(&configFile, "config-file", "", "read all tunnel configs from this YAML file instead; .age, .gpg and .asc files are decrypted in memory")
+	rootCmd.PersistentFlags().StringVar(&configURL, "config-url", "", "read all tunnel configs from this HTTP(S) URL, read-only (default $SSH_TUNNEL_CONFIG_URL; token in $SSH_TUNNEL_CONFIG_TOKEN)")
+	rootCmd.PersistentFlags().StringVar(&identity, "identity", "", "age identity file, or GPG key to encrypt to, for --config-file (default $SSH_TUNNEL_IDENTITY)")
+	rootCmd.PersistentFlags().BoolVar(&insecure, "insecure", false, "do not verify SSH host keys (unsafe; for test servers only)")
 
 	// Add subcommands
 	rootCmd.AddCommand(
@@ -76,6 +139,7 @@ Features:
 		newStopCommand(),
 		newRestartCommand(),
 		newStatusCommand(),
+		newPsCommand(),
 		newLogsCommand(),
 		newConfigCommand(),
 		newBackupCommand(),
@@ -83,6 +147,14 @@ Features:
 		newDiagnosticsCommand(),
 		newRemoteSetupCommand(),
 		newTemplateCommand(),
+		newKeysCommand(),
+		newHostsCommand(),
+		newMigrateCommand(),
+		newInspectCommand(),
+		newProfileCommand(),
+		newUseCommand(),
+		newWhoamiCommand(),
+		newDaemonCommand(),
 	)
 
 	return rootCmd
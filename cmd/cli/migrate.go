@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/lerndmina/SSH-Tunnel/internal/config"
+	"github.com/spf13/cobra"
+)
+
+// newMigrateCommand creates the migrate command
+func newMigrateCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "migrate --from <path>",
+		Short: "Import tunnels from the old bash version",
+		Long: `Import tunnel configurations from the artifacts left by the bash version
+of this tool: a .env file, a connect_<name>.sh script, or a directory
+containing them. Settings that cannot be mapped are reported.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			from, _ := cmd.Flags().GetString("from")
+			dryRun, _ := cmd.Flags().GetBool("dry-run")
+			force, _ := cmd.Flags().GetBool("force")
+
+			result, err := config.ImportLegacy(config.ExpandPath(from))
+			if err != nil {
+				return err
+			}
+
+			configManager := config.GetManager()
+			for _, cfg := range result.Configs {
+				if _, err := configManager.GetConfig(cfg.TunnelName); err == nil && !force {
+					fmt.Printf("- Skipped '%s': configuration already exists (use --force to overwrite)\n", cfg.TunnelName)
+					continue
+				}
+
+				if dryRun {
+					fmt.Printf("✓ Would import '%s' (%s@%s, reverse port %d)\n",
+						cfg.TunnelName, cfg.CloudServer.User, cfg.CloudServer.IP, cfg.LocalServer.ReversePort)
+					continue
+				}
+
+				if err := configManager.SaveConfig(cfg); err != nil {
+					return fmt.Errorf("failed to save configuration '%s': %w", cfg.TunnelName, err)
+				}
+				fmt.Printf("✓ Imported '%s' (%s@%s, reverse port %d)\n",
+					cfg.TunnelName, cfg.CloudServer.User, cfg.CloudServer.IP, cfg.LocalServer.ReversePort)
+			}
+
+			if len(result.Unmapped) > 0 {
+				fmt.Println("\nCould not map:")
+				for _, note := range result.Unmapped {
+					fmt.Printf("  ✗ %s\n", note)
+				}
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().String("from", "", "Legacy .env file, connect_*.sh script or directory")
+	cmd.Flags().Bool("dry-run", false, "Show what would be imported without saving")
+	cmd.Flags().Bool("force", false, "Overwrite existing configurations")
+	_ = cmd.MarkFlagRequired("from")
+	return cmd
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/lerndmina/SSH-Tunnel/internal/config"
+	"github.com/spf13/cobra"
+)
+
+// configBasePath returns the base config directory: the --config flag, or
+// the default directory
+func configBasePath(cmd *cobra.Command) (string, error) {
+	if path, _ := cmd.Flags().GetString("config"); path != "" {
+		return path, nil
+	}
+	return config.DefaultConfigPath()
+}
+
+// newProfileCommand creates the profile command
+func newProfileCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "profile",
+		Short: "Manage config profiles",
+		Long: `Config profiles are separate sets of tunnels, each with its own defaults,
+logs and locks, e.g. one per client. Every other command works within the
+active profile.
+
+The default profile is the base config directory itself; other profiles are
+kept under its profiles/ subdirectory. A config profile is unrelated to the
+profile field of a tunnel, which groups tunnels within one config set.`,
+		// Profile commands work on the base directory, so they must not
+		// fail because the active profile is missing
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			return nil
+		},
+	}
+
+	cmd.AddCommand(
+		&cobra.Command{
+			Use:   "create <name>",
+			Short: "Create an empty config profile",
+			Args:  cobra.ExactArgs(1),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				basePath, err := configBasePath(cmd)
+				if err != nil {
+					return err
+				}
+				if err := config.CreateProfile(basePath, args[0]); err != nil {
+					return err
+				}
+				fmt.Printf("Created profile '%s'; switch to it with 'ssh-tunnel profile use %s'\n", args[0], args[0])
+				return nil
+			},
+		},
+		&cobra.Command{
+			Use:   "use <name>",
+			Short: "Switch to a config profile",
+			Args:  cobra.ExactArgs(1),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				basePath, err := configBasePath(cmd)
+				if err != nil {
+					return err
+				}
+				if err := config.UseProfile(basePath, args[0]); err != nil {
+					return err
+				}
+				fmt.Printf("Switched to profile '%s'\n", args[0])
+				return nil
+			},
+		},
+		&cobra.Command{
+			Use:   "list",
+			Short: "List config profiles, marking the active one",
+			Args:  cobra.NoArgs,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				basePath, err := configBasePath(cmd)
+				if err != nil {
+					return err
+				}
+				profiles, err := config.ListProfiles(basePath)
+				if err != nil {
+					return err
+				}
+				current, err := config.CurrentProfile(basePath)
+				if err != nil {
+					return err
+				}
+
+				for _, name := range profiles {
+					marker := " "
+					if name == current {
+						marker = "*"
+					}
+					fmt.Printf("%s %s\n", marker, name)
+				}
+				return nil
+			},
+		},
+	)
+
+	return cmd
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/lerndmina/SSH-Tunnel/internal/tunnel"
+	"github.com/spf13/cobra"
+)
+
+// newPsCommand creates the ps command
+func newPsCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "ps",
+		Short: "List running tunnel SSH processes",
+		Long: `List the ssh processes on this machine running tunnels, found by the
+command line this tool gives ssh rather than by recorded state.
+
+This shows what is really running: tunnels started by another ssh-tunnel
+process, orphans left by a crashed manager, and ssh processes with a
+tunnel's command line that no config accounts for (TUNNEL "-"). A tunnel
+marked "outdated" has been running since before its config changed;
+restart it to apply the change.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			processes, err := tunnel.NewManager().Processes()
+			if err != nil {
+				return err
+			}
+			if len(processes) == 0 {
+				fmt.Fprintln(cmd.OutOrStdout(), "No tunnel SSH processes running.")
+				return nil
+			}
+			writeProcessTable(cmd.OutOrStdout(), processes, time.Now())
+			return nil
+		},
+	}
+}
+
+// writeProcessTable writes one line per tunnel process
+func writeProcessTable(w io.Writer, processes []tunnel.TunnelProcess, now time.Time) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PID\tTUNNEL\tUPTIME\tFORWARD\tDESTINATION")
+
+	for _, proc := range processes {
+		name := "-"
+		if proc.Tunnel != "" {
+			name = proc.Tunnel
+			if proc.Outdated {
+				name += " (outdated)"
+			}
+		}
+
+		uptime := "-"
+		if !proc.Started.IsZero() {
+			uptime = now.Sub(proc.Started).Round(time.Second).String()
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", strconv.Itoa(proc.PID), name, uptime, proc.Forward, proc.Destination)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lerndmina/SSH-Tunnel/internal/process"
+	"github.com/lerndmina/SSH-Tunnel/internal/tunnel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcessTable(t *testing.T) {
+	now := time.Now()
+	processes := []tunnel.TunnelProcess{
+		{Process: process.Process{PID: 4242, Started: now.Add(-90 * time.Minute)}, Tunnel: "home", Forward: "2222:localhost:22", Destination: "tunnel@203.0.113.1"},
+		{Process: process.Process{PID: 4300}, Tunnel: "lab", Outdated: true, Forward: "2223:localhost:22", Destination: "tunnel@203.0.113.1"},
+		{Process: process.Process{PID: 5000}, Forward: "2299:localhost:22", Destination: "ops@198.51.100.4"},
+	}
+
+	var out bytes.Buffer
+	writeProcessTable(&out, processes, now)
+	lines := strings.Split(strings.TrimRight(out.String(), "\n"), "\n")
+	require.Len(t, lines, 4)
+
+	assert.Equal(t, []string{"PID", "TUNNEL", "UPTIME", "FORWARD", "DESTINATION"}, strings.Fields(lines[0]))
+	assert.Equal(t, []string{"4242", "home", "1h30m0s", "2222:localhost:22", "tunnel@203.0.113.1"}, strings.Fields(lines[1]))
+	assert.Equal(t, []string{"4300", "lab", "(outdated)", "-", "2223:localhost:22", "tunnel@203.0.113.1"}, strings.Fields(lines[2]))
+	assert.Equal(t, []string{"5000", "-", "-", "2299:localhost:22", "ops@198.51.100.4"}, strings.Fields(lines[3]))
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/lerndmina/SSH-Tunnel/internal/audit"
+	"github.com/lerndmina/SSH-Tunnel/internal/config"
+	"github.com/lerndmina/SSH-Tunnel/internal/remote"
+	"github.com/lerndmina/SSH-Tunnel/internal/ssh"
+	"github.com/spf13/cobra"
+)
+
+// defaultIdentities are tried in order when no --identity is given
+var defaultIdentities = []string{"~/.ssh/id_ed25519", "~/.ssh/id_ecdsa", "~/.ssh/id_rsa"}
+
+// newRemoteSetupCommand creates the remote setup command
+func newRemoteSetupCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "remote-setup [flags] <host>",
+		Short: "Setup a remote server for SSH tunneling",
+		Long: `Prepare a cloud server for SSH tunneling.
+
+This command will:
+- Install required packages
+- Configure SSH daemon for secure tunneling
+- Setup firewall rules
+- Create a dedicated tunnel user and authorize its key
+
+The server is inspected first and the exact changes are shown as a plan,
+which must be confirmed before anything is changed (skip with --yes).
+Use --dry-run to only show the plan. Once applied, a summary lists exactly
+what changed; --json prints it as JSON for automation instead, and needs
+--yes since there is no plan to confirm.
+
+sshd_config is backed up before it is changed and the new file is checked
+with sshd -t; if sshd rejects it the backup is restored. Use --rollback to
+restore the most recent backup later.
+
+A remote command that hangs, e.g. waiting on a package manager lock, is
+cancelled after --command-timeout, and the whole inspection or run is
+abandoned after --timeout, naming the step that stalled.
+
+Examples:
+  ssh-tunnel remote-setup 1.2.3.4
+  ssh-tunnel remote-setup --user ubuntu --key ~/.ssh/id_rsa.pub server.example.com
+  ssh-tunnel remote-setup --rollback server.example.com`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			host := args[0]
+			user, _ := cmd.Flags().GetString("user")
+			port, _ := cmd.Flags().GetInt("port")
+			identity, _ := cmd.Flags().GetString("identity")
+			dryRun, _ := cmd.Flags().GetBool("dry-run")
+			yes, _ := cmd.Flags().GetBool("yes")
+			rollback, _ := cmd.Flags().GetBool("rollback")
+			timeout, _ := cmd.Flags().GetDuration("timeout")
+			commandTimeout, _ := cmd.Flags().GetDuration("command-timeout")
+			asJSON, _ := cmd.Flags().GetBool("json")
+
+			if asJSON && (dryRun || rollback) {
+				return fmt.Errorf("--json cannot be combined with --dry-run or --rollback")
+			}
+			if asJSON && !yes {
+				return fmt.Errorf("--json requires --yes, since the plan cannot be confirmed")
+			}
+
+			opts, err := remoteSetupOptions(cmd, user, port)
+			if err != nil {
+				return err
+			}
+
+			identity, err = resolveIdentity(identity)
+			if err != nil {
+				return err
+			}
+
+			client, err := ssh.NewKeyManager().Connect(host, user, identity, port)
+			if err != nil {
+				return err
+			}
+			defer client.Close()
+
+			exec := remote.WithCommandTimeout(remote.NewSSHExecutor(client), commandTimeout)
+
+			if rollback {
+				ctx, cancel := withOptionalTimeout(timeout)
+				defer cancel()
+				backup, err := remote.RollbackSSHD(ctx, exec, opts.Sudo)
+				if err != nil {
+					return timeoutHint(err, timeout)
+				}
+				fmt.Printf("✓ Restored %s from %s and reloaded sshd\n", remote.SSHDConfigPath, backup)
+				return nil
+			}
+
+			inspectCtx, cancel := withOptionalTimeout(timeout)
+			plan, err := remote.BuildPlan(inspectCtx, exec, opts)
+			cancel()
+			if err != nil {
+				return timeoutHint(fmt.Errorf("failed to inspect %s: %w", host, err), timeout)
+			}
+			for _, warning := range plan.Warnings {
+				fmt.Fprintf(cmd.ErrOrStderr(), "Warning: %s\n", warning)
+			}
+
+			if plan.Empty() {
+				if asJSON {
+					return writeRemoteResultJSON(cmd.OutOrStdout(), host, &remote.Result{}, nil)
+				}
+				fmt.Printf("✓ %s is already set up; nothing to do\n", host)
+				return nil
+			}
+
+			if asJSON {
+				ctx, cancel := withOptionalTimeout(timeout)
+				defer cancel()
+				res, err := applyRemotePlan(ctx, exec, plan, host, port)
+				if err != nil {
+					err = timeoutHint(err, timeout)
+				}
+				if jsonErr := writeRemoteResultJSON(cmd.OutOrStdout(), host, res, err); jsonErr != nil {
+					return jsonErr
+				}
+				return err
+			}
+
+			fmt.Printf("Remote setup plan for %s@%s:\n\n", user, host)
+			printRemotePlan(os.Stdout, plan)
+
+			if dryRun {
+				return nil
+			}
+			if !yes && !confirm(cmd.InOrStdin(), "\nApply these changes?") {
+				fmt.Println("Aborted; no changes made")
+				return nil
+			}
+
+			// The time spent at the confirmation prompt does not count
+			ctx, cancel := withOptionalTimeout(timeout)
+			defer cancel()
+			res, err := applyRemotePlan(ctx, exec, plan, host, port)
+			if err != nil {
+				if res.Changed() {
+					fmt.Println("Changes made before the failure:")
+					printRemoteResult(os.Stdout, res)
+				}
+				return fmt.Errorf("%w\nCompleted steps are recorded on the server; run remote-setup again to resume", timeoutHint(err, timeout))
+			}
+
+			fmt.Printf("✓ Remote setup of %s complete\n", host)
+			printRemoteResult(os.Stdout, res)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringP("user", "u", "root", "SSH user for connecting to remote server")
+	cmd.Flags().StringP("identity", "i", "", "Private key for connecting to remote server (default ~/.ssh/id_ed25519, id_ecdsa or id_rsa)")
+	cmd.Flags().StringP("key", "k", "", "Path to public key file to deploy")
+	cmd.Flags().Bool("restrict", false, "Limit the deployed key to port forwarding ("+ssh.RestrictedKeyOptions+")")
+	cmd.Flags().StringP("tunnel-user", "t", remote.DefaultTunnelUser, "Username to create for tunnel connections")
+	cmd.Flags().IntP("port", "p", 22, "SSH port on remote server")
+	cmd.Flags().Bool("dry-run", false, "Show what would be done without executing")
+	cmd.Flags().BoolP("yes", "y", false, "Apply the plan without asking for confirmation")
+	cmd.Flags().Bool("json", false, "Print what changed as JSON (requires --yes)")
+	cmd.Flags().Bool("rollback", false, "Restore the last sshd_config backup made by remote-setup")
+	cmd.Flags().Duration("timeout", 30*time.Minute, "Give up if inspecting or applying takes longer than this (0 for no limit)")
+	cmd.Flags().Duration("command-timeout", 10*time.Minute, "Cancel any single remote command running longer than this (0 for no limit)")
+
+	return cmd
+}
+
+// withOptionalTimeout returns a context that expires after timeout, or never
+// if timeout is zero or less
+func withOptionalTimeout(timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), timeout)
+}
+
+// timeoutHint adds the overall time limit to errors caused by it running
+// out, which otherwise only say the context deadline was exceeded
+func timeoutHint(err error, timeout time.Duration) error {
+	var cmdErr *remote.CommandTimeoutError
+	if timeout > 0 && errors.Is(err, context.DeadlineExceeded) && !errors.As(err, &cmdErr) {
+		return fmt.Errorf("%w (remote-setup timed out after %s; raise it with --timeout)", err, timeout)
+	}
+	return err
+}
+
+// remoteSetupOptions builds the desired server state from the command flags
+func remoteSetupOptions(cmd *cobra.Command, user string, port int) (remote.Options, error) {
+	tunnelUser, _ := cmd.Flags().GetString("tunnel-user")
+	keyPath, _ := cmd.Flags().GetString("key")
+	restrict, _ := cmd.Flags().GetBool("restrict")
+
+	opts := remote.Options{
+		TunnelUser: tunnelUser,
+		SSHPort:    port,
+		Sudo:       user != "root",
+	}
+	if restrict {
+		opts.KeyOptions = ssh.RestrictedKeyOptions
+	}
+	if keyPath != "" {
+		data, err := os.ReadFile(config.ExpandPath(keyPath))
+		if err != nil {
+			return opts, fmt.Errorf("failed to read public key: %w", err)
+		}
+		opts.PublicKey = data
+	}
+
+	return opts, nil
+}
+
+// resolveIdentity returns the private key to connect with, falling back to
+// the first default identity that exists
+func resolveIdentity(identity string) (string, error) {
+	if identity != "" {
+		return config.ExpandPath(identity), nil
+	}
+	for _, candidate := range defaultIdentities {
+		path := config.ExpandPath(candidate)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("no private key found; specify one with --identity")
+}
+
+// printRemotePlan writes a remote setup plan as a list of changes
+func printRemotePlan(w io.Writer, plan *remote.Plan) {
+	if len(plan.Packages) > 0 {
+		fmt.Fprintf(w, "Packages to install (with %s):\n", plan.PackageManager)
+		for _, pkg := range plan.Packages {
+			fmt.Fprintf(w, "  + %s\n", pkg)
+		}
+	}
+
+	if plan.CreateUser {
+		fmt.Fprintln(w, "User to create:")
+		fmt.Fprintf(w, "  + %s\n", plan.TunnelUser)
+	}
+
+	if plan.AuthorizedKey != "" {
+		fmt.Fprintf(w, "Key to authorize for %s:\n", plan.TunnelUser)
+		fmt.Fprintf(w, "  + %s\n", plan.AuthorizedKey)
+	}
+
+	if len(plan.SSHDChanges) > 0 {
+		fmt.Fprintf(w, "%s changes:\n", remote.SSHDConfigPath)
+		for _, change := range plan.SSHDChanges {
+			if change.Before != "" {
+				fmt.Fprintf(w, "  - %s\n", change.Before)
+			}
+			fmt.Fprintf(w, "  + %s\n", change.After)
+		}
+	}
+
+	if len(plan.FirewallRules) > 0 {
+		fmt.Fprintln(w, "Firewall rules to add:")
+		for _, rule := range plan.FirewallRules {
+			fmt.Fprintf(w, "  + %s %s\n", plan.Firewall, rule)
+		}
+	}
+}
+
+// applyRemotePlan applies a plan and records any key deployment in the
+// audit log
+func applyRemotePlan(ctx context.Context, exec remote.Executor, plan *remote.Plan, host string, port int) (*remote.Result, error) {
+	res, err := remote.Apply(ctx, exec, plan)
+	if plan.AuthorizedKey != "" {
+		config.GetManager().Audit().Log(audit.ActionKeyDeploy, "", map[string]string{
+			"host": fmt.Sprintf("%s@%s:%d", plan.TunnelUser, host, port),
+			"key":  plan.AuthorizedKey,
+		}, err)
+	}
+	return res, err
+}
+
+// printRemoteResult writes the changes a remote setup made, one kind per
+// line
+func printRemoteResult(w io.Writer, res *remote.Result) {
+	if !res.Changed() {
+		fmt.Fprintln(w, "  No changes were needed")
+		return
+	}
+	if len(res.Packages) > 0 {
+		fmt.Fprintf(w, "  Packages installed: %s\n", strings.Join(res.Packages, ", "))
+	}
+	if res.UserCreated {
+		fmt.Fprintln(w, "  User created: yes")
+	}
+	if res.KeyDeployed {
+		fmt.Fprintln(w, "  Key deployed: yes")
+	}
+	if len(res.SSHDOptions) > 0 {
+		fmt.Fprintf(w, "  sshd options set: %s (backup %s)\n", strings.Join(res.SSHDOptions, ", "), res.SSHDBackup)
+	}
+	if len(res.FirewallRules) > 0 {
+		fmt.Fprintf(w, "  Firewall rules added: %s\n", strings.Join(res.FirewallRules, ", "))
+	}
+}
+
+// remoteSetupReport is the JSON output of remote-setup --json
+type remoteSetupReport struct {
+	Host string `json:"host"`
+	*remote.Result
+	Changed bool   `json:"changed"`
+	Error   string `json:"error,omitempty"`
+}
+
+// writeRemoteResultJSON writes the changes a remote setup made, and the
+// error that stopped it, if any, as JSON
+func writeRemoteResultJSON(w io.Writer, host string, res *remote.Result, err error) error {
+	if res.Packages == nil {
+		res.Packages = []string{}
+	}
+	if res.SSHDOptions == nil {
+		res.SSHDOptions = []string{}
+	}
+	if res.FirewallRules == nil {
+		res.FirewallRules = []string{}
+	}
+
+	report := remoteSetupReport{Host: host, Result: res, Changed: res.Changed()}
+	if err != nil {
+		report.Error = err.Error()
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
+
+// confirm asks a yes/no question, defaulting to no
+func confirm(in io.Reader, question string) bool {
+	fmt.Printf("%s [y/N]: ", question)
+	answer, _ := bufio.NewReader(in).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/lerndmina/SSH-Tunnel/internal/remote"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRemoteResultOutput(t *testing.T) {
+	res := &remote.Result{UserCreated: true, FirewallRules: []string{"allow 22/tcp"}}
+
+	var text bytes.Buffer
+	printRemoteResult(&text, res)
+	assert.Equal(t, "  User created: yes\n  Firewall rules added: allow 22/tcp\n", text.String())
+
+	var out bytes.Buffer
+	require.NoError(t, writeRemoteResultJSON(&out, "203.0.113.5", res, errors.New("failed to reload sshd")))
+	var report map[string]interface{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &report))
+	assert.Equal(t, map[string]interface{}{
+		"host":                 "203.0.113.5",
+		"packages_installed":   []interface{}{},
+		"user_created":         true,
+		"key_deployed":         false,
+		"sshd_options_set":     []interface{}{},
+		"firewall_rules_added": []interface{}{"allow 22/tcp"},
+		"changed":              true,
+		"error":                "failed to reload sshd",
+	}, report)
+
+	text.Reset()
+	printRemoteResult(&text, &remote.Result{})
+	assert.Equal(t, "  No changes were needed\n", text.String())
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/lerndmina/SSH-Tunnel/internal/config"
+	"github.com/lerndmina/SSH-Tunnel/internal/tunnel"
+	"github.com/lerndmina/SSH-Tunnel/pkg/logger"
+	"github.com/spf13/cobra"
+)
+
+// defaultRestartDebounce is how long --on-change waits for a config file
+// to stop changing before restarting its tunnel, since editors often write
+// a file in several steps
+const defaultRestartDebounce = 500 * time.Millisecond
+
+// runRestart restarts the named tunnel; without a name, the active tunnel,
+// or all tunnels with --all or if none is active
+func runRestart(cmd *cobra.Command, args []string) error {
+	configManager := config.GetManager()
+	tunnelManager := tunnel.NewManagerWithConfig(configManager)
+	parallel, _ := cmd.Flags().GetInt("parallel")
+	if err := checkParallel(parallel); err != nil {
+		return err
+	}
+	args, err := selectArgs(cmd, configManager, tunnelManager, args)
+	if err != nil {
+		return err
+	}
+	configs, single, err := tunnelTargets(cmd, configManager, args)
+	if err != nil {
+		return err
+	}
+	if len(configs) == 0 {
+		fmt.Println("No tunnels configured.")
+		return nil
+	}
+
+	events := tunnelManager.Subscribe()
+	defer tunnelManager.Unsubscribe(events)
+
+	if single {
+		tunnelName := configs[0]
+		if err := tunnelManager.Restart(tunnelName); err != nil {
+			return fmt.Errorf("failed to restart tunnel '%s': %w", tunnelName, err)
+		}
+		fmt.Printf("✓ Restarted tunnel: %s\n", tunnelName)
+		return waitForExpiry(cmd.Context(), tunnelManager, events, configs)
+	}
+
+	// A group restarts with its first tunnel
+	targets, members := groupTargets(configManager, configs)
+	restarted, err := restartTunnels(cmd.OutOrStdout(), tunnelManager.Restart, targets, members, parallel)
+	// Tunnels that did restart still stop on time
+	waitErr := waitForExpiry(cmd.Context(), tunnelManager, events, restarted)
+	if err != nil {
+		return err
+	}
+	return waitErr
+}
+
+// restartTunnels restarts the target tunnels, at most parallel at once,
+// and returns the names of the tunnels restarted with them, members
+// listing those of each target
+func restartTunnels(out io.Writer, restart func(name string) error, targets []string, members map[string][]string, parallel int) ([]string, error) {
+	var mu sync.Mutex
+	var restarted []string
+	errors := runBulk(targets, parallel, func(name string) error {
+		if err := restart(name); err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		for _, member := range members[name] {
+			fmt.Fprintf(out, "✓ Restarted tunnel: %s\n", member)
+		}
+		restarted = append(restarted, members[name]...)
+		return nil
+	})
+
+	if len(errors) > 0 {
+		return restarted, fmt.Errorf("failed to restart some tunnels:\n%s", strings.Join(errors, "\n"))
+	}
+	return restarted, nil
+}
+
+// runRestartOnChange runs 'restart --on-change' for the named tunnel, or all
+// tunnels with --all, until the process is interrupted
+func runRestartOnChange(cmd *cobra.Command, args []string) error {
+	all, _ := cmd.Flags().GetBool("all")
+	debounce, _ := cmd.Flags().GetDuration("debounce")
+	configManager := config.GetManager()
+	tunnelManager := tunnel.NewManagerWithConfig(configManager)
+	args, err := selectArgs(cmd, configManager, tunnelManager, args)
+	if err != nil {
+		return err
+	}
+
+	var names []string
+	switch {
+	case all:
+		names = configManager.ListConfigs()
+		sort.Strings(names)
+	case len(args) > 0:
+		names = args[:1]
+	default:
+		return fmt.Errorf("specify a tunnel name, --select or --all with --on-change")
+	}
+	if len(names) == 0 {
+		fmt.Println("No tunnels configured. Run 'ssh-tunnel setup' to create one.")
+		return nil
+	}
+
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return restartOnChange(ctx, configManager, tunnelManager, names, debounce)
+}
+
+// restartOnChange starts the named tunnels and restarts each one whenever
+// its config file changes, until ctx is done; then it stops them. The
+// tunnels must be kept in local files, which rules out --config-url.
+func restartOnChange(ctx context.Context, configManager *config.Manager, tunnelManager *tunnel.Manager, names []string, debounce time.Duration) error {
+	files := make(map[string]string, len(names))
+	for _, name := range names {
+		path, ok := configManager.LocalFile(name)
+		if !ok {
+			return fmt.Errorf("--on-change watches config files, but the config of tunnel '%s' is not kept in a local file", name)
+		}
+		files[name] = path
+	}
+
+	var started []string
+	for _, name := range names {
+		if err := tunnelManager.StartContext(ctx, name); err != nil {
+			logger.Errorf("Failed to start tunnel '%s': %v", name, err)
+			continue
+		}
+		logger.Infof("Started tunnel: %s", name)
+		started = append(started, name)
+	}
+	if len(started) == 0 {
+		return fmt.Errorf("no tunnels started")
+	}
+
+	// The hash of the config each tunnel runs with, so files saved without
+	// changes do not restart it
+	hashes := make(map[string]string, len(started))
+	for _, name := range started {
+		if cfg, err := configManager.GetConfig(name); err == nil {
+			hashes[name], _ = cfg.Hash()
+		}
+	}
+
+	watched := make(map[string]string, len(started))
+	for _, name := range started {
+		watched[name] = files[name]
+	}
+	logger.Infof("Watching the config files of %s for changes", strings.Join(started, ", "))
+	err := watchTunnelConfigs(ctx, watched, debounce, func(name string) {
+		restartIfChanged(configManager, tunnelManager.Restart, hashes, name)
+	})
+
+	for _, name := range started {
+		if err := tunnelManager.Stop(name); err != nil {
+			logger.Warnf("Failed to stop tunnel '%s': %v", name, err)
+		}
+	}
+	return err
+}
+
+// restartIfChanged reloads a tunnel's config and restarts the tunnel if the
+// config's hash differs from hashes[name], the one it runs with, recording
+// the new hash. It reports whether the tunnel was restarted.
+func restartIfChanged(configManager *config.Manager, restart func(name string) error, hashes map[string]string, name string) bool {
+	cfg, err := configManager.ReloadConfig(name)
+	if err != nil {
+		logger.Errorf("Not restarting tunnel '%s': %v", name, err)
+		return false
+	}
+	hash, err := cfg.Hash()
+	if err == nil && hash == hashes[name] {
+		logger.Infof("Config of tunnel '%s' was saved without changes; not restarting", name)
+		return false
+	}
+
+	logger.Infof("Config of tunnel '%s' changed; restarting", name)
+	if err := restart(name); err != nil {
+		logger.Errorf("Failed to restart tunnel '%s': %v", name, err)
+		return false
+	}
+	hashes[name] = hash
+	logger.Infof("Restarted tunnel: %s", name)
+	return true
+}
+
+// watchTunnelConfigs calls onChange with a tunnel's name once its config
+// file, given by files, has been written or replaced and then left alone for
+// the debounce period, until ctx is done. Tunnels sharing a file, as in
+// single-file mode, are all passed to onChange when it changes. The
+// directories are watched rather than the files, so editors that save by
+// renaming a new file into place are seen too. onChange runs on the
+// watching goroutine, one call at a time.
+func watchTunnelConfigs(ctx context.Context, files map[string]string, debounce time.Duration, onChange func(name string)) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to watch config files: %w", err)
+	}
+	defer watcher.Close()
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// The tunnels kept in each file
+	watched := make(map[string][]string)
+	for _, name := range names {
+		path := filepath.Clean(files[name])
+		if _, ok := watched[path]; !ok {
+			if err := watcher.Add(filepath.Dir(path)); err != nil {
+				return fmt.Errorf("failed to watch %s: %w", filepath.Dir(path), err)
+			}
+		}
+		watched[path] = append(watched[path], name)
+	}
+
+	timers := make(map[string]*time.Timer)
+	defer func() {
+		for _, timer := range timers {
+			timer.Stop()
+		}
+	}()
+	settled := make(chan string)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			path := filepath.Clean(event.Name)
+			if watched[path] == nil || !event.Has(fsnotify.Write) && !event.Has(fsnotify.Create) {
+				continue
+			}
+			if timer, ok := timers[path]; ok {
+				timer.Reset(debounce)
+				continue
+			}
+			timers[path] = time.AfterFunc(debounce, func() {
+				select {
+				case settled <- path:
+				case <-ctx.Done():
+				}
+			})
+
+		case path := <-settled:
+			delete(timers, path)
+			for _, name := range watched[path] {
+				onChange(name)
+			}
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			logger.Warnf("Error watching config files: %v", err)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lerndmina/SSH-Tunnel/internal/config"
+	"github.com/lerndmina/SSH-Tunnel/internal/tunnel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatchTunnelConfigsDebouncesChanges(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "home.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("tunnel_name: home\n"), 0600))
+
+	var mu sync.Mutex
+	var changed []string
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- watchTunnelConfigs(ctx, map[string]string{"home": path}, 200*time.Millisecond, func(name string) {
+			mu.Lock()
+			changed = append(changed, name)
+			mu.Unlock()
+		})
+	}()
+	// Give the watcher time to start
+	time.Sleep(100 * time.Millisecond)
+
+	// Several quick writes, as editors make, and a change to an unwatched file
+	for i := 0; i < 5; i++ {
+		require.NoError(t, os.WriteFile(path, []byte("tunnel_name: home\n# edit\n"), 0600))
+		time.Sleep(20 * time.Millisecond)
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "other.yaml"), []byte("tunnel_name: other\n"), 0600))
+	time.Sleep(600 * time.Millisecond)
+
+	cancel()
+	require.NoError(t, <-done)
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"home"}, changed, "changes within the debounce should restart once")
+}
+
+func TestWatchTunnelConfigsInOneFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tunnels.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("tunnel_name: home\n"), 0600))
+
+	changed := make(chan string, 4)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- watchTunnelConfigs(ctx, map[string]string{"home": path, "work": path}, 50*time.Millisecond, func(name string) {
+			changed <- name
+		})
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	// A change to the shared file is checked for every tunnel in it
+	require.NoError(t, os.WriteFile(path, []byte("tunnel_name: home\n---\ntunnel_name: work\n"), 0600))
+	var names []string
+	for len(names) < 2 {
+		select {
+		case name := <-changed:
+			names = append(names, name)
+		case <-time.After(2 * time.Second):
+			t.Fatal("no change seen")
+		}
+	}
+	assert.Equal(t, []string{"home", "work"}, names)
+
+	cancel()
+	require.NoError(t, <-done)
+}
+
+func TestRestartOnChangeNeedsLocalFiles(t *testing.T) {
+	cm, err := config.NewManager(t.TempDir())
+	require.NoError(t, err)
+	require.NoError(t, cm.UseStore(config.NewMemoryStore()))
+	require.NoError(t, cm.SaveConfig(&config.Config{TunnelName: "home"}))
+
+	err = restartOnChange(context.Background(), cm, tunnel.NewManagerWithConfig(cm), []string{"home"}, time.Second)
+	assert.ErrorContains(t, err, "not kept in a local file")
+}
+
+func TestRestartIfChangedSkipsIdenticalSave(t *testing.T) {
+	dir := t.TempDir()
+	cm, err := config.NewManager(dir)
+	require.NoError(t, err)
+	require.NoError(t, cm.SaveConfig(&config.Config{TunnelName: "home", CloudServer: config.CloudServerConfig{IP: "203.0.113.1"}}))
+	cfg, err := cm.GetConfig("home")
+	require.NoError(t, err)
+	hash, err := cfg.Hash()
+	require.NoError(t, err)
+	hashes := map[string]string{"home": hash}
+
+	var restarts []string
+	restart := func(name string) error {
+		restarts = append(restarts, name)
+		return nil
+	}
+
+	// Another process saves the config again without changing it
+	editor, err := config.NewManager(dir)
+	require.NoError(t, err)
+	saved, err := editor.GetConfig("home")
+	require.NoError(t, err)
+	require.NoError(t, editor.SaveConfig(saved))
+	assert.False(t, restartIfChanged(cm, restart, hashes, "home"))
+	assert.Empty(t, restarts)
+
+	// A real change restarts the tunnel, once
+	saved.CloudServer.IP = "203.0.113.2"
+	require.NoError(t, editor.SaveConfig(saved))
+	assert.True(t, restartIfChanged(cm, restart, hashes, "home"))
+	assert.False(t, restartIfChanged(cm, restart, hashes, "home"))
+	assert.Equal(t, []string{"home"}, restarts)
+}
+
+func TestRestartTunnelsReportsGroupsAndFailures(t *testing.T) {
+	var out bytes.Buffer
+	restart := func(name string) error {
+		if name == "broken" {
+			return fmt.Errorf("tunnel '%s' not found", name)
+		}
+		return nil
+	}
+	members := map[string][]string{"lab": {"lab", "web"}, "broken": {"broken"}}
+
+	restarted, err := restartTunnels(&out, restart, []string{"lab", "broken"}, members, 1)
+	assert.ErrorContains(t, err, "failed to restart some tunnels")
+	assert.ErrorContains(t, err, "tunnel 'broken' not found")
+	assert.Equal(t, []string{"lab", "web"}, restarted)
+	assert.Equal(t, "✓ Restarted tunnel: lab\n✓ Restarted tunnel: web\n", out.String())
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"time"
+
+	"github.com/coreos/go-systemd/v22/daemon"
+	"github.com/lerndmina/SSH-Tunnel/pkg/logger"
+)
+
+// systemdNotifier reports the daemon's state to systemd. Outside systemd,
+// where NOTIFY_SOCKET is unset, it does nothing.
+type systemdNotifier struct {
+	// watchdog is how often to send a watchdog heartbeat: half of the
+	// service's WatchdogSec, or zero if the watchdog is off
+	watchdog time.Duration
+}
+
+// newSystemdNotifier creates a notifier for the service the process runs
+// as, if any
+func newSystemdNotifier() *systemdNotifier {
+	interval, err := daemon.SdWatchdogEnabled(false)
+	if err != nil {
+		logger.Warnf("Ignoring systemd watchdog settings: %v", err)
+	}
+	return &systemdNotifier{watchdog: interval / 2}
+}
+
+// notify sends a state such as daemon.SdNotifyReady to systemd
+func (n *systemdNotifier) notify(state string) {
+	if _, err := daemon.SdNotify(false, state); err != nil {
+		logger.Warnf("Failed to notify systemd (%s): %v", state, err)
+	}
+}
+
+// heartbeats returns a channel ticking whenever a watchdog heartbeat is
+// due, or nil if the watchdog is off, and a function to stop it
+func (n *systemdNotifier) heartbeats() (<-chan time.Time, func()) {
+	if n.watchdog <= 0 {
+		return nil, func() {}
+	}
+	ticker := time.NewTicker(n.watchdog)
+	return ticker.C, ticker.Stop
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/lerndmina/SSH-Tunnel/internal/config"
+	"github.com/lerndmina/SSH-Tunnel/internal/tunnel"
+	"github.com/spf13/cobra"
+)
+
+// addSelectFlag adds the --select flag, which picks the tunnel from a list
+func addSelectFlag(cmd *cobra.Command) {
+	cmd.Flags().Bool("select", false, "Pick the tunnel from a list of configured tunnels")
+}
+
+// selectArgs returns args unchanged unless --select is set and no tunnel is
+// named; then the user picks a tunnel from a list showing each tunnel's
+// status, and args holds its name
+func selectArgs(cmd *cobra.Command, configManager *config.Manager, tunnelManager *tunnel.Manager, args []string) ([]string, error) {
+	selectFlag, _ := cmd.Flags().GetBool("select")
+	if !selectFlag || len(args) > 0 {
+		return args, nil
+	}
+
+	names := configManager.ListConfigs()
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no tunnels configured")
+	}
+	sort.Strings(names)
+
+	entries := make([]pickerEntry, 0, len(names))
+	for _, name := range names {
+		status, err := tunnelManager.GetStatus(name)
+		entry := pickerEntry{name: name, status: "stopped"}
+		if err == nil && status != nil {
+			entry.status = status.Status.String()
+		}
+		entries = append(entries, entry)
+	}
+
+	name, err := pickTunnel(cmd.InOrStdin(), cmd.ErrOrStderr(), entries)
+	if err != nil {
+		return nil, err
+	}
+	return []string{name}, nil
+}
+
+// pickerEntry is a tunnel in the picker list
+type pickerEntry struct {
+	name   string
+	status string
+}
+
+// pickerModel is a bubbletea list of tunnels to choose one from
+type pickerModel struct {
+	entries   []pickerEntry
+	cursor    int
+	chosen    string
+	cancelled bool
+}
+
+func (m pickerModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m pickerModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	key, ok := msg.(tea.KeyMsg)
+	if !ok {
+		return m, nil
+	}
+
+	// Keys typed faster than they are read arrive together
+	if key.Type == tea.KeyRunes && len(key.Runes) > 1 {
+		var model tea.Model = m
+		var cmd tea.Cmd
+		for _, r := range key.Runes {
+			if model, cmd = model.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}}); cmd != nil {
+				return model, cmd
+			}
+		}
+		return model, nil
+	}
+
+	switch key.String() {
+	case "up", "k":
+		if m.cursor > 0 {
+			m.cursor--
+		}
+	case "down", "j":
+		if m.cursor < len(m.entries)-1 {
+			m.cursor++
+		}
+	case "enter":
+		m.chosen = m.entries[m.cursor].name
+		return m, tea.Quit
+	case "q", "esc", "ctrl+c":
+		m.cancelled = true
+		return m, tea.Quit
+	}
+	return m, nil
+}
+
+func (m pickerModel) View() string {
+	if m.chosen != "" || m.cancelled {
+		return ""
+	}
+
+	width := 0
+	for _, entry := range m.entries {
+		width = max(width, len(entry.name))
+	}
+
+	var b strings.Builder
+	b.WriteString("Select a tunnel (↑/↓ to move, enter to choose, q to cancel):\n\n")
+	for i, entry := range m.entries {
+		cursor := "  "
+		if i == m.cursor {
+			cursor = "> "
+		}
+		fmt.Fprintf(&b, "%s%-*s  %s\n", cursor, width, entry.name, entry.status)
+	}
+	return b.String()
+}
+
+// pickTunnel shows the picker, reading keys from in and drawing on out, and
+// returns the chosen tunnel's name
+func pickTunnel(in io.Reader, out io.Writer, entries []pickerEntry) (string, error) {
+	result, err := tea.NewProgram(pickerModel{entries: entries}, tea.WithInput(in), tea.WithOutput(out)).Run()
+	if err != nil {
+		return "", fmt.Errorf("tunnel picker failed: %w", err)
+	}
+
+	picked := result.(pickerModel)
+	if picked.chosen == "" {
+		return "", fmt.Errorf("no tunnel selected")
+	}
+	return picked.chosen, nil
+}
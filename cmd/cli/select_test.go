@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/lerndmina/SSH-Tunnel/internal/config"
+	"github.com/lerndmina/SSH-Tunnel/internal/tunnel"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// runWithSelect runs a command with --select, answering the picker with
+// input, and returns the tunnels the command acted on
+func runWithSelect(t *testing.T, input string, cmdArgs ...string) ([]string, error) {
+	t.Helper()
+
+	configManager, err := config.NewManager(t.TempDir())
+	require.NoError(t, err)
+	for _, name := range []string{"office", "home", "lab"} {
+		require.NoError(t, configManager.SaveConfig(&config.Config{TunnelName: name}))
+	}
+	tunnelManager := tunnel.NewManagerWithConfig(configManager)
+
+	var acted []string
+	cmd := &cobra.Command{
+		Use: "start",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			args, err := selectArgs(cmd, configManager, tunnelManager, args)
+			if err != nil {
+				return err
+			}
+			acted = append(acted, args...)
+			return nil
+		},
+	}
+	addSelectFlag(cmd)
+	cmd.SetIn(strings.NewReader(input))
+	cmd.SetErr(&bytes.Buffer{})
+	cmd.SetOut(&bytes.Buffer{})
+	cmd.SetArgs(cmdArgs)
+	return acted, cmd.Execute()
+}
+
+func TestSelectRunsActionOnChosenTunnel(t *testing.T) {
+	// The list is sorted: home, lab, office
+	acted, err := runWithSelect(t, "jj\r", "--select")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"office"}, acted)
+
+	acted, err = runWithSelect(t, "\x1b[B\r", "--select")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"lab"}, acted)
+
+	// A named tunnel skips the picker
+	acted, err = runWithSelect(t, "", "--select", "home")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"home"}, acted)
+}
+
+func TestSelectCancelled(t *testing.T) {
+	acted, err := runWithSelect(t, "q", "--select")
+	assert.EqualError(t, err, "no tunnel selected")
+	assert.Empty(t, acted)
+}
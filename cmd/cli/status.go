@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/lerndmina/SSH-Tunnel/internal/config"
+	"github.com/lerndmina/SSH-Tunnel/internal/tunnel"
+)
+
+// clearScreen moves the cursor home and clears the terminal
+const clearScreen = "\033[H\033[2J"
+
+// watchStatus re-renders the status every interval until ctx is cancelled
+func watchStatus(ctx context.Context, interval time.Duration, render func() error) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if interval <= 0 {
+		interval = 2 * time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		fmt.Print(clearScreen)
+		fmt.Printf("Every %s: ssh-tunnel status    %s\n\n", interval, time.Now().Format("2006-01-02 15:04:05"))
+		if err := render(); err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// statusRow is one tunnel's line in the status table
+type statusRow struct {
+	name   string
+	status *tunnel.TunnelStatus
+	config *config.Config
+	err    error
+}
+
+// statusRows looks up the status and config of each named tunnel
+func statusRows(tunnelManager *tunnel.Manager, configManager *config.Manager, names []string) []statusRow {
+	rows := make([]statusRow, 0, len(names))
+	for _, name := range names {
+		row := statusRow{name: name}
+		row.status, row.err = tunnelManager.GetStatus(name)
+		if row.err == nil {
+			row.config, _ = configManager.GetConfig(name)
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// printStatusTable prints one status line per tunnel, with the wide table's
+// extra columns if wide is set
+func printStatusTable(w io.Writer, tunnelManager *tunnel.Manager, configManager *config.Manager, names []string, wide bool) {
+	rows := statusRows(tunnelManager, configManager, names)
+	if wide {
+		writeWideStatusTable(w, rows)
+		return
+	}
+	writeStatusTable(w, rows)
+}
+
+// statusHeader is the header of the default status table
+var statusHeader = []string{"NAME", "STATUS", "UPTIME", "DETAILS"}
+
+// wideStatusHeader is the header of the wide status table
+var wideStatusHeader = []string{"NAME", "STATUS", "UPTIME", "STARTED", "PID", "CLOUD", "REVERSE", "SOCKS", "RECONNECTS", "LAST ERROR"}
+
+// statusFields returns a row's values for the columns of statusHeader
+func statusFields(row statusRow) []string {
+	if row.err != nil {
+		return []string{row.name, "ERROR", "-", row.err.Error()}
+	}
+
+	status := row.status
+	details := "-"
+	if status != nil && status.Status == tunnel.StatusReconnecting {
+		details = fmt.Sprintf("attempt %d, retry in %s", status.ReconnectAttempt, retryIn(status.NextRetry))
+		if status.Error != nil {
+			details += ": " + status.Error.Error()
+		}
+	} else if status != nil && status.Error != nil {
+		details = status.Error.Error()
+	}
+
+	return []string{row.name, statusString(status), uptimeString(status), details}
+}
+
+// wideStatusFields returns a row's values for the columns of
+// wideStatusHeader
+func wideStatusFields(row statusRow) []string {
+	if row.err != nil {
+		return []string{row.name, "ERROR", "-", "-", "-", "-", "-", "-", "-", oneLine(row.err.Error())}
+	}
+
+	status := row.status
+	pid, reconnects, lastError := "-", "-", "-"
+	if status != nil {
+		if status.PID > 0 {
+			pid = strconv.Itoa(status.PID)
+		}
+		if status.ReconnectCount > 0 {
+			reconnects = strconv.Itoa(status.ReconnectCount)
+		}
+		if status.Error != nil {
+			lastError = oneLine(status.Error.Error())
+		} else if status.LastError != "" {
+			lastError = oneLine(status.LastError)
+		}
+	}
+
+	cloud, reverse, socks := "-", "-", "-"
+	if cfg := row.config; cfg != nil {
+		cloud = fmt.Sprintf("%s@%s", cfg.CloudServer.User, net.JoinHostPort(cfg.CloudServer.IP, strconv.Itoa(cfg.CloudServer.Port)))
+		if cfg.LocalServer.ReversePort > 0 {
+			reverse = strconv.Itoa(cfg.LocalServer.ReversePort)
+		}
+		if cfg.LocalServer.SOCKSPort > 0 {
+			socks = tunnel.SOCKSAddress(cfg.LocalServer.SOCKSBindAddr, cfg.LocalServer.SOCKSPort)
+		}
+	}
+
+	return []string{row.name, statusString(status), uptimeString(status), startedString(status), pid, cloud, reverse, socks, reconnects, lastError}
+}
+
+// writeStatusTable writes the default status table
+func writeStatusTable(w io.Writer, rows []statusRow) {
+	fmt.Fprintf(w, "%-20s %-15s %-15s %-20s\n", statusHeader[0], statusHeader[1], statusHeader[2], statusHeader[3])
+	fmt.Fprintln(w, strings.Repeat("-", 75))
+
+	for _, row := range rows {
+		fields := statusFields(row)
+		fmt.Fprintf(w, "%-20s %-15s %-15s %-20s\n", fields[0], fields[1], fields[2], fields[3])
+	}
+}
+
+// writeWideStatusTable writes the status table with the process, endpoints
+// and reconnect history of each tunnel. Columns are sized to their widest
+// value so long endpoints and errors do not shift the columns after them.
+func writeWideStatusTable(w io.Writer, rows []statusRow) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(wideStatusHeader, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(wideStatusFields(row), "\t"))
+	}
+	tw.Flush()
+}
+
+// writeStatusCSV writes the status table as CSV, with the wide table's
+// columns if wide is set
+func writeStatusCSV(w io.Writer, rows []statusRow, wide bool) error {
+	header, fields := statusHeader, statusFields
+	if wide {
+		header, fields = wideStatusHeader, wideStatusFields
+	}
+
+	records := [][]string{header}
+	for _, row := range rows {
+		records = append(records, fields(row))
+	}
+	return writeCSV(w, records)
+}
+
+// statusString returns a tunnel's state for the status table
+func statusString(status *tunnel.TunnelStatus) string {
+	if status == nil {
+		return "stopped"
+	}
+	return status.Status.String()
+}
+
+// uptimeString returns how long a running tunnel has been up, for the
+// status table
+func uptimeString(status *tunnel.TunnelStatus) string {
+	return status.UptimeHuman()
+}
+
+// startedString returns when a running tunnel started, with the date, for
+// the wide status table
+func startedString(status *tunnel.TunnelStatus) string {
+	if status != nil && !status.StartTime.IsZero() && status.Status == tunnel.StatusRunning {
+		return status.StartTime.Format("2006-01-02 15:04:05")
+	}
+	return "-"
+}
+
+// oneLine collapses a multi-line message onto one table line
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// printStatusDetail prints the full status of a single tunnel
+func printStatusDetail(w io.Writer, tunnelManager *tunnel.Manager, tunnelName string) error {
+	status, err := tunnelManager.GetStatus(tunnelName)
+	if err != nil {
+		return fmt.Errorf("failed to get status for tunnel '%s': %w", tunnelName, err)
+	}
+
+	fmt.Fprintf(w, "Tunnel: %s\n", tunnelName)
+	if status == nil {
+		fmt.Fprintln(w, "Status: stopped")
+		return nil
+	}
+
+	fmt.Fprintf(w, "Status: %s\n", status.Status.String())
+	if !status.StartTime.IsZero() {
+		fmt.Fprintf(w, "Started: %s\n", status.StartTime.Format("2006-01-02 15:04:05"))
+	}
+	if uptime := status.UptimeHuman(); uptime != "-" {
+		fmt.Fprintf(w, "Uptime: %s\n", uptime)
+	}
+	if !status.LastHealthCheck.IsZero() {
+		fmt.Fprintf(w, "Last Health Check: %s\n", status.LastHealthCheck.Format("2006-01-02 15:04:05"))
+	}
+	if status.ReconnectAttempt > 0 {
+		fmt.Fprintf(w, "Reconnect Attempt: %d\n", status.ReconnectAttempt)
+	}
+	if !status.NextRetry.IsZero() {
+		fmt.Fprintf(w, "Next Retry: %s (in %s)\n", status.NextRetry.Format("2006-01-02 15:04:05"), retryIn(status.NextRetry))
+	}
+	if status.ReconnectCount > 0 {
+		fmt.Fprintf(w, "Reconnects: %d\n", status.ReconnectCount)
+	}
+	if status.Error != nil {
+		fmt.Fprintf(w, "Error: %s\n", status.Error.Error())
+	} else if status.LastError != "" {
+		fmt.Fprintf(w, "Last Error: %s\n", status.LastError)
+	}
+	if status.SOCKSError != nil {
+		fmt.Fprintf(w, "SOCKS Proxy: %s\n", status.SOCKSError.Error())
+	}
+
+	return nil
+}
+
+// retryIn formats the time remaining until a retry
+func retryIn(next time.Time) string {
+	remaining := time.Until(next).Round(time.Second)
+	if remaining < 0 {
+		remaining = 0
+	}
+	return remaining.String()
+}
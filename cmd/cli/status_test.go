@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lerndmina/SSH-Tunnel/internal/config"
+	"github.com/lerndmina/SSH-Tunnel/internal/tunnel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWideStatusTable(t *testing.T) {
+	started := time.Now().Add(-(2*24*time.Hour + 3*time.Hour + 14*time.Minute + 30*time.Second))
+	rows := []statusRow{
+		{
+			name: "home",
+			status: &tunnel.TunnelStatus{
+				Status:         tunnel.StatusRunning,
+				StartTime:      started,
+				PID:            4242,
+				ReconnectCount: 3,
+				LastError:      "Connection reset by peer",
+			},
+			config: &config.Config{
+				CloudServer: config.CloudServerConfig{IP: "203.0.113.1", Port: 22, User: "tunnel"},
+				LocalServer: config.LocalServerConfig{ReversePort: 2222, SOCKSPort: 1080},
+			},
+		},
+		{
+			name:   "a-much-longer-tunnel-name",
+			status: &tunnel.TunnelStatus{Status: tunnel.StatusStopped},
+			config: &config.Config{
+				CloudServer: config.CloudServerConfig{IP: "2001:db8::1", Port: 2200, User: "ops"},
+				LocalServer: config.LocalServerConfig{ReversePort: 2223},
+			},
+		},
+		{name: "broken", err: errors.New("config not found")},
+	}
+
+	var out bytes.Buffer
+	writeWideStatusTable(&out, rows)
+	lines := strings.Split(strings.TrimRight(out.String(), "\n"), "\n")
+	require.Len(t, lines, 4)
+
+	assert.Equal(t, []string{"NAME", "STATUS", "UPTIME", "STARTED", "PID", "CLOUD", "REVERSE", "SOCKS", "RECONNECTS", "LAST", "ERROR"}, strings.Fields(lines[0]))
+	date, clock, _ := strings.Cut(started.Format("2006-01-02 15:04:05"), " ")
+	assert.Equal(t, []string{"home", "running", "2d", "3h", "14m", date, clock, "4242", "tunnel@203.0.113.1:22", "2222", "127.0.0.1:1080", "3", "Connection", "reset", "by", "peer"}, strings.Fields(lines[1]))
+	assert.Equal(t, []string{"a-much-longer-tunnel-name", "stopped", "-", "-", "-", "ops@[2001:db8::1]:2200", "2223", "-", "-", "-"}, strings.Fields(lines[2]))
+	assert.Equal(t, []string{"broken", "ERROR", "-", "-", "-", "-", "-", "-", "-", "config", "not", "found"}, strings.Fields(lines[3]))
+
+	// Every column starts at the same offset on every line
+	for _, column := range []string{"STARTED", "PID", "CLOUD", "REVERSE", "SOCKS", "RECONNECTS", "LAST ERROR"} {
+		offset := strings.Index(lines[0], column)
+		for _, line := range lines[1:] {
+			assert.NotEqual(t, byte(' '), line[offset], "column %s in %q", column, line)
+			assert.Equal(t, byte(' '), line[offset-1], "column %s in %q", column, line)
+		}
+	}
+}
+
+func TestStatusCSV(t *testing.T) {
+	rows := []statusRow{
+		{
+			name:   "home",
+			status: &tunnel.TunnelStatus{Status: tunnel.StatusRunning, PID: 4242, LastError: "dial tcp: refused, retrying\nagain"},
+			config: &config.Config{
+				CloudServer: config.CloudServerConfig{IP: "203.0.113.1", Port: 22, User: "tunnel"},
+				LocalServer: config.LocalServerConfig{ReversePort: 2222},
+			},
+		},
+		{name: "broken", err: errors.New("config not found")},
+	}
+
+	var out bytes.Buffer
+	require.NoError(t, writeStatusCSV(&out, rows, false))
+	records, err := csv.NewReader(&out).ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{
+		{"NAME", "STATUS", "UPTIME", "DETAILS"},
+		{"home", "running", "-", "-"},
+		{"broken", "ERROR", "-", "config not found"},
+	}, records)
+
+	out.Reset()
+	require.NoError(t, writeStatusCSV(&out, rows, true))
+	records, err = csv.NewReader(&out).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	assert.Equal(t, wideStatusHeader, records[0])
+	assert.Equal(t, []string{"home", "running", "-", "-", "4242", "tunnel@203.0.113.1:22", "2222", "-", "-", "dial tcp: refused, retrying again"}, records[1])
+}
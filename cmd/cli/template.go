@@ -0,0 +1,237 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/lerndmina/SSH-Tunnel/internal/config"
+	"github.com/lerndmina/SSH-Tunnel/internal/ssh"
+	"github.com/lerndmina/SSH-Tunnel/internal/templates"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// newTemplateApplyCommand creates the template apply command
+func newTemplateApplyCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "apply <template-name> <tunnel-name>",
+		Short: "Apply template to create new tunnel",
+		Long: `Render a template into a new tunnel configuration and save it.
+
+Template variables are set with --set name=value; tunnel_name is taken from
+the tunnel name argument. Variables that are not set use the template's
+defaults. Use --dry-run to print the rendered configuration without saving.
+
+With --port-range, or templates.port_range in settings.yaml, the tunnel gets
+the lowest reverse port in the range that no existing tunnel uses, so a
+template can be applied again and again across a fleet. Templates can take
+further ports from the range with {{ nextPort }}.
+
+With --generate-key, key files the new tunnel references that do not exist
+yet are generated, and their public keys printed for deployment. They are of
+the type the template's key_type variable names (set it with
+--set key_type=rsa for older servers), unless --key-type is given.
+
+Examples:
+  ssh-tunnel template apply home-server my-home --set cloud_ip=203.0.113.1 --set local_user=pi
+  ssh-tunnel template apply home-server my-home --set cloud_ip=203.0.113.1 --set local_user=pi --dry-run
+  ssh-tunnel template apply home-server pi-07 --set cloud_ip=203.0.113.1 --set local_user=pi --port-range 2200-2299`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			sets, _ := cmd.Flags().GetStringArray("set")
+			dryRun, _ := cmd.Flags().GetBool("dry-run")
+			portRange, _ := cmd.Flags().GetString("port-range")
+			keyType, err := generateKeyType(cmd)
+			if err != nil {
+				return err
+			}
+			if keyType != "" && !cmd.Flags().Changed("key-type") {
+				fromTemplate, err := templateKeyType(args[0], sets)
+				if err != nil {
+					return err
+				}
+				if fromTemplate != "" {
+					keyType = fromTemplate
+				}
+			}
+
+			configManager := config.GetManager()
+			if portRange == "" {
+				settings, err := config.LoadSettings(configManager.GetConfigPath())
+				if err != nil {
+					return err
+				}
+				portRange = settings.Templates.PortRange
+			}
+			return applyTemplate(cmd.OutOrStdout(), configManager, args[0], args[1], sets, portRange, dryRun, keyType)
+		},
+	}
+
+	cmd.Flags().StringArray("set", nil, "Set a template variable (name=value, repeatable)")
+	cmd.Flags().Bool("dry-run", false, "Print the rendered configuration without saving it")
+	cmd.Flags().String("port-range", "", "Assign the lowest free reverse port in this range, e.g. 2200-2299 (default templates.port_range)")
+	addGenerateKeyFlags(cmd)
+	return cmd
+}
+
+// applyTemplate renders a template into the configuration of a new tunnel,
+// printing it instead of saving it if dryRun is set. With a port range, the
+// reverse port is the lowest one in it that no existing tunnel uses, for its
+// reverse port or a local forward. If
+// keyType is set, missing key files of the saved tunnel are generated with
+// that type.
+func applyTemplate(out io.Writer, configManager *config.Manager, templateName, tunnelName string, sets []string, portRange string, dryRun bool, keyType string) error {
+	variables, err := parseTemplateVariables(sets)
+	if err != nil {
+		return err
+	}
+	variables["tunnel_name"] = tunnelName
+
+	var opts templates.ApplyOptions
+	if portRange != "" {
+		rng, err := templates.ParsePortRange(portRange)
+		if err != nil {
+			return err
+		}
+		opts.PortRange = &rng
+		opts.UsedPorts = portsInUse(configManager)
+	}
+
+	if !dryRun {
+		if _, err := configManager.GetConfig(tunnelName); err == nil {
+			return fmt.Errorf("tunnel '%s' already exists", tunnelName)
+		}
+	}
+
+	cfg, err := renderTemplateConfig(templateName, variables, opts)
+	if err != nil {
+		return err
+	}
+
+	if dryRun {
+		return writeConfigYAML(out, cfg)
+	}
+
+	if err := configManager.SaveConfig(cfg); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "✓ Created tunnel '%s' from template '%s'\n", tunnelName, templateName)
+	if keyType != "" {
+		_, err := generateMissingKeys(out, ssh.NewKeyManager(), cfg, keyType)
+		return err
+	}
+	return nil
+}
+
+// newTemplateRenderCommand creates the template render command
+func newTemplateRenderCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "render <template-name>",
+		Short: "Print a rendered template as tunnel configuration YAML",
+		Long: `Render a template and print the resulting tunnel configuration as YAML,
+without touching the config store. Set variables, including tunnel_name,
+with --set name=value.
+
+Examples:
+  ssh-tunnel template render home-server --set tunnel_name=my-home --set cloud_ip=203.0.113.1 --set local_user=pi > my-home.yaml`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			sets, _ := cmd.Flags().GetStringArray("set")
+			variables, err := parseTemplateVariables(sets)
+			if err != nil {
+				return err
+			}
+
+			cfg, err := renderTemplateConfig(args[0], variables, templates.ApplyOptions{})
+			if err != nil {
+				return err
+			}
+			return writeConfigYAML(cmd.OutOrStdout(), cfg)
+		},
+	}
+
+	cmd.Flags().StringArray("set", nil, "Set a template variable (name=value, repeatable)")
+	return cmd
+}
+
+// renderTemplateConfig renders a template into a validated configuration
+func renderTemplateConfig(templateName string, variables map[string]interface{}, opts templates.ApplyOptions) (*config.Config, error) {
+	cfg, err := templates.NewManager().ApplyWithOptions(templateName, variables, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration '%s': %w", cfg.TunnelName, err)
+	}
+	return cfg, nil
+}
+
+// portsInUse returns the reverse and local forward ports of the configured
+// tunnels
+func portsInUse(configManager *config.Manager) []int {
+	var ports []int
+	for _, name := range configManager.ListConfigs() {
+		cfg, err := configManager.GetConfig(name)
+		if err != nil {
+			continue
+		}
+		ports = append(ports, cfg.LocalServer.ReversePort)
+		for _, forward := range cfg.LocalServer.LocalForwards {
+			ports = append(ports, forward.LocalPort)
+		}
+	}
+	return ports
+}
+
+// writeConfigYAML writes a configuration as YAML
+func writeConfigYAML(out io.Writer, cfg *config.Config) error {
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal config: %w", err)
+	}
+	_, err = out.Write(data)
+	return err
+}
+
+// templateKeyType returns the key type named by the key_type variable of a
+// template applied with sets, or "" if the variable is neither set nor has
+// a default
+func templateKeyType(templateName string, sets []string) (string, error) {
+	variables, err := parseTemplateVariables(sets)
+	if err != nil {
+		return "", err
+	}
+	keyType, isSet := variables["key_type"]
+	if !isSet {
+		tmpl, err := templates.NewManager().Get(templateName)
+		if err != nil {
+			return "", err
+		}
+		keyType = tmpl.Variables["key_type"].Default
+	}
+
+	name, _ := keyType.(string)
+	if name == "" {
+		return "", nil
+	}
+	if err := ssh.CheckKeyType(name); err != nil {
+		return "", fmt.Errorf("template variable key_type: %w", err)
+	}
+	return name, nil
+}
+
+// parseTemplateVariables parses name=value assignments of template variables
+func parseTemplateVariables(sets []string) (map[string]interface{}, error) {
+	variables := make(map[string]interface{}, len(sets)+1)
+	for _, set := range sets {
+		name, value, ok := strings.Cut(set, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid variable %q: expected name=value", set)
+		}
+		variables[name] = value
+	}
+	return variables, nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lerndmina/SSH-Tunnel/internal/config"
+	"github.com/lerndmina/SSH-Tunnel/internal/templates"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+// homeServerVariables are the variables home-server needs without defaults
+var homeServerVariables = []string{"cloud_ip=203.0.113.1", "local_user=pi"}
+
+func TestTemplateApplyDryRunDoesNotSave(t *testing.T) {
+	configManager, err := config.NewManager(t.TempDir())
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	require.NoError(t, applyTemplate(&out, configManager, "home-server", "my-home", homeServerVariables, "", true, ""))
+
+	var cfg config.Config
+	require.NoError(t, yaml.Unmarshal(out.Bytes(), &cfg))
+	assert.Equal(t, "my-home", cfg.TunnelName)
+	assert.Equal(t, "203.0.113.1", cfg.CloudServer.IP)
+	assert.Equal(t, "ubuntu", cfg.CloudServer.User)
+	assert.Equal(t, "pi", cfg.LocalServer.User)
+	assert.Equal(t, "ssh-tunnel-my-home", cfg.Service.Name)
+
+	assert.Empty(t, configManager.ListConfigs())
+	assert.NoFileExists(t, filepath.Join(configManager.GetConfigPath(), "tunnels", "my-home.yaml"))
+}
+
+func TestTemplateApplySavesConfig(t *testing.T) {
+	configManager, err := config.NewManager(t.TempDir())
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	require.NoError(t, applyTemplate(&out, configManager, "home-server", "my-home", homeServerVariables, "", false, ""))
+	assert.Contains(t, out.String(), "Created tunnel 'my-home'")
+
+	cfg, err := configManager.GetConfig("my-home")
+	require.NoError(t, err)
+	assert.Equal(t, "203.0.113.1", cfg.CloudServer.IP)
+	_, err = os.Stat(filepath.Join(configManager.GetConfigPath(), "tunnels", "my-home.yaml"))
+	require.NoError(t, err)
+
+	err = applyTemplate(&out, configManager, "home-server", "my-home", homeServerVariables, "", false, "")
+	assert.ErrorContains(t, err, "already exists")
+}
+
+func TestParseTemplateVariables(t *testing.T) {
+	variables, err := parseTemplateVariables([]string{"cloud_ip=203.0.113.1", "empty="})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"cloud_ip": "203.0.113.1", "empty": ""}, variables)
+
+	_, err = parseTemplateVariables([]string{"cloud_ip"})
+	assert.ErrorContains(t, err, "expected name=value")
+}
+
+func TestTemplateRenderPrintsLoadableYAML(t *testing.T) {
+	cmd := newTemplateRenderCommand()
+	var out bytes.Buffer
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"home-server", "--set", "tunnel_name=my-home", "--set", "cloud_ip=203.0.113.1", "--set", "local_user=pi"})
+	require.NoError(t, cmd.Execute())
+
+	// The output can be dropped into a config directory as is
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "tunnels"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "tunnels", "my-home.yaml"), out.Bytes(), 0600))
+
+	configManager, err := config.NewManager(dir)
+	require.NoError(t, err)
+	cfg, err := configManager.GetConfig("my-home")
+	require.NoError(t, err)
+	assert.Equal(t, "203.0.113.1", cfg.CloudServer.IP)
+	assert.Equal(t, "pi", cfg.LocalServer.User)
+	assert.Equal(t, 2222, cfg.LocalServer.ReversePort)
+}
+
+func TestTemplateApplyAssignsDistinctReversePorts(t *testing.T) {
+	configManager, err := config.NewManager(t.TempDir())
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	require.NoError(t, applyTemplate(&out, configManager, "home-server", "pi-01", homeServerVariables, "2200-2202", false, ""))
+	require.NoError(t, applyTemplate(&out, configManager, "home-server", "pi-02", homeServerVariables, "2200-2202", false, ""))
+
+	first, err := configManager.GetConfig("pi-01")
+	require.NoError(t, err)
+	second, err := configManager.GetConfig("pi-02")
+	require.NoError(t, err)
+	assert.Equal(t, 2200, first.LocalServer.ReversePort)
+	assert.Equal(t, 2201, second.LocalServer.ReversePort)
+
+	require.NoError(t, applyTemplate(&out, configManager, "home-server", "pi-03", homeServerVariables, "2200-2202", false, ""))
+	err = applyTemplate(&out, configManager, "home-server", "pi-04", homeServerVariables, "2200-2202", false, "")
+	assert.ErrorContains(t, err, "no free port left in range 2200-2202")
+}
+
+func TestTemplateApplySkipsLocalForwardPorts(t *testing.T) {
+	configManager, err := config.NewManager(t.TempDir())
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	require.NoError(t, applyTemplate(&out, configManager, "home-server", "pi-01", homeServerVariables, "2200-2202", false, ""))
+	first, err := configManager.GetConfig("pi-01")
+	require.NoError(t, err)
+	first.LocalServer.LocalForwards = []config.ForwardConfig{{LocalPort: 2201, RemoteHost: "localhost", RemotePort: 80}}
+	require.NoError(t, configManager.SaveConfig(first))
+
+	require.NoError(t, applyTemplate(&out, configManager, "home-server", "pi-02", homeServerVariables, "2200-2202", false, ""))
+	second, err := configManager.GetConfig("pi-02")
+	require.NoError(t, err)
+	assert.Equal(t, 2202, second.LocalServer.ReversePort)
+}
+
+func TestTemplateKeyType(t *testing.T) {
+	keyType, err := templateKeyType("home-server", homeServerVariables)
+	require.NoError(t, err)
+	assert.Equal(t, "ed25519", keyType)
+
+	keyType, err = templateKeyType("home-server", append([]string{"key_type=rsa"}, homeServerVariables...))
+	require.NoError(t, err)
+	assert.Equal(t, "rsa", keyType)
+
+	_, err = templateKeyType("home-server", []string{"key_type=dsa"})
+	assert.ErrorContains(t, err, "unsupported key type 'dsa'")
+
+	// A rendered template rejects the unsupported type too
+	_, err = renderTemplateConfig("home-server", map[string]interface{}{"tunnel_name": "home", "cloud_ip": "203.0.113.1", "local_user": "pi", "key_type": "dsa"}, templates.ApplyOptions{})
+	assert.ErrorContains(t, err, "key_type")
+}
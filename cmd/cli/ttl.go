@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/lerndmina/SSH-Tunnel/internal/tunnel"
+)
+
+// waitForExpiry keeps the command running while any of the named tunnels
+// has a lifetime, since the timer that stops it lives in this process. It
+// returns once they have all stopped; an interrupt stops them early.
+func waitForExpiry(ctx context.Context, tunnelManager *tunnel.Manager, events <-chan tunnel.TunnelEvent, names []string) error {
+	waiting := make(map[string]bool)
+	for _, name := range names {
+		status, err := tunnelManager.GetStatus(name)
+		if err != nil || status.ExpiresAt.IsZero() {
+			continue
+		}
+		waiting[name] = true
+		fmt.Printf("Tunnel %s stops at %s (in %s); press Ctrl-C to stop it now\n",
+			name, status.ExpiresAt.Format("15:04:05"), time.Until(status.ExpiresAt).Round(time.Second))
+	}
+	if len(waiting) == 0 {
+		return nil
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	for len(waiting) > 0 {
+		select {
+		case event := <-events:
+			if event.Type == tunnel.EventStopped && waiting[event.Tunnel] {
+				delete(waiting, event.Tunnel)
+				fmt.Printf("✓ Tunnel %s stopped\n", event.Tunnel)
+			}
+		case <-ctx.Done():
+			for name := range waiting {
+				if err := stopTunnel(tunnelManager, name, false); err != nil {
+					fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+				}
+			}
+			return nil
+		}
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/lerndmina/SSH-Tunnel/internal/config"
+	"github.com/spf13/cobra"
+)
+
+// newUseCommand creates the use command
+func newUseCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "use [tunnel-name]",
+		Short: "Set or show the active tunnel",
+		Long: `Make a tunnel the active one, so that start and stop act on it when no
+tunnel is named. Without a name, print the active tunnel.
+
+Use --all with start or stop to act on every tunnel regardless.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			configManager := config.GetManager()
+
+			if len(args) == 0 {
+				active, err := configManager.GetActiveConfig()
+				if errors.Is(err, config.ErrNoActiveConfig) {
+					fmt.Println("No active tunnel. Set one with 'ssh-tunnel use <tunnel-name>'.")
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+				fmt.Println(active.TunnelName)
+				return nil
+			}
+
+			if err := configManager.SetActiveConfig(args[0]); err != nil {
+				return err
+			}
+			fmt.Printf("✓ Active tunnel: %s\n", args[0])
+			return nil
+		},
+	}
+}
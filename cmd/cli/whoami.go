@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/lerndmina/SSH-Tunnel/internal/config"
+	"github.com/lerndmina/SSH-Tunnel/internal/tunnel"
+	"github.com/spf13/cobra"
+)
+
+// newWhoamiCommand creates the whoami command
+func newWhoamiCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "whoami",
+		Aliases: []string{"context"},
+		Short:   "Show the active profile, tunnel and config directory",
+		Long: `Summarize the environment other commands work in: the active config
+profile, the active tunnel, the config directory, and how many tunnels are
+configured and running.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			basePath, err := configBasePath(cmd)
+			if err != nil {
+				return err
+			}
+			configManager := config.GetManager()
+			summary, err := summarizeContext(basePath, configManager, tunnel.NewManagerWithConfig(configManager))
+			if err != nil {
+				return err
+			}
+
+			if asJSON, _ := cmd.Flags().GetBool("json"); asJSON {
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.SetIndent("", "  ")
+				return enc.Encode(summary)
+			}
+			printContext(cmd.OutOrStdout(), summary)
+			return nil
+		},
+	}
+
+	cmd.Flags().Bool("json", false, "Print the summary as JSON")
+	return cmd
+}
+
+// contextSummary describes the environment commands work in
+type contextSummary struct {
+	Profile string `json:"profile"`
+	// ActiveTunnel is empty when no tunnel is active
+	ActiveTunnel string `json:"active_tunnel"`
+	ConfigDir    string `json:"config_dir"`
+	Tunnels      int    `json:"tunnels"`
+	Running      int    `json:"running"`
+}
+
+// summarizeContext gathers the active profile under basePath and the state
+// of the tunnels in configManager
+func summarizeContext(basePath string, configManager *config.Manager, tunnels tunnelStatuses) (contextSummary, error) {
+	profile, err := config.CurrentProfile(basePath)
+	if err != nil {
+		return contextSummary{}, err
+	}
+
+	summary := contextSummary{Profile: profile, ConfigDir: configManager.GetConfigPath()}
+
+	active, err := configManager.GetActiveConfig()
+	switch {
+	case err == nil:
+		summary.ActiveTunnel = active.TunnelName
+	case !errors.Is(err, config.ErrNoActiveConfig):
+		return contextSummary{}, err
+	}
+
+	names := configManager.ListConfigs()
+	summary.Tunnels = len(names)
+	for _, name := range names {
+		status, err := tunnels.GetStatus(name)
+		if err == nil && status.Status == tunnel.StatusRunning {
+			summary.Running++
+		}
+	}
+	return summary, nil
+}
+
+// printContext prints the summary, one field per line
+func printContext(w io.Writer, summary contextSummary) {
+	active := summary.ActiveTunnel
+	if active == "" {
+		active = "(none)"
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Profile:\t%s\n", summary.Profile)
+	fmt.Fprintf(tw, "Active tunnel:\t%s\n", active)
+	fmt.Fprintf(tw, "Config dir:\t%s\n", summary.ConfigDir)
+	fmt.Fprintf(tw, "Tunnels:\t%d configured, %d running\n", summary.Tunnels, summary.Running)
+	tw.Flush()
+}
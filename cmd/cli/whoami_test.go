@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/lerndmina/SSH-Tunnel/internal/config"
+	"github.com/lerndmina/SSH-Tunnel/internal/tunnel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSummarizeContext(t *testing.T) {
+	base := t.TempDir()
+	require.NoError(t, config.CreateProfile(base, "acme"))
+	require.NoError(t, config.UseProfile(base, "acme"))
+	cm, err := config.NewManager(config.ProfilePath(base, "acme"))
+	require.NoError(t, err)
+	for _, name := range []string{"home", "lab", "office"} {
+		require.NoError(t, cm.SaveConfig(&config.Config{TunnelName: name}))
+	}
+	require.NoError(t, cm.SetActiveConfig("office"))
+	tunnels := &fakeTunnels{statuses: map[string]tunnel.Status{
+		"home": tunnel.StatusRunning,
+		"lab":  tunnel.StatusReconnecting,
+	}}
+
+	summary, err := summarizeContext(base, cm, tunnels)
+	require.NoError(t, err)
+	assert.Equal(t, contextSummary{
+		Profile:      "acme",
+		ActiveTunnel: "office",
+		ConfigDir:    config.ProfilePath(base, "acme"),
+		Tunnels:      3,
+		Running:      1,
+	}, summary)
+
+	var out bytes.Buffer
+	printContext(&out, summary)
+	assert.Contains(t, out.String(), "Profile:        acme\n")
+	assert.Contains(t, out.String(), "Active tunnel:  office\n")
+	assert.Contains(t, out.String(), "Tunnels:        3 configured, 1 running\n")
+}
+
+func TestSummarizeContextWithoutActiveTunnel(t *testing.T) {
+	base := t.TempDir()
+	cm, err := config.NewManager(base)
+	require.NoError(t, err)
+
+	summary, err := summarizeContext(base, cm, &fakeTunnels{})
+	require.NoError(t, err)
+	assert.Equal(t, config.DefaultProfile, summary.Profile)
+	assert.Empty(t, summary.ActiveTunnel)
+	assert.Zero(t, summary.Tunnels)
+
+	var out bytes.Buffer
+	printContext(&out, summary)
+	assert.Contains(t, out.String(), "Active tunnel:  (none)\n")
+}
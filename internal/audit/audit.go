@@ -0,0 +1,142 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/lerndmina/SSH-Tunnel/pkg/logger"
+)
+
+// FileName is the audit log's file name within the config directory
+const FileName = "audit.log"
+
+// Actions recorded in the audit log
+const (
+	ActionConfigSave    = "config.save"
+	ActionConfigSet     = "config.set"
+	ActionConfigDelete  = "config.delete"
+	ActionConfigRestore = "config.restore"
+	ActionTunnelStart   = "tunnel.start"
+	ActionTunnelStop    = "tunnel.stop"
+	ActionKeyDeploy     = "key.deploy"
+	ActionKeyRevoke     = "key.revoke"
+)
+
+// Record is one line of the audit log
+type Record struct {
+	Time    time.Time         `json:"time"`
+	User    string            `json:"user"`
+	Action  string            `json:"action"`
+	Tunnel  string            `json:"tunnel,omitempty"`
+	Details map[string]string `json:"details,omitempty"`
+	// Error is set when the action failed
+	Error string `json:"error,omitempty"`
+}
+
+// Logger appends records to an audit log. The log is kept apart from the
+// operational logs and is never rotated or truncated by this program.
+type Logger struct {
+	path string
+	mu   sync.Mutex
+}
+
+// New creates a logger writing to the audit log in configPath
+func New(configPath string) *Logger {
+	return &Logger{path: filepath.Join(configPath, FileName)}
+}
+
+// Path returns the audit log's path
+func (l *Logger) Path() string {
+	return l.path
+}
+
+// Log records an action on a tunnel, with err set if it failed. Failing to
+// write the record is logged as a warning rather than failing the action.
+// A nil Logger records nothing.
+func (l *Logger) Log(action, tunnel string, details map[string]string, err error) {
+	if l == nil {
+		return
+	}
+
+	record := Record{
+		Time:    time.Now(),
+		User:    currentUser(),
+		Action:  action,
+		Tunnel:  tunnel,
+		Details: details,
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+
+	if err := l.write(record); err != nil {
+		logger.Warnf("Failed to write audit record: %v", err)
+	}
+}
+
+// write appends a record as a single JSON line
+func (l *Logger) write(record Record) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	file, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(append(data, '\n'))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Read returns the records in the audit log at path, oldest first. A
+// missing log has no records.
+func Read(path string) ([]Record, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var records []Record
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return records, fmt.Errorf("%s line %d: %w", path, line, err)
+		}
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
+
+// currentUser returns the name of the user running the program
+func currentUser() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	if name := os.Getenv("USER"); name != "" {
+		return name
+	}
+	return os.Getenv("USERNAME")
+}
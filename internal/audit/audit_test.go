@@ -0,0 +1,47 @@
+package audit
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogAppendsJSONLines(t *testing.T) {
+	dir := t.TempDir()
+	l := New(dir)
+
+	l.Log(ActionConfigSave, "home", nil, nil)
+	l.Log(ActionKeyDeploy, "home", map[string]string{"host": "tunnel@203.0.113.1:22"}, errors.New("connection refused"))
+
+	// A second logger appends rather than truncating
+	New(dir).Log(ActionTunnelStop, "office", nil, nil)
+
+	records, err := Read(filepath.Join(dir, FileName))
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+
+	assert.Equal(t, ActionConfigSave, records[0].Action)
+	assert.Empty(t, records[0].Error)
+	assert.Equal(t, "tunnel@203.0.113.1:22", records[1].Details["host"])
+	assert.Equal(t, "connection refused", records[1].Error)
+	assert.Equal(t, "office", records[2].Tunnel)
+
+	info, err := os.Stat(filepath.Join(dir, FileName))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+}
+
+func TestReadMissingLog(t *testing.T) {
+	records, err := Read(filepath.Join(t.TempDir(), FileName))
+	require.NoError(t, err)
+	assert.Empty(t, records)
+}
+
+func TestNilLoggerRecordsNothing(t *testing.T) {
+	var l *Logger
+	assert.NotPanics(t, func() { l.Log(ActionTunnelStart, "home", nil, nil) })
+}
@@ -0,0 +1,643 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lerndmina/SSH-Tunnel/internal/config"
+	"github.com/lerndmina/SSH-Tunnel/pkg/logger"
+	"github.com/mitchellh/go-homedir"
+)
+
+// Archive name prefixes. Automatic backups are pruned; manual ones are kept
+// until the user deletes them.
+const (
+	ManualPrefix = "backup-"
+	AutoPrefix   = "auto-"
+)
+
+// archiveExt is the extension of backup archives
+const archiveExt = ".tar.gz"
+
+// timeFormat sorts archives chronologically by name
+const timeFormat = "20060102-150405"
+
+// manifestName is the archive entry listing the backed up files
+const manifestName = "manifest.json"
+
+// checksumExt is appended to an archive's path to name the file holding
+// its SHA-256, in sha256sum format
+const checksumExt = ".sha256"
+
+// ErrChecksumMismatch is wrapped by errors for archives or files whose
+// contents do not match their recorded SHA-256
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// Manifest lists the tunnels and files in a backup archive
+type Manifest struct {
+	Created time.Time      `json:"created"`
+	Tunnels []string       `json:"tunnels"`
+	Files   []ManifestFile `json:"files"`
+}
+
+// ManifestFile records a backed up file by its name in the archive. Config
+// files are named by their path relative to the config directory; key files
+// are kept under keys/ with the Path they are restored to, relative to the
+// home directory as ~/....
+type ManifestFile struct {
+	Name   string `json:"name"`
+	Tunnel string `json:"tunnel,omitempty"`
+	Path   string `json:"path,omitempty"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Options selects what a backup or restore covers. The zero Options covers
+// every tunnel, the shared defaults and settings, but no keys.
+type Options struct {
+	// Tunnels, if set, limits the backup or restore to these tunnels,
+	// leaving out defaults and settings
+	Tunnels []string
+	// IncludeKeys also covers the SSH key files the tunnels use
+	IncludeKeys bool
+	// Store holds the tunnel configurations, as the config manager keeps
+	// them; nil is the tunnels directory of the config directory
+	Store config.Store
+}
+
+// store returns the store holding the tunnels of the configuration in
+// configPath
+func (o Options) store(configPath string) config.Store {
+	if o.Store != nil {
+		return o.Store
+	}
+	return config.NewFileStore(filepath.Join(configPath, "tunnels"))
+}
+
+// includes reports whether the options cover a tunnel
+func (o Options) includes(tunnel string) bool {
+	return len(o.Tunnels) == 0 || slices.Contains(o.Tunnels, tunnel)
+}
+
+// Dir returns the directory backups of the configuration in configPath are
+// kept in
+func Dir(configPath string) string {
+	return filepath.Join(configPath, "backups")
+}
+
+// Info describes a backup archive
+type Info struct {
+	Name string
+	Path string
+	Time time.Time
+	Size int64
+	Auto bool
+}
+
+// file is a file as stored in an archive. tunnel and path are recorded in
+// the manifest, not the archive entry.
+type file struct {
+	name   string
+	tunnel string
+	path   string
+	data   []byte
+}
+
+// Create writes an archive of the configuration in configPath that opts
+// selects to dir, named with prefix and now, along with the archive's
+// checksum file. It returns the archive's path.
+func Create(configPath, dir, prefix string, now time.Time, opts Options) (string, error) {
+	files, err := collect(configPath, opts)
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	path := filepath.Join(dir, prefix+now.Format(timeFormat)+archiveExt)
+	out, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return "", fmt.Errorf("failed to create backup: %w", err)
+	}
+
+	hash := sha256.New()
+	err = writeArchive(io.MultiWriter(out, hash), files, now)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		sum := fmt.Sprintf("%x  %s\n", hash.Sum(nil), filepath.Base(path))
+		err = os.WriteFile(path+checksumExt, []byte(sum), 0600)
+	}
+	if err != nil {
+		os.Remove(path)
+		os.Remove(path + checksumExt)
+		return "", fmt.Errorf("failed to write backup: %w", err)
+	}
+	return path, nil
+}
+
+// collect reads the files a backup of configPath selected by opts contains,
+// sorted by name, followed by the tunnels' keys
+func collect(configPath string, opts Options) ([]file, error) {
+	store := opts.store(configPath)
+	tunnels, err := store.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var files []file
+	found := make(map[string]bool)
+	for _, tunnel := range tunnels {
+		if !opts.includes(tunnel) {
+			continue
+		}
+		data, err := store.Load(tunnel)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tunnel '%s': %w", tunnel, err)
+		}
+		files = append(files, file{name: tunnelFile(tunnel), tunnel: tunnel, data: data})
+		found[tunnel] = true
+	}
+	for _, tunnel := range opts.Tunnels {
+		if !found[tunnel] {
+			return nil, fmt.Errorf("configuration '%s' not found", tunnel)
+		}
+	}
+
+	if len(opts.Tunnels) == 0 {
+		for _, name := range []string{config.DefaultsFile, config.SettingsFile} {
+			data, err := os.ReadFile(filepath.Join(configPath, name))
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", name, err)
+			}
+			files = append(files, file{name: name, data: data})
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].name < files[j].name })
+
+	if !opts.IncludeKeys {
+		return files, nil
+	}
+	var keys []file
+	for _, f := range files {
+		if f.tunnel == "" {
+			continue
+		}
+		tunnelKeys, err := collectKeys(f)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, tunnelKeys...)
+	}
+	return append(files, keys...), nil
+}
+
+// collectKeys reads the private and public key files named by a tunnel's
+// configuration file
+func collectKeys(f file) ([]file, error) {
+	tunnel := f.tunnel
+	cfg, err := config.ParseConfig(f.data)
+	if err != nil {
+		return nil, fmt.Errorf("tunnel '%s': %w", tunnel, err)
+	}
+
+	var keys []file
+	seen := make(map[string]bool)
+	for _, keyPath := range []string{cfg.SSH.PrivateKeyPath, cfg.SSH.NattedKeyPath} {
+		if keyPath == "" {
+			continue
+		}
+		keyPath = config.ExpandPath(keyPath)
+		for _, p := range []string{keyPath, keyPath + ".pub"} {
+			if seen[p] {
+				continue
+			}
+			seen[p] = true
+
+			data, err := os.ReadFile(p)
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to read key %s: %w", p, err)
+			}
+			abs, err := filepath.Abs(p)
+			if err != nil {
+				return nil, err
+			}
+			restorePath, ok := homePath(abs)
+			if !ok {
+				logger.Warnf("Not backing up key %s of tunnel '%s': only keys within the home directory are restored", p, tunnel)
+				continue
+			}
+			keys = append(keys, file{
+				name:   "keys/" + tunnel + "/" + filepath.Base(p),
+				tunnel: tunnel,
+				path:   restorePath,
+				data:   data,
+			})
+		}
+	}
+	return keys, nil
+}
+
+// homePath returns an absolute path within the home directory as ~/..., so
+// a key backed up on one machine or account is restored to the same place
+// in the home directory of another. It reports false for other paths.
+func homePath(abs string) (string, bool) {
+	home, err := homedir.Dir()
+	if err != nil {
+		return "", false
+	}
+	rel, err := filepath.Rel(home, abs)
+	if err != nil || !filepath.IsLocal(rel) {
+		return "", false
+	}
+	return "~/" + filepath.ToSlash(rel), true
+}
+
+// sshConfigFiles are files ssh and sshd read as configuration rather than
+// keys, which a restore never creates
+var sshConfigFiles = []string{"authorized_keys", "authorized_keys2", "config", "environment", "known_hosts", "rc"}
+
+// restorableKeyPath reports whether a key may be restored to p, a path
+// within the home directory written as ~/.... Absolute paths are refused,
+// since the manifest naming them comes from whoever wrote the archive.
+func restorableKeyPath(p string) bool {
+	rel, ok := strings.CutPrefix(p, "~/")
+	if !ok || !filepath.IsLocal(filepath.FromSlash(rel)) {
+		return false
+	}
+	return !slices.Contains(sshConfigFiles, path.Base(rel))
+}
+
+// tunnelFile returns the name of a tunnel's configuration file relative to
+// the config directory
+func tunnelFile(tunnel string) string {
+	return "tunnels/" + tunnel + ".yaml"
+}
+
+// writeArchive writes files to w as a gzipped tar archive, preceded by their
+// manifest
+func writeArchive(w io.Writer, files []file, now time.Time) error {
+	manifest := Manifest{Created: now, Tunnels: []string{}, Files: []ManifestFile{}}
+	for _, f := range files {
+		if f.tunnel != "" && !slices.Contains(manifest.Tunnels, f.tunnel) {
+			manifest.Tunnels = append(manifest.Tunnels, f.tunnel)
+		}
+		manifest.Files = append(manifest.Files, ManifestFile{
+			Name:   f.name,
+			Tunnel: f.tunnel,
+			Path:   f.path,
+			Size:   int64(len(f.data)),
+			SHA256: sha256Hex(f.data),
+		})
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	for _, f := range append([]file{{name: manifestName, data: data}}, files...) {
+		header := &tar.Header{
+			Name:    f.name,
+			Mode:    0600,
+			Size:    int64(len(f.data)),
+			ModTime: now,
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := tw.Write(f.data); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// readArchive returns the files in the archive at path, without its
+// manifest
+func readArchive(path string) ([]file, error) {
+	_, files, err := readArchiveManifest(path)
+	return files, err
+}
+
+// readArchiveManifest returns the manifest and other files in the archive at
+// path. The manifest is nil in archives without one.
+func readArchiveManifest(path string) (*Manifest, []file, error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer in.Close()
+
+	gz, err := gzip.NewReader(in)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s is not a backup archive: %w", filepath.Base(path), err)
+	}
+	defer gz.Close()
+
+	var manifest *Manifest
+	var files []file
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return manifest, files, nil
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read %s: %w", filepath.Base(path), err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read %s: %w", filepath.Base(path), err)
+		}
+
+		if header.Name == manifestName {
+			manifest = &Manifest{}
+			if err := json.Unmarshal(data, manifest); err != nil {
+				return nil, nil, fmt.Errorf("%s has an invalid manifest: %w", filepath.Base(path), err)
+			}
+			continue
+		}
+		files = append(files, file{name: header.Name, data: data})
+	}
+}
+
+// CheckArchive verifies an archive against its checksum file, failing with
+// an error wrapping ErrChecksumMismatch if they differ
+func CheckArchive(path string) error {
+	data, err := os.ReadFile(path + checksumExt)
+	if err != nil {
+		return fmt.Errorf("failed to read checksum of %s: %w", filepath.Base(path), err)
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return fmt.Errorf("checksum file of %s is empty", filepath.Base(path))
+	}
+
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, in); err != nil {
+		return fmt.Errorf("failed to read %s: %w", filepath.Base(path), err)
+	}
+	if sum := hex.EncodeToString(hash.Sum(nil)); !strings.EqualFold(sum, fields[0]) {
+		return fmt.Errorf("%s: %w: archive is %s, expected %s", filepath.Base(path), ErrChecksumMismatch, sum, fields[0])
+	}
+	return nil
+}
+
+// verifiedFiles checks an archive and every file in it against their
+// recorded checksums and returns the files with the tunnel and path the
+// manifest gives them
+func verifiedFiles(archive string) (*Manifest, []file, error) {
+	if err := CheckArchive(archive); err != nil {
+		return nil, nil, err
+	}
+
+	manifest, files, err := readArchiveManifest(archive)
+	if err != nil {
+		return nil, nil, err
+	}
+	if manifest == nil {
+		return nil, nil, fmt.Errorf("%s has no manifest", filepath.Base(archive))
+	}
+
+	var verified []file
+	expected := make(map[string]ManifestFile, len(manifest.Files))
+	for _, mf := range manifest.Files {
+		expected[mf.Name] = mf
+	}
+	for _, f := range files {
+		mf, ok := expected[f.name]
+		if !ok {
+			return nil, nil, fmt.Errorf("%s: %s is not in the manifest", filepath.Base(archive), f.name)
+		}
+		if int64(len(f.data)) != mf.Size || sha256Hex(f.data) != mf.SHA256 {
+			return nil, nil, fmt.Errorf("%s: %w: %s does not match the manifest", filepath.Base(archive), ErrChecksumMismatch, f.name)
+		}
+		if !restorable(mf) {
+			return nil, nil, fmt.Errorf("%s: refusing to restore %s", filepath.Base(archive), f.name)
+		}
+		delete(expected, f.name)
+		verified = append(verified, file{name: f.name, tunnel: mf.Tunnel, path: mf.Path, data: f.data})
+	}
+	for _, mf := range manifest.Files {
+		if _, missing := expected[mf.Name]; missing {
+			return nil, nil, fmt.Errorf("%s: %s is in the manifest but missing from the archive", filepath.Base(archive), mf.Name)
+		}
+	}
+	return manifest, verified, nil
+}
+
+// restorable reports whether a manifest entry names a file backups may
+// write: a config file within the config directory, or a key file with a
+// path within the home directory to restore it to
+func restorable(mf ManifestFile) bool {
+	dir, base := path.Split(mf.Name)
+	switch {
+	case mf.Name == config.DefaultsFile || mf.Name == config.SettingsFile:
+		return mf.Path == ""
+	case dir == "tunnels/":
+		return mf.Path == "" && base == mf.Tunnel+".yaml" && mf.Tunnel != ""
+	case dir == "keys/"+mf.Tunnel+"/":
+		return mf.Tunnel != "" && base != "" && restorableKeyPath(mf.Path) && path.Base(mf.Path) == base
+	}
+	return false
+}
+
+// Restore writes the files in an archive that opts selects back into
+// configPath, or the tunnels into opts.Store if set, replacing existing
+// copies, and returns their names. Key files are restored to where they were
+// backed up from, with ~ expanded to the current home directory, but never
+// replace a different existing key. Nothing is written unless the archive
+// and every file in it match their checksums.
+func Restore(archive, configPath string, opts Options) ([]string, error) {
+	manifest, files, err := verifiedFiles(archive)
+	if err != nil {
+		return nil, err
+	}
+	for _, tunnel := range opts.Tunnels {
+		if !slices.Contains(manifest.Tunnels, tunnel) {
+			return nil, fmt.Errorf("tunnel '%s' is not in %s", tunnel, filepath.Base(archive))
+		}
+	}
+
+	type write struct {
+		file
+		target string
+		mode   os.FileMode
+	}
+	var writes []write
+	for _, f := range files {
+		if (f.tunnel == "" && len(opts.Tunnels) > 0) || (f.tunnel != "" && !opts.includes(f.tunnel)) {
+			continue
+		}
+		if f.path == "" {
+			writes = append(writes, write{f, filepath.Join(configPath, filepath.FromSlash(f.name)), 0600})
+			continue
+		}
+		if !opts.IncludeKeys {
+			continue
+		}
+
+		target := config.ExpandPath(filepath.FromSlash(f.path))
+		existing, err := os.ReadFile(target)
+		if err == nil && !bytes.Equal(existing, f.data) {
+			return nil, fmt.Errorf("key %s already exists and differs from the backup; move it aside to restore it", target)
+		}
+		if err == nil {
+			continue
+		}
+		mode := os.FileMode(0600)
+		if strings.HasSuffix(target, ".pub") {
+			mode = 0644
+		}
+		writes = append(writes, write{f, target, mode})
+	}
+
+	var restored []string
+	for _, w := range writes {
+		if opts.Store != nil && w.tunnel != "" && w.path == "" {
+			if err := opts.Store.Save(w.tunnel, w.data); err != nil {
+				return restored, fmt.Errorf("failed to restore %s: %w", w.name, err)
+			}
+			restored = append(restored, w.name)
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(w.target), 0700); err != nil {
+			return restored, fmt.Errorf("failed to create %s: %w", filepath.Dir(w.target), err)
+		}
+		tmp := w.target + ".restore"
+		if err := os.WriteFile(tmp, w.data, w.mode); err != nil {
+			return restored, fmt.Errorf("failed to restore %s: %w", w.name, err)
+		}
+		if err := os.Rename(tmp, w.target); err != nil {
+			os.Remove(tmp)
+			return restored, fmt.Errorf("failed to restore %s: %w", w.name, err)
+		}
+		restored = append(restored, w.name)
+	}
+	return restored, nil
+}
+
+// sha256Hex returns the hex SHA-256 of data
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// digest returns a hash identifying a set of files by their names and
+// contents
+func digest(files []file) string {
+	sorted := append([]file(nil), files...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].name < sorted[j].name })
+
+	h := sha256.New()
+	for _, f := range sorted {
+		fmt.Fprintf(h, "%s\x00%d\x00", f.name, len(f.data))
+		h.Write(f.data)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// List returns the backup archives in dir, oldest first. A missing
+// directory has no backups.
+func List(dir string) ([]Info, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup directory: %w", err)
+	}
+
+	var backups []Info
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, archiveExt) {
+			continue
+		}
+		fileInfo, err := entry.Info()
+		if err != nil {
+			continue
+		}
+
+		info := Info{
+			Name: name,
+			Path: filepath.Join(dir, name),
+			Time: fileInfo.ModTime(),
+			Size: fileInfo.Size(),
+			Auto: strings.HasPrefix(name, AutoPrefix),
+		}
+		stamp := strings.TrimSuffix(name, archiveExt)
+		stamp = strings.TrimPrefix(strings.TrimPrefix(stamp, AutoPrefix), ManualPrefix)
+		if t, err := time.ParseInLocation(timeFormat, stamp, time.Local); err == nil {
+			info.Time = t
+		}
+		backups = append(backups, info)
+	}
+
+	sort.SliceStable(backups, func(i, j int) bool { return backups[i].Time.Before(backups[j].Time) })
+	return backups, nil
+}
+
+// Prune deletes all but the newest keep automatic backups in dir, returning
+// the paths it removed. Manual backups are never pruned.
+func Prune(dir string, keep int) ([]string, error) {
+	backups, err := List(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var auto []Info
+	for _, b := range backups {
+		if b.Auto {
+			auto = append(auto, b)
+		}
+	}
+
+	var removed []string
+	for len(auto) > keep {
+		if err := os.Remove(auto[0].Path); err != nil && !os.IsNotExist(err) {
+			return removed, fmt.Errorf("failed to remove old backup: %w", err)
+		}
+		os.Remove(auto[0].Path + checksumExt)
+		removed = append(removed, auto[0].Path)
+		auto = auto[1:]
+	}
+	return removed, nil
+}
@@ -0,0 +1,339 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lerndmina/SSH-Tunnel/internal/config"
+	"github.com/mitchellh/go-homedir"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTunnel writes a tunnel configuration file into configPath
+func writeTunnel(t *testing.T, configPath, name, content string) {
+	t.Helper()
+	dir := filepath.Join(configPath, "tunnels")
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name+".yaml"), []byte(content), 0600))
+}
+
+func TestCreateArchivesConfigs(t *testing.T) {
+	configPath := t.TempDir()
+	writeTunnel(t, configPath, "home", "tunnel_name: home\n")
+	require.NoError(t, os.WriteFile(filepath.Join(configPath, config.DefaultsFile), []byte("cloud_server:\n  port: 22\n"), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(configPath, "audit.log"), []byte("{}\n"), 0600))
+
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.Local)
+	path, err := Create(configPath, Dir(configPath), ManualPrefix, now, Options{})
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(configPath, "backups", "backup-20260301-120000.tar.gz"), path)
+
+	files, err := readArchive(path)
+	require.NoError(t, err)
+	assert.Equal(t, []file{
+		{name: config.DefaultsFile, data: []byte("cloud_server:\n  port: 22\n")},
+		{name: "tunnels/home.yaml", data: []byte("tunnel_name: home\n")},
+	}, files)
+}
+
+func TestBackupAndRestoreThroughStore(t *testing.T) {
+	configPath := t.TempDir()
+	store := config.NewMemoryStore()
+	require.NoError(t, store.Save("home", []byte("tunnel_name: home\n")))
+	opts := Options{Store: store}
+
+	archive, err := Create(configPath, Dir(configPath), ManualPrefix, time.Now(), opts)
+	require.NoError(t, err)
+	files, err := readArchive(archive)
+	require.NoError(t, err)
+	assert.Equal(t, []file{{name: "tunnels/home.yaml", data: []byte("tunnel_name: home\n")}}, files)
+
+	require.NoError(t, store.Save("home", []byte("tunnel_name: home\nprofile: edited\n")))
+	restored, err := Restore(archive, configPath, opts)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"tunnels/home.yaml"}, restored)
+	data, err := store.Load("home")
+	require.NoError(t, err)
+	assert.Equal(t, "tunnel_name: home\n", string(data))
+	assert.NoDirExists(t, filepath.Join(configPath, "tunnels"))
+}
+
+func TestSchedulerTickAndPrune(t *testing.T) {
+	configPath := t.TempDir()
+	writeTunnel(t, configPath, "home", "tunnel_name: home\n")
+
+	s := NewScheduler(configPath, config.BackupSettings{Interval: time.Hour, Keep: 2})
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.Local)
+
+	// The first tick backs up straight away
+	path, err := s.Tick(start)
+	require.NoError(t, err)
+	assert.FileExists(t, path)
+
+	// Nothing is due until the interval has passed
+	path, err = s.Tick(start.Add(30 * time.Minute))
+	require.NoError(t, err)
+	assert.Empty(t, path)
+
+	for i := 1; i <= 3; i++ {
+		path, err = s.Tick(start.Add(time.Duration(i) * time.Hour))
+		require.NoError(t, err)
+		assert.NotEmpty(t, path)
+	}
+
+	// A manual backup is never pruned
+	manual, err := Create(configPath, s.Dir, ManualPrefix, start.Add(-time.Hour), Options{})
+	require.NoError(t, err)
+	_, err = s.Tick(start.Add(4 * time.Hour))
+	require.NoError(t, err)
+
+	backups, err := List(s.Dir)
+	require.NoError(t, err)
+	var names []string
+	for _, b := range backups {
+		names = append(names, b.Name)
+	}
+	assert.Equal(t, []string{
+		filepath.Base(manual),
+		"auto-20260301-150000.tar.gz",
+		"auto-20260301-160000.tar.gz",
+	}, names)
+}
+
+func TestSchedulerBacksUpOnChange(t *testing.T) {
+	configPath := t.TempDir()
+	writeTunnel(t, configPath, "home", "tunnel_name: home\n")
+
+	s := NewScheduler(configPath, config.BackupSettings{OnChange: true})
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.Local)
+
+	path, err := s.Tick(start)
+	require.NoError(t, err)
+	require.NotEmpty(t, path)
+
+	path, err = s.Tick(start.Add(time.Minute))
+	require.NoError(t, err)
+	assert.Empty(t, path, "unchanged configuration is not backed up again")
+
+	writeTunnel(t, configPath, "work", "tunnel_name: work\n")
+	path, err = s.Tick(start.Add(2 * time.Minute))
+	require.NoError(t, err)
+	require.NotEmpty(t, path)
+
+	files, err := readArchive(path)
+	require.NoError(t, err)
+	assert.Len(t, files, 2)
+}
+
+func TestRestore(t *testing.T) {
+	configPath := t.TempDir()
+	writeTunnel(t, configPath, "home", "tunnel_name: home\n")
+	archive, err := Create(configPath, Dir(configPath), ManualPrefix, time.Now(), Options{})
+	require.NoError(t, err)
+	require.NoError(t, CheckArchive(archive))
+
+	writeTunnel(t, configPath, "home", "tunnel_name: home\nprofile: edited\n")
+	restored, err := Restore(archive, configPath, Options{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"tunnels/home.yaml"}, restored)
+
+	data, err := os.ReadFile(filepath.Join(configPath, "tunnels", "home.yaml"))
+	require.NoError(t, err)
+	assert.Equal(t, "tunnel_name: home\n", string(data))
+}
+
+func TestRestoreCorruptedArchive(t *testing.T) {
+	configPath := t.TempDir()
+	writeTunnel(t, configPath, "home", "tunnel_name: home\n")
+	archive, err := Create(configPath, Dir(configPath), ManualPrefix, time.Now(), Options{})
+	require.NoError(t, err)
+
+	// Flip a byte in the middle of the archive
+	data, err := os.ReadFile(archive)
+	require.NoError(t, err)
+	data[len(data)/2] ^= 0xff
+	require.NoError(t, os.WriteFile(archive, data, 0600))
+
+	writeTunnel(t, configPath, "home", "tunnel_name: home\nprofile: current\n")
+	_, err = Restore(archive, configPath, Options{})
+	require.ErrorIs(t, err, ErrChecksumMismatch)
+	assert.ErrorIs(t, CheckArchive(archive), ErrChecksumMismatch)
+
+	current, err := os.ReadFile(filepath.Join(configPath, "tunnels", "home.yaml"))
+	require.NoError(t, err)
+	assert.Equal(t, "tunnel_name: home\nprofile: current\n", string(current), "nothing is restored from a corrupted archive")
+}
+
+func TestRestoreTamperedFile(t *testing.T) {
+	configPath := t.TempDir()
+
+	// An archive whose checksum file was regenerated after a file in it was
+	// changed passes the archive check but not the manifest
+	manifest, err := json.Marshal(Manifest{Files: []ManifestFile{{
+		Name:   "tunnels/home.yaml",
+		Size:   int64(len("tunnel_name: home\n")),
+		SHA256: sha256Hex([]byte("tunnel_name: home\n")),
+	}}})
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, f := range []file{
+		{name: manifestName, data: manifest},
+		{name: "tunnels/home.yaml", data: []byte("tunnel_name: evil\n")},
+	} {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: f.name, Mode: 0600, Size: int64(len(f.data))}))
+		_, err := tw.Write(f.data)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+
+	archive := filepath.Join(t.TempDir(), "backup-tampered.tar.gz")
+	require.NoError(t, os.WriteFile(archive, buf.Bytes(), 0600))
+	require.NoError(t, os.WriteFile(archive+checksumExt, []byte(sha256Hex(buf.Bytes())+"  backup-tampered.tar.gz\n"), 0600))
+	require.NoError(t, CheckArchive(archive))
+
+	_, err = Restore(archive, configPath, Options{})
+	require.ErrorIs(t, err, ErrChecksumMismatch)
+	assert.Contains(t, err.Error(), "tunnels/home.yaml")
+	assert.NoFileExists(t, filepath.Join(configPath, "tunnels", "home.yaml"))
+}
+
+// useHome points the home directory at a new temporary directory, and
+// returns it
+func useHome(t *testing.T) string {
+	t.Helper()
+	homedir.DisableCache = true
+	t.Cleanup(func() { homedir.DisableCache = false })
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	return home
+}
+
+func TestSelectiveBackupAndRestore(t *testing.T) {
+	configPath := t.TempDir()
+	keyDir := filepath.Join(useHome(t), ".ssh")
+	require.NoError(t, os.MkdirAll(keyDir, 0700))
+	keyPath := filepath.Join(keyDir, "home_key")
+	require.NoError(t, os.WriteFile(keyPath, []byte("private"), 0600))
+	require.NoError(t, os.WriteFile(keyPath+".pub", []byte("public"), 0644))
+
+	writeTunnel(t, configPath, "home", "tunnel_name: home\nssh:\n  private_key_path: "+keyPath+"\n")
+	writeTunnel(t, configPath, "work", "tunnel_name: work\n")
+	writeTunnel(t, configPath, "lab", "tunnel_name: lab\n")
+	require.NoError(t, os.WriteFile(filepath.Join(configPath, config.DefaultsFile), []byte("original defaults\n"), 0600))
+
+	opts := Options{Tunnels: []string{"home", "work"}, IncludeKeys: true}
+	archive, err := Create(configPath, Dir(configPath), ManualPrefix, time.Now(), opts)
+	require.NoError(t, err)
+
+	manifest, files, err := verifiedFiles(archive)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"home", "work"}, manifest.Tunnels)
+	var names []string
+	for _, f := range files {
+		names = append(names, f.name)
+	}
+	assert.Equal(t, []string{"tunnels/home.yaml", "tunnels/work.yaml", "keys/home/home_key", "keys/home/home_key.pub"}, names)
+
+	// Restore only home into a directory where everything has moved on
+	writeTunnel(t, configPath, "home", "tunnel_name: home\nprofile: edited\n")
+	writeTunnel(t, configPath, "work", "tunnel_name: work\nprofile: edited\n")
+	require.NoError(t, os.WriteFile(filepath.Join(configPath, config.DefaultsFile), []byte("edited defaults\n"), 0600))
+	require.NoError(t, os.Remove(keyPath))
+
+	restored, err := Restore(archive, configPath, Options{Tunnels: []string{"home"}, IncludeKeys: true})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"tunnels/home.yaml", "keys/home/home_key"}, restored)
+
+	assert.Equal(t, "tunnel_name: home\nssh:\n  private_key_path: "+keyPath+"\n", string(mustRead(t, filepath.Join(configPath, "tunnels", "home.yaml"))))
+	assert.Equal(t, "tunnel_name: work\nprofile: edited\n", string(mustRead(t, filepath.Join(configPath, "tunnels", "work.yaml"))))
+	assert.Equal(t, "tunnel_name: lab\n", string(mustRead(t, filepath.Join(configPath, "tunnels", "lab.yaml"))))
+	assert.Equal(t, "edited defaults\n", string(mustRead(t, filepath.Join(configPath, config.DefaultsFile))))
+	assert.Equal(t, "private", string(mustRead(t, keyPath)))
+
+	_, err = Restore(archive, configPath, Options{Tunnels: []string{"lab"}})
+	assert.ErrorContains(t, err, "tunnel 'lab' is not in")
+}
+
+func TestRestoreKeepsDifferentExistingKey(t *testing.T) {
+	configPath := t.TempDir()
+	keyPath := filepath.Join(useHome(t), "home_key")
+	require.NoError(t, os.WriteFile(keyPath, []byte("private"), 0600))
+	writeTunnel(t, configPath, "home", "tunnel_name: home\nssh:\n  private_key_path: "+keyPath+"\n")
+
+	archive, err := Create(configPath, Dir(configPath), ManualPrefix, time.Now(), Options{IncludeKeys: true})
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(keyPath, []byte("rotated"), 0600))
+	_, err = Restore(archive, configPath, Options{IncludeKeys: true})
+	assert.ErrorContains(t, err, "already exists and differs")
+	assert.Equal(t, "rotated", string(mustRead(t, keyPath)))
+}
+
+func TestRestoreKeysIntoCurrentHome(t *testing.T) {
+	oldHome := useHome(t)
+	configPath := t.TempDir()
+	keyPath := filepath.Join(oldHome, ".ssh", "home_key")
+	require.NoError(t, os.MkdirAll(filepath.Dir(keyPath), 0700))
+	require.NoError(t, os.WriteFile(keyPath, []byte("private"), 0600))
+	writeTunnel(t, configPath, "home", "tunnel_name: home\nssh:\n  private_key_path: ~/.ssh/home_key\n")
+
+	archive, err := Create(configPath, Dir(configPath), ManualPrefix, time.Now(), Options{IncludeKeys: true})
+	require.NoError(t, err)
+	manifest, _, err := verifiedFiles(archive)
+	require.NoError(t, err)
+	assert.Equal(t, "~/.ssh/home_key", manifest.Files[1].Path)
+
+	// Restore on a machine where the home directory is elsewhere
+	newHome := useHome(t)
+	restored, err := Restore(archive, configPath, Options{IncludeKeys: true})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"tunnels/home.yaml", "keys/home/home_key"}, restored)
+	assert.Equal(t, "private", string(mustRead(t, filepath.Join(newHome, ".ssh", "home_key"))))
+
+}
+
+func TestRestoreRefusesKeysOutsideHome(t *testing.T) {
+	home := useHome(t)
+	configPath := t.TempDir()
+	keyPath := filepath.Join(t.TempDir(), "home_key")
+	require.NoError(t, os.WriteFile(keyPath, []byte("private"), 0600))
+	writeTunnel(t, configPath, "home", "tunnel_name: home\nssh:\n  private_key_path: "+keyPath+"\n")
+
+	// A key outside the home directory is left out of the backup
+	archive, err := Create(configPath, Dir(configPath), ManualPrefix, time.Now(), Options{IncludeKeys: true})
+	require.NoError(t, err)
+	_, files, err := verifiedFiles(archive)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	assert.Equal(t, "tunnels/home.yaml", files[0].name)
+
+	for _, keyPath := range []string{
+		"/etc/cron.d/home_key",
+		filepath.Join(home, ".ssh", "home_key"),
+		"~/../home_key",
+		".ssh/home_key",
+	} {
+		assert.False(t, restorable(ManifestFile{Name: "keys/home/home_key", Tunnel: "home", Path: keyPath}), keyPath)
+	}
+	assert.False(t, restorable(ManifestFile{Name: "keys/home/authorized_keys", Tunnel: "home", Path: "~/.ssh/authorized_keys"}))
+	assert.True(t, restorable(ManifestFile{Name: "keys/home/home_key", Tunnel: "home", Path: "~/.ssh/home_key"}))
+}
+
+// mustRead returns the contents of a file
+func mustRead(t *testing.T, path string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return data
+}
@@ -0,0 +1,117 @@
+package backup
+
+import (
+	"context"
+	"time"
+
+	"github.com/lerndmina/SSH-Tunnel/internal/config"
+	"github.com/lerndmina/SSH-Tunnel/pkg/logger"
+)
+
+// pollInterval is how often the scheduler checks whether a backup is due
+const pollInterval = 30 * time.Second
+
+// Scheduler takes automatic backups of a config directory on an interval
+// and, if enabled, whenever a configuration changes. Whether a backup is due
+// is decided from the archives already in Dir, so a restarted daemon, or
+// several daemons sharing a config directory, do not take extra backups.
+type Scheduler struct {
+	ConfigPath string
+	Dir        string
+	Settings   config.BackupSettings
+	// Store holds the tunnel configurations; nil is the tunnels directory of
+	// ConfigPath
+	Store config.Store
+}
+
+// NewScheduler creates a scheduler backing up configPath into its backup
+// directory
+func NewScheduler(configPath string, settings config.BackupSettings) *Scheduler {
+	return &Scheduler{
+		ConfigPath: configPath,
+		Dir:        Dir(configPath),
+		Settings:   settings,
+	}
+}
+
+// Run takes backups as they fall due until ctx is done. Failures are logged
+// and retried on the next check.
+func (s *Scheduler) Run(ctx context.Context) {
+	interval := pollInterval
+	if s.Settings.Interval > 0 && s.Settings.Interval < interval {
+		interval = s.Settings.Interval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if path, err := s.Tick(time.Now()); err != nil {
+			logger.Warnf("Automatic backup failed: %v", err)
+		} else if path != "" {
+			logger.Infof("Created automatic backup %s", path)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Tick takes an automatic backup if one is due at now and prunes old ones,
+// returning the new archive's path, or "" if none was due
+func (s *Scheduler) Tick(now time.Time) (string, error) {
+	due, err := s.due(now)
+	if err != nil || !due {
+		return "", err
+	}
+
+	path, err := Create(s.ConfigPath, s.Dir, AutoPrefix, now, Options{Store: s.Store})
+	if err != nil {
+		return "", err
+	}
+	if _, err := Prune(s.Dir, s.Settings.KeepCount()); err != nil {
+		return path, err
+	}
+	return path, nil
+}
+
+// due reports whether an automatic backup should be taken at now: the
+// interval has passed since the newest one, or the configuration differs
+// from it
+func (s *Scheduler) due(now time.Time) (bool, error) {
+	backups, err := List(s.Dir)
+	if err != nil {
+		return false, err
+	}
+
+	var latest *Info
+	for i := range backups {
+		if backups[i].Auto {
+			latest = &backups[i]
+		}
+	}
+	if latest == nil {
+		return true, nil
+	}
+
+	if s.Settings.Interval > 0 && now.Sub(latest.Time) >= s.Settings.Interval {
+		return true, nil
+	}
+	if !s.Settings.OnChange {
+		return false, nil
+	}
+
+	current, err := collect(s.ConfigPath, Options{Store: s.Store})
+	if err != nil {
+		return false, err
+	}
+	archived, err := readArchive(latest.Path)
+	if err != nil {
+		// An unreadable archive protects nothing; replace it
+		return true, nil
+	}
+	return digest(current) != digest(archived), nil
+}
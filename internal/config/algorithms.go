@@ -0,0 +1,91 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Algorithm names understood by OpenSSH, as listed by `ssh -Q cipher`,
+// `ssh -Q mac` and `ssh -Q kex`
+var (
+	knownCiphers = []string{
+		"3des-cbc", "aes128-cbc", "aes192-cbc", "aes256-cbc",
+		"aes128-ctr", "aes192-ctr", "aes256-ctr",
+		"aes128-gcm@openssh.com", "aes256-gcm@openssh.com",
+		"chacha20-poly1305@openssh.com",
+	}
+	knownMACs = []string{
+		"hmac-sha1", "hmac-sha1-96", "hmac-sha2-256", "hmac-sha2-512",
+		"hmac-md5", "hmac-md5-96", "umac-64@openssh.com", "umac-128@openssh.com",
+		"hmac-sha1-etm@openssh.com", "hmac-sha1-96-etm@openssh.com",
+		"hmac-sha2-256-etm@openssh.com", "hmac-sha2-512-etm@openssh.com",
+		"hmac-md5-etm@openssh.com", "hmac-md5-96-etm@openssh.com",
+		"umac-64-etm@openssh.com", "umac-128-etm@openssh.com",
+	}
+	knownKexAlgorithms = []string{
+		"diffie-hellman-group1-sha1", "diffie-hellman-group14-sha1",
+		"diffie-hellman-group14-sha256", "diffie-hellman-group16-sha512",
+		"diffie-hellman-group18-sha512", "diffie-hellman-group-exchange-sha1",
+		"diffie-hellman-group-exchange-sha256",
+		"ecdh-sha2-nistp256", "ecdh-sha2-nistp384", "ecdh-sha2-nistp521",
+		"curve25519-sha256", "curve25519-sha256@libssh.org",
+		"sntrup761x25519-sha512", "sntrup761x25519-sha512@openssh.com",
+		"mlkem768x25519-sha256",
+	}
+)
+
+// SplitAlgorithms splits a comma-separated algorithm list, dropping blanks
+func SplitAlgorithms(list string) []string {
+	var names []string
+	for _, name := range strings.Split(list, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// CipherList returns the configured ciphers, or nil for the SSH defaults
+func (s *SSHConfig) CipherList() []string {
+	return SplitAlgorithms(s.Ciphers)
+}
+
+// MACList returns the configured MACs, or nil for the SSH defaults
+func (s *SSHConfig) MACList() []string {
+	return SplitAlgorithms(s.MACs)
+}
+
+// KexList returns the configured key exchange algorithms, or nil for the SSH
+// defaults
+func (s *SSHConfig) KexList() []string {
+	return SplitAlgorithms(s.KexAlgorithms)
+}
+
+// ValidateAlgorithms checks the cipher, MAC and key exchange lists against
+// the algorithm names OpenSSH knows. OpenSSH's +, - and ^ list modifiers are
+// not supported; lists must name every algorithm allowed.
+func (s *SSHConfig) ValidateAlgorithms() error {
+	lists := []struct {
+		field string
+		names []string
+		known []string
+	}{
+		{"ciphers", s.CipherList(), knownCiphers},
+		{"macs", s.MACList(), knownMACs},
+		{"kex_algorithms", s.KexList(), knownKexAlgorithms},
+	}
+
+	for _, list := range lists {
+		for _, name := range list.names {
+			if strings.ContainsAny(name[:1], "+-^") {
+				return fmt.Errorf("ssh.%s: list modifiers are not supported (%q); list the algorithms explicitly", list.field, name)
+			}
+			if !slices.Contains(list.known, name) {
+				return fmt.Errorf("ssh.%s: unknown algorithm %q", list.field, name)
+			}
+		}
+	}
+
+	return nil
+}
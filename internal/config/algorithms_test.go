@@ -0,0 +1,48 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateAlgorithms(t *testing.T) {
+	tests := []struct {
+		name    string
+		ssh     SSHConfig
+		wantErr string
+	}{
+		{"defaults", SSHConfig{}, ""},
+		{"hardened", SSHConfig{
+			Ciphers:       "chacha20-poly1305@openssh.com,aes256-gcm@openssh.com",
+			MACs:          "hmac-sha2-512-etm@openssh.com, hmac-sha2-256-etm@openssh.com",
+			KexAlgorithms: "sntrup761x25519-sha512@openssh.com,curve25519-sha256",
+		}, ""},
+		{"unknown cipher", SSHConfig{Ciphers: "aes256-ctr,blowfish-cbc"}, `ssh.ciphers: unknown algorithm "blowfish-cbc"`},
+		{"unknown mac", SSHConfig{MACs: "hmac-sha3-256"}, `ssh.macs: unknown algorithm "hmac-sha3-256"`},
+		{"unknown kex", SSHConfig{KexAlgorithms: "curve448-sha512"}, `ssh.kex_algorithms: unknown algorithm "curve448-sha512"`},
+		{"modifier", SSHConfig{Ciphers: "+aes128-cbc"}, "list modifiers are not supported"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.ssh.ValidateAlgorithms()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestSaveConfigRejectsUnknownAlgorithm(t *testing.T) {
+	manager, err := NewManager(t.TempDir())
+	require.NoError(t, err)
+
+	err = manager.SaveConfig(&Config{TunnelName: "weak", SSH: SSHConfig{KexAlgorithms: "diffie-hellman-group1-sha2"}})
+	assert.Error(t, err)
+	assert.Empty(t, manager.ListConfigs())
+}
@@ -1,21 +1,32 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"net"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/lerndmina/SSH-Tunnel/internal/audit"
 	"github.com/mitchellh/go-homedir"
 	"gopkg.in/yaml.v3"
 )
 
+// DefaultsFile is the name of the file in the config directory whose values
+// are merged underneath every tunnel configuration
+const DefaultsFile = "defaults.yaml"
+
 // Manager handles configuration management
 type Manager struct {
 	configPath   string
 	configs      map[string]*Config
+	defaults     []byte
 	activeConfig string
+	audit        *audit.Logger
+	store        Store
 	mu           sync.RWMutex
 }
 
@@ -27,6 +38,9 @@ var (
 // Config represents a tunnel configuration
 type Config struct {
 	TunnelName    string             `yaml:"tunnel_name" json:"tunnel_name" validate:"required"`
+	Profile       string             `yaml:"profile,omitempty" json:"profile,omitempty"`
+	Tags          []string           `yaml:"tags,omitempty" json:"tags,omitempty"`
+	Group         string             `yaml:"group,omitempty" json:"group,omitempty"`
 	CloudServer   CloudServerConfig  `yaml:"cloud_server" json:"cloud_server"`
 	LocalServer   LocalServerConfig  `yaml:"local_server" json:"local_server"`
 	SSH           SSHConfig          `yaml:"ssh" json:"ssh"`
@@ -51,6 +65,40 @@ type LocalServerConfig struct {
 	User        string `yaml:"user" json:"user" validate:"required"`
 	ReversePort int    `yaml:"reverse_port" json:"reverse_port" validate:"required,min=1,max=65535"`
 	SOCKSPort   int    `yaml:"socks_port,omitempty" json:"socks_port,omitempty"`
+	// SOCKSBindAddr is the address the SOCKS proxy listens on
+	// (default 127.0.0.1; use "*" for all interfaces)
+	SOCKSBindAddr string `yaml:"socks_bind_addr,omitempty" json:"socks_bind_addr,omitempty"`
+	// SOCKSCheckURL, if set, is fetched through the SOCKS proxy during
+	// health checks and diagnostics
+	SOCKSCheckURL string          `yaml:"socks_check_url,omitempty" json:"socks_check_url,omitempty"`
+	LocalForwards []ForwardConfig `yaml:"local_forwards,omitempty" json:"local_forwards,omitempty"`
+	// RemoteForwards are opened on the cloud server in addition to the
+	// reverse port
+	RemoteForwards []RemoteForwardConfig `yaml:"remote_forwards,omitempty" json:"remote_forwards,omitempty"`
+}
+
+// DefaultBindAddr is used for local listeners without an explicit bind
+// address, so they are not exposed to the network by accident
+const DefaultBindAddr = "127.0.0.1"
+
+// ForwardConfig describes a local port forward (ssh -L): connections to
+// BindAddr:LocalPort are forwarded to RemoteHost:RemotePort via the cloud server
+type ForwardConfig struct {
+	BindAddr   string `yaml:"bind_addr,omitempty" json:"bind_addr,omitempty"`
+	LocalPort  int    `yaml:"local_port" json:"local_port"`
+	RemoteHost string `yaml:"remote_host" json:"remote_host"`
+	RemotePort int    `yaml:"remote_port" json:"remote_port"`
+}
+
+// RemoteForwardConfig describes a remote port forward (ssh -R): connections
+// to BindAddr:RemotePort on the cloud server are forwarded to
+// LocalHost:LocalPort from this machine. Without BindAddr, sshd picks the
+// address according to its GatewayPorts setting.
+type RemoteForwardConfig struct {
+	BindAddr   string `yaml:"bind_addr,omitempty" json:"bind_addr,omitempty"`
+	RemotePort int    `yaml:"remote_port" json:"remote_port"`
+	LocalHost  string `yaml:"local_host" json:"local_host"`
+	LocalPort  int    `yaml:"local_port" json:"local_port"`
 }
 
 // SSHConfig contains SSH-related configuration
@@ -60,6 +108,31 @@ type SSHConfig struct {
 	KnownHostsFile string `yaml:"known_hosts_file" json:"known_hosts_file"`
 	Compression    bool   `yaml:"compression" json:"compression"`
 	Ciphers        string `yaml:"ciphers,omitempty" json:"ciphers,omitempty"`
+	// MACs and KexAlgorithms are comma-separated lists like Ciphers,
+	// restricting the algorithms SSH may negotiate
+	MACs          string `yaml:"macs,omitempty" json:"macs,omitempty"`
+	KexAlgorithms string `yaml:"kex_algorithms,omitempty" json:"kex_algorithms,omitempty"`
+	// AuthorizedKeyOptions prefixes keys deployed for this tunnel in
+	// authorized_keys, e.g. "restrict,port-forwarding"
+	AuthorizedKeyOptions string `yaml:"authorized_key_options,omitempty" json:"authorized_key_options,omitempty"`
+	// ConfigFile is an OpenSSH client config file passed to ssh with -F.
+	// The tunnel's own settings still take precedence over it.
+	ConfigFile string `yaml:"config_file,omitempty" json:"config_file,omitempty"`
+	// BindAddress is the local IP address SSH connections originate from,
+	// passed to ssh with -b, for machines with several interfaces
+	BindAddress string `yaml:"bind_address,omitempty" json:"bind_address,omitempty"`
+	// CertificatePath is an OpenSSH certificate for the private key, passed
+	// to ssh as CertificateFile
+	CertificatePath string `yaml:"certificate_path,omitempty" json:"certificate_path,omitempty"`
+	// CertRenewCommand refreshes the certificate, e.g. with 'step ssh
+	// certificate' or Vault. It runs before connecting whenever the
+	// certificate is missing or expires within CertRenewBefore (default 10m).
+	CertRenewCommand string        `yaml:"cert_renew_command,omitempty" json:"cert_renew_command,omitempty"`
+	CertRenewBefore  time.Duration `yaml:"cert_renew_before,omitempty" json:"cert_renew_before,omitempty"`
+	// InsecureSkipHostKeyCheck turns host key verification off, for test
+	// servers whose keys change on every run. A warning is logged whenever
+	// it takes effect.
+	InsecureSkipHostKeyCheck bool `yaml:"insecure_skip_host_key_check,omitempty" json:"insecure_skip_host_key_check,omitempty"`
 }
 
 // ServiceConfig contains system service configuration
@@ -67,6 +140,20 @@ type ServiceConfig struct {
 	Name          string `yaml:"name" json:"name" validate:"required"`
 	AutoReconnect bool   `yaml:"auto_reconnect" json:"auto_reconnect"`
 	RestartSec    int    `yaml:"restart_sec" json:"restart_sec"`
+	// PreStart is a shell command run before SSH is spawned; a nonzero exit
+	// aborts the start. OnStart and OnStop run after the tunnel starts or
+	// stops. All hooks see the tunnel in SSH_TUNNEL_* environment variables.
+	PreStart string `yaml:"pre_start,omitempty" json:"pre_start,omitempty"`
+	OnStart  string `yaml:"on_start,omitempty" json:"on_start,omitempty"`
+	OnStop   string `yaml:"on_stop,omitempty" json:"on_stop,omitempty"`
+	// HookTimeout limits each hook command, in seconds (default 30)
+	HookTimeout int `yaml:"hook_timeout,omitempty" json:"hook_timeout,omitempty"`
+	// MaxLifetime, if set, stops the tunnel automatically once it has run
+	// this long, e.g. "2h"
+	MaxLifetime time.Duration `yaml:"max_lifetime,omitempty" json:"max_lifetime,omitempty"`
+	// HealthCheckInterval, if set, runs a health check this often while the
+	// tunnel is up, e.g. "1m", reconnecting it when a check fails
+	HealthCheckInterval time.Duration `yaml:"health_check_interval,omitempty" json:"health_check_interval,omitempty"`
 }
 
 // AnalyticsConfig contains analytics and monitoring settings
@@ -82,6 +169,16 @@ type NotificationConfig struct {
 	Email      string `yaml:"email,omitempty" json:"email,omitempty"`
 	WebhookURL string `yaml:"webhook_url,omitempty" json:"webhook_url,omitempty"`
 	Enabled    bool   `yaml:"enabled" json:"enabled"`
+	// WebhookTimeoutSec limits each webhook request, in seconds (default 10)
+	WebhookTimeoutSec int `yaml:"webhook_timeout_sec,omitempty" json:"webhook_timeout_sec,omitempty"`
+	// WebhookRetries is how many times a failed webhook request is retried
+	WebhookRetries int `yaml:"webhook_retries,omitempty" json:"webhook_retries,omitempty"`
+	// WebhookHeaders are added to every webhook request, e.g. an
+	// Authorization header for the endpoint
+	WebhookHeaders map[string]string `yaml:"webhook_headers,omitempty" json:"webhook_headers,omitempty"`
+	// Format is the webhook payload format: raw, slack or discord. If
+	// empty it is detected from the webhook URL.
+	Format string `yaml:"format,omitempty" json:"format,omitempty"`
 }
 
 // PerformanceConfig contains performance tuning settings
@@ -89,6 +186,15 @@ type PerformanceConfig struct {
 	KeepAliveInterval int `yaml:"keep_alive_interval" json:"keep_alive_interval"`
 	KeepAliveCountMax int `yaml:"keep_alive_count_max" json:"keep_alive_count_max"`
 	ConnectTimeout    int `yaml:"connect_timeout" json:"connect_timeout"`
+	// DNSRetrySec is the pause between reconnect attempts while the cloud
+	// server's host name does not resolve, for dynamic DNS records that lag
+	// behind address changes. It replaces the exponential backoff for those
+	// failures; 0 uses the default of 30 seconds.
+	DNSRetrySec int `yaml:"dns_retry_sec,omitempty" json:"dns_retry_sec,omitempty"`
+	// DNSRefreshSec, if set, re-resolves the cloud server's host name this
+	// often while connected and logs when its address changes. The
+	// connection is kept; the new address is used when it next reconnects.
+	DNSRefreshSec int `yaml:"dns_refresh_sec,omitempty" json:"dns_refresh_sec,omitempty"`
 }
 
 // Initialize initializes the global configuration manager
@@ -100,14 +206,22 @@ func Initialize(configPath string) error {
 	return err
 }
 
-// NewManager creates a new configuration manager
+// NewManager creates a new configuration manager, keeping tunnel
+// configurations in the tunnels directory of the config directory
 func NewManager(configPath string) (*Manager, error) {
+	return NewManagerWithStore(configPath, nil)
+}
+
+// NewManagerWithStore creates a configuration manager keeping tunnel
+// configurations in store. The config directory still holds the defaults,
+// the active marker and the audit log. A nil store is the tunnels
+// directory, as for NewManager.
+func NewManagerWithStore(configPath string, store Store) (*Manager, error) {
 	if configPath == "" {
-		home, err := homedir.Dir()
-		if err != nil {
-			return nil, fmt.Errorf("failed to get home directory: %w", err)
+		var err error
+		if configPath, err = DefaultConfigPath(); err != nil {
+			return nil, err
 		}
-		configPath = filepath.Join(home, ".ssh-tunnel-manager")
 	}
 
 	// Ensure config directory exists
@@ -115,9 +229,20 @@ func NewManager(configPath string) (*Manager, error) {
 		return nil, fmt.Errorf("failed to create config directory: %w", err)
 	}
 
+	if store == nil {
+		store = NewFileStore(filepath.Join(configPath, "tunnels"))
+	}
+
 	manager := &Manager{
 		configPath: configPath,
 		configs:    make(map[string]*Config),
+		audit:      audit.New(configPath),
+		store:      store,
+	}
+
+	// Load shared defaults before the configurations that build on them
+	if err := manager.loadDefaults(); err != nil {
+		return nil, fmt.Errorf("failed to load defaults: %w", err)
 	}
 
 	// Load existing configurations
@@ -128,33 +253,52 @@ func NewManager(configPath string) (*Manager, error) {
 	return manager, nil
 }
 
+// DefaultConfigPath returns the config directory used when none is given
+func DefaultConfigPath() (string, error) {
+	home, err := homedir.Dir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(home, ".ssh-tunnel-manager"), nil
+}
+
 // GetManager returns the global configuration manager
 func GetManager() *Manager {
 	return globalManager
 }
 
-// loadConfigs loads all configuration files from the config directory
-func (m *Manager) loadConfigs() error {
-	configsDir := filepath.Join(m.configPath, "tunnels")
-	if _, err := os.Stat(configsDir); os.IsNotExist(err) {
-		return nil // No configs directory yet
+// loadDefaults reads the shared defaults file, if present
+func (m *Manager) loadDefaults() error {
+	data, err := os.ReadFile(filepath.Join(m.configPath, DefaultsFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
 	}
 
-	entries, err := os.ReadDir(configsDir)
-	if err != nil {
-		return fmt.Errorf("failed to read configs directory: %w", err)
+	// Make sure the defaults parse before they are applied to every tunnel
+	var defaults Config
+	if err := yaml.Unmarshal(data, &defaults); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", DefaultsFile, err)
 	}
 
-	for _, entry := range entries {
-		if entry.IsDir() || filepath.Ext(entry.Name()) != ".yaml" {
-			continue
-		}
+	m.defaults = data
+	return nil
+}
+
+// loadConfigs loads all configurations from the store
+func (m *Manager) loadConfigs() error {
+	names, err := m.store.List()
+	if err != nil {
+		return err
+	}
 
-		configFile := filepath.Join(configsDir, entry.Name())
-		config, err := m.loadConfig(configFile)
+	for _, name := range names {
+		config, err := m.loadConfig(name)
 		if err != nil {
 			// Log error but continue loading other configs
-			fmt.Printf("Warning: failed to load config %s: %v\n", entry.Name(), err)
+			fmt.Printf("Warning: failed to load config %s: %v\n", m.location(name), err)
 			continue
 		}
 
@@ -164,23 +308,157 @@ func (m *Manager) loadConfigs() error {
 	return nil
 }
 
-// loadConfig loads a single configuration file
-func (m *Manager) loadConfig(filePath string) (*Config, error) {
-	data, err := os.ReadFile(filePath)
+// loadConfig loads a single configuration from the store
+func (m *Manager) loadConfig(name string) (*Config, error) {
+	data, err := m.store.Load(name)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read config file: %w", err)
+		return nil, err
 	}
 
+	return m.decodeConfig(data)
+}
+
+// decodeConfig parses a configuration file's contents over the defaults
+func (m *Manager) decodeConfig(data []byte) (*Config, error) {
+	// Decode the defaults first so fields set in the tunnel file override
+	// them while fields it omits keep the default value
 	var config Config
+	if len(m.defaults) > 0 {
+		if err := yaml.Unmarshal(m.defaults, &config); err != nil {
+			return nil, fmt.Errorf("failed to apply %s: %w", DefaultsFile, err)
+		}
+	}
 	if err := yaml.Unmarshal(data, &config); err != nil {
 		return nil, fmt.Errorf("failed to parse config file: %w", err)
 	}
+	applyDefaults(&config)
 
 	return &config, nil
 }
 
-// SaveConfig saves a configuration to disk
-func (m *Manager) SaveConfig(config *Config) error {
+// Values applyDefaults gives fields a configuration leaves unset
+const (
+	DefaultSSHPort           = 22
+	DefaultKeepAliveInterval = 30
+	DefaultKeepAliveCountMax = 3
+	DefaultConnectTimeout    = 10
+	DefaultRestartSec        = 5
+)
+
+// applyDefaults fills in fields that are zero, so a hand-written file that
+// omits them still works: a zero keep-alive interval would otherwise turn
+// SSH keep-alives off
+func applyDefaults(config *Config) {
+	if config.CloudServer.Port == 0 {
+		config.CloudServer.Port = DefaultSSHPort
+	}
+	if config.Performance.KeepAliveInterval == 0 {
+		config.Performance.KeepAliveInterval = DefaultKeepAliveInterval
+	}
+	if config.Performance.KeepAliveCountMax == 0 {
+		config.Performance.KeepAliveCountMax = DefaultKeepAliveCountMax
+	}
+	if config.Performance.ConnectTimeout == 0 {
+		config.Performance.ConnectTimeout = DefaultConnectTimeout
+	}
+	if config.Service.RestartSec == 0 {
+		config.Service.RestartSec = DefaultRestartSec
+	}
+}
+
+// Validate checks a configuration for values SSH would reject
+func (c *Config) Validate() error {
+	if err := c.SSH.ValidateAlgorithms(); err != nil {
+		return err
+	}
+	if err := c.Notifications.ValidateFormat(); err != nil {
+		return err
+	}
+	if err := c.SSH.ValidateBindAddress(); err != nil {
+		return err
+	}
+	if err := c.LocalServer.ValidateRemoteForwards(); err != nil {
+		return err
+	}
+	return c.SSH.ValidateConfigFile()
+}
+
+// ValidateRemoteForwards checks that each remote forward has valid ports and
+// a local host, and opens a port on the cloud server that neither the
+// reverse port nor another remote forward does
+func (l *LocalServerConfig) ValidateRemoteForwards() error {
+	for i, forward := range l.RemoteForwards {
+		field := fmt.Sprintf("local_server.remote_forwards[%d]", i)
+		switch {
+		case forward.RemotePort < 1 || forward.RemotePort > 65535:
+			return fmt.Errorf("%s: remote_port %d must be from 1 to 65535", field, forward.RemotePort)
+		case forward.LocalPort < 1 || forward.LocalPort > 65535:
+			return fmt.Errorf("%s: local_port %d must be from 1 to 65535", field, forward.LocalPort)
+		case forward.LocalHost == "":
+			return fmt.Errorf("%s: local_host is required", field)
+		case forward.RemotePort == l.ReversePort:
+			return fmt.Errorf("%s: remote port %d is the tunnel's reverse port", field, forward.RemotePort)
+		}
+		for _, earlier := range l.RemoteForwards[:i] {
+			if earlier.BindAddr == forward.BindAddr && earlier.RemotePort == forward.RemotePort {
+				return fmt.Errorf("%s: remote port %d is already forwarded to %s:%d", field, forward.RemotePort, earlier.LocalHost, earlier.LocalPort)
+			}
+		}
+	}
+	return nil
+}
+
+// ValidateConfigFile checks that the SSH config file, if set, exists
+func (s *SSHConfig) ValidateConfigFile() error {
+	if s.ConfigFile == "" {
+		return nil
+	}
+
+	info, err := os.Stat(ExpandPath(s.ConfigFile))
+	if err != nil {
+		return fmt.Errorf("ssh.config_file: %w", err)
+	}
+	if info.IsDir() {
+		return fmt.Errorf("ssh.config_file: %s is a directory", s.ConfigFile)
+	}
+	return nil
+}
+
+// interfaceAddrs lists the machine's addresses; a variable so tests can
+// stand in their own
+var interfaceAddrs = net.InterfaceAddrs
+
+// ValidateBindAddress checks that the bind address, if set, is an IP
+// address assigned to one of this machine's interfaces
+func (s *SSHConfig) ValidateBindAddress() error {
+	if s.BindAddress == "" {
+		return nil
+	}
+
+	ip := net.ParseIP(s.BindAddress)
+	if ip == nil {
+		return fmt.Errorf("ssh.bind_address: %q is not an IP address", s.BindAddress)
+	}
+	addrs, err := interfaceAddrs()
+	if err != nil {
+		return fmt.Errorf("ssh.bind_address: failed to list local addresses: %w", err)
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.Equal(ip) {
+			return nil
+		}
+	}
+	return fmt.Errorf("ssh.bind_address: %s is not assigned to any local interface", s.BindAddress)
+}
+
+// SaveConfig saves a configuration to the store
+func (m *Manager) SaveConfig(config *Config) (err error) {
+	defer func() { m.audit.Log(audit.ActionConfigSave, config.TunnelName, nil, err) }()
+
+	if err := config.Validate(); err != nil {
+		return fmt.Errorf("invalid configuration '%s': %w", config.TunnelName, err)
+	}
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -189,25 +467,123 @@ func (m *Manager) SaveConfig(config *Config) error {
 		config.CreatedAt = config.UpdatedAt
 	}
 
-	// Ensure tunnels directory exists
-	tunnelsDir := filepath.Join(m.configPath, "tunnels")
-	if err := os.MkdirAll(tunnelsDir, 0755); err != nil {
-		return fmt.Errorf("failed to create tunnels directory: %w", err)
+	data, err := m.encodeOwnFields(config)
+	if err != nil {
+		return err
+	}
+	// The defaults are applied to the copy kept for use, as when loading,
+	// never to what is saved
+	loaded, err := m.decodeConfig(data)
+	if err != nil {
+		return err
+	}
+	if err := m.store.Save(config.TunnelName, data); err != nil {
+		return err
 	}
 
-	// Write config file
-	configFile := filepath.Join(tunnelsDir, config.TunnelName+".yaml")
-	data, err := yaml.Marshal(config)
+	m.configs[config.TunnelName] = loaded
+	return nil
+}
+
+// encodeOwnFields marshals the fields of a configuration that the tunnel
+// sets itself. Values equal to what the tunnel would inherit from
+// defaults.yaml or applyDefaults are left out unless its stored file already
+// sets them, so saving a loaded configuration does not copy the defaults
+// into its file and later changes to defaults.yaml still reach it.
+func (m *Manager) encodeOwnFields(config *Config) ([]byte, error) {
+	var doc yaml.Node
+	if err := doc.Encode(config); err != nil {
+		return nil, fmt.Errorf("failed to marshal config: %w", err)
+	}
+	// Zero values applyDefaults fills in are compared as filled in
+	runtime := *config
+	applyDefaults(&runtime)
+	var effective yaml.Node
+	if err := effective.Encode(&runtime); err != nil {
+		return nil, fmt.Errorf("failed to marshal config: %w", err)
+	}
+
+	inherited, err := m.decodeConfig(nil)
 	if err != nil {
-		return fmt.Errorf("failed to marshal config: %w", err)
+		return nil, err
+	}
+	var defaults yaml.Node
+	if err := defaults.Encode(inherited); err != nil {
+		return nil, fmt.Errorf("failed to marshal defaults: %w", err)
 	}
 
-	if err := os.WriteFile(configFile, data, 0600); err != nil {
-		return fmt.Errorf("failed to write config file: %w", err)
+	var stored yaml.Node
+	if data, err := m.store.Load(config.TunnelName); err == nil {
+		// A stored file that no longer parses sets nothing worth keeping
+		if yaml.Unmarshal(data, &stored) != nil || len(stored.Content) == 0 {
+			stored = yaml.Node{}
+		}
+	}
+	var set *yaml.Node
+	if len(stored.Content) > 0 {
+		set = stored.Content[0]
 	}
 
-	m.configs[config.TunnelName] = config
-	return nil
+	dropInherited(&doc, &effective, &defaults, set)
+	data, err := yaml.Marshal(&doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal config: %w", err)
+	}
+	return data, nil
+}
+
+// dropInherited removes the keys of mapping node whose values, as found in
+// effective, equal those in defaults, unless set, the mapping from the
+// stored file, has them. Sections left empty are removed too.
+func dropInherited(node, effective, defaults, set *yaml.Node) {
+	for i := 0; i+1 < len(node.Content); {
+		key, value := node.Content[i].Value, node.Content[i+1]
+		compared := value
+		if j := mappingIndex(effective, key); j >= 0 {
+			compared = effective.Content[j]
+		}
+		var inherited, own *yaml.Node
+		if j := mappingIndex(defaults, key); j >= 0 {
+			inherited = defaults.Content[j]
+		}
+		if set != nil {
+			if j := mappingIndex(set, key); j >= 0 {
+				own = set.Content[j]
+			}
+		}
+
+		drop := false
+		switch {
+		case inherited == nil:
+		case value.Kind == yaml.MappingNode && inherited.Kind == yaml.MappingNode:
+			if own != nil && own.Kind != yaml.MappingNode {
+				own = nil
+			}
+			dropInherited(value, compared, inherited, own)
+			drop = len(value.Content) == 0 && own == nil
+		default:
+			drop = own == nil && sameNode(compared, inherited)
+		}
+
+		if drop {
+			node.Content = append(node.Content[:i], node.Content[i+2:]...)
+			continue
+		}
+		i += 2
+	}
+}
+
+// sameNode reports whether two YAML nodes hold the same value
+func sameNode(a, b *yaml.Node) bool {
+	if a.Kind != b.Kind || a.Tag != b.Tag || a.Value != b.Value || len(a.Content) != len(b.Content) {
+		return false
+	}
+	for i := range a.Content {
+		if !sameNode(a.Content[i], b.Content[i]) {
+			return false
+		}
+	}
+	return true
 }
 
 // GetConfig retrieves a configuration by name
@@ -223,6 +599,80 @@ func (m *Manager) GetConfig(name string) (*Config, error) {
 	return config, nil
 }
 
+// ReloadConfig reads a tunnel's configuration from the store again,
+// replacing the loaded configuration, so changes made to its file since the
+// manager was created take effect. If it no longer parses or validates, the
+// loaded configuration is kept and the error returned.
+func (m *Manager) ReloadConfig(name string) (*Config, error) {
+	m.mu.RLock()
+	config, err := m.loadConfig(name)
+	m.mu.RUnlock()
+	if err != nil {
+		return nil, fmt.Errorf("failed to reload configuration '%s': %w", name, err)
+	}
+	if config.TunnelName != name {
+		return nil, fmt.Errorf("failed to reload configuration '%s': file names tunnel '%s'", name, config.TunnelName)
+	}
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration '%s': %w", name, err)
+	}
+
+	m.mu.Lock()
+	m.configs[name] = config
+	m.mu.Unlock()
+	return config, nil
+}
+
+// Reload reads the defaults and every configuration again, from the
+// store, replacing the loaded ones. Unlike
+// loading at startup, a configuration that fails to load or validate is an
+// error: nothing is replaced, so a half-edited file cannot make tunnels
+// disappear.
+func (m *Manager) Reload() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	defaults := m.defaults
+	m.defaults = nil
+	if err := m.loadDefaults(); err != nil {
+		m.defaults = defaults
+		return fmt.Errorf("failed to load defaults: %w", err)
+	}
+
+	configs, err := m.readAllConfigs()
+	if err != nil {
+		m.defaults = defaults
+		return err
+	}
+
+	m.configs = make(map[string]*Config, len(configs))
+	for _, config := range configs {
+		m.configs[config.TunnelName] = config
+	}
+	return nil
+}
+
+// readAllConfigs loads and validates every configuration for Reload
+func (m *Manager) readAllConfigs() ([]*Config, error) {
+	names, err := m.store.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var configs []*Config
+	for _, name := range names {
+		config, err := m.loadConfig(name)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", m.location(name), err)
+		}
+		if err := config.Validate(); err != nil {
+			return nil, fmt.Errorf("%s: invalid configuration '%s': %w", m.location(name), config.TunnelName, err)
+		}
+		configs = append(configs, config)
+	}
+	return configs, nil
+}
+
 // ListConfigs returns all configuration names
 func (m *Manager) ListConfigs() []string {
 	m.mu.RLock()
@@ -236,8 +686,39 @@ func (m *Manager) ListConfigs() []string {
 	return names
 }
 
+// HasTag reports whether the configuration carries the given tag
+func (c *Config) HasTag(tag string) bool {
+	for _, t := range c.Tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchesTags reports whether the configuration matches all of the filters.
+// Each filter may list alternatives separated by commas, so
+// []string{"prod", "eu,us"} means prod AND (eu OR us).
+func (c *Config) MatchesTags(filters []string) bool {
+	for _, filter := range filters {
+		matched := false
+		for _, tag := range strings.Split(filter, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" && c.HasTag(tag) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
 // DeleteConfig removes a configuration
-func (m *Manager) DeleteConfig(name string) error {
+func (m *Manager) DeleteConfig(name string) (err error) {
+	defer func() { m.audit.Log(audit.ActionConfigDelete, name, nil, err) }()
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -245,13 +726,49 @@ func (m *Manager) DeleteConfig(name string) error {
 		return fmt.Errorf("configuration '%s' not found", name)
 	}
 
-	// Remove config file
-	configFile := filepath.Join(m.configPath, "tunnels", name+".yaml")
-	if err := os.Remove(configFile); err != nil && !os.IsNotExist(err) {
-		return fmt.Errorf("failed to remove config file: %w", err)
+	if err := m.store.Delete(name); err != nil {
+		return err
 	}
-
 	delete(m.configs, name)
+
+	// Don't leave the active marker pointing at the deleted configuration
+	if m.activeName() == name {
+		if err := m.clearActiveConfig(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ErrNoActiveConfig is returned by GetActiveConfig when no configuration is
+// active
+var ErrNoActiveConfig = errors.New("no active configuration set")
+
+// activeConfigFile is the file in the config directory naming the active
+// configuration
+const activeConfigFile = "active"
+
+// activeName returns the name of the active configuration, reading the
+// marker file if it has not been loaded yet, or "" if none is set. It is
+// called with m.mu held for writing.
+func (m *Manager) activeName() string {
+	if m.activeConfig == "" {
+		data, err := os.ReadFile(filepath.Join(m.configPath, activeConfigFile))
+		if err == nil {
+			m.activeConfig = strings.TrimSpace(string(data))
+		}
+	}
+	return m.activeConfig
+}
+
+// clearActiveConfig removes the active marker. It is called with m.mu held
+// for writing.
+func (m *Manager) clearActiveConfig() error {
+	m.activeConfig = ""
+	if err := os.Remove(filepath.Join(m.configPath, activeConfigFile)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to clear active config: %w", err)
+	}
 	return nil
 }
 
@@ -267,31 +784,27 @@ func (m *Manager) SetActiveConfig(name string) error {
 	m.activeConfig = name
 
 	// Save active config to file
-	activeConfigFile := filepath.Join(m.configPath, "active")
-	return os.WriteFile(activeConfigFile, []byte(name), 0644)
+	return os.WriteFile(filepath.Join(m.configPath, activeConfigFile), []byte(name), 0644)
 }
 
-// GetActiveConfig returns the active configuration
+// GetActiveConfig returns the active configuration. A marker left pointing
+// at a configuration that no longer exists is cleared, and reported as
+// ErrNoActiveConfig.
 func (m *Manager) GetActiveConfig() (*Config, error) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-	if m.activeConfig == "" {
-		// Try to load from file
-		activeConfigFile := filepath.Join(m.configPath, "active")
-		data, err := os.ReadFile(activeConfigFile)
-		if err != nil {
-			if os.IsNotExist(err) {
-				return nil, fmt.Errorf("no active configuration set")
-			}
-			return nil, fmt.Errorf("failed to read active config: %w", err)
-		}
-		m.activeConfig = string(data)
+	name := m.activeName()
+	if name == "" {
+		return nil, ErrNoActiveConfig
 	}
 
-	config, exists := m.configs[m.activeConfig]
+	config, exists := m.configs[name]
 	if !exists {
-		return nil, fmt.Errorf("active configuration '%s' not found", m.activeConfig)
+		if err := m.clearActiveConfig(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: active configuration '%s' no longer exists", ErrNoActiveConfig, name)
 	}
 
 	return config, nil
@@ -301,3 +814,17 @@ func (m *Manager) GetActiveConfig() (*Config, error) {
 func (m *Manager) GetConfigPath() string {
 	return m.configPath
 }
+
+// Audit returns the logger for the audit log in the configuration directory
+func (m *Manager) Audit() *audit.Logger {
+	return m.audit
+}
+
+// ExpandPath expands a leading ~ in a path to the user's home directory
+func ExpandPath(path string) string {
+	expanded, err := homedir.Expand(path)
+	if err != nil {
+		return path
+	}
+	return expanded
+}
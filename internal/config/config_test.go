@@ -1,6 +1,7 @@
 package config
 
 import (
+	"net"
 	"os"
 	"path/filepath"
 	"testing"
@@ -104,6 +105,158 @@ func TestListConfigs(t *testing.T) {
 	assert.Contains(t, configs, "tunnel2")
 }
 
+func TestReloadConfig(t *testing.T) {
+	tempDir := t.TempDir()
+	manager, err := NewManager(tempDir)
+	require.NoError(t, err)
+	require.NoError(t, manager.SaveConfig(&Config{TunnelName: "home", CreatedAt: time.Now()}))
+
+	// Edit the file behind the manager's back
+	path := filepath.Join(tempDir, "tunnels", "home.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("tunnel_name: home\ncloud_server:\n  ip: 203.0.113.5\n"), 0600))
+	reloaded, err := manager.ReloadConfig("home")
+	require.NoError(t, err)
+	assert.Equal(t, "203.0.113.5", reloaded.CloudServer.IP)
+	loaded, err := manager.GetConfig("home")
+	require.NoError(t, err)
+	assert.Equal(t, "203.0.113.5", loaded.CloudServer.IP)
+
+	// A broken file keeps the loaded configuration
+	require.NoError(t, os.WriteFile(path, []byte("tunnel_name: [\n"), 0600))
+	_, err = manager.ReloadConfig("home")
+	assert.Error(t, err)
+	loaded, err = manager.GetConfig("home")
+	require.NoError(t, err)
+	assert.Equal(t, "203.0.113.5", loaded.CloudServer.IP)
+}
+
+func TestProfileSurvivesReload(t *testing.T) {
+	tempDir := t.TempDir()
+	manager, err := NewManager(tempDir)
+	require.NoError(t, err)
+	require.NoError(t, manager.SaveConfig(&Config{TunnelName: "home-nas", Profile: "home"}))
+
+	reloaded, err := NewManager(tempDir)
+	require.NoError(t, err)
+	loaded, err := reloaded.GetConfig("home-nas")
+	require.NoError(t, err)
+	assert.Equal(t, "home", loaded.Profile)
+}
+
+func TestMatchesTags(t *testing.T) {
+	config := &Config{TunnelName: "db", Tags: []string{"prod", "eu", "Database"}}
+
+	tests := []struct {
+		name    string
+		filters []string
+		want    bool
+	}{
+		{"no filters", nil, true},
+		{"single tag", []string{"prod"}, true},
+		{"case insensitive", []string{"database"}, true},
+		{"and all present", []string{"prod", "eu"}, true},
+		{"and one missing", []string{"prod", "us"}, false},
+		{"or one present", []string{"us,eu"}, true},
+		{"or none present", []string{"us,asia"}, false},
+		{"and of ors", []string{"staging,prod", "us, eu"}, true},
+		{"and of ors failing", []string{"staging,prod", "us,asia"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, config.MatchesTags(tt.filters))
+		})
+	}
+}
+
+func TestDefaultsMergedUnderConfig(t *testing.T) {
+	tempDir := t.TempDir()
+
+	defaults := `cloud_server:
+  ip: 203.0.113.10
+  user: tunnel
+ssh:
+  ciphers: aes256-ctr
+performance:
+  keep_alive_interval: 30
+  keep_alive_count_max: 3
+`
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, DefaultsFile), []byte(defaults), 0600))
+
+	tunnelsDir := filepath.Join(tempDir, "tunnels")
+	require.NoError(t, os.MkdirAll(tunnelsDir, 0755))
+	tunnel := `tunnel_name: home
+cloud_server:
+  port: 2200
+  user: home-user
+local_server:
+  reverse_port: 2222
+performance:
+  keep_alive_interval: 60
+`
+	require.NoError(t, os.WriteFile(filepath.Join(tunnelsDir, "home.yaml"), []byte(tunnel), 0600))
+
+	manager, err := NewManager(tempDir)
+	require.NoError(t, err)
+
+	config, err := manager.GetConfig("home")
+	require.NoError(t, err)
+
+	// Fields only in defaults are filled in
+	assert.Equal(t, "203.0.113.10", config.CloudServer.IP)
+	assert.Equal(t, "aes256-ctr", config.SSH.Ciphers)
+	assert.Equal(t, 3, config.Performance.KeepAliveCountMax)
+
+	// Fields set by the tunnel override the defaults
+	assert.Equal(t, "home-user", config.CloudServer.User)
+	assert.Equal(t, 2200, config.CloudServer.Port)
+	assert.Equal(t, 60, config.Performance.KeepAliveInterval)
+}
+
+func TestSaveConfigKeepsDefaultsOutOfTunnelFile(t *testing.T) {
+	tempDir := t.TempDir()
+	defaults := "cloud_server:\n  ip: 203.0.113.10\nssh:\n  ciphers: aes256-ctr\n"
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, DefaultsFile), []byte(defaults), 0600))
+	tunnelsDir := filepath.Join(tempDir, "tunnels")
+	require.NoError(t, os.MkdirAll(tunnelsDir, 0755))
+	tunnel := "tunnel_name: home\ncloud_server:\n  user: home-user\nssh:\n  ciphers: aes256-ctr\n"
+	require.NoError(t, os.WriteFile(filepath.Join(tunnelsDir, "home.yaml"), []byte(tunnel), 0600))
+
+	manager, err := NewManager(tempDir)
+	require.NoError(t, err)
+	config, err := manager.GetConfig("home")
+	require.NoError(t, err)
+	config.LocalServer.ReversePort = 2222
+	require.NoError(t, manager.SaveConfig(config))
+
+	data, err := os.ReadFile(filepath.Join(tunnelsDir, "home.yaml"))
+	require.NoError(t, err)
+	saved := string(data)
+	assert.Contains(t, saved, "reverse_port: 2222")
+	assert.Contains(t, saved, "user: home-user")
+	assert.Contains(t, saved, "ciphers: aes256-ctr", "fields the file set are kept even when they match the defaults")
+	assert.NotContains(t, saved, "203.0.113.10")
+	assert.NotContains(t, saved, "keep_alive_interval")
+
+	// A changed default reaches the saved tunnel
+	defaults = "cloud_server:\n  ip: 198.51.100.7\n"
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, DefaultsFile), []byte(defaults), 0600))
+	require.NoError(t, manager.Reload())
+	config, err = manager.GetConfig("home")
+	require.NoError(t, err)
+	assert.Equal(t, "198.51.100.7", config.CloudServer.IP)
+	assert.Equal(t, 2222, config.LocalServer.ReversePort)
+	assert.Equal(t, DefaultKeepAliveInterval, config.Performance.KeepAliveInterval)
+}
+
+func TestInvalidDefaults(t *testing.T) {
+	tempDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, DefaultsFile), []byte("cloud_server: [not, a, map]\n"), 0600))
+
+	_, err := NewManager(tempDir)
+	assert.Error(t, err)
+}
+
 func TestDeleteConfig(t *testing.T) {
 	tempDir := t.TempDir()
 	manager, err := NewManager(tempDir)
@@ -164,6 +317,48 @@ func TestActiveConfig(t *testing.T) {
 	assert.Equal(t, "test-tunnel", string(content))
 }
 
+func TestDeletingActiveConfigClearsMarker(t *testing.T) {
+	tempDir := t.TempDir()
+	manager, err := NewManager(tempDir)
+	require.NoError(t, err)
+
+	require.NoError(t, manager.SaveConfig(&Config{TunnelName: "home"}))
+	require.NoError(t, manager.SaveConfig(&Config{TunnelName: "work"}))
+	require.NoError(t, manager.SetActiveConfig("home"))
+
+	// Deleting another tunnel keeps the marker
+	require.NoError(t, manager.DeleteConfig("work"))
+	activeConfig, err := manager.GetActiveConfig()
+	require.NoError(t, err)
+	assert.Equal(t, "home", activeConfig.TunnelName)
+
+	require.NoError(t, manager.DeleteConfig("home"))
+	assert.NoFileExists(t, filepath.Join(tempDir, "active"))
+
+	_, err = manager.GetActiveConfig()
+	assert.ErrorIs(t, err, ErrNoActiveConfig)
+
+	// A fresh process sees no marker either
+	reloaded, err := NewManager(tempDir)
+	require.NoError(t, err)
+	_, err = reloaded.GetActiveConfig()
+	assert.ErrorIs(t, err, ErrNoActiveConfig)
+}
+
+func TestStaleActiveMarkerSelfHeals(t *testing.T) {
+	tempDir := t.TempDir()
+	activeFile := filepath.Join(tempDir, "active")
+	require.NoError(t, os.WriteFile(activeFile, []byte("removed-by-hand\n"), 0644))
+
+	manager, err := NewManager(tempDir)
+	require.NoError(t, err)
+
+	_, err = manager.GetActiveConfig()
+	require.ErrorIs(t, err, ErrNoActiveConfig)
+	assert.Contains(t, err.Error(), "removed-by-hand")
+	assert.NoFileExists(t, activeFile)
+}
+
 func TestGetConfigNotFound(t *testing.T) {
 	tempDir := t.TempDir()
 	manager, err := NewManager(tempDir)
@@ -183,3 +378,122 @@ func TestDeleteConfigNotFound(t *testing.T) {
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "not found")
 }
+
+func TestValidateConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "ssh_config")
+	require.NoError(t, os.WriteFile(file, []byte("Host *\n"), 0600))
+
+	assert.NoError(t, (&SSHConfig{}).ValidateConfigFile())
+	assert.NoError(t, (&SSHConfig{ConfigFile: file}).ValidateConfigFile())
+
+	err := (&SSHConfig{ConfigFile: filepath.Join(dir, "missing")}).ValidateConfigFile()
+	assert.ErrorContains(t, err, "ssh.config_file")
+	assert.ErrorContains(t, (&SSHConfig{ConfigFile: dir}).ValidateConfigFile(), "is a directory")
+}
+
+func TestValidateBindAddress(t *testing.T) {
+	saved := interfaceAddrs
+	defer func() { interfaceAddrs = saved }()
+	interfaceAddrs = func() ([]net.Addr, error) {
+		return []net.Addr{
+			&net.IPNet{IP: net.ParseIP("127.0.0.1"), Mask: net.CIDRMask(8, 32)},
+			&net.IPNet{IP: net.ParseIP("192.0.2.7"), Mask: net.CIDRMask(24, 32)},
+			&net.IPNet{IP: net.ParseIP("2001:db8::7"), Mask: net.CIDRMask(64, 128)},
+		}, nil
+	}
+
+	assert.NoError(t, (&SSHConfig{}).ValidateBindAddress())
+	assert.NoError(t, (&SSHConfig{BindAddress: "192.0.2.7"}).ValidateBindAddress())
+	assert.NoError(t, (&SSHConfig{BindAddress: "2001:db8::7"}).ValidateBindAddress())
+	assert.EqualError(t, (&SSHConfig{BindAddress: "192.0.2.8"}).ValidateBindAddress(),
+		"ssh.bind_address: 192.0.2.8 is not assigned to any local interface")
+	assert.ErrorContains(t, (&SSHConfig{BindAddress: "eth0"}).ValidateBindAddress(), "not an IP address")
+
+	cfg := &Config{TunnelName: "multihomed", SSH: SSHConfig{BindAddress: "198.51.100.1"}}
+	assert.ErrorContains(t, cfg.Validate(), "ssh.bind_address")
+}
+
+func TestLoadSettings(t *testing.T) {
+	dir := t.TempDir()
+
+	settings, err := LoadSettings(dir)
+	require.NoError(t, err)
+	assert.False(t, settings.Backup.Enabled())
+	assert.Equal(t, DefaultBackupKeep, settings.Backup.KeepCount())
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, SettingsFile), []byte("backup:\n  interval: 24h\n  keep: 5\n"), 0600))
+	settings, err = LoadSettings(dir)
+	require.NoError(t, err)
+	assert.True(t, settings.Backup.Enabled())
+	assert.Equal(t, 24*time.Hour, settings.Backup.Interval)
+	assert.Equal(t, 5, settings.Backup.KeepCount())
+}
+
+func TestReloadKeepsConfigsOnError(t *testing.T) {
+	tempDir := t.TempDir()
+	manager, err := NewManager(tempDir)
+	require.NoError(t, err)
+	require.NoError(t, manager.SaveConfig(&Config{TunnelName: "home", CreatedAt: time.Now()}))
+	require.NoError(t, manager.SaveConfig(&Config{TunnelName: "office", CreatedAt: time.Now()}))
+
+	// Changed, added and removed files are all picked up
+	tunnelsDir := filepath.Join(tempDir, "tunnels")
+	require.NoError(t, os.WriteFile(filepath.Join(tunnelsDir, "home.yaml"), []byte("tunnel_name: home\ncloud_server:\n  ip: 203.0.113.5\n"), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(tunnelsDir, "lab.yaml"), []byte("tunnel_name: lab\n"), 0600))
+	require.NoError(t, os.Remove(filepath.Join(tunnelsDir, "office.yaml")))
+	require.NoError(t, manager.Reload())
+	assert.ElementsMatch(t, []string{"home", "lab"}, manager.ListConfigs())
+	home, err := manager.GetConfig("home")
+	require.NoError(t, err)
+	assert.Equal(t, "203.0.113.5", home.CloudServer.IP)
+
+	// A broken file fails the reload and changes nothing
+	require.NoError(t, os.WriteFile(filepath.Join(tunnelsDir, "lab.yaml"), []byte("tunnel_name: [\n"), 0600))
+	assert.ErrorContains(t, manager.Reload(), "lab.yaml")
+	assert.ElementsMatch(t, []string{"home", "lab"}, manager.ListConfigs())
+}
+
+func TestLoadMinimalConfigAppliesDefaults(t *testing.T) {
+	tempDir := t.TempDir()
+	tunnelsDir := filepath.Join(tempDir, "tunnels")
+	require.NoError(t, os.MkdirAll(tunnelsDir, 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(tunnelsDir, "minimal.yaml"), []byte(`tunnel_name: minimal
+cloud_server:
+  ip: 203.0.113.5
+  user: tunnel
+performance:
+  connect_timeout: 20
+`), 0600))
+
+	manager, err := NewManager(tempDir)
+	require.NoError(t, err)
+	cfg, err := manager.GetConfig("minimal")
+	require.NoError(t, err)
+
+	assert.Equal(t, DefaultSSHPort, cfg.CloudServer.Port)
+	assert.Equal(t, DefaultKeepAliveInterval, cfg.Performance.KeepAliveInterval)
+	assert.Equal(t, DefaultKeepAliveCountMax, cfg.Performance.KeepAliveCountMax)
+	assert.Equal(t, 20, cfg.Performance.ConnectTimeout, "set fields are kept")
+	assert.Equal(t, DefaultRestartSec, cfg.Service.RestartSec)
+}
+
+func TestSaveConfigAppliesDefaultsOnlyAtRuntime(t *testing.T) {
+	tempDir := t.TempDir()
+	manager, err := NewManager(tempDir)
+	require.NoError(t, err)
+
+	cfg := &Config{TunnelName: "minimal", CloudServer: CloudServerConfig{IP: "203.0.113.5"}}
+	require.NoError(t, manager.SaveConfig(cfg))
+	assert.Zero(t, cfg.Performance.KeepAliveInterval, "the saved config is left as given")
+
+	loaded, err := manager.GetConfig("minimal")
+	require.NoError(t, err)
+	assert.Equal(t, DefaultSSHPort, loaded.CloudServer.Port)
+	assert.Equal(t, DefaultKeepAliveInterval, loaded.Performance.KeepAliveInterval)
+
+	data, err := os.ReadFile(filepath.Join(tempDir, "tunnels", "minimal.yaml"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "keep_alive_interval")
+	assert.NotContains(t, string(data), "restart_sec")
+}
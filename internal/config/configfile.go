@@ -0,0 +1,185 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// UseConfigFile switches the manager to single-file mode: tunnel
+// configurations are read from the file at path, one per YAML document, in
+// place of the tunnels directory, and saving or deleting a configuration
+// rewrites the file. With a cipher the file is decrypted in memory on load
+// and encrypted again on save, so its plaintext is never written to disk. A
+// missing file starts out empty.
+func (m *Manager) UseConfigFile(path string, cipher Cipher) error {
+	return m.UseStore(&configFileStore{path: path, cipher: cipher})
+}
+
+// configFileStore keeps every tunnel as one document of a single YAML file,
+// encrypted with cipher if that is set. Each change rewrites the file.
+type configFileStore struct {
+	path   string
+	cipher Cipher
+}
+
+// Path returns the file holding a tunnel, the same for all of them
+func (s *configFileStore) Path(string) string {
+	return s.path
+}
+
+func (s *configFileStore) Load(name string) ([]byte, error) {
+	docs, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	data, exists := docs[name]
+	if !exists {
+		return nil, fmt.Errorf("%s no longer holds tunnel '%s': %w", s.path, name, fs.ErrNotExist)
+	}
+	return data, nil
+}
+
+func (s *configFileStore) Save(name string, data []byte) error {
+	docs, err := s.read()
+	if err != nil {
+		return err
+	}
+	docs[name] = data
+	return s.write(docs)
+}
+
+func (s *configFileStore) Delete(name string) error {
+	docs, err := s.read()
+	if err != nil {
+		return err
+	}
+	if _, exists := docs[name]; !exists {
+		return nil
+	}
+	delete(docs, name)
+	return s.write(docs)
+}
+
+func (s *configFileStore) List() ([]string, error) {
+	docs, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(docs))
+	for name := range docs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// read splits the config file into its documents, keyed by the tunnel each
+// names
+func (s *configFileStore) read() (map[string][]byte, error) {
+	docs := make(map[string][]byte)
+
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return docs, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	if s.cipher != nil {
+		if data, err = s.cipher.Decrypt(data); err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", s.path, err)
+		}
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	for doc := 1; ; doc++ {
+		var node yaml.Node
+		if err := decoder.Decode(&node); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("failed to read %s: document %d: %w", s.path, doc, err)
+		}
+		if len(node.Content) == 0 || node.Content[0].Tag == "!!null" {
+			continue // empty document, e.g. a trailing "---"
+		}
+
+		var named struct {
+			TunnelName string `yaml:"tunnel_name"`
+		}
+		if err := node.Decode(&named); err != nil {
+			return nil, fmt.Errorf("failed to read %s: document %d: %w", s.path, doc, err)
+		}
+		if err := checkTunnelName(named.TunnelName); err != nil {
+			return nil, fmt.Errorf("failed to read %s: document %d: %w", s.path, doc, err)
+		}
+		if _, seen := docs[named.TunnelName]; seen {
+			return nil, fmt.Errorf("failed to read %s: document %d: tunnel '%s' appears more than once", s.path, doc, named.TunnelName)
+		}
+
+		if docs[named.TunnelName], err = yaml.Marshal(&node); err != nil {
+			return nil, fmt.Errorf("failed to read %s: document %d: %w", s.path, doc, err)
+		}
+	}
+	return docs, nil
+}
+
+// write replaces the config file with the documents, sorted by tunnel name
+func (s *configFileStore) write(docs map[string][]byte) error {
+	names := make([]string, 0, len(docs))
+	for name := range docs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	for _, name := range names {
+		var node yaml.Node
+		if err := yaml.Unmarshal(docs[name], &node); err != nil {
+			return fmt.Errorf("failed to marshal config '%s': %w", name, err)
+		}
+		if err := encoder.Encode(&node); err != nil {
+			return fmt.Errorf("failed to write config '%s': %w", name, err)
+		}
+	}
+	if err := encoder.Close(); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+
+	data := buf.Bytes()
+	if s.cipher != nil {
+		var err error
+		if data, err = s.cipher.Encrypt(data); err != nil {
+			return fmt.Errorf("failed to write %s: %w", s.path, err)
+		}
+	}
+
+	// Write beside the file and rename, so an interrupted save leaves the
+	// old file intact
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), "."+filepath.Base(s.path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	return nil
+}
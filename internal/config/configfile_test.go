@@ -0,0 +1,106 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const encryptedConfigs = `tunnel_name: home
+cloud_server:
+  ip: 203.0.113.1
+  port: 2200
+  user: ubuntu
+local_server:
+  reverse_port: 2222
+---
+tunnel_name: office
+cloud_server:
+  ip: 203.0.113.2
+local_server:
+  reverse_port: 2223
+`
+
+// newAgeIdentity writes a fresh age identity file and returns its path
+func newAgeIdentity(t *testing.T) string {
+	t.Helper()
+
+	identity, err := age.GenerateX25519Identity()
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "key.txt")
+	require.NoError(t, os.WriteFile(path, []byte(identity.String()+"\n"), 0600))
+	return path
+}
+
+func TestEncryptedConfigFileRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "tunnels.yaml.age")
+	cipher, err := CipherForFile(path, newAgeIdentity(t))
+	require.NoError(t, err)
+	ciphertext, err := cipher.Encrypt([]byte(encryptedConfigs))
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, ciphertext, 0600))
+
+	manager, err := NewManager(t.TempDir())
+	require.NoError(t, err)
+	require.NoError(t, manager.UseConfigFile(path, cipher))
+	assert.ElementsMatch(t, []string{"home", "office"}, manager.ListConfigs())
+	home, err := manager.GetConfig("home")
+	require.NoError(t, err)
+	assert.Equal(t, "203.0.113.1", home.CloudServer.IP)
+	assert.Equal(t, 2200, home.CloudServer.Port)
+	assert.Equal(t, "ubuntu", home.CloudServer.User)
+	assert.Equal(t, 2222, home.LocalServer.ReversePort)
+
+	// Saving and deleting re-encrypt the file, and write nothing else
+	home.CloudServer.IP = "198.51.100.9"
+	require.NoError(t, manager.SaveConfig(home))
+	require.NoError(t, manager.DeleteConfig("office"))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.False(t, bytes.Contains(data, []byte("198.51.100.9")), "the file must stay encrypted")
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	reloaded, err := NewManager(t.TempDir())
+	require.NoError(t, err)
+	require.NoError(t, reloaded.UseConfigFile(path, cipher))
+	assert.Equal(t, []string{"home"}, reloaded.ListConfigs())
+	home, err = reloaded.GetConfig("home")
+	require.NoError(t, err)
+	assert.Equal(t, "198.51.100.9", home.CloudServer.IP)
+}
+
+func TestEncryptedConfigFileWrongIdentity(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tunnels.yaml.age")
+	cipher, err := CipherForFile(path, newAgeIdentity(t))
+	require.NoError(t, err)
+	ciphertext, err := cipher.Encrypt([]byte(encryptedConfigs))
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, ciphertext, 0600))
+
+	other, err := CipherForFile(path, newAgeIdentity(t))
+	require.NoError(t, err)
+	manager, err := NewManager(t.TempDir())
+	require.NoError(t, err)
+	assert.ErrorContains(t, manager.UseConfigFile(path, other), "failed to decrypt")
+}
+
+func TestCipherForFile(t *testing.T) {
+	cipher, err := CipherForFile("tunnels.yaml", "")
+	require.NoError(t, err)
+	assert.Nil(t, cipher)
+
+	_, err = CipherForFile("tunnels.yaml.age", "")
+	assert.ErrorContains(t, err, "identity file is required")
+
+	cipher, err = CipherForFile("tunnels.yaml.asc", "ops@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, &GPGCipher{Recipient: "ops@example.com", Armor: true}, cipher)
+}
@@ -0,0 +1,148 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// diffIgnoredFields are top-level fields left out of configuration diffs
+var diffIgnoredFields = []string{"created_at", "updated_at"}
+
+// FieldDiff is a single differing field between two configurations. Old or
+// New is nil when the field is only present on one side.
+type FieldDiff struct {
+	Path string
+	Old  interface{}
+	New  interface{}
+}
+
+// DiffConfigs compares two configurations field by field, using their YAML
+// keys as paths (e.g. "cloud_server.ip"). Timestamps are ignored and the
+// result is sorted by path.
+func DiffConfigs(a, b *Config) ([]FieldDiff, error) {
+	left, err := flattenConfig(a)
+	if err != nil {
+		return nil, err
+	}
+	right, err := flattenConfig(b)
+	if err != nil {
+		return nil, err
+	}
+
+	var diffs []FieldDiff
+	for path, oldValue := range left {
+		newValue, ok := right[path]
+		if !ok {
+			diffs = append(diffs, FieldDiff{Path: path, Old: oldValue})
+			continue
+		}
+		if !reflect.DeepEqual(oldValue, newValue) {
+			diffs = append(diffs, FieldDiff{Path: path, Old: oldValue, New: newValue})
+		}
+	}
+	for path, newValue := range right {
+		if _, ok := left[path]; !ok {
+			diffs = append(diffs, FieldDiff{Path: path, New: newValue})
+		}
+	}
+
+	sort.Slice(diffs, func(i, j int) bool { return diffs[i].Path < diffs[j].Path })
+	return diffs, nil
+}
+
+// Hash returns a digest of the configuration's content, as loaded with the
+// defaults applied. Timestamps are left out, so a file saved again without
+// changes hashes the same, and tunnels need only be restarted when the hash
+// differs.
+func (c *Config) Hash() (string, error) {
+	content := *c
+	content.CreatedAt = time.Time{}
+	content.UpdatedAt = time.Time{}
+
+	data, err := yaml.Marshal(&content)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal config: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// SameContent reports whether two configurations hash the same. A
+// configuration that cannot be hashed is taken to differ.
+func SameContent(a, b *Config) bool {
+	hashA, err := a.Hash()
+	if err != nil {
+		return false
+	}
+	hashB, err := b.Hash()
+	return err == nil && hashA == hashB
+}
+
+// ReadConfigFile reads a single tunnel configuration file, such as a copy
+// kept in a backup
+func ReadConfigFile(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	return ParseConfig(data)
+}
+
+// ParseConfig parses a tunnel configuration document as stored, without the
+// shared defaults
+func ParseConfig(data []byte) (*Config, error) {
+	var config Config
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+
+	return &config, nil
+}
+
+// flattenConfig converts a configuration into a map of dotted YAML paths to
+// scalar values, so key order never shows up as a difference
+func flattenConfig(config *Config) (map[string]interface{}, error) {
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal config: %w", err)
+	}
+
+	var tree map[string]interface{}
+	if err := yaml.Unmarshal(data, &tree); err != nil {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+	for _, field := range diffIgnoredFields {
+		delete(tree, field)
+	}
+
+	flat := make(map[string]interface{})
+	flattenValue("", tree, flat)
+	return flat, nil
+}
+
+// flattenValue walks a decoded YAML value, recording each leaf under its path
+func flattenValue(prefix string, value interface{}, flat map[string]interface{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			path := key
+			if prefix != "" {
+				path = prefix + "." + key
+			}
+			flattenValue(path, child, flat)
+		}
+	case []interface{}:
+		for i, child := range v {
+			flattenValue(fmt.Sprintf("%s[%d]", prefix, i), child, flat)
+		}
+	default:
+		flat[prefix] = v
+	}
+}
@@ -0,0 +1,90 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestDiffConfigsOnlyChangedFields(t *testing.T) {
+	a := &Config{
+		TunnelName:  "home",
+		CloudServer: CloudServerConfig{IP: "203.0.113.1", Port: 22, User: "tunnel"},
+		LocalServer: LocalServerConfig{User: "pi", ReversePort: 2222},
+		SSH:         SSHConfig{PrivateKeyPath: "~/.ssh/key", Ciphers: "aes256-ctr"},
+		Tags:        []string{"prod"},
+		CreatedAt:   time.Now().Add(-time.Hour),
+		UpdatedAt:   time.Now().Add(-time.Hour),
+	}
+	b := *a
+	b.TunnelName = "office"
+	b.CloudServer.IP = "203.0.113.2"
+	b.SSH.Ciphers = ""
+	b.Tags = []string{"prod", "eu"}
+	b.CreatedAt = time.Now()
+	b.UpdatedAt = time.Now()
+
+	diffs, err := DiffConfigs(a, &b)
+	require.NoError(t, err)
+
+	assert.Equal(t, []FieldDiff{
+		{Path: "cloud_server.ip", Old: "203.0.113.1", New: "203.0.113.2"},
+		{Path: "ssh.ciphers", Old: "aes256-ctr"},
+		{Path: "tags[1]", New: "eu"},
+		{Path: "tunnel_name", Old: "home", New: "office"},
+	}, diffs)
+}
+
+func TestDiffConfigsIdentical(t *testing.T) {
+	a := &Config{TunnelName: "home", CreatedAt: time.Now()}
+	b := &Config{TunnelName: "home"}
+
+	diffs, err := DiffConfigs(a, b)
+	require.NoError(t, err)
+	assert.Empty(t, diffs)
+}
+
+func TestReadConfigFile(t *testing.T) {
+	config := &Config{TunnelName: "home", CloudServer: CloudServerConfig{IP: "203.0.113.1"}}
+	data, err := yaml.Marshal(config)
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "home.yaml")
+	require.NoError(t, os.WriteFile(path, data, 0600))
+
+	loaded, err := ReadConfigFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "203.0.113.1", loaded.CloudServer.IP)
+}
+
+func TestConfigHashIgnoresTimestamps(t *testing.T) {
+	manager, err := NewManager(t.TempDir())
+	require.NoError(t, err)
+	cfg := &Config{TunnelName: "home", CloudServer: CloudServerConfig{IP: "203.0.113.1"}}
+	require.NoError(t, manager.SaveConfig(cfg))
+	before, err := manager.GetConfig("home")
+	require.NoError(t, err)
+	hash, err := before.Hash()
+	require.NoError(t, err)
+
+	// Saved again unchanged: only updated_at moves
+	time.Sleep(10 * time.Millisecond)
+	resaved := *before
+	require.NoError(t, manager.SaveConfig(&resaved))
+	reloaded, err := manager.ReloadConfig("home")
+	require.NoError(t, err)
+	assert.NotEqual(t, before.UpdatedAt, reloaded.UpdatedAt)
+	assert.True(t, SameContent(before, reloaded))
+	again, err := reloaded.Hash()
+	require.NoError(t, err)
+	assert.Equal(t, hash, again)
+
+	changed := *reloaded
+	changed.CloudServer.IP = "203.0.113.2"
+	assert.False(t, SameContent(before, &changed))
+}
@@ -0,0 +1,144 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+// Cipher encrypts and decrypts configuration files in memory, so their
+// plaintext never reaches the disk
+type Cipher interface {
+	Encrypt(plaintext []byte) ([]byte, error)
+	Decrypt(ciphertext []byte) ([]byte, error)
+}
+
+// CipherForFile returns the cipher for a configuration file, chosen by its
+// extension: age for .age, GPG for .gpg and .asc (ASCII armored), and nil
+// for plain YAML. For age, identity is the identity file to decrypt with,
+// whose recipients the file is encrypted to when saved; for GPG it is the
+// key to encrypt to, while decryption uses the gpg agent's keys.
+func CipherForFile(path, identity string) (Cipher, error) {
+	switch {
+	case strings.HasSuffix(path, ".age"):
+		if identity == "" {
+			return nil, fmt.Errorf("%s is age encrypted: an identity file is required", path)
+		}
+		return NewAgeCipher(ExpandPath(identity))
+	case strings.HasSuffix(path, ".gpg"):
+		return &GPGCipher{Recipient: identity}, nil
+	case strings.HasSuffix(path, ".asc"):
+		return &GPGCipher{Recipient: identity, Armor: true}, nil
+	}
+	return nil, nil
+}
+
+// AgeCipher encrypts with age to the recipients of its identities
+type AgeCipher struct {
+	identities []age.Identity
+	recipients []age.Recipient
+}
+
+// NewAgeCipher reads the X25519 identities in an age identity file, as
+// written by age-keygen
+func NewAgeCipher(identityFile string) (*AgeCipher, error) {
+	file, err := os.Open(identityFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open age identity: %w", err)
+	}
+	defer file.Close()
+
+	identities, err := age.ParseIdentities(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse age identity %s: %w", identityFile, err)
+	}
+
+	c := &AgeCipher{identities: identities}
+	for _, identity := range identities {
+		if x25519, ok := identity.(*age.X25519Identity); ok {
+			c.recipients = append(c.recipients, x25519.Recipient())
+		}
+	}
+	if len(c.recipients) == 0 {
+		return nil, fmt.Errorf("age identity %s holds no X25519 keys", identityFile)
+	}
+	return c, nil
+}
+
+// Encrypt implements Cipher
+func (c *AgeCipher) Encrypt(plaintext []byte) ([]byte, error) {
+	var out bytes.Buffer
+	w, err := age.Encrypt(&out, c.recipients...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt: %w", err)
+	}
+	if _, err := w.Write(plaintext); err != nil {
+		return nil, fmt.Errorf("failed to encrypt: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encrypt: %w", err)
+	}
+	return out.Bytes(), nil
+}
+
+// Decrypt implements Cipher. ASCII armored files are accepted too.
+func (c *AgeCipher) Decrypt(ciphertext []byte) ([]byte, error) {
+	in := bufio.NewReader(bytes.NewReader(ciphertext))
+	var src io.Reader = in
+	if start, _ := in.Peek(len(armor.Header)); string(start) == armor.Header {
+		src = armor.NewReader(in)
+	}
+
+	r, err := age.Decrypt(src, c.identities...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt: %w", err)
+	}
+	plaintext, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt: %w", err)
+	}
+	return plaintext, nil
+}
+
+// GPGCipher encrypts with gpg to Recipient, passing data through pipes
+type GPGCipher struct {
+	Recipient string
+	Armor     bool
+}
+
+// Encrypt implements Cipher
+func (c *GPGCipher) Encrypt(plaintext []byte) ([]byte, error) {
+	if c.Recipient == "" {
+		return nil, fmt.Errorf("failed to encrypt: no GPG key given to encrypt to")
+	}
+	args := []string{"--batch", "--yes", "--encrypt", "--recipient", c.Recipient}
+	if c.Armor {
+		args = append(args, "--armor")
+	}
+	return runGPG(plaintext, args...)
+}
+
+// Decrypt implements Cipher
+func (c *GPGCipher) Decrypt(ciphertext []byte) ([]byte, error) {
+	return runGPG(ciphertext, "--batch", "--quiet", "--decrypt")
+}
+
+// runGPG runs gpg with input on stdin and returns its stdout
+func runGPG(input []byte, args ...string) ([]byte, error) {
+	cmd := exec.Command("gpg", args...)
+	cmd.Stdin = bytes.NewReader(input)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("gpg failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
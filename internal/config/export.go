@@ -0,0 +1,49 @@
+package config
+
+import (
+	"fmt"
+	"io"
+
+	"gopkg.in/yaml.v3"
+)
+
+// keyFields are the SSH settings naming key files, which only make sense on
+// the machine the keys live on
+var keyFields = []string{"private_key_path", "natted_key_path"}
+
+// ExportConfigs writes configurations as a YAML stream, one document per
+// tunnel, that DecodeConfigs reads back. With omitKeys the key file paths
+// are left out, so the importing machine's defaults supply its own.
+func ExportConfigs(w io.Writer, configs []*Config, omitKeys bool) error {
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+
+	for _, config := range configs {
+		var node yaml.Node
+		if err := node.Encode(config); err != nil {
+			return fmt.Errorf("failed to marshal config '%s': %w", config.TunnelName, err)
+		}
+		if omitKeys {
+			removeKeyFields(&node)
+		}
+		if err := encoder.Encode(&node); err != nil {
+			return fmt.Errorf("failed to write config '%s': %w", config.TunnelName, err)
+		}
+	}
+	return encoder.Close()
+}
+
+// removeKeyFields deletes the key file paths from an encoded configuration
+func removeKeyFields(root *yaml.Node) {
+	i := mappingIndex(root, "ssh")
+	if i < 0 {
+		return
+	}
+
+	section := root.Content[i]
+	for _, key := range keyFields {
+		if j := mappingIndex(section, key); j >= 0 {
+			section.Content = append(section.Content[:j-1], section.Content[j+1:]...)
+		}
+	}
+}
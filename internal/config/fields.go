@@ -0,0 +1,460 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lerndmina/SSH-Tunnel/internal/audit"
+	"gopkg.in/yaml.v3"
+)
+
+// FieldUpdate assigns a value to the configuration field at a dotted YAML
+// path, e.g. "ssh.compression" or "local_forwards[0].local_port"
+type FieldUpdate struct {
+	Path  string
+	Value string
+}
+
+// ParseFieldUpdate parses a "<path>=<value>" argument
+func ParseFieldUpdate(arg string) (FieldUpdate, error) {
+	path, value, ok := strings.Cut(arg, "=")
+	path = strings.TrimSpace(path)
+	if !ok || path == "" {
+		return FieldUpdate{}, fmt.Errorf("invalid assignment %q: expected <path>=<value>", arg)
+	}
+	return FieldUpdate{Path: path, Value: value}, nil
+}
+
+// fieldSegment is one step of a field path; Index is the list item it
+// selects, or -1
+type fieldSegment struct {
+	Name  string
+	Index int
+}
+
+// timeType is the type of the timestamp fields, which are maintained
+// automatically
+var timeType = reflect.TypeOf(time.Time{})
+
+// durationType is the type of duration fields, written like "2h"
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// parseFieldPath splits a dotted field path into its segments
+func parseFieldPath(path string) ([]fieldSegment, error) {
+	var segments []fieldSegment
+	for _, part := range strings.Split(path, ".") {
+		segment := fieldSegment{Name: part, Index: -1}
+		if open := strings.IndexByte(part, '['); open >= 0 {
+			if !strings.HasSuffix(part, "]") {
+				return nil, fmt.Errorf("invalid field path %q", path)
+			}
+			index, err := strconv.Atoi(part[open+1 : len(part)-1])
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("invalid list index in field path %q", path)
+			}
+			segment = fieldSegment{Name: part[:open], Index: index}
+		}
+		if segment.Name == "" {
+			return nil, fmt.Errorf("invalid field path %q", path)
+		}
+		segments = append(segments, segment)
+	}
+	return segments, nil
+}
+
+// formatFieldPath joins segments back into a dotted field path
+func formatFieldPath(segments []fieldSegment) string {
+	parts := make([]string, len(segments))
+	for i, segment := range segments {
+		parts[i] = segment.Name
+		if segment.Index >= 0 {
+			parts[i] += fmt.Sprintf("[%d]", segment.Index)
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+// yamlFieldName returns the YAML key of a struct field, or "" if the field
+// is not serialized
+func yamlFieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+	if name == "-" {
+		return ""
+	}
+	return name
+}
+
+// fieldByYAMLName returns the index of the struct field with a YAML key
+func fieldByYAMLName(t reflect.Type, name string) (int, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		if yamlFieldName(t.Field(i)) == name {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// isSection reports whether values of type t are sections of nested fields
+// rather than single values
+func isSection(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct && t != timeType
+}
+
+// fieldType returns the type of the Config field a path names
+func fieldType(segments []fieldSegment) (reflect.Type, error) {
+	t := reflect.TypeOf(Config{})
+	for i, segment := range segments {
+		if !isSection(t) {
+			return nil, fmt.Errorf("unknown field %q", formatFieldPath(segments))
+		}
+		index, ok := fieldByYAMLName(t, segment.Name)
+		if !ok {
+			return nil, fmt.Errorf("unknown field %q", formatFieldPath(segments))
+		}
+		t = t.Field(index).Type
+		if segment.Index >= 0 {
+			if t.Kind() != reflect.Slice {
+				return nil, fmt.Errorf("%s is not a list", formatFieldPath(segments[:i+1]))
+			}
+			t = t.Elem()
+		}
+	}
+	return t, nil
+}
+
+// leafPaths lists the paths of the single-value fields of a section type,
+// leaving out lists of sections
+func leafPaths(t reflect.Type, prefix string) []string {
+	var paths []string
+	for i := 0; i < t.NumField(); i++ {
+		name := yamlFieldName(t.Field(i))
+		if name == "" {
+			continue
+		}
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+
+		fieldType := t.Field(i).Type
+		switch {
+		case isSection(fieldType):
+			paths = append(paths, leafPaths(fieldType, name)...)
+		case fieldType.Kind() == reflect.Slice && isSection(fieldType.Elem()):
+		default:
+			paths = append(paths, name)
+		}
+	}
+	return paths
+}
+
+// resolveField resolves a field path against Config, returning its segments
+// and the type of the value it names. A bare field name that appears in only
+// one section, like "reverse_port", is shorthand for its full path.
+func resolveField(path string) ([]fieldSegment, reflect.Type, error) {
+	segments, err := parseFieldPath(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	t, err := fieldType(segments)
+	if err == nil {
+		return segments, t, nil
+	}
+	if len(segments) != 1 || segments[0].Index >= 0 {
+		return nil, nil, err
+	}
+
+	var matches []string
+	for _, leaf := range leafPaths(reflect.TypeOf(Config{}), "") {
+		if strings.HasSuffix(leaf, "."+path) {
+			matches = append(matches, leaf)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, nil, err
+	case 1:
+		return resolveField(matches[0])
+	default:
+		return nil, nil, fmt.Errorf("ambiguous field %q: could be %s", path, strings.Join(matches, ", "))
+	}
+}
+
+// fieldNode converts a command-line value to the YAML node stored for a
+// field of type t, rejecting values of the wrong type
+func fieldNode(path string, t reflect.Type, value string) (*yaml.Node, error) {
+	switch {
+	case t == timeType:
+		return nil, fmt.Errorf("%s is maintained automatically", path)
+	case t == durationType:
+		d, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("%s expects a duration such as 90s or 2h, got %q", path, value)
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: d.String()}, nil
+	case isSection(t):
+		return nil, fmt.Errorf("%s is a section, not a field", path)
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.String:
+		// Comma-separated, so "tags=home,lab" sets two tags
+		node := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: item})
+			}
+		}
+		return node, nil
+	case t.Kind() == reflect.Slice:
+		return nil, fmt.Errorf("%s is a list; set fields of its items instead, e.g. %s[0].<field>", path, path)
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}, nil
+	case reflect.Bool:
+		b, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("%s expects true or false, got %q", path, value)
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: strconv.FormatBool(b)}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("%s expects an integer, got %q", path, value)
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: strconv.Itoa(n)}, nil
+	}
+
+	return nil, fmt.Errorf("%s cannot be set from the command line", path)
+}
+
+// FieldValue is a single-value configuration field and its value as text
+type FieldValue struct {
+	Path  string
+	Value string
+}
+
+// formatFieldValue renders a field value the way config set accepts it
+func formatFieldValue(v reflect.Value) string {
+	if v.Type() == timeType {
+		return v.Interface().(time.Time).Format(time.RFC3339)
+	}
+	if v.Kind() == reflect.Slice {
+		items := make([]string, v.Len())
+		for i := range items {
+			items[i] = formatFieldValue(v.Index(i))
+		}
+		return strings.Join(items, ",")
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// GetField returns the value of the single-value field at a path, accepting
+// the same paths as SetFields
+func (c *Config) GetField(path string) (string, error) {
+	segments, t, err := resolveField(path)
+	if err != nil {
+		return "", err
+	}
+	path = formatFieldPath(segments)
+	if isSection(t) {
+		return "", fmt.Errorf("%s is a section, not a field", path)
+	}
+	if t.Kind() == reflect.Slice && isSection(t.Elem()) {
+		return "", fmt.Errorf("%s is a list; get fields of its items instead, e.g. %s[0].<field>", path, path)
+	}
+
+	v := reflect.ValueOf(c).Elem()
+	for i, segment := range segments {
+		index, _ := fieldByYAMLName(v.Type(), segment.Name)
+		v = v.Field(index)
+		if segment.Index >= 0 {
+			if segment.Index >= v.Len() {
+				return "", fmt.Errorf("%s does not exist", formatFieldPath(segments[:i+1]))
+			}
+			v = v.Index(segment.Index)
+		}
+	}
+	return formatFieldValue(v), nil
+}
+
+// Fields returns every single-value field of the configuration in
+// declaration order, with list items addressed by index
+func (c *Config) Fields() []FieldValue {
+	return appendFields(nil, "", reflect.ValueOf(c).Elem())
+}
+
+// appendFields appends the single-value fields of a section value
+func appendFields(fields []FieldValue, prefix string, v reflect.Value) []FieldValue {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := yamlFieldName(t.Field(i))
+		if name == "" {
+			continue
+		}
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+
+		field := v.Field(i)
+		switch {
+		case isSection(field.Type()):
+			fields = appendFields(fields, name, field)
+		case field.Kind() == reflect.Slice && isSection(field.Type().Elem()):
+			for j := 0; j < field.Len(); j++ {
+				fields = appendFields(fields, fmt.Sprintf("%s[%d]", name, j), field.Index(j))
+			}
+		default:
+			fields = append(fields, FieldValue{Path: name, Value: formatFieldValue(field)})
+		}
+	}
+	return fields
+}
+
+// mappingIndex returns the index of a key's value in a YAML mapping node, or
+// -1 if the key is missing
+func mappingIndex(node *yaml.Node, key string) int {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// setMappingValue sets a key in a YAML mapping node, appending it if missing
+func setMappingValue(node *yaml.Node, key string, value *yaml.Node) {
+	if i := mappingIndex(node, key); i >= 0 {
+		value.HeadComment = node.Content[i].HeadComment
+		value.LineComment = node.Content[i].LineComment
+		node.Content[i] = value
+		return
+	}
+	node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, value)
+}
+
+// setNode stores value at a field path in a YAML mapping, creating missing
+// sections. List items must already exist.
+func setNode(root *yaml.Node, segments []fieldSegment, value *yaml.Node) error {
+	node := root
+	for i, segment := range segments {
+		last := i == len(segments)-1
+
+		if segment.Index >= 0 {
+			var child *yaml.Node
+			if j := mappingIndex(node, segment.Name); j >= 0 {
+				child = node.Content[j]
+			}
+			if child == nil || child.Kind != yaml.SequenceNode || segment.Index >= len(child.Content) {
+				return fmt.Errorf("%s does not exist in the tunnel's configuration file", formatFieldPath(segments[:i+1]))
+			}
+			if last {
+				child.Content[segment.Index] = value
+				return nil
+			}
+			node = child.Content[segment.Index]
+			if node.Kind != yaml.MappingNode {
+				return fmt.Errorf("%s is not a section", formatFieldPath(segments[:i+1]))
+			}
+			continue
+		}
+
+		if last {
+			setMappingValue(node, segment.Name, value)
+			return nil
+		}
+
+		j := mappingIndex(node, segment.Name)
+		if j < 0 || node.Content[j].Kind != yaml.MappingNode {
+			setMappingValue(node, segment.Name, &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"})
+			j = mappingIndex(node, segment.Name)
+		}
+		node = node.Content[j]
+	}
+	return nil
+}
+
+// SetFields applies updates to a tunnel's configuration file. Only the
+// updated fields are written, so values inherited from defaults.yaml stay
+// inherited and comments in the file are kept. Nothing is saved unless every
+// update applies and the result validates.
+func (m *Manager) SetFields(name string, updates []FieldUpdate) (_ *Config, err error) {
+	defer func() {
+		details := make(map[string]string, len(updates))
+		for _, update := range updates {
+			details[update.Path] = update.Value
+		}
+		m.audit.Log(audit.ActionConfigSet, name, details, err)
+	}()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.configs[name]; !exists {
+		return nil, fmt.Errorf("configuration '%s' not found", name)
+	}
+	if store, ok := m.store.(*configFileStore); ok {
+		return nil, fmt.Errorf("setting fields is not supported with a single config file; edit %s instead", store.path)
+	}
+
+	data, err := m.store.Load(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s is not a YAML mapping", m.location(name))
+	}
+	root := doc.Content[0]
+
+	for _, update := range updates {
+		segments, t, err := resolveField(update.Path)
+		if err != nil {
+			return nil, err
+		}
+		path := formatFieldPath(segments)
+		if path == "tunnel_name" {
+			return nil, fmt.Errorf("tunnel_name cannot be changed")
+		}
+
+		value, err := fieldNode(path, t, update.Value)
+		if err != nil {
+			return nil, err
+		}
+		if err := setNode(root, segments, value); err != nil {
+			return nil, err
+		}
+	}
+
+	var updatedAt yaml.Node
+	if err := updatedAt.Encode(time.Now()); err != nil {
+		return nil, fmt.Errorf("failed to encode timestamp: %w", err)
+	}
+	setMappingValue(root, "updated_at", &updatedAt)
+
+	data, err = yaml.Marshal(&doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal config: %w", err)
+	}
+
+	config, err := m.decodeConfig(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration '%s': %w", name, err)
+	}
+
+	if err := m.store.Save(name, data); err != nil {
+		return nil, err
+	}
+
+	m.configs[name] = config
+	return config, nil
+}
@@ -0,0 +1,212 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeFieldsTunnel writes a tunnel file and defaults.yaml for the field
+// tests and returns a manager loading them
+func writeFieldsTunnel(t *testing.T) (*Manager, string) {
+	tempDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, DefaultsFile), []byte("performance:\n  connect_timeout: 20\n"), 0600))
+
+	tunnelsDir := filepath.Join(tempDir, "tunnels")
+	require.NoError(t, os.MkdirAll(tunnelsDir, 0755))
+	tunnel := `tunnel_name: home
+# The VPS
+cloud_server:
+  ip: 203.0.113.10
+  port: 22
+local_server:
+  reverse_port: 2222
+  local_forwards:
+    - local_port: 5432
+      remote_host: db.internal
+      remote_port: 5432
+`
+	configFile := filepath.Join(tunnelsDir, "home.yaml")
+	require.NoError(t, os.WriteFile(configFile, []byte(tunnel), 0600))
+
+	manager, err := NewManager(tempDir)
+	require.NoError(t, err)
+	return manager, configFile
+}
+
+func TestSetFieldsNestedPaths(t *testing.T) {
+	manager, configFile := writeFieldsTunnel(t)
+
+	config, err := manager.SetFields("home", []FieldUpdate{
+		{Path: "ssh.compression", Value: "true"},
+		{Path: "performance.keep_alive_interval", Value: "15"},
+		{Path: "local_server.local_forwards[0].local_port", Value: "6543"},
+		{Path: "tags", Value: "home, lab"},
+	})
+	require.NoError(t, err)
+	assert.True(t, config.SSH.Compression)
+	assert.Equal(t, 15, config.Performance.KeepAliveInterval)
+	assert.Equal(t, 6543, config.LocalServer.LocalForwards[0].LocalPort)
+	assert.Equal(t, []string{"home", "lab"}, config.Tags)
+	assert.Equal(t, 20, config.Performance.ConnectTimeout, "defaults still apply")
+
+	// The file gains only the updated fields and keeps its comments
+	data, err := os.ReadFile(configFile)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "# The VPS")
+	assert.NotContains(t, string(data), "connect_timeout")
+
+	reloaded, err := NewManager(filepath.Dir(filepath.Dir(configFile)))
+	require.NoError(t, err)
+	saved, err := reloaded.GetConfig("home")
+	require.NoError(t, err)
+	assert.Equal(t, config.SSH.Compression, saved.SSH.Compression)
+	assert.Equal(t, 15, saved.Performance.KeepAliveInterval)
+	assert.False(t, saved.UpdatedAt.IsZero())
+}
+
+func TestSetFieldsShorthand(t *testing.T) {
+	manager, _ := writeFieldsTunnel(t)
+
+	config, err := manager.SetFields("home", []FieldUpdate{{Path: "reverse_port", Value: "2300"}})
+	require.NoError(t, err)
+	assert.Equal(t, 2300, config.LocalServer.ReversePort)
+
+	_, err = manager.SetFields("home", []FieldUpdate{{Path: "user", Value: "me"}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "ambiguous")
+}
+
+func TestSetFieldsDuration(t *testing.T) {
+	manager, configFile := writeFieldsTunnel(t)
+
+	config, err := manager.SetFields("home", []FieldUpdate{{Path: "service.max_lifetime", Value: "90m"}})
+	require.NoError(t, err)
+	assert.Equal(t, 90*time.Minute, config.Service.MaxLifetime)
+
+	data, err := os.ReadFile(configFile)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "max_lifetime: 1h30m0s")
+
+	value, err := config.GetField("max_lifetime")
+	require.NoError(t, err)
+	assert.Equal(t, "1h30m0s", value)
+
+	_, err = manager.SetFields("home", []FieldUpdate{{Path: "service.max_lifetime", Value: "2"}})
+	assert.ErrorContains(t, err, "expects a duration")
+}
+
+func TestSetFieldsRejectsBadInput(t *testing.T) {
+	manager, configFile := writeFieldsTunnel(t)
+	before, err := os.ReadFile(configFile)
+	require.NoError(t, err)
+
+	tests := []struct {
+		update FieldUpdate
+		want   string
+	}{
+		{FieldUpdate{Path: "ssh.compresion", Value: "true"}, `unknown field "ssh.compresion"`},
+		{FieldUpdate{Path: "ssh.compression", Value: "yes please"}, "expects true or false"},
+		{FieldUpdate{Path: "cloud_server.port", Value: "twenty-two"}, "expects an integer"},
+		{FieldUpdate{Path: "cloud_server", Value: "x"}, "is a section"},
+		{FieldUpdate{Path: "created_at", Value: "now"}, "maintained automatically"},
+		{FieldUpdate{Path: "tunnel_name", Value: "away"}, "cannot be changed"},
+		{FieldUpdate{Path: "local_server.local_forwards[3].local_port", Value: "1"}, "does not exist"},
+		{FieldUpdate{Path: "ssh.macs", Value: "hmac-md5-bogus"}, "unknown algorithm"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.update.Path, func(t *testing.T) {
+			_, err := manager.SetFields("home", []FieldUpdate{{Path: "reverse_port", Value: "2400"}, tt.update})
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.want)
+		})
+	}
+
+	after, err := os.ReadFile(configFile)
+	require.NoError(t, err)
+	assert.Equal(t, string(before), string(after), "failed updates must not be saved")
+
+	_, err = manager.SetFields("missing", []FieldUpdate{{Path: "reverse_port", Value: "1"}})
+	assert.Error(t, err)
+}
+
+func TestParseFieldUpdate(t *testing.T) {
+	update, err := ParseFieldUpdate("service.on_start=curl -d a=b https://example.com")
+	require.NoError(t, err)
+	assert.Equal(t, FieldUpdate{Path: "service.on_start", Value: "curl -d a=b https://example.com"}, update)
+
+	_, err = ParseFieldUpdate("ssh.compression")
+	assert.Error(t, err)
+	_, err = ParseFieldUpdate("=true")
+	assert.Error(t, err)
+}
+
+func TestGetField(t *testing.T) {
+	manager, _ := writeFieldsTunnel(t)
+	config, err := manager.GetConfig("home")
+	require.NoError(t, err)
+
+	tests := map[string]string{
+		"cloud_server.ip": "203.0.113.10",
+		"reverse_port":    "2222",
+		"local_server.local_forwards[0].remote_host": "db.internal",
+		"performance.connect_timeout":                "20",
+		"ssh.compression":                            "false",
+		"ssh.ciphers":                                "",
+	}
+	for path, want := range tests {
+		value, err := config.GetField(path)
+		require.NoError(t, err, path)
+		assert.Equal(t, want, value, path)
+	}
+
+	config.Tags = []string{"home", "lab"}
+	value, err := config.GetField("tags")
+	require.NoError(t, err)
+	assert.Equal(t, "home,lab", value)
+}
+
+func TestGetFieldMissingPaths(t *testing.T) {
+	manager, _ := writeFieldsTunnel(t)
+	config, err := manager.GetConfig("home")
+	require.NoError(t, err)
+
+	for path, want := range map[string]string{
+		"cloud_server.hostname":       "unknown field",
+		"nonsense":                    "unknown field",
+		"cloud_server":                "is a section",
+		"local_server.local_forwards": "is a list",
+		"local_server.local_forwards[1].local_port": "does not exist",
+		"local_server.local_forwards[x].local_port": "invalid list index",
+		"user": "ambiguous",
+	} {
+		_, err := config.GetField(path)
+		require.Error(t, err, path)
+		assert.Contains(t, err.Error(), want, path)
+	}
+}
+
+func TestFieldsListsEveryLeaf(t *testing.T) {
+	manager, _ := writeFieldsTunnel(t)
+	config, err := manager.GetConfig("home")
+	require.NoError(t, err)
+
+	fields := config.Fields()
+	require.NotEmpty(t, fields)
+	assert.Equal(t, FieldValue{Path: "tunnel_name", Value: "home"}, fields[0])
+
+	byPath := make(map[string]string)
+	for _, field := range fields {
+		byPath[field.Path] = field.Value
+		value, err := config.GetField(field.Path)
+		require.NoError(t, err, field.Path)
+		assert.Equal(t, field.Value, value, field.Path)
+	}
+	assert.Equal(t, "5432", byPath["local_server.local_forwards[0].local_port"])
+	assert.Equal(t, "20", byPath["performance.connect_timeout"])
+}
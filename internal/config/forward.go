@@ -0,0 +1,147 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ParseForwardSpec parses a local forward in ssh -L syntax,
+// [bind_address:]port:host:hostport. IPv6 addresses are written in
+// brackets, e.g. [::1]:8080:db.internal:5432.
+func ParseForwardSpec(spec string) (ForwardConfig, error) {
+	bindAddr, port, host, hostPort, err := parseForwardSpec(spec)
+	if err != nil {
+		return ForwardConfig{}, err
+	}
+	return ForwardConfig{BindAddr: bindAddr, LocalPort: port, RemoteHost: host, RemotePort: hostPort}, nil
+}
+
+// ParseRemoteForwardSpec parses a remote forward in ssh -R syntax,
+// [bind_address:]port:host:hostport, where port is opened on the cloud
+// server and host:hostport is reached from this machine
+func ParseRemoteForwardSpec(spec string) (RemoteForwardConfig, error) {
+	bindAddr, port, host, hostPort, err := parseForwardSpec(spec)
+	if err != nil {
+		return RemoteForwardConfig{}, err
+	}
+	return RemoteForwardConfig{BindAddr: bindAddr, RemotePort: port, LocalHost: host, LocalPort: hostPort}, nil
+}
+
+// parseForwardSpec splits a forward in ssh -L/-R syntax into its parts
+func parseForwardSpec(spec string) (bindAddr string, port int, host string, hostPort int, err error) {
+	fields, err := splitForwardSpec(spec)
+	if err != nil {
+		return "", 0, "", 0, err
+	}
+
+	switch len(fields) {
+	case 3:
+	case 4:
+		bindAddr = fields[0]
+		fields = fields[1:]
+	default:
+		return "", 0, "", 0, fmt.Errorf("invalid forward %q: want [bind_address:]port:host:hostport", spec)
+	}
+
+	if port, err = parseForwardPort(fields[0]); err != nil {
+		return "", 0, "", 0, fmt.Errorf("invalid forward %q: %w", spec, err)
+	}
+	if fields[1] == "" {
+		return "", 0, "", 0, fmt.Errorf("invalid forward %q: missing host", spec)
+	}
+	host = fields[1]
+	if hostPort, err = parseForwardPort(fields[2]); err != nil {
+		return "", 0, "", 0, fmt.Errorf("invalid forward %q: %w", spec, err)
+	}
+	return bindAddr, port, host, hostPort, nil
+}
+
+// WithLocalForwards returns a copy of the configuration with extra local
+// forwards added after its own. The configuration itself is unchanged, so
+// the extra forwards are never saved. A forward listening on the same
+// address and port as another is rejected.
+func (c *Config) WithLocalForwards(extra []ForwardConfig) (*Config, error) {
+	copied := *c
+	forwards := slices.Clone(c.LocalServer.LocalForwards)
+	for _, forward := range extra {
+		for _, existing := range forwards {
+			if forwardBindAddr(existing.BindAddr) == forwardBindAddr(forward.BindAddr) && existing.LocalPort == forward.LocalPort {
+				return nil, fmt.Errorf("local port %d is already forwarded to %s:%d", forward.LocalPort, existing.RemoteHost, existing.RemotePort)
+			}
+		}
+		forwards = append(forwards, forward)
+	}
+	copied.LocalServer.LocalForwards = forwards
+	return &copied, nil
+}
+
+// WithRemoteForwards returns a copy of the configuration with extra remote
+// forwards added after its own, leaving the configuration itself unchanged.
+// A forward opening the reverse port, or a port another remote forward
+// opens, is rejected.
+func (c *Config) WithRemoteForwards(extra []RemoteForwardConfig) (*Config, error) {
+	copied := *c
+	forwards := slices.Clone(c.LocalServer.RemoteForwards)
+	for _, forward := range extra {
+		if forward.RemotePort == c.LocalServer.ReversePort {
+			return nil, fmt.Errorf("remote port %d is the tunnel's reverse port", forward.RemotePort)
+		}
+		for _, existing := range forwards {
+			if existing.BindAddr == forward.BindAddr && existing.RemotePort == forward.RemotePort {
+				return nil, fmt.Errorf("remote port %d is already forwarded to %s:%d", forward.RemotePort, existing.LocalHost, existing.LocalPort)
+			}
+		}
+		forwards = append(forwards, forward)
+	}
+	copied.LocalServer.RemoteForwards = forwards
+	return &copied, nil
+}
+
+// forwardBindAddr returns the address a forward listens on
+func forwardBindAddr(bindAddr string) string {
+	if bindAddr == "" {
+		return DefaultBindAddr
+	}
+	return bindAddr
+}
+
+// splitForwardSpec splits a forward spec at colons outside brackets and
+// strips the brackets around IPv6 addresses
+func splitForwardSpec(spec string) ([]string, error) {
+	var fields []string
+	rest := spec
+	for {
+		var field string
+		found := true
+		if strings.HasPrefix(rest, "[") {
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("invalid forward %q: unclosed '['", spec)
+			}
+			field, rest = rest[1:end], rest[end+1:]
+			if rest == "" {
+				found = false
+			} else if rest, found = strings.CutPrefix(rest, ":"); !found {
+				return nil, fmt.Errorf("invalid forward %q: expected ':' after ']'", spec)
+			}
+		} else {
+			field, rest, found = strings.Cut(rest, ":")
+		}
+
+		fields = append(fields, field)
+		if !found {
+			return fields, nil
+		}
+	}
+}
+
+// parseForwardPort parses a port number in a forward spec
+func parseForwardPort(s string) (int, error) {
+	port, err := strconv.Atoi(s)
+	if err != nil || port < 1 || port > 65535 {
+		return 0, fmt.Errorf("port %q must be a number from 1 to 65535", s)
+	}
+	return port, nil
+}
@@ -0,0 +1,93 @@
+package config
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseForwardSpec(t *testing.T) {
+	tests := []struct {
+		spec string
+		want ForwardConfig
+		err  string
+	}{
+		{spec: "8080:db.internal:5432", want: ForwardConfig{LocalPort: 8080, RemoteHost: "db.internal", RemotePort: 5432}},
+		{spec: "0.0.0.0:8080:db.internal:5432", want: ForwardConfig{BindAddr: "0.0.0.0", LocalPort: 8080, RemoteHost: "db.internal", RemotePort: 5432}},
+		{spec: "[::1]:8080:[fd00::5]:5432", want: ForwardConfig{BindAddr: "::1", LocalPort: 8080, RemoteHost: "fd00::5", RemotePort: 5432}},
+		{spec: "8080:db.internal", err: "want [bind_address:]port:host:hostport"},
+		{spec: "http:db.internal:5432", err: `port "http" must be a number`},
+		{spec: "8080:db.internal:70000", err: `port "70000" must be a number`},
+		{spec: "8080::5432", err: "missing host"},
+		{spec: "[::1:8080:db:5432", err: "unclosed '['"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := ParseForwardSpec(tt.spec)
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestWithLocalForwards(t *testing.T) {
+	cfg := &Config{TunnelName: "home"}
+	cfg.LocalServer.LocalForwards = []ForwardConfig{{LocalPort: 8080, RemoteHost: "web", RemotePort: 80}}
+
+	merged, err := cfg.WithLocalForwards([]ForwardConfig{{LocalPort: 5432, RemoteHost: "db", RemotePort: 5432}})
+	require.NoError(t, err)
+	assert.Len(t, merged.LocalServer.LocalForwards, 2)
+	assert.Len(t, cfg.LocalServer.LocalForwards, 1, "the original configuration is unchanged")
+
+	_, err = cfg.WithLocalForwards([]ForwardConfig{{BindAddr: "127.0.0.1", LocalPort: 8080, RemoteHost: "db", RemotePort: 5432}})
+	assert.ErrorContains(t, err, "local port 8080 is already forwarded to web:80")
+}
+
+func TestWithRemoteForwards(t *testing.T) {
+	cfg := &Config{TunnelName: "home"}
+	cfg.LocalServer.ReversePort = 2222
+	cfg.LocalServer.RemoteForwards = []RemoteForwardConfig{{RemotePort: 8080, LocalHost: "localhost", LocalPort: 80}}
+
+	forward, err := ParseRemoteForwardSpec("0.0.0.0:9000:localhost:3000")
+	require.NoError(t, err)
+	assert.Equal(t, RemoteForwardConfig{BindAddr: "0.0.0.0", RemotePort: 9000, LocalHost: "localhost", LocalPort: 3000}, forward)
+
+	merged, err := cfg.WithRemoteForwards([]RemoteForwardConfig{forward})
+	require.NoError(t, err)
+	assert.Len(t, merged.LocalServer.RemoteForwards, 2)
+	assert.Len(t, cfg.LocalServer.RemoteForwards, 1, "the original configuration is unchanged")
+
+	_, err = cfg.WithRemoteForwards([]RemoteForwardConfig{{RemotePort: 2222, LocalHost: "localhost", LocalPort: 22}})
+	assert.ErrorContains(t, err, "remote port 2222 is the tunnel's reverse port")
+	_, err = cfg.WithRemoteForwards([]RemoteForwardConfig{{RemotePort: 8080, LocalHost: "localhost", LocalPort: 81}})
+	assert.ErrorContains(t, err, "remote port 8080 is already forwarded to localhost:80")
+}
+
+func TestValidateRemoteForwards(t *testing.T) {
+	cfg := &Config{TunnelName: "web"}
+	cfg.LocalServer.ReversePort = 2222
+	cfg.LocalServer.RemoteForwards = []RemoteForwardConfig{
+		{RemotePort: 8080, LocalHost: "localhost", LocalPort: 80},
+		{BindAddr: "0.0.0.0", RemotePort: 8080, LocalHost: "localhost", LocalPort: 81},
+	}
+	assert.NoError(t, cfg.Validate())
+
+	for forward, want := range map[RemoteForwardConfig]string{
+		{RemotePort: 0, LocalHost: "localhost", LocalPort: 80}:     "remote_forwards[2]: remote_port 0 must be from 1 to 65535",
+		{RemotePort: 9000, LocalHost: "localhost", LocalPort: 1e5}: "remote_forwards[2]: local_port 100000 must be from 1 to 65535",
+		{RemotePort: 9000, LocalPort: 80}:                          "remote_forwards[2]: local_host is required",
+		{RemotePort: 2222, LocalHost: "localhost", LocalPort: 22}:  "remote_forwards[2]: remote port 2222 is the tunnel's reverse port",
+		{RemotePort: 8080, LocalHost: "localhost", LocalPort: 82}:  "remote_forwards[2]: remote port 8080 is already forwarded to localhost:80",
+	} {
+		invalid := *cfg
+		invalid.LocalServer.RemoteForwards = append(slices.Clone(cfg.LocalServer.RemoteForwards), forward)
+		assert.ErrorContains(t, invalid.Validate(), want)
+	}
+}
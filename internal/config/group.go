@@ -0,0 +1,83 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// GroupConfigs returns the configurations of the tunnels in a group, sorted
+// by name
+func (m *Manager) GroupConfigs(group string) ([]*Config, error) {
+	names := m.ListConfigs()
+	sort.Strings(names)
+
+	var members []*Config
+	for _, name := range names {
+		cfg, err := m.GetConfig(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get configuration for tunnel '%s' in group '%s': %w", name, group, err)
+		}
+		if cfg.Group == group {
+			members = append(members, cfg)
+		}
+	}
+	return members, nil
+}
+
+// MergeGroup combines the configurations of a tunnel group into the one
+// configuration its shared SSH process runs with. Tunnels in a group must
+// connect to the same cloud server as the same user with the same key; the
+// connection settings are taken from the first. Every member's reverse port
+// and forwards are carried, and at most one member may have a SOCKS proxy.
+func MergeGroup(group string, members []*Config) (*Config, error) {
+	if len(members) == 0 {
+		return nil, fmt.Errorf("group '%s' has no tunnels", group)
+	}
+
+	first := members[0]
+	merged := *first
+	merged.TunnelName = group
+	for _, member := range members[1:] {
+		if err := sameEndpoint(first, member); err != nil {
+			return nil, fmt.Errorf("group '%s': %w", group, err)
+		}
+
+		reverse := RemoteForwardConfig{RemotePort: member.LocalServer.ReversePort, LocalHost: "localhost", LocalPort: 22}
+		next, err := merged.WithRemoteForwards(append([]RemoteForwardConfig{reverse}, member.LocalServer.RemoteForwards...))
+		if err != nil {
+			return nil, fmt.Errorf("group '%s': tunnel '%s': %w", group, member.TunnelName, err)
+		}
+		if next, err = next.WithLocalForwards(member.LocalServer.LocalForwards); err != nil {
+			return nil, fmt.Errorf("group '%s': tunnel '%s': %w", group, member.TunnelName, err)
+		}
+
+		if member.LocalServer.SOCKSPort > 0 {
+			if next.LocalServer.SOCKSPort > 0 {
+				return nil, fmt.Errorf("group '%s': only one tunnel may have a SOCKS proxy", group)
+			}
+			next.LocalServer.SOCKSPort = member.LocalServer.SOCKSPort
+			next.LocalServer.SOCKSBindAddr = member.LocalServer.SOCKSBindAddr
+			next.LocalServer.SOCKSCheckURL = member.LocalServer.SOCKSCheckURL
+		}
+		merged = *next
+	}
+	return &merged, nil
+}
+
+// sameEndpoint checks that a group member connects the way the group's
+// first tunnel does
+func sameEndpoint(first, member *Config) error {
+	switch {
+	case !strings.EqualFold(member.CloudServer.IP, first.CloudServer.IP) || member.CloudServer.Port != first.CloudServer.Port:
+		return fmt.Errorf("tunnel '%s' connects to %s:%d, not %s:%d like '%s'", member.TunnelName,
+			member.CloudServer.IP, member.CloudServer.Port, first.CloudServer.IP, first.CloudServer.Port, first.TunnelName)
+	case member.CloudServer.User != first.CloudServer.User:
+		return fmt.Errorf("tunnel '%s' logs in as %s, not %s like '%s'", member.TunnelName,
+			member.CloudServer.User, first.CloudServer.User, first.TunnelName)
+	case ExpandPath(member.SSH.PrivateKeyPath) != ExpandPath(first.SSH.PrivateKeyPath):
+		return fmt.Errorf("tunnel '%s' uses key %s, not %s like '%s'", member.TunnelName,
+			member.SSH.PrivateKeyPath, first.SSH.PrivateKeyPath, first.TunnelName)
+	}
+	return nil
+}
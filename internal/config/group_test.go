@@ -0,0 +1,70 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// groupMember returns a tunnel in group "office" with the given reverse port
+func groupMember(name string, reversePort int) *Config {
+	return &Config{
+		TunnelName:  name,
+		Group:       "office",
+		CloudServer: CloudServerConfig{IP: "203.0.113.1", Port: 22, User: "tunnel"},
+		LocalServer: LocalServerConfig{User: "pi", ReversePort: reversePort},
+		SSH:         SSHConfig{PrivateKeyPath: "~/.ssh/id_ed25519"},
+	}
+}
+
+func TestMergeGroup(t *testing.T) {
+	web := groupMember("web", 2222)
+	web.LocalServer.LocalForwards = []ForwardConfig{{LocalPort: 5432, RemoteHost: "db.internal", RemotePort: 5432}}
+	ssh := groupMember("ssh", 2223)
+	ssh.LocalServer.RemoteForwards = []RemoteForwardConfig{{RemotePort: 8080, LocalHost: "localhost", LocalPort: 80}}
+	ssh.LocalServer.SOCKSPort = 1080
+
+	merged, err := MergeGroup("office", []*Config{web, ssh})
+	require.NoError(t, err)
+
+	assert.Equal(t, "office", merged.TunnelName)
+	assert.Equal(t, 2222, merged.LocalServer.ReversePort)
+	assert.Equal(t, []RemoteForwardConfig{
+		{RemotePort: 2223, LocalHost: "localhost", LocalPort: 22},
+		{RemotePort: 8080, LocalHost: "localhost", LocalPort: 80},
+	}, merged.LocalServer.RemoteForwards)
+	assert.Equal(t, web.LocalServer.LocalForwards, merged.LocalServer.LocalForwards)
+	assert.Equal(t, 1080, merged.LocalServer.SOCKSPort)
+
+	// The members are unchanged
+	assert.Equal(t, "web", web.TunnelName)
+	assert.Empty(t, web.LocalServer.RemoteForwards)
+	assert.Zero(t, web.LocalServer.SOCKSPort)
+}
+
+func TestMergeGroupRejectsConflicts(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(*Config)
+		err    string
+	}{
+		{"other server", func(c *Config) { c.CloudServer.IP = "198.51.100.1" }, "connects to 198.51.100.1:22"},
+		{"other user", func(c *Config) { c.CloudServer.User = "root" }, "logs in as root"},
+		{"other key", func(c *Config) { c.SSH.PrivateKeyPath = "~/.ssh/other" }, "uses key ~/.ssh/other"},
+		{"same reverse port", func(c *Config) { c.LocalServer.ReversePort = 2222 }, "remote port 2222 is the tunnel's reverse port"},
+		{"two SOCKS proxies", func(c *Config) { c.LocalServer.SOCKSPort = 1081 }, "only one tunnel may have a SOCKS proxy"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			web := groupMember("web", 2222)
+			web.LocalServer.SOCKSPort = 1080
+			ssh := groupMember("ssh", 2223)
+			tt.change(ssh)
+
+			_, err := MergeGroup("office", []*Config{web, ssh})
+			assert.ErrorContains(t, err, tt.err)
+		})
+	}
+}
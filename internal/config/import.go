@@ -0,0 +1,71 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DecodeConfigs reads one or more tunnel configurations from a YAML stream,
+// one per document, each applied over the defaults as if loaded from the
+// tunnels directory. Every configuration must name its tunnel and validate.
+func (m *Manager) DecodeConfigs(r io.Reader) ([]*Config, error) {
+	decoder := yaml.NewDecoder(r)
+	seen := make(map[string]bool)
+
+	var configs []*Config
+	for doc := 1; ; doc++ {
+		var node yaml.Node
+		if err := decoder.Decode(&node); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("document %d: %w", doc, err)
+		}
+		if len(node.Content) == 0 || node.Content[0].Tag == "!!null" {
+			continue // empty document, e.g. a trailing "---"
+		}
+
+		data, err := yaml.Marshal(&node)
+		if err != nil {
+			return nil, fmt.Errorf("document %d: %w", doc, err)
+		}
+		config, err := m.decodeConfig(data)
+		if err != nil {
+			return nil, fmt.Errorf("document %d: %w", doc, err)
+		}
+
+		if err := checkTunnelName(config.TunnelName); err != nil {
+			return nil, fmt.Errorf("document %d: %w", doc, err)
+		}
+		if seen[config.TunnelName] {
+			return nil, fmt.Errorf("document %d: tunnel '%s' appears more than once", doc, config.TunnelName)
+		}
+		seen[config.TunnelName] = true
+
+		if err := config.Validate(); err != nil {
+			return nil, fmt.Errorf("document %d: invalid configuration '%s': %w", doc, config.TunnelName, err)
+		}
+		configs = append(configs, config)
+	}
+
+	if len(configs) == 0 {
+		return nil, fmt.Errorf("no tunnel configurations found")
+	}
+	return configs, nil
+}
+
+// checkTunnelName checks that a tunnel name can be used as a file name in
+// the tunnels directory
+func checkTunnelName(name string) error {
+	switch {
+	case name == "":
+		return fmt.Errorf("tunnel_name is required")
+	case name == "." || name == ".." || strings.ContainsAny(name, `/\`):
+		return fmt.Errorf("invalid tunnel_name %q", name)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Sources of an effective configuration value, as reported by InspectConfig
+const (
+	// SourceConfig marks values set in the tunnel's own file
+	SourceConfig = "config"
+	// SourceDefaults marks values inherited from defaults.yaml
+	SourceDefaults = DefaultsFile
+	// SourceDefault marks values nobody set, left at their built-in default
+	SourceDefault = "default"
+)
+
+// expandedFields are the paths whose values are run through ExpandPath
+// before use
+var expandedFields = map[string]bool{
+	"ssh.private_key_path": true,
+	"ssh.natted_key_path":  true,
+	"ssh.known_hosts_file": true,
+}
+
+// InspectedField is one value of an effective configuration and where it
+// came from. For path fields, Value is expanded and Unexpanded holds the
+// value as written if it differed.
+type InspectedField struct {
+	Path       string
+	Value      interface{}
+	Source     string
+	Unexpanded string
+}
+
+// InspectConfig returns every field of a tunnel's effective configuration,
+// after defaults.yaml is merged and paths are expanded, sorted by path
+func (m *Manager) InspectConfig(name string) ([]InspectedField, error) {
+	config, err := m.GetConfig(name)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defaults := m.defaults
+	m.mu.RUnlock()
+
+	own, err := m.flattenStored(name)
+	if err != nil {
+		return nil, err
+	}
+	inherited, err := flattenYAML(defaults)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", DefaultsFile, err)
+	}
+	effective, err := flattenConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make([]InspectedField, 0, len(effective))
+	for path, value := range effective {
+		field := InspectedField{Path: path, Value: value, Source: SourceDefault}
+		if _, ok := own[path]; ok {
+			field.Source = SourceConfig
+		} else if _, ok := inherited[path]; ok {
+			field.Source = SourceDefaults
+		}
+
+		if raw, ok := value.(string); ok && expandedFields[path] {
+			if expanded := ExpandPath(raw); expanded != raw {
+				field.Value = expanded
+				field.Unexpanded = raw
+			}
+		}
+
+		fields = append(fields, field)
+	}
+
+	sort.Slice(fields, func(i, j int) bool { return fields[i].Path < fields[j].Path })
+	return fields, nil
+}
+
+// flattenStored flattens the YAML keys a tunnel's stored configuration
+// sets, which may be missing
+func (m *Manager) flattenStored(name string) (map[string]interface{}, error) {
+	m.mu.RLock()
+	data, err := m.store.Load(name)
+	m.mu.RUnlock()
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	flat, err := flattenYAML(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+	return flat, nil
+}
+
+// flattenYAML flattens raw YAML into dotted paths, as flattenConfig does
+func flattenYAML(data []byte) (map[string]interface{}, error) {
+	var tree map[string]interface{}
+	if err := yaml.Unmarshal(data, &tree); err != nil {
+		return nil, err
+	}
+
+	flat := make(map[string]interface{})
+	if tree != nil {
+		flattenValue("", tree, flat)
+	}
+	return flat, nil
+}
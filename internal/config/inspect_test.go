@@ -0,0 +1,58 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInspectConfigAnnotatesSources(t *testing.T) {
+	tempDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, DefaultsFile), []byte("cloud_server:\n  user: tunnel\n"), 0600))
+
+	tunnelsDir := filepath.Join(tempDir, "tunnels")
+	require.NoError(t, os.MkdirAll(tunnelsDir, 0755))
+	tunnel := `tunnel_name: home
+cloud_server:
+  ip: 203.0.113.10
+ssh:
+  private_key_path: ~/.ssh/cloud_key
+`
+	require.NoError(t, os.WriteFile(filepath.Join(tunnelsDir, "home.yaml"), []byte(tunnel), 0600))
+
+	manager, err := NewManager(tempDir)
+	require.NoError(t, err)
+
+	fields, err := manager.InspectConfig("home")
+	require.NoError(t, err)
+
+	byPath := make(map[string]InspectedField)
+	for _, field := range fields {
+		byPath[field.Path] = field
+	}
+
+	assert.Equal(t, SourceConfig, byPath["cloud_server.ip"].Source)
+	assert.Equal(t, SourceDefaults, byPath["cloud_server.user"].Source)
+	assert.Equal(t, "tunnel", byPath["cloud_server.user"].Value)
+	assert.Equal(t, SourceDefault, byPath["cloud_server.port"].Source)
+	assert.Equal(t, SourceDefault, byPath["service.auto_reconnect"].Source)
+
+	key := byPath["ssh.private_key_path"]
+	assert.Equal(t, SourceConfig, key.Source)
+	assert.Equal(t, "~/.ssh/cloud_key", key.Unexpanded)
+	assert.Equal(t, ExpandPath("~/.ssh/cloud_key"), key.Value)
+
+	_, timestamped := byPath["created_at"]
+	assert.False(t, timestamped)
+}
+
+func TestInspectConfigUnknownTunnel(t *testing.T) {
+	manager, err := NewManager(t.TempDir())
+	require.NoError(t, err)
+
+	_, err = manager.InspectConfig("missing")
+	assert.Error(t, err)
+}
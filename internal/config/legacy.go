@@ -0,0 +1,274 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// LegacyImport is the result of importing configuration from the old bash
+// version of the tool
+type LegacyImport struct {
+	// Configs holds one configuration per tunnel found
+	Configs []*Config
+	// Unmapped describes settings that could not be carried over
+	Unmapped []string
+}
+
+// legacyField applies a legacy variable to a configuration
+type legacyField func(cfg *Config, value string) error
+
+// legacyFields maps the variable names used by the bash version's .env files
+// and generated connect_<name>.sh scripts onto configuration fields
+var legacyFields = map[string]legacyField{
+	"TUNNEL_NAME":       func(cfg *Config, v string) error { cfg.TunnelName = v; return nil },
+	"CLOUD_IP":          func(cfg *Config, v string) error { cfg.CloudServer.IP = v; return nil },
+	"CLOUD_HOST":        func(cfg *Config, v string) error { cfg.CloudServer.IP = v; return nil },
+	"CLOUD_SERVER_IP":   func(cfg *Config, v string) error { cfg.CloudServer.IP = v; return nil },
+	"CLOUD_PORT":        legacyInt(func(cfg *Config, n int) { cfg.CloudServer.Port = n }),
+	"CLOUD_SSH_PORT":    legacyInt(func(cfg *Config, n int) { cfg.CloudServer.Port = n }),
+	"CLOUD_SERVER_PORT": legacyInt(func(cfg *Config, n int) { cfg.CloudServer.Port = n }),
+	"CLOUD_USER":        func(cfg *Config, v string) error { cfg.CloudServer.User = v; return nil },
+	"CLOUD_HOME":        func(cfg *Config, v string) error { cfg.CloudServer.HomeDir = v; return nil },
+	"NATTED_USER":       func(cfg *Config, v string) error { cfg.LocalServer.User = v; return nil },
+	"LOCAL_USER":        func(cfg *Config, v string) error { cfg.LocalServer.User = v; return nil },
+	"REVERSE_PORT":      legacyInt(func(cfg *Config, n int) { cfg.LocalServer.ReversePort = n }),
+	"SOCKS_PORT":        legacyInt(func(cfg *Config, n int) { cfg.LocalServer.SOCKSPort = n }),
+	"SSH_KEY":           func(cfg *Config, v string) error { cfg.SSH.PrivateKeyPath = v; return nil },
+	"CLOUD_KEY":         func(cfg *Config, v string) error { cfg.SSH.PrivateKeyPath = v; return nil },
+	"PRIVATE_KEY_PATH":  func(cfg *Config, v string) error { cfg.SSH.PrivateKeyPath = v; return nil },
+	"NATTED_KEY":        func(cfg *Config, v string) error { cfg.SSH.NattedKeyPath = v; return nil },
+	"SERVICE_NAME":      func(cfg *Config, v string) error { cfg.Service.Name = v; return nil },
+	"KEEPALIVE":         legacyInt(func(cfg *Config, n int) { cfg.Performance.KeepAliveInterval = n }),
+	"KEEP_ALIVE":        legacyInt(func(cfg *Config, n int) { cfg.Performance.KeepAliveInterval = n }),
+}
+
+// legacyIgnored are variables from the connect scripts that describe the
+// cloud-to-NAT'd-server hop and have no equivalent in the configuration
+var legacyIgnored = map[string]bool{
+	"NATTED_HOST": true,
+	"NATTED_PORT": true,
+}
+
+// legacyInt wraps an integer setter as a legacyField
+func legacyInt(set func(cfg *Config, n int)) legacyField {
+	return func(cfg *Config, v string) error {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", v)
+		}
+		set(cfg, n)
+		return nil
+	}
+}
+
+var (
+	legacyAssignment   = regexp.MustCompile(`^(?:export\s+)?([A-Za-z_][A-Za-z0-9_]*)=(.*)$`)
+	legacyScriptHeader = regexp.MustCompile(`^#\s*Connection script for reverse SSH tunnel:\s*(\S+)`)
+)
+
+// ImportLegacy reads configuration artifacts left by the bash version: a
+// .env file, a connect_<name>.sh script, or a directory containing either.
+// Artifacts describing the same tunnel are merged into one configuration.
+func ImportLegacy(path string) (*LegacyImport, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read legacy config: %w", err)
+	}
+
+	files := []string{path}
+	if info.IsDir() {
+		files, err = legacyFiles(path)
+		if err != nil {
+			return nil, err
+		}
+		if len(files) == 0 {
+			return nil, fmt.Errorf("no legacy .env or connect_*.sh files found in %s", path)
+		}
+	}
+
+	result := &LegacyImport{}
+	byName := make(map[string]*Config)
+	for _, file := range files {
+		if err := importLegacyFile(file, byName, result); err != nil {
+			return nil, err
+		}
+	}
+
+	names := make([]string, 0, len(byName))
+	for name := range byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		cfg := byName[name]
+		applyLegacyDefaults(cfg)
+		if cfg.CloudServer.IP == "" {
+			result.Unmapped = append(result.Unmapped, fmt.Sprintf("%s: cloud server address not found; set cloud_server.ip before starting", name))
+		}
+		if cfg.LocalServer.ReversePort == 0 {
+			result.Unmapped = append(result.Unmapped, fmt.Sprintf("%s: reverse port not found; set local_server.reverse_port before starting", name))
+		}
+		result.Configs = append(result.Configs, cfg)
+	}
+
+	return result, nil
+}
+
+// legacyFiles lists the legacy artifacts in a directory
+func legacyFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read legacy config directory: %w", err)
+	}
+
+	var files []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() {
+			continue
+		}
+		if name == ".env" || strings.HasSuffix(name, ".env") ||
+			(strings.HasPrefix(name, "connect_") && strings.HasSuffix(name, ".sh")) {
+			files = append(files, filepath.Join(dir, name))
+		}
+	}
+
+	return files, nil
+}
+
+// importLegacyFile parses a single legacy file into the config for the tunnel
+// it describes
+func importLegacyFile(path string, byName map[string]*Config, result *LegacyImport) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	base := filepath.Base(path)
+	name := ""
+	if strings.HasPrefix(base, "connect_") && strings.HasSuffix(base, ".sh") {
+		name = strings.TrimSuffix(strings.TrimPrefix(base, "connect_"), ".sh")
+	}
+
+	vars, order := parseShellAssignments(data)
+	for _, line := range strings.Split(string(data), "\n") {
+		if m := legacyScriptHeader.FindStringSubmatch(strings.TrimSpace(line)); m != nil {
+			name = m[1]
+			break
+		}
+	}
+	if v := vars["TUNNEL_NAME"]; v != "" {
+		name = v
+	}
+	if name == "" {
+		name = strings.TrimSuffix(strings.TrimPrefix(base, "."), ".env")
+		if name == "" || name == "env" {
+			name = "default"
+		}
+	}
+
+	cfg, ok := byName[name]
+	if !ok {
+		cfg = &Config{TunnelName: name}
+		byName[name] = cfg
+	}
+
+	for _, key := range order {
+		value := vars[key]
+		field, known := legacyFields[key]
+		switch {
+		case known:
+			if err := field(cfg, value); err != nil {
+				result.Unmapped = append(result.Unmapped, fmt.Sprintf("%s: %s: %v", base, key, err))
+			}
+		case legacyIgnored[key]:
+			// Describes the reverse hop; implied by the tunnel itself
+		default:
+			result.Unmapped = append(result.Unmapped, fmt.Sprintf("%s: unknown setting %s=%s", base, key, value))
+		}
+	}
+	cfg.TunnelName = name
+
+	return nil
+}
+
+// parseShellAssignments extracts top-level VAR=value assignments from a shell
+// script or .env file, returning the values and the order they appeared in
+func parseShellAssignments(data []byte) (map[string]string, []string) {
+	vars := make(map[string]string)
+	var order []string
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		m := legacyAssignment.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+
+		key, value := m[1], unquoteShellValue(m[2])
+		if _, seen := vars[key]; !seen {
+			order = append(order, key)
+		}
+		vars[key] = value
+	}
+
+	return vars, order
+}
+
+// unquoteShellValue strips quotes and trailing comments from a shell value
+func unquoteShellValue(value string) string {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return ""
+	}
+
+	if quote := value[0]; quote == '"' || quote == '\'' {
+		if end := strings.IndexByte(value[1:], quote); end >= 0 {
+			return value[1 : end+1]
+		}
+		return strings.Trim(value, string(quote))
+	}
+
+	if idx := strings.Index(value, " #"); idx >= 0 {
+		value = value[:idx]
+	}
+	return strings.TrimSpace(value)
+}
+
+// applyLegacyDefaults fills in the settings the bash version hard-coded
+func applyLegacyDefaults(cfg *Config) {
+	if cfg.CloudServer.Port == 0 {
+		cfg.CloudServer.Port = 22
+	}
+	if cfg.CloudServer.User == "" {
+		cfg.CloudServer.User = "root"
+	}
+	if cfg.SSH.PrivateKeyPath == "" {
+		cfg.SSH.PrivateKeyPath = "~/.ssh/cloud_server_key"
+	}
+	if cfg.SSH.NattedKeyPath == "" {
+		cfg.SSH.NattedKeyPath = "~/.ssh/natted_server_key_" + cfg.TunnelName
+	}
+	if cfg.Service.Name == "" {
+		cfg.Service.Name = "ssh-tunnel-" + cfg.TunnelName
+	}
+	if cfg.Service.RestartSec == 0 {
+		cfg.Service.AutoReconnect = true
+		cfg.Service.RestartSec = 30
+	}
+	if cfg.Performance.KeepAliveInterval == 0 {
+		cfg.Performance.KeepAliveInterval = 30
+	}
+	if cfg.Performance.KeepAliveCountMax == 0 {
+		cfg.Performance.KeepAliveCountMax = 3
+	}
+}
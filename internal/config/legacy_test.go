@@ -0,0 +1,43 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImportLegacyDirectory(t *testing.T) {
+	result, err := ImportLegacy("testdata/legacy")
+	require.NoError(t, err)
+	require.Len(t, result.Configs, 2)
+
+	// .env and connect_home.sh describe the same tunnel and are merged
+	home := result.Configs[0]
+	assert.Equal(t, "home", home.TunnelName)
+	assert.Equal(t, "203.0.113.10", home.CloudServer.IP)
+	assert.Equal(t, 2200, home.CloudServer.Port)
+	assert.Equal(t, "tunnel", home.CloudServer.User)
+	assert.Equal(t, "pi", home.LocalServer.User)
+	assert.Equal(t, 2222, home.LocalServer.ReversePort)
+	assert.Equal(t, "~/.ssh/cloud_server_key", home.SSH.PrivateKeyPath)
+	assert.Equal(t, "~/.ssh/natted_server_key_home", home.SSH.NattedKeyPath)
+	assert.Equal(t, "ssh-tunnel-home", home.Service.Name)
+
+	office := result.Configs[1]
+	assert.Equal(t, "office", office.TunnelName)
+	assert.Equal(t, "admin", office.LocalServer.User)
+	assert.Equal(t, 22, office.CloudServer.Port)
+
+	assert.ElementsMatch(t, []string{
+		".env: unknown setting MONITOR_INTERVAL=60",
+		`connect_office.sh: REVERSE_PORT: "abc" is not a number`,
+		"office: cloud server address not found; set cloud_server.ip before starting",
+		"office: reverse port not found; set local_server.reverse_port before starting",
+	}, result.Unmapped)
+}
+
+func TestImportLegacyMissingPath(t *testing.T) {
+	_, err := ImportLegacy("testdata/does-not-exist")
+	assert.Error(t, err)
+}
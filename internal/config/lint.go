@@ -0,0 +1,115 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// LintWarning is a problem found across several configurations, such as two
+// tunnels that cannot run at the same time
+type LintWarning struct {
+	Message string
+	Tunnels []string
+}
+
+func (w LintWarning) String() string {
+	return fmt.Sprintf("%s: %s", w.Message, strings.Join(w.Tunnels, ", "))
+}
+
+// LintConfigs checks configurations against each other. Tunnels listening on
+// the same port of a cloud server, with their reverse port or a remote
+// forward, or on the same local port, with a local forward or SOCKS proxy,
+// are bound to conflict, as are tunnels sharing a service name. Members of a
+// group must connect the same way to share an SSH process. Warnings are
+// sorted by message, and the tunnels in each by name.
+func LintConfigs(configs []*Config) []LintWarning {
+	endpoints := make(map[string][]string)
+	localPorts := make(map[string][]string)
+	services := make(map[string][]string)
+	groups := make(map[string][]*Config)
+	for _, cfg := range configs {
+		if cfg.CloudServer.IP != "" {
+			cloud := strings.ToLower(cfg.CloudServer.IP)
+			remotePorts := []int{cfg.LocalServer.ReversePort}
+			for _, forward := range cfg.LocalServer.RemoteForwards {
+				remotePorts = append(remotePorts, forward.RemotePort)
+			}
+			for _, port := range remotePorts {
+				if port > 0 {
+					addTunnel(endpoints, fmt.Sprintf("%s:%d", cloud, port), cfg.TunnelName)
+				}
+			}
+		}
+
+		ports := []int{cfg.LocalServer.SOCKSPort}
+		for _, forward := range cfg.LocalServer.LocalForwards {
+			ports = append(ports, forward.LocalPort)
+		}
+		for _, port := range ports {
+			if port > 0 {
+				addTunnel(localPorts, fmt.Sprintf("%d", port), cfg.TunnelName)
+			}
+		}
+
+		if cfg.Service.Name != "" {
+			addTunnel(services, cfg.Service.Name, cfg.TunnelName)
+		}
+		if cfg.Group != "" {
+			groups[cfg.Group] = append(groups[cfg.Group], cfg)
+		}
+	}
+
+	var warnings []LintWarning
+	for endpoint, names := range endpoints {
+		if len(names) > 1 {
+			sort.Strings(names)
+			warnings = append(warnings, LintWarning{
+				Message: fmt.Sprintf("remote endpoint %s is used by several tunnels", endpoint),
+				Tunnels: names,
+			})
+		}
+	}
+	for port, names := range localPorts {
+		if len(names) > 1 {
+			sort.Strings(names)
+			warnings = append(warnings, LintWarning{
+				Message: fmt.Sprintf("local port %s is used by several tunnels", port),
+				Tunnels: names,
+			})
+		}
+	}
+	for service, names := range services {
+		if len(names) > 1 {
+			sort.Strings(names)
+			warnings = append(warnings, LintWarning{
+				Message: fmt.Sprintf("service name '%s' is used by several tunnels", service),
+				Tunnels: names,
+			})
+		}
+	}
+	for group, members := range groups {
+		sort.Slice(members, func(i, j int) bool { return members[i].TunnelName < members[j].TunnelName })
+		for _, member := range members[1:] {
+			if err := sameEndpoint(members[0], member); err != nil {
+				warnings = append(warnings, LintWarning{
+					Message: fmt.Sprintf("group '%s' cannot share one connection: %v", group, err),
+					Tunnels: []string{members[0].TunnelName, member.TunnelName},
+				})
+			}
+		}
+	}
+
+	sort.Slice(warnings, func(i, j int) bool { return warnings[i].Message < warnings[j].Message })
+	return warnings
+}
+
+// addTunnel records that a tunnel uses key, once however often it does
+func addTunnel(users map[string][]string, key, name string) {
+	for _, user := range users[key] {
+		if user == name {
+			return
+		}
+	}
+	users[key] = append(users[key], name)
+}
@@ -0,0 +1,59 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLintConfigsReportsCollisions(t *testing.T) {
+	home := &Config{TunnelName: "home"}
+	home.CloudServer.IP = "203.0.113.1"
+	home.LocalServer.ReversePort = 2222
+	home.Service.Name = "ssh-tunnel-home"
+
+	copied := &Config{TunnelName: "home-copy"}
+	copied.CloudServer.IP = "203.0.113.1"
+	copied.LocalServer.ReversePort = 2222
+	copied.Service.Name = "ssh-tunnel-home"
+
+	office := &Config{TunnelName: "office"}
+	office.CloudServer.IP = "203.0.113.1"
+	office.LocalServer.ReversePort = 2223
+	office.Service.Name = "ssh-tunnel-office"
+
+	warnings := LintConfigs([]*Config{office, copied, home})
+	assert.Equal(t, []LintWarning{
+		{Message: "remote endpoint 203.0.113.1:2222 is used by several tunnels", Tunnels: []string{"home", "home-copy"}},
+		{Message: "service name 'ssh-tunnel-home' is used by several tunnels", Tunnels: []string{"home", "home-copy"}},
+	}, warnings)
+
+	assert.Empty(t, LintConfigs([]*Config{home, office}))
+}
+
+func TestLintConfigsReportsForwardAndGroupConflicts(t *testing.T) {
+	home := &Config{TunnelName: "home", Group: "lab"}
+	home.CloudServer.IP = "203.0.113.1"
+	home.CloudServer.User = "tunnel"
+	home.LocalServer.ReversePort = 2222
+	home.LocalServer.LocalForwards = []ForwardConfig{{LocalPort: 8080, RemoteHost: "localhost", RemotePort: 80}}
+
+	// Its remote forward takes the cloud port home reverses, and it binds
+	// the local port home forwards, twice
+	office := &Config{TunnelName: "office", Group: "lab"}
+	office.CloudServer.IP = "203.0.113.1"
+	office.CloudServer.User = "admin"
+	office.LocalServer.ReversePort = 2223
+	office.LocalServer.RemoteForwards = []RemoteForwardConfig{{RemotePort: 2222, LocalHost: "localhost", LocalPort: 80}}
+	office.LocalServer.LocalForwards = []ForwardConfig{
+		{LocalPort: 8080, RemoteHost: "localhost", RemotePort: 80},
+		{BindAddr: "0.0.0.0", LocalPort: 8080, RemoteHost: "localhost", RemotePort: 81},
+	}
+
+	warnings := LintConfigs([]*Config{office, home})
+	assert.Equal(t, []LintWarning{
+		{Message: "group 'lab' cannot share one connection: tunnel 'office' logs in as admin, not tunnel like 'home'", Tunnels: []string{"home", "office"}},
+		{Message: "local port 8080 is used by several tunnels", Tunnels: []string{"home", "office"}},
+		{Message: "remote endpoint 203.0.113.1:2222 is used by several tunnels", Tunnels: []string{"home", "office"}},
+	}, warnings)
+}
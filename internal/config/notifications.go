@@ -0,0 +1,49 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Webhook payload formats
+const (
+	// WebhookFormatRaw posts the event as the tool's own JSON
+	WebhookFormatRaw = "raw"
+	// WebhookFormatSlack posts a Slack incoming webhook message
+	WebhookFormatSlack = "slack"
+	// WebhookFormatDiscord posts a Discord webhook message
+	WebhookFormatDiscord = "discord"
+)
+
+// WebhookFormat returns the payload format for the webhook: Format if set,
+// otherwise slack or discord for those services' webhook URLs, and raw for
+// anything else
+func (n NotificationConfig) WebhookFormat() string {
+	if n.Format != "" {
+		return strings.ToLower(n.Format)
+	}
+
+	u, err := url.Parse(n.WebhookURL)
+	if err != nil {
+		return WebhookFormatRaw
+	}
+	host := strings.ToLower(u.Hostname())
+	switch {
+	case host == "hooks.slack.com":
+		return WebhookFormatSlack
+	case (host == "discord.com" || host == "discordapp.com" || strings.HasSuffix(host, ".discord.com")) &&
+		strings.HasPrefix(u.Path, "/api/webhooks/"):
+		return WebhookFormatDiscord
+	}
+	return WebhookFormatRaw
+}
+
+// ValidateFormat checks that Format, if set, is a known payload format
+func (n NotificationConfig) ValidateFormat() error {
+	switch strings.ToLower(n.Format) {
+	case "", WebhookFormatRaw, WebhookFormatSlack, WebhookFormatDiscord:
+		return nil
+	}
+	return fmt.Errorf("unknown notification format '%s' (use raw, slack or discord)", n.Format)
+}
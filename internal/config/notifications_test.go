@@ -0,0 +1,34 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhookFormat(t *testing.T) {
+	tests := []struct {
+		name string
+		n    NotificationConfig
+		want string
+	}{
+		{"slack url", NotificationConfig{WebhookURL: "https://hooks.slack.com/services/T0/B0/x"}, WebhookFormatSlack},
+		{"discord url", NotificationConfig{WebhookURL: "https://discord.com/api/webhooks/1/abc"}, WebhookFormatDiscord},
+		{"legacy discord url", NotificationConfig{WebhookURL: "https://discordapp.com/api/webhooks/1/abc"}, WebhookFormatDiscord},
+		{"other url", NotificationConfig{WebhookURL: "https://alerts.example.com/hook"}, WebhookFormatRaw},
+		{"explicit format wins", NotificationConfig{WebhookURL: "https://hooks.slack.com/services/x", Format: "Raw"}, WebhookFormatRaw},
+		{"slack-compatible proxy", NotificationConfig{WebhookURL: "https://chat.example.com/hooks/x", Format: "slack"}, WebhookFormatSlack},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.n.WebhookFormat())
+		})
+	}
+}
+
+func TestValidateNotificationFormat(t *testing.T) {
+	assert.NoError(t, NotificationConfig{}.ValidateFormat())
+	assert.NoError(t, NotificationConfig{Format: "discord"}.ValidateFormat())
+	assert.EqualError(t, NotificationConfig{Format: "teams"}.ValidateFormat(),
+		"unknown notification format 'teams' (use raw, slack or discord)")
+}
@@ -0,0 +1,64 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Preflight checks a configuration before a tunnel is started: everything
+// Validate checks, plus the fields SSH needs and the files it reads. Every
+// problem found is reported, each with how to fix it. It does not touch the
+// network; the diagnostics command checks the cloud server itself.
+func (c *Config) Preflight() error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+
+	var problems []error
+	if c.CloudServer.IP == "" {
+		problems = append(problems, errors.New("cloud_server.ip is empty; set it to the cloud server's address"))
+	}
+	if c.CloudServer.User == "" && c.SSH.ConfigFile == "" {
+		problems = append(problems, errors.New("cloud_server.user is empty; set it to the user the tunnel logs in as"))
+	}
+	if c.LocalServer.ReversePort < 1 || c.LocalServer.ReversePort > 65535 {
+		problems = append(problems, fmt.Errorf("local_server.reverse_port %d must be from 1 to 65535", c.LocalServer.ReversePort))
+	}
+
+	if err := checkFile("ssh.private_key_path", c.SSH.PrivateKeyPath); err != nil {
+		problems = append(problems, fmt.Errorf("%w; create the key with ssh-keygen or fix the path", err))
+	}
+	// A renew command fetches a missing certificate before connecting
+	if c.SSH.CertRenewCommand == "" {
+		if err := checkFile("ssh.certificate_path", c.SSH.CertificatePath); err != nil {
+			problems = append(problems, err)
+		}
+	}
+	if err := checkFile("ssh.known_hosts_file", c.SSH.KnownHostsFile); err != nil {
+		problems = append(problems, fmt.Errorf("%w; trust the cloud server with 'ssh-tunnel setup' or unset it to use ~/.ssh/known_hosts", err))
+	}
+
+	return errors.Join(problems...)
+}
+
+// checkFile checks that a path set in a config field is a readable file.
+// An empty path is not checked.
+func checkFile(field, path string) error {
+	if path == "" {
+		return nil
+	}
+
+	expanded := ExpandPath(path)
+	info, err := os.Stat(expanded)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%s: %s does not exist", field, expanded)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", field, err)
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s: %s is a directory", field, expanded)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// preflightConfig returns a configuration whose key file exists
+func preflightConfig(t *testing.T) *Config {
+	t.Helper()
+
+	keyPath := filepath.Join(t.TempDir(), "id_ed25519")
+	require.NoError(t, os.WriteFile(keyPath, []byte("key"), 0600))
+	return &Config{
+		TunnelName:  "home",
+		CloudServer: CloudServerConfig{IP: "203.0.113.1", Port: 22, User: "tunnel"},
+		LocalServer: LocalServerConfig{User: "pi", ReversePort: 2222},
+		SSH:         SSHConfig{PrivateKeyPath: keyPath},
+	}
+}
+
+func TestPreflightAcceptsValidConfig(t *testing.T) {
+	assert.NoError(t, preflightConfig(t).Preflight())
+}
+
+func TestPreflightReportsEveryProblem(t *testing.T) {
+	cfg := preflightConfig(t)
+	dir := t.TempDir()
+	cfg.CloudServer.IP = ""
+	cfg.LocalServer.ReversePort = 70000
+	cfg.SSH.PrivateKeyPath = filepath.Join(dir, "missing")
+	cfg.SSH.KnownHostsFile = dir
+
+	err := cfg.Preflight()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cloud_server.ip is empty")
+	assert.Contains(t, err.Error(), "local_server.reverse_port 70000")
+	assert.Contains(t, err.Error(), "ssh.private_key_path: "+filepath.Join(dir, "missing")+" does not exist")
+	assert.Contains(t, err.Error(), "ssh.known_hosts_file: "+dir+" is a directory")
+}
+
+func TestPreflightCertificate(t *testing.T) {
+	cfg := preflightConfig(t)
+	cfg.SSH.CertificatePath = filepath.Join(t.TempDir(), "id_ed25519-cert.pub")
+	assert.ErrorContains(t, cfg.Preflight(), "ssh.certificate_path")
+
+	// The renew command fetches it before connecting
+	cfg.SSH.CertRenewCommand = "step ssh certificate"
+	assert.NoError(t, cfg.Preflight())
+}
+
+func TestPreflightRunsValidate(t *testing.T) {
+	cfg := preflightConfig(t)
+	cfg.SSH.Ciphers = "rot13"
+	assert.ErrorContains(t, cfg.Preflight(), "unknown algorithm")
+}
@@ -0,0 +1,129 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// DefaultProfile is the config profile kept directly in the base config
+// directory, which is active until another profile is selected
+const DefaultProfile = "default"
+
+const (
+	// profilesDir is the subdirectory of the base config directory holding
+	// the other config profiles
+	profilesDir = "profiles"
+	// currentProfileFile names the active config profile
+	currentProfileFile = "current-profile"
+)
+
+// validProfileName matches names usable as profile directory names
+var validProfileName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// ProfilePath returns the config directory of a config profile. Each profile
+// is a complete, separate set of tunnels, defaults, logs and locks.
+func ProfilePath(basePath, name string) string {
+	if name == DefaultProfile {
+		return basePath
+	}
+	return filepath.Join(basePath, profilesDir, name)
+}
+
+// CurrentProfile returns the name of the active config profile
+func CurrentProfile(basePath string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(basePath, currentProfileFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return DefaultProfile, nil
+		}
+		return "", fmt.Errorf("failed to read current profile: %w", err)
+	}
+
+	name := strings.TrimSpace(string(data))
+	if name == "" {
+		return DefaultProfile, nil
+	}
+	return name, nil
+}
+
+// ActiveProfilePath returns the config directory of the active config
+// profile, failing if the profile has been removed
+func ActiveProfilePath(basePath string) (string, error) {
+	name, err := CurrentProfile(basePath)
+	if err != nil {
+		return "", err
+	}
+
+	path := ProfilePath(basePath, name)
+	if name != DefaultProfile {
+		if _, err := os.Stat(path); err != nil {
+			return "", fmt.Errorf("active profile '%s' is missing (%s); switch with 'ssh-tunnel profile use'", name, path)
+		}
+	}
+	return path, nil
+}
+
+// CreateProfile creates an empty config profile
+func CreateProfile(basePath, name string) error {
+	if !validProfileName.MatchString(name) {
+		return fmt.Errorf("invalid profile name %q: use letters, digits, '.', '_' and '-'", name)
+	}
+	if name == DefaultProfile {
+		return fmt.Errorf("profile '%s' already exists", name)
+	}
+
+	path := ProfilePath(basePath, name)
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("profile '%s' already exists", name)
+	}
+
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return fmt.Errorf("failed to create profile directory: %w", err)
+	}
+	return nil
+}
+
+// UseProfile makes a config profile the active one
+func UseProfile(basePath, name string) error {
+	profiles, err := ListProfiles(basePath)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(profiles, name) {
+		return fmt.Errorf("profile '%s' not found", name)
+	}
+
+	if err := os.MkdirAll(basePath, 0755); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(basePath, currentProfileFile), []byte(name+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to save current profile: %w", err)
+	}
+	return nil
+}
+
+// ListProfiles returns the config profiles, the default profile first and
+// the rest sorted by name
+func ListProfiles(basePath string) ([]string, error) {
+	profiles := []string{DefaultProfile}
+
+	entries, err := os.ReadDir(filepath.Join(basePath, profilesDir))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read profiles directory: %w", err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() && validProfileName.MatchString(entry.Name()) {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+
+	return append(profiles, names...), nil
+}
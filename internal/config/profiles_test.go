@@ -0,0 +1,86 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSwitchProfiles(t *testing.T) {
+	base := t.TempDir()
+
+	current, err := CurrentProfile(base)
+	require.NoError(t, err)
+	assert.Equal(t, DefaultProfile, current)
+
+	path, err := ActiveProfilePath(base)
+	require.NoError(t, err)
+	assert.Equal(t, base, path)
+
+	require.NoError(t, CreateProfile(base, "client-b"))
+	require.NoError(t, CreateProfile(base, "client-a"))
+	assert.Error(t, CreateProfile(base, "client-a"), "duplicate profile")
+
+	profiles, err := ListProfiles(base)
+	require.NoError(t, err)
+	assert.Equal(t, []string{DefaultProfile, "client-a", "client-b"}, profiles)
+
+	require.NoError(t, UseProfile(base, "client-a"))
+	current, err = CurrentProfile(base)
+	require.NoError(t, err)
+	assert.Equal(t, "client-a", current)
+
+	path, err = ActiveProfilePath(base)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(base, "profiles", "client-a"), path)
+
+	require.NoError(t, UseProfile(base, DefaultProfile))
+	path, err = ActiveProfilePath(base)
+	require.NoError(t, err)
+	assert.Equal(t, base, path)
+
+	assert.Error(t, UseProfile(base, "client-c"), "unknown profile")
+}
+
+func TestProfilesAreIsolated(t *testing.T) {
+	base := t.TempDir()
+	require.NoError(t, CreateProfile(base, "client-a"))
+	require.NoError(t, CreateProfile(base, "client-b"))
+
+	managerA, err := NewManager(ProfilePath(base, "client-a"))
+	require.NoError(t, err)
+	require.NoError(t, managerA.SaveConfig(&Config{TunnelName: "db"}))
+
+	managerB, err := NewManager(ProfilePath(base, "client-b"))
+	require.NoError(t, err)
+	assert.Empty(t, managerB.ListConfigs())
+
+	defaultManager, err := NewManager(ProfilePath(base, DefaultProfile))
+	require.NoError(t, err)
+	assert.Empty(t, defaultManager.ListConfigs())
+
+	reloadedA, err := NewManager(ProfilePath(base, "client-a"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"db"}, reloadedA.ListConfigs())
+}
+
+func TestInvalidProfileNames(t *testing.T) {
+	base := t.TempDir()
+	for _, name := range []string{"", "../escape", "a/b", ".hidden", DefaultProfile} {
+		assert.Error(t, CreateProfile(base, name), name)
+	}
+}
+
+func TestMissingActiveProfile(t *testing.T) {
+	base := t.TempDir()
+	require.NoError(t, CreateProfile(base, "gone"))
+	require.NoError(t, UseProfile(base, "gone"))
+	require.NoError(t, os.RemoveAll(ProfilePath(base, "gone")))
+
+	_, err := ActiveProfilePath(base)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "profile use")
+}
@@ -0,0 +1,275 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/lerndmina/SSH-Tunnel/pkg/logger"
+)
+
+// DefaultRemoteTimeout bounds each request to a remote config store
+const DefaultRemoteTimeout = 30 * time.Second
+
+// maxRemoteDocument is the largest response read from a remote config store
+const maxRemoteDocument = 1 << 20
+
+var (
+	// ErrReadOnlyStore is returned by Save and Delete on a store that does
+	// not accept changes
+	ErrReadOnlyStore = errors.New("config store is read-only")
+	// errRemoteUnavailable marks requests that could not reach a remote
+	// store or that it failed to serve, which fall back to the cache
+	errRemoteUnavailable = errors.New("config store unavailable")
+)
+
+// HTTPStore reads tunnel configurations from an HTTP server, so a fleet of
+// devices can pull their tunnels from one place. Each tunnel is the document
+// <URL>/<name>.yaml, and the base URL lists them, either as a JSON array of
+// tunnel names or as an XML ListBucketResult whose top-level .yaml keys name
+// the tunnels. Truncated listings are followed page by page. Requests are
+// only authenticated with a bearer token, not signed, so a bucket has to be
+// served through something that accepts the token.
+//
+// Every document fetched is copied to the cache, if one is given, and read
+// from there while the remote is unreachable or failing, so devices still
+// start their tunnels offline. The store is read-only unless Writable is
+// set.
+type HTTPStore struct {
+	base   *url.URL
+	token  string
+	cache  Store
+	client *http.Client
+	// Writable makes Save PUT and Delete DELETE the remote documents
+	Writable bool
+}
+
+// NewHTTPStore returns a store reading tunnels from the http or https URL
+// rawURL. A token, if given, is sent as a bearer token; cache may be nil.
+func NewHTTPStore(rawURL, token string, cache Store) (*HTTPStore, error) {
+	base, err := url.Parse(rawURL)
+	if err != nil || (base.Scheme != "http" && base.Scheme != "https") || base.Host == "" {
+		return nil, fmt.Errorf("invalid config store URL %q: must be an http or https URL", rawURL)
+	}
+	base.Path = strings.TrimSuffix(base.Path, "/") + "/"
+
+	return &HTTPStore{
+		base:   base,
+		token:  token,
+		cache:  cache,
+		client: &http.Client{Timeout: DefaultRemoteTimeout},
+	}, nil
+}
+
+// Path returns the URL of a tunnel's document
+func (s *HTTPStore) Path(name string) string {
+	return s.base.JoinPath(name + ".yaml").String()
+}
+
+func (s *HTTPStore) Load(name string) ([]byte, error) {
+	data, err := s.request(http.MethodGet, s.Path(name), nil)
+	if errors.Is(err, errRemoteUnavailable) && s.cache != nil {
+		if cached, cacheErr := s.cache.Load(name); cacheErr == nil {
+			logger.Warnf("Using cached configuration of tunnel '%s': %v", name, err)
+			return cached, nil
+		}
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		s.uncache(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if s.cache != nil {
+		if err := s.cache.Save(name, data); err != nil {
+			logger.Warnf("Failed to cache configuration of tunnel '%s': %v", name, err)
+		}
+	}
+	return data, nil
+}
+
+func (s *HTTPStore) List() ([]string, error) {
+	names, err := s.listRemote()
+	if errors.Is(err, errRemoteUnavailable) && s.cache != nil {
+		if names, cacheErr := s.cache.List(); cacheErr == nil {
+			logger.Warnf("Using cached tunnel configurations: %v", err)
+			return names, nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Forget cached tunnels the remote no longer has
+	if s.cache != nil {
+		cached, _ := s.cache.List()
+		for _, name := range cached {
+			if !slices.Contains(names, name) {
+				s.uncache(name)
+			}
+		}
+	}
+	return names, nil
+}
+
+// listRemote reads the tunnel names from the remote's listing, requesting
+// each further page of a truncated one
+func (s *HTTPStore) listRemote() ([]string, error) {
+	var names []string
+	target := *s.base
+	for {
+		data, err := s.request(http.MethodGet, target.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		page, next, err := parseListing(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tunnel list from %s: %w", s.base, err)
+		}
+		names = append(names, page...)
+
+		if next == nil {
+			return names, nil
+		}
+		if next.Encode() == target.RawQuery {
+			return nil, fmt.Errorf("failed to read tunnel list from %s: listing repeats the page %s", s.base, target.RawQuery)
+		}
+		target.RawQuery = next.Encode()
+	}
+}
+
+func (s *HTTPStore) Save(name string, data []byte) error {
+	if !s.Writable {
+		return fmt.Errorf("cannot save tunnel '%s' to %s: %w", name, s.base, ErrReadOnlyStore)
+	}
+	if _, err := s.request(http.MethodPut, s.Path(name), data); err != nil {
+		return err
+	}
+	if s.cache != nil {
+		if err := s.cache.Save(name, data); err != nil {
+			logger.Warnf("Failed to cache configuration of tunnel '%s': %v", name, err)
+		}
+	}
+	return nil
+}
+
+func (s *HTTPStore) Delete(name string) error {
+	if !s.Writable {
+		return fmt.Errorf("cannot delete tunnel '%s' from %s: %w", name, s.base, ErrReadOnlyStore)
+	}
+	if _, err := s.request(http.MethodDelete, s.Path(name), nil); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	s.uncache(name)
+	return nil
+}
+
+// uncache removes a tunnel from the cache
+func (s *HTTPStore) uncache(name string) {
+	if s.cache == nil {
+		return
+	}
+	if err := s.cache.Delete(name); err != nil {
+		logger.Warnf("Failed to remove cached configuration of tunnel '%s': %v", name, err)
+	}
+}
+
+// request sends a request to the remote and returns the response body. A
+// 404 is an error wrapping fs.ErrNotExist; connection failures and 5xx
+// responses wrap errRemoteUnavailable. Other failures, such as a rejected
+// token, wrap neither, so they are not hidden by the cache.
+func (s *HTTPStore) request(method, target string, body []byte) ([]byte, error) {
+	req, err := http.NewRequest(method, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/yaml")
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errRemoteUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxRemoteDocument))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s %s: %w", errRemoteUnavailable, method, target, err)
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, fmt.Errorf("%s %s: %w", method, target, fs.ErrNotExist)
+	case resp.StatusCode >= 500:
+		return nil, fmt.Errorf("%w: %s %s: %s", errRemoteUnavailable, method, target, resp.Status)
+	case resp.StatusCode >= 300:
+		return nil, fmt.Errorf("%s %s: %s", method, target, resp.Status)
+	}
+	return data, nil
+}
+
+// parseListing reads the tunnel names from a remote store's listing: a JSON
+// array of names, or an XML ListBucketResult. For a truncated
+// ListBucketResult it also returns the query requesting the next page.
+func parseListing(data []byte) ([]string, url.Values, error) {
+	data = bytes.TrimSpace(data)
+
+	var names []string
+	var next url.Values
+	if bytes.HasPrefix(data, []byte("<")) {
+		var result struct {
+			Contents []struct {
+				Key string `xml:"Key"`
+			} `xml:"Contents"`
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+			NextMarker            string `xml:"NextMarker"`
+		}
+		if err := xml.Unmarshal(data, &result); err != nil {
+			return nil, nil, err
+		}
+		for _, object := range result.Contents {
+			name, ok := strings.CutSuffix(object.Key, ".yaml")
+			if ok && !strings.Contains(name, "/") {
+				names = append(names, name)
+			}
+		}
+
+		// Version 2 listings continue from a token, version 1 listings from
+		// the last key seen
+		switch {
+		case !result.IsTruncated:
+		case result.NextContinuationToken != "":
+			next = url.Values{"list-type": {"2"}, "continuation-token": {result.NextContinuationToken}}
+		case result.NextMarker != "":
+			next = url.Values{"marker": {result.NextMarker}}
+		case len(result.Contents) > 0:
+			next = url.Values{"marker": {result.Contents[len(result.Contents)-1].Key}}
+		default:
+			return nil, nil, errors.New("truncated listing without a way to continue it")
+		}
+	} else if err := json.Unmarshal(data, &names); err != nil {
+		return nil, nil, err
+	}
+
+	for _, name := range names {
+		if err := checkTunnelName(name); err != nil {
+			return nil, nil, err
+		}
+	}
+	return names, next, nil
+}
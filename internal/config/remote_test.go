@@ -0,0 +1,221 @@
+package config
+
+import (
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockRemote is an HTTP config store serving tunnel documents from memory,
+// requiring a bearer token
+type mockRemote struct {
+	mu     sync.Mutex
+	docs   map[string]string
+	token  string
+	failed bool
+	s3     bool
+	// s3Page, if set, truncates bucket listings after this many tunnels
+	s3Page int
+}
+
+func (r *mockRemote) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.failed {
+		http.Error(w, "maintenance", http.StatusServiceUnavailable)
+		return
+	}
+	if req.Header.Get("Authorization") != "Bearer "+r.token {
+		http.Error(w, "no", http.StatusUnauthorized)
+		return
+	}
+
+	name, isDoc := strings.CutSuffix(strings.TrimPrefix(req.URL.Path, "/fleet/"), ".yaml")
+	if !isDoc {
+		var names []string
+		for name := range r.docs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		if r.s3 {
+			start, _ := strconv.Atoi(req.URL.Query().Get("continuation-token"))
+			names = names[start:]
+			truncated := r.s3Page > 0 && len(names) > r.s3Page
+			if truncated {
+				names = names[:r.s3Page]
+			}
+			io.WriteString(w, `<?xml version="1.0" encoding="UTF-8"?><ListBucketResult><Name>fleet</Name>`)
+			for _, name := range names {
+				io.WriteString(w, "<Contents><Key>"+name+".yaml</Key></Contents>")
+			}
+			if truncated {
+				io.WriteString(w, "<IsTruncated>true</IsTruncated><NextContinuationToken>"+strconv.Itoa(start+r.s3Page)+"</NextContinuationToken></ListBucketResult>")
+				return
+			}
+			io.WriteString(w, "<Contents><Key>archive/old.yaml</Key></Contents><Contents><Key>README.md</Key></Contents></ListBucketResult>")
+			return
+		}
+		io.WriteString(w, `["`+strings.Join(names, `","`)+`"]`)
+		return
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+		doc, exists := r.docs[name]
+		if !exists {
+			http.NotFound(w, req)
+			return
+		}
+		io.WriteString(w, doc)
+	case http.MethodPut:
+		data, _ := io.ReadAll(req.Body)
+		r.docs[name] = string(data)
+	case http.MethodDelete:
+		delete(r.docs, name)
+	}
+}
+
+func (r *mockRemote) set(change func(r *mockRemote)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	change(r)
+}
+
+func newMockRemote(t *testing.T) (*mockRemote, *httptest.Server) {
+	t.Helper()
+
+	remote := &mockRemote{
+		token: "fleet-token",
+		docs: map[string]string{
+			"home":   "tunnel_name: home\ncloud_server:\n  ip: 203.0.113.1\nlocal_server:\n  reverse_port: 2222\n",
+			"office": "tunnel_name: office\ncloud_server:\n  ip: 203.0.113.2\nlocal_server:\n  reverse_port: 2223\n",
+		},
+	}
+	server := httptest.NewServer(remote)
+	t.Cleanup(server.Close)
+	return remote, server
+}
+
+func TestHTTPStoreLoadsAndCaches(t *testing.T) {
+	remote, server := newMockRemote(t)
+	cache := NewFileStore(filepath.Join(t.TempDir(), "remote-cache"))
+	store, err := NewHTTPStore(server.URL+"/fleet", "fleet-token", cache)
+	require.NoError(t, err)
+
+	manager, err := NewManagerWithStore(t.TempDir(), store)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"home", "office"}, manager.ListConfigs())
+	home, err := manager.GetConfig("home")
+	require.NoError(t, err)
+	assert.Equal(t, "203.0.113.1", home.CloudServer.IP)
+
+	// The store is read-only
+	home.CloudServer.IP = "198.51.100.1"
+	assert.ErrorIs(t, manager.SaveConfig(home), ErrReadOnlyStore)
+	assert.ErrorIs(t, manager.DeleteConfig("office"), ErrReadOnlyStore)
+
+	// While the remote fails, the cached copies are used
+	remote.set(func(r *mockRemote) { r.failed = true })
+	offline, err := NewManagerWithStore(t.TempDir(), store)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"home", "office"}, offline.ListConfigs())
+	home, err = offline.ReloadConfig("home")
+	require.NoError(t, err)
+	assert.Equal(t, "203.0.113.1", home.CloudServer.IP)
+
+	// Tunnels removed from the remote are dropped from the cache
+	remote.set(func(r *mockRemote) {
+		r.failed = false
+		delete(r.docs, "office")
+	})
+	require.NoError(t, offline.Reload())
+	assert.Equal(t, []string{"home"}, offline.ListConfigs())
+	_, err = cache.Load("office")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestHTTPStoreRejectedToken(t *testing.T) {
+	_, server := newMockRemote(t)
+	cache := NewFileStore(filepath.Join(t.TempDir(), "remote-cache"))
+	require.NoError(t, cache.Save("home", []byte("tunnel_name: home\n")))
+
+	// A rejected token is reported rather than hidden by the cache
+	store, err := NewHTTPStore(server.URL+"/fleet/", "wrong", cache)
+	require.NoError(t, err)
+	_, err = store.List()
+	assert.ErrorContains(t, err, "401 Unauthorized")
+	_, err = store.Load("home")
+	assert.ErrorContains(t, err, "401 Unauthorized")
+}
+
+func TestHTTPStoreS3Listing(t *testing.T) {
+	remote, server := newMockRemote(t)
+	remote.set(func(r *mockRemote) { r.s3 = true })
+	store, err := NewHTTPStore(server.URL+"/fleet", "fleet-token", nil)
+	require.NoError(t, err)
+
+	names, err := store.List()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"home", "office"}, names)
+}
+
+func TestHTTPStoreFollowsTruncatedListing(t *testing.T) {
+	remote, server := newMockRemote(t)
+	remote.set(func(r *mockRemote) {
+		r.s3 = true
+		r.s3Page = 1
+		r.docs["lab"] = "tunnel_name: lab\n"
+	})
+	store, err := NewHTTPStore(server.URL+"/fleet", "fleet-token", nil)
+	require.NoError(t, err)
+
+	names, err := store.List()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"home", "lab", "office"}, names)
+}
+
+func TestParseListingContinuesVersion1Listings(t *testing.T) {
+	names, next, err := parseListing([]byte(`<ListBucketResult><IsTruncated>true</IsTruncated><Contents><Key>home.yaml</Key></Contents></ListBucketResult>`))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"home"}, names)
+	assert.Equal(t, "marker=home.yaml", next.Encode())
+
+	_, next, err = parseListing([]byte(`["home"]`))
+	require.NoError(t, err)
+	assert.Nil(t, next)
+}
+
+func TestHTTPStoreWritable(t *testing.T) {
+	remote, server := newMockRemote(t)
+	store, err := NewHTTPStore(server.URL+"/fleet", "fleet-token", nil)
+	require.NoError(t, err)
+	store.Writable = true
+
+	manager, err := NewManagerWithStore(t.TempDir(), store)
+	require.NoError(t, err)
+	require.NoError(t, manager.SaveConfig(&Config{TunnelName: "lab", LocalServer: LocalServerConfig{ReversePort: 2224}}))
+	require.NoError(t, manager.DeleteConfig("office"))
+
+	remote.set(func(r *mockRemote) {
+		assert.Contains(t, r.docs["lab"], "reverse_port: 2224")
+		assert.NotContains(t, r.docs, "office")
+	})
+	_, err = store.Load("office")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestNewHTTPStoreRejectsOtherSchemes(t *testing.T) {
+	_, err := NewHTTPStore("ftp://example.com/fleet", "", nil)
+	assert.ErrorContains(t, err, "must be an http or https URL")
+}
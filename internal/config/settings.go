@@ -0,0 +1,107 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SettingsFile is the name of the file in the config directory holding
+// settings for the tool itself rather than for any one tunnel
+const SettingsFile = "settings.yaml"
+
+// DefaultBackupKeep is how many automatic backups are kept when
+// backup.keep is not set
+const DefaultBackupKeep = 10
+
+// Settings contains settings for the tool itself
+type Settings struct {
+	Backup    BackupSettings   `yaml:"backup" json:"backup"`
+	Templates TemplateSettings `yaml:"templates" json:"templates"`
+	Daemon    DaemonSettings   `yaml:"daemon" json:"daemon"`
+}
+
+// BackupSettings controls automatic backups taken by the daemon
+type BackupSettings struct {
+	// Interval, if set, takes an automatic backup this often, e.g. "24h"
+	Interval time.Duration `yaml:"interval,omitempty" json:"interval,omitempty"`
+	// OnChange takes an automatic backup whenever a configuration changes
+	OnChange bool `yaml:"on_change,omitempty" json:"on_change,omitempty"`
+	// Keep is how many automatic backups are kept (default 10)
+	Keep int `yaml:"keep,omitempty" json:"keep,omitempty"`
+}
+
+// TemplateSettings controls how templates are applied
+type TemplateSettings struct {
+	// PortRange, e.g. "2200-2299", makes template apply assign each new
+	// tunnel the lowest reverse port in the range no tunnel uses yet
+	PortRange string `yaml:"port_range,omitempty" json:"port_range,omitempty"`
+}
+
+// DefaultHealthBind is the address the daemon's health endpoint listens on
+// when daemon.health_bind is not set
+const DefaultHealthBind = "127.0.0.1"
+
+// DaemonSettings controls the daemon
+type DaemonSettings struct {
+	// HealthPort, if set, serves /healthz and /readyz over HTTP on this
+	// port, on HealthBind (default 127.0.0.1)
+	HealthPort int    `yaml:"health_port,omitempty" json:"health_port,omitempty"`
+	HealthBind string `yaml:"health_bind,omitempty" json:"health_bind,omitempty"`
+}
+
+// HealthAddr returns the address the health endpoint listens on, or "" if
+// it is off
+func (d DaemonSettings) HealthAddr() string {
+	if d.HealthPort <= 0 {
+		return ""
+	}
+	bind := d.HealthBind
+	if bind == "" {
+		bind = DefaultHealthBind
+	}
+	return net.JoinHostPort(bind, strconv.Itoa(d.HealthPort))
+}
+
+// Enabled reports whether automatic backups are configured
+func (b BackupSettings) Enabled() bool {
+	return b.Interval > 0 || b.OnChange
+}
+
+// KeepCount returns how many automatic backups to keep
+func (b BackupSettings) KeepCount() int {
+	if b.Keep <= 0 {
+		return DefaultBackupKeep
+	}
+	return b.Keep
+}
+
+// LoadSettings reads the settings file in configPath. A missing file gives
+// the zero settings.
+func LoadSettings(configPath string) (*Settings, error) {
+	settings := &Settings{}
+
+	data, err := os.ReadFile(filepath.Join(configPath, SettingsFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return settings, nil
+		}
+		return nil, err
+	}
+
+	if err := yaml.Unmarshal(data, settings); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", SettingsFile, err)
+	}
+	if settings.Backup.Interval < 0 {
+		return nil, fmt.Errorf("%s: backup.interval must not be negative", SettingsFile)
+	}
+	if settings.Daemon.HealthPort < 0 || settings.Daemon.HealthPort > 65535 {
+		return nil, fmt.Errorf("%s: daemon.health_port must be from 1 to 65535", SettingsFile)
+	}
+	return settings, nil
+}
@@ -0,0 +1,188 @@
+package config
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Store holds tunnel configurations as YAML documents, keyed by tunnel name.
+// The Manager decodes each document over the shared defaults, so a store
+// only keeps what a tunnel sets itself.
+type Store interface {
+	// Load returns a tunnel's document, or an error wrapping fs.ErrNotExist
+	// if the store has none
+	Load(name string) ([]byte, error)
+	// Save writes a tunnel's document, replacing any earlier one
+	Save(name string, data []byte) error
+	// Delete removes a tunnel's document. Deleting a tunnel the store does
+	// not have is not an error.
+	Delete(name string) error
+	// List returns the names of the stored tunnels
+	List() ([]string, error)
+}
+
+// FileStore keeps each tunnel in its own YAML file in a directory. It is
+// the default store, on the tunnels directory of the config directory.
+type FileStore struct {
+	dir string
+}
+
+// NewFileStore returns a store keeping tunnels in dir, which is created on
+// the first save
+func NewFileStore(dir string) *FileStore {
+	return &FileStore{dir: dir}
+}
+
+// Path returns the file holding a tunnel
+func (s *FileStore) Path(name string) string {
+	return filepath.Join(s.dir, name+".yaml")
+}
+
+func (s *FileStore) Load(name string) ([]byte, error) {
+	data, err := os.ReadFile(s.Path(name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	return data, nil
+}
+
+func (s *FileStore) Save(name string, data []byte) error {
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return fmt.Errorf("failed to create tunnels directory: %w", err)
+	}
+	if err := os.WriteFile(s.Path(name), data, 0600); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	return nil
+}
+
+func (s *FileStore) Delete(name string) error {
+	if err := os.Remove(s.Path(name)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove config file: %w", err)
+	}
+	return nil
+}
+
+func (s *FileStore) List() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if os.IsNotExist(err) {
+		return nil, nil // No configs directory yet
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read configs directory: %w", err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".yaml" {
+			continue
+		}
+		names = append(names, strings.TrimSuffix(entry.Name(), ".yaml"))
+	}
+	return names, nil
+}
+
+// MemoryStore keeps tunnel configurations in memory, for tests and for
+// programs embedding the manager without a tunnels directory
+type MemoryStore struct {
+	mu   sync.RWMutex
+	docs map[string][]byte
+}
+
+// NewMemoryStore returns an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{docs: make(map[string][]byte)}
+}
+
+func (s *MemoryStore) Load(name string) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	data, exists := s.docs[name]
+	if !exists {
+		return nil, fmt.Errorf("tunnel '%s': %w", name, fs.ErrNotExist)
+	}
+	return append([]byte(nil), data...), nil
+}
+
+func (s *MemoryStore) Save(name string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.docs[name] = append([]byte(nil), data...)
+	return nil
+}
+
+func (s *MemoryStore) Delete(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.docs, name)
+	return nil
+}
+
+func (s *MemoryStore) List() ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	names := make([]string, 0, len(s.docs))
+	for name := range s.docs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// UseStore switches the manager to keeping tunnel configurations in store,
+// replacing the loaded configurations with the ones in it. Unlike loading
+// at startup, a configuration that fails to load or validate is an error.
+func (m *Manager) UseStore(store Store) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.store = store
+
+	configs, err := m.readAllConfigs()
+	if err != nil {
+		return err
+	}
+	m.configs = make(map[string]*Config, len(configs))
+	for _, config := range configs {
+		m.configs[config.TunnelName] = config
+	}
+	return nil
+}
+
+// Store returns the store the manager keeps tunnel configurations in
+func (m *Manager) Store() Store {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.store
+}
+
+// LocalFile returns the local file a tunnel's configuration is kept in, or
+// false if the store does not keep it in one, as for a remote store. In
+// single-file mode every tunnel is kept in the same file.
+func (m *Manager) LocalFile(name string) (string, bool) {
+	switch s := m.Store().(type) {
+	case *FileStore:
+		return s.Path(name), true
+	case *configFileStore:
+		return s.path, true
+	}
+	return "", false
+}
+
+// location describes where a tunnel's configuration is kept, for error
+// messages: its file or URL, for stores that have one
+func (m *Manager) location(name string) string {
+	if s, ok := m.store.(interface{ Path(string) string }); ok {
+		return s.Path(name)
+	}
+	return fmt.Sprintf("tunnel '%s'", name)
+}
@@ -0,0 +1,125 @@
+package config
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManagerWithMemoryStore(t *testing.T) {
+	dir := t.TempDir()
+	store := NewMemoryStore()
+	manager, err := NewManagerWithStore(dir, store)
+	require.NoError(t, err)
+
+	require.NoError(t, manager.SaveConfig(&Config{
+		TunnelName:  "home",
+		CloudServer: CloudServerConfig{IP: "203.0.113.1", User: "tunnel"},
+		LocalServer: LocalServerConfig{ReversePort: 2222},
+	}))
+	require.NoError(t, manager.SaveConfig(&Config{TunnelName: "office"}))
+	assert.NoDirExists(t, filepath.Join(dir, "tunnels"))
+
+	names, err := store.List()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"home", "office"}, names)
+
+	// A second manager on the same store loads what the first saved
+	reloaded, err := NewManagerWithStore(dir, store)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"home", "office"}, reloaded.ListConfigs())
+	home, err := reloaded.GetConfig("home")
+	require.NoError(t, err)
+	assert.Equal(t, "203.0.113.1", home.CloudServer.IP)
+	assert.Equal(t, DefaultSSHPort, home.CloudServer.Port)
+
+	require.NoError(t, reloaded.DeleteConfig("office"))
+	_, err = store.Load("office")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	assert.Equal(t, []string{"home"}, reloaded.ListConfigs())
+}
+
+func TestMemoryStoreChangesAreReloaded(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, DefaultsFile), []byte("cloud_server:\n  user: ubuntu\n"), 0600))
+	store := NewMemoryStore()
+	require.NoError(t, store.Save("home", []byte("tunnel_name: home\ncloud_server:\n  ip: 203.0.113.1\n")))
+
+	manager, err := NewManagerWithStore(dir, store)
+	require.NoError(t, err)
+	home, err := manager.GetConfig("home")
+	require.NoError(t, err)
+	assert.Equal(t, "ubuntu", home.CloudServer.User)
+
+	require.NoError(t, store.Save("home", []byte("tunnel_name: home\ncloud_server:\n  ip: 203.0.113.5\n")))
+	home, err = manager.ReloadConfig("home")
+	require.NoError(t, err)
+	assert.Equal(t, "203.0.113.5", home.CloudServer.IP)
+	assert.Equal(t, "ubuntu", home.CloudServer.User)
+
+	// A broken document fails the reload and keeps the loaded configuration
+	require.NoError(t, store.Save("lab", []byte("tunnel_name: [\n")))
+	assert.ErrorContains(t, manager.Reload(), "tunnel 'lab'")
+	assert.Equal(t, []string{"home"}, manager.ListConfigs())
+}
+
+func TestSetFieldsWithMemoryStore(t *testing.T) {
+	store := NewMemoryStore()
+	require.NoError(t, store.Save("home", []byte("# the home lab\ntunnel_name: home\nlocal_server:\n  reverse_port: 2222\n")))
+	manager, err := NewManagerWithStore(t.TempDir(), store)
+	require.NoError(t, err)
+
+	config, err := manager.SetFields("home", []FieldUpdate{{Path: "local_server.reverse_port", Value: "2223"}})
+	require.NoError(t, err)
+	assert.Equal(t, 2223, config.LocalServer.ReversePort)
+
+	data, err := store.Load("home")
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "# the home lab")
+	assert.Contains(t, string(data), "reverse_port: 2223")
+
+	fields, err := manager.InspectConfig("home")
+	require.NoError(t, err)
+	for _, field := range fields {
+		if field.Path == "local_server.reverse_port" {
+			assert.Equal(t, SourceConfig, field.Source)
+		}
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "tunnels")
+	store := NewFileStore(dir)
+
+	names, err := store.List()
+	require.NoError(t, err)
+	assert.Empty(t, names)
+	_, err = store.Load("home")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	require.NoError(t, store.Delete("home"))
+
+	require.NoError(t, store.Save("home", []byte("tunnel_name: home\n")))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), nil, 0600))
+	names, err = store.List()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"home"}, names)
+	info, err := os.Stat(store.Path("home"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	require.NoError(t, store.Delete("home"))
+	assert.NoFileExists(t, store.Path("home"))
+}
+
+func TestNewManagerUsesFileStore(t *testing.T) {
+	dir := t.TempDir()
+	manager, err := NewManager(dir)
+	require.NoError(t, err)
+	require.NoError(t, manager.SaveConfig(&Config{TunnelName: "home", CreatedAt: time.Now()}))
+	assert.FileExists(t, filepath.Join(dir, "tunnels", "home.yaml"))
+}
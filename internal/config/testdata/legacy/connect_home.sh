@@ -0,0 +1,13 @@
+#!/bin/bash
+# Connection script for reverse SSH tunnel: home
+# This script connects from cloud server to NAT'd server
+
+NATTED_HOST="localhost"  # Connection will be via reverse tunnel
+NATTED_PORT="22"         # Standard SSH port on local machine
+NATTED_USER="pi"
+NATTED_KEY="~/.ssh/natted_server_key_home"
+REVERSE_PORT="2222"
+
+connect_via_reverse_tunnel() {
+    ssh -i "$NATTED_KEY" -p ${REVERSE_PORT} ${NATTED_USER}@localhost
+}
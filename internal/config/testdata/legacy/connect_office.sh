@@ -0,0 +1,7 @@
+#!/bin/bash
+# Connection script for reverse SSH tunnel: office
+NATTED_HOST="localhost"
+NATTED_PORT="22"
+NATTED_USER="admin"
+NATTED_KEY="~/.ssh/natted_server_key_office"
+REVERSE_PORT="abc"
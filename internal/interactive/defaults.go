@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"math/big"
 	"os/user"
+	"strconv"
 	"strings"
 )
 
@@ -69,14 +70,22 @@ func GetDefaultPort() string {
 	return "22"
 }
 
-// ValidatePort checks if a port string is valid
-func ValidatePort(portStr string) bool {
+// ValidatePort checks that a port string is a port number (1-65535),
+// describing the problem if not
+func ValidatePort(portStr string) error {
+	portStr = strings.TrimSpace(portStr)
 	if portStr == "" {
-		return false
+		return fmt.Errorf("port is required")
 	}
 
-	// Basic port validation - should be improved
-	return !strings.Contains(portStr, " ") && len(portStr) > 0
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return fmt.Errorf("%q is not a port number", portStr)
+	}
+	if port < 1 || port > 65535 {
+		return fmt.Errorf("port %d is out of range (1-65535)", port)
+	}
+	return nil
 }
 
 // GetPortPlaceholder returns a helpful placeholder for port input
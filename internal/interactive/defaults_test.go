@@ -0,0 +1,42 @@
+package interactive
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidatePort(t *testing.T) {
+	tests := []struct {
+		port string
+		want string
+	}{
+		{"1", ""},
+		{"22", ""},
+		{" 2222 ", ""},
+		{"65535", ""},
+		{"0", "out of range"},
+		{"65536", "out of range"},
+		{"99999", "out of range"},
+		{"-22", "out of range"},
+		{"", "required"},
+		{"   ", "required"},
+		{"abc", "not a port number"},
+		{"22a", "not a port number"},
+		{"2 2", "not a port number"},
+		{"22.0", "not a port number"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.port, func(t *testing.T) {
+			err := ValidatePort(tt.port)
+			if tt.want == "" {
+				assert.NoError(t, err)
+				return
+			}
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package interactive
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/lerndmina/SSH-Tunnel/internal/audit"
+	"github.com/lerndmina/SSH-Tunnel/internal/config"
+	"github.com/lerndmina/SSH-Tunnel/internal/ssh"
+)
+
+// keyRemoval is the outcome of removing a deleted tunnel's keys
+type keyRemoval struct {
+	// revoked is set if the key was removed from the cloud server's
+	// authorized_keys; revokeErr is why it could not be
+	revoked   bool
+	revokeErr error
+	// removed lists the key files deleted
+	removed []string
+}
+
+// tunnelKeyPaths returns the private key paths of a tunnel that no other
+// configured tunnel uses. Call it after the tunnel's config is deleted.
+func tunnelKeyPaths(configMgr *config.Manager, cfg *config.Config) []string {
+	inUse := make(map[string]bool)
+	for _, name := range configMgr.ListConfigs() {
+		other, err := configMgr.GetConfig(name)
+		if err != nil {
+			continue
+		}
+		inUse[config.ExpandPath(other.SSH.PrivateKeyPath)] = true
+		inUse[config.ExpandPath(other.SSH.NattedKeyPath)] = true
+	}
+
+	var paths []string
+	for _, path := range []string{cfg.SSH.PrivateKeyPath, cfg.SSH.NattedKeyPath} {
+		if path = config.ExpandPath(path); path != "" && !inUse[path] {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// removeTunnelKeys revokes a deleted tunnel's key from its cloud server and
+// deletes its key files. Keys shared with other tunnels are left alone. A
+// failed revocation is reported in the result and does not stop the files
+// being deleted.
+func removeTunnelKeys(km *ssh.KeyManager, configMgr *config.Manager, cfg *config.Config) (keyRemoval, error) {
+	var result keyRemoval
+	paths := tunnelKeyPaths(configMgr, cfg)
+
+	// Revoke first, while the key can still log in
+	primary := config.ExpandPath(cfg.SSH.PrivateKeyPath)
+	for _, path := range paths {
+		if path == primary {
+			result.revoked, result.revokeErr = km.RevokePublicKey(cfg.CloudServer.IP, cfg.CloudServer.User, path, cfg.CloudServer.Port)
+			configMgr.Audit().Log(audit.ActionKeyRevoke, cfg.TunnelName, map[string]string{
+				"host": fmt.Sprintf("%s@%s:%d", cfg.CloudServer.User, cfg.CloudServer.IP, cfg.CloudServer.Port),
+				"key":  path,
+			}, result.revokeErr)
+		}
+	}
+
+	for _, path := range paths {
+		for _, file := range []string{path, path + ".pub"} {
+			if err := os.Remove(file); err != nil {
+				if os.IsNotExist(err) {
+					continue
+				}
+				return result, fmt.Errorf("failed to remove key file: %w", err)
+			}
+			result.removed = append(result.removed, file)
+		}
+	}
+	return result, nil
+}
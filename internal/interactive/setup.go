@@ -0,0 +1,218 @@
+package interactive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/lerndmina/SSH-Tunnel/internal/audit"
+	"github.com/lerndmina/SSH-Tunnel/internal/config"
+	"github.com/lerndmina/SSH-Tunnel/internal/ssh"
+)
+
+// setupStep is one step of setting up a new tunnel
+type setupStep struct {
+	name string
+	run  func(ctx context.Context) error
+}
+
+// setupRollback undoes what a tunnel setup changed when the setup fails or
+// is cancelled. Changes on the cloud server that cannot be undone are
+// listed in remote for the user instead.
+type setupRollback struct {
+	undo   []func() error
+	remote []string
+}
+
+// keepFiles records the files at paths before they are written, so rolling
+// back restores their contents, or removes them if they did not exist
+func (r *setupRollback) keepFiles(paths ...string) {
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if os.IsNotExist(err) {
+			r.undo = append(r.undo, func() error {
+				if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+					return err
+				}
+				return nil
+			})
+			continue
+		}
+		data, readErr := os.ReadFile(path)
+		if err != nil || readErr != nil {
+			continue // Unreadable, so there is nothing to restore
+		}
+		r.undo = append(r.undo, func() error {
+			return os.WriteFile(path, data, info.Mode().Perm())
+		})
+	}
+}
+
+// undoAll undoes the recorded changes, newest first, returning the ones
+// that could not be undone
+func (r *setupRollback) undoAll() error {
+	var errs []error
+	for i := len(r.undo) - 1; i >= 0; i-- {
+		if err := r.undo[i](); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	r.undo = nil
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("failed to roll back the setup: %w", err)
+	}
+	return nil
+}
+
+// runSetupSteps runs the steps in order, so a tunnel is only saved by a
+// last step once everything before it succeeded. report, if set, is called
+// as each step starts, with done false, and as it finishes. If a step fails
+// or ctx is cancelled, the remaining steps are skipped, the changes recorded
+// in rollback are undone, and the error names the step.
+func runSetupSteps(ctx context.Context, steps []setupStep, rollback *setupRollback, report func(step int, done bool, err error)) error {
+	if report == nil {
+		report = func(int, bool, error) {}
+	}
+
+	for i, step := range steps {
+		report(i, false, nil)
+		err := ctx.Err()
+		if err == nil {
+			err = step.run(ctx)
+		}
+		report(i, true, err)
+		if err != nil {
+			err = fmt.Errorf("setup step %d of %d (%s) failed: %w", i+1, len(steps), step.name, err)
+			return errors.Join(err, rollback.undoAll())
+		}
+	}
+	return nil
+}
+
+// runSetup runs the steps, printing the progress of each, and lists what a
+// failed or cancelled setup left on the cloud server
+func (tui *SimpleTUI) runSetup(ctx context.Context, steps []setupStep, rollback *setupRollback) error {
+	err := runSetupSteps(ctx, steps, rollback, func(i int, done bool, err error) {
+		progress := fmt.Sprintf("[%d/%d]", i+1, len(steps))
+		switch {
+		case !done:
+			fmt.Printf("%s %s...\n", progress, steps[i].name)
+		case err == nil:
+			fmt.Println(colorize(progress+" ✓ done", colorGreen))
+		case ctx.Err() != nil || errors.Is(err, errCancelled):
+			fmt.Println(colorize(progress+" ✗ cancelled", colorYellow))
+		default:
+			fmt.Println(colorize(progress+" ✗ failed", colorRed))
+		}
+	})
+	if err != nil {
+		for _, change := range rollback.remote {
+			fmt.Println(colorize("Left on the cloud server: "+change, colorYellow))
+		}
+	}
+	return err
+}
+
+// setupSteps returns the steps connecting the cloud server and this server
+// for cfg, whose cloud server key is already in place, and saving it. The
+// NAT'd server key is generated with keyType and kept beside the cloud
+// server key. Steps on the cloud server run over connections that are
+// closed when the setup is cancelled, so nothing carries on after it is
+// rolled back.
+func (tui *SimpleTUI) setupSteps(cfg *config.Config, keyType string, rollback *setupRollback) []setupStep {
+	cloudKeyPath := cfg.SSH.PrivateKeyPath
+	sshDir := filepath.Dir(cloudKeyPath)
+	nattedKeyPath := filepath.Join(sshDir, fmt.Sprintf("natted_server_key_%s", cfg.TunnelName))
+	cfg.SSH.NattedKeyPath = nattedKeyPath
+	host, port, user := cfg.CloudServer.IP, cfg.CloudServer.Port, cfg.CloudServer.User
+
+	return []setupStep{
+		{"Checking the cloud server's host key", func(context.Context) error {
+			if err := tui.trustCloudHostKey(cfg); err != nil {
+				return fmt.Errorf("host key check failed: %w", err)
+			}
+			return nil
+		}},
+		{"Testing the SSH connection to the cloud server", func(ctx context.Context) error {
+			remote, err := tui.keyManager.ProbeRemoteContext(ctx, host, user, cloudKeyPath, port)
+			if err != nil && ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if err != nil {
+				return fmt.Errorf("SSH connection test failed, please check your credentials: %w", err)
+			}
+
+			fmt.Printf("Logged in as %s\n", remote)
+			if !remote.LoggedInAs(user) {
+				fmt.Println(colorize(fmt.Sprintf("The cloud server logged the key in as '%s', not '%s'.", remote.User, user), colorYellow))
+			}
+			return nil
+		}},
+		{"Generating a key pair for the cloud server to connect back", func(context.Context) error {
+			rollback.keepFiles(nattedKeyPath, nattedKeyPath+".pub")
+			if err := tui.keyManager.GenerateKeyPair(keyType, nattedKeyPath, ssh.DefaultKeyComment(cfg.TunnelName)); err != nil {
+				return fmt.Errorf("failed to generate natted server key pair: %w", err)
+			}
+			return nil
+		}},
+		{"Adding the public key to this server's authorized_keys", func(context.Context) error {
+			pubKeyContent, err := os.ReadFile(nattedKeyPath + ".pub")
+			if err != nil {
+				return fmt.Errorf("failed to read public key: %w", err)
+			}
+			authorizedLine, err := ssh.FormatAuthorizedKey(pubKeyContent, cfg.SSH.AuthorizedKeyOptions)
+			if err != nil {
+				return err
+			}
+
+			authorizedKeysPath := filepath.Join(sshDir, "authorized_keys")
+			added, err := ssh.AddAuthorizedKey(authorizedKeysPath, authorizedLine)
+			if err != nil {
+				return err
+			}
+			if !added {
+				fmt.Println(colorize("Public key already exists in authorized_keys", colorYellow))
+				return nil
+			}
+			rollback.undo = append(rollback.undo, func() error {
+				_, err := ssh.DeleteAuthorizedKey(authorizedKeysPath, authorizedLine)
+				return err
+			})
+			return nil
+		}},
+		{"Deploying the NAT'd server key to the cloud server", func(ctx context.Context) error {
+			rollback.remote = append(rollback.remote, "~/.ssh/"+filepath.Base(nattedKeyPath))
+			err := tui.deployNattedKeyToCloud(ctx, host, port, user, cloudKeyPath, nattedKeyPath)
+			if err != nil && ctx.Err() != nil {
+				err = ctx.Err()
+			}
+			tui.configMgr.Audit().Log(audit.ActionKeyDeploy, cfg.TunnelName, map[string]string{
+				"host": fmt.Sprintf("%s@%s:%d", user, host, port),
+				"key":  nattedKeyPath,
+			}, err)
+			if err != nil && ctx.Err() == nil {
+				return fmt.Errorf("failed to deploy natted key to cloud server: %w", err)
+			}
+			return err
+		}},
+		{"Creating the connection script on the cloud server", func(ctx context.Context) error {
+			rollback.remote = append(rollback.remote, fmt.Sprintf("connect_%s.sh", cfg.TunnelName))
+			err := tui.createConnectionScript(ctx, host, port, user, cloudKeyPath, nattedKeyPath, cfg)
+			if err != nil && ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if err != nil {
+				return fmt.Errorf("failed to create connection script: %w", err)
+			}
+			return nil
+		}},
+		{"Saving the tunnel configuration", func(context.Context) error {
+			if err := tui.configMgr.SaveConfig(cfg); err != nil {
+				return fmt.Errorf("failed to save tunnel configuration: %w", err)
+			}
+			return nil
+		}},
+	}
+}
@@ -2,19 +2,21 @@ package interactive
 
 import (
 	"bufio"
+	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
-	"net"
+	"io"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strconv"
 	"strings"
-	"time"
 
 	"github.com/lerndmina/SSH-Tunnel/internal/config"
 	"github.com/lerndmina/SSH-Tunnel/internal/ssh"
 	"github.com/lerndmina/SSH-Tunnel/internal/tunnel"
-	cryptossh "golang.org/x/crypto/ssh"
+	"github.com/lerndmina/SSH-Tunnel/pkg/logger"
 )
 
 // SimpleTUI provides a simple command-line interface for tunnel management
@@ -22,7 +24,16 @@ type SimpleTUI struct {
 	keyManager  *ssh.KeyManager
 	tunnelMgr   *tunnel.Manager
 	configMgr   *config.Manager
+	input       io.Reader
 	scanner     *bufio.Scanner
+	events      <-chan tunnel.TunnelEvent
+	// interrupt, when closed, cancels the prompt waiting for input
+	interrupt   <-chan struct{}
+	// pending delivers a line still being read for a cancelled prompt
+	pending     chan lineResult
+	// keyType, if set, is the type of the keys setup generates, in place
+	// of asking for one
+	keyType     string
 }
 
 // Colors for terminal output
@@ -37,29 +48,128 @@ const (
 	colorWhite  = "\033[37m"
 )
 
+// colorEnabled controls whether colorize emits ANSI escapes
+var colorEnabled = logger.ColorAllowed(os.Stdout)
+
+// SetColor enables or disables colored output
+func SetColor(enabled bool) {
+	colorEnabled = enabled
+}
+
 func colorize(text, color string) string {
+	if !colorEnabled {
+		return text
+	}
 	return color + text + colorReset
 }
 
 // NewSimpleTUI creates a new simple TUI instance
 func NewSimpleTUI() (*SimpleTUI, error) {
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get home directory: %v", err)
-	}
-	
-	configPath := filepath.Join(homeDir, ".ssh-tunnel-manager")
-	configMgr, err := config.NewManager(configPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create config manager: %v", err)
+	// Work in the active profile, like the other commands
+	configMgr := config.GetManager()
+	if configMgr == nil {
+		return nil, fmt.Errorf("configuration has not been initialized")
 	}
 
+	return newSimpleTUI(os.Stdin, configMgr), nil
+}
+
+// newSimpleTUI creates a SimpleTUI reading its input from input
+func newSimpleTUI(input io.Reader, configMgr *config.Manager) *SimpleTUI {
+	tunnelMgr := tunnel.NewManagerWithConfig(configMgr)
+
 	return &SimpleTUI{
 		keyManager: ssh.NewKeyManager(),
-		tunnelMgr:  tunnel.NewManager(),
+		tunnelMgr:  tunnelMgr,
 		configMgr:  configMgr,
-		scanner:    bufio.NewScanner(os.Stdin),
-	}, nil
+		input:      input,
+		scanner:    bufio.NewScanner(input),
+		events:     tunnelMgr.Subscribe(),
+	}
+}
+
+// errCancelled is returned by prompts at the end of input, as when the user
+// presses Ctrl-D, to abandon the current action
+var errCancelled = errors.New("cancelled")
+
+// lineResult is a line read from the input, or the error reading it
+type lineResult struct {
+	line string
+	err  error
+}
+
+// readLine reads the next line of input, without its line ending. Every
+// prompt reads through it, so one Enter always answers exactly one prompt.
+// At the end of input it returns errCancelled and starts a fresh scanner,
+// so that later prompts can read again once the terminal has delivered the
+// EOF. It also returns errCancelled once tui.interrupt is closed; the line
+// then still being read goes to the next prompt.
+func (tui *SimpleTUI) readLine() (string, error) {
+	if tui.pending == nil {
+		pending := make(chan lineResult, 1)
+		go func() {
+			line, err := tui.scanLine()
+			pending <- lineResult{line, err}
+		}()
+		tui.pending = pending
+	}
+
+	select {
+	case result := <-tui.pending:
+		tui.pending = nil
+		return result.line, result.err
+	case <-tui.interrupt:
+		return "", errCancelled
+	}
+}
+
+// scanLine reads the next line from the scanner, for readLine
+func (tui *SimpleTUI) scanLine() (string, error) {
+	if tui.scanner.Scan() {
+		return strings.TrimSuffix(tui.scanner.Text(), "\r"), nil
+	}
+	if err := tui.scanner.Err(); err != nil {
+		return "", fmt.Errorf("failed to read input: %w", err)
+	}
+
+	tui.scanner = bufio.NewScanner(tui.input)
+	return "", errCancelled
+}
+
+// report prints the error from a menu action and waits for the user to read
+// it. Cancelled actions return to the menu straight away.
+func (tui *SimpleTUI) report(err error) {
+	if errors.Is(err, errCancelled) {
+		fmt.Println()
+		fmt.Println(colorize("Cancelled.", colorYellow))
+		return
+	}
+	fmt.Printf("%s: %v\n", colorize("Error", colorRed), err)
+	tui.promptContinue()
+}
+
+// printEvents prints the tunnel events received since the last call
+func (tui *SimpleTUI) printEvents() {
+	for {
+		select {
+		case event := <-tui.events:
+			color := colorGreen
+			switch event.Type {
+			case tunnel.EventError:
+				color = colorRed
+			case tunnel.EventReconnecting, tunnel.EventExpired:
+				color = colorYellow
+			case tunnel.EventHealthCheck:
+				if event.Err == nil {
+					continue
+				}
+				color = colorRed
+			}
+			fmt.Printf("%s %s\n", colorize(event.Time.Format("15:04:05"), colorWhite), colorize(event.String(), color))
+		default:
+			return
+		}
+	}
 }
 
 // Run starts the interactive tunnel creation process
@@ -68,6 +178,7 @@ func (tui *SimpleTUI) Run() error {
 	fmt.Println()
 
 	for {
+		tui.printEvents()
 		fmt.Println(colorize("Main Menu:", colorBlue))
 		fmt.Println("1) Create new tunnel")
 		fmt.Println("2) List tunnels")
@@ -78,32 +189,37 @@ func (tui *SimpleTUI) Run() error {
 		fmt.Println()
 
 		choice, err := tui.promptString("Select an option (1-6)", "", true)
+		if errors.Is(err, errCancelled) {
+			fmt.Println()
+			fmt.Println(colorize("Goodbye!", colorGreen))
+			return nil
+		}
 		if err != nil {
 			return err
 		}
 
 		switch choice {
 		case "1":
-			if err := tui.createNewTunnel(); err != nil {
-				fmt.Printf("%s: %v\n", colorize("Error", colorRed), err)
-				tui.promptContinue()
+			// Ctrl-C abandons the setup rather than leaving it half done
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+			err := tui.createNewTunnel(ctx)
+			stop()
+			if err != nil {
+				tui.report(err)
 			}
 		case "2":
 			tui.listTunnels()
 		case "3":
 			if err := tui.startTunnel(); err != nil {
-				fmt.Printf("%s: %v\n", colorize("Error", colorRed), err)
-				tui.promptContinue()
+				tui.report(err)
 			}
 		case "4":
 			if err := tui.stopTunnel(); err != nil {
-				fmt.Printf("%s: %v\n", colorize("Error", colorRed), err)
-				tui.promptContinue()
+				tui.report(err)
 			}
 		case "5":
 			if err := tui.deleteTunnel(); err != nil {
-				fmt.Printf("%s: %v\n", colorize("Error", colorRed), err)
-				tui.promptContinue()
+				tui.report(err)
 			}
 		case "6":
 			fmt.Println(colorize("Goodbye!", colorGreen))
@@ -115,31 +231,52 @@ func (tui *SimpleTUI) Run() error {
 	}
 }
 
-func (tui *SimpleTUI) createNewTunnel() error {
+// createNewTunnel asks for a new tunnel and sets it up. Cancelling ctx
+// aborts the setup at the next prompt or step, rolling back what it wrote.
+func (tui *SimpleTUI) createNewTunnel(ctx context.Context) error {
 	fmt.Println(colorize("=== Create New Tunnel ===", colorCyan))
 	fmt.Println()
 
+	tui.interrupt = ctx.Done()
+	defer func() { tui.interrupt = nil }()
+
 	// Get tunnel configuration
 	cfg, err := tui.promptForTunnelConfig()
 	if err != nil {
 		return err
 	}
 
-	// Setup SSH key
-	if err := tui.setupSSHKey(cfg); err != nil {
+	// Review before anything is set up or saved
+	confirmed, err := tui.confirmTunnelConfig(cfg)
+	if err != nil {
 		return err
 	}
+	if !confirmed {
+		return errCancelled
+	}
 
-	// Setup natted server connection
-	if err := tui.setupNattedServerConnection(cfg); err != nil {
+	keyType, err := tui.chooseKeyType()
+	if err != nil {
 		return err
 	}
 
-	// Save configuration
-	if err := tui.configMgr.SaveConfig(cfg); err != nil {
-		return fmt.Errorf("failed to save tunnel configuration: %v", err)
+	// Setup SSH key, then connect the servers and save the configuration
+	rollback := &setupRollback{}
+	err = tui.setupSSHKey(cfg, keyType, rollback)
+	if err == nil {
+		fmt.Println()
+		err = tui.runSetup(ctx, tui.setupSteps(cfg, keyType, rollback), rollback)
+	} else if rollbackErr := rollback.undoAll(); rollbackErr != nil {
+		err = errors.Join(err, rollbackErr)
+	}
+	if ctx.Err() != nil {
+		return errCancelled
+	}
+	if err != nil {
+		return err
 	}
 
+	fmt.Println()
 	fmt.Println(colorize("Tunnel created successfully!", colorGreen))
 	fmt.Printf("Tunnel '%s' is ready to use.\n", cfg.TunnelName)
 	fmt.Println()
@@ -176,14 +313,10 @@ func (tui *SimpleTUI) promptForTunnelConfig() (*config.Config, error) {
 	}
 
 	// Cloud SSH Port with default
-	cloudSSHPortStr, err := tui.promptString("Cloud SSH Port", "22", true)
+	cfg.CloudServer.Port, err = tui.promptPort("Cloud SSH Port", "22")
 	if err != nil {
 		return nil, err
 	}
-	cfg.CloudServer.Port, err = strconv.Atoi(cloudSSHPortStr)
-	if err != nil {
-		return nil, fmt.Errorf("invalid cloud SSH port: %v", err)
-	}
 
 	cfg.CloudServer.User, err = tui.promptString("Cloud User", "root", true)
 	if err != nil {
@@ -191,14 +324,10 @@ func (tui *SimpleTUI) promptForTunnelConfig() (*config.Config, error) {
 	}
 
 	// Reverse Port with sensible default
-	reversePortStr, err := tui.promptString("Reverse Port", "2222", true)
+	cfg.LocalServer.ReversePort, err = tui.promptPort("Reverse Port", "2222")
 	if err != nil {
 		return nil, err
 	}
-	cfg.LocalServer.ReversePort, err = strconv.Atoi(reversePortStr)
-	if err != nil {
-		return nil, fmt.Errorf("invalid reverse port: %v", err)
-	}
 
 	// Get current user as default for NattedUser
 	currentUser := os.Getenv("USER")
@@ -217,7 +346,119 @@ func (tui *SimpleTUI) promptForTunnelConfig() (*config.Config, error) {
 	return cfg, nil
 }
 
-func (tui *SimpleTUI) setupSSHKey(cfg *config.Config) error {
+// summaryField is an entered tunnel setting shown for review, with the
+// prompt that changes it
+type summaryField struct {
+	label string
+	value func() string
+	edit  func() error
+}
+
+// tunnelSummaryFields returns the reviewable settings of a new tunnel
+func (tui *SimpleTUI) tunnelSummaryFields(cfg *config.Config) []summaryField {
+	text := func(label string, field *string) summaryField {
+		return summaryField{
+			label: label,
+			value: func() string { return *field },
+			edit: func() error {
+				value, err := tui.promptString(label, *field, true)
+				if err == nil {
+					*field = value
+				}
+				return err
+			},
+		}
+	}
+	port := func(label string, field *int) summaryField {
+		return summaryField{
+			label: label,
+			value: func() string { return strconv.Itoa(*field) },
+			edit: func() error {
+				value, err := tui.promptPort(label, strconv.Itoa(*field))
+				if err == nil {
+					*field = value
+				}
+				return err
+			},
+		}
+	}
+
+	return []summaryField{
+		text("Tunnel Name", &cfg.TunnelName),
+		text("Cloud Server IP", &cfg.CloudServer.IP),
+		port("Cloud SSH Port", &cfg.CloudServer.Port),
+		text("Cloud User", &cfg.CloudServer.User),
+		port("Reverse Port", &cfg.LocalServer.ReversePort),
+		text("Natted User", &cfg.LocalServer.User),
+	}
+}
+
+// confirmTunnelConfig shows the entered settings and lets the user correct
+// any of them. It returns false if the user declines to create the tunnel.
+func (tui *SimpleTUI) confirmTunnelConfig(cfg *config.Config) (bool, error) {
+	fields := tui.tunnelSummaryFields(cfg)
+
+	for {
+		fmt.Println()
+		fmt.Println(colorize("=== Tunnel Summary ===", colorCyan))
+		for i, field := range fields {
+			fmt.Printf("%d) %-16s %s\n", i+1, field.label+":", field.value())
+		}
+		fmt.Println()
+
+		choice, err := tui.promptString("Create this tunnel? (y)es, (e)dit a field, (n)o", "y", true)
+		if err != nil {
+			return false, err
+		}
+
+		switch strings.ToLower(choice) {
+		case "y", "yes":
+			return true, nil
+		case "n", "no":
+			return false, nil
+		case "e", "edit":
+			number, err := tui.promptString(fmt.Sprintf("Field to edit (1-%d)", len(fields)), "", true)
+			if err != nil {
+				return false, err
+			}
+			index, err := strconv.Atoi(number)
+			if err != nil || index < 1 || index > len(fields) {
+				fmt.Println(colorize("Invalid field number.", colorRed))
+				continue
+			}
+			if err := fields[index-1].edit(); err != nil {
+				return false, err
+			}
+		default:
+			fmt.Println(colorize("Please enter 'y', 'e' or 'n'.", colorRed))
+		}
+	}
+}
+
+// chooseKeyType returns the type of the keys setup generates: the type set
+// with --force-key-type, or the one the user picks
+func (tui *SimpleTUI) chooseKeyType() (string, error) {
+	if tui.keyType != "" {
+		return tui.keyType, nil
+	}
+
+	for {
+		keyType, err := tui.promptString("Type of keys to generate ("+strings.Join(ssh.KeyTypes, ", ")+"; rsa for older servers)", ssh.KeyTypes[0], true)
+		if err != nil {
+			return "", err
+		}
+		if err := ssh.CheckKeyType(keyType); err != nil {
+			fmt.Println(colorize(fmt.Sprintf("Invalid key type: %v.", err), colorRed))
+			continue
+		}
+		return keyType, nil
+	}
+}
+
+// setupSSHKey asks for the key used to log in to the cloud server and
+// writes it to ~/.ssh/cloud_server_key, generating it with keyType if asked
+// to. The key files it replaces are recorded in rollback.
+func (tui *SimpleTUI) setupSSHKey(cfg *config.Config, keyType string, rollback *setupRollback) error {
 	fmt.Println()
 	fmt.Println(colorize("SSH Private Key Setup", colorYellow))
 	fmt.Println("Choose an option for SSH authentication:")
@@ -260,16 +501,19 @@ func (tui *SimpleTUI) setupSSHKey(cfg *config.Config) error {
 	}
 
 	privateKeyPath := filepath.Join(sshDir, "cloud_server_key")
+	if keyChoice != "4" {
+		rollback.keepFiles(privateKeyPath, privateKeyPath+".pub")
+	}
 
 	switch keyChoice {
 	case "1":
-		fmt.Println("Paste your private key content (press Ctrl+D when finished):")
+		fmt.Println("Paste your private key content (a PEM key ends at its -----END line, anything else at an empty line):")
 		content, err := tui.readMultilineInput()
 		if err != nil {
-			return fmt.Errorf("failed to read private key content: %v", err)
+			return fmt.Errorf("failed to read private key content: %w", err)
 		}
-		if err := os.WriteFile(privateKeyPath, []byte(content), 0600); err != nil {
-			return fmt.Errorf("failed to write private key: %v", err)
+		if err := tui.keyManager.ImportPrivateKey([]byte(content), privateKeyPath); err != nil {
+			return fmt.Errorf("failed to save private key: %v", err)
 		}
 		fmt.Println(colorize("Private key saved successfully", colorGreen))
 
@@ -291,7 +535,7 @@ func (tui *SimpleTUI) setupSSHKey(cfg *config.Config) error {
 					if err != nil {
 						return fmt.Errorf("failed to read key file: %v", err)
 					}
-					if err := os.WriteFile(privateKeyPath, content, 0600); err != nil {
+					if err := tui.keyManager.ImportPrivateKey(content, privateKeyPath); err != nil {
 						return fmt.Errorf("failed to copy key: %v", err)
 					}
 					fmt.Println(colorize("Key copied to "+privateKeyPath, colorGreen))
@@ -303,8 +547,8 @@ func (tui *SimpleTUI) setupSSHKey(cfg *config.Config) error {
 		}
 
 	case "3":
-		fmt.Println(colorize("Generating new SSH key pair...", colorYellow))
-		if err := tui.keyManager.GenerateKeyPair("ed25519", privateKeyPath); err != nil {
+		fmt.Println(colorize(fmt.Sprintf("Generating new %s SSH key pair...", keyType), colorYellow))
+		if err := tui.keyManager.GenerateKeyPair(keyType, privateKeyPath, ssh.DefaultKeyComment(cfg.TunnelName)); err != nil {
 			return fmt.Errorf("failed to generate key pair: %v", err)
 		}
 		fmt.Println(colorize("New SSH key pair generated!", colorGreen))
@@ -315,7 +559,11 @@ func (tui *SimpleTUI) setupSSHKey(cfg *config.Config) error {
 		if err != nil {
 			return fmt.Errorf("failed to read public key: %v", err)
 		}
-		fmt.Print(string(pubKeyContent))
+		authorizedLine, err := ssh.FormatAuthorizedKey(pubKeyContent, cfg.SSH.AuthorizedKeyOptions)
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(authorizedLine))
 		fmt.Println()
 		
 		_, err = tui.promptString("Press Enter after you've added the public key to your cloud server...", "", false)
@@ -334,123 +582,70 @@ func (tui *SimpleTUI) setupSSHKey(cfg *config.Config) error {
 		}
 	}
 
-	// Test SSH connection
-	fmt.Println(colorize("Testing SSH connection to cloud server...", colorYellow))
-	fmt.Println("Testing connection (you may need to accept the host key)...")
-	
-	if err := tui.keyManager.TestConnection(cfg.CloudServer.IP, cfg.CloudServer.User, privateKeyPath, cfg.CloudServer.Port); err != nil {
-		fmt.Println(colorize("SSH connection failed. Please check your credentials and try again.", colorRed))
-		return fmt.Errorf("SSH connection test failed: %v", err)
-	}
-	fmt.Println(colorize("SSH connection successful!", colorGreen))
-
+	cfg.SSH.PrivateKeyPath = privateKeyPath
 	return nil
 }
 
-func (tui *SimpleTUI) setupNattedServerConnection(cfg *config.Config) error {
-	fmt.Println(colorize("Setting up connection from cloud server to NAT'd server...", colorYellow))
-
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return fmt.Errorf("failed to get home directory: %v", err)
-	}
-
-	sshDir := filepath.Join(homeDir, ".ssh")
-	nattedKeyPath := filepath.Join(sshDir, fmt.Sprintf("natted_server_key_%s", cfg.TunnelName))
-
-	// Generate a separate key pair for connecting FROM cloud server TO NAT'd server
-	fmt.Println("Generating SSH key pair for cloud server to connect to NAT'd server...")
-	if err := tui.keyManager.GenerateKeyPair("ed25519", nattedKeyPath); err != nil {
-		return fmt.Errorf("failed to generate natted server key pair: %v", err)
-	}
-
-	// Add the public key to this server's authorized_keys
-	fmt.Println("Adding public key to this server's authorized_keys...")
-	if err := os.MkdirAll(sshDir, 0700); err != nil {
-		return fmt.Errorf("failed to create SSH directory: %v", err)
-	}
-
-	authorizedKeysPath := filepath.Join(sshDir, "authorized_keys")
-	pubKeyContent, err := os.ReadFile(nattedKeyPath + ".pub")
-	if err != nil {
-		return fmt.Errorf("failed to read public key: %v", err)
-	}
-
-	// Check if key already exists in authorized_keys
-	if _, err := os.Stat(authorizedKeysPath); err == nil {
-		existingKeys, err := os.ReadFile(authorizedKeysPath)
-		if err != nil {
-			return fmt.Errorf("failed to read authorized_keys: %v", err)
-		}
-		if strings.Contains(string(existingKeys), strings.TrimSpace(string(pubKeyContent))) {
-			fmt.Println(colorize("Public key already exists in authorized_keys", colorYellow))
-		} else {
-			if err := tui.appendToAuthorizedKeys(authorizedKeysPath, pubKeyContent); err != nil {
-				return err
-			}
-			fmt.Println(colorize("Public key added to authorized_keys", colorGreen))
-		}
-	} else {
-		if err := tui.appendToAuthorizedKeys(authorizedKeysPath, pubKeyContent); err != nil {
+// trustCloudHostKey checks the cloud server's host key against known_hosts,
+// showing its fingerprint and asking before trusting a server seen for the
+// first time. Later connections in this session verify the server against
+// the stored key.
+func (tui *SimpleTUI) trustCloudHostKey(cfg *config.Config) error {
+	knownHosts := config.ExpandPath(cfg.SSH.KnownHostsFile)
+	if knownHosts == "" {
+		var err error
+		if knownHosts, err = ssh.DefaultKnownHostsFile(); err != nil {
 			return err
 		}
-		fmt.Println(colorize("Public key added to authorized_keys", colorGreen))
 	}
 
-	// Deploy the natted server's private key to cloud server so it can connect back
-	fmt.Println("Deploying natted server private key to cloud server...")
-	cloudKeyPath := filepath.Join(homeDir, ".ssh", "cloud_server_key")
-	if err := tui.deployNattedKeyToCloud(cfg.CloudServer.IP, cfg.CloudServer.Port, cfg.CloudServer.User, cloudKeyPath, nattedKeyPath); err != nil {
-		return fmt.Errorf("failed to deploy natted key to cloud server: %v", err)
-	}
-
-	// Create connection script on cloud server
-	fmt.Println("Creating connection script on cloud server...")
-	if err := tui.createConnectionScript(cfg.CloudServer.IP, cfg.CloudServer.Port, cfg.CloudServer.User, cloudKeyPath, nattedKeyPath, cfg); err != nil {
-		return fmt.Errorf("failed to create connection script: %v", err)
-	}
-
-	// Set the SSH config paths
-	cfg.SSH.PrivateKeyPath = filepath.Join(homeDir, ".ssh", "cloud_server_key")
-	cfg.SSH.NattedKeyPath = nattedKeyPath
-
-	return nil
+	tui.keyManager.SetKnownHostsFile(knownHosts)
+	return tui.keyManager.TrustHostKey(cfg.CloudServer.IP, cfg.CloudServer.Port, func(address, fingerprint string) (bool, error) {
+		fmt.Printf("The authenticity of host '%s' can't be established.\n", address)
+		fmt.Printf("Its key fingerprint is %s.\n", fingerprint)
+		return tui.promptYesNo("Trust this host and save its key to "+knownHosts+"?", false)
+	})
 }
 
-func (tui *SimpleTUI) appendToAuthorizedKeys(authorizedKeysPath string, pubKeyContent []byte) error {
-	file, err := os.OpenFile(authorizedKeysPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
-	if err != nil {
-		return fmt.Errorf("failed to open authorized_keys: %v", err)
-	}
-	defer file.Close()
+// readMultilineInput reads pasted key content from the shared scanner. Once
+// a PEM "-----BEGIN ...-----" line is seen it reads through the matching
+// "-----END ...-----" line, keeping the blank line that separates the
+// headers of an encrypted key from its body. Other content ends at an empty
+// line. Either stops at the end of input, leaving any further input for
+// later prompts.
+func (tui *SimpleTUI) readMultilineInput() (string, error) {
+	var lines []string
+	var pemEnd string
+	for {
+		line, err := tui.readLine()
+		if errors.Is(err, errCancelled) && len(lines) > 0 {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
 
-	if _, err := file.Write(pubKeyContent); err != nil {
-		return fmt.Errorf("failed to write to authorized_keys: %v", err)
-	}
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			if pemEnd != "" {
+				lines = append(lines, "")
+				continue
+			}
+			if len(lines) > 0 {
+				break
+			}
+			continue
+		}
 
-	// Ensure it ends with a newline
-	if !strings.HasSuffix(string(pubKeyContent), "\n") {
-		if _, err := file.WriteString("\n"); err != nil {
-			return fmt.Errorf("failed to write newline to authorized_keys: %v", err)
+		lines = append(lines, line)
+		if label, ok := strings.CutPrefix(trimmed, "-----BEGIN "); ok && pemEnd == "" {
+			pemEnd = "-----END " + label
+		} else if pemEnd != "" && trimmed == pemEnd {
+			break
 		}
 	}
 
-	return nil
-}
-
-func (tui *SimpleTUI) readMultilineInput() (string, error) {
-	var lines []string
-	scanner := bufio.NewScanner(os.Stdin)
-	
-	for scanner.Scan() {
-		lines = append(lines, scanner.Text())
-	}
-	
-	if err := scanner.Err(); err != nil {
-		return "", err
-	}
-	
-	return strings.Join(lines, "\n"), nil
+	return strings.Join(lines, "\n") + "\n", nil
 }
 
 func (tui *SimpleTUI) listTunnels() {
@@ -636,16 +831,55 @@ func (tui *SimpleTUI) deleteTunnel() error {
 		}
 	}
 
+	// Keep the config for removing its keys afterwards
+	cfg, err := tui.configMgr.GetConfig(selectedTunnel)
+	if err != nil {
+		return err
+	}
+
 	// Delete tunnel configuration
 	if err := tui.configMgr.DeleteConfig(selectedTunnel); err != nil {
 		return fmt.Errorf("failed to delete tunnel: %v", err)
 	}
 
 	fmt.Printf("%s deleted successfully!\n", colorize("Tunnel '"+selectedTunnel+"'", colorGreen))
+
+	// Keys are kept unless the user asks, e.g. when decommissioning a device
+	removeKeys, err := tui.promptYesNo("Also remove its SSH keys and revoke them from the cloud server?", false)
+	if err != nil {
+		return err
+	}
+	if removeKeys {
+		if err := tui.removeTunnelKeys(cfg); err != nil {
+			return err
+		}
+	}
+
 	tui.promptContinue()
 	return nil
 }
 
+// removeTunnelKeys removes a deleted tunnel's keys and reports what was done
+func (tui *SimpleTUI) removeTunnelKeys(cfg *config.Config) error {
+	result, err := removeTunnelKeys(tui.keyManager, tui.configMgr, cfg)
+	switch {
+	case result.revokeErr != nil:
+		fmt.Println(colorize(fmt.Sprintf("Could not revoke the key from %s: %v", cfg.CloudServer.IP, result.revokeErr), colorYellow))
+	case result.revoked:
+		fmt.Printf("Revoked the key from %s\n", cfg.CloudServer.IP)
+	}
+	for _, file := range result.removed {
+		fmt.Printf("Removed %s\n", file)
+	}
+	if err != nil {
+		return err
+	}
+	if len(result.removed) == 0 {
+		fmt.Println("No key files to remove; they are missing or used by other tunnels.")
+	}
+	return nil
+}
+
 func (tui *SimpleTUI) promptString(prompt, defaultValue string, required bool) (string, error) {
 	for {
 		if defaultValue != "" {
@@ -654,11 +888,12 @@ func (tui *SimpleTUI) promptString(prompt, defaultValue string, required bool) (
 			fmt.Printf("%s: ", prompt)
 		}
 
-		if !tui.scanner.Scan() {
-			return "", fmt.Errorf("failed to read input")
+		line, err := tui.readLine()
+		if err != nil {
+			return "", err
 		}
 
-		input := strings.TrimSpace(tui.scanner.Text())
+		input := strings.TrimSpace(line)
 		if input == "" && defaultValue != "" {
 			return defaultValue, nil
 		}
@@ -670,6 +905,21 @@ func (tui *SimpleTUI) promptString(prompt, defaultValue string, required bool) (
 	}
 }
 
+// promptPort asks for a port number, asking again until the answer is valid
+func (tui *SimpleTUI) promptPort(prompt, defaultValue string) (int, error) {
+	for {
+		input, err := tui.promptString(prompt, defaultValue, true)
+		if err != nil {
+			return 0, err
+		}
+		if err := ValidatePort(input); err != nil {
+			fmt.Println(colorize(fmt.Sprintf("Invalid port: %v. Please try again.", err), colorRed))
+			continue
+		}
+		return strconv.Atoi(strings.TrimSpace(input))
+	}
+}
+
 func (tui *SimpleTUI) promptYesNo(prompt string, defaultValue bool) (bool, error) {
 	defaultStr := "n"
 	if defaultValue {
@@ -694,9 +944,13 @@ func (tui *SimpleTUI) promptYesNo(prompt string, defaultValue bool) (bool, error
 	}
 }
 
+// promptContinue waits for Enter. Ctrl-D also continues; the end of input
+// is used up here so the menu does not read it as a request to exit.
 func (tui *SimpleTUI) promptContinue() {
 	fmt.Print("Press Enter to continue...")
-	tui.scanner.Scan()
+	if _, err := tui.readLine(); err != nil {
+		fmt.Println()
+	}
 }
 
 func (tui *SimpleTUI) generateRandomTunnelName() string {
@@ -710,37 +964,15 @@ func (tui *SimpleTUI) generateRandomTunnelName() string {
 	return fmt.Sprintf("%s-%s", adjectives[adjIndex], nouns[nounIndex])
 }
 
-func (tui *SimpleTUI) deployNattedKeyToCloud(cloudHost string, cloudPort int, cloudUser, cloudKeyPath, nattedKeyPath string) error {
-	// Read the cloud server private key for authentication
-	cloudKeyData, err := os.ReadFile(cloudKeyPath)
-	if err != nil {
-		return fmt.Errorf("failed to read cloud server key: %w", err)
-	}
-
-	cloudSigner, err := cryptossh.ParsePrivateKey(cloudKeyData)
-	if err != nil {
-		return fmt.Errorf("failed to parse cloud server key: %w", err)
-	}
-
+func (tui *SimpleTUI) deployNattedKeyToCloud(ctx context.Context, cloudHost string, cloudPort int, cloudUser, cloudKeyPath, nattedKeyPath string) error {
 	// Read the natted server private key to deploy
 	nattedKeyData, err := os.ReadFile(nattedKeyPath)
 	if err != nil {
 		return fmt.Errorf("failed to read natted server key: %w", err)
 	}
 
-	// Create SSH client config using cloud server key
-	config := &cryptossh.ClientConfig{
-		User: cloudUser,
-		Auth: []cryptossh.AuthMethod{
-			cryptossh.PublicKeys(cloudSigner),
-		},
-		HostKeyCallback: cryptossh.InsecureIgnoreHostKey(),
-		Timeout:         30 * time.Second,
-	}
-
-	// Connect to cloud server
-	address := net.JoinHostPort(cloudHost, fmt.Sprintf("%d", cloudPort))
-	client, err := cryptossh.Dial("tcp", address, config)
+	// Connect to cloud server using the cloud server key
+	client, err := tui.keyManager.ConnectContext(ctx, cloudHost, cloudUser, cloudKeyPath, cloudPort)
 	if err != nil {
 		return fmt.Errorf("failed to connect to cloud server: %w", err)
 	}
@@ -775,31 +1007,9 @@ func (tui *SimpleTUI) deployNattedKeyToCloud(cloudHost string, cloudPort int, cl
 	return nil
 }
 
-func (tui *SimpleTUI) createConnectionScript(cloudHost string, cloudPort int, cloudUser, cloudKeyPath, nattedKeyPath string, cfg *config.Config) error {
-	// Read the cloud server private key for authentication
-	cloudKeyData, err := os.ReadFile(cloudKeyPath)
-	if err != nil {
-		return fmt.Errorf("failed to read cloud server key: %w", err)
-	}
-
-	cloudSigner, err := cryptossh.ParsePrivateKey(cloudKeyData)
-	if err != nil {
-		return fmt.Errorf("failed to parse cloud server key: %w", err)
-	}
-
-	// Create SSH client config using cloud server key
-	config := &cryptossh.ClientConfig{
-		User: cloudUser,
-		Auth: []cryptossh.AuthMethod{
-			cryptossh.PublicKeys(cloudSigner),
-		},
-		HostKeyCallback: cryptossh.InsecureIgnoreHostKey(),
-		Timeout:         30 * time.Second,
-	}
-
-	// Connect to cloud server
-	address := net.JoinHostPort(cloudHost, fmt.Sprintf("%d", cloudPort))
-	client, err := cryptossh.Dial("tcp", address, config)
+func (tui *SimpleTUI) createConnectionScript(ctx context.Context, cloudHost string, cloudPort int, cloudUser, cloudKeyPath, nattedKeyPath string, cfg *config.Config) error {
+	// Connect to cloud server using the cloud server key
+	client, err := tui.keyManager.ConnectContext(ctx, cloudHost, cloudUser, cloudKeyPath, cloudPort)
 	if err != nil {
 		return fmt.Errorf("failed to connect to cloud server: %w", err)
 	}
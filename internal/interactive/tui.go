@@ -1,14 +1,18 @@
 package interactive
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/charmbracelet/bubbles/list"
 	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/lerndmina/SSH-Tunnel/internal/audit"
 	"github.com/lerndmina/SSH-Tunnel/internal/config"
 	"github.com/lerndmina/SSH-Tunnel/internal/ssh"
 	"github.com/lerndmina/SSH-Tunnel/internal/tunnel"
@@ -53,6 +57,9 @@ type Model struct {
 	message         string
 	selectedTunnel  string
 	confirmAction   string
+	// deletedConfig is the tunnel just deleted, kept while asking whether
+	// to remove its keys too
+	deletedConfig   *config.Config
 }
 
 var (
@@ -259,6 +266,15 @@ func (m Model) updateNewTunnel(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		return m, tea.Quit
 	case "enter":
 		if m.formIndex < len(m.formFields) {
+			// Stay on the port step until the port is valid
+			if m.formFields[m.formIndex] == "remote_port" {
+				if err := ValidatePort(m.textInput.Value()); err != nil {
+					m.message = fmt.Sprintf("Invalid remote port: %v", err)
+					return m, nil
+				}
+				m.message = ""
+			}
+
 			// Save current field value
 			m.currentForm[m.formFields[m.formIndex]] = strings.TrimSpace(m.textInput.Value())
 			m.formIndex++
@@ -294,12 +310,12 @@ func (m Model) createTunnel() (tea.Model, tea.Cmd) {
 		return m, nil
 	}
 
-	remotePort, err := strconv.Atoi(remotePortStr)
-	if err != nil || remotePort < 1 || remotePort > 65535 {
-		m.message = "Invalid remote port number"
+	if err := ValidatePort(remotePortStr); err != nil {
+		m.message = fmt.Sprintf("Invalid remote port: %v", err)
 		m.state = StateMainMenu
 		return m, nil
 	}
+	remotePort, _ := strconv.Atoi(remotePortStr)
 
 	// Show progress message
 	m.message = "Creating tunnel configuration and setting up SSH keys..."
@@ -333,30 +349,51 @@ func (m Model) setupTunnelWithKeys(name, remoteHost string, remotePort int, user
 		},
 	}
 
-	// Save configuration first
-	if err := m.configMgr.SaveConfig(tunnelConfig); err != nil {
-		m.message = fmt.Sprintf("Failed to save tunnel configuration: %v", err)
-		m.state = StateMainMenu
-		return m, nil
-	}
-
-	// Generate SSH keys for this tunnel
-	if err := m.generateTunnelKeys(tunnelConfig); err != nil {
-		m.message = fmt.Sprintf("Failed to generate SSH keys: %v", err)
-		m.state = StateMainMenu
-		return m, nil
+	// Save the configuration only once its keys are generated and deployed;
+	// if a step fails, the keys are removed again and nothing is saved. If
+	// none of the user's keys logs in to install the new one, it is saved
+	// for the user to install the key by hand.
+	rollback := &setupRollback{}
+	var manualInstall bool
+	steps := []setupStep{
+		{"Generating SSH keys", func(context.Context) error {
+			privateKeyPath := config.ExpandPath(tunnelConfig.SSH.PrivateKeyPath)
+			nattedKeyPath := config.ExpandPath(tunnelConfig.SSH.NattedKeyPath)
+			rollback.keepFiles(privateKeyPath, privateKeyPath+".pub", nattedKeyPath, nattedKeyPath+".pub")
+			return m.generateTunnelKeys(tunnelConfig)
+		}},
+		{"Deploying the public key to the cloud server", func(context.Context) error {
+			err := m.deployKeyToRemote(tunnelConfig)
+			if errors.Is(err, ssh.ErrNoAuthorizedKey) {
+				manualInstall = true
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			rollback.undo = append(rollback.undo, func() error {
+				keyPath := config.ExpandPath(tunnelConfig.SSH.PrivateKeyPath)
+				_, err := m.sshMgr.RevokePublicKey(remoteHost, user, keyPath, remotePort)
+				m.configMgr.Audit().Log(audit.ActionKeyRevoke, name, map[string]string{
+					"host": fmt.Sprintf("%s@%s:%d", user, remoteHost, remotePort),
+					"key":  keyPath,
+				}, err)
+				return err
+			})
+			return nil
+		}},
+		{"Saving the tunnel configuration", func(context.Context) error {
+			return m.configMgr.SaveConfig(tunnelConfig)
+		}},
 	}
-
-	// Test SSH connection to the cloud server
-	if err := m.testSSHConnection(tunnelConfig); err != nil {
-		m.message = fmt.Sprintf("Warning: SSH connection test failed: %v", err)
+	if err := runSetupSteps(context.Background(), steps, rollback, nil); err != nil {
+		m.message = fmt.Sprintf("Tunnel '%s' was not created: %v", name, err)
+	} else if manualInstall {
+		pubKey, _ := m.sshMgr.GetPublicKeyContent(config.ExpandPath(tunnelConfig.SSH.PrivateKeyPath))
+		m.message = fmt.Sprintf("Tunnel '%s' created, but none of your keys logs in to %s@%s to install its key. Add this line to ~/.ssh/authorized_keys there:\n%s",
+			name, user, remoteHost, strings.TrimSpace(pubKey))
 	} else {
-		// Try to deploy the public key to the remote server
-		if err := m.deployKeyToRemote(tunnelConfig); err != nil {
-			m.message = fmt.Sprintf("Tunnel created but key deployment failed: %v", err)
-		} else {
-			m.message = fmt.Sprintf("Tunnel '%s' created successfully with SSH keys deployed!", name)
-		}
+		m.message = fmt.Sprintf("Tunnel '%s' created successfully with SSH keys deployed!", name)
 	}
 
 	m.state = StateMainMenu
@@ -399,13 +436,19 @@ func (m Model) viewNewTunnel() string {
 		}
 	}
 
+	// Validation errors replace the hint until the step is corrected
+	hint := statusMessageStyle("Fill in the tunnel configuration details step by step")
+	if m.message != "" {
+		hint = errorMessageStyle(m.message)
+	}
+
 	return fmt.Sprintf("\n%s\n\n%s\n\n%s\n%s\n\n%s\n\n%s",
 		titleStyle.Render("Create New Tunnel - "+progress),
 		instructions,
 		previousValues,
 		m.textInput.View(),
 		"Press 'enter' to continue, 'esc' to go back",
-		statusMessageStyle("Fill in the tunnel configuration details step by step"),
+		hint,
 	)
 }
 
@@ -540,7 +583,7 @@ func (m Model) updateSSHKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		// Generate new key pair
 		m.message = "Generating new SSH key pair..."
 		keyPath := "~/.ssh/id_ed25519_tunnel"
-		if err := m.sshMgr.GenerateKeyPair("ed25519", keyPath); err != nil {
+		if err := m.sshMgr.GenerateKeyPair("ed25519", keyPath, ssh.DefaultKeyComment("")); err != nil {
 			m.message = fmt.Sprintf("Failed to generate key pair: %v", err)
 		} else {
 			m.message = "SSH key pair generated successfully at " + keyPath
@@ -661,11 +704,30 @@ func (m Model) updateConfirm(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	case "esc", "n":
 		m.state = StateManageTunnels
 		m.confirmAction = ""
-		m.message = ""
+		if m.deletedConfig != nil {
+			m.message = fmt.Sprintf("Tunnel '%s' deleted; its SSH keys were kept", m.deletedConfig.TunnelName)
+			m.deletedConfig = nil
+		} else {
+			m.message = ""
+		}
 		return m, nil
 	case "ctrl+c":
 		return m, tea.Quit
 	case "y", "enter":
+		// Keys are only removed on an explicit 'y'
+		if m.confirmAction == "delete_keys" && m.deletedConfig != nil {
+			cfg := m.deletedConfig
+			m.deletedConfig = nil
+			m.state = StateManageTunnels
+			m.confirmAction = ""
+			if msg.String() != "y" {
+				m.message = fmt.Sprintf("Tunnel '%s' deleted; its SSH keys were kept", cfg.TunnelName)
+				return m, nil
+			}
+			m.message = keyRemovalMessage(m.removeTunnelKeys(cfg))
+			return m, nil
+		}
+
 		// Process confirmation
 		if m.confirmAction == "delete_tunnel" && m.selectedTunnel != "" {
 			// Stop tunnel if running
@@ -673,9 +735,16 @@ func (m Model) updateConfirm(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 				// Log error but continue with deletion
 			}
 			
-			// Delete configuration
+			// Delete configuration, keeping it to offer removing its keys
+			cfg, _ := m.configMgr.GetConfig(m.selectedTunnel)
 			if err := m.configMgr.DeleteConfig(m.selectedTunnel); err != nil {
 				m.message = fmt.Sprintf("Failed to delete tunnel: %v", err)
+			} else if cfg != nil {
+				m.deletedConfig = cfg
+				m.confirmAction = "delete_keys"
+				m.selectedTunnel = ""
+				m.message = fmt.Sprintf("Tunnel '%s' deleted successfully", cfg.TunnelName)
+				return m, nil
 			} else {
 				m.message = fmt.Sprintf("Tunnel '%s' deleted successfully", m.selectedTunnel)
 				m.selectedTunnel = ""
@@ -693,6 +762,9 @@ func (m Model) viewConfirm() string {
 	var confirmText string
 	if m.confirmAction == "delete_tunnel" && m.selectedTunnel != "" {
 		confirmText = fmt.Sprintf("Are you sure you want to delete tunnel '%s'?", m.selectedTunnel)
+	} else if m.confirmAction == "delete_keys" && m.deletedConfig != nil {
+		confirmText = fmt.Sprintf("Tunnel '%s' deleted. Also remove its SSH keys and revoke them from %s?\nKeys are kept unless you press 'y'.",
+			m.deletedConfig.TunnelName, m.deletedConfig.CloudServer.IP)
 	} else {
 		confirmText = "Are you sure?"
 	}
@@ -704,37 +776,81 @@ func (m Model) viewConfirm() string {
 	)
 }
 
+// removeTunnelKeys removes a deleted tunnel's keys
+func (m *Model) removeTunnelKeys(cfg *config.Config) (keyRemoval, error) {
+	return removeTunnelKeys(m.sshMgr, m.configMgr, cfg)
+}
+
+// keyRemovalMessage summarizes the removal of a deleted tunnel's keys
+func keyRemovalMessage(result keyRemoval, err error) string {
+	if err != nil {
+		return fmt.Sprintf("Failed to remove SSH keys: %v", err)
+	}
+	message := fmt.Sprintf("Removed %d key file(s)", len(result.removed))
+	switch {
+	case result.revokeErr != nil:
+		message += fmt.Sprintf("; could not revoke the key: %v", result.revokeErr)
+	case result.revoked:
+		message += " and revoked the key from the cloud server"
+	}
+	return message
+}
+
 // generateTunnelKeys generates SSH keys for a tunnel
 func (m *Model) generateTunnelKeys(cfg *config.Config) error {
 	// Generate primary SSH key for connecting to cloud server
-	if err := m.sshMgr.GenerateKeyPair("ed25519", cfg.SSH.PrivateKeyPath); err != nil {
+	if err := m.sshMgr.GenerateKeyPair("ed25519", config.ExpandPath(cfg.SSH.PrivateKeyPath), ssh.DefaultKeyComment(cfg.TunnelName)); err != nil {
 		return fmt.Errorf("failed to generate primary SSH key: %w", err)
 	}
 
 	// Generate natted key for reverse connections
-	if err := m.sshMgr.GenerateKeyPair("ed25519", cfg.SSH.NattedKeyPath); err != nil {
+	if err := m.sshMgr.GenerateKeyPair("ed25519", config.ExpandPath(cfg.SSH.NattedKeyPath), ssh.DefaultKeyComment(cfg.TunnelName)); err != nil {
 		return fmt.Errorf("failed to generate natted SSH key: %w", err)
 	}
 
 	return nil
 }
 
-// testSSHConnection tests SSH connectivity to the cloud server
-func (m *Model) testSSHConnection(cfg *config.Config) error {
-	return m.sshMgr.TestConnection(cfg.CloudServer.IP, cfg.CloudServer.User, cfg.SSH.PrivateKeyPath, cfg.CloudServer.Port)
+// deployKeyToRemote deploys the public key to the remote server. It tests
+// the connection first, and only installs the key if that fails.
+func (m *Model) deployKeyToRemote(cfg *config.Config) error {
+	err := m.sshMgr.DeployPublicKey(cfg.CloudServer.IP, cfg.CloudServer.Port, cfg.CloudServer.User, config.ExpandPath(cfg.SSH.PrivateKeyPath), cfg.SSH.AuthorizedKeyOptions)
+	m.configMgr.Audit().Log(audit.ActionKeyDeploy, cfg.TunnelName, map[string]string{
+		"host": fmt.Sprintf("%s@%s:%d", cfg.CloudServer.User, cfg.CloudServer.IP, cfg.CloudServer.Port),
+		"key":  cfg.SSH.PrivateKeyPath + ".pub",
+	}, err)
+	return err
 }
 
-// deployKeyToRemote deploys the public key to the remote server
-func (m *Model) deployKeyToRemote(cfg *config.Config) error {
-	return m.sshMgr.DeployPublicKey(cfg.CloudServer.IP, cfg.CloudServer.Port, cfg.CloudServer.User, cfg.SSH.PrivateKeyPath)
+// Options configures interactive mode
+type Options struct {
+	// Timeout overrides the SSH connection timeout; zero keeps the defaults
+	Timeout time.Duration
+	// KeyType, if set, is the type of the keys setup generates (one of
+	// ssh.KeyTypes), instead of asking
+	KeyType string
 }
 
 // StartInteractiveMode starts the simple command-line interface
 func StartInteractiveMode() error {
+	return StartInteractiveModeWithOptions(Options{})
+}
+
+// StartInteractiveModeWithOptions starts the simple command-line interface
+// with the given options
+func StartInteractiveModeWithOptions(opts Options) error {
+	if opts.KeyType != "" {
+		if err := ssh.CheckKeyType(opts.KeyType); err != nil {
+			return err
+		}
+	}
+
 	tui, err := NewSimpleTUI()
 	if err != nil {
 		return fmt.Errorf("failed to create TUI: %v", err)
 	}
-	
+	tui.keyManager.SetTimeout(opts.Timeout)
+	tui.keyType = opts.KeyType
+
 	return tui.Run()
 }
@@ -0,0 +1,272 @@
+package interactive
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"testing"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/lerndmina/SSH-Tunnel/internal/config"
+	"github.com/lerndmina/SSH-Tunnel/internal/ssh"
+	"github.com/lerndmina/SSH-Tunnel/internal/tunnel"
+	"github.com/mitchellh/go-homedir"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+func TestNewTunnelFormRejectsBadPort(t *testing.T) {
+	m := Model{
+		state:       StateNewTunnel,
+		textInput:   textinput.New(),
+		currentForm: map[string]string{"name": "home", "remote_host": "203.0.113.10"},
+		formFields:  []string{"name", "remote_host", "remote_port", "user"},
+		formIndex:   2,
+	}
+
+	m.textInput.SetValue("99999")
+	updated, _ := m.updateNewTunnel(tea.KeyMsg{Type: tea.KeyEnter})
+	m = updated.(Model)
+	assert.Equal(t, 2, m.formIndex, "the form must stay on the port step")
+	assert.Contains(t, m.message, "out of range")
+	assert.Contains(t, m.viewNewTunnel(), "out of range")
+
+	m.textInput.SetValue("2200")
+	updated, _ = m.updateNewTunnel(tea.KeyMsg{Type: tea.KeyEnter})
+	m = updated.(Model)
+	assert.Equal(t, 3, m.formIndex)
+	assert.Equal(t, "2200", m.currentForm["remote_port"])
+	assert.Empty(t, m.message)
+}
+
+func TestDeleteConfirmOffersKeyRemoval(t *testing.T) {
+	for _, key := range []string{"enter", "y"} {
+		t.Run(key, func(t *testing.T) {
+			configMgr, err := config.NewManager(t.TempDir())
+			require.NoError(t, err)
+			cfg := saveTunnelWithKeys(t, configMgr, "pi-07")
+			m := Model{
+				state:          StateConfirm,
+				confirmAction:  "delete_tunnel",
+				selectedTunnel: "pi-07",
+				configMgr:      configMgr,
+				tunnelMgr:      tunnel.NewManagerWithConfig(configMgr),
+				sshMgr:         ssh.NewKeyManager(),
+			}
+
+			updated, _ := m.updateConfirm(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("y")})
+			m = updated.(Model)
+			assert.Equal(t, StateConfirm, m.state)
+			assert.Contains(t, m.viewConfirm(), "remove its SSH keys")
+
+			msg := tea.KeyMsg{Type: tea.KeyEnter}
+			if key == "y" {
+				msg = tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("y")}
+			}
+			updated, _ = m.updateConfirm(msg)
+			m = updated.(Model)
+			assert.Equal(t, StateManageTunnels, m.state)
+			if key == "y" {
+				assert.NoFileExists(t, cfg.SSH.PrivateKeyPath)
+				assert.Contains(t, m.message, "Removed 4 key file(s)")
+			} else {
+				assert.FileExists(t, cfg.SSH.PrivateKeyPath, "Enter must keep the keys")
+				assert.Contains(t, m.message, "were kept")
+			}
+		})
+	}
+}
+
+func TestFailedTunnelCreationRollsBack(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	defer func(disabled bool) { homedir.DisableCache = disabled }(homedir.DisableCache)
+	homedir.DisableCache = true
+
+	// A cloud server refusing connections fails the key deployment
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	configMgr, err := config.NewManager(t.TempDir())
+	require.NoError(t, err)
+	m := Model{
+		state:       StateNewTunnel,
+		configMgr:   configMgr,
+		sshMgr:      ssh.NewKeyManager(),
+		currentForm: map[string]string{},
+	}
+	m.sshMgr.SetKnownHostsFile(filepath.Join(home, ".ssh", "known_hosts"))
+
+	updated, _ := m.setupTunnelWithKeys("pi-07", "127.0.0.1", port, "tunnel")
+	m = updated.(Model)
+	assert.Equal(t, StateMainMenu, m.state)
+	assert.Contains(t, m.message, "was not created: setup step 2 of 3 (Deploying the public key to the cloud server) failed")
+	assert.Empty(t, configMgr.ListConfigs())
+
+	entries, err := os.ReadDir(filepath.Join(home, ".ssh"))
+	require.NoError(t, err)
+	for _, entry := range entries {
+		assert.NotContains(t, entry.Name(), "pi-07_key", "generated keys must be removed")
+	}
+}
+
+// startKeyInstallServer runs an SSH server that accepts the public keys in
+// authorized and answers every command with success. Keys a command installs
+// the way ssh.InstallPublicKey does are accepted from then on, and returned
+// by the second function.
+func startKeyInstallServer(t *testing.T, authorized ...gossh.PublicKey) (int, func() []gossh.PublicKey) {
+	t.Helper()
+
+	var mu sync.Mutex
+	var installed []gossh.PublicKey
+	accepts := func(key gossh.PublicKey) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, known := range append(authorized, installed...) {
+			if bytes.Equal(known.Marshal(), key.Marshal()) {
+				return true
+			}
+		}
+		return false
+	}
+
+	_, hostKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signer, err := gossh.NewSignerFromKey(hostKey)
+	require.NoError(t, err)
+	serverConfig := &gossh.ServerConfig{
+		PublicKeyCallback: func(conn gossh.ConnMetadata, key gossh.PublicKey) (*gossh.Permissions, error) {
+			if accepts(key) {
+				return nil, nil
+			}
+			return nil, assert.AnError
+		},
+	}
+	serverConfig.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	install := regexp.MustCompile(`echo '([A-Za-z0-9+/=]+)' \| base64 -d`)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				sshConn, chans, reqs, err := gossh.NewServerConn(conn, serverConfig)
+				if err != nil {
+					return
+				}
+				defer sshConn.Close()
+				go gossh.DiscardRequests(reqs)
+				for newChannel := range chans {
+					channel, requests, err := newChannel.Accept()
+					if err != nil {
+						continue
+					}
+					go func() {
+						defer channel.Close()
+						for req := range requests {
+							var exec struct{ Command string }
+							if req.Type != "exec" || gossh.Unmarshal(req.Payload, &exec) != nil {
+								req.Reply(false, nil)
+								continue
+							}
+							req.Reply(true, nil)
+							if match := install.FindStringSubmatch(exec.Command); match != nil {
+								line, _ := base64.StdEncoding.DecodeString(match[1])
+								if key, _, _, _, err := gossh.ParseAuthorizedKey(line); err == nil {
+									mu.Lock()
+									installed = append(installed, key)
+									mu.Unlock()
+								}
+							}
+							channel.SendRequest("exit-status", false, gossh.Marshal(struct{ Status uint32 }{0}))
+							return
+						}
+					}()
+				}
+			}()
+		}
+	}()
+
+	return listener.Addr().(*net.TCPAddr).Port, func() []gossh.PublicKey {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]gossh.PublicKey(nil), installed...)
+	}
+}
+
+// newKeySetupModel returns a model creating tunnels with keys in a
+// temporary home directory
+func newKeySetupModel(t *testing.T) (Model, string) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	defer func(disabled bool) { t.Cleanup(func() { homedir.DisableCache = disabled }) }(homedir.DisableCache)
+	homedir.DisableCache = true
+
+	configMgr, err := config.NewManager(t.TempDir())
+	require.NoError(t, err)
+	m := Model{
+		state:       StateNewTunnel,
+		configMgr:   configMgr,
+		sshMgr:      ssh.NewKeyManager(),
+		currentForm: map[string]string{},
+	}
+	return m, home
+}
+
+func TestTunnelCreationDeploysKeyWithExistingKey(t *testing.T) {
+	m, home := newKeySetupModel(t)
+
+	// The server already accepts the user's own key
+	identity := filepath.Join(home, ".ssh", "id_ed25519")
+	require.NoError(t, m.sshMgr.GenerateKeyPair("ed25519", identity, ""))
+	pubKeyData, err := os.ReadFile(identity + ".pub")
+	require.NoError(t, err)
+	identityKey, _, _, _, err := gossh.ParseAuthorizedKey(pubKeyData)
+	require.NoError(t, err)
+	port, installed := startKeyInstallServer(t, identityKey)
+
+	updated, _ := m.setupTunnelWithKeys("pi-07", "127.0.0.1", port, "tunnel")
+	m = updated.(Model)
+	assert.Contains(t, m.message, "created successfully")
+	assert.Equal(t, []string{"pi-07"}, m.configMgr.ListConfigs())
+
+	// The tunnel's new key was installed over the existing key's login
+	tunnelKeyData, err := os.ReadFile(filepath.Join(home, ".ssh", "pi-07_key.pub"))
+	require.NoError(t, err)
+	tunnelKey, _, _, _, err := gossh.ParseAuthorizedKey(tunnelKeyData)
+	require.NoError(t, err)
+	require.Len(t, installed(), 1)
+	assert.Equal(t, tunnelKey.Marshal(), installed()[0].Marshal())
+}
+
+func TestTunnelCreationWithoutAuthorizedKeyShowsKeyToInstall(t *testing.T) {
+	m, home := newKeySetupModel(t)
+	port, installed := startKeyInstallServer(t)
+
+	updated, _ := m.setupTunnelWithKeys("pi-07", "127.0.0.1", port, "tunnel")
+	m = updated.(Model)
+	assert.Empty(t, installed())
+	assert.Equal(t, []string{"pi-07"}, m.configMgr.ListConfigs())
+
+	tunnelKeyData, err := os.ReadFile(filepath.Join(home, ".ssh", "pi-07_key.pub"))
+	require.NoError(t, err)
+	assert.Contains(t, m.message, "Add this line to ~/.ssh/authorized_keys")
+	assert.Contains(t, m.message, string(bytes.TrimSpace(tunnelKeyData)))
+}
@@ -0,0 +1,291 @@
+package process
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Process is a running process and its command line
+type Process struct {
+	PID  int
+	Args []string
+	// Started is when the process started, or zero if the platform does
+	// not report it
+	Started time.Time
+}
+
+// Name returns the base name of the process executable, without any .exe
+// suffix
+func (p Process) Name() string {
+	if len(p.Args) == 0 {
+		return ""
+	}
+	name := filepath.Base(strings.ReplaceAll(p.Args[0], `\`, "/"))
+	return strings.TrimSuffix(strings.ToLower(name), ".exe")
+}
+
+// Enumerator lists and kills processes
+type Enumerator interface {
+	Processes() ([]Process, error)
+	// StartTime returns when a process started
+	StartTime(pid int) (time.Time, error)
+	Kill(pid int) error
+}
+
+// System returns the Enumerator for the running platform: /proc on Linux,
+// Win32_Process on Windows and ps elsewhere
+func System() Enumerator {
+	switch runtime.GOOS {
+	case "linux":
+		return procEnumerator{root: "/proc"}
+	case "windows":
+		return windowsEnumerator{}
+	default:
+		return psEnumerator{}
+	}
+}
+
+// kill kills a process by ID
+func kill(pid int) error {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return fmt.Errorf("failed to find process %d: %w", pid, err)
+	}
+	if err := process.Kill(); err != nil {
+		return fmt.Errorf("failed to kill process %d: %w", pid, err)
+	}
+	return nil
+}
+
+// procEnumerator reads command lines from a Linux /proc filesystem
+type procEnumerator struct {
+	root string
+}
+
+func (e procEnumerator) Processes() ([]Process, error) {
+	entries, err := os.ReadDir(e.root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", e.root, err)
+	}
+
+	bootTime := e.bootTime()
+
+	var processes []Process
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || !entry.IsDir() {
+			continue
+		}
+
+		// Processes can exit while being listed, and kernel threads have
+		// no command line
+		data, err := os.ReadFile(filepath.Join(e.root, entry.Name(), "cmdline"))
+		if err != nil || len(data) == 0 {
+			continue
+		}
+
+		args := strings.Split(strings.TrimSuffix(string(data), "\x00"), "\x00")
+		proc := Process{PID: pid, Args: args}
+		if !bootTime.IsZero() {
+			proc.Started = e.startTime(entry.Name(), bootTime)
+		}
+		processes = append(processes, proc)
+	}
+
+	return processes, nil
+}
+
+// clockTicks is the kernel's USER_HZ, the unit of process start times in
+// /proc, which Linux fixes at 100 for user space
+const clockTicks = 100
+
+// bootTime reads when the system booted from the btime line of /proc/stat,
+// returning zero if it is unavailable
+func (e procEnumerator) bootTime() time.Time {
+	data, err := os.ReadFile(filepath.Join(e.root, "stat"))
+	if err != nil {
+		return time.Time{}
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if value, ok := strings.CutPrefix(line, "btime "); ok {
+			if seconds, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64); err == nil {
+				return time.Unix(seconds, 0)
+			}
+		}
+	}
+	return time.Time{}
+}
+
+// startTime reads when a process started from its /proc stat file,
+// returning zero if it is unavailable
+func (e procEnumerator) startTime(pid string, bootTime time.Time) time.Time {
+	data, err := os.ReadFile(filepath.Join(e.root, pid, "stat"))
+	if err != nil {
+		return time.Time{}
+	}
+	// The command name in parentheses may contain spaces; starttime is the
+	// 22nd field, the 20th after it
+	end := strings.LastIndexByte(string(data), ')')
+	if end < 0 {
+		return time.Time{}
+	}
+	fields := strings.Fields(string(data[end+1:]))
+	if len(fields) < 20 {
+		return time.Time{}
+	}
+	ticks, err := strconv.ParseInt(fields[19], 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return bootTime.Add(time.Duration(ticks) * time.Second / clockTicks)
+}
+
+func (e procEnumerator) StartTime(pid int) (time.Time, error) {
+	bootTime := e.bootTime()
+	if bootTime.IsZero() {
+		return time.Time{}, fmt.Errorf("failed to read boot time from %s", filepath.Join(e.root, "stat"))
+	}
+	started := e.startTime(strconv.Itoa(pid), bootTime)
+	if started.IsZero() {
+		return time.Time{}, fmt.Errorf("failed to read start time of process %d", pid)
+	}
+	return started, nil
+}
+
+func (e procEnumerator) Kill(pid int) error {
+	return kill(pid)
+}
+
+// psEnumerator lists processes with ps, for macOS and the BSDs. Arguments are
+// split on whitespace, as ps does not preserve their boundaries.
+type psEnumerator struct{}
+
+func (psEnumerator) Processes() ([]Process, error) {
+	output, err := exec.Command("ps", "-axww", "-o", "pid=,etime=,args=").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list processes: %w", err)
+	}
+	return parsePSLines(output, time.Now()), nil
+}
+
+// parsePSLines parses lines of "<pid> <elapsed> <command line>" as printed
+// by ps, working out start times from the elapsed times
+func parsePSLines(output []byte, now time.Time) []Process {
+	var processes []Process
+	for _, proc := range parsePIDLines(output) {
+		if len(proc.Args) < 2 {
+			continue
+		}
+		elapsed, err := parseElapsed(proc.Args[0])
+		if err != nil {
+			continue
+		}
+		proc.Started = now.Add(-elapsed)
+		proc.Args = proc.Args[1:]
+		processes = append(processes, proc)
+	}
+	return processes
+}
+
+// parseElapsed parses a ps elapsed time, "[[dd-]hh:]mm:ss"
+func parseElapsed(s string) (time.Duration, error) {
+	var days int
+	if d, rest, ok := strings.Cut(s, "-"); ok {
+		n, err := strconv.Atoi(d)
+		if err != nil {
+			return 0, fmt.Errorf("invalid elapsed time %q", s)
+		}
+		days, s = n, rest
+	}
+
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, fmt.Errorf("invalid elapsed time %q", s)
+	}
+	seconds := 0
+	for _, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return 0, fmt.Errorf("invalid elapsed time %q", s)
+		}
+		seconds = seconds*60 + n
+	}
+	return time.Duration(days)*24*time.Hour + time.Duration(seconds)*time.Second, nil
+}
+
+func (psEnumerator) StartTime(pid int) (time.Time, error) {
+	output, err := exec.Command("ps", "-o", "etime=", "-p", strconv.Itoa(pid)).Output()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read start time of process %d: %w", pid, err)
+	}
+	elapsed, err := parseElapsed(strings.TrimSpace(string(output)))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read start time of process %d: %w", pid, err)
+	}
+	return time.Now().Add(-elapsed), nil
+}
+
+func (psEnumerator) Kill(pid int) error {
+	return kill(pid)
+}
+
+// windowsEnumerator lists processes through Win32_Process, since tasklist
+// does not report command lines. Arguments are split on whitespace.
+type windowsEnumerator struct{}
+
+func (windowsEnumerator) Processes() ([]Process, error) {
+	script := `Get-CimInstance Win32_Process | ForEach-Object { "$($_.ProcessId) $($_.CommandLine)" }`
+	output, err := exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", script).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list processes: %w", err)
+	}
+	return parsePIDLines(output), nil
+}
+
+func (windowsEnumerator) StartTime(pid int) (time.Time, error) {
+	script := fmt.Sprintf(`(Get-Process -Id %d).StartTime.ToUniversalTime().ToString("o")`, pid)
+	output, err := exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", script).Output()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read start time of process %d: %w", pid, err)
+	}
+	started, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(string(output)))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read start time of process %d: %w", pid, err)
+	}
+	return started, nil
+}
+
+func (windowsEnumerator) Kill(pid int) error {
+	return kill(pid)
+}
+
+// parsePIDLines parses lines of "<pid> <command line>"
+func parsePIDLines(output []byte) []Process {
+	var processes []Process
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		pid, err := strconv.Atoi(fields[0])
+		if err != nil {
+			continue
+		}
+		args := make([]string, 0, len(fields)-1)
+		for _, arg := range fields[1:] {
+			args = append(args, strings.Trim(arg, `"`))
+		}
+		processes = append(processes, Process{PID: pid, Args: args})
+	}
+	return processes
+}
@@ -0,0 +1,90 @@
+package process
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcEnumerator(t *testing.T) {
+	root := t.TempDir()
+	writeCmdline := func(pid, cmdline string) {
+		require.NoError(t, os.MkdirAll(filepath.Join(root, pid), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(root, pid, "cmdline"), []byte(cmdline), 0644))
+	}
+	writeCmdline("42", "ssh\x00-N\x00-R\x002222:localhost:22\x00tunnel@203.0.113.1\x00")
+	writeCmdline("7", "") // kernel thread
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "self"), 0755))
+
+	processes, err := procEnumerator{root: root}.Processes()
+	require.NoError(t, err)
+	assert.Equal(t, []Process{
+		{PID: 42, Args: []string{"ssh", "-N", "-R", "2222:localhost:22", "tunnel@203.0.113.1"}},
+	}, processes)
+}
+
+func TestParsePIDLines(t *testing.T) {
+	output := []byte(`    1 /sbin/launchd
+  812 "C:\Windows\System32\OpenSSH\ssh.exe" -N -p 22 tunnel@203.0.113.1
+  913
+`)
+
+	processes := parsePIDLines(output)
+	require.Len(t, processes, 2)
+	assert.Equal(t, 812, processes[1].PID)
+	assert.Equal(t, []string{`C:\Windows\System32\OpenSSH\ssh.exe`, "-N", "-p", "22", "tunnel@203.0.113.1"}, processes[1].Args)
+	assert.Equal(t, "ssh", processes[1].Name())
+	assert.Equal(t, "launchd", processes[0].Name())
+}
+
+func TestProcEnumeratorStartTime(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "stat"), []byte("cpu  1 2 3\nbtime 1700000000\nprocesses 42\n"), 0644))
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "42"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "42", "cmdline"), []byte("ssh\x00-N\x00"), 0644))
+	// The command name contains a space and a parenthesis; starttime is
+	// 12345 ticks after boot
+	stat := "42 (ssh (x) y) S 1 42 42 0 -1 4194560 100 0 0 0 1 2 0 0 20 0 1 0 12345 1000 200 0 0 0"
+	require.NoError(t, os.WriteFile(filepath.Join(root, "42", "stat"), []byte(stat), 0644))
+
+	processes, err := procEnumerator{root: root}.Processes()
+	require.NoError(t, err)
+	require.Len(t, processes, 1)
+	assert.Equal(t, time.Unix(1700000000, 0).Add(123450*time.Millisecond), processes[0].Started)
+}
+
+func TestProcEnumeratorStartTimeOfPID(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "stat"), []byte("btime 1700000000\n"), 0644))
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "42"), 0755))
+	stat := "42 (ssh) S 1 42 42 0 -1 4194560 100 0 0 0 1 2 0 0 20 0 1 0 6000 1000 200 0 0 0"
+	require.NoError(t, os.WriteFile(filepath.Join(root, "42", "stat"), []byte(stat), 0644))
+
+	started, err := procEnumerator{root: root}.StartTime(42)
+	require.NoError(t, err)
+	assert.Equal(t, time.Unix(1700000060, 0), started)
+
+	_, err = procEnumerator{root: root}.StartTime(43)
+	assert.ErrorContains(t, err, "failed to read start time of process 43")
+}
+
+func TestParsePSLines(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	output := []byte(`    1 3-04:05:06 /sbin/launchd
+  812      01:30 /usr/bin/ssh -N -R 2222:localhost:22 tunnel@203.0.113.1
+  913 02:00:00
+  914 garbage ssh
+`)
+
+	processes := parsePSLines(output, now)
+	require.Len(t, processes, 2)
+	assert.Equal(t, now.Add(-(3*24*time.Hour + 4*time.Hour + 5*time.Minute + 6*time.Second)), processes[0].Started)
+	assert.Equal(t, []string{"/sbin/launchd"}, processes[0].Args)
+	assert.Equal(t, 812, processes[1].PID)
+	assert.Equal(t, now.Add(-90*time.Second), processes[1].Started)
+	assert.Equal(t, []string{"/usr/bin/ssh", "-N", "-R", "2222:localhost:22", "tunnel@203.0.113.1"}, processes[1].Args)
+}
@@ -0,0 +1,106 @@
+package remote
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Executor runs shell commands on a remote server. Run returns the combined
+// output and an error if the command could not be run or exited nonzero.
+type Executor interface {
+	Run(ctx context.Context, command string) (string, error)
+}
+
+// SSHExecutor runs commands in sessions on an SSH connection
+type SSHExecutor struct {
+	client *ssh.Client
+}
+
+// NewSSHExecutor creates an executor for an established SSH connection
+func NewSSHExecutor(client *ssh.Client) *SSHExecutor {
+	return &SSHExecutor{client: client}
+}
+
+// Run runs a command in a new session. If ctx is cancelled first, the session
+// is closed and ctx.Err() is returned.
+func (e *SSHExecutor) Run(ctx context.Context, command string) (string, error) {
+	session, err := e.client.NewSession()
+	if err != nil {
+		return "", fmt.Errorf("failed to create SSH session: %w", err)
+	}
+	defer session.Close()
+
+	type result struct {
+		output []byte
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		output, err := session.CombinedOutput(command)
+		done <- result{output, err}
+	}()
+
+	select {
+	case r := <-done:
+		output := string(r.output)
+		if r.err != nil {
+			return output, fmt.Errorf("%w (output: %s)", r.err, strings.TrimSpace(output))
+		}
+		return output, nil
+	case <-ctx.Done():
+		_ = session.Signal(ssh.SIGKILL)
+		session.Close()
+		return "", ctx.Err()
+	}
+}
+
+// CommandTimeoutError is returned when a remote command runs longer than the
+// per-command timeout. It matches context.DeadlineExceeded with errors.Is.
+type CommandTimeoutError struct {
+	Command string
+	Timeout time.Duration
+}
+
+func (e *CommandTimeoutError) Error() string {
+	command := strings.Join(strings.Fields(e.Command), " ")
+	if len(command) > 60 {
+		command = command[:57] + "..."
+	}
+	return fmt.Sprintf("command timed out after %s: %s", e.Timeout, command)
+}
+
+func (e *CommandTimeoutError) Unwrap() error {
+	return context.DeadlineExceeded
+}
+
+// timeoutExecutor limits how long each command of another executor may run
+type timeoutExecutor struct {
+	exec    Executor
+	timeout time.Duration
+}
+
+// WithCommandTimeout returns an executor that cancels any command running
+// longer than timeout, failing it with a *CommandTimeoutError. A timeout of
+// zero or less leaves exec unchanged.
+func WithCommandTimeout(exec Executor, timeout time.Duration) Executor {
+	if timeout <= 0 {
+		return exec
+	}
+	return &timeoutExecutor{exec: exec, timeout: timeout}
+}
+
+// Run implements Executor
+func (e *timeoutExecutor) Run(ctx context.Context, command string) (string, error) {
+	cmdCtx, cancel := context.WithTimeout(ctx, e.timeout)
+	defer cancel()
+
+	output, err := e.exec.Run(cmdCtx, command)
+	if err != nil && ctx.Err() == nil && cmdCtx.Err() == context.DeadlineExceeded {
+		return output, &CommandTimeoutError{Command: command, Timeout: e.timeout}
+	}
+	return output, err
+}
@@ -0,0 +1,164 @@
+package remote
+
+import (
+	"fmt"
+	"strings"
+)
+
+// OSReleasePath describes the server's distribution
+const OSReleasePath = "/etc/os-release"
+
+// PackageManager installs packages on a family of distributions
+type PackageManager struct {
+	Name string
+	// Update refreshes the package lists before the first install, if the
+	// package manager needs that
+	Update string
+	// Install installs the packages appended to it
+	Install string
+	// families are the os-release IDs the package manager serves
+	families []string
+	// names maps required package names to the distribution's, where they
+	// differ
+	names map[string]string
+}
+
+// PackageName returns the distribution's name for a required package
+func (pm *PackageManager) PackageName(name string) string {
+	if distName, ok := pm.names[name]; ok {
+		return distName
+	}
+	return name
+}
+
+// InstallCommand returns the command installing a package, refreshing the
+// package lists first if update is set
+func (pm *PackageManager) InstallCommand(pkg string, update bool) string {
+	cmd := pm.Install + " " + pkg
+	if update && pm.Update != "" {
+		cmd = pm.Update + " && " + cmd
+	}
+	return cmd
+}
+
+// packageManagers are the supported package managers. yum comes after dnf,
+// so distributions offering both use dnf; detectPackageManager picks yum for
+// releases too old to have dnf.
+var packageManagers = []*PackageManager{
+	{
+		Name:     "apt",
+		Update:   "DEBIAN_FRONTEND=noninteractive apt-get update -q",
+		Install:  "DEBIAN_FRONTEND=noninteractive apt-get install -y -q",
+		families: []string{"debian", "ubuntu"},
+	},
+	{
+		Name:     "dnf",
+		Install:  "dnf install -y -q",
+		families: []string{"fedora", "rhel", "centos", "rocky", "almalinux", "ol"},
+	},
+	{
+		Name:     "yum",
+		Install:  "yum install -y -q",
+		families: []string{"rhel", "centos", "amzn"},
+	},
+	{
+		Name:     "apk",
+		Update:   "apk update -q",
+		Install:  "apk add -q",
+		families: []string{"alpine"},
+	},
+	{
+		Name:     "pacman",
+		Update:   "pacman -Sy --noconfirm",
+		Install:  "pacman -S --noconfirm --needed",
+		families: []string{"arch"},
+		names:    map[string]string{"openssh-server": "openssh"},
+	},
+}
+
+// packageManager returns the supported package manager with a name
+func packageManager(name string) *PackageManager {
+	for _, pm := range packageManagers {
+		if pm.Name == name {
+			return pm
+		}
+	}
+	return nil
+}
+
+// parseOSRelease parses os-release contents into their variables, unquoted
+func parseOSRelease(content string) map[string]string {
+	vars := make(map[string]string)
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		vars[key] = value
+	}
+	return vars
+}
+
+// detectPackageManager picks the package manager for a server from its
+// os-release contents, matching ID first and then each ID_LIKE entry
+func detectPackageManager(osRelease string) (*PackageManager, error) {
+	vars := parseOSRelease(osRelease)
+	ids := append([]string{vars["ID"]}, strings.Fields(vars["ID_LIKE"])...)
+
+	for _, id := range ids {
+		if id == "" {
+			continue
+		}
+		for _, pm := range packageManagers {
+			for _, family := range pm.families {
+				if family != id {
+					continue
+				}
+				if pm.Name == "dnf" && !hasDNF(vars) {
+					return packageManager("yum"), nil
+				}
+				return pm, nil
+			}
+		}
+	}
+
+	name := vars["PRETTY_NAME"]
+	if name == "" {
+		name = vars["ID"]
+	}
+	if name == "" {
+		name = "unknown"
+	}
+	return nil, fmt.Errorf("unsupported distribution %q: remote-setup supports apt, dnf, yum, apk and pacman based systems; install %s manually",
+		name, strings.Join(requiredPackageNames(), " and "))
+}
+
+// hasDNF reports whether a Red Hat family release ships dnf: Fedora always
+// does, and RHEL and its rebuilds from version 8
+func hasDNF(vars map[string]string) bool {
+	if vars["ID"] == "fedora" {
+		return true
+	}
+	major, _, _ := strings.Cut(vars["VERSION_ID"], ".")
+	switch major {
+	case "5", "6", "7":
+		return false
+	}
+	return true
+}
+
+// requiredPackageNames lists the packages a tunnel server needs
+func requiredPackageNames() []string {
+	names := make([]string, len(requiredPackages))
+	for i, pkg := range requiredPackages {
+		names[i] = pkg.Name
+	}
+	return names
+}
@@ -0,0 +1,76 @@
+package remote
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const ubuntuOSRelease = `PRETTY_NAME="Ubuntu 24.04.1 LTS"
+NAME="Ubuntu"
+VERSION_ID="24.04"
+ID=ubuntu
+ID_LIKE=debian
+`
+
+func TestDetectPackageManager(t *testing.T) {
+	tests := []struct {
+		name      string
+		osRelease string
+		install   string
+	}{
+		{"ubuntu", ubuntuOSRelease,
+			"DEBIAN_FRONTEND=noninteractive apt-get update -q && DEBIAN_FRONTEND=noninteractive apt-get install -y -q openssh-server"},
+		{"raspbian", "ID=raspbian\nID_LIKE=debian\n",
+			"DEBIAN_FRONTEND=noninteractive apt-get update -q && DEBIAN_FRONTEND=noninteractive apt-get install -y -q openssh-server"},
+		{"fedora", "NAME=\"Fedora Linux\"\nVERSION_ID=40\nID=fedora\n",
+			"dnf install -y -q openssh-server"},
+		{"rocky 9", "ID=\"rocky\"\nID_LIKE=\"rhel centos fedora\"\nVERSION_ID=\"9.4\"\n",
+			"dnf install -y -q openssh-server"},
+		{"centos 7", "ID=\"centos\"\nID_LIKE=\"rhel fedora\"\nVERSION_ID=\"7\"\n",
+			"yum install -y -q openssh-server"},
+		{"amazon linux 2", "ID=\"amzn\"\nID_LIKE=\"centos rhel fedora\"\nVERSION_ID=\"2\"\n",
+			"yum install -y -q openssh-server"},
+		{"alpine", "NAME=\"Alpine Linux\"\nID=alpine\nVERSION_ID=3.20.2\n",
+			"apk update -q && apk add -q openssh-server"},
+		{"arch", "NAME=\"Arch Linux\"\nID=arch\n",
+			"pacman -Sy --noconfirm && pacman -S --noconfirm --needed openssh"},
+		{"manjaro", "ID=manjaro\nID_LIKE=arch\n",
+			"pacman -Sy --noconfirm && pacman -S --noconfirm --needed openssh"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pm, err := detectPackageManager(tt.osRelease)
+			require.NoError(t, err)
+			assert.Equal(t, tt.install, pm.InstallCommand(pm.PackageName("openssh-server"), true))
+		})
+	}
+}
+
+func TestDetectPackageManagerUnsupported(t *testing.T) {
+	_, err := detectPackageManager("PRETTY_NAME=\"openSUSE Tumbleweed\"\nID=\"opensuse-tumbleweed\"\nID_LIKE=\"opensuse suse\"\n")
+	assert.ErrorContains(t, err, `unsupported distribution "openSUSE Tumbleweed"`)
+	assert.ErrorContains(t, err, "install openssh-server manually")
+
+	_, err = detectPackageManager("")
+	assert.ErrorContains(t, err, `unsupported distribution "unknown"`)
+}
+
+func TestBuildPlanUsesDistributionPackageNames(t *testing.T) {
+	exec := &fakeExecutor{responses: map[string]string{
+		"/usr/sbin/sshd":        "no\n",
+		"command -v ufw":        "yes\n",
+		"id -u tunneluser":      "yes\n",
+		"cat " + OSReleasePath:  "ID=arch\n",
+		"cat " + SSHDConfigPath: "",
+		"ufw status":            "",
+	}}
+
+	plan, err := BuildPlan(context.Background(), exec, Options{})
+	require.NoError(t, err)
+	assert.Equal(t, "pacman", plan.PackageManager)
+	assert.Equal(t, []string{"openssh"}, plan.Packages)
+}
@@ -0,0 +1,273 @@
+package remote
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/lerndmina/SSH-Tunnel/internal/ssh"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// DefaultTunnelUser is the account remote-setup creates for tunnels
+const DefaultTunnelUser = "tunneluser"
+
+// validUserName matches account names that are safe to pass to useradd
+var validUserName = regexp.MustCompile(`^[a-z_][a-z0-9_-]{0,31}$`)
+
+// requiredPackage is a package remote-setup installs, and a command whose
+// presence shows it is already installed
+type requiredPackage struct {
+	Name  string
+	Check string
+}
+
+// requiredPackages are the packages a tunnel server needs
+var requiredPackages = []requiredPackage{
+	{"openssh-server", "test -x /usr/sbin/sshd"},
+}
+
+// Firewall front ends remote-setup opens the SSH port with, by command
+const (
+	firewallUFW       = "ufw"
+	firewallFirewalld = "firewall-cmd"
+)
+
+// Options describes the desired state of a tunnel server
+type Options struct {
+	// TunnelUser is the account tunnels connect as
+	TunnelUser string
+	// PublicKey is a public key to authorize for TunnelUser, if any
+	PublicKey []byte
+	// KeyOptions are authorized_keys options to prefix PublicKey with
+	KeyOptions string
+	// SSHPort is the port sshd listens on, opened in the firewall
+	SSHPort int
+	// Sudo runs the commands through sudo, for non-root logins
+	Sudo bool
+}
+
+// Plan lists the changes remote-setup would make to a server. Fields are
+// empty when the server already has the desired state.
+type Plan struct {
+	TunnelUser string
+	// CreateUser is set if TunnelUser does not exist yet
+	CreateUser bool
+	// Packages are the packages to install, named as the server's
+	// distribution names them, and PackageManager the tool installing them
+	Packages       []string
+	PackageManager string
+	// AuthorizedKey is the authorized_keys line to add for TunnelUser
+	AuthorizedKey string
+	// SSHDChanges are the sshd_config options to set
+	SSHDChanges []SSHDChange
+	// Firewall is the firewall command found on the server, "ufw" or
+	// "firewall-cmd", or empty if neither is in use
+	Firewall string
+	// FirewallRules are the arguments adding each rule with Firewall, e.g.
+	// "allow 22/tcp" for ufw or "--add-port=22/tcp" for firewalld
+	FirewallRules []string
+	// Warnings describe what remote-setup leaves for the user to check,
+	// such as a firewall it cannot manage
+	Warnings []string
+
+	sshdConfig     string
+	sudo           bool
+	packageManager *PackageManager
+	// packageChecks maps each package to install to the condition showing
+	// it is installed
+	packageChecks map[string]string
+}
+
+// Empty reports whether the plan has no changes
+func (p *Plan) Empty() bool {
+	return !p.CreateUser && len(p.Packages) == 0 && p.AuthorizedKey == "" &&
+		len(p.SSHDChanges) == 0 && len(p.FirewallRules) == 0
+}
+
+// BuildPlan inspects the server and works out the changes needed to reach
+// the state described by opts. Nothing on the server is modified.
+func BuildPlan(ctx context.Context, exec Executor, opts Options) (*Plan, error) {
+	if opts.TunnelUser == "" {
+		opts.TunnelUser = DefaultTunnelUser
+	}
+	if !validUserName.MatchString(opts.TunnelUser) {
+		return nil, fmt.Errorf("invalid tunnel user name %q", opts.TunnelUser)
+	}
+	if opts.SSHPort == 0 {
+		opts.SSHPort = 22
+	}
+
+	r := &runner{exec: exec, sudo: opts.Sudo}
+	plan := &Plan{TunnelUser: opts.TunnelUser, sudo: opts.Sudo}
+
+	var missing []requiredPackage
+	for _, pkg := range requiredPackages {
+		installed, err := r.probe(ctx, pkg.Check)
+		if err != nil {
+			return nil, err
+		}
+		if !installed {
+			missing = append(missing, pkg)
+		}
+	}
+	if len(missing) > 0 {
+		osRelease, err := r.run(ctx, "cat "+OSReleasePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", OSReleasePath, err)
+		}
+		pm, err := detectPackageManager(osRelease)
+		if err != nil {
+			return nil, err
+		}
+		plan.packageManager = pm
+		plan.PackageManager = pm.Name
+		plan.packageChecks = make(map[string]string, len(missing))
+		for _, pkg := range missing {
+			name := pm.PackageName(pkg.Name)
+			plan.Packages = append(plan.Packages, name)
+			plan.packageChecks[name] = pkg.Check
+		}
+	}
+
+	userExists, err := r.probe(ctx, "id -u "+opts.TunnelUser+" >/dev/null 2>&1")
+	if err != nil {
+		return nil, err
+	}
+	plan.CreateUser = !userExists
+
+	if len(opts.PublicKey) > 0 {
+		line, err := ssh.FormatAuthorizedKey(opts.PublicKey, opts.KeyOptions)
+		if err != nil {
+			return nil, err
+		}
+		present := false
+		if userExists {
+			existing, err := r.run(ctx, fmt.Sprintf(`cat "%s/.ssh/authorized_keys" 2>/dev/null || true`, userHome(opts.TunnelUser)))
+			if err != nil {
+				return nil, fmt.Errorf("failed to read authorized_keys: %w", err)
+			}
+			pubKey, _, _, _, err := gossh.ParseAuthorizedKey(line)
+			if err != nil {
+				return nil, fmt.Errorf("invalid public key: %w", err)
+			}
+			present = ssh.AuthorizedKeysContain([]byte(existing), pubKey)
+		}
+		if !present {
+			plan.AuthorizedKey = strings.TrimSpace(string(line))
+		}
+	}
+
+	sshdConfig, err := r.run(ctx, "cat "+SSHDConfigPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", SSHDConfigPath, err)
+	}
+	plan.sshdConfig = sshdConfig
+	plan.SSHDChanges = planSSHDChanges(sshdConfig)
+
+	if err := planFirewall(ctx, r, plan, opts.SSHPort); err != nil {
+		return nil, err
+	}
+
+	return plan, nil
+}
+
+// planFirewall opens the SSH port with ufw, or else with a running firewalld.
+// Servers with neither get a warning instead, as remote-setup cannot tell
+// what other firewalls, such as plain nftables rules, let through.
+func planFirewall(ctx context.Context, r *runner, plan *Plan, port int) error {
+	hasUFW, err := r.probe(ctx, "command -v ufw >/dev/null 2>&1")
+	if err != nil {
+		return err
+	}
+	if hasUFW {
+		plan.Firewall = firewallUFW
+		status, err := r.run(ctx, "ufw status 2>/dev/null || true")
+		if err != nil {
+			return fmt.Errorf("failed to read firewall rules: %w", err)
+		}
+		if !ufwAllows(status, port) {
+			plan.FirewallRules = append(plan.FirewallRules, fmt.Sprintf("allow %d/tcp", port))
+		}
+		return nil
+	}
+
+	hasFirewalld, err := r.probe(ctx, "command -v firewall-cmd >/dev/null 2>&1 && firewall-cmd --state >/dev/null 2>&1")
+	if err != nil {
+		return err
+	}
+	if hasFirewalld {
+		plan.Firewall = firewallFirewalld
+		check := fmt.Sprintf("firewall-cmd --query-port=%d/tcp >/dev/null 2>&1", port)
+		if port == 22 {
+			check += " || firewall-cmd --query-service=ssh >/dev/null 2>&1"
+		}
+		open, err := r.probe(ctx, check)
+		if err != nil {
+			return fmt.Errorf("failed to read firewall rules: %w", err)
+		}
+		if !open {
+			plan.FirewallRules = append(plan.FirewallRules, fmt.Sprintf("--add-port=%d/tcp", port))
+		}
+		return nil
+	}
+
+	plan.Warnings = append(plan.Warnings, fmt.Sprintf("Neither ufw nor firewalld is in use; make sure the server's firewall allows port %d/tcp", port))
+	return nil
+}
+
+// firewallCommand returns the command adding a rule with a firewall, made
+// permanent for firewalld
+func firewallCommand(firewall, rule string) string {
+	if firewall == firewallFirewalld {
+		return fmt.Sprintf("firewall-cmd --permanent %s && firewall-cmd --reload", rule)
+	}
+	return firewall + " " + rule
+}
+
+// ufwAllows reports whether `ufw status` output has an allow rule for port
+func ufwAllows(status string, port int) bool {
+	want := fmt.Sprintf("%d/tcp", port)
+	for _, line := range strings.Split(status, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && (fields[0] == want || fields[0] == fmt.Sprint(port)) &&
+			strings.EqualFold(fields[1], "ALLOW") {
+			return true
+		}
+	}
+	return false
+}
+
+// userHome returns a shell expression for a user's home directory
+func userHome(user string) string {
+	return fmt.Sprintf("$(getent passwd %s | cut -d: -f6)", user)
+}
+
+// runner runs commands on the server, through sudo if required
+type runner struct {
+	exec Executor
+	sudo bool
+}
+
+// run runs a shell command
+func (r *runner) run(ctx context.Context, command string) (string, error) {
+	if r.sudo {
+		command = "sudo -n sh -c " + shellQuote(command)
+	}
+	return r.exec.Run(ctx, command)
+}
+
+// probe runs a shell condition and reports whether it held
+func (r *runner) probe(ctx context.Context, condition string) (bool, error) {
+	output, err := r.run(ctx, fmt.Sprintf("if %s; then echo yes; else echo no; fi", condition))
+	if err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(output) == "yes", nil
+}
+
+// shellQuote quotes s as a single POSIX shell word
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,195 @@
+package remote
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lerndmina/SSH-Tunnel/internal/ssh"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeExecutor answers commands from a table of substrings to outputs and
+// records every command run. Commands matching a key in failures return its
+// output along with an error.
+type fakeExecutor struct {
+	responses map[string]string
+	failures  map[string]string
+	commands  []string
+}
+
+func (f *fakeExecutor) Run(ctx context.Context, command string) (string, error) {
+	f.commands = append(f.commands, command)
+	for match, output := range f.failures {
+		if strings.Contains(command, match) {
+			return output, fmt.Errorf("Process exited with status 1")
+		}
+	}
+	for match, output := range f.responses {
+		if strings.Contains(command, match) {
+			return output, nil
+		}
+	}
+	return "", fmt.Errorf("unexpected command: %s", command)
+}
+
+const freshSSHDConfig = `# Default sshd_config
+#PubkeyAuthentication yes
+AllowTcpForwarding no
+ClientAliveInterval 0
+
+Match User backup
+	AllowTcpForwarding yes
+`
+
+// testPublicKey generates a public key for authorizing
+func testPublicKey(t *testing.T) []byte {
+	t.Helper()
+	keyPath := filepath.Join(t.TempDir(), "id_ed25519")
+	require.NoError(t, ssh.NewKeyManager().GenerateKeyPair("ed25519", keyPath, "ssh-tunnel:home@test"))
+	data, err := os.ReadFile(keyPath + ".pub")
+	require.NoError(t, err)
+	return data
+}
+
+func TestBuildPlanEnumeratesChanges(t *testing.T) {
+	exec := &fakeExecutor{responses: map[string]string{
+		"/usr/sbin/sshd":        "no\n",
+		"command -v ufw":        "yes\n",
+		"id -u tunneluser":      "no\n",
+		"cat " + SSHDConfigPath: freshSSHDConfig,
+		"cat " + OSReleasePath:  ubuntuOSRelease,
+		"ufw status":            "",
+	}}
+	pubKey := testPublicKey(t)
+
+	plan, err := BuildPlan(context.Background(), exec, Options{
+		TunnelUser: "tunneluser",
+		PublicKey:  pubKey,
+		KeyOptions: ssh.RestrictedKeyOptions,
+		SSHPort:    2200,
+	})
+	require.NoError(t, err)
+
+	assert.False(t, plan.Empty())
+	assert.Equal(t, []string{"openssh-server"}, plan.Packages)
+	assert.Equal(t, "apt", plan.PackageManager)
+	assert.True(t, plan.CreateUser)
+	assert.Equal(t, "tunneluser", plan.TunnelUser)
+	assert.True(t, strings.HasPrefix(plan.AuthorizedKey, ssh.RestrictedKeyOptions+" ssh-ed25519 "))
+	assert.Equal(t, "ufw", plan.Firewall)
+	assert.Equal(t, []string{"allow 2200/tcp"}, plan.FirewallRules)
+	assert.Empty(t, plan.Warnings)
+
+	var changes []string
+	for _, change := range plan.SSHDChanges {
+		changes = append(changes, change.Before+" -> "+change.After)
+	}
+	assert.Equal(t, []string{
+		" -> PubkeyAuthentication yes",
+		"AllowTcpForwarding no -> AllowTcpForwarding yes",
+		" -> GatewayPorts no",
+		"ClientAliveInterval 0 -> ClientAliveInterval 30",
+		" -> ClientAliveCountMax 3",
+	}, changes)
+
+	// Inspecting the server must not change it
+	for _, cmd := range exec.commands {
+		assert.NotContains(t, cmd, "useradd")
+		assert.NotContains(t, cmd, "apt-get")
+	}
+}
+
+func TestBuildPlanEmptyWhenConfigured(t *testing.T) {
+	pubKey := testPublicKey(t)
+	line, err := ssh.FormatAuthorizedKey(pubKey, "")
+	require.NoError(t, err)
+
+	exec := &fakeExecutor{responses: map[string]string{
+		"/usr/sbin/sshd":   "yes\n",
+		"command -v ufw":   "yes\n",
+		"id -u tunneluser": "yes\n",
+		"authorized_keys":  string(line),
+		"cat " + SSHDConfigPath: "PubkeyAuthentication yes\nAllowTcpForwarding yes\nGatewayPorts no\n" +
+			"ClientAliveInterval 30\nClientAliveCountMax 3\n",
+		"ufw status": "Status: active\n\nTo                         Action      From\n--                         ------      ----\n22/tcp                     ALLOW       Anywhere\n",
+	}}
+
+	plan, err := BuildPlan(context.Background(), exec, Options{TunnelUser: "tunneluser", PublicKey: pubKey})
+	require.NoError(t, err)
+	assert.True(t, plan.Empty())
+}
+
+func TestBuildPlanOpensPortWithFirewalld(t *testing.T) {
+	exec := &fakeExecutor{responses: map[string]string{
+		"/usr/sbin/sshd":        "yes\n",
+		"command -v ufw":        "no\n",
+		"firewall-cmd --state":  "yes\n",
+		"--query-port=2200/tcp": "no\n",
+		"id -u tunneluser":      "yes\n",
+		"cat " + SSHDConfigPath: freshSSHDConfig,
+	}}
+
+	plan, err := BuildPlan(context.Background(), exec, Options{SSHPort: 2200})
+	require.NoError(t, err)
+	assert.Empty(t, plan.Packages, "no firewall is installed")
+	assert.Equal(t, "firewall-cmd", plan.Firewall)
+	assert.Equal(t, []string{"--add-port=2200/tcp"}, plan.FirewallRules)
+	assert.Equal(t, "firewall-cmd --permanent --add-port=2200/tcp && firewall-cmd --reload", firewallCommand(plan.Firewall, plan.FirewallRules[0]))
+}
+
+func TestBuildPlanWarnsWithoutKnownFirewall(t *testing.T) {
+	exec := &fakeExecutor{responses: map[string]string{
+		"/usr/sbin/sshd":        "yes\n",
+		"command -v ufw":        "no\n",
+		"firewall-cmd --state":  "no\n",
+		"id -u tunneluser":      "yes\n",
+		"cat " + SSHDConfigPath: "PubkeyAuthentication yes\nAllowTcpForwarding yes\nGatewayPorts no\nClientAliveInterval 30\nClientAliveCountMax 3\n",
+	}}
+
+	plan, err := BuildPlan(context.Background(), exec, Options{})
+	require.NoError(t, err)
+	assert.True(t, plan.Empty())
+	assert.Empty(t, plan.Firewall)
+	require.Len(t, plan.Warnings, 1)
+	assert.Contains(t, plan.Warnings[0], "allows port 22/tcp")
+}
+
+func TestBuildPlanUsesSudo(t *testing.T) {
+	exec := &fakeExecutor{responses: map[string]string{
+		"sudo -n sh -c": "yes\n",
+	}}
+
+	_, err := BuildPlan(context.Background(), exec, Options{Sudo: true})
+	require.NoError(t, err)
+	for _, cmd := range exec.commands {
+		assert.True(t, strings.HasPrefix(cmd, "sudo -n sh -c '"), cmd)
+	}
+}
+
+func TestBuildPlanRejectsInvalidUser(t *testing.T) {
+	_, err := BuildPlan(context.Background(), &fakeExecutor{}, Options{TunnelUser: "bad; rm -rf /"})
+	assert.Error(t, err)
+}
+
+func TestApplySSHDChanges(t *testing.T) {
+	changes := planSSHDChanges(freshSSHDConfig)
+	updated := applySSHDChanges(freshSSHDConfig, changes)
+
+	assert.Equal(t, `# Default sshd_config
+#PubkeyAuthentication yes
+AllowTcpForwarding yes
+ClientAliveInterval 30
+
+PubkeyAuthentication yes
+GatewayPorts no
+ClientAliveCountMax 3
+Match User backup
+	AllowTcpForwarding yes
+`, updated)
+	assert.Empty(t, planSSHDChanges(updated))
+}
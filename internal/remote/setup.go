@@ -0,0 +1,282 @@
+package remote
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// reloadSSHD reloads sshd under whichever service name the distribution uses
+const reloadSSHD = "systemctl reload ssh 2>/dev/null || systemctl reload sshd 2>/dev/null || rc-service sshd reload 2>/dev/null || service ssh reload"
+
+// ProgressFile records on the server which setup steps have completed, so
+// that a run interrupted midway continues where it stopped. It is removed
+// once a run completes.
+const ProgressFile = "/var/lib/ssh-tunnel/remote-setup.progress"
+
+// installAttempts is how many times a package install is tried before
+// remote-setup gives up, waiting installRetryDelay after the first failure
+// and twice as long after each further one
+const installAttempts = 3
+
+// installRetryDelay is a variable so tests need not wait
+var installRetryDelay = 10 * time.Second
+
+// Result records the changes an Apply run made. Changes that were already
+// in place, or recorded as done by an earlier interrupted run, are left out,
+// so re-running setup on a finished server reports no changes.
+type Result struct {
+	// Packages are the packages installed
+	Packages []string `json:"packages_installed"`
+	// UserCreated is set if the tunnel user was created
+	UserCreated bool `json:"user_created"`
+	// KeyDeployed is set if the key was added to the user's authorized_keys
+	KeyDeployed bool `json:"key_deployed"`
+	// SSHDOptions are the sshd_config lines set, e.g. "GatewayPorts yes",
+	// and SSHDBackup the backup taken of the file before
+	SSHDOptions []string `json:"sshd_options_set"`
+	SSHDBackup  string   `json:"sshd_backup,omitempty"`
+	// FirewallRules are the firewall rules added, as passed to the plan's
+	// Firewall
+	FirewallRules []string `json:"firewall_rules_added"`
+}
+
+// Changed reports whether any change was made
+func (r *Result) Changed() bool {
+	return len(r.Packages) > 0 || r.UserCreated || r.KeyDeployed ||
+		len(r.SSHDOptions) > 0 || len(r.FirewallRules) > 0
+}
+
+// setupStep is one change Apply makes. Its name identifies the exact change,
+// e.g. the package or firewall rule, so a recorded step never stands in for
+// a different one.
+type setupStep struct {
+	name string
+	// applied, if set, checks whether the change is already in place
+	applied func(ctx context.Context, r *runner) (bool, error)
+	apply   func(ctx context.Context, r *runner) error
+}
+
+// Apply makes the changes in a plan built by BuildPlan. Each step is
+// recorded in ProgressFile once done, and steps recorded by an earlier,
+// interrupted run or found already in place are skipped, so running Apply
+// again after a failure resumes from the failed step. The returned result
+// lists the changes made, including those made before a failure.
+func Apply(ctx context.Context, exec Executor, plan *Plan) (*Result, error) {
+	r := &runner{exec: exec, sudo: plan.sudo}
+	res := &Result{}
+
+	output, err := r.run(ctx, "cat "+ProgressFile+" 2>/dev/null || true")
+	if err != nil {
+		return res, fmt.Errorf("failed to read setup progress: %w", err)
+	}
+	done := make(map[string]bool)
+	for _, line := range strings.Split(output, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			done[line] = true
+		}
+	}
+
+	for _, step := range planSteps(plan, res) {
+		if done[step.name] {
+			continue
+		}
+		if step.applied != nil {
+			applied, err := step.applied(ctx, r)
+			if err != nil {
+				return res, stepError(step, err)
+			}
+			if applied {
+				continue
+			}
+		}
+
+		if err := step.apply(ctx, r); err != nil {
+			return res, stepError(step, err)
+		}
+		record := fmt.Sprintf("mkdir -p %s && echo %s >> %s", path.Dir(ProgressFile), shellQuote(step.name), ProgressFile)
+		if _, err := r.run(ctx, record); err != nil {
+			return res, fmt.Errorf("failed to record setup progress: %w", err)
+		}
+	}
+
+	if _, err := r.run(ctx, "rm -f "+ProgressFile); err != nil {
+		return res, fmt.Errorf("failed to clear setup progress: %w", err)
+	}
+	return res, nil
+}
+
+// planSteps lists the steps making a plan's changes, in order. Each step
+// adds its change to res once made.
+func planSteps(plan *Plan, res *Result) []setupStep {
+	var steps []setupStep
+
+	listsUpdated := false
+	for _, name := range plan.Packages {
+		name := name
+		steps = append(steps, setupStep{
+			name:    "package " + name,
+			applied: packageInstalled(plan.packageChecks[name]),
+			apply: func(ctx context.Context, r *runner) error {
+				if plan.packageManager == nil {
+					return fmt.Errorf("failed to install %s: no package manager detected", name)
+				}
+				// The package lists only need refreshing once per run
+				cmd := plan.packageManager.InstallCommand(name, !listsUpdated)
+				if err := installWithRetry(ctx, r, cmd); err != nil {
+					return fmt.Errorf("failed to install %s: %w", name, err)
+				}
+				listsUpdated = true
+				res.Packages = append(res.Packages, name)
+				return nil
+			},
+		})
+	}
+
+	if plan.CreateUser {
+		steps = append(steps, setupStep{
+			name: "user " + plan.TunnelUser,
+			applied: func(ctx context.Context, r *runner) (bool, error) {
+				return r.probe(ctx, "id -u "+plan.TunnelUser+" >/dev/null 2>&1")
+			},
+			apply: func(ctx context.Context, r *runner) error {
+				if _, err := r.run(ctx, "useradd -m -s /bin/bash "+plan.TunnelUser); err != nil {
+					return fmt.Errorf("failed to create user %s: %w", plan.TunnelUser, err)
+				}
+				res.UserCreated = true
+				return nil
+			},
+		})
+	}
+
+	if plan.AuthorizedKey != "" {
+		steps = append(steps, setupStep{
+			name:    "authorized-key " + plan.TunnelUser + " " + shortDigest(plan.AuthorizedKey),
+			applied: keyAuthorized(plan.TunnelUser, plan.AuthorizedKey),
+			apply: func(ctx context.Context, r *runner) error {
+				// Sent base64 encoded so key options containing quotes survive the
+				// remote shell, with a newline added first if the file lacks one
+				cmd := fmt.Sprintf(`home=%s &&
+			mkdir -p "$home/.ssh" &&
+			touch "$home/.ssh/authorized_keys" &&
+			{ [ ! -s "$home/.ssh/authorized_keys" ] || [ -z "$(tail -c 1 "$home/.ssh/authorized_keys")" ] || echo >> "$home/.ssh/authorized_keys"; } &&
+			echo '%s' | base64 -d >> "$home/.ssh/authorized_keys" &&
+			chmod 700 "$home/.ssh" &&
+			chmod 600 "$home/.ssh/authorized_keys" &&
+			chown -R %s: "$home/.ssh"`,
+					userHome(plan.TunnelUser), base64.StdEncoding.EncodeToString([]byte(plan.AuthorizedKey+"\n")), plan.TunnelUser)
+				if _, err := r.run(ctx, cmd); err != nil {
+					return fmt.Errorf("failed to authorize key for %s: %w", plan.TunnelUser, err)
+				}
+				res.KeyDeployed = true
+				return nil
+			},
+		})
+	}
+
+	if len(plan.SSHDChanges) > 0 {
+		updated := applySSHDChanges(plan.sshdConfig, plan.SSHDChanges)
+		steps = append(steps, setupStep{
+			name: "sshd-config " + shortDigest(updated),
+			apply: func(ctx context.Context, r *runner) error {
+				backup, err := updateSSHDConfig(ctx, r, updated, time.Now())
+				if err != nil {
+					return err
+				}
+				for _, change := range plan.SSHDChanges {
+					res.SSHDOptions = append(res.SSHDOptions, change.After)
+				}
+				res.SSHDBackup = backup
+				return nil
+			},
+		})
+	}
+
+	for _, rule := range plan.FirewallRules {
+		rule := rule
+		steps = append(steps, setupStep{
+			name: "firewall " + rule,
+			apply: func(ctx context.Context, r *runner) error {
+				if _, err := r.run(ctx, firewallCommand(plan.Firewall, rule)); err != nil {
+					return fmt.Errorf("failed to add firewall rule %q: %w", rule, err)
+				}
+				res.FirewallRules = append(res.FirewallRules, rule)
+				return nil
+			},
+		})
+	}
+
+	return steps
+}
+
+// stepError names the step in errors from commands that timed out, so the
+// user can see where setup stalled
+func stepError(step setupStep, err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("step '%s' stalled: %w", step.name, err)
+	}
+	return err
+}
+
+// packageInstalled returns a check for a package's presence from its
+// condition, or nil if there is none
+func packageInstalled(check string) func(ctx context.Context, r *runner) (bool, error) {
+	if check == "" {
+		return nil
+	}
+	return func(ctx context.Context, r *runner) (bool, error) {
+		return r.probe(ctx, check)
+	}
+}
+
+// keyAuthorized returns a check for an authorized_keys line's key already
+// being in the user's authorized_keys, or nil if the line does not parse
+func keyAuthorized(user, line string) func(ctx context.Context, r *runner) (bool, error) {
+	pubKey, _, _, _, err := gossh.ParseAuthorizedKey([]byte(line))
+	if err != nil {
+		return nil
+	}
+	blob := base64.StdEncoding.EncodeToString(pubKey.Marshal())
+	return func(ctx context.Context, r *runner) (bool, error) {
+		return r.probe(ctx, fmt.Sprintf(`grep -qF '%s' "%s/.ssh/authorized_keys" 2>/dev/null`, blob, userHome(user)))
+	}
+}
+
+// installWithRetry runs a package install command, retrying with growing
+// delays since mirrors and apt locks often fail transiently
+func installWithRetry(ctx context.Context, r *runner, cmd string) error {
+	delay := installRetryDelay
+	var err error
+	for attempt := 1; attempt <= installAttempts; attempt++ {
+		if _, err = r.run(ctx, cmd); err == nil {
+			return nil
+		}
+		if attempt == installAttempts {
+			break
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		delay *= 2
+	}
+	return fmt.Errorf("%w (tried %d times)", err, installAttempts)
+}
+
+// shortDigest returns a short hash identifying s
+func shortDigest(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:6])
+}
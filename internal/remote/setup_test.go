@@ -0,0 +1,232 @@
+package remote
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lerndmina/SSH-Tunnel/internal/ssh"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// progressExecutor keeps ProgressFile in memory and passes every other
+// command on to a fakeExecutor
+type progressExecutor struct {
+	*fakeExecutor
+	progress []string
+}
+
+func (p *progressExecutor) Run(ctx context.Context, command string) (string, error) {
+	if !strings.Contains(command, ProgressFile) {
+		return p.fakeExecutor.Run(ctx, command)
+	}
+
+	switch {
+	case strings.HasPrefix(command, "cat "):
+		if len(p.progress) == 0 {
+			return "", nil
+		}
+		return strings.Join(p.progress, "\n") + "\n", nil
+	case strings.HasPrefix(command, "rm "):
+		p.progress = nil
+	default:
+		_, rest, _ := strings.Cut(command, "echo '")
+		step, _, _ := strings.Cut(rest, "' >>")
+		p.progress = append(p.progress, step)
+	}
+	return "", nil
+}
+
+// commandsContaining counts the commands run that contain s
+func (f *fakeExecutor) commandsContaining(s string) int {
+	n := 0
+	for _, cmd := range f.commands {
+		if strings.Contains(cmd, s) {
+			n++
+		}
+	}
+	return n
+}
+
+// noRetryDelay makes package installs retry at once for the test
+func noRetryDelay(t *testing.T) {
+	delay := installRetryDelay
+	installRetryDelay = 0
+	t.Cleanup(func() { installRetryDelay = delay })
+}
+
+func TestApplyResumesAfterFailure(t *testing.T) {
+	noRetryDelay(t)
+	plan := &Plan{
+		TunnelUser:     "tunneluser",
+		Packages:       []string{"ufw"},
+		CreateUser:     true,
+		Firewall:       "ufw",
+		FirewallRules:  []string{"allow 22/tcp"},
+		packageManager: packageManager("apt"),
+		packageChecks:  map[string]string{"ufw": "command -v ufw >/dev/null 2>&1"},
+	}
+
+	exec := &progressExecutor{fakeExecutor: &fakeExecutor{
+		responses: map[string]string{
+			"command -v ufw":   "no\n",
+			"id -u tunneluser": "no\n",
+			"apt-get install":  "",
+			"ufw allow":        "",
+		},
+		failures: map[string]string{"useradd": "useradd: cannot lock /etc/passwd"},
+	}}
+
+	_, err := Apply(context.Background(), exec, plan)
+	require.ErrorContains(t, err, "failed to create user tunneluser")
+	assert.Equal(t, []string{"package ufw"}, exec.progress)
+	assert.Zero(t, exec.commandsContaining("ufw allow"))
+
+	// The re-run skips the installed package and continues with the user
+	exec.failures = nil
+	exec.responses["useradd"] = ""
+	exec.commands = nil
+	_, err = Apply(context.Background(), exec, plan)
+	require.NoError(t, err)
+	assert.Zero(t, exec.commandsContaining("apt-get"))
+	assert.Equal(t, 1, exec.commandsContaining("useradd"))
+	assert.Equal(t, 1, exec.commandsContaining("ufw allow 22/tcp"))
+	assert.Empty(t, exec.progress, "progress is cleared once setup completes")
+}
+
+func TestApplySkipsStepsAlreadyInPlace(t *testing.T) {
+	exec := &progressExecutor{fakeExecutor: &fakeExecutor{responses: map[string]string{
+		"/usr/sbin/sshd":   "yes\n",
+		"id -u tunneluser": "yes\n",
+	}}}
+
+	plan := &Plan{
+		TunnelUser:     "tunneluser",
+		Packages:       []string{"openssh-server"},
+		CreateUser:     true,
+		packageManager: packageManager("apt"),
+		packageChecks:  map[string]string{"openssh-server": "test -x /usr/sbin/sshd"},
+	}
+	_, err := Apply(context.Background(), exec, plan)
+	require.NoError(t, err)
+	assert.Zero(t, exec.commandsContaining("apt-get"))
+	assert.Zero(t, exec.commandsContaining("useradd"))
+}
+
+func TestApplyRetriesPackageInstall(t *testing.T) {
+	noRetryDelay(t)
+	exec := &progressExecutor{fakeExecutor: &fakeExecutor{
+		responses: map[string]string{"command -v ufw": "no\n"},
+		failures:  map[string]string{"apt-get": "E: Could not get lock /var/lib/dpkg/lock-frontend"},
+	}}
+
+	_, err := Apply(context.Background(), exec, &Plan{Packages: []string{"ufw"}, packageManager: packageManager("apt")})
+	require.ErrorContains(t, err, "failed to install ufw")
+	assert.ErrorContains(t, err, "tried 3 times")
+	assert.Equal(t, installAttempts, exec.commandsContaining("apt-get install"))
+	assert.Empty(t, exec.progress)
+}
+
+// hangingExecutor never finishes commands containing match, like a command
+// stuck on a lock, until its context is cancelled
+type hangingExecutor struct {
+	Executor
+	match string
+}
+
+func (h *hangingExecutor) Run(ctx context.Context, command string) (string, error) {
+	if strings.Contains(command, h.match) {
+		<-ctx.Done()
+		return "", ctx.Err()
+	}
+	return h.Executor.Run(ctx, command)
+}
+
+func TestApplyCommandTimeoutNamesStalledStep(t *testing.T) {
+	fake := &progressExecutor{fakeExecutor: &fakeExecutor{responses: map[string]string{"id -u tunneluser": "no\n"}}}
+	exec := WithCommandTimeout(&hangingExecutor{Executor: fake, match: "useradd"}, 50*time.Millisecond)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := Apply(context.Background(), exec, &Plan{TunnelUser: "tunneluser", CreateUser: true})
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		require.Error(t, err)
+		var timeoutErr *CommandTimeoutError
+		require.ErrorAs(t, err, &timeoutErr)
+		assert.Equal(t, 50*time.Millisecond, timeoutErr.Timeout)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.ErrorContains(t, err, "step 'user tunneluser' stalled")
+		assert.Empty(t, fake.progress)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Apply did not return after the command timeout")
+	}
+}
+
+func TestApplyOverallTimeout(t *testing.T) {
+	fake := &progressExecutor{fakeExecutor: &fakeExecutor{}}
+	exec := &hangingExecutor{Executor: fake, match: "ufw allow"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := Apply(ctx, exec, &Plan{Firewall: "ufw", FirewallRules: []string{"allow 22/tcp"}})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.ErrorContains(t, err, "step 'firewall allow 22/tcp' stalled")
+}
+
+func TestApplyReportsChangesMade(t *testing.T) {
+	pubKey := testPublicKey(t)
+	line, err := ssh.FormatAuthorizedKey(pubKey, "")
+	require.NoError(t, err)
+
+	plan := &Plan{
+		TunnelUser:     "tunneluser",
+		Packages:       []string{"ufw"},
+		CreateUser:     true,
+		AuthorizedKey:  strings.TrimSpace(string(line)),
+		SSHDChanges:    []SSHDChange{{Option: "GatewayPorts", After: "GatewayPorts no", line: -1}},
+		Firewall:       "ufw",
+		FirewallRules:  []string{"allow 22/tcp"},
+		sshdConfig:     "PubkeyAuthentication yes\n",
+		packageManager: packageManager("apt"),
+		packageChecks:  map[string]string{"ufw": "command -v ufw >/dev/null 2>&1"},
+	}
+	newExec := func() *progressExecutor {
+		return &progressExecutor{fakeExecutor: &fakeExecutor{responses: map[string]string{
+			// ufw is already installed, everything else is missing
+			"command -v ufw":   "yes\n",
+			"id -u tunneluser": "no\n",
+			"useradd":          "",
+			"grep -qF":         "no\n",
+			"base64 -d":        "",
+			"cp -p":            "",
+			validateSSHD:       "",
+			"systemctl reload": "",
+			"ufw allow":        "",
+		}}}
+	}
+
+	res, err := Apply(context.Background(), newExec(), plan)
+	require.NoError(t, err)
+	assert.True(t, res.Changed())
+	assert.Empty(t, res.Packages, "packages already installed are not reported")
+	assert.True(t, res.UserCreated)
+	assert.True(t, res.KeyDeployed)
+	assert.Equal(t, []string{"GatewayPorts no"}, res.SSHDOptions)
+	assert.True(t, strings.HasPrefix(res.SSHDBackup, sshdBackupPrefix))
+	assert.Equal(t, []string{"allow 22/tcp"}, res.FirewallRules)
+
+	// A failed step still reports the changes made before it
+	exec := newExec()
+	exec.failures = map[string]string{"ufw allow": "ERROR: Couldn't determine iptables version"}
+	res, err = Apply(context.Background(), exec, plan)
+	require.ErrorContains(t, err, "failed to add firewall rule")
+	assert.True(t, res.UserCreated)
+	assert.Equal(t, []string{"GatewayPorts no"}, res.SSHDOptions)
+	assert.Empty(t, res.FirewallRules)
+}
@@ -0,0 +1,205 @@
+package remote
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// SSHDConfigPath is the sshd configuration file remote-setup edits
+const SSHDConfigPath = "/etc/ssh/sshd_config"
+
+// sshdSetting is an sshd_config option and the value remote-setup requires
+type sshdSetting struct {
+	Option string
+	Value  string
+}
+
+// sshdSettings are the sshd options a tunnel server needs: forwarding for the
+// reverse tunnel, remote forwards kept on loopback, and keepalives so dead
+// tunnels release their ports
+var sshdSettings = []sshdSetting{
+	{"PubkeyAuthentication", "yes"},
+	{"AllowTcpForwarding", "yes"},
+	{"GatewayPorts", "no"},
+	{"ClientAliveInterval", "30"},
+	{"ClientAliveCountMax", "3"},
+}
+
+// SSHDChange is a single sshd_config option to set. Before is the line
+// currently in effect, or empty if the option is not set.
+type SSHDChange struct {
+	Option string
+	Before string
+	After  string
+
+	// line is the index of Before in the file, or -1 if the option is unset
+	line int
+}
+
+// parseSSHDLine splits an sshd_config line into its keyword and value.
+// Comments and blank lines return an empty keyword.
+func parseSSHDLine(line string) (string, string) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", ""
+	}
+
+	end := strings.IndexAny(line, " \t=")
+	if end < 0 {
+		return line, ""
+	}
+	value := strings.TrimLeft(line[end:], " \t=")
+	return line[:end], strings.TrimSpace(value)
+}
+
+// planSSHDChanges compares an sshd_config against sshdSettings. Only global
+// options count: sshd uses the first value it sees, and anything after the
+// first Match block is conditional.
+func planSSHDChanges(content string) []SSHDChange {
+	lines := strings.Split(content, "\n")
+	current := make(map[string]int)
+	for i, line := range lines {
+		keyword, _ := parseSSHDLine(line)
+		if keyword == "" {
+			continue
+		}
+		keyword = strings.ToLower(keyword)
+		if keyword == "match" {
+			break
+		}
+		if _, seen := current[keyword]; !seen {
+			current[keyword] = i
+		}
+	}
+
+	var changes []SSHDChange
+	for _, setting := range sshdSettings {
+		after := setting.Option + " " + setting.Value
+		index, ok := current[strings.ToLower(setting.Option)]
+		if !ok {
+			changes = append(changes, SSHDChange{Option: setting.Option, After: after, line: -1})
+			continue
+		}
+
+		_, value := parseSSHDLine(lines[index])
+		if strings.EqualFold(value, setting.Value) {
+			continue
+		}
+		changes = append(changes, SSHDChange{
+			Option: setting.Option,
+			Before: strings.TrimSpace(lines[index]),
+			After:  after,
+			line:   index,
+		})
+	}
+
+	return changes
+}
+
+// applySSHDChanges returns content with changes applied. Existing lines are
+// replaced in place; unset options are added before the first Match block so
+// they stay global.
+func applySSHDChanges(content string, changes []SSHDChange) string {
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	if content == "" {
+		lines = nil
+	}
+
+	var added []string
+	for _, change := range changes {
+		if change.line >= 0 && change.line < len(lines) {
+			lines[change.line] = change.After
+			continue
+		}
+		added = append(added, change.After)
+	}
+
+	insertAt := len(lines)
+	for i, line := range lines {
+		if keyword, _ := parseSSHDLine(line); strings.EqualFold(keyword, "match") {
+			insertAt = i
+			break
+		}
+	}
+
+	result := make([]string, 0, len(lines)+len(added))
+	result = append(result, lines[:insertAt]...)
+	result = append(result, added...)
+	result = append(result, lines[insertAt:]...)
+	return strings.Join(result, "\n") + "\n"
+}
+
+// sshdBackupPrefix is prepended to a timestamp to name sshd_config backups
+const sshdBackupPrefix = SSHDConfigPath + ".ssh-tunnel-backup."
+
+// sshdBackupTimeFormat sorts backups chronologically by name
+const sshdBackupTimeFormat = "20060102-150405"
+
+// validateSSHD checks the installed sshd configuration
+const validateSSHD = "/usr/sbin/sshd -t"
+
+// updateSSHDConfig replaces sshd_config with content, keeping a timestamped
+// backup of the original. The new file is checked with sshd -t before sshd
+// is reloaded, and the backup is restored if it is rejected. The backup path
+// is returned.
+func updateSSHDConfig(ctx context.Context, r *runner, content string, now time.Time) (string, error) {
+	backup := sshdBackupPrefix + now.Format(sshdBackupTimeFormat)
+	if _, err := r.run(ctx, fmt.Sprintf("cp -p %s %s", SSHDConfigPath, backup)); err != nil {
+		return "", fmt.Errorf("failed to back up %s: %w", SSHDConfigPath, err)
+	}
+
+	write := fmt.Sprintf("echo '%s' | base64 -d > %s", base64.StdEncoding.EncodeToString([]byte(content)), SSHDConfigPath)
+	if _, err := r.run(ctx, write); err != nil {
+		return backup, restoreSSHD(ctx, r, backup, fmt.Errorf("failed to write %s: %w", SSHDConfigPath, err))
+	}
+
+	if output, err := r.run(ctx, validateSSHD); err != nil {
+		return backup, restoreSSHD(ctx, r, backup, fmt.Errorf("sshd rejected the new configuration: %s", strings.TrimSpace(output)))
+	}
+
+	if _, err := r.run(ctx, reloadSSHD); err != nil {
+		return backup, fmt.Errorf("failed to reload sshd: %w", err)
+	}
+
+	return backup, nil
+}
+
+// restoreSSHD puts a backup back after a failed update and returns cause,
+// noting whether the restore worked
+func restoreSSHD(ctx context.Context, r *runner, backup string, cause error) error {
+	if _, err := r.run(ctx, fmt.Sprintf("cp -p %s %s", backup, SSHDConfigPath)); err != nil {
+		return fmt.Errorf("%w; restoring %s also failed: %v", cause, backup, err)
+	}
+	return fmt.Errorf("%w; original restored from %s", cause, backup)
+}
+
+// RollbackSSHD restores the most recent sshd_config backup made by
+// remote-setup, validates it and reloads sshd. The restored backup's path is
+// returned.
+func RollbackSSHD(ctx context.Context, exec Executor, sudo bool) (string, error) {
+	r := &runner{exec: exec, sudo: sudo}
+
+	output, err := r.run(ctx, fmt.Sprintf("ls -1 %s* 2>/dev/null | sort | tail -n 1", sshdBackupPrefix))
+	if err != nil {
+		return "", fmt.Errorf("failed to list sshd_config backups: %w", err)
+	}
+	backup := strings.TrimSpace(output)
+	if backup == "" {
+		return "", fmt.Errorf("no sshd_config backup found on the server")
+	}
+
+	if _, err := r.run(ctx, fmt.Sprintf("cp -p %s %s", backup, SSHDConfigPath)); err != nil {
+		return "", fmt.Errorf("failed to restore %s: %w", backup, err)
+	}
+	if output, err := r.run(ctx, validateSSHD); err != nil {
+		return backup, fmt.Errorf("restored %s but sshd rejects it: %s", backup, strings.TrimSpace(output))
+	}
+	if _, err := r.run(ctx, reloadSSHD); err != nil {
+		return backup, fmt.Errorf("failed to reload sshd: %w", err)
+	}
+
+	return backup, nil
+}
@@ -0,0 +1,92 @@
+package remote
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var backupTime = time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+
+const testBackup = sshdBackupPrefix + "20240301-123000"
+
+func TestUpdateSSHDConfigValidates(t *testing.T) {
+	exec := &fakeExecutor{responses: map[string]string{
+		"cp -p":      "",
+		"base64 -d":  "",
+		validateSSHD: "",
+		"systemctl":  "",
+	}}
+
+	backup, err := updateSSHDConfig(context.Background(), &runner{exec: exec}, "AllowTcpForwarding yes\n", backupTime)
+	require.NoError(t, err)
+	assert.Equal(t, testBackup, backup)
+
+	require.Len(t, exec.commands, 4)
+	assert.Equal(t, "cp -p "+SSHDConfigPath+" "+testBackup, exec.commands[0])
+	assert.Contains(t, exec.commands[1], "> "+SSHDConfigPath)
+	assert.Equal(t, validateSSHD, exec.commands[2])
+	assert.Equal(t, reloadSSHD, exec.commands[3])
+}
+
+func TestUpdateSSHDConfigRestoresOnValidationFailure(t *testing.T) {
+	exec := &fakeExecutor{
+		responses: map[string]string{
+			"cp -p":     "",
+			"base64 -d": "",
+		},
+		failures: map[string]string{
+			validateSSHD: "/etc/ssh/sshd_config line 3: Bad configuration option: AllowTcpForwardin\n",
+		},
+	}
+
+	_, err := updateSSHDConfig(context.Background(), &runner{exec: exec}, "AllowTcpForwardin yes\n", backupTime)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Bad configuration option")
+	assert.Contains(t, err.Error(), "original restored from "+testBackup)
+
+	require.Len(t, exec.commands, 4)
+	assert.Equal(t, "cp -p "+testBackup+" "+SSHDConfigPath, exec.commands[3])
+	for _, cmd := range exec.commands {
+		assert.NotEqual(t, reloadSSHD, cmd, "sshd must not be reloaded with a rejected config")
+	}
+}
+
+func TestRollbackSSHDRestoresLatestBackup(t *testing.T) {
+	exec := &fakeExecutor{responses: map[string]string{
+		"ls -1":      testBackup + "\n",
+		"cp -p":      "",
+		validateSSHD: "",
+		"systemctl":  "",
+	}}
+
+	backup, err := RollbackSSHD(context.Background(), exec, false)
+	require.NoError(t, err)
+	assert.Equal(t, testBackup, backup)
+	assert.Contains(t, exec.commands, "cp -p "+testBackup+" "+SSHDConfigPath)
+	assert.Contains(t, exec.commands, reloadSSHD)
+}
+
+func TestRollbackSSHDWithoutBackup(t *testing.T) {
+	exec := &fakeExecutor{responses: map[string]string{"ls -1": ""}}
+
+	_, err := RollbackSSHD(context.Background(), exec, false)
+	assert.ErrorContains(t, err, "no sshd_config backup")
+}
+
+func TestRollbackSSHDRejectedBackupIsNotReloaded(t *testing.T) {
+	exec := &fakeExecutor{
+		responses: map[string]string{
+			"ls -1": testBackup + "\n",
+			"cp -p": "",
+		},
+		failures: map[string]string{validateSSHD: "bad config\n"},
+	}
+
+	_, err := RollbackSSHD(context.Background(), exec, false)
+	assert.ErrorContains(t, err, "sshd rejects it")
+	assert.NotContains(t, exec.commands, reloadSSHD)
+}
@@ -66,6 +66,54 @@ func (p *program) Stop(s service.Service) error {
 	return nil
 }
 
+// watchdogSec is the WatchdogSec of installed systemd units. The daemon
+// sends heartbeats at half of it, so systemd restarts a daemon that hangs.
+const watchdogSec = 30
+
+// systemdUnitTemplate is the library's systemd unit with Type=notify, so
+// systemd waits for the daemon's READY=1, and with the watchdog on. Its
+// RestartSec and WatchdogSec are filled in by systemdUnit; the rest is
+// rendered by the library.
+const systemdUnitTemplate = `[Unit]
+Description={{.Description}}
+ConditionFileIsExecutable={{.Path|cmdEscape}}
+{{range $i, $dep := .Dependencies}}
+{{$dep}} {{end}}
+
+[Service]
+Type=notify
+NotifyAccess=main
+WatchdogSec=%d
+StartLimitInterval=5
+StartLimitBurst=10
+ExecStart={{.Path|cmdEscape}}{{range .Arguments}} {{.|cmd}}{{end}}
+{{if .ChRoot}}RootDirectory={{.ChRoot|cmd}}{{end}}
+{{if .WorkingDirectory}}WorkingDirectory={{.WorkingDirectory|cmdEscape}}{{end}}
+{{if .UserName}}User={{.UserName}}{{end}}
+{{if .ReloadSignal}}ExecReload=/bin/kill -{{.ReloadSignal}} "$MAINPID"{{end}}
+{{if .PIDFile}}PIDFile={{.PIDFile|cmd}}{{end}}
+StandardOutput=journal
+StandardError=journal
+{{if gt .LimitNOFILE -1 }}LimitNOFILE={{.LimitNOFILE}}{{end}}
+{{if .Restart}}Restart={{.Restart}}{{end}}
+{{if .SuccessExitStatus}}SuccessExitStatus={{.SuccessExitStatus}}{{end}}
+RestartSec=%d
+EnvironmentFile=-/etc/sysconfig/{{.Name}}
+
+{{range $k, $v := .EnvVars -}}
+Environment={{$k}}={{$v}}
+{{end -}}
+
+[Install]
+WantedBy=multi-user.target
+`
+
+// systemdUnit returns the systemd unit template for a tunnel restarted
+// restartSec seconds after it exits
+func systemdUnit(restartSec int) string {
+	return fmt.Sprintf(systemdUnitTemplate, watchdogSec, restartSec)
+}
+
 // Install installs a service for a tunnel
 func (sm *ServiceManager) Install(tunnelConfig *config.Config) error {
 	serviceName := tunnelConfig.Service.Name
@@ -96,11 +144,9 @@ func (sm *ServiceManager) Install(tunnelConfig *config.Config) error {
 	switch sm.platform {
 	case "linux":
 		svcConfig.Option = service.KeyValue{
-			"Restart":        "always",
-			"RestartSec":     fmt.Sprintf("%d", tunnelConfig.Service.RestartSec),
-			"LimitNOFILE":    "65536",
-			"StandardOutput": "journal",
-			"StandardError":  "journal",
+			"Restart":       "always",
+			"LimitNOFILE":   65536,
+			"SystemdScript": systemdUnit(tunnelConfig.Service.RestartSec),
 		}
 	case "windows":
 		svcConfig.Option = service.KeyValue{
@@ -0,0 +1,40 @@
+package service
+
+import (
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSystemdUnitUsesNotifyAndWatchdog(t *testing.T) {
+	funcs := template.FuncMap{
+		"cmd":       func(s string) string { return s },
+		"cmdEscape": func(s string) string { return s },
+	}
+	tmpl, err := template.New("unit").Funcs(funcs).Parse(systemdUnit(7))
+	require.NoError(t, err)
+
+	var unit strings.Builder
+	require.NoError(t, tmpl.Execute(&unit, map[string]interface{}{
+		"Description": "SSH Tunnel service for home",
+		"Path":        "/usr/local/bin/ssh-tunnel",
+		"Arguments":   []string{"daemon", "--tunnel", "home"},
+		"Name":        "ssh-tunnel-home",
+		"LimitNOFILE": 65536,
+		"Restart":     "always",
+	}))
+
+	for _, line := range []string{
+		"Type=notify",
+		"WatchdogSec=30",
+		"RestartSec=7",
+		"Restart=always",
+		"LimitNOFILE=65536",
+		"ExecStart=/usr/local/bin/ssh-tunnel daemon --tunnel home",
+	} {
+		assert.Contains(t, strings.Split(unit.String(), "\n"), line)
+	}
+}
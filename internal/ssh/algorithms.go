@@ -0,0 +1,62 @@
+package ssh
+
+import (
+	"fmt"
+	"slices"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Algorithms restricts the algorithms negotiated by native SSH connections.
+// Empty lists leave the crypto/ssh defaults in place.
+type Algorithms struct {
+	Ciphers      []string
+	MACs         []string
+	KeyExchanges []string
+}
+
+// SetAlgorithms restricts the ciphers, MACs and key exchanges used by every
+// remote operation, mirroring the -o Ciphers/MACs/KexAlgorithms options
+// given to the ssh binary
+func (km *KeyManager) SetAlgorithms(algorithms Algorithms) {
+	km.algorithms = algorithms
+}
+
+// sshConfig maps the algorithm lists onto a crypto/ssh config. Names that
+// OpenSSH accepts but crypto/ssh does not implement are dropped; a list left
+// empty by that is an error, since no connection could be negotiated.
+func (a Algorithms) sshConfig() (ssh.Config, error) {
+	supported := ssh.SupportedAlgorithms()
+	insecure := ssh.InsecureAlgorithms()
+
+	var config ssh.Config
+	var err error
+	if config.Ciphers, err = nativeAlgorithms("ciphers", a.Ciphers, supported.Ciphers, insecure.Ciphers); err != nil {
+		return config, err
+	}
+	if config.MACs, err = nativeAlgorithms("MACs", a.MACs, supported.MACs, insecure.MACs); err != nil {
+		return config, err
+	}
+	if config.KeyExchanges, err = nativeAlgorithms("key exchanges", a.KeyExchanges, supported.KeyExchanges, insecure.KeyExchanges); err != nil {
+		return config, err
+	}
+	return config, nil
+}
+
+// nativeAlgorithms filters names down to those crypto/ssh implements
+func nativeAlgorithms(kind string, names, supported, insecure []string) ([]string, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	var native []string
+	for _, name := range names {
+		if slices.Contains(supported, name) || slices.Contains(insecure, name) {
+			native = append(native, name)
+		}
+	}
+	if len(native) == 0 {
+		return nil, fmt.Errorf("none of the configured %s are supported by the native SSH client: %v", kind, names)
+	}
+	return native, nil
+}
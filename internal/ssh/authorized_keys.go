@@ -0,0 +1,159 @@
+package ssh
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// RestrictedKeyOptions limits a deployed key to port forwarding only, which is
+// all a tunnel-only account needs
+const RestrictedKeyOptions = "restrict,port-forwarding"
+
+// FormatAuthorizedKey returns the authorized_keys line for a public key,
+// prefixed with the given options (e.g. `restrict,port-forwarding` or
+// `restrict,command="/bin/false"`). Any options already on the key are replaced.
+func FormatAuthorizedKey(pubKeyData []byte, options string) ([]byte, error) {
+	pubKey, comment, _, _, err := ssh.ParseAuthorizedKey(pubKeyData)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %w", err)
+	}
+
+	options = strings.TrimSpace(options)
+	if strings.ContainsAny(options, "\r\n") {
+		return nil, fmt.Errorf("authorized_keys options must be on a single line")
+	}
+
+	line := MarshalAuthorizedKeyWithComment(pubKey, comment)
+	if options == "" {
+		return line, nil
+	}
+	return append([]byte(options+" "), line...), nil
+}
+
+// AuthorizedKeysContain reports whether authorized_keys data already holds
+// pubKey, comparing the parsed keys so options, comments and whitespace are
+// ignored
+func AuthorizedKeysContain(data []byte, pubKey ssh.PublicKey) bool {
+	want := pubKey.Marshal()
+	for len(data) > 0 {
+		existing, _, _, rest, err := ssh.ParseAuthorizedKey(data)
+		if err != nil {
+			// No further valid keys
+			return false
+		}
+		if bytes.Equal(existing.Marshal(), want) {
+			return true
+		}
+		data = rest
+	}
+	return false
+}
+
+// authorizedWithOptions reports whether every authorized_keys line in data
+// holding pubKey has exactly the given options
+func authorizedWithOptions(data []byte, pubKey ssh.PublicKey, options []string) bool {
+	want := pubKey.Marshal()
+	for len(data) > 0 {
+		existing, _, existingOptions, rest, err := ssh.ParseAuthorizedKey(data)
+		if err != nil {
+			// No further valid keys
+			return true
+		}
+		if bytes.Equal(existing.Marshal(), want) && !slices.Equal(existingOptions, options) {
+			return false
+		}
+		data = rest
+	}
+	return true
+}
+
+// AddAuthorizedKey appends an authorized_keys line to the file at path unless
+// the key is already present. It reports whether the line was added.
+func AddAuthorizedKey(path string, line []byte) (bool, error) {
+	pubKey, _, _, _, err := ssh.ParseAuthorizedKey(line)
+	if err != nil {
+		return false, fmt.Errorf("invalid public key: %w", err)
+	}
+
+	existing, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return false, fmt.Errorf("failed to read authorized_keys: %w", err)
+	}
+	if AuthorizedKeysContain(existing, pubKey) {
+		return false, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return false, fmt.Errorf("failed to create SSH directory: %w", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return false, fmt.Errorf("failed to open authorized_keys: %w", err)
+	}
+	defer file.Close()
+
+	// Don't join the new key onto an unterminated last line
+	if len(existing) > 0 && !bytes.HasSuffix(existing, []byte("\n")) {
+		line = append([]byte("\n"), line...)
+	}
+	if !bytes.HasSuffix(line, []byte("\n")) {
+		line = append(line, '\n')
+	}
+
+	if _, err := file.Write(line); err != nil {
+		return false, fmt.Errorf("failed to write to authorized_keys: %w", err)
+	}
+
+	return true, nil
+}
+
+// RemoveAuthorizedKey returns authorized_keys data without the lines holding
+// pubKey, whatever their options or comment, and how many lines were removed.
+// All other lines are kept as they are.
+func RemoveAuthorizedKey(data []byte, pubKey ssh.PublicKey) ([]byte, int) {
+	want := pubKey.Marshal()
+	var kept []byte
+	removed := 0
+	for _, line := range bytes.SplitAfter(data, []byte("\n")) {
+		if existing, _, _, _, err := ssh.ParseAuthorizedKey(line); err == nil && bytes.Equal(existing.Marshal(), want) {
+			removed++
+			continue
+		}
+		kept = append(kept, line...)
+	}
+	return kept, removed
+}
+
+// DeleteAuthorizedKey removes the key of an authorized_keys line from the
+// file at path, undoing AddAuthorizedKey. It reports whether any line was
+// removed; a missing file holds no keys.
+func DeleteAuthorizedKey(path string, line []byte) (bool, error) {
+	pubKey, _, _, _, err := ssh.ParseAuthorizedKey(line)
+	if err != nil {
+		return false, fmt.Errorf("invalid public key: %w", err)
+	}
+
+	existing, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read authorized_keys: %w", err)
+	}
+
+	kept, removed := RemoveAuthorizedKey(existing, pubKey)
+	if removed == 0 {
+		return false, nil
+	}
+	if err := os.WriteFile(path, kept, 0600); err != nil {
+		return false, fmt.Errorf("failed to write authorized_keys: %w", err)
+	}
+	return true, nil
+}
@@ -0,0 +1,147 @@
+package ssh
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestFormatAuthorizedKeyPrefixesOptions(t *testing.T) {
+	keyPath := filepath.Join(t.TempDir(), "id_ed25519")
+	km := NewKeyManager()
+	require.NoError(t, km.GenerateKeyPair("ed25519", keyPath, "ssh-tunnel:home@test"))
+	pubData, err := os.ReadFile(keyPath + ".pub")
+	require.NoError(t, err)
+
+	options := `restrict,port-forwarding,command="/bin/false"`
+	line, err := FormatAuthorizedKey(pubData, options)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(line), options+" ssh-ed25519 "))
+	assert.True(t, strings.HasSuffix(string(line), " ssh-tunnel:home@test\n"))
+
+	pubKey, comment, parsedOptions, _, err := ssh.ParseAuthorizedKey(line)
+	require.NoError(t, err)
+	assert.Equal(t, "ssh-tunnel:home@test", comment)
+	assert.Equal(t, []string{"restrict", "port-forwarding", `command="/bin/false"`}, parsedOptions)
+
+	original, _, _, _, err := ssh.ParseAuthorizedKey(pubData)
+	require.NoError(t, err)
+	assert.Equal(t, original.Marshal(), pubKey.Marshal())
+}
+
+func TestFormatAuthorizedKeyWithoutOptions(t *testing.T) {
+	keyPath := filepath.Join(t.TempDir(), "id_ed25519")
+	km := NewKeyManager()
+	require.NoError(t, km.GenerateKeyPair("ed25519", keyPath, ""))
+	pubData, err := os.ReadFile(keyPath + ".pub")
+	require.NoError(t, err)
+
+	line, err := FormatAuthorizedKey(pubData, "")
+	require.NoError(t, err)
+	assert.Equal(t, string(pubData), string(line))
+
+	_, err = FormatAuthorizedKey(pubData, "restrict\nssh-ed25519 AAAA")
+	assert.Error(t, err)
+}
+
+func TestAddAuthorizedKeyDedupesByKey(t *testing.T) {
+	dir := t.TempDir()
+	km := NewKeyManager()
+	require.NoError(t, km.GenerateKeyPair("ed25519", filepath.Join(dir, "a"), "a@test"))
+	require.NoError(t, km.GenerateKeyPair("ed25519", filepath.Join(dir, "b"), "b@test"))
+	pubA, err := os.ReadFile(filepath.Join(dir, "a.pub"))
+	require.NoError(t, err)
+	pubB, err := os.ReadFile(filepath.Join(dir, "b.pub"))
+	require.NoError(t, err)
+	fieldsA := strings.Fields(string(pubA))
+
+	// A commented-out copy of key A would fool a substring check, and the
+	// file is missing its trailing newline
+	authorizedKeysPath := filepath.Join(dir, "authorized_keys")
+	require.NoError(t, os.WriteFile(authorizedKeysPath, []byte("# "+strings.TrimSpace(string(pubA))+"\n"+strings.TrimSpace(string(pubB))), 0600))
+
+	variants := [][]byte{
+		pubA,
+		[]byte(fieldsA[0] + "\t" + fieldsA[1] + "   other-comment\n"),
+		[]byte("restrict " + string(pubA)),
+	}
+	for i, line := range variants {
+		added, err := AddAuthorizedKey(authorizedKeysPath, line)
+		require.NoError(t, err)
+		assert.Equal(t, i == 0, added, "variant %d", i)
+	}
+
+	added, err := AddAuthorizedKey(authorizedKeysPath, pubB)
+	require.NoError(t, err)
+	assert.False(t, added)
+
+	data, err := os.ReadFile(authorizedKeysPath)
+	require.NoError(t, err)
+
+	keyA, _, _, _, err := ssh.ParseAuthorizedKey(pubA)
+	require.NoError(t, err)
+	keyB, _, _, _, err := ssh.ParseAuthorizedKey(pubB)
+	require.NoError(t, err)
+
+	counts := map[string]int{}
+	for rest := data; len(rest) > 0; {
+		key, _, _, next, err := ssh.ParseAuthorizedKey(rest)
+		if err != nil {
+			break
+		}
+		counts[string(key.Marshal())]++
+		rest = next
+	}
+	assert.Equal(t, 1, counts[string(keyA.Marshal())])
+	assert.Equal(t, 1, counts[string(keyB.Marshal())])
+}
+
+func TestRemoveAuthorizedKeyKeepsOtherLines(t *testing.T) {
+	dir := t.TempDir()
+	km := NewKeyManager()
+	require.NoError(t, km.GenerateKeyPair("ed25519", filepath.Join(dir, "a"), "a@test"))
+	require.NoError(t, km.GenerateKeyPair("ed25519", filepath.Join(dir, "b"), "b@test"))
+	pubA, err := os.ReadFile(filepath.Join(dir, "a.pub"))
+	require.NoError(t, err)
+	pubB, err := os.ReadFile(filepath.Join(dir, "b.pub"))
+	require.NoError(t, err)
+	keyA, _, _, _, err := ssh.ParseAuthorizedKey(pubA)
+	require.NoError(t, err)
+
+	data := "# laptop\n" + string(pubB) + "restrict,port-forwarding " + string(pubA) + strings.TrimSpace(string(pubA))
+	kept, removed := RemoveAuthorizedKey([]byte(data), keyA)
+	assert.Equal(t, 2, removed)
+	assert.Equal(t, "# laptop\n"+string(pubB), string(kept))
+
+	_, removed = RemoveAuthorizedKey(kept, keyA)
+	assert.Zero(t, removed)
+}
+
+func TestDeleteAuthorizedKeyUndoesAdd(t *testing.T) {
+	dir := t.TempDir()
+	km := NewKeyManager()
+	require.NoError(t, km.GenerateKeyPair("ed25519", filepath.Join(dir, "a"), "a@test"))
+	pubA, err := os.ReadFile(filepath.Join(dir, "a.pub"))
+	require.NoError(t, err)
+
+	authorizedKeysPath := filepath.Join(dir, "authorized_keys")
+	removed, err := DeleteAuthorizedKey(authorizedKeysPath, pubA)
+	require.NoError(t, err)
+	assert.False(t, removed, "a missing file holds no keys")
+
+	require.NoError(t, os.WriteFile(authorizedKeysPath, []byte("# laptop\n"), 0600))
+	_, err = AddAuthorizedKey(authorizedKeysPath, []byte("restrict "+string(pubA)))
+	require.NoError(t, err)
+
+	removed, err = DeleteAuthorizedKey(authorizedKeysPath, pubA)
+	require.NoError(t, err)
+	assert.True(t, removed)
+	data, err := os.ReadFile(authorizedKeysPath)
+	require.NoError(t, err)
+	assert.Equal(t, "# laptop\n", string(data))
+}
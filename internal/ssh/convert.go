@@ -0,0 +1,116 @@
+package ssh
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Supported private key output formats
+const (
+	KeyFormatOpenSSH = "openssh"
+	KeyFormatPKCS8   = "pkcs8"
+)
+
+// PassphraseFunc is called to obtain a passphrase for an encrypted key
+type PassphraseFunc func() ([]byte, error)
+
+// ParsePrivateKeyData parses a private key in any supported format (OpenSSH,
+// PKCS#1, PKCS#8, SEC1 or PuTTY .ppk). If the key is encrypted, passphrase is
+// called to unlock it.
+func ParsePrivateKeyData(data []byte, passphrase PassphraseFunc) (crypto.PrivateKey, error) {
+	if IsPPK(data) {
+		key, _, err := ParsePPK(data)
+		return key, err
+	}
+
+	key, err := ssh.ParseRawPrivateKey(data)
+	var missing *ssh.PassphraseMissingError
+	if errors.As(err, &missing) {
+		if passphrase == nil {
+			return nil, fmt.Errorf("key is encrypted and no passphrase was provided")
+		}
+		pass, perr := passphrase()
+		if perr != nil {
+			return nil, fmt.Errorf("failed to read passphrase: %w", perr)
+		}
+		key, err = ssh.ParseRawPrivateKeyWithPassphrase(data, pass)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid SSH private key: %w", err)
+	}
+
+	// crypto/ssh returns *ed25519.PrivateKey for OpenSSH keys; normalise it
+	if k, ok := key.(*ed25519.PrivateKey); ok {
+		key = *k
+	}
+
+	return key, nil
+}
+
+// MarshalPrivateKeyFormat encodes a private key as PEM in the given format
+func MarshalPrivateKeyFormat(key crypto.PrivateKey, format, comment string) ([]byte, error) {
+	var block *pem.Block
+	var err error
+
+	switch format {
+	case KeyFormatOpenSSH, "":
+		block, err = ssh.MarshalPrivateKey(key, comment)
+	case KeyFormatPKCS8:
+		var der []byte
+		der, err = x509.MarshalPKCS8PrivateKey(key)
+		block = &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+	default:
+		return nil, fmt.Errorf("unsupported key format: %s (expected %s or %s)", format, KeyFormatOpenSSH, KeyFormatPKCS8)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal private key: %w", err)
+	}
+
+	return pem.EncodeToMemory(block), nil
+}
+
+// ConvertKey reads the private key at inPath and writes it to outPath in the
+// requested format, together with its public key
+func (km *KeyManager) ConvertKey(inPath, outPath, format string, passphrase PassphraseFunc) error {
+	data, err := os.ReadFile(inPath)
+	if err != nil {
+		return fmt.Errorf("failed to read key file: %w", err)
+	}
+
+	key, err := ParsePrivateKeyData(data, passphrase)
+	if err != nil {
+		return err
+	}
+
+	converted, err := MarshalPrivateKeyFormat(key, format, "")
+	if err != nil {
+		return err
+	}
+
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		return fmt.Errorf("failed to derive public key: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(outPath), 0700); err != nil {
+		return fmt.Errorf("failed to create key directory: %w", err)
+	}
+
+	if err := os.WriteFile(outPath, converted, 0600); err != nil {
+		return fmt.Errorf("failed to write private key: %w", err)
+	}
+
+	if err := os.WriteFile(outPath+".pub", ssh.MarshalAuthorizedKey(signer.PublicKey()), 0644); err != nil {
+		return fmt.Errorf("failed to write public key: %w", err)
+	}
+
+	return nil
+}
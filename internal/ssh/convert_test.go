@@ -0,0 +1,59 @@
+package ssh
+
+import (
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvertKeyRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	km := NewKeyManager()
+
+	// GenerateKeyPair writes ed25519 keys as PKCS#8
+	pkcs8Path := filepath.Join(dir, "key_pkcs8")
+	require.NoError(t, km.GenerateKeyPair("ed25519", pkcs8Path, ""))
+	assertPEMType(t, pkcs8Path, "PRIVATE KEY")
+
+	opensshPath := filepath.Join(dir, "key_openssh")
+	require.NoError(t, km.ConvertKey(pkcs8Path, opensshPath, KeyFormatOpenSSH, nil))
+	assertPEMType(t, opensshPath, "OPENSSH PRIVATE KEY")
+	require.NoError(t, km.ValidateKey(opensshPath))
+
+	backPath := filepath.Join(dir, "key_back")
+	require.NoError(t, km.ConvertKey(opensshPath, backPath, KeyFormatPKCS8, nil))
+	assertPEMType(t, backPath, "PRIVATE KEY")
+
+	// The key type and material are preserved through both conversions
+	original, err := km.GetPublicKeyContent(pkcs8Path)
+	require.NoError(t, err)
+	for _, path := range []string{opensshPath, backPath} {
+		converted, err := km.GetPublicKeyContent(path)
+		require.NoError(t, err)
+		assert.Equal(t, original, converted)
+	}
+}
+
+func TestConvertKeyRejectsUnknownFormat(t *testing.T) {
+	dir := t.TempDir()
+	km := NewKeyManager()
+
+	keyPath := filepath.Join(dir, "key")
+	require.NoError(t, km.GenerateKeyPair("ed25519", keyPath, ""))
+
+	err := km.ConvertKey(keyPath, filepath.Join(dir, "out"), "der", nil)
+	assert.ErrorContains(t, err, "unsupported key format")
+}
+
+func assertPEMType(t *testing.T, path, expected string) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	block, _ := pem.Decode(data)
+	require.NotNil(t, block)
+	assert.Equal(t, expected, block.Type)
+}
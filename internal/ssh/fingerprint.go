@@ -0,0 +1,88 @@
+package ssh
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// KeyInfo describes a key pair by its public key
+type KeyInfo struct {
+	Type        string
+	Bits        int
+	Fingerprint string
+	Comment     string
+}
+
+// Fingerprint returns the type, size and SHA256 fingerprint of the key pair
+// at keyPath. The public key is read from keyPath.pub, or from the private
+// key if there is no .pub file.
+func Fingerprint(keyPath string) (KeyInfo, error) {
+	pubData, err := os.ReadFile(keyPath + ".pub")
+	if err == nil {
+		pubKey, comment, _, _, err := ssh.ParseAuthorizedKey(pubData)
+		if err != nil {
+			return KeyInfo{}, fmt.Errorf("invalid public key %s.pub: %w", keyPath, err)
+		}
+		return keyInfo(pubKey, comment), nil
+	}
+	if !os.IsNotExist(err) {
+		return KeyInfo{}, fmt.Errorf("failed to read public key: %w", err)
+	}
+
+	keyData, err := os.ReadFile(keyPath)
+	if err != nil {
+		return KeyInfo{}, fmt.Errorf("failed to read key file: %w", err)
+	}
+	if IsPPK(keyData) {
+		privKey, comment, err := ParsePPK(keyData)
+		if err != nil {
+			return KeyInfo{}, fmt.Errorf("invalid PuTTY private key: %w", err)
+		}
+		signer, err := ssh.NewSignerFromKey(privKey)
+		if err != nil {
+			return KeyInfo{}, fmt.Errorf("invalid PuTTY private key: %w", err)
+		}
+		return keyInfo(signer.PublicKey(), comment), nil
+	}
+
+	signer, err := ssh.ParsePrivateKey(keyData)
+	if err != nil {
+		// Encrypted OpenSSH keys carry their public key in the clear
+		var missing *ssh.PassphraseMissingError
+		if errors.As(err, &missing) && missing.PublicKey != nil {
+			return keyInfo(missing.PublicKey, ""), nil
+		}
+		return KeyInfo{}, fmt.Errorf("invalid SSH private key: %w", err)
+	}
+	return keyInfo(signer.PublicKey(), ""), nil
+}
+
+// keyInfo describes a public key
+func keyInfo(pubKey ssh.PublicKey, comment string) KeyInfo {
+	info := KeyInfo{
+		Type:        pubKey.Type(),
+		Fingerprint: ssh.FingerprintSHA256(pubKey),
+		Comment:     comment,
+	}
+
+	cryptoKey, ok := pubKey.(ssh.CryptoPublicKey)
+	if !ok {
+		return info
+	}
+	switch key := cryptoKey.CryptoPublicKey().(type) {
+	case *rsa.PublicKey:
+		info.Bits = key.N.BitLen()
+	case *ecdsa.PublicKey:
+		info.Bits = key.Curve.Params().BitSize
+	default:
+		if pubKey.Type() == ssh.KeyAlgoED25519 {
+			info.Bits = 256
+		}
+	}
+	return info
+}
@@ -0,0 +1,42 @@
+package ssh
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestFingerprint(t *testing.T) {
+	keyPath := filepath.Join(t.TempDir(), "id_ecdsa")
+	km := NewKeyManager()
+	require.NoError(t, km.GenerateKeyPair("ecdsa", keyPath, "ssh-tunnel:home"))
+
+	pubData, err := os.ReadFile(keyPath + ".pub")
+	require.NoError(t, err)
+	pubKey, _, _, _, err := ssh.ParseAuthorizedKey(pubData)
+	require.NoError(t, err)
+	want := KeyInfo{
+		Type:        ssh.KeyAlgoECDSA256,
+		Bits:        256,
+		Fingerprint: ssh.FingerprintSHA256(pubKey),
+		Comment:     "ssh-tunnel:home",
+	}
+
+	info, err := Fingerprint(keyPath)
+	require.NoError(t, err)
+	assert.Equal(t, want, info)
+
+	// Without a .pub file the private key is read instead
+	require.NoError(t, os.Remove(keyPath+".pub"))
+	info, err = Fingerprint(keyPath)
+	require.NoError(t, err)
+	want.Comment = ""
+	assert.Equal(t, want, info)
+
+	_, err = Fingerprint(filepath.Join(t.TempDir(), "missing"))
+	assert.ErrorContains(t, err, "failed to read key file")
+}
@@ -0,0 +1,271 @@
+package ssh
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync/atomic"
+
+	"github.com/lerndmina/SSH-Tunnel/pkg/logger"
+	"github.com/mitchellh/go-homedir"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// ErrHostKeyRejected is returned by TrustHostKey when the user declines to
+// trust a host key
+var ErrHostKeyRejected = errors.New("host key not trusted")
+
+// ErrHostKeyChanged is wrapped by TrustHostKey errors when a host presents a
+// different key than the one recorded for it
+var ErrHostKeyChanged = errors.New("host key has changed")
+
+// HostKeyPrompt shows a host's key fingerprint to the user and reports
+// whether they trust it
+type HostKeyPrompt func(address, fingerprint string) (bool, error)
+
+// DefaultKnownHostsFile returns the user's OpenSSH known_hosts file
+func DefaultKnownHostsFile() (string, error) {
+	home, err := homedir.Dir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(home, ".ssh", "known_hosts"), nil
+}
+
+// skipAllHostKeyChecks is set by SkipAllHostKeyChecks
+var skipAllHostKeyChecks atomic.Bool
+
+// SkipAllHostKeyChecks turns host key verification off for every connection
+// the process makes, including those of tunnels' ssh processes, as the
+// --insecure flag does
+func SkipAllHostKeyChecks(skip bool) {
+	skipAllHostKeyChecks.Store(skip)
+}
+
+// HostKeyChecksSkipped reports whether host key verification is off for a
+// connection, either by its own setting or by SkipAllHostKeyChecks
+func HostKeyChecksSkipped(insecure bool) bool {
+	return insecure || skipAllHostKeyChecks.Load()
+}
+
+// SetKnownHostsFile makes connections verify host keys against a known_hosts
+// file, refusing hosts that are missing from it or present a different key.
+// An empty path goes back to the user's known_hosts, where hosts not listed
+// yet are added on first use.
+func (km *KeyManager) SetKnownHostsFile(path string) {
+	km.knownHostsFile = path
+}
+
+// SetInsecureSkipHostKeyCheck turns host key verification off, leaving
+// connections open to man-in-the-middle attacks. Each connection made
+// without verification logs a warning.
+func (km *KeyManager) SetInsecureSkipHostKeyCheck(skip bool) {
+	km.insecure = skip
+}
+
+// hostKeyCallback returns the host key check for connections
+func (km *KeyManager) hostKeyCallback() (ssh.HostKeyCallback, error) {
+	if HostKeyChecksSkipped(km.insecure) {
+		return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			logger.Warnf("INSECURE: not verifying the host key of %s (%s); the connection is open to man-in-the-middle attacks",
+				hostname, ssh.FingerprintSHA256(key))
+			return nil
+		}, nil
+	}
+
+	if km.knownHostsFile == "" {
+		path, err := DefaultKnownHostsFile()
+		if err != nil {
+			return nil, err
+		}
+		return acceptNewHostKeys(path), nil
+	}
+
+	callback, err := knownhosts.New(km.knownHostsFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read known hosts: %w", err)
+	}
+	return callback, nil
+}
+
+// acceptNewHostKeys returns a host key check against a known_hosts file that
+// adds hosts missing from it, like ssh's StrictHostKeyChecking=accept-new,
+// and refuses hosts presenting a different key than the one recorded for
+// its type
+func acceptNewHostKeys(path string) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return AddKnownHost(path, hostname, key)
+		}
+
+		check, err := knownhosts.New(path)
+		if err != nil {
+			return fmt.Errorf("failed to read known hosts: %w", err)
+		}
+		err = check(hostname, remote, key)
+		var keyErr *knownhosts.KeyError
+		if !errors.As(err, &keyErr) {
+			return err
+		}
+		if hostKeyChanged(keyErr, key) {
+			return hostKeyChangedError(hostname, key, path)
+		}
+
+		logger.Infof("Adding host key of %s (%s) to %s", hostname, ssh.FingerprintSHA256(key), path)
+		return AddKnownHost(path, hostname, key)
+	}
+}
+
+// hostKeyChangedError returns the error for a host presenting key when the
+// known_hosts file at path records a different one, wrapping
+// ErrHostKeyChanged
+func hostKeyChangedError(host string, key ssh.PublicKey, path string) error {
+	return fmt.Errorf("%s: %w: it now presents %s; if that is expected, remove the old key from %s",
+		host, ErrHostKeyChanged, ssh.FingerprintSHA256(key), path)
+}
+
+// hostKeyChanged reports whether a host failing a known_hosts check has a
+// different key recorded of the same type as key. Keys of other types do not
+// count, as a host may have several and record only some of them.
+func hostKeyChanged(keyErr *knownhosts.KeyError, key ssh.PublicKey) bool {
+	for _, known := range keyErr.Want {
+		if known.Key.Type() == key.Type() {
+			return true
+		}
+	}
+	return false
+}
+
+// lookupKey is a public key that matches no known_hosts line, so checking
+// it lists every key recorded for a host
+type lookupKey struct{}
+
+func (lookupKey) Type() string                        { return "ssh-tunnel-lookup" }
+func (lookupKey) Marshal() []byte                     { return []byte("ssh-tunnel-lookup") }
+func (lookupKey) Verify([]byte, *ssh.Signature) error { return errors.New("lookup key") }
+
+// knownHostKeyAlgorithms returns the host key algorithms for the key types a
+// known_hosts file records for address, or nil if it has none. Asking a
+// host for these keeps it from presenting a key of another type it also
+// has, which could not be verified.
+func knownHostKeyAlgorithms(path, address string) []string {
+	check, err := knownhosts.New(path)
+	if err != nil {
+		return nil
+	}
+	// The address takes precedence over the remote address, which only has
+	// to parse
+	var keyErr *knownhosts.KeyError
+	if !errors.As(check(address, &net.TCPAddr{}, lookupKey{}), &keyErr) {
+		return nil
+	}
+
+	var algorithms []string
+	seen := make(map[string]bool)
+	for _, known := range keyErr.Want {
+		keyAlgorithms := []string{known.Key.Type()}
+		if known.Key.Type() == ssh.KeyAlgoRSA {
+			keyAlgorithms = []string{ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA}
+		}
+		for _, algorithm := range keyAlgorithms {
+			if !seen[algorithm] {
+				seen[algorithm] = true
+				algorithms = append(algorithms, algorithm)
+			}
+		}
+	}
+	return algorithms
+}
+
+// hostKeyAlgorithms returns the host key algorithms to ask address for:
+// those of the key types recorded for it in the known_hosts file
+// connections are checked against, or nil to accept any
+func (km *KeyManager) hostKeyAlgorithms(address string) []string {
+	if HostKeyChecksSkipped(km.insecure) {
+		return nil
+	}
+	path := km.knownHostsFile
+	if path == "" {
+		var err error
+		if path, err = DefaultKnownHostsFile(); err != nil {
+			return nil
+		}
+	}
+	return knownHostKeyAlgorithms(path, address)
+}
+
+// preferHostKeyAlgorithms returns the host key algorithms the ssh package
+// supports, with preferred first, so a host presents a key of a recorded type
+// if it still has one, and any other key otherwise
+func preferHostKeyAlgorithms(preferred []string) []string {
+	if len(preferred) == 0 {
+		return nil
+	}
+	algorithms := slices.Clone(preferred)
+	for _, algorithm := range append(ssh.SupportedAlgorithms().HostKeys, ssh.KeyAlgoRSA) {
+		if !slices.Contains(algorithms, algorithm) {
+			algorithms = append(algorithms, algorithm)
+		}
+	}
+	return algorithms
+}
+
+// TrustHostKey makes sure the known_hosts file set with SetKnownHostsFile
+// has a key for a host, trusting it on first use. A host already listed must
+// present the recorded key of its type. For an unknown host, prompt is shown
+// the key's fingerprint, as GetFingerprint reports it, and the key is stored
+// only if the user accepts it.
+func (km *KeyManager) TrustHostKey(host string, port int, prompt HostKeyPrompt) error {
+	if km.knownHostsFile == "" {
+		return fmt.Errorf("no known hosts file set")
+	}
+
+	address := net.JoinHostPort(host, fmt.Sprintf("%d", port))
+	hostKey, err := km.fetchHostKey(host, port)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(km.knownHostsFile), 0700); err != nil {
+		return fmt.Errorf("failed to create known hosts directory: %w", err)
+	}
+	file, err := os.OpenFile(km.knownHostsFile, os.O_CREATE|os.O_RDONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open known hosts: %w", err)
+	}
+	file.Close()
+
+	check, err := knownhosts.New(km.knownHostsFile)
+	if err != nil {
+		return fmt.Errorf("failed to read known hosts: %w", err)
+	}
+
+	remote, err := net.ResolveTCPAddr("tcp", address)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %w", address, err)
+	}
+	err = check(address, remote, hostKey)
+	var keyErr *knownhosts.KeyError
+	switch {
+	case err == nil:
+		return nil
+	case !errors.As(err, &keyErr):
+		return err
+	case hostKeyChanged(keyErr, hostKey):
+		return hostKeyChangedError(address, hostKey, km.knownHostsFile)
+	}
+
+	trusted, err := prompt(address, ssh.FingerprintSHA256(hostKey))
+	if err != nil {
+		return err
+	}
+	if !trusted {
+		return ErrHostKeyRejected
+	}
+
+	return AddKnownHost(km.knownHostsFile, address, hostKey)
+}
@@ -0,0 +1,302 @@
+package ssh
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/lerndmina/SSH-Tunnel/pkg/logger"
+	"github.com/mitchellh/go-homedir"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// startHostKeyServer runs an SSH server that presents a fresh host key and
+// completes key exchange, returning its port and the key
+func startHostKeyServer(t *testing.T) (int, ssh.PublicKey) {
+	t.Helper()
+
+	_, privKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(privKey)
+	require.NoError(t, err)
+
+	return serveHostKeys(t, signer), signer.PublicKey()
+}
+
+// serveHostKeys runs an SSH server that offers the given host keys and
+// completes key exchange, returning its port
+func serveHostKeys(t *testing.T, signers ...ssh.Signer) int {
+	t.Helper()
+
+	serverConfig := &ssh.ServerConfig{NoClientAuth: true}
+	for _, signer := range signers {
+		serverConfig.AddHostKey(signer)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				sshConn, chans, reqs, err := ssh.NewServerConn(conn, serverConfig)
+				if err != nil {
+					return
+				}
+				defer sshConn.Close()
+				go ssh.DiscardRequests(reqs)
+				for newChannel := range chans {
+					_ = newChannel.Reject(ssh.Prohibited, "test server")
+				}
+			}()
+		}
+	}()
+
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+func TestTrustHostKeyAccept(t *testing.T) {
+	port, hostKey := startHostKeyServer(t)
+	knownHosts := filepath.Join(t.TempDir(), ".ssh", "known_hosts")
+
+	km := NewKeyManager()
+	km.SetKnownHostsFile(knownHosts)
+
+	var shown string
+	err := km.TrustHostKey("127.0.0.1", port, func(address, fingerprint string) (bool, error) {
+		shown = fingerprint
+		return true, nil
+	})
+	require.NoError(t, err)
+
+	fingerprint, err := km.GetFingerprint("127.0.0.1", port)
+	require.NoError(t, err)
+	assert.Equal(t, ssh.FingerprintSHA256(hostKey), shown)
+	assert.Equal(t, fingerprint, shown)
+
+	data, err := os.ReadFile(knownHosts)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), string(ssh.MarshalAuthorizedKey(hostKey))[:40])
+
+	// Once stored the key is verified without asking again
+	err = km.TrustHostKey("127.0.0.1", port, func(string, string) (bool, error) {
+		t.Fatal("asked to trust a known host")
+		return false, nil
+	})
+	require.NoError(t, err)
+
+	callback, err := km.hostKeyCallback()
+	require.NoError(t, err)
+	addr := &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: port}
+	assert.NoError(t, callback(addr.String(), addr, hostKey))
+}
+
+func TestTrustHostKeyReject(t *testing.T) {
+	port, _ := startHostKeyServer(t)
+	knownHosts := filepath.Join(t.TempDir(), "known_hosts")
+
+	km := NewKeyManager()
+	km.SetKnownHostsFile(knownHosts)
+
+	err := km.TrustHostKey("127.0.0.1", port, func(string, string) (bool, error) {
+		return false, nil
+	})
+	require.ErrorIs(t, err, ErrHostKeyRejected)
+
+	data, err := os.ReadFile(knownHosts)
+	require.NoError(t, err)
+	assert.Empty(t, data)
+
+	// Connections refuse the untrusted host
+	keyPath := filepath.Join(t.TempDir(), "id_ed25519")
+	require.NoError(t, km.GenerateKeyPair("ed25519", keyPath, ""))
+	err = km.TestConnection("127.0.0.1", "tunnel", keyPath, port)
+	assert.ErrorContains(t, err, "key is unknown")
+}
+
+func TestTrustHostKeyChanged(t *testing.T) {
+	port, _ := startHostKeyServer(t)
+	knownHosts := filepath.Join(t.TempDir(), "known_hosts")
+
+	// Record a different key for the server's address
+	_, otherKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	otherSigner, err := ssh.NewSignerFromKey(otherKey)
+	require.NoError(t, err)
+	address := net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+	line := knownhosts.Line([]string{knownhosts.Normalize(address)}, otherSigner.PublicKey())
+	require.NoError(t, os.WriteFile(knownHosts, []byte(line+"\n"), 0600))
+
+	km := NewKeyManager()
+	km.SetKnownHostsFile(knownHosts)
+	err = km.TrustHostKey("127.0.0.1", port, func(string, string) (bool, error) {
+		t.Fatal("asked to trust a changed host key")
+		return true, nil
+	})
+	assert.ErrorIs(t, err, ErrHostKeyChanged)
+}
+
+func TestTrustHostKeyOfAnotherType(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	edSigner, err := ssh.NewSignerFromKey(edKey)
+	require.NoError(t, err)
+	port := serveHostKeys(t, newECDSASigner(t), edSigner)
+	address := net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+	knownHosts := filepath.Join(t.TempDir(), "known_hosts")
+
+	km := NewKeyManager()
+	km.SetKnownHostsFile(knownHosts)
+	noPrompt := func(string, string) (bool, error) {
+		t.Fatal("asked to trust a recorded host")
+		return false, nil
+	}
+
+	// A host whose recorded ed25519 key it still has is trusted, though it
+	// prefers to present its ecdsa key
+	line := knownhosts.Line([]string{knownhosts.Normalize(address)}, edSigner.PublicKey())
+	require.NoError(t, os.WriteFile(knownHosts, []byte(line+"\n"), 0600))
+	require.NoError(t, km.TrustHostKey("127.0.0.1", port, noPrompt))
+
+	// A host that only has a key of a type not recorded for it has not
+	// changed its key, so the user is asked about the new one
+	onlyEd := serveHostKeys(t, edSigner)
+	onlyEdAddress := net.JoinHostPort("127.0.0.1", strconv.Itoa(onlyEd))
+	line = knownhosts.Line([]string{knownhosts.Normalize(onlyEdAddress)}, newECDSASigner(t).PublicKey())
+	require.NoError(t, os.WriteFile(knownHosts, []byte(line+"\n"), 0600))
+	var asked bool
+	err = km.TrustHostKey("127.0.0.1", onlyEd, func(string, string) (bool, error) {
+		asked = true
+		return true, nil
+	})
+	require.NoError(t, err)
+	assert.True(t, asked)
+}
+
+func TestInsecureSkipHostKeyCheck(t *testing.T) {
+	port, hostKey := startHostKeyServer(t)
+	keyPath := filepath.Join(t.TempDir(), "id_ed25519")
+	km := NewKeyManager()
+	require.NoError(t, km.GenerateKeyPair("ed25519", keyPath, ""))
+
+	var logged bytes.Buffer
+	logger.SetOutput(&logged)
+	t.Cleanup(func() { logger.SetOutput(os.Stdout) })
+
+	// With a known_hosts file that lacks the server, verification fails
+	km.SetKnownHostsFile(filepath.Join(t.TempDir(), "known_hosts"))
+	require.NoError(t, os.WriteFile(km.knownHostsFile, nil, 0600))
+	err := km.TestConnection("127.0.0.1", "tunnel", keyPath, port)
+	assert.ErrorContains(t, err, "key is unknown")
+	assert.NotContains(t, logged.String(), "INSECURE")
+
+	// Skipping verification lets the connection through, with a warning
+	km.SetInsecureSkipHostKeyCheck(true)
+	client, err := km.Connect("127.0.0.1", "tunnel", keyPath, port)
+	require.NoError(t, err)
+	client.Close()
+	assert.Contains(t, logged.String(), "INSECURE")
+	assert.Contains(t, logged.String(), ssh.FingerprintSHA256(hostKey))
+
+	// So does skipping it for the whole process
+	km.SetInsecureSkipHostKeyCheck(false)
+	SkipAllHostKeyChecks(true)
+	t.Cleanup(func() { SkipAllHostKeyChecks(false) })
+	logged.Reset()
+	client, err = km.Connect("127.0.0.1", "tunnel", keyPath, port)
+	require.NoError(t, err)
+	client.Close()
+	assert.Contains(t, logged.String(), "INSECURE")
+}
+
+func TestAcceptNewHostKeys(t *testing.T) {
+	_, hostKey := startHostKeyServer(t)
+	knownHosts := filepath.Join(t.TempDir(), ".ssh", "known_hosts")
+	callback := acceptNewHostKeys(knownHosts)
+	addr := &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 2222}
+
+	// A new host is added, then verified
+	require.NoError(t, callback(addr.String(), addr, hostKey))
+	data, err := os.ReadFile(knownHosts)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "[127.0.0.1]:2222")
+	require.NoError(t, callback(addr.String(), addr, hostKey))
+
+	// A host presenting a different key is refused
+	_, otherKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	otherSigner, err := ssh.NewSignerFromKey(otherKey)
+	require.NoError(t, err)
+	err = callback(addr.String(), addr, otherSigner.PublicKey())
+	assert.ErrorIs(t, err, ErrHostKeyChanged)
+
+	// A key of a type not recorded yet is not a change, and is added
+	ecdsaSigner := newECDSASigner(t)
+	require.NoError(t, callback(addr.String(), addr, ecdsaSigner.PublicKey()))
+	require.NoError(t, callback(addr.String(), addr, ecdsaSigner.PublicKey()))
+}
+
+func newECDSASigner(t *testing.T) ssh.Signer {
+	t.Helper()
+	privKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(privKey)
+	require.NoError(t, err)
+	return signer
+}
+
+func TestConnectAsksForRecordedHostKeyType(t *testing.T) {
+	// The server prefers ecdsa, but only its ed25519 key is recorded
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	edSigner, err := ssh.NewSignerFromKey(edKey)
+	require.NoError(t, err)
+	port := serveHostKeys(t, newECDSASigner(t), edSigner)
+
+	address := net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+	knownHosts := filepath.Join(t.TempDir(), "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize(address)}, edSigner.PublicKey())
+	require.NoError(t, os.WriteFile(knownHosts, []byte(line+"\n"), 0600))
+
+	keyPath := filepath.Join(t.TempDir(), "id_ed25519")
+	km := NewKeyManager()
+	require.NoError(t, km.GenerateKeyPair("ed25519", keyPath, ""))
+	assert.Equal(t, []string{ssh.KeyAlgoED25519}, knownHostKeyAlgorithms(knownHosts, address))
+
+	// Checking strictly against the file
+	km.SetKnownHostsFile(knownHosts)
+	client, err := km.Connect("127.0.0.1", "tunnel", keyPath, port)
+	require.NoError(t, err)
+	client.Close()
+
+	// And against the user's known_hosts, which is left as it was
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	homedir.DisableCache = true
+	t.Cleanup(func() { homedir.DisableCache = false })
+	require.NoError(t, os.MkdirAll(filepath.Join(home, ".ssh"), 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(home, ".ssh", "known_hosts"), []byte(line+"\n"), 0600))
+	km.SetKnownHostsFile("")
+	client, err = km.Connect("127.0.0.1", "tunnel", keyPath, port)
+	require.NoError(t, err)
+	client.Close()
+	data, err := os.ReadFile(filepath.Join(home, ".ssh", "known_hosts"))
+	require.NoError(t, err)
+	assert.Equal(t, line+"\n", string(data))
+}
@@ -1,51 +1,274 @@
 package ssh
 
 import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
 	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rand"
+	"crypto/rsa"
 	"crypto/x509"
+	"encoding/base64"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"net"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
+	"github.com/mitchellh/go-homedir"
 	"golang.org/x/crypto/ssh"
 )
 
+// Default timeouts for remote operations when no explicit timeout is set
+const (
+	DefaultConnectTimeout   = 10 * time.Second
+	DefaultInstallTimeout   = 30 * time.Second
+	DefaultHandshakeTimeout = 5 * time.Second
+)
+
 // KeyManager handles SSH key operations
-type KeyManager struct{}
+type KeyManager struct {
+	timeout    time.Duration
+	algorithms Algorithms
+	// knownHostsFile, if set, must list the host key of every server
+	// connected to; otherwise the user's known_hosts is used, trusting new
+	// hosts on first use
+	knownHostsFile string
+	// insecure turns host key verification off
+	insecure bool
+	// bindAddress, if set, is the local IP address connections originate
+	// from
+	bindAddress string
+}
 
 // NewKeyManager creates a new SSH key manager
 func NewKeyManager() *KeyManager {
 	return &KeyManager{}
 }
 
-// GenerateKeyPair generates a new SSH key pair
-func (km *KeyManager) GenerateKeyPair(keyType, keyPath string) error {
+// SetTimeout overrides the timeout applied to every remote operation, covering
+// both the TCP dial and the SSH handshake. Zero restores the defaults.
+func (km *KeyManager) SetTimeout(timeout time.Duration) {
+	km.timeout = timeout
+}
+
+// SetBindAddress makes connections originate from a local IP address, like
+// ssh -b, on machines with several interfaces. Empty lets the system choose.
+func (km *KeyManager) SetBindAddress(address string) {
+	km.bindAddress = address
+}
+
+// DialTCP opens a TCP connection to address from the bind address, if set
+func (km *KeyManager) DialTCP(address string, timeout time.Duration) (net.Conn, error) {
+	return km.dialTCP(context.Background(), address, timeout)
+}
+
+// dialTCP is DialTCP, giving up when ctx is cancelled
+func (km *KeyManager) dialTCP(ctx context.Context, address string, timeout time.Duration) (net.Conn, error) {
+	dialer := net.Dialer{Timeout: timeout}
+	if km.bindAddress != "" {
+		ip := net.ParseIP(km.bindAddress)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid bind address %q", km.bindAddress)
+		}
+		dialer.LocalAddr = &net.TCPAddr{IP: ip}
+	}
+	return dialer.DialContext(ctx, "tcp", address)
+}
+
+// Timeout returns the configured timeout, or zero when using the defaults
+func (km *KeyManager) Timeout() time.Duration {
+	return km.timeout
+}
+
+// timeoutOr returns the configured timeout, falling back to def
+func (km *KeyManager) timeoutOr(def time.Duration) time.Duration {
+	if km.timeout > 0 {
+		return km.timeout
+	}
+	return def
+}
+
+// clientConfig builds an SSH client config authenticating with the given key
+func (km *KeyManager) clientConfig(user, keyPath string, defaultTimeout time.Duration) (*ssh.ClientConfig, error) {
+	keyData, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key: %w", err)
+	}
+
+	signer, err := ssh.ParsePrivateKey(keyData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+
+	algorithms, err := km.algorithms.sshConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	hostKeyCallback, err := km.hostKeyCallback()
+	if err != nil {
+		return nil, err
+	}
+
+	return &ssh.ClientConfig{
+		Config: algorithms,
+		User:   user,
+		Auth: []ssh.AuthMethod{
+			ssh.PublicKeys(signer),
+		},
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         km.timeoutOr(defaultTimeout),
+	}, nil
+}
+
+// dial connects to an SSH server, enforcing config.Timeout on both the TCP
+// connection and the SSH handshake. Cancelling ctx closes the connection,
+// during the handshake or after, failing whatever the client is running.
+func (km *KeyManager) dial(ctx context.Context, address string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	conn, err := km.dialTCP(ctx, address, config.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	context.AfterFunc(ctx, func() { conn.Close() })
+
+	if config.Timeout > 0 {
+		if err := conn.SetDeadline(time.Now().Add(config.Timeout)); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, address, config)
+	if err != nil {
+		conn.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+
+	// Clear the handshake deadline for the lifetime of the connection
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		sshConn.Close()
+		return nil, err
+	}
+
+	return ssh.NewClient(sshConn, chans, reqs), nil
+}
+
+// Connect opens an authenticated SSH connection using the given private key
+func (km *KeyManager) Connect(host, user, keyPath string, port int) (*ssh.Client, error) {
+	return km.ConnectContext(context.Background(), host, user, keyPath, port)
+}
+
+// ConnectContext is Connect, closing the connection when ctx is cancelled so
+// that nothing is left running on the server through it
+func (km *KeyManager) ConnectContext(ctx context.Context, host, user, keyPath string, port int) (*ssh.Client, error) {
+	return km.connect(ctx, host, user, keyPath, port, DefaultInstallTimeout)
+}
+
+// connect opens an authenticated SSH connection, using defaultTimeout unless
+// a timeout has been configured. Cancelling ctx closes it.
+func (km *KeyManager) connect(ctx context.Context, host, user, keyPath string, port int, defaultTimeout time.Duration) (*ssh.Client, error) {
+	config, err := km.clientConfig(user, keyPath, defaultTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	address := net.JoinHostPort(host, fmt.Sprintf("%d", port))
+	config.HostKeyAlgorithms = km.hostKeyAlgorithms(address)
+	client, err := km.dial(ctx, address, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", address, err)
+	}
+
+	return client, nil
+}
+
+// DefaultKeyComment returns the public key comment used for keys generated
+// for a tunnel, e.g. "ssh-tunnel:home@raspberrypi"
+func DefaultKeyComment(tunnelName string) string {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "localhost"
+	}
+	if tunnelName == "" {
+		return "ssh-tunnel@" + hostname
+	}
+	return fmt.Sprintf("ssh-tunnel:%s@%s", tunnelName, hostname)
+}
+
+// KeyTypes are the key types GenerateKeyPair creates, the default first.
+// rsa is for older servers that do not accept ed25519 keys.
+var KeyTypes = []string{"ed25519", "ecdsa", "rsa"}
+
+// CheckKeyType returns an error if GenerateKeyPair cannot create keys of
+// keyType
+func CheckKeyType(keyType string) error {
+	for _, supported := range KeyTypes {
+		if keyType == supported {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported key type '%s' (use %s)", keyType, strings.Join(KeyTypes, ", "))
+}
+
+// GenerateKeyPair generates a new SSH key pair. The comment is appended to the
+// public key so the key can be identified in authorized_keys.
+func (km *KeyManager) GenerateKeyPair(keyType, keyPath, comment string) error {
 	switch keyType {
 	case "ed25519", "":
-		return km.generateED25519KeyPair(keyPath)
+		return km.generateED25519KeyPair(keyPath, comment)
 	case "rsa":
-		return fmt.Errorf("RSA key generation not yet implemented")
+		return km.generateRSAKeyPair(keyPath, comment)
 	case "ecdsa":
-		return fmt.Errorf("ECDSA key generation not yet implemented")
+		return km.generateECDSAKeyPair(keyPath, comment)
 	default:
-		return fmt.Errorf("unsupported key type: %s", keyType)
+		return CheckKeyType(keyType)
 	}
 }
 
 // generateED25519KeyPair generates an ED25519 key pair
-func (km *KeyManager) generateED25519KeyPair(keyPath string) error {
-	// Generate ED25519 key pair
-	pubKey, privKey, err := ed25519.GenerateKey(rand.Reader)
+func (km *KeyManager) generateED25519KeyPair(keyPath, comment string) error {
+	_, privKey, err := ed25519.GenerateKey(rand.Reader)
 	if err != nil {
 		return fmt.Errorf("failed to generate ED25519 key pair: %w", err)
 	}
 
+	return km.writeKeyPair(privKey, keyPath, comment)
+}
+
+// generateRSAKeyPair generates a 4096-bit RSA key pair
+func (km *KeyManager) generateRSAKeyPair(keyPath, comment string) error {
+	privKey, err := rsa.GenerateKey(rand.Reader, 4096)
+	if err != nil {
+		return fmt.Errorf("failed to generate RSA key pair: %w", err)
+	}
+
+	return km.writeKeyPair(privKey, keyPath, comment)
+}
+
+// generateECDSAKeyPair generates a P-256 ECDSA key pair
+func (km *KeyManager) generateECDSAKeyPair(keyPath, comment string) error {
+	privKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return fmt.Errorf("failed to generate ECDSA key pair: %w", err)
+	}
+
+	return km.writeKeyPair(privKey, keyPath, comment)
+}
+
+// writeKeyPair writes a private key in PKCS#8 PEM format and its public key
+// in authorized_keys format to keyPath and keyPath.pub
+func (km *KeyManager) writeKeyPair(privKey crypto.Signer, keyPath, comment string) error {
 	// Convert to SSH format
-	sshPubKey, err := ssh.NewPublicKey(pubKey)
+	sshPubKey, err := ssh.NewPublicKey(privKey.Public())
 	if err != nil {
 		return fmt.Errorf("failed to create SSH public key: %w", err)
 	}
@@ -74,7 +297,7 @@ func (km *KeyManager) generateED25519KeyPair(keyPath string) error {
 
 	// Write public key
 	pubKeyPath := keyPath + ".pub"
-	pubKeyData := ssh.MarshalAuthorizedKey(sshPubKey)
+	pubKeyData := MarshalAuthorizedKeyWithComment(sshPubKey, comment)
 	if err := os.WriteFile(pubKeyPath, pubKeyData, 0644); err != nil {
 		return fmt.Errorf("failed to write public key: %w", err)
 	}
@@ -82,6 +305,17 @@ func (km *KeyManager) generateED25519KeyPair(keyPath string) error {
 	return nil
 }
 
+// MarshalAuthorizedKeyWithComment serializes a public key in authorized_keys
+// format, followed by an optional comment
+func MarshalAuthorizedKeyWithComment(key ssh.PublicKey, comment string) []byte {
+	line := ssh.MarshalAuthorizedKey(key)
+	comment = strings.TrimSpace(comment)
+	if comment == "" {
+		return line
+	}
+	return append(bytes.TrimRight(line, "\n"), []byte(" "+comment+"\n")...)
+}
+
 // ValidateKey validates an SSH private key
 func (km *KeyManager) ValidateKey(keyPath string) error {
 	keyData, err := os.ReadFile(keyPath)
@@ -89,6 +323,14 @@ func (km *KeyManager) ValidateKey(keyPath string) error {
 		return fmt.Errorf("failed to read key file: %w", err)
 	}
 
+	// PuTTY keys are valid keys, but ssh cannot use them until converted
+	if IsPPK(keyData) {
+		if _, _, err := ParsePPK(keyData); err != nil {
+			return fmt.Errorf("invalid PuTTY private key: %w", err)
+		}
+		return fmt.Errorf("%w; import it to convert it to OpenSSH format", ErrPPKFormat)
+	}
+
 	// Try to parse as SSH private key
 	_, err = ssh.ParsePrivateKey(keyData)
 	if err != nil {
@@ -98,17 +340,64 @@ func (km *KeyManager) ValidateKey(keyPath string) error {
 	return nil
 }
 
+// ImportPrivateKey validates private key data and stores it at keyPath along
+// with its public key. PuTTY .ppk keys are converted to OpenSSH format.
+func (km *KeyManager) ImportPrivateKey(keyData []byte, keyPath string) error {
+	if IsPPK(keyData) {
+		converted, err := ConvertPPK(keyData)
+		if err != nil {
+			return fmt.Errorf("failed to convert PuTTY key: %w", err)
+		}
+		keyData = converted
+	}
+
+	signer, err := ssh.ParsePrivateKey(keyData)
+	if err != nil {
+		return fmt.Errorf("invalid SSH private key: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(keyPath), 0700); err != nil {
+		return fmt.Errorf("failed to create key directory: %w", err)
+	}
+
+	if err := os.WriteFile(keyPath, keyData, 0600); err != nil {
+		return fmt.Errorf("failed to write private key: %w", err)
+	}
+
+	pubKeyData := ssh.MarshalAuthorizedKey(signer.PublicKey())
+	if err := os.WriteFile(keyPath+".pub", pubKeyData, 0644); err != nil {
+		return fmt.Errorf("failed to write public key: %w", err)
+	}
+
+	return nil
+}
+
 // GetFingerprint gets the SSH fingerprint of a host
 func (km *KeyManager) GetFingerprint(host string, port int) (string, error) {
+	hostKey, err := km.fetchHostKey(host, port)
+	if err != nil {
+		return "", err
+	}
+	return ssh.FingerprintSHA256(hostKey), nil
+}
+
+// fetchHostKey performs enough of an SSH handshake with a host to learn its
+// host key
+func (km *KeyManager) fetchHostKey(host string, port int) (ssh.PublicKey, error) {
 	address := net.JoinHostPort(host, fmt.Sprintf("%d", port))
 
 	// Set timeout for connection
-	conn, err := net.DialTimeout("tcp", address, 10*time.Second)
+	conn, err := km.DialTCP(address, km.timeoutOr(DefaultConnectTimeout))
 	if err != nil {
-		return "", fmt.Errorf("failed to connect to %s: %w", address, err)
+		return nil, fmt.Errorf("failed to connect to %s: %w", address, err)
 	}
 	defer conn.Close()
 
+	handshakeTimeout := km.timeoutOr(DefaultHandshakeTimeout)
+	if err := conn.SetDeadline(time.Now().Add(handshakeTimeout)); err != nil {
+		return nil, fmt.Errorf("failed to set deadline for %s: %w", address, err)
+	}
+
 	var hostKey ssh.PublicKey
 	// Perform SSH handshake to get host key
 	sshConn, chans, reqs, err := ssh.NewClientConn(conn, address, &ssh.ClientConfig{
@@ -117,11 +406,12 @@ func (km *KeyManager) GetFingerprint(host string, port int) (string, error) {
 			hostKey = key
 			return nil
 		},
-		Timeout: 5 * time.Second,
+		HostKeyAlgorithms: preferHostKeyAlgorithms(km.hostKeyAlgorithms(address)),
+		Timeout:           handshakeTimeout,
 	})
 	if err != nil && hostKey == nil {
 		// Try to extract host key from error if possible
-		return "", fmt.Errorf("failed SSH handshake with %s: %w", address, err)
+		return nil, fmt.Errorf("failed SSH handshake with %s: %w", address, err)
 	}
 	if sshConn != nil {
 		defer sshConn.Close()
@@ -135,16 +425,17 @@ func (km *KeyManager) GetFingerprint(host string, port int) (string, error) {
 		}()
 	}
 
-	// Get host key fingerprint
 	if hostKey == nil {
-		return "", fmt.Errorf("could not retrieve host key")
+		return nil, fmt.Errorf("could not retrieve host key")
 	}
-
-	return ssh.FingerprintSHA256(hostKey), nil
+	return hostKey, nil
 }
 
-// InstallPublicKey installs a public key on a remote server
-func (km *KeyManager) InstallPublicKey(host, user, keyPath string, port int) error {
+// InstallPublicKey installs a public key on a remote server, logging in with
+// authKeyPath, a key the server already accepts. If options is non-empty the
+// key is prefixed with them in authorized_keys; a key already authorized with
+// other options is rewritten with them.
+func (km *KeyManager) InstallPublicKey(host, user, authKeyPath, keyPath string, port int, options string) error {
 	// Read public key
 	pubKeyPath := keyPath + ".pub"
 	pubKeyData, err := os.ReadFile(pubKeyPath)
@@ -152,34 +443,37 @@ func (km *KeyManager) InstallPublicKey(host, user, keyPath string, port int) err
 		return fmt.Errorf("failed to read public key: %w", err)
 	}
 
-	// Read private key for authentication
-	privKeyData, err := os.ReadFile(keyPath)
+	authorizedLine, err := FormatAuthorizedKey(pubKeyData, options)
 	if err != nil {
-		return fmt.Errorf("failed to read private key: %w", err)
+		return err
 	}
 
-	signer, err := ssh.ParsePrivateKey(privKeyData)
+	// Connect to remote server
+	client, err := km.connect(context.Background(), host, user, authKeyPath, port, DefaultInstallTimeout)
 	if err != nil {
-		return fmt.Errorf("failed to parse private key: %w", err)
+		return err
 	}
+	defer client.Close()
 
-	// Create SSH client config
-	config := &ssh.ClientConfig{
-		User: user,
-		Auth: []ssh.AuthMethod{
-			ssh.PublicKeys(signer),
-		},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-		Timeout:         30 * time.Second,
+	// Skip the install if the key is already authorized as requested
+	existing, err := readRemoteFile(client, "~/.ssh/authorized_keys")
+	if err != nil {
+		return err
 	}
-
-	// Connect to remote server
-	address := net.JoinHostPort(host, fmt.Sprintf("%d", port))
-	client, err := ssh.Dial("tcp", address, config)
+	pubKey, _, keyOptions, _, err := ssh.ParseAuthorizedKey(authorizedLine)
 	if err != nil {
-		return fmt.Errorf("failed to connect to %s: %w", address, err)
+		return fmt.Errorf("invalid public key: %w", err)
+	}
+	if AuthorizedKeysContain(existing, pubKey) {
+		if options == "" || authorizedWithOptions(existing, pubKey, keyOptions) {
+			return nil
+		}
+		kept, _ := RemoveAuthorizedKey(existing, pubKey)
+		if len(kept) > 0 && !bytes.HasSuffix(kept, []byte("\n")) {
+			kept = append(kept, '\n')
+		}
+		return writeRemoteAuthorizedKeys(client, append(append(kept, authorizedLine...), '\n'))
 	}
-	defer client.Close()
 
 	// Create SSH session
 	session, err := client.NewSession()
@@ -188,14 +482,18 @@ func (km *KeyManager) InstallPublicKey(host, user, keyPath string, port int) err
 	}
 	defer session.Close()
 
-	// Command to add public key to authorized_keys
+	// Command to add public key to authorized_keys. The line is sent base64
+	// encoded so options containing quotes survive the remote shell, and a
+	// newline is added first if the file does not end with one.
 	cmd := fmt.Sprintf(`
 		mkdir -p ~/.ssh &&
 		chmod 700 ~/.ssh &&
-		echo '%s' >> ~/.ssh/authorized_keys &&
+		touch ~/.ssh/authorized_keys &&
+		{ [ ! -s ~/.ssh/authorized_keys ] || [ -z "$(tail -c 1 ~/.ssh/authorized_keys)" ] || echo >> ~/.ssh/authorized_keys; } &&
+		echo '%s' | base64 -d >> ~/.ssh/authorized_keys &&
 		chmod 600 ~/.ssh/authorized_keys &&
 		echo "Public key installed successfully"
-	`, string(pubKeyData))
+	`, base64.StdEncoding.EncodeToString(authorizedLine))
 
 	// Execute the command
 	output, err := session.CombinedOutput(cmd)
@@ -206,34 +504,97 @@ func (km *KeyManager) InstallPublicKey(host, user, keyPath string, port int) err
 	return nil
 }
 
-// TestConnection tests an SSH connection
-func (km *KeyManager) TestConnection(host, user, keyPath string, port int) error {
-	// Read private key
-	keyData, err := os.ReadFile(keyPath)
+// writeRemoteAuthorizedKeys replaces ~/.ssh/authorized_keys on a remote
+// server with data. The file is written beside it and renamed into place,
+// so a failed write leaves the old one.
+func writeRemoteAuthorizedKeys(client *ssh.Client, data []byte) error {
+	session, err := client.NewSession()
 	if err != nil {
-		return fmt.Errorf("failed to read private key: %w", err)
+		return fmt.Errorf("failed to create SSH session: %w", err)
 	}
+	defer session.Close()
 
-	signer, err := ssh.ParsePrivateKey(keyData)
+	cmd := fmt.Sprintf(`
+		mkdir -p ~/.ssh &&
+		chmod 700 ~/.ssh &&
+		echo '%s' | base64 -d > ~/.ssh/authorized_keys.new &&
+		chmod 600 ~/.ssh/authorized_keys.new &&
+		mv ~/.ssh/authorized_keys.new ~/.ssh/authorized_keys
+	`, base64.StdEncoding.EncodeToString(data))
+
+	output, err := session.CombinedOutput(cmd)
 	if err != nil {
-		return fmt.Errorf("failed to parse private key: %w", err)
+		return fmt.Errorf("failed to update authorized_keys: %w (output: %s)", err, string(output))
 	}
+	return nil
+}
 
-	// Create SSH client config
-	config := &ssh.ClientConfig{
-		User: user,
-		Auth: []ssh.AuthMethod{
-			ssh.PublicKeys(signer),
-		},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-		Timeout:         10 * time.Second,
+// RevokePublicKey removes a public key from authorized_keys on a remote
+// server, connecting with the key itself, so it must still be authorized. It
+// reports whether the key was found.
+func (km *KeyManager) RevokePublicKey(host, user, keyPath string, port int) (bool, error) {
+	pubKeyData, err := os.ReadFile(keyPath + ".pub")
+	if err != nil {
+		return false, fmt.Errorf("failed to read public key: %w", err)
+	}
+	pubKey, _, _, _, err := ssh.ParseAuthorizedKey(pubKeyData)
+	if err != nil {
+		return false, fmt.Errorf("invalid public key: %w", err)
 	}
 
-	// Connect to remote server
-	address := net.JoinHostPort(host, fmt.Sprintf("%d", port))
-	client, err := ssh.Dial("tcp", address, config)
+	client, err := km.connect(context.Background(), host, user, keyPath, port, DefaultInstallTimeout)
 	if err != nil {
-		return fmt.Errorf("failed to connect to %s: %w", address, err)
+		return false, err
+	}
+	defer client.Close()
+
+	existing, err := readRemoteFile(client, "~/.ssh/authorized_keys")
+	if err != nil {
+		return false, err
+	}
+	kept, removed := RemoveAuthorizedKey(existing, pubKey)
+	if removed == 0 {
+		return false, nil
+	}
+
+	session, err := client.NewSession()
+	if err != nil {
+		return false, fmt.Errorf("failed to create SSH session: %w", err)
+	}
+	defer session.Close()
+
+	// Replace the file in one step so a dropped connection cannot leave it
+	// half written
+	session.Stdin = bytes.NewReader(kept)
+	cmd := "umask 077 && cat > ~/.ssh/authorized_keys.ssh-tunnel && mv ~/.ssh/authorized_keys.ssh-tunnel ~/.ssh/authorized_keys"
+	if output, err := session.CombinedOutput(cmd); err != nil {
+		return false, fmt.Errorf("failed to revoke public key: %w (output: %s)", err, string(output))
+	}
+
+	return true, nil
+}
+
+// readRemoteFile returns the contents of a file on the remote server, or nil
+// if it does not exist
+func readRemoteFile(client *ssh.Client, path string) ([]byte, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create SSH session: %w", err)
+	}
+	defer session.Close()
+
+	output, err := session.Output(fmt.Sprintf("cat %s 2>/dev/null || true", path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read remote %s: %w", path, err)
+	}
+	return output, nil
+}
+
+// TestConnection tests an SSH connection
+func (km *KeyManager) TestConnection(host, user, keyPath string, port int) error {
+	client, err := km.connect(context.Background(), host, user, keyPath, port, DefaultConnectTimeout)
+	if err != nil {
+		return err
 	}
 	defer client.Close()
 
@@ -262,15 +623,61 @@ func (km *KeyManager) GetPublicKeyContent(keyPath string) (string, error) {
 	return string(data), nil
 }
 
-// DeployPublicKey deploys a public key to a remote server
-func (km *KeyManager) DeployPublicKey(host string, port int, user, keyPath string) error {
+// DeployPublicKey deploys a public key to a remote server, prefixed with the
+// given authorized_keys options. Like ssh-copy-id, it logs in to install the
+// key with one of the user's own keys (see DefaultIdentityFiles) that the
+// server accepts. If none is accepted, it returns ErrNoAuthorizedKey and the
+// key has to be installed by hand. A key that already logs in is rewritten
+// with options if it is authorized with others.
+func (km *KeyManager) DeployPublicKey(host string, port int, user, keyPath, options string) error {
 	// First test if we can connect with the current key
 	err := km.TestConnection(host, user, keyPath, port)
 	if err == nil {
-		// Connection already works, key might already be deployed
+		// Connection already works, so the key is deployed; it logs in to
+		// apply the options itself
+		if options == "" {
+			return nil
+		}
+		return km.InstallPublicKey(host, user, keyPath, keyPath, port, options)
+	}
+	if !isAuthFailure(err) {
+		return err // The server cannot be reached, or refused the connection
+	}
+
+	for _, identity := range DefaultIdentityFiles() {
+		if identity != keyPath && km.TestConnection(host, user, identity, port) == nil {
+			return km.InstallPublicKey(host, user, identity, keyPath, port, options)
+		}
+	}
+	return fmt.Errorf("%w for %s@%s; add %s.pub to ~/.ssh/authorized_keys there by hand",
+		ErrNoAuthorizedKey, user, host, keyPath)
+}
+
+// ErrNoAuthorizedKey is returned by DeployPublicKey when none of the user's
+// keys logs in to the server to install the new key with
+var ErrNoAuthorizedKey = errors.New("no key that logs in to the server to install the public key with")
+
+// isAuthFailure reports whether a connection failed because the server
+// accepted none of the credentials offered. The ssh package has no error
+// value for this, only its message.
+func isAuthFailure(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "ssh: unable to authenticate")
+}
+
+// DefaultIdentityFiles returns the user's own private keys that exist among
+// ~/.ssh/id_ed25519, id_ecdsa and id_rsa, which ssh also tries by default
+func DefaultIdentityFiles() []string {
+	home, err := homedir.Dir()
+	if err != nil {
 		return nil
 	}
 
-	// Try to install the key using ssh-copy-id equivalent
-	return km.InstallPublicKey(host, user, keyPath, port)
+	var paths []string
+	for _, keyType := range KeyTypes {
+		path := filepath.Join(home, ".ssh", "id_"+keyType)
+		if _, err := os.Stat(path); err == nil {
+			paths = append(paths, path)
+		}
+	}
+	return paths
 }
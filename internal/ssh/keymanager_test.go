@@ -0,0 +1,206 @@
+package ssh
+
+import (
+	"encoding/base64"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestSetTimeoutPropagatesToClientConfig(t *testing.T) {
+	keyPath := filepath.Join(t.TempDir(), "test_key")
+	km := NewKeyManager()
+	require.NoError(t, km.GenerateKeyPair("ed25519", keyPath, ""))
+
+	cfg, err := km.clientConfig("tunnel", keyPath, DefaultConnectTimeout)
+	require.NoError(t, err)
+	assert.Equal(t, DefaultConnectTimeout, cfg.Timeout)
+
+	km.SetTimeout(2 * time.Second)
+	cfg, err = km.clientConfig("tunnel", keyPath, DefaultConnectTimeout)
+	require.NoError(t, err)
+	assert.Equal(t, 2*time.Second, cfg.Timeout)
+}
+
+func TestTestConnectionHonoursTimeout(t *testing.T) {
+	keyPath := filepath.Join(t.TempDir(), "test_key")
+	km := NewKeyManager()
+	require.NoError(t, km.GenerateKeyPair("ed25519", keyPath, ""))
+
+	// A server that accepts connections but never completes the handshake
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	addr := listener.Addr().(*net.TCPAddr)
+	km.SetTimeout(200 * time.Millisecond)
+
+	start := time.Now()
+	err = km.TestConnection("127.0.0.1", "tunnel", keyPath, addr.Port)
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
+
+func TestGenerateKeyPairWritesComment(t *testing.T) {
+	km := NewKeyManager()
+	comment := DefaultKeyComment("home")
+	assert.True(t, strings.HasPrefix(comment, "ssh-tunnel:home@"))
+
+	for _, keyType := range []string{"ed25519", "rsa", "ecdsa"} {
+		t.Run(keyType, func(t *testing.T) {
+			keyPath := filepath.Join(t.TempDir(), "id_"+keyType)
+			require.NoError(t, km.GenerateKeyPair(keyType, keyPath, comment))
+			require.NoError(t, km.ValidateKey(keyPath))
+
+			pubData, err := os.ReadFile(keyPath + ".pub")
+			require.NoError(t, err)
+			assert.True(t, strings.HasSuffix(string(pubData), " "+comment+"\n"))
+
+			_, parsedComment, _, _, err := ssh.ParseAuthorizedKey(pubData)
+			require.NoError(t, err)
+			assert.Equal(t, comment, parsedComment)
+		})
+	}
+}
+
+func TestSetAlgorithmsPropagatesToClientConfig(t *testing.T) {
+	keyPath := filepath.Join(t.TempDir(), "test_key")
+	km := NewKeyManager()
+	require.NoError(t, km.GenerateKeyPair("ed25519", keyPath, ""))
+
+	cfg, err := km.clientConfig("tunnel", keyPath, DefaultConnectTimeout)
+	require.NoError(t, err)
+	assert.Nil(t, cfg.Ciphers)
+	assert.Nil(t, cfg.MACs)
+	assert.Nil(t, cfg.KeyExchanges)
+
+	km.SetAlgorithms(Algorithms{
+		Ciphers:      []string{"chacha20-poly1305@openssh.com", "aes256-gcm@openssh.com"},
+		MACs:         []string{"umac-128-etm@openssh.com", "hmac-sha2-512-etm@openssh.com"},
+		KeyExchanges: []string{"curve25519-sha256"},
+	})
+	cfg, err = km.clientConfig("tunnel", keyPath, DefaultConnectTimeout)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"chacha20-poly1305@openssh.com", "aes256-gcm@openssh.com"}, cfg.Ciphers)
+	// umac is valid for OpenSSH but not implemented by crypto/ssh
+	assert.Equal(t, []string{"hmac-sha2-512-etm@openssh.com"}, cfg.MACs)
+	assert.Equal(t, []string{"curve25519-sha256"}, cfg.KeyExchanges)
+
+	km.SetAlgorithms(Algorithms{MACs: []string{"umac-64@openssh.com"}})
+	_, err = km.clientConfig("tunnel", keyPath, DefaultConnectTimeout)
+	assert.Error(t, err)
+}
+
+func TestDialTCPUsesBindAddress(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("binding to 127.0.0.2 needs Linux's 127.0.0.0/8 loopback")
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	accepted := make(chan net.Addr, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		accepted <- conn.RemoteAddr()
+		conn.Close()
+	}()
+
+	km := NewKeyManager()
+	km.SetBindAddress("127.0.0.2")
+	conn, err := km.DialTCP(listener.Addr().String(), time.Second)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	assert.Equal(t, "127.0.0.2", conn.LocalAddr().(*net.TCPAddr).IP.String())
+	select {
+	case remote := <-accepted:
+		assert.Equal(t, "127.0.0.2", remote.(*net.TCPAddr).IP.String())
+	case <-time.After(time.Second):
+		t.Fatal("connection was not accepted")
+	}
+
+	km.SetBindAddress("not-an-ip")
+	_, err = km.DialTCP(listener.Addr().String(), time.Second)
+	assert.ErrorContains(t, err, `invalid bind address "not-an-ip"`)
+}
+
+// startAuthorizedKeysServer runs an SSH server that accepts any key and
+// keeps an authorized_keys file in memory, which the commands KeyManager
+// runs read, append to and replace. The second function returns the file.
+func startAuthorizedKeysServer(t *testing.T, authorizedKeys string) (int, func() string) {
+	t.Helper()
+
+	var mu sync.Mutex
+	write := regexp.MustCompile(`echo '([A-Za-z0-9+/=]+)' \| base64 -d (>>?) ~/\.ssh/authorized_keys`)
+	port := startCommandServer(t, func(command string) (string, bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case strings.HasPrefix(command, "echo 'SSH connection test successful'"):
+			return "SSH connection test successful\n", true
+		case strings.HasPrefix(command, "cat ~/.ssh/authorized_keys"):
+			return authorizedKeys, true
+		}
+		match := write.FindStringSubmatch(command)
+		if match == nil {
+			return "", false
+		}
+		data, err := base64.StdEncoding.DecodeString(match[1])
+		if err != nil {
+			return "", false
+		}
+		if match[2] == ">" {
+			authorizedKeys = string(data)
+		} else {
+			authorizedKeys += string(data)
+		}
+		return "", true
+	})
+	return port, func() string {
+		mu.Lock()
+		defer mu.Unlock()
+		return authorizedKeys
+	}
+}
+
+func TestDeployPublicKeyAppliesOptionsToAuthorizedKey(t *testing.T) {
+	km, keyPath := newProbeKeyManager(t)
+	pubKey, err := os.ReadFile(keyPath + ".pub")
+	require.NoError(t, err)
+
+	// The key is already authorized without restrictions
+	other := "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIOMqqnkVzrm0SdG6UOoqKLsabgH5C9okWi0dh2l9GKJl other\n"
+	port, authorizedKeys := startAuthorizedKeysServer(t, other+string(pubKey))
+
+	require.NoError(t, km.DeployPublicKey("127.0.0.1", port, "tunnel", keyPath, RestrictedKeyOptions))
+	restricted, err := FormatAuthorizedKey(pubKey, RestrictedKeyOptions)
+	require.NoError(t, err)
+	assert.Equal(t, other+string(restricted)+"\n", authorizedKeys())
+
+	// Deploying it again with the same options changes nothing
+	require.NoError(t, km.DeployPublicKey("127.0.0.1", port, "tunnel", keyPath, RestrictedKeyOptions))
+	assert.Equal(t, other+string(restricted)+"\n", authorizedKeys())
+}
@@ -0,0 +1,266 @@
+package ssh
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// hashedHostPrefix starts a host name hashed as by ssh-keygen -H
+const hashedHostPrefix = "|1|"
+
+// KnownHost is one entry of a known_hosts file
+type KnownHost struct {
+	// Line is the entry's line number in the file
+	Line int
+	// Hosts are the entry's host patterns; hashed ones stay hashed
+	Hosts []string
+	// Marker is "@cert-authority" or "@revoked" for marked entries
+	Marker      string
+	KeyType     string
+	Fingerprint string
+	Comment     string
+}
+
+// Hashed reports whether all of the entry's host names are hashed
+func (h KnownHost) Hashed() bool {
+	for _, host := range h.Hosts {
+		if !strings.HasPrefix(host, hashedHostPrefix) {
+			return false
+		}
+	}
+	return len(h.Hosts) > 0
+}
+
+// knownHostsLine is a line of a known_hosts file: an entry, or a comment or
+// blank line kept as it is
+type knownHostsLine struct {
+	text  string
+	entry *KnownHost
+	// fields are the line's fields, the host patterns at hostField
+	fields    []string
+	hostField int
+}
+
+// readKnownHosts reads a known_hosts file line by line. A missing file has
+// no lines.
+func readKnownHosts(path string) ([]knownHostsLine, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read known hosts: %w", err)
+	}
+
+	var lines []knownHostsLine
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		text := scanner.Text()
+		line := knownHostsLine{text: text}
+
+		trimmed := strings.TrimSpace(text)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			lines = append(lines, line)
+			continue
+		}
+
+		marker, hosts, key, comment, _, err := ssh.ParseKnownHosts([]byte(trimmed))
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", path, n, err)
+		}
+		line.fields = strings.Fields(trimmed)
+		if marker != "" {
+			marker = "@" + marker
+			line.hostField = 1
+		}
+		line.entry = &KnownHost{
+			Line:        n,
+			Hosts:       hosts,
+			Marker:      marker,
+			KeyType:     key.Type(),
+			Fingerprint: ssh.FingerprintSHA256(key),
+			Comment:     comment,
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
+
+// writeKnownHosts replaces a known_hosts file with lines, through a
+// temporary file so it is never left half written
+func writeKnownHosts(path string, lines []knownHostsLine) error {
+	var buf bytes.Buffer
+	for _, line := range lines {
+		if line.entry != nil {
+			fields := append([]string(nil), line.fields...)
+			fields[line.hostField] = strings.Join(line.entry.Hosts, ",")
+			buf.WriteString(strings.Join(fields, " "))
+		} else {
+			buf.WriteString(line.text)
+		}
+		buf.WriteByte('\n')
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".known_hosts-*")
+	if err != nil {
+		return fmt.Errorf("failed to write known hosts: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write known hosts: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write known hosts: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// ListKnownHosts returns the entries of a known_hosts file. A missing file
+// has no entries.
+func ListKnownHosts(path string) ([]KnownHost, error) {
+	lines, err := readKnownHosts(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var hosts []KnownHost
+	for _, line := range lines {
+		if line.entry != nil {
+			hosts = append(hosts, *line.entry)
+		}
+	}
+	return hosts, nil
+}
+
+// AddKnownHost appends a host's key to a known_hosts file, creating the file
+// if needed. The address may include a port.
+func AddKnownHost(path, address string, key ssh.PublicKey) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create known hosts directory: %w", err)
+	}
+
+	line := knownhosts.Line([]string{knownhosts.Normalize(address)}, key)
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open known hosts: %w", err)
+	}
+	_, err = file.WriteString(line + "\n")
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write known hosts: %w", err)
+	}
+	return nil
+}
+
+// RemoveKnownHost drops a host from a known_hosts file, matching hashed
+// entries too, and returns how many entries named it. The address may
+// include a port. Entries naming other hosts as well keep those.
+func RemoveKnownHost(path, address string) (int, error) {
+	lines, err := readKnownHosts(path)
+	if err != nil {
+		return 0, err
+	}
+
+	name := knownhosts.Normalize(address)
+	removed := 0
+	kept := lines[:0]
+	for _, line := range lines {
+		if line.entry == nil || line.entry.Marker != "" {
+			kept = append(kept, line)
+			continue
+		}
+
+		var hosts []string
+		for _, host := range line.entry.Hosts {
+			if !hostEntryMatches(host, name) {
+				hosts = append(hosts, host)
+			}
+		}
+		if len(hosts) < len(line.entry.Hosts) {
+			removed++
+		}
+		if len(hosts) == 0 {
+			continue
+		}
+		line.entry.Hosts = hosts
+		kept = append(kept, line)
+	}
+
+	if removed == 0 {
+		return 0, nil
+	}
+	return removed, writeKnownHosts(path, kept)
+}
+
+// HashKnownHosts replaces the host names in a known_hosts file with hashes,
+// as ssh-keygen -H does, so the file no longer lists the hosts it trusts.
+// Wildcard and negated patterns cannot be hashed and are left as they are.
+// It returns the number of host names hashed.
+func HashKnownHosts(path string) (int, error) {
+	lines, err := readKnownHosts(path)
+	if err != nil {
+		return 0, err
+	}
+
+	hashed := 0
+	for _, line := range lines {
+		if line.entry == nil || line.entry.Marker != "" {
+			continue
+		}
+		for i, host := range line.entry.Hosts {
+			if strings.HasPrefix(host, hashedHostPrefix) || strings.ContainsAny(host, "*?!") {
+				continue
+			}
+			line.entry.Hosts[i] = knownhosts.HashHostname(host)
+			hashed++
+		}
+	}
+
+	if hashed == 0 {
+		return 0, nil
+	}
+	return hashed, writeKnownHosts(path, lines)
+}
+
+// hostEntryMatches reports whether a known_hosts host name, plain or hashed,
+// is the normalized host name
+func hostEntryMatches(entry, name string) bool {
+	if !strings.HasPrefix(entry, hashedHostPrefix) {
+		return strings.EqualFold(entry, name)
+	}
+
+	parts := strings.Split(strings.TrimPrefix(entry, hashedHostPrefix), "|")
+	if len(parts) != 2 {
+		return false
+	}
+	salt, err := base64.StdEncoding.DecodeString(parts[0])
+	if err != nil {
+		return false
+	}
+	want, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha1.New, salt)
+	mac.Write([]byte(name))
+	return hmac.Equal(mac.Sum(nil), want)
+}
@@ -0,0 +1,132 @@
+package ssh
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// newHostKey generates a public key to record in a known_hosts file
+func newHostKey(t *testing.T) ssh.PublicKey {
+	t.Helper()
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	key, err := ssh.NewPublicKey(pub)
+	require.NoError(t, err)
+	return key
+}
+
+func TestKnownHostsAddListRemove(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ssh", "known_hosts")
+	hosts, err := ListKnownHosts(path)
+	require.NoError(t, err)
+	assert.Empty(t, hosts)
+
+	keyA, keyB := newHostKey(t), newHostKey(t)
+	require.NoError(t, AddKnownHost(path, "203.0.113.1:22", keyA))
+	require.NoError(t, AddKnownHost(path, "203.0.113.2:2222", keyB))
+
+	hosts, err = ListKnownHosts(path)
+	require.NoError(t, err)
+	require.Len(t, hosts, 2)
+	assert.Equal(t, []string{"203.0.113.1"}, hosts[0].Hosts)
+	assert.Equal(t, ssh.FingerprintSHA256(keyA), hosts[0].Fingerprint)
+	assert.Equal(t, []string{"[203.0.113.2]:2222"}, hosts[1].Hosts)
+	assert.Equal(t, 2, hosts[1].Line)
+
+	// The port must match too
+	removed, err := RemoveKnownHost(path, "203.0.113.2")
+	require.NoError(t, err)
+	assert.Zero(t, removed)
+
+	removed, err = RemoveKnownHost(path, "203.0.113.2:2222")
+	require.NoError(t, err)
+	assert.Equal(t, 1, removed)
+
+	hosts, err = ListKnownHosts(path)
+	require.NoError(t, err)
+	require.Len(t, hosts, 1)
+	assert.Equal(t, []string{"203.0.113.1"}, hosts[0].Hosts)
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+}
+
+func TestRemoveKnownHostKeepsOtherNamesAndComments(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "known_hosts")
+	key := newHostKey(t)
+	content := "# cloud servers\n" +
+		knownhosts.Line([]string{"cloud.example.com", "203.0.113.1"}, key) + " rebuilt 2026\n" +
+		"@cert-authority *.example.com " + strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key))) + "\n"
+	require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+
+	removed, err := RemoveKnownHost(path, "203.0.113.1")
+	require.NoError(t, err)
+	assert.Equal(t, 1, removed)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 3)
+	assert.Equal(t, "# cloud servers", lines[0])
+	assert.True(t, strings.HasPrefix(lines[1], "cloud.example.com ssh-ed25519 "))
+	assert.True(t, strings.HasSuffix(lines[1], " rebuilt 2026"))
+	assert.True(t, strings.HasPrefix(lines[2], "@cert-authority *.example.com "))
+}
+
+func TestHashKnownHosts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "known_hosts")
+	key := newHostKey(t)
+	require.NoError(t, AddKnownHost(path, "203.0.113.1:2222", key))
+	require.NoError(t, os.WriteFile(path, append(mustReadFile(t, path),
+		[]byte(knownhosts.Line([]string{"*.example.com"}, key)+"\n")...), 0600))
+
+	hashed, err := HashKnownHosts(path)
+	require.NoError(t, err)
+	assert.Equal(t, 1, hashed)
+
+	hosts, err := ListKnownHosts(path)
+	require.NoError(t, err)
+	require.Len(t, hosts, 2)
+	assert.True(t, hosts[0].Hashed())
+	assert.NotContains(t, string(mustReadFile(t, path)), "203.0.113.1")
+	assert.Equal(t, []string{"*.example.com"}, hosts[1].Hosts)
+
+	// Hashed entries still verify, and can still be removed by name
+	callback, err := knownhosts.New(path)
+	require.NoError(t, err)
+	assert.NoError(t, callback("203.0.113.1:2222", fakeAddr("203.0.113.1:2222"), key))
+
+	hashed, err = HashKnownHosts(path)
+	require.NoError(t, err)
+	assert.Zero(t, hashed)
+
+	removed, err := RemoveKnownHost(path, "203.0.113.1:2222")
+	require.NoError(t, err)
+	assert.Equal(t, 1, removed)
+	hosts, err = ListKnownHosts(path)
+	require.NoError(t, err)
+	assert.Len(t, hosts, 1)
+}
+
+// fakeAddr is a net.Addr for host key callbacks
+type fakeAddr string
+
+func (a fakeAddr) Network() string { return "tcp" }
+func (a fakeAddr) String() string  { return string(a) }
+
+func mustReadFile(t *testing.T, path string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return data
+}
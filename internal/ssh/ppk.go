@@ -0,0 +1,302 @@
+package ssh
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// ppkHeaderPrefix starts every PuTTY private key file
+const ppkHeaderPrefix = "PuTTY-User-Key-File-"
+
+// ErrPPKFormat is returned when an OpenSSH key was expected but a PuTTY key was found
+var ErrPPKFormat = errors.New("key is in PuTTY .ppk format")
+
+// ppkFile holds the fields of a parsed PuTTY private key file
+type ppkFile struct {
+	version     int
+	algorithm   string
+	encryption  string
+	comment     string
+	publicBlob  []byte
+	privateBlob []byte
+	mac         []byte
+}
+
+// IsPPK reports whether data looks like a PuTTY private key file
+func IsPPK(data []byte) bool {
+	return bytes.HasPrefix(bytes.TrimLeft(data, "\ufeff \t\r\n"), []byte(ppkHeaderPrefix))
+}
+
+// ParsePPK parses an unencrypted PuTTY private key file (format 2 or 3),
+// returning the private key and its comment
+func ParsePPK(data []byte) (crypto.PrivateKey, string, error) {
+	ppk, err := parsePPKFile(data)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if ppk.encryption != "none" {
+		return nil, "", fmt.Errorf("encrypted .ppk keys (%s) are not supported; remove the passphrase in PuTTYgen or convert with 'puttygen -O private-openssh'", ppk.encryption)
+	}
+
+	if err := ppk.verifyMAC(); err != nil {
+		return nil, "", err
+	}
+
+	key, err := ppk.privateKey()
+	if err != nil {
+		return nil, "", err
+	}
+
+	return key, ppk.comment, nil
+}
+
+// ConvertPPK converts a PuTTY private key file to an OpenSSH PEM private key.
+// If the key cannot be parsed natively (e.g. it is encrypted) and puttygen is
+// installed, puttygen is used instead.
+func ConvertPPK(data []byte) ([]byte, error) {
+	key, comment, err := ParsePPK(data)
+	if err == nil {
+		block, err := ssh.MarshalPrivateKey(key, comment)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal private key: %w", err)
+		}
+		return pem.EncodeToMemory(block), nil
+	}
+
+	if _, lookErr := exec.LookPath("puttygen"); lookErr != nil {
+		return nil, err
+	}
+
+	converted, puttygenErr := convertWithPuttygen(data)
+	if puttygenErr != nil {
+		return nil, fmt.Errorf("%v (puttygen fallback failed: %v)", err, puttygenErr)
+	}
+	return converted, nil
+}
+
+// convertWithPuttygen shells out to puttygen to convert a key to OpenSSH format
+func convertWithPuttygen(data []byte) ([]byte, error) {
+	dir, err := os.MkdirTemp("", "ssh-tunnel-ppk")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	in := filepath.Join(dir, "key.ppk")
+	out := filepath.Join(dir, "key")
+	if err := os.WriteFile(in, data, 0600); err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command("puttygen", in, "-O", "private-openssh", "-o", out)
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return nil, err
+	}
+
+	return os.ReadFile(out)
+}
+
+// parsePPKFile splits a PuTTY key file into its fields
+func parsePPKFile(data []byte) (*ppkFile, error) {
+	ppk := &ppkFile{}
+	scanner := bufio.NewScanner(bytes.NewReader(bytes.TrimLeft(data, "\ufeff \t\r\n")))
+
+	readBlob := func(countStr string) ([]byte, error) {
+		count, err := strconv.Atoi(strings.TrimSpace(countStr))
+		if err != nil || count < 0 {
+			return nil, fmt.Errorf("invalid .ppk line count %q", countStr)
+		}
+		var b64 strings.Builder
+		for i := 0; i < count; i++ {
+			if !scanner.Scan() {
+				return nil, fmt.Errorf("truncated .ppk file")
+			}
+			b64.WriteString(strings.TrimSpace(scanner.Text()))
+		}
+		return base64.StdEncoding.DecodeString(b64.String())
+	}
+
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, ": ")
+		if !ok {
+			return nil, fmt.Errorf("malformed .ppk line %q", line)
+		}
+
+		var err error
+		switch {
+		case strings.HasPrefix(key, ppkHeaderPrefix):
+			ppk.version, err = strconv.Atoi(strings.TrimPrefix(key, ppkHeaderPrefix))
+			if err != nil || (ppk.version != 2 && ppk.version != 3) {
+				return nil, fmt.Errorf("unsupported .ppk version %q", key)
+			}
+			ppk.algorithm = value
+		case key == "Encryption":
+			ppk.encryption = value
+		case key == "Comment":
+			ppk.comment = value
+		case key == "Public-Lines":
+			ppk.publicBlob, err = readBlob(value)
+		case key == "Private-Lines":
+			ppk.privateBlob, err = readBlob(value)
+		case key == "Private-MAC":
+			ppk.mac, err = hex.DecodeString(value)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse .ppk field %s: %w", key, err)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if ppk.version == 0 || ppk.publicBlob == nil || ppk.privateBlob == nil {
+		return nil, fmt.Errorf("incomplete .ppk file")
+	}
+
+	return ppk, nil
+}
+
+// verifyMAC checks the integrity MAC of an unencrypted key file
+func (ppk *ppkFile) verifyMAC() error {
+	var mac hash.Hash
+	switch ppk.version {
+	case 2:
+		macKey := sha1.Sum([]byte("putty-private-key-file-mac-key"))
+		mac = hmac.New(sha1.New, macKey[:])
+	case 3:
+		mac = hmac.New(sha256.New, nil)
+	}
+
+	for _, field := range [][]byte{
+		[]byte(ppk.algorithm),
+		[]byte(ppk.encryption),
+		[]byte(ppk.comment),
+		ppk.publicBlob,
+		ppk.privateBlob,
+	} {
+		var length [4]byte
+		binary.BigEndian.PutUint32(length[:], uint32(len(field)))
+		mac.Write(length[:])
+		mac.Write(field)
+	}
+
+	if !hmac.Equal(mac.Sum(nil), ppk.mac) {
+		return fmt.Errorf(".ppk file MAC verification failed; the key may be corrupted")
+	}
+	return nil
+}
+
+// privateKey decodes the key material for the file's algorithm
+func (ppk *ppkFile) privateKey() (crypto.PrivateKey, error) {
+	pubKey, err := ssh.ParsePublicKey(ppk.publicBlob)
+	if err != nil {
+		return nil, fmt.Errorf("invalid .ppk public key: %w", err)
+	}
+	if pubKey.Type() != ppk.algorithm {
+		return nil, fmt.Errorf(".ppk public key type %q does not match header %q", pubKey.Type(), ppk.algorithm)
+	}
+	cryptoPub := pubKey.(ssh.CryptoPublicKey).CryptoPublicKey()
+
+	priv := &ppkReader{data: ppk.privateBlob}
+
+	switch pub := cryptoPub.(type) {
+	case ed25519.PublicKey:
+		seed := priv.readString()
+		if priv.err != nil || len(seed) != ed25519.SeedSize {
+			return nil, fmt.Errorf("malformed ed25519 .ppk key")
+		}
+		key := ed25519.NewKeyFromSeed(seed)
+		if !pub.Equal(key.Public()) {
+			return nil, fmt.Errorf(".ppk private key does not match its public key")
+		}
+		return key, nil
+
+	case *rsa.PublicKey:
+		d := priv.readMPInt()
+		p := priv.readMPInt()
+		q := priv.readMPInt()
+		if priv.err != nil {
+			return nil, fmt.Errorf("malformed RSA .ppk key")
+		}
+		key := &rsa.PrivateKey{
+			PublicKey: *pub,
+			D:         d,
+			Primes:    []*big.Int{p, q},
+		}
+		if err := key.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid RSA .ppk key: %w", err)
+		}
+		key.Precompute()
+		return key, nil
+
+	case *ecdsa.PublicKey:
+		d := priv.readMPInt()
+		if priv.err != nil {
+			return nil, fmt.Errorf("malformed ECDSA .ppk key")
+		}
+		return &ecdsa.PrivateKey{PublicKey: *pub, D: d}, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported .ppk key type %q", ppk.algorithm)
+	}
+}
+
+// ppkReader reads SSH wire-format fields from a key blob
+type ppkReader struct {
+	data []byte
+	err  error
+}
+
+// readString reads a uint32 length-prefixed byte string
+func (r *ppkReader) readString() []byte {
+	if r.err != nil {
+		return nil
+	}
+	if len(r.data) < 4 {
+		r.err = fmt.Errorf("unexpected end of key data")
+		return nil
+	}
+	length := binary.BigEndian.Uint32(r.data)
+	if uint32(len(r.data)-4) < length {
+		r.err = fmt.Errorf("unexpected end of key data")
+		return nil
+	}
+	value := r.data[4 : 4+length]
+	r.data = r.data[4+length:]
+	return value
+}
+
+// readMPInt reads an SSH multiple-precision integer
+func (r *ppkReader) readMPInt() *big.Int {
+	return new(big.Int).SetBytes(r.readString())
+}
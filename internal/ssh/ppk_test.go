@@ -0,0 +1,61 @@
+package ssh
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestParsePPK(t *testing.T) {
+	for _, name := range []string{"ed25519.ppk", "rsa.ppk"} {
+		t.Run(name, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("testdata", name))
+			require.NoError(t, err)
+			require.True(t, IsPPK(data))
+
+			key, comment, err := ParsePPK(data)
+			require.NoError(t, err)
+			assert.NotEmpty(t, comment)
+
+			signer, err := ssh.NewSignerFromKey(key)
+			require.NoError(t, err)
+
+			expected, err := os.ReadFile(filepath.Join("testdata", name+".pub"))
+			require.NoError(t, err)
+			assert.Equal(t, string(expected), string(ssh.MarshalAuthorizedKey(signer.PublicKey())))
+		})
+	}
+}
+
+func TestParsePPKRejectsCorruptedMAC(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "ed25519.ppk"))
+	require.NoError(t, err)
+
+	corrupted := bytes.Replace(data, []byte("Comment: "), []byte("Comment: tampered-"), 1)
+	_, _, err = ParsePPK(corrupted)
+	assert.ErrorContains(t, err, "MAC verification failed")
+}
+
+func TestImportPrivateKeyConvertsPPK(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "ed25519.ppk"))
+	require.NoError(t, err)
+
+	km := NewKeyManager()
+	ppkPath := filepath.Join("testdata", "ed25519.ppk")
+	assert.ErrorIs(t, km.ValidateKey(ppkPath), ErrPPKFormat)
+
+	keyPath := filepath.Join(t.TempDir(), "imported_key")
+	require.NoError(t, km.ImportPrivateKey(data, keyPath))
+	require.NoError(t, km.ValidateKey(keyPath))
+
+	expected, err := os.ReadFile(ppkPath + ".pub")
+	require.NoError(t, err)
+	actual, err := os.ReadFile(keyPath + ".pub")
+	require.NoError(t, err)
+	assert.Equal(t, string(expected), string(actual))
+}
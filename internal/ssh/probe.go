@@ -0,0 +1,122 @@
+package ssh
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Commands ProbeRemote runs to identify the remote account and platform. The
+// POSIX command brackets its answers with probeSentinel lines, so text a
+// login shell prints around them is skipped. The Windows command is only
+// tried when the POSIX one fails to run.
+const (
+	probeSentinel       = "--ssh-tunnel-probe--"
+	probeCommand        = "echo " + probeSentinel + " && id -un && uname -a && echo " + probeSentinel
+	probeWindowsCommand = "whoami"
+)
+
+// RemoteInfo describes the account and platform an SSH connection logs in
+// to
+type RemoteInfo struct {
+	// User is the account the server authenticated, e.g. "ubuntu" or
+	// "host\user" on Windows
+	User string
+	// OS is the output of uname -a, "Windows", or empty if the platform
+	// could not be told
+	OS string
+}
+
+// String describes the account and platform, e.g. "ubuntu on Linux ..."
+func (info RemoteInfo) String() string {
+	if info.OS == "" {
+		return info.User
+	}
+	return fmt.Sprintf("%s on %s", info.User, info.OS)
+}
+
+// LoggedInAs reports whether the remote account is name. The domain of a
+// Windows account is ignored, as is case, which Windows does not regard.
+func (info RemoteInfo) LoggedInAs(name string) bool {
+	if info.OS == "Windows" {
+		account := info.User[strings.LastIndex(info.User, `\`)+1:]
+		return strings.EqualFold(account, name)
+	}
+	return info.User == name
+}
+
+// ProbeRemote tests an SSH connection like TestConnection, and reports the
+// user the server authenticated and its operating system. This confirms the
+// key logs in to the intended account, and shows the remote platform.
+func (km *KeyManager) ProbeRemote(host, user, keyPath string, port int) (RemoteInfo, error) {
+	return km.ProbeRemoteContext(context.Background(), host, user, keyPath, port)
+}
+
+// ProbeRemoteContext is ProbeRemote, giving up when ctx is cancelled
+func (km *KeyManager) ProbeRemoteContext(ctx context.Context, host, user, keyPath string, port int) (RemoteInfo, error) {
+	client, err := km.connect(ctx, host, user, keyPath, port, DefaultConnectTimeout)
+	if err != nil {
+		return RemoteInfo{}, err
+	}
+	defer client.Close()
+
+	return probeClient(client)
+}
+
+// probeClient identifies the account and platform of a connected client
+func probeClient(client *ssh.Client) (RemoteInfo, error) {
+	output, err := runRemote(client, probeCommand)
+	if err == nil {
+		return parseProbe(output)
+	}
+
+	// Windows' OpenSSH runs commands in cmd.exe or PowerShell, which have
+	// neither id nor uname
+	output, winErr := runRemote(client, probeWindowsCommand)
+	if winErr != nil {
+		return RemoteInfo{}, fmt.Errorf("failed to execute test command: %w", err)
+	}
+	info := RemoteInfo{User: strings.TrimSpace(string(output))}
+	if strings.Contains(info.User, `\`) {
+		// Only Windows' whoami names the account as domain\user
+		info.OS = "Windows"
+	}
+	return info, nil
+}
+
+// parseProbe reads the user and platform from the output of probeCommand
+func parseProbe(output []byte) (RemoteInfo, error) {
+	var answers []string
+	inside := false
+	for _, line := range strings.Split(string(output), "\n") {
+		line = strings.TrimSpace(line)
+		if line == probeSentinel {
+			if inside {
+				break
+			}
+			inside = true
+			continue
+		}
+		if inside {
+			answers = append(answers, line)
+		}
+	}
+
+	if len(answers) != 2 || answers[0] == "" {
+		return RemoteInfo{}, fmt.Errorf("unexpected output from test command: %q", output)
+	}
+	return RemoteInfo{User: answers[0], OS: answers[1]}, nil
+}
+
+// runRemote runs a command in a new session and returns its output
+func runRemote(client *ssh.Client, command string) ([]byte, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create SSH session: %w", err)
+	}
+	defer session.Close()
+
+	return session.Output(command)
+}
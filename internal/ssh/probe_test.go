@@ -0,0 +1,185 @@
+package ssh
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+// startExecServer runs an SSH server whose sessions answer exec requests
+// with fixed output. Commands missing from outputs exit with status 127,
+// as from a shell that does not know them.
+func startExecServer(t *testing.T, outputs map[string]string) int {
+	t.Helper()
+	return startCommandServer(t, func(command string) (string, bool) {
+		output, ok := outputs[command]
+		return output, ok
+	})
+}
+
+// startCommandServer runs an SSH server whose sessions answer exec requests
+// with the output of run. Commands run does not know exit with status 127.
+func startCommandServer(t *testing.T, run func(command string) (string, bool)) int {
+	t.Helper()
+
+	_, privKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(privKey)
+	require.NoError(t, err)
+
+	serverConfig := &ssh.ServerConfig{NoClientAuth: true}
+	serverConfig.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				sshConn, chans, reqs, err := ssh.NewServerConn(conn, serverConfig)
+				if err != nil {
+					return
+				}
+				defer sshConn.Close()
+				go ssh.DiscardRequests(reqs)
+				for newChannel := range chans {
+					channel, requests, err := newChannel.Accept()
+					if err != nil {
+						continue
+					}
+					go serveExec(channel, requests, run)
+				}
+			}()
+		}
+	}()
+
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+// serveExec answers a session's exec request with the output of run
+func serveExec(channel ssh.Channel, requests <-chan *ssh.Request, run func(command string) (string, bool)) {
+	defer channel.Close()
+	for req := range requests {
+		if req.Type != "exec" {
+			req.Reply(false, nil)
+			continue
+		}
+		var exec struct{ Command string }
+		if err := ssh.Unmarshal(req.Payload, &exec); err != nil {
+			req.Reply(false, nil)
+			return
+		}
+		req.Reply(true, nil)
+
+		status := uint32(0)
+		if output, ok := run(exec.Command); ok {
+			channel.Write([]byte(output))
+		} else {
+			channel.Stderr().Write([]byte("command not found\n"))
+			status = 127
+		}
+		channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+		return
+	}
+}
+
+func newProbeKeyManager(t *testing.T) (*KeyManager, string) {
+	t.Helper()
+	keyPath := filepath.Join(t.TempDir(), "id_ed25519")
+	km := NewKeyManager()
+	require.NoError(t, km.GenerateKeyPair("ed25519", keyPath, ""))
+	km.SetInsecureSkipHostKeyCheck(true)
+	return km, keyPath
+}
+
+func TestProbeRemoteReportsUserAndOS(t *testing.T) {
+	port := startExecServer(t, map[string]string{
+		// A login shell printing a banner around the answers
+		probeCommand: "Welcome to cloud-1\n" + probeSentinel + "\nubuntu\nLinux cloud-1 5.15.0-91-generic #101-Ubuntu SMP x86_64 GNU/Linux\n" + probeSentinel + "\nLast login: today\n",
+	})
+	km, keyPath := newProbeKeyManager(t)
+
+	info, err := km.ProbeRemote("127.0.0.1", "ubuntu", keyPath, port)
+	require.NoError(t, err)
+	assert.Equal(t, RemoteInfo{User: "ubuntu", OS: "Linux cloud-1 5.15.0-91-generic #101-Ubuntu SMP x86_64 GNU/Linux"}, info)
+	assert.Equal(t, "ubuntu on Linux cloud-1 5.15.0-91-generic #101-Ubuntu SMP x86_64 GNU/Linux", info.String())
+}
+
+func TestProbeRemoteFallsBackToWhoamiOnWindows(t *testing.T) {
+	port := startExecServer(t, map[string]string{
+		probeWindowsCommand: "gateway\\tunnel\r\n",
+	})
+	km, keyPath := newProbeKeyManager(t)
+
+	info, err := km.ProbeRemote("127.0.0.1", "tunnel", keyPath, port)
+	require.NoError(t, err)
+	assert.Equal(t, RemoteInfo{User: "gateway\\tunnel", OS: "Windows"}, info)
+	assert.True(t, info.LoggedInAs("Tunnel"))
+	assert.False(t, RemoteInfo{User: "root", OS: "Linux"}.LoggedInAs("tunnel"))
+}
+
+func TestProbeRemoteFailsWhenNoCommandRuns(t *testing.T) {
+	port := startExecServer(t, nil)
+	km, keyPath := newProbeKeyManager(t)
+
+	_, err := km.ProbeRemote("127.0.0.1", "tunnel", keyPath, port)
+	assert.ErrorContains(t, err, "failed to execute test command")
+}
+
+func TestProbeRemoteLeavesOSUnknownWithoutWindowsAccount(t *testing.T) {
+	port := startExecServer(t, map[string]string{
+		probeWindowsCommand: "tunnel\n",
+	})
+	km, keyPath := newProbeKeyManager(t)
+
+	info, err := km.ProbeRemote("127.0.0.1", "tunnel", keyPath, port)
+	require.NoError(t, err)
+	assert.Equal(t, RemoteInfo{User: "tunnel"}, info)
+	assert.Equal(t, "tunnel", info.String())
+	assert.True(t, info.LoggedInAs("tunnel"))
+}
+
+func TestProbeRemoteRejectsUnexpectedOutput(t *testing.T) {
+	// The POSIX command ran, so whoami is not tried in its place
+	port := startExecServer(t, map[string]string{
+		probeCommand:        "ubuntu\n",
+		probeWindowsCommand: "gateway\\tunnel\r\n",
+	})
+	km, keyPath := newProbeKeyManager(t)
+
+	_, err := km.ProbeRemote("127.0.0.1", "ubuntu", keyPath, port)
+	assert.ErrorContains(t, err, "unexpected output from test command")
+}
+
+func TestConnectContextClosesClientOnCancel(t *testing.T) {
+	port := startExecServer(t, nil)
+	km, keyPath := newProbeKeyManager(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	client, err := km.ConnectContext(ctx, "127.0.0.1", "tunnel", keyPath, port)
+	require.NoError(t, err)
+	defer client.Close()
+
+	cancel()
+	assert.Eventually(t, func() bool {
+		_, err := client.NewSession()
+		return err != nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	_, err = km.ProbeRemoteContext(ctx, "127.0.0.1", "tunnel", keyPath, port)
+	assert.ErrorIs(t, err, context.Canceled)
+}
@@ -0,0 +1,116 @@
+package ssh
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// HostConfig holds the settings an OpenSSH client config file gives a host
+// that native connections use
+type HostConfig struct {
+	HostName     string
+	User         string
+	Port         int
+	IdentityFile string
+}
+
+// ReadHostConfig returns the settings the OpenSSH config file at path gives
+// host. As in ssh, the first value found for a keyword in a matching Host
+// block wins. Match blocks and Include directives are skipped, since
+// evaluating them needs ssh itself.
+func ReadHostConfig(path, host string) (HostConfig, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return HostConfig{}, fmt.Errorf("failed to open ssh config: %w", err)
+	}
+	defer file.Close()
+
+	var hc HostConfig
+	matching := true // settings before the first Host line apply to all hosts
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		keyword, value := splitConfigLine(scanner.Text())
+		if keyword == "" {
+			continue
+		}
+
+		switch keyword {
+		case "host":
+			matching = hostMatches(strings.Fields(value), host)
+			continue
+		case "match":
+			matching = false
+			continue
+		}
+		if !matching {
+			continue
+		}
+
+		switch keyword {
+		case "hostname":
+			if hc.HostName == "" {
+				hc.HostName = strings.ReplaceAll(value, "%h", host)
+			}
+		case "user":
+			if hc.User == "" {
+				hc.User = value
+			}
+		case "port":
+			if hc.Port == 0 {
+				port, err := strconv.Atoi(value)
+				if err != nil {
+					return HostConfig{}, fmt.Errorf("%s line %d: bad port %q", path, line, value)
+				}
+				hc.Port = port
+			}
+		case "identityfile":
+			if hc.IdentityFile == "" {
+				hc.IdentityFile = value
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return HostConfig{}, fmt.Errorf("failed to read ssh config: %w", err)
+	}
+
+	return hc, nil
+}
+
+// splitConfigLine splits an ssh config line into its lower-cased keyword and
+// value, accepting both "Keyword value" and "Keyword=value"
+func splitConfigLine(line string) (string, string) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", ""
+	}
+
+	end := strings.IndexAny(line, " \t=")
+	if end < 0 {
+		return strings.ToLower(line), ""
+	}
+	keyword := strings.ToLower(line[:end])
+	value := strings.TrimSpace(line[end:])
+	value = strings.TrimSpace(strings.TrimPrefix(value, "="))
+	return keyword, strings.Trim(value, `"`)
+}
+
+// hostMatches reports whether host matches a Host line's patterns: at least
+// one pattern must match and no negated (!) pattern may
+func hostMatches(patterns []string, host string) bool {
+	matched := false
+	for _, pattern := range patterns {
+		negated := strings.HasPrefix(pattern, "!")
+		pattern = strings.TrimPrefix(pattern, "!")
+		if ok, _ := path.Match(strings.ToLower(pattern), strings.ToLower(host)); ok {
+			if negated {
+				return false
+			}
+			matched = true
+		}
+	}
+	return matched
+}
@@ -0,0 +1,59 @@
+package ssh
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSSHConfig = `# personal hosts
+Host bastion
+    HostName bastion.example.com
+
+Host cloud *.cloud.example.com !skip.cloud.example.com
+    HostName %h.internal
+    User = ops
+    Port 2200
+
+Match exec "true"
+    User matched
+
+Host *
+    User fallback
+    IdentityFile "~/.ssh/id_ed25519"
+    Port 22
+`
+
+func TestReadHostConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ssh_config")
+	require.NoError(t, os.WriteFile(path, []byte(testSSHConfig), 0600))
+
+	tests := []struct {
+		host string
+		want HostConfig
+	}{
+		{"cloud", HostConfig{HostName: "cloud.internal", User: "ops", Port: 2200, IdentityFile: "~/.ssh/id_ed25519"}},
+		{"EU.cloud.example.com", HostConfig{HostName: "EU.cloud.example.com.internal", User: "ops", Port: 2200, IdentityFile: "~/.ssh/id_ed25519"}},
+		{"skip.cloud.example.com", HostConfig{User: "fallback", Port: 22, IdentityFile: "~/.ssh/id_ed25519"}},
+		{"bastion", HostConfig{HostName: "bastion.example.com", User: "fallback", Port: 22, IdentityFile: "~/.ssh/id_ed25519"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			hc, err := ReadHostConfig(path, tt.host)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, hc)
+		})
+	}
+}
+
+func TestReadHostConfigBadPort(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ssh_config")
+	require.NoError(t, os.WriteFile(path, []byte("Host *\n  Port ssh\n"), 0600))
+
+	_, err := ReadHostConfig(path, "cloud")
+	assert.ErrorContains(t, err, "line 2")
+}
@@ -2,10 +2,16 @@ package templates
 
 import (
 	"fmt"
+	"net"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"strconv"
 	"strings"
 	"text/template"
 
 	"github.com/lerndmina/SSH-Tunnel/internal/config"
+	"gopkg.in/yaml.v3"
 )
 
 // Template represents a configuration template
@@ -16,6 +22,17 @@ type Template struct {
 	Config      config.Config          `yaml:"config" json:"config"`
 	Variables   map[string]Variable    `yaml:"variables" json:"variables"`
 	Examples    map[string]interface{} `yaml:"examples" json:"examples"`
+	// Forwards are local forwards added to the configuration. Their fields
+	// are all rendered from templates, so ports may come from variables.
+	Forwards []Forward `yaml:"forwards,omitempty" json:"forwards,omitempty"`
+}
+
+// Forward is a templated local port forward (see config.ForwardConfig)
+type Forward struct {
+	BindAddr   string `yaml:"bind_addr,omitempty" json:"bind_addr,omitempty"`
+	LocalPort  string `yaml:"local_port" json:"local_port"`
+	RemoteHost string `yaml:"remote_host" json:"remote_host"`
+	RemotePort string `yaml:"remote_port" json:"remote_port"`
 }
 
 // Variable represents a template variable
@@ -27,6 +44,15 @@ type Variable struct {
 	Validation  string      `yaml:"validation,omitempty" json:"validation,omitempty"`
 }
 
+// keyTypeVariable is the key_type variable of the built-in templates: the
+// type of the keys generated for the tunnel (ssh.KeyTypes)
+var keyTypeVariable = Variable{
+	Description: "Type of SSH keys to generate (ed25519, ecdsa or rsa for older servers)",
+	Type:        "string",
+	Default:     "ed25519",
+	Validation:  "regex:ed25519|ecdsa|rsa",
+}
+
 // Manager manages configuration templates
 type Manager struct {
 	templates map[string]*Template
@@ -120,6 +146,7 @@ func (m *Manager) loadBuiltinTemplates() {
 				Default:     "~/.ssh/natted_server_key",
 				Required:    true,
 			},
+			"key_type": keyTypeVariable,
 		},
 		Examples: map[string]interface{}{
 			"tunnel_name":     "home-server",
@@ -208,6 +235,7 @@ func (m *Manager) loadBuiltinTemplates() {
 				Default:     "~/.ssh/natted_dev_key",
 				Required:    true,
 			},
+			"key_type": keyTypeVariable,
 		},
 		Examples: map[string]interface{}{
 			"tunnel_name":     "dev-server",
@@ -303,15 +331,18 @@ func (m *Manager) loadBuiltinTemplates() {
 				Default:     "~/.ssh/natted_prod_key",
 				Required:    true,
 			},
+			"key_type": keyTypeVariable,
 			"notification_email": {
 				Description: "Email address for alerts (optional)",
 				Type:        "string",
 				Required:    false,
+				Validation:  "email",
 			},
 			"webhook_url": {
 				Description: "Webhook URL for alerts (optional)",
 				Type:        "string",
 				Required:    false,
+				Validation:  "url",
 			},
 		},
 		Examples: map[string]interface{}{
@@ -402,6 +433,7 @@ func (m *Manager) loadBuiltinTemplates() {
 				Default:     "~/.ssh/natted_iot_key",
 				Required:    true,
 			},
+			"key_type": keyTypeVariable,
 		},
 		Examples: map[string]interface{}{
 			"tunnel_name":     "raspberry-pi-01",
@@ -413,6 +445,124 @@ func (m *Manager) loadBuiltinTemplates() {
 			"natted_key_path": "~/.ssh/natted_iot_key",
 		},
 	}
+
+	// Database Forward Template
+	m.templates["database-forward"] = &Template{
+		Name:        "database-forward",
+		Description: "Template for reaching a database behind the cloud server through a local port",
+		Category:    "development",
+		Config: config.Config{
+			TunnelName: "{{.tunnel_name}}",
+			CloudServer: config.CloudServerConfig{
+				IP:      "{{.cloud_ip}}",
+				Port:    22,
+				User:    "{{.cloud_user}}",
+				HomeDir: "{{.cloud_home}}",
+			},
+			LocalServer: config.LocalServerConfig{
+				User:        "{{.local_user}}",
+				ReversePort: 2226,
+			},
+			SSH: config.SSHConfig{
+				PrivateKeyPath: "{{.ssh_key_path}}",
+				NattedKeyPath:  "{{.natted_key_path}}",
+				Compression:    true,
+			},
+			Service: config.ServiceConfig{
+				Name:          "ssh-tunnel-db-{{.tunnel_name}}",
+				AutoReconnect: true,
+				RestartSec:    5,
+			},
+			Performance: config.PerformanceConfig{
+				KeepAliveInterval: 30,
+				KeepAliveCountMax: 3,
+				ConnectTimeout:    10,
+			},
+		},
+		Forwards: []Forward{
+			{
+				LocalPort:  "{{.local_port}}",
+				RemoteHost: "{{.db_host}}",
+				RemotePort: "{{.db_port}}",
+			},
+		},
+		Variables: map[string]Variable{
+			"tunnel_name": {
+				Description: "Name for this tunnel configuration",
+				Type:        "string",
+				Required:    true,
+			},
+			"cloud_ip": {
+				Description: "IP address of the cloud server that can reach the database",
+				Type:        "string",
+				Required:    true,
+				Validation:  "ip",
+			},
+			"cloud_user": {
+				Description: "Username on the cloud server",
+				Type:        "string",
+				Default:     "ubuntu",
+				Required:    true,
+			},
+			"cloud_home": {
+				Description: "Home directory on cloud server",
+				Type:        "string",
+				Default:     "/home/ubuntu",
+				Required:    true,
+			},
+			"local_user": {
+				Description: "Username on this local machine",
+				Type:        "string",
+				Required:    true,
+			},
+			"ssh_key_path": {
+				Description: "Path to SSH private key for cloud server",
+				Type:        "string",
+				Default:     "~/.ssh/cloud_server_key",
+				Required:    true,
+			},
+			"natted_key_path": {
+				Description: "Path to SSH key for reverse connection",
+				Type:        "string",
+				Default:     "~/.ssh/natted_server_key",
+				Required:    true,
+			},
+			"key_type": keyTypeVariable,
+			"db_host": {
+				Description: "Database host, as seen from the cloud server",
+				Type:        "string",
+				Default:     "localhost",
+				Required:    true,
+				Validation:  "hostname",
+			},
+			"db_port": {
+				Description: "Database port",
+				Type:        "int",
+				Default:     5432,
+				Required:    true,
+				Validation:  "port",
+			},
+			"local_port": {
+				Description: "Local port to reach the database on",
+				Type:        "int",
+				Default:     5432,
+				Required:    true,
+				Validation:  "port",
+			},
+		},
+		Examples: map[string]interface{}{
+			"tunnel_name":     "prod-db",
+			"cloud_ip":        "203.0.113.10",
+			"cloud_user":      "ubuntu",
+			"cloud_home":      "/home/ubuntu",
+			"local_user":      "dev",
+			"ssh_key_path":    "~/.ssh/cloud_server_key",
+			"natted_key_path": "~/.ssh/natted_server_key",
+			"db_host":         "db.internal",
+			"db_port":         5432,
+			"local_port":      15432,
+		},
+	}
 }
 
 // List returns all available template names
@@ -458,8 +608,26 @@ func (m *Manager) GetCategories() []string {
 	return result
 }
 
+// ApplyOptions adjust how a template is applied
+type ApplyOptions struct {
+	// PortRange, if set, replaces the template's reverse port with the
+	// lowest port in the range that is not in UsedPorts. Templates can take
+	// further ports from the range with {{ nextPort }}.
+	PortRange *PortRange
+	// UsedPorts are ports already taken, e.g. the reverse and local forward
+	// ports of existing tunnels. The template's own fixed local forward ports
+	// are added to them.
+	UsedPorts []int
+}
+
 // Apply applies a template with the given variables to create a configuration
 func (m *Manager) Apply(templateName string, variables map[string]interface{}) (*config.Config, error) {
+	return m.ApplyWithOptions(templateName, variables, ApplyOptions{})
+}
+
+// ApplyWithOptions applies a template like Apply, assigning ports as opts
+// describe
+func (m *Manager) ApplyWithOptions(templateName string, variables map[string]interface{}, opts ApplyOptions) (*config.Config, error) {
 	tmpl, err := m.Get(templateName)
 	if err != nil {
 		return nil, err
@@ -470,11 +638,23 @@ func (m *Manager) Apply(templateName string, variables map[string]interface{}) (
 		return nil, err
 	}
 
+	// The reverse port is assigned first, so it gets the lowest free port
+	ports := newPortAllocator(opts.PortRange, append(fixedForwardPorts(tmpl), opts.UsedPorts...))
+	reversePort := 0
+	if opts.PortRange != nil {
+		if reversePort, err = ports.next(); err != nil {
+			return nil, err
+		}
+	}
+
 	// Apply template rendering
-	renderedConfig, err := m.renderTemplate(tmpl, variables)
+	renderedConfig, err := m.renderTemplate(tmpl, variables, ports)
 	if err != nil {
 		return nil, fmt.Errorf("failed to render template: %w", err)
 	}
+	if reversePort != 0 {
+		renderedConfig.LocalServer.ReversePort = reversePort
+	}
 
 	return renderedConfig, nil
 }
@@ -484,22 +664,32 @@ func (m *Manager) validateVariables(tmpl *Template, variables map[string]interfa
 	for varName, varDef := range tmpl.Variables {
 		value, exists := variables[varName]
 
-		if varDef.Required && !exists {
+		if varDef.Required && !exists && varDef.Default == nil {
 			return fmt.Errorf("required variable '%s' is missing", varName)
 		}
 
 		if !exists && varDef.Default != nil {
 			variables[varName] = varDef.Default
+		} else if !exists {
+			// Optional variables without a default render empty
+			variables[varName] = ""
 		}
 
 		if exists {
+			// Values from the command line arrive as strings
+			value, err := coerceVariable(varName, value, varDef.Type)
+			if err != nil {
+				return err
+			}
+			variables[varName] = value
+
 			// Type validation
 			if err := m.validateVariableType(varName, value, varDef.Type); err != nil {
 				return err
 			}
 
-			// Additional validation
-			if varDef.Validation != "" {
+			// Additional validation; optional variables may be left empty
+			if varDef.Validation != "" && (varDef.Required || value != "") {
 				if err := m.validateVariableValue(varName, value, varDef.Validation); err != nil {
 					return err
 				}
@@ -510,6 +700,31 @@ func (m *Manager) validateVariables(tmpl *Template, variables map[string]interfa
 	return nil
 }
 
+// coerceVariable converts a string value to the variable's declared int or
+// bool type. Other values are returned unchanged.
+func coerceVariable(name string, value interface{}, varType string) (interface{}, error) {
+	str, ok := value.(string)
+	if !ok {
+		return value, nil
+	}
+
+	switch varType {
+	case "int":
+		n, err := strconv.Atoi(strings.TrimSpace(str))
+		if err != nil {
+			return nil, fmt.Errorf("variable '%s' must be an integer, got %q", name, str)
+		}
+		return n, nil
+	case "bool":
+		b, err := strconv.ParseBool(strings.TrimSpace(str))
+		if err != nil {
+			return nil, fmt.Errorf("variable '%s' must be true or false, got %q", name, str)
+		}
+		return b, nil
+	}
+	return value, nil
+}
+
 // validateVariableType validates the type of a variable
 func (m *Manager) validateVariableType(name string, value interface{}, expectedType string) error {
 	switch expectedType {
@@ -529,98 +744,177 @@ func (m *Manager) validateVariableType(name string, value interface{}, expectedT
 	return nil
 }
 
-// validateVariableValue validates the value of a variable based on validation rules
+// validateVariableValue validates the value of a variable against a
+// validation rule: ip, port, hostname, email, url or regex:<pattern>. A
+// regex must match the whole value.
 func (m *Manager) validateVariableValue(name string, value interface{}, validation string) error {
-	str, ok := value.(string)
-	if !ok {
-		return nil // Only validate string values for now
-	}
+	str := fmt.Sprint(value)
+	rule, pattern, _ := strings.Cut(validation, ":")
 
-	switch validation {
+	switch rule {
 	case "ip":
-		// Simple IP validation
-		parts := strings.Split(str, ".")
-		if len(parts) != 4 {
+		if net.ParseIP(str) == nil {
 			return fmt.Errorf("variable '%s' must be a valid IP address", name)
 		}
-		// Could add more sophisticated IP validation here
+	case "port":
+		if port, err := strconv.Atoi(str); err != nil || port < 1 || port > 65535 {
+			return fmt.Errorf("variable '%s' must be a port number (1-65535)", name)
+		}
+	case "hostname":
+		if !validHostname(str) {
+			return fmt.Errorf("variable '%s' must be a valid hostname", name)
+		}
+	case "email":
+		if addr, err := mail.ParseAddress(str); err != nil || addr.Address != str {
+			return fmt.Errorf("variable '%s' must be a valid email address", name)
+		}
+	case "url":
+		if u, err := url.Parse(str); err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("variable '%s' must be a valid URL", name)
+		}
+	case "regex":
+		re, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return fmt.Errorf("variable '%s' has an invalid validation pattern: %w", name, err)
+		}
+		if !re.MatchString(str) {
+			return fmt.Errorf("variable '%s' must match %s", name, pattern)
+		}
+	default:
+		return fmt.Errorf("variable '%s' has unknown validation rule %q", name, validation)
 	}
 
 	return nil
 }
 
-// renderTemplate renders the configuration template with variables
-func (m *Manager) renderTemplate(tmpl *Template, variables map[string]interface{}) (*config.Config, error) {
-	// Convert config to JSON string for template processing
-	configStr := m.configToTemplateString(&tmpl.Config)
+// validHostname reports whether s is a valid DNS hostname (RFC 1123)
+func validHostname(s string) bool {
+	s = strings.TrimSuffix(s, ".")
+	if s == "" || len(s) > 253 {
+		return false
+	}
+
+	for _, label := range strings.Split(s, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// fixedForwardPorts returns the local forward ports a template sets without
+// templating them, which assigned ports must not collide with
+func fixedForwardPorts(tmpl *Template) []int {
+	var ports []int
+	for _, forward := range tmpl.Config.LocalServer.LocalForwards {
+		if forward.LocalPort != 0 {
+			ports = append(ports, forward.LocalPort)
+		}
+	}
+	for _, forward := range tmpl.Forwards {
+		if port, err := strconv.Atoi(strings.TrimSpace(forward.LocalPort)); err == nil {
+			ports = append(ports, port)
+		}
+	}
+	return ports
+}
+
+// renderTemplate renders the configuration template with variables. Each
+// string value of the template's configuration is rendered on its own, so
+// rendered values never need quoting to survive the trip back to a Config.
+// {{ nextPort }} takes a port from ports.
+func (m *Manager) renderTemplate(tmpl *Template, variables map[string]interface{}, ports *portAllocator) (*config.Config, error) {
+	var doc yaml.Node
+	if err := doc.Encode(&tmpl.Config); err != nil {
+		return nil, fmt.Errorf("failed to encode template config: %w", err)
+	}
 
-	// Create template
-	t, err := template.New("config").Parse(configStr)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse template: %w", err)
+	if len(tmpl.Forwards) > 0 {
+		if err := addForwards(&doc, tmpl.Forwards); err != nil {
+			return nil, err
+		}
 	}
 
-	// Render template
-	var rendered strings.Builder
-	if err := t.Execute(&rendered, variables); err != nil {
-		return nil, fmt.Errorf("failed to execute template: %w", err)
+	funcs := template.FuncMap{"nextPort": ports.next}
+	if err := renderNode(&doc, variables, funcs); err != nil {
+		return nil, err
 	}
 
-	// Parse back to config
-	renderedConfig, err := m.templateStringToConfig(rendered.String())
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse rendered config: %w", err)
+	var rendered config.Config
+	if err := doc.Decode(&rendered); err != nil {
+		return nil, fmt.Errorf("failed to decode rendered config: %w", err)
 	}
 
-	return renderedConfig, nil
+	return &rendered, nil
 }
 
-// configToTemplateString converts config to a template string
-// This is a simplified version - in a real implementation, you might use JSON or YAML
-func (m *Manager) configToTemplateString(cfg *config.Config) string {
-	// This is a basic implementation - you would want to use proper serialization
-	return fmt.Sprintf(`{
-		"tunnel_name": "%s",
-		"cloud_server": {
-			"ip": "%s",
-			"port": %d,
-			"user": "%s",
-			"home_dir": "%s"
-		},
-		"local_server": {
-			"user": "%s",
-			"reverse_port": %d,
-			"socks_port": %d
-		},
-		"ssh": {
-			"private_key_path": "%s",
-			"natted_key_path": "%s",
-			"compression": %t,
-			"ciphers": "%s"
-		},
-		"service": {
-			"name": "%s",
-			"auto_reconnect": %t,
-			"restart_sec": %d
-		},
-		"performance": {
-			"keep_alive_interval": %d,
-			"keep_alive_count_max": %d,
-			"connect_timeout": %d
+// addForwards adds templated forwards to the local_forwards of an encoded
+// configuration
+func addForwards(doc *yaml.Node, forwards []Forward) error {
+	var node yaml.Node
+	if err := node.Encode(forwards); err != nil {
+		return fmt.Errorf("failed to encode template forwards: %w", err)
+	}
+	// Forward fields are strings only so they can hold templates; literal
+	// ports must still decode into the int fields of the configuration
+	for _, item := range node.Content {
+		for _, field := range item.Content {
+			field.Tag = ""
+			field.Style = 0
+		}
+	}
+
+	for i := 0; i+1 < len(doc.Content); i += 2 {
+		if doc.Content[i].Value != "local_server" {
+			continue
 		}
-	}`,
-		cfg.TunnelName,
-		cfg.CloudServer.IP, cfg.CloudServer.Port, cfg.CloudServer.User, cfg.CloudServer.HomeDir,
-		cfg.LocalServer.User, cfg.LocalServer.ReversePort, cfg.LocalServer.SOCKSPort,
-		cfg.SSH.PrivateKeyPath, cfg.SSH.NattedKeyPath, cfg.SSH.Compression, cfg.SSH.Ciphers,
-		cfg.Service.Name, cfg.Service.AutoReconnect, cfg.Service.RestartSec,
-		cfg.Performance.KeepAliveInterval, cfg.Performance.KeepAliveCountMax, cfg.Performance.ConnectTimeout,
-	)
+		localServer := doc.Content[i+1]
+		for j := 0; j+1 < len(localServer.Content); j += 2 {
+			if localServer.Content[j].Value == "local_forwards" {
+				localServer.Content[j+1].Content = append(localServer.Content[j+1].Content, node.Content...)
+				return nil
+			}
+		}
+		localServer.Content = append(localServer.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Value: "local_forwards"}, &node)
+		return nil
+	}
+	return fmt.Errorf("template config has no local_server section")
 }
 
-// templateStringToConfig converts a template string back to config
-func (m *Manager) templateStringToConfig(str string) (*config.Config, error) {
-	// This is a placeholder - you would implement proper JSON/YAML parsing here
-	// For now, return a basic config
-	return &config.Config{}, nil
+// renderNode renders every templated scalar in a YAML node tree in place
+func renderNode(node *yaml.Node, variables map[string]interface{}, funcs template.FuncMap) error {
+	if node.Kind == yaml.ScalarNode {
+		if !strings.Contains(node.Value, "{{") {
+			return nil
+		}
+
+		t, err := template.New("config").Option("missingkey=error").Funcs(funcs).Parse(node.Value)
+		if err != nil {
+			return fmt.Errorf("failed to parse template %q: %w", node.Value, err)
+		}
+
+		var rendered strings.Builder
+		if err := t.Execute(&rendered, variables); err != nil {
+			return fmt.Errorf("failed to execute template %q: %w", node.Value, err)
+		}
+		// Resolve the result like a hand-written value, so that rendered
+		// numbers can fill int fields
+		node.Value = rendered.String()
+		node.Tag = ""
+		node.Style = 0
+		return nil
+	}
+
+	for _, child := range node.Content {
+		if err := renderNode(child, variables, funcs); err != nil {
+			return err
+		}
+	}
+	return nil
 }
@@ -0,0 +1,194 @@
+package templates
+
+import (
+	"testing"
+
+	"github.com/lerndmina/SSH-Tunnel/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyRendersVariables(t *testing.T) {
+	cfg, err := NewManager().Apply("home-server", map[string]interface{}{
+		"tunnel_name": "it's-home",
+		"cloud_ip":    "203.0.113.1",
+		"local_user":  "pi",
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "it's-home", cfg.TunnelName)
+	assert.Equal(t, "ssh-tunnel-it's-home", cfg.Service.Name)
+	assert.Equal(t, "203.0.113.1", cfg.CloudServer.IP)
+	assert.Equal(t, "/home/ubuntu", cfg.CloudServer.HomeDir)
+	assert.Equal(t, 2222, cfg.LocalServer.ReversePort)
+	assert.True(t, cfg.SSH.Compression)
+}
+
+func TestApplyRequiresVariables(t *testing.T) {
+	_, err := NewManager().Apply("home-server", map[string]interface{}{"tunnel_name": "home"})
+	assert.ErrorContains(t, err, "is missing")
+}
+
+// newTypedManager returns a template manager with a template taking int and
+// bool variables
+func newTypedManager() *Manager {
+	m := NewManager()
+	m.templates["typed"] = &Template{
+		Name: "typed",
+		Variables: map[string]Variable{
+			"port":     {Type: "int", Required: true},
+			"compress": {Type: "bool", Default: false},
+		},
+	}
+	return m
+}
+
+func TestApplyCoercesStringVariables(t *testing.T) {
+	variables := map[string]interface{}{"port": "8080", "compress": "true"}
+	_, err := newTypedManager().Apply("typed", variables)
+	require.NoError(t, err)
+
+	assert.Equal(t, 8080, variables["port"])
+	assert.Equal(t, true, variables["compress"])
+}
+
+func TestApplyRejectsUnparseableVariables(t *testing.T) {
+	_, err := newTypedManager().Apply("typed", map[string]interface{}{"port": "http"})
+	assert.ErrorContains(t, err, `variable 'port' must be an integer, got "http"`)
+
+	_, err = newTypedManager().Apply("typed", map[string]interface{}{"port": 22, "compress": "maybe"})
+	assert.ErrorContains(t, err, `variable 'compress' must be true or false, got "maybe"`)
+}
+
+func TestValidateVariableValue(t *testing.T) {
+	tests := []struct {
+		rule    string
+		valid   []interface{}
+		invalid []interface{}
+	}{
+		{"ip", []interface{}{"203.0.113.1", "2001:db8::1"}, []interface{}{"203.0.113", "1.2.3.256", "example.com"}},
+		{"port", []interface{}{"22", 8080, "65535"}, []interface{}{"0", 70000, "ssh", ""}},
+		{"hostname", []interface{}{"example.com", "vps-1.example.com.", "localhost"}, []interface{}{"-bad.example.com", "under_score.com", "a..b", ""}},
+		{"email", []interface{}{"alerts@company.com"}, []interface{}{"alerts", "Alerts <alerts@company.com>", "@company.com"}},
+		{"url", []interface{}{"https://hooks.slack.com/services/T000", "http://10.0.0.1:8080/hook"}, []interface{}{"hooks.slack.com", "https://", "::"}},
+		{"regex:[a-z]+-[0-9]+", []interface{}{"prod-1"}, []interface{}{"prod", "xprod-1x", "PROD-1"}},
+	}
+
+	m := NewManager()
+	for _, tt := range tests {
+		for _, value := range tt.valid {
+			assert.NoError(t, m.validateVariableValue("v", value, tt.rule), "%s %v", tt.rule, value)
+		}
+		for _, value := range tt.invalid {
+			assert.Error(t, m.validateVariableValue("v", value, tt.rule), "%s %v", tt.rule, value)
+		}
+	}
+}
+
+func TestValidateVariableValueBadRules(t *testing.T) {
+	m := NewManager()
+	assert.ErrorContains(t, m.validateVariableValue("v", "x", "regex:("), "invalid validation pattern")
+	assert.ErrorContains(t, m.validateVariableValue("v", "x", "phone"), `unknown validation rule "phone"`)
+}
+
+func TestProductionTemplateValidatesNotifications(t *testing.T) {
+	variables := func(extra map[string]interface{}) map[string]interface{} {
+		vars := map[string]interface{}{"tunnel_name": "prod", "cloud_ip": "203.0.113.100", "local_user": "ops"}
+		for k, v := range extra {
+			vars[k] = v
+		}
+		return vars
+	}
+
+	// The notification settings are optional
+	cfg, err := NewManager().Apply("production", variables(nil))
+	require.NoError(t, err)
+	assert.Empty(t, cfg.Notifications.Email)
+
+	_, err = NewManager().Apply("production", variables(map[string]interface{}{"notification_email": "not-an-email"}))
+	assert.ErrorContains(t, err, "valid email address")
+
+	_, err = NewManager().Apply("production", variables(map[string]interface{}{"webhook_url": "hooks.slack.com"}))
+	assert.ErrorContains(t, err, "valid URL")
+}
+
+func TestDatabaseForwardTemplate(t *testing.T) {
+	cfg, err := NewManager().Apply("database-forward", map[string]interface{}{
+		"tunnel_name": "prod-db",
+		"cloud_ip":    "203.0.113.10",
+		"local_user":  "dev",
+		"db_host":     "db.internal",
+		"local_port":  "15432",
+	})
+	require.NoError(t, err)
+
+	require.Len(t, cfg.LocalServer.LocalForwards, 1)
+	forward := cfg.LocalServer.LocalForwards[0]
+	assert.Equal(t, 15432, forward.LocalPort)
+	assert.Equal(t, "db.internal", forward.RemoteHost)
+	assert.Equal(t, 5432, forward.RemotePort)
+	assert.Empty(t, forward.BindAddr)
+	assert.Equal(t, "ssh-tunnel-db-prod-db", cfg.Service.Name)
+	assert.NoError(t, cfg.Validate())
+
+	_, err = NewManager().Apply("database-forward", map[string]interface{}{
+		"tunnel_name": "prod-db",
+		"cloud_ip":    "203.0.113.10",
+		"local_user":  "dev",
+		"db_port":     "99999",
+	})
+	assert.ErrorContains(t, err, "variable 'db_port' must be a port number")
+}
+
+func TestApplyForwardsWithLiteralPorts(t *testing.T) {
+	m := NewManager()
+	m.templates["literal"] = &Template{
+		Name:      "literal",
+		Config:    m.templates["home-server"].Config,
+		Variables: m.templates["home-server"].Variables,
+		Forwards:  []Forward{{LocalPort: "8080", RemoteHost: "{{ .tunnel_name }}.internal", RemotePort: "80"}},
+	}
+
+	cfg, err := m.Apply("literal", map[string]interface{}{"tunnel_name": "web", "cloud_ip": "203.0.113.1", "local_user": "pi"})
+	require.NoError(t, err)
+	require.Len(t, cfg.LocalServer.LocalForwards, 1)
+	assert.Equal(t, config.ForwardConfig{LocalPort: 8080, RemoteHost: "web.internal", RemotePort: 80}, cfg.LocalServer.LocalForwards[0])
+}
+
+func TestParsePortRange(t *testing.T) {
+	rng, err := ParsePortRange("2200-2299")
+	require.NoError(t, err)
+	assert.Equal(t, PortRange{First: 2200, Last: 2299}, rng)
+
+	for _, bad := range []string{"2200", "2299-2200", "0-10", "2200-70000", "a-b"} {
+		_, err := ParsePortRange(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestApplyNextPort(t *testing.T) {
+	m := NewManager()
+	m.templates["ports"] = &Template{
+		Name:      "ports",
+		Config:    m.templates["home-server"].Config,
+		Variables: m.templates["home-server"].Variables,
+		Forwards:  []Forward{{LocalPort: "{{ nextPort }}", RemoteHost: "localhost", RemotePort: "{{ .web_port }}"}},
+	}
+	m.templates["ports"].Config.LocalServer.LocalForwards = []config.ForwardConfig{{LocalPort: 2203, RemoteHost: "localhost", RemotePort: 22}}
+	variables := map[string]interface{}{"tunnel_name": "web", "cloud_ip": "203.0.113.1", "local_user": "pi", "web_port": "80"}
+
+	cfg, err := m.ApplyWithOptions("ports", variables, ApplyOptions{
+		PortRange: &PortRange{First: 2200, Last: 2299},
+		UsedPorts: []int{2200, 2202},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2201, cfg.LocalServer.ReversePort)
+	require.Len(t, cfg.LocalServer.LocalForwards, 2)
+	// The template's own forward keeps 2203, so nextPort skips it
+	assert.Equal(t, 2203, cfg.LocalServer.LocalForwards[0].LocalPort)
+	assert.Equal(t, 2204, cfg.LocalServer.LocalForwards[1].LocalPort)
+	assert.Equal(t, 80, cfg.LocalServer.LocalForwards[1].RemotePort)
+
+	_, err = m.Apply("ports", variables)
+	assert.ErrorContains(t, err, "nextPort needs a port range")
+}
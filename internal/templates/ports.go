@@ -0,0 +1,66 @@
+package templates
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// PortRange is an inclusive range of ports to assign reverse ports from
+type PortRange struct {
+	First int
+	Last  int
+}
+
+// ParsePortRange parses a range written as first-last, e.g. 2200-2299
+func ParsePortRange(s string) (PortRange, error) {
+	first, last, ok := strings.Cut(strings.TrimSpace(s), "-")
+	if !ok {
+		return PortRange{}, fmt.Errorf("invalid port range %q: expected first-last, e.g. 2200-2299", s)
+	}
+
+	var r PortRange
+	var err1, err2 error
+	r.First, err1 = strconv.Atoi(strings.TrimSpace(first))
+	r.Last, err2 = strconv.Atoi(strings.TrimSpace(last))
+	if err1 != nil || err2 != nil || r.First < 1 || r.Last > 65535 || r.First > r.Last {
+		return PortRange{}, fmt.Errorf("invalid port range %q: expected first-last within 1-65535", s)
+	}
+	return r, nil
+}
+
+// String formats the range as ParsePortRange reads it
+func (r PortRange) String() string {
+	return fmt.Sprintf("%d-%d", r.First, r.Last)
+}
+
+// portAllocator hands out the ports of a range that are not in use, lowest
+// first
+type portAllocator struct {
+	rng  *PortRange
+	used map[int]bool
+}
+
+// newPortAllocator creates an allocator for rng avoiding the used ports.
+// With a nil range every allocation fails.
+func newPortAllocator(rng *PortRange, used []int) *portAllocator {
+	a := &portAllocator{rng: rng, used: make(map[int]bool, len(used))}
+	for _, port := range used {
+		a.used[port] = true
+	}
+	return a
+}
+
+// next returns the lowest free port in the range and marks it used
+func (a *portAllocator) next() (int, error) {
+	if a.rng == nil {
+		return 0, fmt.Errorf("nextPort needs a port range")
+	}
+	for port := a.rng.First; port <= a.rng.Last; port++ {
+		if !a.used[port] {
+			a.used[port] = true
+			return port, nil
+		}
+	}
+	return 0, fmt.Errorf("no free port left in range %s", a.rng)
+}
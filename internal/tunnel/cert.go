@@ -0,0 +1,85 @@
+package tunnel
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/lerndmina/SSH-Tunnel/internal/config"
+	"github.com/lerndmina/SSH-Tunnel/pkg/logger"
+	"golang.org/x/crypto/ssh"
+)
+
+// DefaultCertRenewBefore is how long before its expiry a certificate is
+// renewed unless SSH.CertRenewBefore is set
+const DefaultCertRenewBefore = 10 * time.Minute
+
+// certRenewBefore returns how early a tunnel's certificate is renewed
+func certRenewBefore(cfg *config.Config) time.Duration {
+	if cfg.SSH.CertRenewBefore > 0 {
+		return cfg.SSH.CertRenewBefore
+	}
+	return DefaultCertRenewBefore
+}
+
+// certExpiry reads an OpenSSH certificate and returns the end of its
+// validity window. Certificates valid forever report the zero time.
+func certExpiry(path string) (time.Time, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	key, _, _, _, err := ssh.ParseAuthorizedKey(data)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to parse certificate %s: %w", path, err)
+	}
+	cert, ok := key.(*ssh.Certificate)
+	if !ok {
+		return time.Time{}, fmt.Errorf("%s is a public key, not a certificate", path)
+	}
+	if cert.ValidBefore == ssh.CertTimeInfinity {
+		return time.Time{}, nil
+	}
+	return time.Unix(int64(cert.ValidBefore), 0), nil
+}
+
+// certNeedsRenewal reports why a tunnel's certificate should be renewed at
+// now, or "" if it need not be. Certificates that are missing or cannot be
+// read are renewed too, since the renew command may well fix them.
+func certNeedsRenewal(cfg *config.Config, now time.Time) string {
+	if cfg.SSH.CertificatePath == "" || cfg.SSH.CertRenewCommand == "" {
+		return ""
+	}
+
+	expiry, err := certExpiry(config.ExpandPath(cfg.SSH.CertificatePath))
+	switch {
+	case err != nil:
+		return err.Error()
+	case expiry.IsZero():
+		return ""
+	case !now.Before(expiry):
+		return fmt.Sprintf("certificate expired at %s", expiry.Format(time.RFC3339))
+	case expiry.Sub(now) <= certRenewBefore(cfg):
+		return fmt.Sprintf("certificate expires at %s", expiry.Format(time.RFC3339))
+	}
+	return ""
+}
+
+// renewCertificate runs the tunnel's cert renew command if its certificate
+// is about to expire. It is called before each connection attempt.
+func renewCertificate(ctx context.Context, runner CommandRunner, cfg *config.Config) error {
+	reason := certNeedsRenewal(cfg, time.Now())
+	if reason == "" {
+		return nil
+	}
+
+	logger.Infof("Renewing certificate for tunnel '%s': %s", cfg.TunnelName, reason)
+	if output, err := runHookWith(ctx, runner, cfg, HookCertRenew, cfg.SSH.CertRenewCommand); err != nil {
+		if output != "" {
+			return fmt.Errorf("%w: %s", err, output)
+		}
+		return err
+	}
+	return nil
+}
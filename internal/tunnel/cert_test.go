@@ -0,0 +1,129 @@
+package tunnel
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lerndmina/SSH-Tunnel/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+// writeTestCert writes an OpenSSH user certificate valid until validBefore
+// and returns its path
+func writeTestCert(t *testing.T, validBefore uint64) string {
+	t.Helper()
+
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	_, caKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	key, err := ssh.NewPublicKey(pub)
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(caKey)
+	require.NoError(t, err)
+
+	cert := &ssh.Certificate{
+		Key:             key,
+		CertType:        ssh.UserCert,
+		ValidPrincipals: []string{"tunnel"},
+		ValidBefore:     validBefore,
+	}
+	require.NoError(t, cert.SignCert(rand.Reader, signer))
+
+	path := filepath.Join(t.TempDir(), "id_ed25519-cert.pub")
+	require.NoError(t, os.WriteFile(path, ssh.MarshalAuthorizedKey(cert), 0600))
+	return path
+}
+
+func TestCertNeedsRenewal(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name   string
+		path   string
+		renews bool
+	}{
+		{"valid for hours", writeTestCert(t, uint64(now.Add(8*time.Hour).Unix())), false},
+		{"expiring soon", writeTestCert(t, uint64(now.Add(time.Minute).Unix())), true},
+		{"expired", writeTestCert(t, uint64(now.Add(-time.Minute).Unix())), true},
+		{"valid forever", writeTestCert(t, ssh.CertTimeInfinity), false},
+		{"missing", filepath.Join(t.TempDir(), "missing-cert.pub"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig("home")
+			cfg.SSH.CertificatePath = tt.path
+			cfg.SSH.CertRenewCommand = "renew"
+			assert.Equal(t, tt.renews, certNeedsRenewal(cfg, now) != "")
+		})
+	}
+
+	// Without a renew command there is nothing to do
+	cfg := testConfig("home")
+	cfg.SSH.CertificatePath = tests[1].path
+	assert.Empty(t, certNeedsRenewal(cfg, now))
+}
+
+// orderRunner is a CommandRunner logging "renew" to a shared log
+type orderRunner struct {
+	log *[]string
+	mu  *sync.Mutex
+}
+
+func (r orderRunner) Run(ctx context.Context, command string, env []string) ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	*r.log = append(*r.log, "renew")
+	return nil, nil
+}
+
+func TestExpiringCertRenewedBeforeReconnect(t *testing.T) {
+	cfg := testConfig("certified")
+	cfg.SSH.CertificatePath = writeTestCert(t, uint64(time.Now().Add(time.Minute).Unix()))
+	cfg.SSH.CertRenewCommand = "step ssh certificate --force tunnel id_ed25519.pub"
+	m := newTestManager(t, cfg)
+	m.backoff = func(cfg *config.Config, attempt int) time.Duration {
+		return 10 * time.Millisecond
+	}
+
+	var mu sync.Mutex
+	var log []string
+	m.SetCommandRunner(orderRunner{log: &log, mu: &mu})
+	m.command = func(ctx context.Context, name string, args ...string) *exec.Cmd {
+		mu.Lock()
+		defer mu.Unlock()
+		// Drop the first connection, then stay up
+		log = append(log, "connect")
+		if len(log) <= 2 {
+			return helperCommand("flap")(ctx, name, args...)
+		}
+		return helperCommand("run")(ctx, name, args...)
+	}
+
+	require.NoError(t, m.Start("certified"))
+	t.Cleanup(func() { m.Stop("certified") })
+
+	waitForStatus(t, m, "certified", func(s *TunnelStatus) bool {
+		return s.Status == StatusRunning && s.ReconnectCount == 1
+	})
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"renew", "connect", "renew", "connect"}, log)
+}
+
+func TestBuildSSHArgsCertificate(t *testing.T) {
+	cfg := testConfig("home")
+	cfg.SSH.PrivateKeyPath = "/keys/id_ed25519"
+	cfg.SSH.CertificatePath = "/keys/id_ed25519-cert.pub"
+
+	args := BuildSSHArgs(cfg)
+	assert.Contains(t, args, "CertificateFile=/keys/id_ed25519-cert.pub")
+}
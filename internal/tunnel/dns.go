@@ -0,0 +1,124 @@
+package tunnel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/lerndmina/SSH-Tunnel/internal/config"
+	"github.com/lerndmina/SSH-Tunnel/pkg/logger"
+)
+
+// DefaultDNSRetry is the pause between reconnect attempts while the cloud
+// server's host name does not resolve, unless Performance.DNSRetrySec is set
+const DefaultDNSRetry = 30 * time.Second
+
+// ErrHostUnresolved is the cloud server's host name failing to resolve
+var ErrHostUnresolved = errors.New("host name does not resolve")
+
+// resolveFunc looks up the addresses of a host name
+type resolveFunc func(ctx context.Context, host string) ([]string, error)
+
+// dnsRetryDelay returns the pause between reconnect attempts while the
+// cloud server's host name does not resolve
+func dnsRetryDelay(cfg *config.Config) time.Duration {
+	if cfg.Performance.DNSRetrySec > 0 {
+		return time.Duration(cfg.Performance.DNSRetrySec) * time.Second
+	}
+	return DefaultDNSRetry
+}
+
+// resolveCloudServer looks up the addresses of the tunnel's cloud server.
+// Only DNS failures are reported, wrapping ErrHostUnresolved and the
+// *net.DNSError; anything else is left for ssh to run into and report.
+func (t *Tunnel) resolveCloudServer() ([]string, error) {
+	t.mu.RLock()
+	cfg, resolve := t.Config, t.resolve
+	t.mu.RUnlock()
+	if resolve == nil {
+		resolve = net.DefaultResolver.LookupHost
+	}
+
+	target, err := ResolveNativeTarget(cfg)
+	if err != nil {
+		return nil, nil
+	}
+	if net.ParseIP(target.Host) != nil {
+		return []string{target.Host}, nil
+	}
+
+	timeout := time.Duration(cfg.Performance.ConnectTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = config.DefaultConnectTimeout * time.Second
+	}
+	ctx, cancel := context.WithTimeout(t.ctx, timeout)
+	defer cancel()
+
+	addrs, err := resolve(ctx, target.Host)
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return nil, fmt.Errorf("%w: %w", ErrHostUnresolved, err)
+	}
+	if err != nil {
+		logger.Debugf("Failed to resolve %s for tunnel '%s': %v", target.Host, t.ID, err)
+		return nil, nil
+	}
+	return addrs, nil
+}
+
+// setResolvedAddrs records the cloud server's addresses, if known, and
+// reports whether they differ from the ones recorded before. It is called
+// with t.mu held.
+func (t *Tunnel) setResolvedAddrs(addrs []string) bool {
+	if addrs == nil {
+		return false
+	}
+	addrs = slices.Clone(addrs)
+	slices.Sort(addrs)
+	changed := t.ResolvedAddrs != nil && !slices.Equal(t.ResolvedAddrs, addrs)
+	t.ResolvedAddrs = addrs
+	return changed
+}
+
+// watchDNS starts refreshing the cloud server's addresses in the background,
+// if Performance.DNSRefreshSec is set
+func (t *Tunnel) watchDNS() {
+	if interval := t.Config.Performance.DNSRefreshSec; interval > 0 {
+		go t.refreshDNS(time.Duration(interval) * time.Second)
+	}
+}
+
+// refreshDNS re-resolves the cloud server's host name every interval until
+// the tunnel is stopped, logging when its addresses change. The SSH process
+// is left alone; it picks up the new address when it next reconnects.
+func (t *Tunnel) refreshDNS(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-t.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		addrs, err := t.resolveCloudServer()
+		if err != nil {
+			logger.Warnf("Tunnel '%s': %v", t.ID, err)
+			continue
+		}
+
+		t.mu.Lock()
+		previous := t.ResolvedAddrs
+		if t.setResolvedAddrs(addrs) {
+			logger.Infof("Tunnel '%s': %s now resolves to %s instead of %s; the connection is kept until it reconnects",
+				t.ID, t.Config.CloudServer.IP, strings.Join(t.ResolvedAddrs, ", "), strings.Join(previous, ", "))
+			t.changed()
+		}
+		t.mu.Unlock()
+	}
+}
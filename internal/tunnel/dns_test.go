@@ -0,0 +1,76 @@
+package tunnel
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lerndmina/SSH-Tunnel/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flakyResolver fails to resolve with a DNS error the given number of times,
+// then resolves every host to addr
+func flakyResolver(failures int32, addr string) resolveFunc {
+	var calls atomic.Int32
+	return func(ctx context.Context, host string) ([]string, error) {
+		if calls.Add(1) <= failures {
+			return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+		}
+		return []string{addr}, nil
+	}
+}
+
+func TestStartRetriesUntilHostResolves(t *testing.T) {
+	cfg := testConfig("dyndns")
+	cfg.CloudServer.IP = "home.dyndns.example"
+	cfg.Performance.DNSRetrySec = 1
+	m := newTestManager(t, cfg)
+	m.command = helperCommand("run")
+	m.resolve = flakyResolver(1, "198.51.100.7")
+	// Other failures would wait far longer
+	m.backoff = func(cfg *config.Config, attempt int) time.Duration {
+		return time.Hour
+	}
+
+	require.NoError(t, m.Start("dyndns"))
+	t.Cleanup(func() { m.Stop("dyndns") })
+
+	status := waitForStatus(t, m, "dyndns", func(s *TunnelStatus) bool {
+		return s.Status == StatusReconnecting
+	})
+	assert.ErrorIs(t, status.Error, ErrHostUnresolved)
+	var dnsErr *net.DNSError
+	assert.ErrorAs(t, status.Error, &dnsErr)
+	assert.WithinDuration(t, time.Now().Add(time.Second), status.NextRetry, 500*time.Millisecond)
+
+	status = waitForStatus(t, m, "dyndns", func(s *TunnelStatus) bool {
+		return s.Status == StatusRunning
+	})
+	assert.NoError(t, status.Error)
+	assert.Equal(t, []string{"198.51.100.7"}, status.ResolvedAddrs)
+	assert.Equal(t, 1, status.ReconnectCount)
+}
+
+func TestStartFailsOnDNSErrorWithoutReconnect(t *testing.T) {
+	cfg := testConfig("dyndns")
+	cfg.CloudServer.IP = "home.dyndns.example"
+	cfg.Service.AutoReconnect = false
+	m := newTestManager(t, cfg)
+	m.command = helperCommand("run")
+	m.resolve = flakyResolver(1, "198.51.100.7")
+
+	err := m.Start("dyndns")
+	assert.ErrorIs(t, err, ErrHostUnresolved)
+}
+
+func TestDNSRetryDelay(t *testing.T) {
+	cfg := testConfig("dyndns")
+	assert.Equal(t, DefaultDNSRetry, dnsRetryDelay(cfg))
+
+	cfg.Performance.DNSRetrySec = 120
+	assert.Equal(t, 2*time.Minute, dnsRetryDelay(cfg))
+}
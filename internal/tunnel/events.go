@@ -0,0 +1,142 @@
+package tunnel
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lerndmina/SSH-Tunnel/pkg/logger"
+)
+
+// EventType identifies a tunnel state change
+type EventType string
+
+const (
+	// EventStarted is sent when an SSH process starts, including after a
+	// reconnect
+	EventStarted EventType = "started"
+	// EventStopped is sent when a tunnel is stopped
+	EventStopped EventType = "stopped"
+	// EventError is sent when the SSH process exits unexpectedly
+	EventError EventType = "error"
+	// EventReconnecting is sent when a reconnect attempt is scheduled
+	EventReconnecting EventType = "reconnecting"
+	// EventHealthCheck is sent after each health check, with Err set if it
+	// failed
+	EventHealthCheck EventType = "healthcheck"
+	// EventExpired is sent when a tunnel reaches its lifetime, just before
+	// it is stopped
+	EventExpired EventType = "expired"
+)
+
+// eventBufferSize is how many events a subscriber may fall behind by before
+// further events are dropped for it
+const eventBufferSize = 64
+
+// TunnelEvent describes a change in a tunnel's state
+type TunnelEvent struct {
+	Type   EventType
+	Tunnel string
+	Time   time.Time
+	// Err is the error behind error events and failed health checks
+	Err error
+	// Attempt is the reconnect attempt number for reconnecting events
+	Attempt int
+}
+
+// eventBus fans events out to subscribers without ever blocking the sender
+type eventBus struct {
+	mu          sync.Mutex
+	subscribers map[<-chan TunnelEvent]chan TunnelEvent
+}
+
+// newEventBus creates an event bus with no subscribers
+func newEventBus() *eventBus {
+	return &eventBus{subscribers: make(map[<-chan TunnelEvent]chan TunnelEvent)}
+}
+
+// subscribe registers a new buffered subscriber channel
+func (b *eventBus) subscribe() <-chan TunnelEvent {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan TunnelEvent, eventBufferSize)
+	b.subscribers[ch] = ch
+	return ch
+}
+
+// unsubscribe removes and closes a subscriber channel
+func (b *eventBus) unsubscribe(ch <-chan TunnelEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if sub, ok := b.subscribers[ch]; ok {
+		delete(b.subscribers, ch)
+		close(sub)
+	}
+}
+
+// publish sends an event to every subscriber, dropping it for subscribers
+// whose buffer is full
+func (b *eventBus) publish(event TunnelEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, sub := range b.subscribers {
+		select {
+		case sub <- event:
+		default:
+			logger.Debugf("Dropped %s event for tunnel '%s': subscriber is not keeping up", event.Type, event.Tunnel)
+		}
+	}
+}
+
+// Subscribe returns a channel receiving every tunnel event from this manager.
+// Events for a tunnel arrive in the order they happened. The channel is
+// buffered; a subscriber that falls too far behind misses events rather than
+// blocking the manager. Call Unsubscribe when done.
+func (m *Manager) Subscribe() <-chan TunnelEvent {
+	return m.events.subscribe()
+}
+
+// Unsubscribe stops delivery to a channel returned by Subscribe and closes it
+func (m *Manager) Unsubscribe(ch <-chan TunnelEvent) {
+	m.events.unsubscribe(ch)
+}
+
+// emit publishes an event for the tunnel, sends it to the tunnel's webhook
+// and marks its status as changed. Events of a group's SSH process are sent
+// for each tunnel in the group. It is called with t.mu held, so that a
+// tunnel's events are published in the order its state changed.
+func (t *Tunnel) emit(eventType EventType, err error) {
+	t.changed()
+	targets := []*Tunnel{t}
+	if len(t.members) > 0 {
+		targets = t.members
+	}
+	for _, target := range targets {
+		event := TunnelEvent{
+			Type:    eventType,
+			Tunnel:  target.ID,
+			Time:    time.Now(),
+			Err:     err,
+			Attempt: t.ReconnectAttempt,
+		}
+		target.notify(event)
+		if t.events != nil {
+			t.events.publish(event)
+		}
+	}
+}
+
+// String describes the event, e.g. "tunnel 'home' reconnecting (attempt 2)"
+func (e TunnelEvent) String() string {
+	text := fmt.Sprintf("tunnel '%s' %s", e.Tunnel, e.Type)
+	if e.Type == EventReconnecting {
+		text += fmt.Sprintf(" (attempt %d)", e.Attempt)
+	}
+	if e.Err != nil {
+		text += ": " + e.Err.Error()
+	}
+	return text
+}
@@ -0,0 +1,105 @@
+package tunnel
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lerndmina/SSH-Tunnel/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// nextEvent receives the next event or fails the test
+func nextEvent(t *testing.T, events <-chan TunnelEvent) TunnelEvent {
+	t.Helper()
+	select {
+	case event, ok := <-events:
+		require.True(t, ok, "event channel closed")
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for event")
+		return TunnelEvent{}
+	}
+}
+
+func TestSubscribeEventsArriveInOrder(t *testing.T) {
+	m := newTestManager(t, testConfig("flappy"))
+	m.command = helperCommand("flap")
+	m.backoff = func(cfg *config.Config, attempt int) time.Duration {
+		if attempt < 3 {
+			return 10 * time.Millisecond
+		}
+		return time.Hour
+	}
+
+	events := m.Subscribe()
+	defer m.Unsubscribe(events)
+
+	require.NoError(t, m.Start("flappy"))
+
+	type step struct {
+		Type    EventType
+		Attempt int
+	}
+	var got []step
+	for len(got) < 9 {
+		event := nextEvent(t, events)
+		assert.Equal(t, "flappy", event.Tunnel)
+		assert.False(t, event.Time.IsZero())
+		got = append(got, step{event.Type, event.Attempt})
+	}
+
+	require.NoError(t, m.Stop("flappy"))
+	stopped := nextEvent(t, events)
+	got = append(got, step{stopped.Type, stopped.Attempt})
+
+	assert.Equal(t, []step{
+		{EventStarted, 0}, {EventError, 0}, {EventReconnecting, 1},
+		{EventStarted, 1}, {EventError, 1}, {EventReconnecting, 2},
+		{EventStarted, 2}, {EventError, 2}, {EventReconnecting, 3},
+		{EventStopped, 3},
+	}, got)
+}
+
+func TestHealthCheckEvent(t *testing.T) {
+	m := newTestManager(t, testConfig("healthy"))
+	m.command = helperCommand("run")
+
+	events := m.Subscribe()
+	defer m.Unsubscribe(events)
+
+	require.NoError(t, m.Start("healthy"))
+	defer m.Stop("healthy")
+	assert.Equal(t, EventStarted, nextEvent(t, events).Type)
+
+	require.NoError(t, m.HealthCheck("healthy"))
+	event := nextEvent(t, events)
+	assert.Equal(t, EventHealthCheck, event.Type)
+	assert.NoError(t, event.Err)
+}
+
+func TestSlowSubscriberDoesNotBlock(t *testing.T) {
+	m := NewManagerWithConfig(nil)
+	slow := m.Subscribe()
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < eventBufferSize*2; i++ {
+			m.events.publish(TunnelEvent{Type: EventHealthCheck, Tunnel: "busy"})
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("publishing blocked on a slow subscriber")
+	}
+	assert.Len(t, slow, eventBufferSize)
+
+	m.Unsubscribe(slow)
+	for range slow {
+	}
+	_, open := <-slow
+	assert.False(t, open)
+}
@@ -0,0 +1,79 @@
+package tunnel
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lerndmina/SSH-Tunnel/internal/config"
+)
+
+// ErrForwardNoAnswer is returned by the remote forward check when the
+// reverse port accepts connections on the cloud server but nothing answers
+// through it, e.g. because the local SSH server is down
+var ErrForwardNoAnswer = errors.New("reverse port is bound but nothing answers")
+
+// DefaultForwardCheckTimeout bounds waiting for the banner when the context
+// has no deadline
+const DefaultForwardCheckTimeout = 10 * time.Second
+
+// forwardDialer opens connections from the cloud server's side, like an SSH
+// client's direct-tcpip channels
+type forwardDialer interface {
+	Dial(network, address string) (net.Conn, error)
+}
+
+// forwardCheckFunc checks end to end that a tunnel's reverse forward reaches
+// the local SSH server, returning its banner
+type forwardCheckFunc func(ctx context.Context, cfg *config.Config) (string, error)
+
+// RemoteForwardCheck connects to the cloud server over SSH, opens a
+// connection to the reverse port from there and reads the banner of the
+// local SSH server it forwards to. Unlike the readiness probe, it tells a
+// working tunnel apart from a bound port with nothing behind it.
+func RemoteForwardCheck(ctx context.Context, cfg *config.Config) (string, error) {
+	client, err := dialCloud(ctx, cfg)
+	if err != nil {
+		return "", err
+	}
+	defer client.Close()
+
+	return checkRemoteForward(ctx, client, cfg.LocalServer.ReversePort)
+}
+
+// checkRemoteForward connects to the reverse port through dialer and
+// expects an SSH banner from the far end
+func checkRemoteForward(ctx context.Context, dialer forwardDialer, port int) (string, error) {
+	address := net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+	conn, err := dialer.Dial("tcp", address)
+	if err != nil {
+		return "", fmt.Errorf("reverse port %d is not open: %w", port, err)
+	}
+	defer conn.Close()
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(DefaultForwardCheckTimeout)
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		return "", err
+	}
+
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	banner := strings.TrimRight(line, "\r\n")
+	if banner == "" {
+		if err == nil {
+			err = errors.New("empty line")
+		}
+		return "", fmt.Errorf("%w on port %d: %v", ErrForwardNoAnswer, port, err)
+	}
+	if !strings.HasPrefix(banner, "SSH-") {
+		return "", fmt.Errorf("reverse port %d answered %q, not an SSH banner", port, banner)
+	}
+	return banner, nil
+}
@@ -0,0 +1,78 @@
+package tunnel
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/lerndmina/SSH-Tunnel/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockSession stands in for an SSH connection to the cloud server. Each
+// dial returns one end of a pipe, and the far end sends reply and closes.
+type mockSession struct {
+	reply   string
+	dialErr error
+	dialed  string
+}
+
+func (s *mockSession) Dial(network, address string) (net.Conn, error) {
+	s.dialed = address
+	if s.dialErr != nil {
+		return nil, s.dialErr
+	}
+
+	client, server := net.Pipe()
+	go func() {
+		if s.reply != "" {
+			server.Write([]byte(s.reply))
+		}
+		server.Close()
+	}()
+	return client, nil
+}
+
+func TestCheckRemoteForward(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	session := &mockSession{reply: "SSH-2.0-OpenSSH_9.6\r\n"}
+	banner, err := checkRemoteForward(ctx, session, 2222)
+	require.NoError(t, err)
+	assert.Equal(t, "SSH-2.0-OpenSSH_9.6", banner)
+	assert.Equal(t, "127.0.0.1:2222", session.dialed)
+
+	// Bound by sshd on the cloud server, but nothing behind it
+	_, err = checkRemoteForward(ctx, &mockSession{}, 2222)
+	assert.ErrorIs(t, err, ErrForwardNoAnswer)
+
+	_, err = checkRemoteForward(ctx, &mockSession{reply: "HTTP/1.1 400 Bad Request\r\n"}, 2222)
+	assert.ErrorContains(t, err, "not an SSH banner")
+
+	_, err = checkRemoteForward(ctx, &mockSession{dialErr: errors.New("connect failed")}, 2222)
+	assert.ErrorContains(t, err, "reverse port 2222 is not open")
+	assert.NotErrorIs(t, err, ErrForwardNoAnswer)
+}
+
+func TestHealthCheckIncludesRemoteForwardCheck(t *testing.T) {
+	m := newTestManager(t, testConfig("checked"))
+	m.command = helperCommand("run")
+	m.forwardCheck = func(ctx context.Context, cfg *config.Config) (string, error) {
+		return checkRemoteForward(ctx, &mockSession{}, cfg.LocalServer.ReversePort)
+	}
+
+	require.NoError(t, m.Start("checked"))
+	t.Cleanup(func() { m.Stop("checked") })
+
+	err := m.HealthCheck("checked")
+	assert.ErrorIs(t, err, ErrForwardNoAnswer)
+
+	status, err := m.GetStatus("checked")
+	require.NoError(t, err)
+	assert.ErrorIs(t, status.ForwardError, ErrForwardNoAnswer)
+	assert.NoError(t, status.SOCKSError)
+}
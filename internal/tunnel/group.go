@@ -0,0 +1,102 @@
+package tunnel
+
+import (
+	"fmt"
+
+	"github.com/lerndmina/SSH-Tunnel/internal/config"
+)
+
+// startConfigs returns the configurations of the tunnels that start and
+// stop together with a tunnel: its group, or else just the tunnel itself
+func (m *Manager) startConfigs(tunnelName string) ([]*config.Config, error) {
+	cfg, err := m.configManager.GetConfig(tunnelName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get configuration for tunnel '%s': %w", tunnelName, err)
+	}
+	if cfg.Group == "" {
+		return []*config.Config{cfg}, nil
+	}
+	return m.configManager.GroupConfigs(cfg.Group)
+}
+
+// sshProcessConfig returns the configuration the SSH process running a
+// tunnel is started with, merged with the rest of its group if it has one,
+// and the tunnels that process serves
+func (m *Manager) sshProcessConfig(tunnelName string) (*config.Config, []*config.Config, error) {
+	members, err := m.startConfigs(tunnelName)
+	if err != nil {
+		return nil, nil, err
+	}
+	if group := members[0].Group; group != "" {
+		merged, err := config.MergeGroup(group, members)
+		return merged, members, err
+	}
+	return members[0], members, nil
+}
+
+// sshProcess returns the tunnel running t's SSH process: its group's
+// carrier, or t itself
+func (t *Tunnel) sshProcess() *Tunnel {
+	if t.carrier != nil {
+		return t.carrier
+	}
+	return t
+}
+
+// memberStatus reads the status of a tunnel in a group: the state of the
+// group's SSH process, with the tunnel's own name, health checks and
+// lifetime
+func (t *Tunnel) memberStatus() *TunnelStatus {
+	status := t.carrier.status()
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	status.Name = t.ID
+	status.Group = t.Config.Group
+	status.LastHealthCheck = t.LastHealthCheck
+	status.SOCKSError = t.SOCKSError
+	status.ForwardError = t.ForwardError
+	status.ExpiresAt = t.ExpiresAt
+	return status
+}
+
+// locks returns the locks held for the tunnels t's SSH process serves
+func (t *Tunnel) locks() []*tunnelLock {
+	if len(t.members) == 0 {
+		if t.lock == nil {
+			return nil
+		}
+		return []*tunnelLock{t.lock}
+	}
+
+	var locks []*tunnelLock
+	for _, member := range t.members {
+		if member.lock != nil {
+			locks = append(locks, member.lock)
+		}
+	}
+	return locks
+}
+
+// logFiles returns the files t's SSH process output is captured to: each
+// member's log for a group
+func (t *Tunnel) logFiles() []string {
+	if len(t.members) == 0 {
+		return []string{t.LogFile}
+	}
+	files := make([]string, len(t.members))
+	for i, member := range t.members {
+		files[i] = member.LogFile
+	}
+	return files
+}
+
+// tunnelNames returns the names of tunnels
+func tunnelNames(tunnels []*Tunnel) []string {
+	names := make([]string, len(tunnels))
+	for i, t := range tunnels {
+		names[i] = t.ID
+	}
+	return names
+}
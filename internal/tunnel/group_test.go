@@ -0,0 +1,128 @@
+package tunnel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"sync"
+	"testing"
+
+	"github.com/lerndmina/SSH-Tunnel/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newGroupManager creates a tunnel manager with two tunnels in the group
+// "office" and records the arguments of every SSH process it spawns
+func newGroupManager(t *testing.T) (*Manager, func() [][]string) {
+	t.Helper()
+
+	web := testConfig("web")
+	web.Group = "office"
+	web.LocalServer.LocalForwards = []config.ForwardConfig{{LocalPort: 5432, RemoteHost: "db.internal", RemotePort: 5432}}
+	ssh := testConfig("ssh")
+	ssh.Group = "office"
+	ssh.LocalServer.ReversePort = 2223
+
+	m := newTestManager(t, web)
+	require.NoError(t, m.configManager.SaveConfig(ssh))
+
+	var mu sync.Mutex
+	var spawned [][]string
+	m.command = func(ctx context.Context, name string, args ...string) *exec.Cmd {
+		mu.Lock()
+		spawned = append(spawned, args)
+		mu.Unlock()
+		return helperCommand("run")(ctx, name, args...)
+	}
+	return m, func() [][]string {
+		mu.Lock()
+		defer mu.Unlock()
+		return spawned
+	}
+}
+
+func TestGroupSharesOneSSHProcess(t *testing.T) {
+	m, spawned := newGroupManager(t)
+
+	require.NoError(t, m.Start("ssh"))
+	t.Cleanup(func() { m.Stop("ssh") })
+
+	// One process carries both tunnels' reverse ports and forwards
+	require.Len(t, spawned(), 1)
+	args := spawned()[0]
+	assert.ElementsMatch(t, []string{"2223:localhost:22", "2222:localhost:22"}, argValues(args, "-R"))
+	assert.Equal(t, []string{"127.0.0.1:5432:db.internal:5432"}, argValues(args, "-L"))
+
+	// Each tunnel still has its own status
+	web, err := m.GetStatus("web")
+	require.NoError(t, err)
+	ssh, err := m.GetStatus("ssh")
+	require.NoError(t, err)
+	assert.Equal(t, "web", web.Name)
+	assert.Equal(t, "ssh", ssh.Name)
+	for _, status := range []*TunnelStatus{web, ssh} {
+		assert.Equal(t, StatusRunning, status.Status)
+		assert.Equal(t, "office", status.Group)
+	}
+	assert.NotZero(t, web.PID)
+	assert.Equal(t, web.PID, ssh.PID)
+
+	statuses, err := m.List()
+	require.NoError(t, err)
+	assert.Len(t, statuses, 2)
+
+	// Starting another member finds it running
+	assert.ErrorContains(t, m.Start("ssh"), "tunnel 'ssh' is already running")
+	assert.ErrorContains(t, m.Start("web"), "tunnel 'ssh' in group 'office' is already running")
+	assert.Len(t, spawned(), 1)
+}
+
+func TestGroupHealthIsPerTunnel(t *testing.T) {
+	m, _ := newGroupManager(t)
+	m.forwardCheck = func(ctx context.Context, cfg *config.Config) (string, error) {
+		if cfg.LocalServer.ReversePort == 2223 {
+			return "", fmt.Errorf("reverse port %d: %w", cfg.LocalServer.ReversePort, ErrForwardNoAnswer)
+		}
+		return "SSH-2.0-OpenSSH_9.6", nil
+	}
+
+	require.NoError(t, m.Start("web"))
+	t.Cleanup(func() { m.Stop("web") })
+
+	assert.NoError(t, m.HealthCheck("web"))
+	assert.ErrorIs(t, m.HealthCheck("ssh"), ErrForwardNoAnswer)
+
+	web, err := m.GetStatus("web")
+	require.NoError(t, err)
+	ssh, err := m.GetStatus("ssh")
+	require.NoError(t, err)
+	assert.NoError(t, web.ForwardError)
+	assert.True(t, errors.Is(ssh.ForwardError, ErrForwardNoAnswer))
+	assert.Equal(t, StatusRunning, ssh.Status)
+}
+
+func TestGroupStopsTogether(t *testing.T) {
+	m, _ := newGroupManager(t)
+	events := m.Subscribe()
+	defer m.Unsubscribe(events)
+
+	require.NoError(t, m.Start("web"))
+	require.NoError(t, m.Stop("ssh"))
+
+	for _, name := range []string{"web", "ssh"} {
+		status, err := m.GetStatus(name)
+		require.NoError(t, err)
+		assert.Equal(t, StatusStopped, status.Status, name)
+	}
+	assert.ErrorContains(t, m.Stop("web"), "not found")
+
+	// Events are sent for each tunnel in the group
+	var got []string
+	for len(got) < 4 {
+		event := <-events
+		got = append(got, fmt.Sprintf("%s %s", event.Tunnel, event.Type))
+	}
+	assert.ElementsMatch(t, []string{"ssh started", "web started", "ssh stopped", "web stopped"}, got)
+}
@@ -0,0 +1,62 @@
+package tunnel
+
+import (
+	"time"
+
+	"github.com/lerndmina/SSH-Tunnel/pkg/logger"
+)
+
+// watchHealth runs a health check of each of the tunnels carried by proc's
+// SSH process every interval until proc is stopped. A failed check restarts
+// the SSH process, so a connection that stays up while its forwards no
+// longer work is reconnected like one that dropped.
+func (m *Manager) watchHealth(proc *Tunnel, tunnels []*Tunnel, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-proc.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for _, tunnel := range tunnels {
+			// A process that is reconnecting is already being replaced
+			proc.mu.RLock()
+			running := proc.Status == StatusRunning
+			proc.mu.RUnlock()
+			if !running {
+				break
+			}
+
+			if err := m.HealthCheck(tunnel.ID); err != nil {
+				proc.restartUnhealthy(err)
+				break
+			}
+		}
+	}
+}
+
+// restartUnhealthy kills the SSH process after a failed health check, so
+// supervise reconnects it. Without auto-reconnect the failure is only
+// logged, as killing the process would leave the tunnel down.
+func (t *Tunnel) restartUnhealthy(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.Config.Service.AutoReconnect {
+		logger.Warnf("Tunnel '%s' failed its health check: %v", t.ID, err)
+		return
+	}
+	if t.Status != StatusRunning || t.Process == nil || t.Process.Process == nil {
+		return
+	}
+
+	logger.Warnf("Tunnel '%s' failed its health check, reconnecting: %v", t.ID, err)
+	t.unhealthy = err
+	if killErr := t.Process.Process.Kill(); killErr != nil {
+		t.unhealthy = nil
+		logger.Warnf("Failed to stop the SSH process of tunnel '%s': %v", t.ID, killErr)
+	}
+}
@@ -0,0 +1,70 @@
+package tunnel
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lerndmina/SSH-Tunnel/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFailedHealthCheckReconnects(t *testing.T) {
+	cfg := testConfig("checked")
+	cfg.Service.HealthCheckInterval = 20 * time.Millisecond
+	m := newTestManager(t, cfg)
+	m.command = helperCommand("run")
+	m.backoff = func(cfg *config.Config, attempt int) time.Duration {
+		return 10 * time.Millisecond
+	}
+
+	var failing atomic.Bool
+	failing.Store(true)
+	m.forwardCheck = func(ctx context.Context, cfg *config.Config) (string, error) {
+		if failing.Load() {
+			return "", ErrForwardNoAnswer
+		}
+		return "SSH-2.0-OpenSSH_9.6", nil
+	}
+
+	assert.NoError(t, m.Start("checked"))
+	t.Cleanup(func() { m.Stop("checked") })
+
+	status := waitForStatus(t, m, "checked", func(s *TunnelStatus) bool { return s.ReconnectCount > 0 })
+	assert.Contains(t, status.LastError, "failed health check")
+	assert.Contains(t, status.LastError, ErrForwardNoAnswer.Error())
+
+	// Once the checks pass the tunnel stays up
+	failing.Store(false)
+	status = waitForStatus(t, m, "checked", func(s *TunnelStatus) bool {
+		return s.Status == StatusRunning && s.ForwardError == nil && !s.LastHealthCheck.IsZero()
+	})
+	count := status.ReconnectCount
+	time.Sleep(100 * time.Millisecond)
+	status = waitForStatus(t, m, "checked", func(s *TunnelStatus) bool { return s.Status == StatusRunning })
+	assert.Equal(t, count, status.ReconnectCount)
+}
+
+func TestFailedHealthCheckWithoutAutoReconnectKeepsTunnel(t *testing.T) {
+	cfg := testConfig("manual")
+	cfg.Service.AutoReconnect = false
+	cfg.Service.HealthCheckInterval = 20 * time.Millisecond
+	m := newTestManager(t, cfg)
+	m.command = helperCommand("run")
+
+	var checks atomic.Int32
+	m.forwardCheck = func(ctx context.Context, cfg *config.Config) (string, error) {
+		checks.Add(1)
+		return "", ErrForwardNoAnswer
+	}
+
+	assert.NoError(t, m.Start("manual"))
+	t.Cleanup(func() { m.Stop("manual") })
+
+	assert.Eventually(t, func() bool { return checks.Load() >= 3 }, 5*time.Second, 10*time.Millisecond)
+	status, err := m.GetStatus("manual")
+	assert.NoError(t, err)
+	assert.Equal(t, StatusRunning, status.Status)
+	assert.Zero(t, status.ReconnectCount)
+}
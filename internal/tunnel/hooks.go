@@ -0,0 +1,118 @@
+package tunnel
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/lerndmina/SSH-Tunnel/internal/config"
+	"github.com/lerndmina/SSH-Tunnel/pkg/logger"
+	"github.com/sirupsen/logrus"
+)
+
+// Hook names, passed to hook commands as SSH_TUNNEL_HOOK
+const (
+	HookPreStart = "pre_start"
+	HookOnStart  = "on_start"
+	HookOnStop   = "on_stop"
+	// HookCertRenew runs SSH.CertRenewCommand before connecting
+	HookCertRenew = "cert_renew"
+)
+
+// DefaultHookTimeout bounds how long a hook command may run unless
+// Service.HookTimeout is set
+const DefaultHookTimeout = 30 * time.Second
+
+// CommandRunner runs hook commands
+type CommandRunner interface {
+	// Run executes command with env added to the environment and returns
+	// its combined output
+	Run(ctx context.Context, command string, env []string) ([]byte, error)
+}
+
+// ShellRunner runs commands through the system shell
+type ShellRunner struct{}
+
+// Run implements CommandRunner
+func (ShellRunner) Run(ctx context.Context, command string, env []string) ([]byte, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	cmd.Env = append(os.Environ(), env...)
+
+	return cmd.CombinedOutput()
+}
+
+// hookEnv returns the environment describing a tunnel to its hooks
+func hookEnv(cfg *config.Config, hook string) []string {
+	return []string{
+		"SSH_TUNNEL_HOOK=" + hook,
+		"SSH_TUNNEL_NAME=" + cfg.TunnelName,
+		fmt.Sprintf("SSH_TUNNEL_REVERSE_PORT=%d", cfg.LocalServer.ReversePort),
+		"SSH_TUNNEL_CLOUD_HOST=" + cfg.CloudServer.IP,
+		fmt.Sprintf("SSH_TUNNEL_CLOUD_PORT=%d", cfg.CloudServer.Port),
+		"SSH_TUNNEL_CLOUD_USER=" + cfg.CloudServer.User,
+	}
+}
+
+// hookTimeout returns the time limit for a tunnel's hook commands
+func hookTimeout(cfg *config.Config) time.Duration {
+	if cfg.Service.HookTimeout > 0 {
+		return time.Duration(cfg.Service.HookTimeout) * time.Second
+	}
+	return DefaultHookTimeout
+}
+
+// runHook runs a tunnel hook command, if configured, logging its output. The
+// trimmed output is returned so callers can report it. The command is killed
+// if parent is cancelled or the hook timeout passes.
+func (m *Manager) runHook(parent context.Context, cfg *config.Config, hook, command string) (string, error) {
+	m.mu.RLock()
+	runner := m.runner
+	m.mu.RUnlock()
+
+	return runHookWith(parent, runner, cfg, hook, command)
+}
+
+// runHookWith runs a hook command like Manager.runHook, with the given runner
+func runHookWith(parent context.Context, runner CommandRunner, cfg *config.Config, hook, command string) (string, error) {
+	if strings.TrimSpace(command) == "" {
+		return "", nil
+	}
+	if runner == nil {
+		runner = ShellRunner{}
+	}
+
+	timeout := hookTimeout(cfg)
+	ctx, cancel := context.WithTimeout(parent, timeout)
+	defer cancel()
+
+	logger.Debugf("Running %s hook for tunnel '%s': %s", hook, cfg.TunnelName, command)
+	output, err := runner.Run(ctx, command, hookEnv(cfg, hook))
+	trimmed := strings.TrimSpace(string(output))
+
+	fields := logrus.Fields{"tunnel": cfg.TunnelName, "hook": hook}
+	for _, line := range strings.Split(trimmed, "\n") {
+		if line = strings.TrimRight(line, "\r"); line != "" {
+			logger.Log(logger.InfoLevel, fields, line)
+		}
+	}
+
+	if parent.Err() != nil {
+		err = parent.Err()
+	} else if ctx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("timed out after %s", timeout)
+	}
+	if err != nil {
+		return trimmed, fmt.Errorf("%s hook for tunnel '%s' failed: %w", hook, cfg.TunnelName, err)
+	}
+
+	return trimmed, nil
+}
@@ -0,0 +1,196 @@
+package tunnel
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// hookCall records a single CommandRunner invocation
+type hookCall struct {
+	command string
+	env     []string
+}
+
+// recordingRunner is a CommandRunner that records calls instead of running them
+type recordingRunner struct {
+	calls  []hookCall
+	output string
+	err    error
+	mu     sync.Mutex
+}
+
+func (r *recordingRunner) Run(ctx context.Context, command string, env []string) ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, hookCall{command: command, env: env})
+	return []byte(r.output), r.err
+}
+
+// blockingRunner is a CommandRunner whose commands hang until cancelled
+type blockingRunner struct{}
+
+func (blockingRunner) Run(ctx context.Context, command string, env []string) ([]byte, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestHooksRunWithTunnelEnv(t *testing.T) {
+	cfg := testConfig("home")
+	cfg.Service.OnStart = "register-port"
+	cfg.Service.OnStop = "deregister-port"
+	m := newTestManager(t, cfg)
+	m.command = helperCommand("run")
+	runner := &recordingRunner{}
+	m.SetCommandRunner(runner)
+
+	require.NoError(t, m.Start("home"))
+	require.Len(t, runner.calls, 1)
+	assert.Equal(t, "register-port", runner.calls[0].command)
+	assert.Subset(t, runner.calls[0].env, []string{
+		"SSH_TUNNEL_HOOK=on_start",
+		"SSH_TUNNEL_NAME=home",
+		"SSH_TUNNEL_REVERSE_PORT=2222",
+		"SSH_TUNNEL_CLOUD_HOST=203.0.113.1",
+	})
+
+	require.NoError(t, m.Stop("home"))
+	require.Len(t, runner.calls, 2)
+	assert.Equal(t, "deregister-port", runner.calls[1].command)
+	assert.Contains(t, runner.calls[1].env, "SSH_TUNNEL_HOOK=on_stop")
+}
+
+func TestFailingPostStartHookDoesNotFailStart(t *testing.T) {
+	cfg := testConfig("home")
+	cfg.Service.OnStart = "register-port"
+	m := newTestManager(t, cfg)
+	m.command = helperCommand("run")
+	m.SetCommandRunner(&recordingRunner{err: fmt.Errorf("exit status 1")})
+
+	require.NoError(t, m.Start("home"))
+	defer m.Stop("home")
+
+	status, err := m.GetStatus("home")
+	require.NoError(t, err)
+	assert.Equal(t, StatusRunning, status.Status)
+}
+
+func TestFailingPreStartHookVetoesStart(t *testing.T) {
+	cfg := testConfig("home")
+	cfg.Service.PreStart = "check-vpn"
+	cfg.Service.OnStart = "register-port"
+	m := newTestManager(t, cfg)
+
+	spawned := false
+	run := helperCommand("run")
+	m.command = func(ctx context.Context, name string, args ...string) *exec.Cmd {
+		spawned = true
+		return run(ctx, name, args...)
+	}
+	runner := &recordingRunner{output: "VPN is not connected\n", err: fmt.Errorf("exit status 1")}
+	m.SetCommandRunner(runner)
+
+	err := m.Start("home")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "pre_start hook")
+	assert.Contains(t, err.Error(), "VPN is not connected")
+
+	assert.False(t, spawned)
+	require.Len(t, runner.calls, 1, "on_start must not run after a veto")
+	assert.Contains(t, runner.calls[0].env, "SSH_TUNNEL_HOOK=pre_start")
+
+	status, err := m.GetStatus("home")
+	require.NoError(t, err)
+	assert.Equal(t, StatusStopped, status.Status)
+}
+
+func TestPreStartHookTimeout(t *testing.T) {
+	cfg := testConfig("home")
+	cfg.Service.PreStart = "sleep 3600"
+	cfg.Service.HookTimeout = 1
+	m := newTestManager(t, cfg)
+	m.command = helperCommand("run")
+	m.SetCommandRunner(blockingRunner{})
+
+	start := time.Now()
+	err := m.Start("home")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "timed out")
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestStartContextCancelAbortsSlowStart(t *testing.T) {
+	cfg := testConfig("home")
+	cfg.Service.PreStart = "sleep 3600"
+	m := newTestManager(t, cfg)
+
+	spawned := false
+	run := helperCommand("run")
+	m.command = func(ctx context.Context, name string, args ...string) *exec.Cmd {
+		spawned = true
+		return run(ctx, name, args...)
+	}
+	m.SetCommandRunner(blockingRunner{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := m.StartContext(ctx, "home")
+	require.Error(t, err)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 5*time.Second)
+	assert.False(t, spawned)
+
+	status, err := m.GetStatus("home")
+	require.NoError(t, err)
+	assert.Equal(t, StatusStopped, status.Status)
+
+	// A context cancelled before the start does nothing at all
+	cfg.Service.PreStart = ""
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.ErrorIs(t, m.StartContext(cancelled, "home"), context.Canceled)
+	assert.False(t, spawned)
+}
+
+func TestShellRunnerPassesEnv(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a POSIX shell")
+	}
+
+	output, err := ShellRunner{}.Run(context.Background(), `echo "$SSH_TUNNEL_NAME:$SSH_TUNNEL_REVERSE_PORT"`, hookEnv(testConfig("home"), HookOnStart))
+	require.NoError(t, err)
+	assert.Equal(t, "home:2222\n", string(output))
+}
+
+func TestPreStartHookSkippedWhenAlreadyRunning(t *testing.T) {
+	cfg := testConfig("home")
+	cfg.Service.PreStart = "check-vpn"
+	m := newTestManager(t, cfg)
+	m.command = helperCommand("run")
+	runner := &recordingRunner{}
+	m.SetCommandRunner(runner)
+
+	require.NoError(t, m.Start("home"))
+	defer m.Stop("home")
+	require.Len(t, runner.calls, 1)
+
+	err := m.Start("home")
+	assert.ErrorContains(t, err, "already running")
+	assert.Len(t, runner.calls, 1, "pre_start must not run for a tunnel that is already running")
+
+	// Nor for one running in another process
+	other := NewManagerWithConfig(m.configManager)
+	other.command = helperCommand("run")
+	other.SetCommandRunner(runner)
+	assert.ErrorIs(t, other.Start("home"), ErrAlreadyRunning)
+	assert.Len(t, runner.calls, 1)
+}
@@ -0,0 +1,250 @@
+package tunnel
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/lerndmina/SSH-Tunnel/internal/process"
+	"github.com/lerndmina/SSH-Tunnel/pkg/logger"
+)
+
+// ErrAlreadyRunning is wrapped by Start errors when another process holds
+// the tunnel's lock
+var ErrAlreadyRunning = errors.New("already running")
+
+// LockDir returns the directory holding tunnel lock files
+func LockDir(configPath string) string {
+	return filepath.Join(configPath, "locks")
+}
+
+// tunnelLock is a lock file marking a tunnel as started by some process, so
+// that separate processes sharing a config directory do not both spawn SSH
+// for it. The file records the owning process and its current SSH process,
+// with when that started; it is stale once neither is alive, as after a
+// crash.
+type tunnelLock struct {
+	name       string
+	path       string
+	ownerPID   int
+	sshPID     int
+	sshStarted time.Time
+}
+
+// lockRecord is what a lock file records
+type lockRecord struct {
+	ownerPID int
+	sshPID   int
+	// sshStarted is when the SSH process started, zero in lock files
+	// written before it was recorded
+	sshStarted time.Time
+}
+
+// lockStartTolerance is how far a process's start time, as the system
+// reports it, may be from the one recorded in a lock for them to be taken
+// as the same process. ps and /proc only give it to the second.
+const lockStartTolerance = 2 * time.Second
+
+// startedAt reports whether a process that started at started is the SSH
+// process the lock recorded, rather than a later one given the same ID.
+// Locks without a recorded start time match any process.
+func (r lockRecord) startedAt(started time.Time) bool {
+	if r.sshStarted.IsZero() {
+		return true
+	}
+	diff := started.Sub(r.sshStarted)
+	return diff > -lockStartTolerance && diff < lockStartTolerance
+}
+
+// liveSSHProcess reports whether the SSH process the lock records is alive,
+// and is that process rather than a later one given the same ID. started is
+// when it started, or zero if that could not be read.
+func (r lockRecord) liveSSHProcess(processes process.Enumerator) (started time.Time, alive bool) {
+	if r.sshPID <= 0 || !processAlive(r.sshPID) {
+		return time.Time{}, false
+	}
+
+	started, err := processes.StartTime(r.sshPID)
+	switch {
+	case err != nil && !r.sshStarted.IsZero():
+		// Without its start time the process cannot be told apart from a
+		// later one; usually it has exited
+		logger.Debugf("%v", err)
+		return time.Time{}, false
+	case err != nil:
+		logger.Debugf("%v", err)
+		return time.Time{}, true
+	case !r.startedAt(started):
+		logger.Debugf("Process %d started at %s, not at %s as its lock records", r.sshPID, started, r.sshStarted)
+		return time.Time{}, false
+	}
+	return started, true
+}
+
+// acquireLock takes the lock for a tunnel, failing with ErrAlreadyRunning if
+// a live process holds it. Stale locks are replaced; processes tells the
+// recorded SSH process from a later one given its ID.
+func acquireLock(dir, name string, processes process.Enumerator) (*tunnelLock, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create lock directory: %w", err)
+	}
+
+	lock := &tunnelLock{
+		name:     name,
+		path:     filepath.Join(dir, name+".lock"),
+		ownerPID: os.Getpid(),
+	}
+
+	for attempt := 0; attempt < 2; attempt++ {
+		err := lock.create()
+		if err == nil {
+			return lock, nil
+		}
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf("failed to create lock file: %w", err)
+		}
+
+		if pid := lockHolder(lock.path, processes); pid > 0 {
+			return nil, fmt.Errorf("tunnel '%s' is %w in another process (pid %d)", name, ErrAlreadyRunning, pid)
+		}
+
+		// Stale lock left by a process that has exited
+		if err := removeStaleLock(dir, name, processes); err != nil {
+			return nil, err
+		}
+	}
+
+	return nil, fmt.Errorf("failed to acquire lock for tunnel '%s'", name)
+}
+
+// create atomically creates the lock file with its contents, failing with
+// an os.IsExist error if it is already present
+func (l *tunnelLock) create() error {
+	tmp, err := l.writeTemp()
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+
+	return os.Link(tmp, l.path)
+}
+
+// setSSHPID records the tunnel's current SSH process, and when it started,
+// in the lock file
+func (l *tunnelLock) setSSHPID(pid int, started time.Time) error {
+	l.sshPID = pid
+	l.sshStarted = started
+
+	tmp, err := l.writeTemp()
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, l.path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to update lock file: %w", err)
+	}
+	return nil
+}
+
+// writeTemp writes the lock contents to a temporary file beside the lock
+func (l *tunnelLock) writeTemp() (string, error) {
+	file, err := os.CreateTemp(filepath.Dir(l.path), "."+l.name+".lock-*")
+	if err != nil {
+		return "", err
+	}
+
+	started := "0"
+	if !l.sshStarted.IsZero() {
+		started = l.sshStarted.UTC().Format(time.RFC3339Nano)
+	}
+	_, err = fmt.Fprintf(file, "%d\n%d\n%s\n", l.ownerPID, l.sshPID, started)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+	return file.Name(), nil
+}
+
+// release removes the lock file
+func (l *tunnelLock) release() error {
+	if err := os.Remove(l.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove lock file: %w", err)
+	}
+	return nil
+}
+
+// removeStaleLock removes a tunnel's lock file if no process recorded in it
+// is alive
+func removeStaleLock(dir, name string, processes process.Enumerator) error {
+	path := filepath.Join(dir, name+".lock")
+	if lockHolder(path, processes) > 0 {
+		return nil
+	}
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove stale lock file: %w", err)
+	}
+	return nil
+}
+
+// lockHolder returns the ID of a live process recorded in a lock file, or
+// zero if the lock is stale or missing. An SSH process whose start time
+// differs from the recorded one is another process given its ID, as after a
+// reboot, and does not hold the lock.
+func lockHolder(path string, processes process.Enumerator) int {
+	record := readLock(path)
+	if record.ownerPID > 0 && processAlive(record.ownerPID) {
+		return record.ownerPID
+	}
+	if _, alive := record.liveSSHProcess(processes); alive {
+		return record.sshPID
+	}
+	return 0
+}
+
+// readLock returns what a lock file records, with zero for anything that
+// cannot be read
+func readLock(path string) lockRecord {
+	var record lockRecord
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return record
+	}
+
+	fields := strings.Fields(string(data))
+	if len(fields) > 0 {
+		record.ownerPID, _ = strconv.Atoi(fields[0])
+	}
+	if len(fields) > 1 {
+		record.sshPID, _ = strconv.Atoi(fields[1])
+	}
+	if len(fields) > 2 {
+		record.sshStarted, _ = time.Parse(time.RFC3339Nano, fields[2])
+	}
+	return record
+}
+
+// processAlive reports whether a process with the given ID exists
+func processAlive(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	if runtime.GOOS == "windows" {
+		// FindProcess opens the process, which fails once it has exited
+		process.Release()
+		return true
+	}
+
+	err = process.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
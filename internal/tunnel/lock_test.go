@@ -0,0 +1,179 @@
+package tunnel
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lerndmina/SSH-Tunnel/internal/process"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAcquireLockTwice(t *testing.T) {
+	dir := t.TempDir()
+
+	lock, err := acquireLock(dir, "home", process.System())
+	require.NoError(t, err)
+
+	_, err = acquireLock(dir, "home", process.System())
+	require.ErrorIs(t, err, ErrAlreadyRunning)
+	assert.Contains(t, err.Error(), fmt.Sprintf("tunnel 'home' is already running in another process (pid %d)", os.Getpid()))
+
+	// Other tunnels are unaffected
+	other, err := acquireLock(dir, "work", process.System())
+	require.NoError(t, err)
+	require.NoError(t, other.release())
+
+	require.NoError(t, lock.release())
+	lock, err = acquireLock(dir, "home", process.System())
+	require.NoError(t, err)
+	require.NoError(t, lock.release())
+}
+
+func TestAcquireLockReplacesStaleLock(t *testing.T) {
+	dir := t.TempDir()
+
+	// A process that has already exited
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	require.NoError(t, cmd.Run())
+	dead := cmd.Process.Pid
+
+	path := filepath.Join(dir, "home.lock")
+	require.NoError(t, os.WriteFile(path, []byte(fmt.Sprintf("%d\n%d\n", dead, 0)), 0600))
+
+	lock, err := acquireLock(dir, "home", process.System())
+	require.NoError(t, err)
+	defer lock.release()
+
+	record := readLock(path)
+	assert.Equal(t, os.Getpid(), record.ownerPID)
+	assert.Zero(t, record.sshPID)
+}
+
+func TestAcquireLockIgnoresReusedProcessID(t *testing.T) {
+	dir := t.TempDir()
+	started, err := process.System().StartTime(os.Getpid())
+	require.NoError(t, err)
+
+	// The owner has exited, and the tunnel's SSH process ID went to this
+	// test process after a reboot
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	require.NoError(t, cmd.Run())
+	dead := cmd.Process.Pid
+	path := filepath.Join(dir, "home.lock")
+	recorded := started.Add(-time.Hour).UTC().Format(time.RFC3339Nano)
+	require.NoError(t, os.WriteFile(path, []byte(fmt.Sprintf("%d\n%d\n%s\n", dead, os.Getpid(), recorded)), 0600))
+
+	lock, err := acquireLock(dir, "home", process.System())
+	require.NoError(t, err)
+	require.NoError(t, lock.release())
+
+	// Recorded with its own start time, the process holds the lock
+	recorded = started.UTC().Format(time.RFC3339Nano)
+	require.NoError(t, os.WriteFile(path, []byte(fmt.Sprintf("%d\n%d\n%s\n", dead, os.Getpid(), recorded)), 0600))
+	_, err = acquireLock(dir, "home", process.System())
+	require.ErrorIs(t, err, ErrAlreadyRunning)
+}
+
+func TestStartLockedByAnotherManager(t *testing.T) {
+	first := newTestManager(t, testConfig("shared"))
+	first.command = helperCommand("run")
+	second := NewManagerWithConfig(first.configManager)
+	second.command = helperCommand("run")
+
+	require.NoError(t, first.Start("shared"))
+
+	record := readLock(filepath.Join(LockDir(first.configManager.GetConfigPath()), "shared.lock"))
+	assert.Equal(t, os.Getpid(), record.ownerPID)
+	assert.NotZero(t, record.sshPID)
+	assert.WithinDuration(t, time.Now(), record.sshStarted, time.Minute)
+
+	err := second.Start("shared")
+	require.ErrorIs(t, err, ErrAlreadyRunning)
+
+	require.NoError(t, first.Stop("shared"))
+	require.NoError(t, second.Start("shared"))
+	require.NoError(t, second.Stop("shared"))
+}
+
+func TestRestartTunnelStartedByAnotherManager(t *testing.T) {
+	cfg := testConfig("shared")
+	cfg.Service.AutoReconnect = false
+	first := newTestManager(t, cfg)
+	first.command = helperCommand("run")
+	require.NoError(t, first.Start("shared"))
+
+	// The start command that spawned the SSH process has since exited
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	require.NoError(t, cmd.Run())
+	path := filepath.Join(LockDir(first.configManager.GetConfigPath()), "shared.lock")
+	before := readLock(path)
+	recorded := before.sshStarted.UTC().Format(time.RFC3339Nano)
+	require.NoError(t, os.WriteFile(path, []byte(fmt.Sprintf("%d\n%d\n%s\n", cmd.Process.Pid, before.sshPID, recorded)), 0600))
+
+	second := NewManagerWithConfig(first.configManager)
+	second.command = helperCommand("run")
+	require.NoError(t, second.Restart("shared"))
+	defer second.Stop("shared")
+
+	status, err := second.GetStatus("shared")
+	require.NoError(t, err)
+	assert.Equal(t, StatusRunning, status.Status)
+	assert.NotEqual(t, before.sshPID, status.PID)
+	assert.False(t, processAlive(before.sshPID))
+	assert.Equal(t, os.Getpid(), readLock(path).ownerPID)
+}
+
+func TestStatusOfTunnelStartedElsewhere(t *testing.T) {
+	m := newTestManager(t, testConfig("elsewhere"))
+
+	status, err := m.GetStatus("elsewhere")
+	require.NoError(t, err)
+	assert.Equal(t, StatusStopped, status.Status)
+
+	// An earlier invocation left the tunnel running; this test process
+	// stands in for its SSH process
+	started := time.Now().Add(-90 * time.Minute)
+	m.processes = &fakeProcesses{processes: []process.Process{{PID: os.Getpid(), Started: started}}}
+	dir := LockDir(m.configManager.GetConfigPath())
+	require.NoError(t, os.MkdirAll(dir, 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "elsewhere.lock"), []byte(fmt.Sprintf("999999999\n%d\n", os.Getpid())), 0600))
+
+	status, err = m.GetStatus("elsewhere")
+	require.NoError(t, err)
+	assert.Equal(t, StatusRunning, status.Status)
+	assert.Equal(t, os.Getpid(), status.PID)
+	assert.Equal(t, started, status.StartTime)
+	assert.InDelta(t, 90*time.Minute, status.Uptime, float64(time.Minute))
+	assert.Equal(t, "1h 30m", status.UptimeHuman())
+}
+
+func TestStatusOfReusedProcessID(t *testing.T) {
+	m := newTestManager(t, testConfig("reused"))
+
+	// The tunnel's SSH process exited and its ID went to this test process,
+	// which started an hour after the recorded one
+	started := time.Now().Add(-30 * time.Minute)
+	m.processes = &fakeProcesses{processes: []process.Process{{PID: os.Getpid(), Started: started}}}
+	dir := LockDir(m.configManager.GetConfigPath())
+	require.NoError(t, os.MkdirAll(dir, 0700))
+	recorded := started.Add(-time.Hour).UTC().Format(time.RFC3339Nano)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "reused.lock"), []byte(fmt.Sprintf("999999999\n%d\n%s\n", os.Getpid(), recorded)), 0600))
+
+	status, err := m.GetStatus("reused")
+	require.NoError(t, err)
+	assert.Equal(t, StatusStopped, status.Status)
+	assert.Zero(t, status.PID)
+
+	// Recorded within a second of the process's start, it is the tunnel's
+	recorded = started.Add(500 * time.Millisecond).UTC().Format(time.RFC3339Nano)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "reused.lock"), []byte(fmt.Sprintf("999999999\n%d\n%s\n", os.Getpid(), recorded)), 0600))
+	status, err = m.GetStatus("reused")
+	require.NoError(t, err)
+	assert.Equal(t, StatusRunning, status.Status)
+	assert.Equal(t, os.Getpid(), status.PID)
+}
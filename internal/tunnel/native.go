@@ -0,0 +1,53 @@
+package tunnel
+
+import (
+	"github.com/lerndmina/SSH-Tunnel/internal/config"
+	"github.com/lerndmina/SSH-Tunnel/internal/ssh"
+)
+
+// NativeTarget is the cloud server as native (non-ssh binary) SSH
+// connections reach it
+type NativeTarget struct {
+	Host    string
+	Port    int
+	User    string
+	KeyPath string
+}
+
+// ResolveNativeTarget returns where native SSH connections for a tunnel go.
+// With ssh.config_file set, a HostName there resolves the cloud server
+// address as an alias, and the file fills in settings the tunnel leaves
+// empty; the tunnel's own settings win otherwise, as they do for ssh.
+func ResolveNativeTarget(cfg *config.Config) (NativeTarget, error) {
+	target := NativeTarget{
+		Host:    cfg.CloudServer.IP,
+		Port:    cfg.CloudServer.Port,
+		User:    cfg.CloudServer.User,
+		KeyPath: cfg.SSH.PrivateKeyPath,
+	}
+
+	if cfg.SSH.ConfigFile != "" {
+		hc, err := ssh.ReadHostConfig(config.ExpandPath(cfg.SSH.ConfigFile), target.Host)
+		if err != nil {
+			return target, err
+		}
+		if hc.HostName != "" {
+			target.Host = hc.HostName
+		}
+		if target.Port == 0 {
+			target.Port = hc.Port
+		}
+		if target.User == "" {
+			target.User = hc.User
+		}
+		if target.KeyPath == "" {
+			target.KeyPath = hc.IdentityFile
+		}
+	}
+
+	if target.Port == 0 {
+		target.Port = 22
+	}
+	target.KeyPath = config.ExpandPath(target.KeyPath)
+	return target, nil
+}
@@ -0,0 +1,130 @@
+package tunnel
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/lerndmina/SSH-Tunnel/internal/config"
+	"github.com/lerndmina/SSH-Tunnel/internal/process"
+)
+
+// TunnelProcess is a running ssh process with the command line this tool
+// generates for tunnels, whether or not this manager started it
+type TunnelProcess struct {
+	process.Process
+	// Tunnel is the configured tunnel the process runs, or empty if it
+	// matches none, as for tunnels started from another config directory
+	Tunnel string
+	// Outdated is set when the process has a tunnel's reverse forward and
+	// destination but not its current arguments, as when the config changed
+	// after the process started
+	Outdated bool
+	// Forward is the reverse forward, e.g. "2222:localhost:22"
+	Forward string
+	// Destination is the user@host the process connects to
+	Destination string
+}
+
+// tunnelForward returns the reverse forward of an ssh command line shaped
+// like the ones BuildSSHArgs generates, or false if it is not one
+func tunnelForward(proc process.Process) (string, bool) {
+	if proc.Name() != "ssh" || len(proc.Args) < 2 {
+		return "", false
+	}
+	args := proc.Args[1:]
+	if !slices.Contains(args, "-N") || !slices.Contains(args, "ExitOnForwardFailure=yes") {
+		return "", false
+	}
+	for i, arg := range args[:len(args)-1] {
+		if arg == "-R" && strings.HasSuffix(args[i+1], ":localhost:22") {
+			return args[i+1], true
+		}
+	}
+	return "", false
+}
+
+// FindTunnelProcesses picks the tunnel ssh processes out of a process
+// table and labels each with the config it runs: the one whose arguments
+// it has exactly, or else the one with its reverse forward and destination.
+func FindTunnelProcesses(processes []process.Process, configs []*config.Config) []TunnelProcess {
+	self := os.Getpid()
+
+	var found []TunnelProcess
+	for _, proc := range processes {
+		forward, ok := tunnelForward(proc)
+		if !ok || proc.PID == self {
+			continue
+		}
+		tp := TunnelProcess{Process: proc, Forward: forward, Destination: proc.Args[len(proc.Args)-1]}
+
+		for _, cfg := range configs {
+			if slices.Equal(proc.Args[1:], BuildSSHArgs(cfg)) {
+				tp.Tunnel = cfg.TunnelName
+				break
+			}
+		}
+		if tp.Tunnel == "" {
+			for _, cfg := range configs {
+				destination := fmt.Sprintf("%s@%s", cfg.CloudServer.User, cfg.CloudServer.IP)
+				if forward == fmt.Sprintf("%d:localhost:22", cfg.LocalServer.ReversePort) && tp.Destination == destination {
+					tp.Tunnel = cfg.TunnelName
+					tp.Outdated = true
+					break
+				}
+			}
+		}
+
+		found = append(found, tp)
+	}
+	return found
+}
+
+// Processes lists the tunnel ssh processes running on this machine,
+// labelled with the configured tunnels they run. Unlike GetStatus it
+// reflects the process table rather than this manager's state, so it also
+// shows tunnels started by other processes and orphans of a crashed manager.
+func (m *Manager) Processes() ([]TunnelProcess, error) {
+	processes, err := m.processes.Processes()
+	if err != nil {
+		return nil, err
+	}
+
+	names := m.configManager.ListConfigs()
+	sort.Strings(names)
+	configs := make([]*config.Config, 0, len(names))
+	groups := make(map[string][]*config.Config)
+	var groupNames []string
+	for _, name := range names {
+		cfg, err := m.configManager.GetConfig(name)
+		if err != nil {
+			continue
+		}
+		configs = append(configs, cfg)
+		if cfg.Group != "" {
+			if _, seen := groups[cfg.Group]; !seen {
+				groupNames = append(groupNames, cfg.Group)
+			}
+			groups[cfg.Group] = append(groups[cfg.Group], cfg)
+		}
+	}
+
+	// A group's shared process runs with its members' merged config, and is
+	// labelled with all of their names
+	for _, group := range groupNames {
+		merged, err := config.MergeGroup(group, groups[group])
+		if err != nil {
+			continue
+		}
+		members := make([]string, len(groups[group]))
+		for i, cfg := range groups[group] {
+			members[i] = cfg.TunnelName
+		}
+		merged.TunnelName = strings.Join(members, ",")
+		configs = append(configs, merged)
+	}
+
+	return FindTunnelProcesses(processes, configs), nil
+}
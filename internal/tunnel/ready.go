@@ -0,0 +1,109 @@
+package tunnel
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/lerndmina/SSH-Tunnel/internal/config"
+	"github.com/lerndmina/SSH-Tunnel/internal/ssh"
+	cryptossh "golang.org/x/crypto/ssh"
+)
+
+// readyPollInterval is how often WaitReady re-checks a starting tunnel
+const readyPollInterval = 250 * time.Millisecond
+
+// probeFunc checks that a tunnel's reverse forward accepts connections on
+// the cloud server
+type probeFunc func(ctx context.Context, cfg *config.Config) error
+
+// probeReversePort connects to the cloud server over SSH and opens a
+// connection to the reverse port from there, as a client of the tunnel
+// would
+func probeReversePort(ctx context.Context, cfg *config.Config) error {
+	client, err := dialCloud(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	address := net.JoinHostPort("127.0.0.1", strconv.Itoa(cfg.LocalServer.ReversePort))
+	conn, err := client.Dial("tcp", address)
+	if err != nil {
+		return fmt.Errorf("reverse port %d is not open on %s: %w", cfg.LocalServer.ReversePort, cfg.CloudServer.IP, err)
+	}
+	return conn.Close()
+}
+
+// dialCloud connects to a tunnel's cloud server over SSH, within ctx's
+// deadline if it has one
+func dialCloud(ctx context.Context, cfg *config.Config) (*cryptossh.Client, error) {
+	keyManager := ssh.NewKeyManager()
+	keyManager.SetAlgorithms(ssh.Algorithms{
+		Ciphers:      cfg.SSH.CipherList(),
+		MACs:         cfg.SSH.MACList(),
+		KeyExchanges: cfg.SSH.KexList(),
+	})
+	keyManager.SetBindAddress(cfg.SSH.BindAddress)
+	keyManager.SetKnownHostsFile(config.ExpandPath(cfg.SSH.KnownHostsFile))
+	keyManager.SetInsecureSkipHostKeyCheck(cfg.SSH.InsecureSkipHostKeyCheck)
+	if deadline, ok := ctx.Deadline(); ok {
+		keyManager.SetTimeout(time.Until(deadline))
+	}
+
+	target, err := ResolveNativeTarget(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return keyManager.Connect(target.Host, target.User, target.KeyPath, target.Port)
+}
+
+// WaitReady waits until a started tunnel is healthy: its SSH process is
+// running, the reverse port answers on the cloud server and, if configured,
+// the SOCKS proxy works. It fails as soon as the SSH process exits, with
+// SSH's error, or with the last failed check once ctx is done.
+func (m *Manager) WaitReady(ctx context.Context, tunnelName string) error {
+	cfg, err := m.configManager.GetConfig(tunnelName)
+	if err != nil {
+		return err
+	}
+
+	probe := m.probe
+	if probe == nil {
+		probe = probeReversePort
+	}
+
+	ticker := time.NewTicker(readyPollInterval)
+	defer ticker.Stop()
+
+	var lastErr error
+	for {
+		status, err := m.GetStatus(tunnelName)
+		if err != nil {
+			return err
+		}
+		if status.Status != StatusRunning {
+			if status.Error != nil {
+				return fmt.Errorf("tunnel '%s' failed to come up: %w", tunnelName, status.Error)
+			}
+			return fmt.Errorf("tunnel '%s' failed to come up: it is %s", tunnelName, status.Status)
+		}
+
+		if lastErr = m.HealthCheck(tunnelName); lastErr == nil {
+			if lastErr = probe(ctx, cfg); lastErr == nil {
+				return nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			if lastErr == nil {
+				lastErr = ctx.Err()
+			}
+			return fmt.Errorf("tunnel '%s' is not ready: %w", tunnelName, lastErr)
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package tunnel
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lerndmina/SSH-Tunnel/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWaitReadyFailsOnForwardFailure(t *testing.T) {
+	cfg := testConfig("busy")
+	cfg.Service.AutoReconnect = false
+	m := newTestManager(t, cfg)
+	m.command = helperCommand("forwardfail")
+	m.probe = func(ctx context.Context, cfg *config.Config) error {
+		return errors.New("reverse port 2222 is not open")
+	}
+
+	require.NoError(t, m.Start("busy"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err := m.WaitReady(ctx, "busy")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to come up")
+	assert.Contains(t, err.Error(), "remote port forwarding failed for listen port 2222")
+}
+
+func TestWaitReadyTimesOutWithLastCheckError(t *testing.T) {
+	m := newTestManager(t, testConfig("slow"))
+	m.command = helperCommand("run")
+	m.probe = func(ctx context.Context, cfg *config.Config) error {
+		return errors.New("reverse port 2222 is not open")
+	}
+
+	require.NoError(t, m.Start("slow"))
+	t.Cleanup(func() { m.Stop("slow") })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	err := m.WaitReady(ctx, "slow")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "is not ready: reverse port 2222 is not open")
+}
+
+func TestWaitReadySucceedsOnceProbePasses(t *testing.T) {
+	m := newTestManager(t, testConfig("home"))
+	m.command = helperCommand("run")
+	probes := 0
+	m.probe = func(ctx context.Context, cfg *config.Config) error {
+		if probes++; probes < 3 {
+			return errors.New("reverse port 2222 is not open")
+		}
+		return nil
+	}
+
+	require.NoError(t, m.Start("home"))
+	t.Cleanup(func() { m.Stop("home") })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	require.NoError(t, m.WaitReady(ctx, "home"))
+	assert.Equal(t, 3, probes)
+}
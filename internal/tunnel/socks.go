@@ -0,0 +1,189 @@
+package tunnel
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/lerndmina/SSH-Tunnel/internal/config"
+)
+
+// ErrSOCKSUnhealthy is wrapped by health check errors for the SOCKS proxy, so
+// they can be told apart from reverse-forward failures
+var ErrSOCKSUnhealthy = errors.New("SOCKS proxy unhealthy")
+
+// DefaultSOCKSCheckTimeout bounds a SOCKS health check when the context has
+// no deadline
+const DefaultSOCKSCheckTimeout = 5 * time.Second
+
+// socksReplies describes SOCKS5 reply codes
+var socksReplies = map[byte]string{
+	1: "general SOCKS server failure",
+	2: "connection not allowed by ruleset",
+	3: "network unreachable",
+	4: "host unreachable",
+	5: "connection refused",
+	6: "TTL expired",
+	7: "command not supported",
+	8: "address type not supported",
+}
+
+// SOCKSAddress returns the address to reach a tunnel's SOCKS proxy on, given
+// its bind address and port
+func SOCKSAddress(bindAddr string, port int) string {
+	switch bindAddr {
+	case "":
+		bindAddr = config.DefaultBindAddr
+	case "*", "0.0.0.0", "::":
+		bindAddr = "localhost"
+	}
+	return net.JoinHostPort(bindAddr, strconv.Itoa(port))
+}
+
+// CheckSOCKS performs a SOCKS5 handshake with the proxy at proxyAddr. If
+// checkURL is set, the URL is also fetched through the proxy.
+func CheckSOCKS(ctx context.Context, proxyAddr, checkURL string) error {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, DefaultSOCKSCheckTimeout)
+		defer cancel()
+	}
+
+	conn, err := socksHandshake(ctx, proxyAddr)
+	if err != nil {
+		return err
+	}
+	conn.Close()
+
+	if checkURL == "" {
+		return nil
+	}
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, target string) (net.Conn, error) {
+				return socksConnect(ctx, proxyAddr, target)
+			},
+		},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, checkURL, nil)
+	if err != nil {
+		return fmt.Errorf("invalid check URL: %w", err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch %s through proxy: %w", checkURL, err)
+	}
+	resp.Body.Close()
+
+	return nil
+}
+
+// socksHandshake connects to the proxy and negotiates SOCKS5 with no
+// authentication
+func socksHandshake(ctx context.Context, proxyAddr string) (net.Conn, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", proxyAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to proxy: %w", err)
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if _, err := conn.Write([]byte{5, 1, 0}); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to send SOCKS greeting: %w", err)
+	}
+
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("no SOCKS greeting reply: %w", err)
+	}
+	if reply[0] != 5 {
+		conn.Close()
+		return nil, fmt.Errorf("not a SOCKS5 proxy (version %d)", reply[0])
+	}
+	if reply[1] != 0 {
+		conn.Close()
+		return nil, fmt.Errorf("proxy requires unsupported authentication method %d", reply[1])
+	}
+
+	return conn, nil
+}
+
+// socksConnect opens a connection to target through the SOCKS5 proxy
+func socksConnect(ctx context.Context, proxyAddr, target string) (net.Conn, error) {
+	host, portStr, err := net.SplitHostPort(target)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || len(host) > 255 {
+		return nil, fmt.Errorf("invalid target address %q", target)
+	}
+
+	conn, err := socksHandshake(ctx, proxyAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	req := []byte{5, 1, 0, 3, byte(len(host))}
+	req = append(req, host...)
+	req = binary.BigEndian.AppendUint16(req, uint16(port))
+	if _, err := conn.Write(req); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to send SOCKS connect: %w", err)
+	}
+
+	// VER REP RSV ATYP, then the bound address and port
+	reply := make([]byte, 4)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("no SOCKS connect reply: %w", err)
+	}
+	if reply[1] != 0 {
+		conn.Close()
+		reason, ok := socksReplies[reply[1]]
+		if !ok {
+			reason = fmt.Sprintf("reply code %d", reply[1])
+		}
+		return nil, fmt.Errorf("proxy could not connect to %s: %s", target, reason)
+	}
+
+	var addrLen int
+	switch reply[3] {
+	case 1:
+		addrLen = net.IPv4len
+	case 4:
+		addrLen = net.IPv6len
+	case 3:
+		length := make([]byte, 1)
+		if _, err := io.ReadFull(conn, length); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		addrLen = int(length[0])
+	default:
+		conn.Close()
+		return nil, fmt.Errorf("unknown SOCKS address type %d", reply[3])
+	}
+	if _, err := io.ReadFull(conn, make([]byte, addrLen+2)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	// Clear the handshake deadline; the HTTP client manages its own
+	conn.SetDeadline(time.Time{})
+	return conn, nil
+}
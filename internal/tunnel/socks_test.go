@@ -0,0 +1,146 @@
+package tunnel
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startMockSOCKS starts a minimal SOCKS5 proxy supporting CONNECT to domain
+// names and returns its port
+func startMockSOCKS(t *testing.T) int {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveMockSOCKS(conn)
+		}
+	}()
+
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+func serveMockSOCKS(conn net.Conn) {
+	defer conn.Close()
+
+	// Greeting: VER NMETHODS METHODS...
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return
+	}
+	if _, err := io.ReadFull(conn, make([]byte, header[1])); err != nil {
+		return
+	}
+	conn.Write([]byte{5, 0})
+
+	// Request: VER CMD RSV ATYP=3 LEN HOST PORT
+	req := make([]byte, 5)
+	if _, err := io.ReadFull(conn, req); err != nil {
+		return
+	}
+	host := make([]byte, req[4])
+	if _, err := io.ReadFull(conn, host); err != nil {
+		return
+	}
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(conn, port); err != nil {
+		return
+	}
+
+	target, err := net.Dial("tcp", net.JoinHostPort(string(host), strconv.Itoa(int(binary.BigEndian.Uint16(port)))))
+	if err != nil {
+		conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	defer target.Close()
+	conn.Write([]byte{5, 0, 0, 1, 127, 0, 0, 1, 0, 0})
+
+	go io.Copy(target, conn)
+	io.Copy(conn, target)
+}
+
+func TestCheckSOCKSHandshake(t *testing.T) {
+	port := startMockSOCKS(t)
+	assert.NoError(t, CheckSOCKS(context.Background(), SOCKSAddress("", port), ""))
+}
+
+func TestCheckSOCKSFetchesURL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	port := startMockSOCKS(t)
+	assert.NoError(t, CheckSOCKS(context.Background(), SOCKSAddress("", port), server.URL))
+
+	// A target the proxy cannot reach is reported
+	unreachable, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := unreachable.Addr().String()
+	unreachable.Close()
+
+	err = CheckSOCKS(context.Background(), SOCKSAddress("", port), "http://"+addr+"/")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "connection refused")
+}
+
+func TestCheckSOCKSRejectsNonSOCKSServer(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Write([]byte("SSH-2.0-OpenSSH_9.6\r\n"))
+	}()
+
+	err = CheckSOCKS(context.Background(), listener.Addr().String(), "")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "not a SOCKS5 proxy")
+}
+
+func TestHealthCheckReportsSOCKSSeparately(t *testing.T) {
+	// Reserve a port with nothing listening on it
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	deadPort := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	cfg := testConfig("socks")
+	cfg.LocalServer.SOCKSPort = deadPort
+	m := newTestManager(t, cfg)
+	m.command = helperCommand("run")
+
+	require.NoError(t, m.Start("socks"))
+	defer m.Stop("socks")
+
+	err = m.HealthCheck("socks")
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrSOCKSUnhealthy))
+
+	status, err := m.GetStatus("socks")
+	require.NoError(t, err)
+	assert.Equal(t, StatusRunning, status.Status, "a broken proxy does not fail the reverse forward")
+	assert.Nil(t, status.Error)
+	assert.ErrorIs(t, status.SOCKSError, ErrSOCKSUnhealthy)
+}
@@ -0,0 +1,103 @@
+package tunnel
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/lerndmina/SSH-Tunnel/internal/ssh"
+)
+
+var (
+	// ErrAuthFailed is a cloud server refusing the tunnel's key
+	ErrAuthFailed = errors.New("authentication failed")
+	// ErrConnectionRefused is nothing listening on the cloud server's SSH port
+	ErrConnectionRefused = errors.New("connection refused")
+	// ErrForwardFailed is the cloud server refusing a port forward, usually
+	// because the port is already in use
+	ErrForwardFailed = errors.New("port forwarding failed")
+	// ErrHostKeyMismatch is the cloud server's host key failing verification.
+	// It is ssh.ErrHostKeyChanged, so errors.Is matches the failure whether
+	// the ssh process or an in-process connection reported it.
+	ErrHostKeyMismatch = ssh.ErrHostKeyChanged
+)
+
+// sshCausePatterns map a substring of SSH output to the failure it reports.
+// They are checked in order; the first match wins.
+var sshCausePatterns = []struct {
+	substr string
+	cause  error
+}{
+	{"permission denied", ErrAuthFailed},
+	{"too many authentication failures", ErrAuthFailed},
+	{"no more authentication methods", ErrAuthFailed},
+	{"host key verification failed", ErrHostKeyMismatch},
+	{"remote host identification has changed", ErrHostKeyMismatch},
+	{"connection refused", ErrConnectionRefused},
+	{"port forwarding failed", ErrForwardFailed},
+	{"cannot listen to port", ErrForwardFailed},
+	{"could not resolve hostname", ErrHostUnresolved},
+}
+
+// classifySSHCause returns the failure a line of SSH output reports, or nil
+func classifySSHCause(line string) error {
+	lower := strings.ToLower(line)
+	for _, p := range sshCausePatterns {
+		if strings.Contains(lower, p.substr) {
+			return p.cause
+		}
+	}
+	return nil
+}
+
+// SSHExitError describes an SSH process that exited. Cause is the failure
+// recognised in SSH's output, if any, so errors.Is(err, ErrAuthFailed) and
+// the like tell a refused key from a dropped connection.
+type SSHExitError struct {
+	// ExitCode is the process's exit status, or -1 if it was killed
+	ExitCode int
+	// Output is the line of SSH output the failure was recognised from, or
+	// else the last warning or error SSH printed
+	Output string
+	Cause  error
+	Err    error
+}
+
+// newSSHExitError builds the error for an SSH process that exited with err,
+// from the output it printed
+func newSSHExitError(err error, output *outputCapture) *SSHExitError {
+	if err == nil {
+		err = fmt.Errorf("exit status 0")
+	}
+	e := &SSHExitError{Err: err}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		e.ExitCode = exitErr.ExitCode()
+	}
+
+	e.Output, e.Cause = output.Cause()
+	if e.Cause == nil {
+		e.Output = output.LastError()
+	}
+	return e
+}
+
+func (e *SSHExitError) Error() string {
+	msg := e.Err.Error()
+	if e.Cause != nil {
+		msg = fmt.Sprintf("%v (%s)", e.Cause, msg)
+	}
+	if e.Output != "" {
+		msg += ": " + e.Output
+	}
+	return msg
+}
+
+func (e *SSHExitError) Unwrap() []error {
+	if e.Cause == nil {
+		return []error{e.Err}
+	}
+	return []error{e.Cause, e.Err}
+}
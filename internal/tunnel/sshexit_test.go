@@ -0,0 +1,84 @@
+package tunnel
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/lerndmina/SSH-Tunnel/internal/ssh"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSSHExitErrorClassifiesOutput(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		cause  error
+		line   string
+	}{
+		{
+			name:   "auth failure",
+			output: "Warning: Permanently added '203.0.113.1' (ED25519) to the list of known hosts.\ntunnel@203.0.113.1: Permission denied (publickey).\n",
+			cause:  ErrAuthFailed,
+			line:   "tunnel@203.0.113.1: Permission denied (publickey).",
+		},
+		{
+			name:   "connection refused",
+			output: "ssh: connect to host 203.0.113.1 port 22: Connection refused\n",
+			cause:  ErrConnectionRefused,
+			line:   "ssh: connect to host 203.0.113.1 port 22: Connection refused",
+		},
+		{
+			name:   "forward failed",
+			output: "Error: remote port forwarding failed for listen port 2222\n",
+			cause:  ErrForwardFailed,
+			line:   "Error: remote port forwarding failed for listen port 2222",
+		},
+		{
+			name:   "host key mismatch",
+			output: "@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@\n@    WARNING: REMOTE HOST IDENTIFICATION HAS CHANGED!     @\nHost key for 203.0.113.1 has changed and you have requested strict checking.\nHost key verification failed.\n",
+			// The same error an in-process connection reports
+			cause: ssh.ErrHostKeyChanged,
+			line:  "Host key verification failed.",
+		},
+		{
+			// A later disconnect message does not hide the reason
+			name:   "cause before disconnect",
+			output: "Error: remote port forwarding failed for listen port 2222\nConnection closed by 203.0.113.1 port 22\n",
+			cause:  ErrForwardFailed,
+			line:   "Error: remote port forwarding failed for listen port 2222",
+		},
+		{
+			name:   "host unresolved",
+			output: "ssh: Could not resolve hostname home.dyndns.example: Name or service not known\n",
+			cause:  ErrHostUnresolved,
+			line:   "ssh: Could not resolve hostname home.dyndns.example: Name or service not known",
+		},
+		{
+			name:   "network drop",
+			output: "client_loop: send disconnect: Broken pipe\n",
+			line:   "client_loop: send disconnect: Broken pipe",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, err := newOutputCapture("test", "")
+			assert.NoError(t, err)
+			output.Write([]byte(tt.output))
+			output.Close()
+
+			exitErr := newSSHExitError(errors.New("exit status 255"), output)
+			assert.Equal(t, tt.line, exitErr.Output)
+			assert.Contains(t, exitErr.Error(), "exit status 255")
+			if tt.cause == nil {
+				assert.Nil(t, exitErr.Cause)
+				for _, cause := range []error{ErrAuthFailed, ErrConnectionRefused, ErrForwardFailed, ErrHostKeyMismatch, ErrHostUnresolved} {
+					assert.NotErrorIs(t, exitErr, cause)
+				}
+				return
+			}
+			assert.ErrorIs(t, exitErr, tt.cause)
+			assert.Contains(t, exitErr.Error(), tt.cause.Error())
+		})
+	}
+}
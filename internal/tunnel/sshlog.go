@@ -0,0 +1,185 @@
+package tunnel
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/lerndmina/SSH-Tunnel/pkg/logger"
+	"github.com/sirupsen/logrus"
+)
+
+// sshLinePattern maps a substring of SSH output to a log level
+type sshLinePattern struct {
+	substr string
+	level  logger.LogLevel
+}
+
+// sshLinePatterns are checked in order; the first match wins
+var sshLinePatterns = []sshLinePattern{
+	{"permission denied", logger.ErrorLevel},
+	{"connection refused", logger.ErrorLevel},
+	{"could not resolve hostname", logger.ErrorLevel},
+	{"host key verification failed", logger.ErrorLevel},
+	{"remote host identification has changed", logger.ErrorLevel},
+	{"remote port forwarding failed", logger.ErrorLevel},
+	{"port forwarding failed", logger.ErrorLevel},
+	{"connection timed out", logger.ErrorLevel},
+	{"operation timed out", logger.ErrorLevel},
+	{"no route to host", logger.ErrorLevel},
+	{"network is unreachable", logger.ErrorLevel},
+	{"connection reset", logger.ErrorLevel},
+	{"broken pipe", logger.ErrorLevel},
+	{"bad permissions", logger.ErrorLevel},
+	{"load key", logger.ErrorLevel},
+	{"warning:", logger.WarnLevel},
+	{"timeout, server", logger.WarnLevel},
+	{"administratively prohibited", logger.WarnLevel},
+	{"connection closed by", logger.WarnLevel},
+	{"client_loop:", logger.WarnLevel},
+	{"disconnected", logger.WarnLevel},
+}
+
+// ClassifySSHLine returns the severity of a line of SSH output
+func ClassifySSHLine(line string) logger.LogLevel {
+	lower := strings.ToLower(line)
+	for _, p := range sshLinePatterns {
+		if strings.Contains(lower, p.substr) {
+			return p.level
+		}
+	}
+	return logger.InfoLevel
+}
+
+// LogDir returns the directory holding captured SSH output
+func LogDir(configPath string) string {
+	return filepath.Join(configPath, "logs")
+}
+
+// LogFile returns the path of the captured SSH output for a tunnel
+func LogFile(configPath, tunnelName string) string {
+	return filepath.Join(LogDir(configPath), tunnelName+".log")
+}
+
+// outputCapture receives the SSH process output, appends it untouched to the
+// tunnel's log file, or each member's for a group, and re-emits each line
+// through the structured logger
+type outputCapture struct {
+	tunnelName string
+	files      []*os.File
+	partial    []byte
+	// lastError is the most recent line classified as a warning or error
+	lastError string
+	// cause is the most recent failure recognised in the output, and
+	// causeLine the line it was recognised from
+	cause     error
+	causeLine string
+	mu        sync.Mutex
+}
+
+// newOutputCapture creates an output capture for a tunnel, appending to
+// every log path given. Empty paths are skipped; with none, output is only
+// re-emitted through the logger.
+func newOutputCapture(tunnelName string, logPaths ...string) (*outputCapture, error) {
+	c := &outputCapture{tunnelName: tunnelName}
+	for _, logPath := range logPaths {
+		if logPath == "" {
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(logPath), 0755); err != nil {
+			return c, fmt.Errorf("failed to create log directory: %w", err)
+		}
+
+		file, err := os.OpenFile(logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			return c, fmt.Errorf("failed to open log file: %w", err)
+		}
+		c.files = append(c.files, file)
+	}
+
+	return c, nil
+}
+
+// Write implements io.Writer
+func (c *outputCapture) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, file := range c.files {
+		if _, err := file.Write(p); err != nil {
+			logger.Debugf("Failed to write SSH output for tunnel '%s': %v", c.tunnelName, err)
+		}
+	}
+
+	c.partial = append(c.partial, p...)
+	for {
+		idx := bytes.IndexByte(c.partial, '\n')
+		if idx < 0 {
+			break
+		}
+		c.emit(string(c.partial[:idx]))
+		c.partial = c.partial[idx+1:]
+	}
+
+	return len(p), nil
+}
+
+// Close flushes any incomplete line and closes the log files
+func (c *outputCapture) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.partial) > 0 {
+		c.emit(string(c.partial))
+		c.partial = nil
+	}
+
+	var errs []error
+	for _, file := range c.files {
+		errs = append(errs, file.Close())
+	}
+	c.files = nil
+	return errors.Join(errs...)
+}
+
+// emit logs a single line of SSH output at its classified level
+func (c *outputCapture) emit(line string) {
+	line = strings.TrimRight(line, "\r")
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	level := ClassifySSHLine(line)
+	if level <= logger.WarnLevel {
+		c.lastError = strings.TrimSpace(line)
+	}
+	if cause := classifySSHCause(line); cause != nil {
+		c.cause, c.causeLine = cause, strings.TrimSpace(line)
+	}
+	logger.Log(level, logrus.Fields{"tunnel": c.tunnelName}, line)
+}
+
+// LastError returns the most recent warning or error SSH printed, or ""
+func (c *outputCapture) LastError() string {
+	if c == nil {
+		return ""
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lastError
+}
+
+// Cause returns the line of SSH output reporting the most recent failure
+// recognised in it, and the failure, or nil if there was none
+func (c *outputCapture) Cause() (line string, cause error) {
+	if c == nil {
+		return "", nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.causeLine, c.cause
+}
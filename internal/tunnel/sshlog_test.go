@@ -0,0 +1,53 @@
+package tunnel
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lerndmina/SSH-Tunnel/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassifySSHLine(t *testing.T) {
+	tests := []struct {
+		line  string
+		level logger.LogLevel
+	}{
+		{"Warning: Permanently added '203.0.113.1' (ED25519) to the list of known hosts.", logger.WarnLevel},
+		{"ssh: connect to host 203.0.113.1 port 22: Connection refused", logger.ErrorLevel},
+		{"user@203.0.113.1: Permission denied (publickey).", logger.ErrorLevel},
+		{"ssh: Could not resolve hostname cloud.example.com: Name or service not known", logger.ErrorLevel},
+		{"Error: remote port forwarding failed for listen port 2222", logger.ErrorLevel},
+		{"Host key verification failed.", logger.ErrorLevel},
+		{"Timeout, server 203.0.113.1 not responding.", logger.WarnLevel},
+		{"channel 0: open failed: administratively prohibited: open failed", logger.WarnLevel},
+		{"Connection closed by 203.0.113.1 port 22", logger.WarnLevel},
+		{"Authenticated to 203.0.113.1 ([203.0.113.1]:22) using \"publickey\".", logger.InfoLevel},
+		{"Allocated port 2222 for remote forward to localhost:22", logger.InfoLevel},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			assert.Equal(t, tt.level, ClassifySSHLine(tt.line))
+		})
+	}
+}
+
+func TestOutputCaptureKeepsRawOutput(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "logs", "test-tunnel.log")
+
+	capture, err := newOutputCapture("test-tunnel", logPath)
+	require.NoError(t, err)
+
+	_, err = capture.Write([]byte("Warning: Permanently added 'host'\nssh: connect to host"))
+	require.NoError(t, err)
+	_, err = capture.Write([]byte(" port 22: Connection refused\n"))
+	require.NoError(t, err)
+	require.NoError(t, capture.Close())
+
+	data, err := os.ReadFile(logPath)
+	require.NoError(t, err)
+	assert.Equal(t, "Warning: Permanently added 'host'\nssh: connect to host port 22: Connection refused\n", string(data))
+}
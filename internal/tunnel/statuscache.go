@@ -0,0 +1,79 @@
+package tunnel
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// statusCacheTTL is how long a snapshot of all tunnel statuses is served
+// before it is taken again, unless a tunnel changes state first
+const statusCacheTTL = time.Second
+
+// statusCache holds a snapshot of every tunnel's status, so that status
+// readers polling many tunnels take the manager and tunnel locks once per
+// snapshot rather than once per tunnel and read
+type statusCache struct {
+	// generation is bumped whenever a tunnel's state changes
+	generation atomic.Uint64
+	// snapshots counts the snapshots taken
+	snapshots atomic.Uint64
+
+	mu       sync.Mutex
+	statuses map[string]*TunnelStatus
+	taken    time.Time
+	takenGen uint64
+}
+
+// invalidate marks the snapshot as stale. It only touches an atomic counter,
+// so it may be called with any lock held.
+func (c *statusCache) invalidate() {
+	if c != nil {
+		c.generation.Add(1)
+	}
+}
+
+// get returns the current snapshot, taking a new one with snapshot if the
+// cached one is older than statusCacheTTL or a tunnel changed since
+func (c *statusCache) get(snapshot func() map[string]*TunnelStatus) map[string]*TunnelStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Read the generation before snapshotting: a change made meanwhile
+	// leaves the new snapshot marked stale rather than hiding the change
+	generation := c.generation.Load()
+	if c.statuses != nil && generation == c.takenGen && time.Since(c.taken) < statusCacheTTL {
+		return c.statuses
+	}
+
+	c.statuses = snapshot()
+	c.taken = time.Now()
+	c.takenGen = generation
+	c.snapshots.Add(1)
+	return c.statuses
+}
+
+// statuses returns the status of every tunnel the manager runs, from the
+// cache. The returned statuses are shared and must not be modified.
+func (m *Manager) statuses() map[string]*TunnelStatus {
+	return m.cache.get(m.snapshotStatuses)
+}
+
+// snapshotStatuses reads every tunnel's status under a single hold of the
+// manager lock
+func (m *Manager) snapshotStatuses() map[string]*TunnelStatus {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	statuses := make(map[string]*TunnelStatus, len(m.tunnels))
+	for name, tunnel := range m.tunnels {
+		statuses[name] = tunnel.status()
+	}
+	return statuses
+}
+
+// changed marks the tunnel's status as changed, so the next status read
+// sees it. It is called with t.mu held.
+func (t *Tunnel) changed() {
+	t.cache.invalidate()
+}
@@ -0,0 +1,106 @@
+package tunnel
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/lerndmina/SSH-Tunnel/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newFleetManager creates a manager with n running tunnels that have no SSH
+// process behind them, for exercising status reads
+func newFleetManager(n int) (*Manager, []string) {
+	m := NewManagerWithConfig(nil)
+	names := make([]string, n)
+	for i := range names {
+		names[i] = fmt.Sprintf("tunnel-%d", i)
+		m.tunnels[names[i]] = &Tunnel{ID: names[i], Config: &config.Config{}, Status: StatusRunning, cache: m.cache}
+	}
+	return m, names
+}
+
+func TestStatusReadsShareOneSnapshot(t *testing.T) {
+	m, names := newFleetManager(20)
+
+	for i := 0; i < 3; i++ {
+		for _, name := range names {
+			status, err := m.GetStatus(name)
+			require.NoError(t, err)
+			assert.Equal(t, StatusRunning, status.Status)
+		}
+	}
+	assert.Equal(t, uint64(1), m.cache.snapshots.Load())
+
+	// Callers get copies they may modify
+	status, err := m.GetStatus(names[0])
+	require.NoError(t, err)
+	status.Status = StatusError
+	status, err = m.GetStatus(names[0])
+	require.NoError(t, err)
+	assert.Equal(t, StatusRunning, status.Status)
+}
+
+func TestStatusCacheSeesStateChanges(t *testing.T) {
+	m := newTestManager(t, testConfig("cached"))
+	m.command = helperCommand("run")
+
+	status, err := m.GetStatus("cached")
+	require.NoError(t, err)
+	assert.Equal(t, StatusStopped, status.Status)
+
+	require.NoError(t, m.Start("cached"))
+	status, err = m.GetStatus("cached")
+	require.NoError(t, err)
+	assert.Equal(t, StatusRunning, status.Status)
+
+	require.NoError(t, m.HealthCheck("cached"))
+	status, err = m.GetStatus("cached")
+	require.NoError(t, err)
+	assert.False(t, status.LastHealthCheck.IsZero())
+
+	require.NoError(t, m.Stop("cached"))
+	status, err = m.GetStatus("cached")
+	require.NoError(t, err)
+	assert.Equal(t, StatusStopped, status.Status)
+}
+
+// uncachedStatus reads a status the way GetStatus did before the cache,
+// taking the manager and tunnel locks on every call
+func uncachedStatus(m *Manager, name string) *TunnelStatus {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.tunnels[name].status()
+}
+
+// BenchmarkStatusRefresh reads every tunnel's status once per iteration, as
+// a monitor refresh does, and reports the locks taken per refresh
+func BenchmarkStatusRefresh(b *testing.B) {
+	const fleet = 100
+
+	b.Run("uncached", func(b *testing.B) {
+		m, names := newFleetManager(fleet)
+		for i := 0; i < b.N; i++ {
+			for _, name := range names {
+				uncachedStatus(m, name)
+			}
+		}
+		// One manager and one tunnel lock per read
+		b.ReportMetric(2*fleet, "locks/op")
+	})
+
+	b.Run("cached", func(b *testing.B) {
+		m, names := newFleetManager(fleet)
+		for i := 0; i < b.N; i++ {
+			for _, name := range names {
+				if _, err := m.GetStatus(name); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+		// One manager lock and one lock per tunnel for each snapshot
+		snapshots := float64(m.cache.snapshots.Load())
+		b.ReportMetric(snapshots*(1+fleet)/float64(b.N), "locks/op")
+	})
+}
@@ -2,13 +2,22 @@ package tunnel
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/lerndmina/SSH-Tunnel/internal/audit"
 	"github.com/lerndmina/SSH-Tunnel/internal/config"
+	"github.com/lerndmina/SSH-Tunnel/internal/process"
+	"github.com/lerndmina/SSH-Tunnel/internal/ssh"
 	"github.com/lerndmina/SSH-Tunnel/pkg/logger"
 )
 
@@ -21,6 +30,7 @@ const (
 	StatusRunning
 	StatusStopping
 	StatusError
+	StatusReconnecting
 )
 
 func (s Status) String() string {
@@ -35,6 +45,8 @@ func (s Status) String() string {
 		return "stopping"
 	case StatusError:
 		return "error"
+	case StatusReconnecting:
+		return "reconnecting"
 	default:
 		return "unknown"
 	}
@@ -49,208 +61,876 @@ type Tunnel struct {
 	StartTime       time.Time
 	LastHealthCheck time.Time
 	Error           error
-	ctx             context.Context
-	cancel          context.CancelFunc
-	mu              sync.RWMutex
+	LogFile         string
+
+	// Reconnect state maintained by the supervision loop
+	ReconnectAttempt int
+	NextRetry        time.Time
+	// ReconnectCount is how many times the SSH process was restarted, and
+	// LastError the most recent failure, kept after the tunnel recovers
+	ReconnectCount int
+	LastError      string
+
+	// SOCKSError is the result of the last SOCKS proxy health check
+	SOCKSError error
+	// ForwardError is the result of the last remote forward check, when
+	// health checks include it
+	ForwardError error
+
+	// ExpiresAt is when the tunnel stops itself, if it has a lifetime
+	ExpiresAt time.Time
+
+	// ResolvedAddrs are the cloud server's addresses as last resolved
+	ResolvedAddrs []string
+
+	// unhealthy is the failed health check the SSH process was killed
+	// for, reported by supervise in place of the kill
+	unhealthy error
+
+	// carrier runs the SSH process of a tunnel in a group, and members are
+	// the group's tunnels when this is the carrier
+	carrier *Tunnel
+	members []*Tunnel
+
+	output  *outputCapture
+	lock    *tunnelLock
+	events  *eventBus
+	cache   *statusCache
+	command commandFunc
+	backoff backoffFunc
+	resolve resolveFunc
+	runner  CommandRunner
+	ctx     context.Context
+	cancel  context.CancelFunc
+	mu      sync.RWMutex
 }
 
+// commandFunc creates the command used to run SSH
+type commandFunc func(ctx context.Context, name string, args ...string) *exec.Cmd
+
+// backoffFunc returns the delay before a reconnect attempt (starting at 1)
+type backoffFunc func(cfg *config.Config, attempt int) time.Duration
+
+const (
+	// defaultReconnectDelay is used when Service.RestartSec is not set
+	defaultReconnectDelay = 5 * time.Second
+	// maxReconnectDelay caps the exponential reconnect backoff
+	maxReconnectDelay = 5 * time.Minute
+	// reconnectResetAfter is how long a connection must stay up before the
+	// reconnect attempt counter starts again from one
+	reconnectResetAfter = time.Minute
+)
+
 // Manager manages multiple SSH tunnels
 type Manager struct {
-	tunnels map[string]*Tunnel
-	mu      sync.RWMutex
+	tunnels       map[string]*Tunnel
+	configManager *config.Manager
+	command       commandFunc
+	backoff       backoffFunc
+	resolve       resolveFunc
+	probe         probeFunc
+	forwardCheck  forwardCheckFunc
+	// localForwards and remoteForwards are added to every tunnel started,
+	// without being saved
+	localForwards  []config.ForwardConfig
+	remoteForwards []config.RemoteForwardConfig
+	runner         CommandRunner
+	processes      process.Enumerator
+	events         *eventBus
+	cache          *statusCache
+	mu             sync.RWMutex
 }
 
-// NewManager creates a new tunnel manager
+// NewManager creates a new tunnel manager using the global configuration
 func NewManager() *Manager {
+	return NewManagerWithConfig(config.GetManager())
+}
+
+// NewManagerWithConfig creates a new tunnel manager reading tunnel
+// configurations from configManager
+func NewManagerWithConfig(configManager *config.Manager) *Manager {
 	return &Manager{
-		tunnels: make(map[string]*Tunnel),
+		tunnels:       make(map[string]*Tunnel),
+		configManager: configManager,
+		command:       exec.CommandContext,
+		backoff:       reconnectBackoff,
+		resolve:       net.DefaultResolver.LookupHost,
+		probe:         probeReversePort,
+		runner:        ShellRunner{},
+		processes:     process.System(),
+		events:        newEventBus(),
+		cache:         &statusCache{},
 	}
 }
 
-// Start starts a tunnel with the given configuration
-func (m *Manager) Start(tunnelName string) error {
+// SetCommandRunner sets the runner used for hook commands
+func (m *Manager) SetCommandRunner(runner CommandRunner) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	m.runner = runner
+}
+
+// reconnectBackoff doubles the configured restart delay on each consecutive
+// attempt, up to maxReconnectDelay
+func reconnectBackoff(cfg *config.Config, attempt int) time.Duration {
+	delay := time.Duration(cfg.Service.RestartSec) * time.Second
+	if delay <= 0 {
+		delay = defaultReconnectDelay
+	}
+	for i := 1; i < attempt && delay < maxReconnectDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxReconnectDelay {
+		delay = maxReconnectDelay
+	}
+	return delay
+}
+
+// Start starts a tunnel with the given configuration
+func (m *Manager) Start(tunnelName string) error {
+	return m.StartContext(context.Background(), tunnelName)
+}
+
+// StartContext starts a tunnel, abandoning the start sequence if ctx is
+// cancelled or its deadline passes first. A running pre-start hook is killed
+// and the SSH process is not spawned. ctx only bounds starting: once
+// started, the tunnel runs until stopped.
+func (m *Manager) StartContext(ctx context.Context, tunnelName string) error {
+	return m.StartWithTTL(ctx, tunnelName, 0)
+}
+
+// StartWithTTL starts a tunnel like StartContext that stops itself once it
+// has run for ttl. A zero ttl uses the tunnel's Service.MaxLifetime, if any.
+// A tunnel in a group is started along with the rest of its group.
+func (m *Manager) StartWithTTL(ctx context.Context, tunnelName string, ttl time.Duration) (err error) {
+	defer func() { m.configManager.Audit().Log(audit.ActionTunnelStart, tunnelName, nil, err) }()
+
+	// Catch configuration mistakes before anything runs
+	if members, err := m.startConfigs(tunnelName); err == nil {
+		for _, cfg := range members {
+			if err := cfg.Preflight(); err != nil {
+				return fmt.Errorf("invalid configuration for tunnel '%s': %w", cfg.TunnelName, err)
+			}
+		}
+	}
+
+	start, err := m.claim(ctx, tunnelName)
+	if err != nil {
+		return err
+	}
+	// With the tunnel known not to be running, the pre-start hooks can veto
+	// the start
+	if err := m.prepare(ctx, start.members); err != nil {
+		start.release()
+		return err
+	}
+
+	members, err := m.launch(ctx, start, ttl)
+	if err != nil {
+		return err
+	}
+
+	for _, cfg := range members {
+		if _, err := m.runHook(ctx, cfg, HookOnStart, cfg.Service.OnStart); err != nil {
+			logger.Warnf("%v", err)
+		}
+	}
+
+	return nil
+}
+
+// pendingStart is the start of a tunnel, or the group it belongs to, that
+// holds the tunnels' locks but has not spawned SSH yet
+type pendingStart struct {
+	name    string
+	members []*config.Config
+	// merged is the configuration of a group's shared SSH process
+	merged *config.Config
+	locks  []*tunnelLock
+}
+
+// release lets go of the locks of a start that will not go ahead
+func (p *pendingStart) release() {
+	for _, lock := range p.locks {
+		if err := lock.release(); err != nil {
+			logger.Warnf("%v", err)
+		}
+	}
+}
 
-	// Check if tunnel is already running
-	if tunnel, exists := m.tunnels[tunnelName]; exists {
-		tunnel.mu.RLock()
-		status := tunnel.Status
-		tunnel.mu.RUnlock()
+// prepare runs the pre-start hooks of the tunnels about to start, any of
+// which can veto the start, and renews their certificates
+func (m *Manager) prepare(ctx context.Context, members []*config.Config) error {
+	for _, cfg := range members {
+		if output, err := m.runHook(ctx, cfg, HookPreStart, cfg.Service.PreStart); err != nil {
+			if output != "" {
+				return fmt.Errorf("%w: %s", err, output)
+			}
+			return err
+		}
+	}
 
-		if status == StatusRunning || status == StatusStarting {
-			return fmt.Errorf("tunnel '%s' is already %s", tunnelName, status)
+	m.mu.RLock()
+	runner := m.runner
+	m.mu.RUnlock()
+	for _, cfg := range members {
+		if err := renewCertificate(ctx, runner, cfg); err != nil {
+			logger.Warnf("%v", err)
 		}
 	}
+	return nil
+}
+
+// claim checks that the tunnel, and the rest of its group, is not running
+// and takes their locks, so no other start of them can begin until launch
+// or release
+func (m *Manager) claim(ctx context.Context, tunnelName string) (*pendingStart, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("start of tunnel '%s' aborted: %w", tunnelName, err)
+	}
 
 	// Get configuration
-	configManager := config.GetManager()
-	cfg, err := configManager.GetConfig(tunnelName)
+	configManager := m.configManager
+	members, err := m.startConfigs(tunnelName)
 	if err != nil {
-		return fmt.Errorf("failed to get configuration for tunnel '%s': %w", tunnelName, err)
+		return nil, err
 	}
 
-	// Create tunnel context
-	ctx, cancel := context.WithCancel(context.Background())
+	for i, cfg := range members {
+		// Check if tunnel is already running
+		if tunnel, exists := m.tunnels[cfg.TunnelName]; exists {
+			proc := tunnel.sshProcess()
+			proc.mu.RLock()
+			status := proc.Status
+			proc.mu.RUnlock()
+
+			if status == StatusRunning || status == StatusStarting || status == StatusReconnecting {
+				if cfg.TunnelName != tunnelName {
+					return nil, fmt.Errorf("tunnel '%s' in group '%s' is already %s", cfg.TunnelName, cfg.Group, status)
+				}
+				return nil, fmt.Errorf("tunnel '%s' is already %s", tunnelName, status)
+			}
+
+			// The tunnel failed earlier; let go of its lock before retaking it
+			if tunnel.lock != nil {
+				if err := tunnel.lock.release(); err != nil {
+					logger.Warnf("%v", err)
+				}
+			}
+		}
 
-	tunnel := &Tunnel{
-		ID:     tunnelName,
-		Config: cfg,
-		Status: StatusStarting,
-		ctx:    ctx,
-		cancel: cancel,
+		if cfg.TunnelName != tunnelName {
+			continue
+		}
+		if len(m.localForwards) > 0 {
+			if cfg, err = cfg.WithLocalForwards(m.localForwards); err != nil {
+				return nil, fmt.Errorf("tunnel '%s': %w", tunnelName, err)
+			}
+		}
+		if len(m.remoteForwards) > 0 {
+			if cfg, err = cfg.WithRemoteForwards(m.remoteForwards); err != nil {
+				return nil, fmt.Errorf("tunnel '%s': %w", tunnelName, err)
+			}
+		}
+		members[i] = cfg
 	}
 
+	group := members[0].Group
+	var merged *config.Config
+	if group != "" {
+		if merged, err = config.MergeGroup(group, members); err != nil {
+			return nil, err
+		}
+	}
+
+	// Serialize starts across processes sharing the config directory
+	start := &pendingStart{name: tunnelName, members: members, merged: merged}
+	for _, cfg := range members {
+		lock, err := acquireLock(LockDir(configManager.GetConfigPath()), cfg.TunnelName, m.processes)
+		if err != nil {
+			start.release()
+			return nil, err
+		}
+		start.locks = append(start.locks, lock)
+	}
+	return start, nil
+}
+
+// launch creates and starts a claimed tunnel, or the group it belongs to
+// over one SSH process, returning the configurations of the tunnels started.
+// The start's locks are released if it fails.
+func (m *Manager) launch(ctx context.Context, start *pendingStart, ttl time.Duration) ([]*config.Config, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tunnelName, members, merged, locks := start.name, start.members, start.merged, start.locks
+	if err := ctx.Err(); err != nil {
+		start.release()
+		return nil, fmt.Errorf("start of tunnel '%s' aborted: %w", tunnelName, err)
+	}
+	configManager := m.configManager
+	group := members[0].Group
+
+	// Create tunnel context, independent of ctx so the tunnel outlives the
+	// start request
+	tunnelCtx, cancel := context.WithCancel(context.Background())
+
+	tunnels := make([]*Tunnel, len(members))
+	for i, cfg := range members {
+		tunnels[i] = &Tunnel{
+			ID:      cfg.TunnelName,
+			Config:  cfg,
+			Status:  StatusStarting,
+			LogFile: LogFile(configManager.GetConfigPath(), cfg.TunnelName),
+			lock:    locks[i],
+			events:  m.events,
+			cache:   m.cache,
+			command: m.command,
+			backoff: m.backoff,
+			resolve: m.resolve,
+			runner:  m.runner,
+			ctx:     tunnelCtx,
+		}
+	}
+
+	// The tunnels of a group are views onto one SSH process carrying all
+	// of their forwards
+	proc := tunnels[0]
+	if merged != nil {
+		proc = &Tunnel{
+			ID:      group,
+			Config:  merged,
+			Status:  StatusStarting,
+			members: tunnels,
+			events:  m.events,
+			cache:   m.cache,
+			command: m.command,
+			backoff: m.backoff,
+			resolve: m.resolve,
+			runner:  m.runner,
+			ctx:     tunnelCtx,
+		}
+		for _, tunnel := range tunnels {
+			tunnel.carrier = proc
+		}
+	}
+	proc.cancel = cancel
+
 	// Start the tunnel process
-	if err := tunnel.start(); err != nil {
+	if err := proc.start(); err != nil {
 		cancel()
-		return fmt.Errorf("failed to start tunnel '%s': %w", tunnelName, err)
+		start.release()
+		return nil, fmt.Errorf("failed to start tunnel '%s': %w", tunnelName, err)
+	}
+
+	var started *Tunnel
+	for _, tunnel := range tunnels {
+		m.tunnels[tunnel.ID] = tunnel
+		if tunnel.ID == tunnelName {
+			started = tunnel
+		}
+	}
+	m.cache.invalidate()
+	if merged != nil {
+		logger.Infof("Started tunnel group '%s' (%s) over one SSH process", group, strings.Join(tunnelNames(tunnels), ", "))
+	} else {
+		logger.Infof("Started tunnel '%s'", tunnelName)
 	}
 
-	m.tunnels[tunnelName] = tunnel
-	logger.Infof("Started tunnel '%s'", tunnelName)
+	if interval := proc.Config.Service.HealthCheckInterval; interval > 0 {
+		go m.watchHealth(proc, tunnels, interval)
+	}
 
-	return nil
+	if ttl <= 0 {
+		ttl = started.Config.Service.MaxLifetime
+	}
+	if ttl > 0 {
+		started.mu.Lock()
+		started.ExpiresAt = time.Now().Add(ttl)
+		started.changed()
+		started.mu.Unlock()
+		go m.expire(started, ttl)
+	}
+
+	return members, nil
+}
+
+// expire stops the tunnel once ttl has passed, unless it is stopped first
+func (m *Manager) expire(tunnel *Tunnel, ttl time.Duration) {
+	timer := time.NewTimer(ttl)
+	defer timer.Stop()
+
+	select {
+	case <-tunnel.ctx.Done():
+		return
+	case <-timer.C:
+	}
+
+	// The tunnel may have been stopped and started again meanwhile
+	m.mu.RLock()
+	current := m.tunnels[tunnel.ID]
+	m.mu.RUnlock()
+	if current != tunnel {
+		return
+	}
+
+	logger.Infof("Tunnel '%s' reached its lifetime of %s; stopping", tunnel.ID, ttl)
+	tunnel.mu.Lock()
+	tunnel.emit(EventExpired, nil)
+	tunnel.mu.Unlock()
+
+	if err := m.Stop(tunnel.ID); err != nil {
+		logger.Warnf("Failed to stop expired tunnel '%s': %v", tunnel.ID, err)
+	}
 }
 
 // Stop stops a tunnel
 func (m *Manager) Stop(tunnelName string) error {
+	return m.StopContext(context.Background(), tunnelName)
+}
+
+// StopContext stops a tunnel, along with the rest of its group if it is in
+// one. The tunnel is always stopped; cancelling ctx only cuts short the
+// on-stop hooks.
+func (m *Manager) StopContext(ctx context.Context, tunnelName string) (err error) {
+	defer func() { m.configManager.Audit().Log(audit.ActionTunnelStop, tunnelName, nil, err) }()
+
+	stopped, err := m.halt(tunnelName)
+	if err != nil {
+		return err
+	}
+
+	for _, cfg := range stopped {
+		if _, err := m.runHook(ctx, cfg, HookOnStop, cfg.Service.OnStop); err != nil {
+			logger.Warnf("%v", err)
+		}
+	}
+
+	return nil
+}
+
+// halt stops the tunnel and the rest of its group, returning the
+// configurations of the tunnels stopped
+func (m *Manager) halt(tunnelName string) ([]*config.Config, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	tunnel, exists := m.tunnels[tunnelName]
 	if !exists {
-		return fmt.Errorf("tunnel '%s' not found", tunnelName)
+		return nil, fmt.Errorf("tunnel '%s' not found", tunnelName)
 	}
 
-	tunnel.mu.Lock()
-	defer tunnel.mu.Unlock()
+	proc, tunnels := tunnel, []*Tunnel{tunnel}
+	if tunnel.carrier != nil {
+		proc, tunnels = tunnel.carrier, tunnel.carrier.members
+	}
 
-	if tunnel.Status == StatusStopped || tunnel.Status == StatusStopping {
-		return fmt.Errorf("tunnel '%s' is already %s", tunnelName, tunnel.Status)
+	proc.mu.Lock()
+	defer proc.mu.Unlock()
+
+	if proc.Status == StatusStopped || proc.Status == StatusStopping {
+		return nil, fmt.Errorf("tunnel '%s' is already %s", tunnelName, proc.Status)
 	}
 
-	tunnel.Status = StatusStopping
+	reconnecting := proc.Status == StatusReconnecting
+	proc.Status = StatusStopping
 
 	// Cancel context to signal shutdown
-	if tunnel.cancel != nil {
-		tunnel.cancel()
+	if proc.cancel != nil {
+		proc.cancel()
 	}
 
-	// Kill the process if it exists
-	if tunnel.Process != nil && tunnel.Process.Process != nil {
-		if err := tunnel.Process.Process.Kill(); err != nil {
+	// Kill the process if it exists; while reconnecting it has already exited
+	if proc.Process != nil && proc.Process.Process != nil && !reconnecting {
+		if err := proc.Process.Process.Kill(); err != nil {
 			logger.Warnf("Failed to kill tunnel process: %v", err)
 		}
 	}
 
-	tunnel.Status = StatusStopped
-	delete(m.tunnels, tunnelName)
+	proc.Status = StatusStopped
+	proc.emit(EventStopped, nil)
 
-	logger.Infof("Stopped tunnel '%s'", tunnelName)
-	return nil
+	stopped := make([]*config.Config, 0, len(tunnels))
+	for _, t := range tunnels {
+		delete(m.tunnels, t.ID)
+		if t.lock != nil {
+			if err := t.lock.release(); err != nil {
+				logger.Warnf("%v", err)
+			}
+		}
+		stopped = append(stopped, t.Config)
+	}
+
+	if proc != tunnel {
+		logger.Infof("Stopped tunnel group '%s' (%s)", proc.ID, strings.Join(tunnelNames(tunnels), ", "))
+	} else {
+		logger.Infof("Stopped tunnel '%s'", tunnelName)
+	}
+	return stopped, nil
 }
 
-// Restart restarts a tunnel
+// ForceStop stops a tunnel even if it was started by another process: the
+// tunnel is stopped if this manager runs it, then any SSH process whose
+// command line matches the tunnel's SSH arguments is killed and a stale lock
+// removed. A tunnel in a group is stopped with the rest of the group. It
+// returns the IDs of the killed processes.
+func (m *Manager) ForceStop(tunnelName string) (killed []int, err error) {
+	defer func() {
+		m.configManager.Audit().Log(audit.ActionTunnelStop, tunnelName, map[string]string{"force": "true"}, err)
+	}()
+
+	cfg, members, err := m.sshProcessConfig(tunnelName)
+	if err != nil {
+		return nil, err
+	}
+
+	_, stopErr := m.halt(tunnelName)
+
+	processes, err := m.processes.Processes()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, proc := range FindSSHProcesses(processes, cfg) {
+		if err := m.processes.Kill(proc.PID); err != nil {
+			return killed, err
+		}
+		logger.Infof("Killed SSH process %d for tunnel '%s'", proc.PID, tunnelName)
+		killed = append(killed, proc.PID)
+	}
+
+	for _, member := range members {
+		if err := removeStaleLock(LockDir(m.configManager.GetConfigPath()), member.TunnelName, m.processes); err != nil {
+			logger.Warnf("%v", err)
+		}
+	}
+
+	if stopErr != nil && len(killed) == 0 {
+		return nil, fmt.Errorf("no SSH process found for tunnel '%s'", tunnelName)
+	}
+
+	for _, member := range members {
+		if _, err := m.runHook(context.Background(), member, HookOnStop, member.Service.OnStop); err != nil {
+			logger.Warnf("%v", err)
+		}
+	}
+
+	return killed, nil
+}
+
+// FindSSHProcesses returns the ssh processes running with exactly the
+// arguments BuildSSHArgs generates for cfg
+func FindSSHProcesses(processes []process.Process, cfg *config.Config) []process.Process {
+	args := BuildSSHArgs(cfg)
+	self := os.Getpid()
+
+	var matches []process.Process
+	for _, proc := range processes {
+		if proc.PID == self || proc.Name() != "ssh" || len(proc.Args) != len(args)+1 {
+			continue
+		}
+		if slices.Equal(proc.Args[1:], args) {
+			matches = append(matches, proc)
+		}
+	}
+	return matches
+}
+
+// restartStopTimeout is how long Restart waits for a stopped tunnel's lock
+// to be released before starting it again
+const restartStopTimeout = 10 * time.Second
+
+// Restart restarts a tunnel, along with the rest of its group. A tunnel this
+// manager does not run, as one an earlier invocation started, is stopped
+// through its lock: the SSH process it records is killed. The tunnel is
+// started again once its lock is released.
 func (m *Manager) Restart(tunnelName string) error {
 	logger.Infof("Restarting tunnel '%s'", tunnelName)
 
-	// Stop the tunnel if it's running
-	if err := m.Stop(tunnelName); err != nil {
-		// Log the error but continue with start
-		logger.Warnf("Error stopping tunnel during restart: %v", err)
-	}
+	m.mu.RLock()
+	_, runs := m.tunnels[tunnelName]
+	m.mu.RUnlock()
 
-	// Wait a moment for cleanup
-	time.Sleep(1 * time.Second)
+	if runs {
+		if err := m.Stop(tunnelName); err != nil {
+			// Log the error but continue with start
+			logger.Warnf("Error stopping tunnel during restart: %v", err)
+		}
+	} else if err := m.stopLocked(tunnelName); err != nil {
+		return err
+	}
 
-	// Start the tunnel
+	if err := m.waitForUnlock(tunnelName, restartStopTimeout); err != nil {
+		return err
+	}
 	return m.Start(tunnelName)
 }
 
-// GetStatus returns the status of a tunnel
-func (m *Manager) GetStatus(tunnelName string) (*TunnelStatus, error) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+// stopLocked stops a tunnel started by another manager by killing the SSH
+// process its lock records, and runs its on-stop hooks. A tunnel whose lock
+// names a live owner is left alone, as that process would reconnect it.
+func (m *Manager) stopLocked(tunnelName string) error {
+	_, members, err := m.sshProcessConfig(tunnelName)
+	if err != nil {
+		return err
+	}
 
-	tunnel, exists := m.tunnels[tunnelName]
-	if !exists {
-		return &TunnelStatus{
-			Name:   tunnelName,
-			Status: StatusStopped,
-		}, nil
+	dir := LockDir(m.configManager.GetConfigPath())
+	killed := make(map[int]bool)
+	for _, member := range members {
+		record := readLock(filepath.Join(dir, member.TunnelName+".lock"))
+		if record.ownerPID > 0 && processAlive(record.ownerPID) {
+			return fmt.Errorf("tunnel '%s' is run by another process (pid %d); restart it there", member.TunnelName, record.ownerPID)
+		}
+		if _, alive := record.liveSSHProcess(m.processes); !alive || killed[record.sshPID] {
+			continue
+		}
+		if err := m.processes.Kill(record.sshPID); err != nil {
+			return fmt.Errorf("failed to stop tunnel '%s': %w", member.TunnelName, err)
+		}
+		logger.Infof("Killed SSH process %d for tunnel '%s'", record.sshPID, member.TunnelName)
+		killed[record.sshPID] = true
 	}
 
-	tunnel.mu.RLock()
-	defer tunnel.mu.RUnlock()
+	if len(killed) == 0 {
+		return nil
+	}
+	for _, member := range members {
+		if _, err := m.runHook(context.Background(), member, HookOnStop, member.Service.OnStop); err != nil {
+			logger.Warnf("%v", err)
+		}
+	}
+	return nil
+}
+
+// waitForUnlock waits until no live process holds the lock of the tunnel or
+// the rest of its group, failing after timeout
+func (m *Manager) waitForUnlock(tunnelName string, timeout time.Duration) error {
+	_, members, err := m.sshProcessConfig(tunnelName)
+	if err != nil {
+		return err
+	}
+
+	dir := LockDir(m.configManager.GetConfigPath())
+	deadline := time.Now().Add(timeout)
+	for _, member := range members {
+		path := filepath.Join(dir, member.TunnelName+".lock")
+		for {
+			pid := lockHolder(path, m.processes)
+			if pid == 0 {
+				break
+			}
+			if time.Now().After(deadline) {
+				return fmt.Errorf("tunnel '%s' is still held by process %d after %s", member.TunnelName, pid, timeout)
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+	return nil
+}
+
+// GetStatus returns the status of a tunnel. Statuses are read from a
+// snapshot of all tunnels that is refreshed when any tunnel changes state,
+// or after statusCacheTTL.
+func (m *Manager) GetStatus(tunnelName string) (*TunnelStatus, error) {
+	status, exists := m.statuses()[tunnelName]
+	if !exists {
+		return m.lockedStatus(tunnelName), nil
+	}
+	return status.current(), nil
+}
 
+// lockedStatus returns the status of a tunnel this manager does not run. It
+// is running if the SSH process recorded in its lock file is alive, as when
+// an earlier invocation or another process started it; its start time is
+// then read from the process itself, so uptime carries across invocations.
+// A process whose start time differs from the one recorded in the lock is
+// another one given the same ID after the tunnel's exited.
+func (m *Manager) lockedStatus(tunnelName string) *TunnelStatus {
 	status := &TunnelStatus{
-		Name:            tunnelName,
-		Status:          tunnel.Status,
-		StartTime:       tunnel.StartTime,
-		LastHealthCheck: tunnel.LastHealthCheck,
-		Error:           tunnel.Error,
-		Uptime:          time.Since(tunnel.StartTime),
+		Name:   tunnelName,
+		Status: StatusStopped,
 	}
 
-	if tunnel.Process != nil && tunnel.Process.Process != nil {
-		status.PID = tunnel.Process.Process.Pid
+	path := filepath.Join(LockDir(m.configManager.GetConfigPath()), tunnelName+".lock")
+	record := readLock(path)
+	started, alive := record.liveSSHProcess(m.processes)
+	if !alive {
+		return status
 	}
 
-	return status, nil
+	status.Status = StatusRunning
+	status.PID = record.sshPID
+	if !started.IsZero() {
+		status.StartTime = started
+		status.Uptime = time.Since(started)
+	}
+	return status
 }
 
 // List returns all tunnel statuses
 func (m *Manager) List() ([]*TunnelStatus, error) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-
-	statuses := make([]*TunnelStatus, 0, len(m.tunnels))
+	snapshot := m.statuses()
 
-	for name := range m.tunnels {
-		status, err := m.GetStatus(name)
-		if err != nil {
-			logger.Warnf("Failed to get status for tunnel '%s': %v", name, err)
-			continue
-		}
-		statuses = append(statuses, status)
+	statuses := make([]*TunnelStatus, 0, len(snapshot))
+	for _, status := range snapshot {
+		statuses = append(statuses, status.current())
 	}
 
 	return statuses, nil
 }
 
-// HealthCheck performs a health check on a tunnel
+// current returns a copy of a cached status with its uptime brought up to
+// date
+func (s *TunnelStatus) current() *TunnelStatus {
+	status := *s
+	if !status.StartTime.IsZero() {
+		status.Uptime = time.Since(status.StartTime)
+	}
+	return &status
+}
+
+// status reads the tunnel's status
+func (t *Tunnel) status() *TunnelStatus {
+	if t.carrier != nil {
+		return t.memberStatus()
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	status := &TunnelStatus{
+		Name:            t.ID,
+		Status:          t.Status,
+		StartTime:       t.StartTime,
+		LastHealthCheck: t.LastHealthCheck,
+		Error:           t.Error,
+		Uptime:          time.Since(t.StartTime),
+
+		ReconnectAttempt: t.ReconnectAttempt,
+		NextRetry:        t.NextRetry,
+		ReconnectCount:   t.ReconnectCount,
+		LastError:        t.LastError,
+		SOCKSError:       t.SOCKSError,
+		ForwardError:     t.ForwardError,
+		ExpiresAt:        t.ExpiresAt,
+		ResolvedAddrs:    slices.Clone(t.ResolvedAddrs),
+	}
+
+	if t.Process != nil && t.Process.Process != nil {
+		status.PID = t.Process.Process.Pid
+	}
+
+	return status
+}
+
+// SetRemoteForwardCheck makes health checks also verify, over SSH to the
+// cloud server, that the reverse port reaches the local SSH server. Each
+// check then opens an SSH connection, so it is off by default.
+func (m *Manager) SetRemoteForwardCheck(enabled bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.forwardCheck = nil
+	if enabled {
+		m.forwardCheck = RemoteForwardCheck
+	}
+}
+
+// SetLocalForwards adds local forwards to the tunnels this manager starts
+// from now on, for as long as they run. They are not saved to the tunnels'
+// configurations.
+func (m *Manager) SetLocalForwards(forwards []config.ForwardConfig) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.localForwards = forwards
+}
+
+// SetRemoteForwards adds remote forwards to the tunnels this manager starts
+// from now on, like SetLocalForwards
+func (m *Manager) SetRemoteForwards(forwards []config.RemoteForwardConfig) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.remoteForwards = forwards
+}
+
+// HealthCheck performs a health check on a tunnel. When the tunnel has a
+// SOCKS proxy, the proxy is checked too; its failures wrap ErrSOCKSUnhealthy.
+// With the remote forward check enabled, its failure is returned in
+// preference to the proxy's.
 func (m *Manager) HealthCheck(tunnelName string) error {
 	m.mu.RLock()
 	tunnel, exists := m.tunnels[tunnelName]
+	forwardCheck := m.forwardCheck
 	m.mu.RUnlock()
 
 	if !exists {
 		return fmt.Errorf("tunnel '%s' not found", tunnelName)
 	}
 
+	if err := tunnel.sshProcess().checkProcess(); err != nil {
+		tunnel.mu.Lock()
+		tunnel.emit(EventHealthCheck, err)
+		tunnel.mu.Unlock()
+		return err
+	}
+
+	// Check the SOCKS proxy without holding the tunnel lock
+	socksPort := tunnel.Config.LocalServer.SOCKSPort
+	var socksErr error
+	if socksPort > 0 {
+		proxyAddr := SOCKSAddress(tunnel.Config.LocalServer.SOCKSBindAddr, socksPort)
+		if err := CheckSOCKS(context.Background(), proxyAddr, tunnel.Config.LocalServer.SOCKSCheckURL); err != nil {
+			socksErr = fmt.Errorf("%w: %v", ErrSOCKSUnhealthy, err)
+		}
+	}
+
+	var forwardErr error
+	if forwardCheck != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), DefaultForwardCheckTimeout)
+		_, forwardErr = forwardCheck(ctx, tunnel.Config)
+		cancel()
+	}
+
 	tunnel.mu.Lock()
 	defer tunnel.mu.Unlock()
 
-	if tunnel.Status != StatusRunning {
-		return fmt.Errorf("tunnel '%s' is not running", tunnelName)
+	tunnel.SOCKSError = socksErr
+	tunnel.ForwardError = forwardErr
+	tunnel.LastHealthCheck = time.Now()
+
+	err := socksErr
+	if forwardErr != nil {
+		err = forwardErr
 	}
+	tunnel.emit(EventHealthCheck, err)
+	return err
+}
 
-	// Check if process is still alive
-	if tunnel.Process == nil || tunnel.Process.Process == nil {
-		tunnel.Status = StatusError
-		tunnel.Error = fmt.Errorf("tunnel process not found")
-		return tunnel.Error
+// checkProcess verifies that the tunnel's SSH process is running
+func (t *Tunnel) checkProcess() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.Status != StatusRunning {
+		return fmt.Errorf("tunnel '%s' is not running", t.ID)
 	}
 
-	// Check process state
-	if tunnel.Process.ProcessState != nil && tunnel.Process.ProcessState.Exited() {
-		tunnel.Status = StatusError
-		tunnel.Error = fmt.Errorf("tunnel process has exited")
-		return tunnel.Error
+	// Check if process is still alive
+	if t.Process == nil || t.Process.Process == nil {
+		t.Status = StatusError
+		t.Error = fmt.Errorf("tunnel process not found")
+		t.changed()
+		return t.Error
 	}
 
-	tunnel.LastHealthCheck = time.Now()
+	// An exited process is noticed by supervise, which changes the status;
+	// ProcessState is written by its Wait and cannot be read here safely
 	return nil
 }
 
@@ -263,73 +943,201 @@ type TunnelStatus struct {
 	Uptime          time.Duration `json:"uptime"`
 	PID             int           `json:"pid"`
 	Error           error         `json:"error,omitempty"`
+
+	// ReconnectAttempt is the number of consecutive reconnect attempts made
+	// by the supervision loop, and NextRetry when the next one is due
+	ReconnectAttempt int       `json:"reconnect_attempt,omitempty"`
+	NextRetry        time.Time `json:"next_retry,omitempty"`
+
+	// ReconnectCount is how many times the supervision loop restarted the
+	// SSH process, and LastError the most recent failure, which is kept
+	// after the tunnel recovers
+	ReconnectCount int    `json:"reconnect_count,omitempty"`
+	LastError      string `json:"last_error,omitempty"`
+
+	// SOCKSError is set when the last health check found the SOCKS proxy
+	// unusable, independently of the reverse forward
+	SOCKSError error `json:"socks_error,omitempty"`
+
+	// ForwardError is set when the last remote forward check found the
+	// reverse port not reaching the local SSH server
+	ForwardError error `json:"forward_error,omitempty"`
+
+	// ExpiresAt is when the tunnel stops itself, if it has a lifetime
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+
+	// Group is the group whose SSH process the tunnel shares, if any
+	Group string `json:"group,omitempty"`
+
+	// ResolvedAddrs are the cloud server's addresses as last resolved
+	ResolvedAddrs []string `json:"resolved_addrs,omitempty"`
 }
 
-// start starts the SSH tunnel process
+// start starts the SSH tunnel process and its supervision loop
 func (t *Tunnel) start() error {
+	// A host name that does not resolve yet is retried in the background
+	// rather than failing the start, unless reconnecting is disabled
+	addrs, err := t.resolveCloudServer()
+	if err != nil {
+		t.mu.Lock()
+		t.Error = err
+		t.LastError = err.Error()
+		t.emit(EventError, err)
+		if !t.Config.Service.AutoReconnect {
+			t.Status = StatusError
+			t.changed()
+			t.mu.Unlock()
+			return err
+		}
+		t.mu.Unlock()
+
+		logger.Warnf("Tunnel '%s': %v; retrying every %s", t.ID, err, dnsRetryDelay(t.Config))
+		go func() {
+			if t.reconnect() {
+				t.supervise()
+			}
+		}()
+		t.watchDNS()
+		return nil
+	}
+
+	t.mu.Lock()
+	t.setResolvedAddrs(addrs)
+	t.mu.Unlock()
+
+	if err := t.spawn(); err != nil {
+		return err
+	}
+
+	go t.supervise()
+	t.watchDNS()
+
+	return nil
+}
+
+// spawn starts a new SSH process for the tunnel
+func (t *Tunnel) spawn() error {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
 	// Build SSH command
-	args := t.buildSSHArgs()
+	args := BuildSSHArgs(t.Config)
+	if ssh.HostKeyChecksSkipped(t.Config.SSH.InsecureSkipHostKeyCheck) {
+		logger.Warnf("INSECURE: tunnel '%s' is not verifying the host key of %s; the connection is open to man-in-the-middle attacks",
+			t.Config.TunnelName, t.Config.CloudServer.IP)
+	}
 
 	logger.Debugf("Starting SSH tunnel with command: ssh %v", args)
 
 	// Create the command
-	cmd := exec.CommandContext(t.ctx, "ssh", args...)
+	command := t.command
+	if command == nil {
+		command = exec.CommandContext
+	}
+	cmd := command(t.ctx, "ssh", args...)
 
 	// Set up process attributes
-	cmd.Env = os.Environ()
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
 	cmd.Env = append(cmd.Env, "AUTOSSH_GATETIME=0")
 
+	// Capture SSH output to the tunnel log file
+	output, err := newOutputCapture(t.ID, t.logFiles()...)
+	if err != nil {
+		logger.Warnf("Failed to capture output for tunnel '%s': %v", t.ID, err)
+	}
+	cmd.Stdout = output
+	cmd.Stderr = output
+	t.output = output
+
 	// Start the process
 	if err := cmd.Start(); err != nil {
+		output.Close()
 		t.Status = StatusError
 		t.Error = fmt.Errorf("failed to start SSH process: %w", err)
+		t.LastError = t.Error.Error()
+		t.emit(EventError, t.Error)
 		return t.Error
 	}
 
+	started := time.Now()
+	for _, lock := range t.locks() {
+		if err := lock.setSSHPID(cmd.Process.Pid, started); err != nil {
+			logger.Warnf("%v", err)
+		}
+	}
+
 	t.Process = cmd
 	t.Status = StatusRunning
-	t.StartTime = time.Now()
+	t.StartTime = started
+	t.NextRetry = time.Time{}
 	t.Error = nil
-
-	// Monitor the process in a goroutine
-	go t.monitor()
+	t.emit(EventStarted, nil)
 
 	return nil
 }
 
-// buildSSHArgs builds the SSH command arguments
-func (t *Tunnel) buildSSHArgs() []string {
-	cfg := t.Config
-	args := []string{
+// BuildSSHArgs builds the SSH command arguments for a tunnel configuration
+func BuildSSHArgs(cfg *config.Config) []string {
+	var args []string
+
+	// The config file comes first; the options below override it, since ssh
+	// gives command-line options precedence
+	if cfg.SSH.ConfigFile != "" {
+		args = append(args, "-F", config.ExpandPath(cfg.SSH.ConfigFile))
+	}
+
+	args = append(args,
 		"-N", // Don't execute remote command
 		"-T", // Disable pseudo-terminal allocation
-	}
+	)
 
 	// Add SSH options
 	args = append(args,
 		"-o", "ServerAliveInterval="+fmt.Sprintf("%d", cfg.Performance.KeepAliveInterval),
 		"-o", "ServerAliveCountMax="+fmt.Sprintf("%d", cfg.Performance.KeepAliveCountMax),
-		"-o", "StrictHostKeyChecking=no",
-		"-o", "UserKnownHostsFile=/dev/null",
 		"-o", "ExitOnForwardFailure=yes",
 		"-o", "ConnectTimeout="+fmt.Sprintf("%d", cfg.Performance.ConnectTimeout),
 	)
 
+	// Verify the cloud server's host key: strictly against a configured
+	// known_hosts file, or else trusting it on first use
+	switch {
+	case ssh.HostKeyChecksSkipped(cfg.SSH.InsecureSkipHostKeyCheck):
+		args = append(args, "-o", "StrictHostKeyChecking=no", "-o", "UserKnownHostsFile=/dev/null")
+	case cfg.SSH.KnownHostsFile != "":
+		args = append(args, "-o", "StrictHostKeyChecking=yes", "-o", "UserKnownHostsFile="+config.ExpandPath(cfg.SSH.KnownHostsFile))
+	default:
+		args = append(args, "-o", "StrictHostKeyChecking=accept-new")
+	}
+
 	// Add compression if enabled
 	if cfg.SSH.Compression {
 		args = append(args, "-o", "Compression=yes")
 	}
 
-	// Add custom ciphers if specified
-	if cfg.SSH.Ciphers != "" {
-		args = append(args, "-o", "Ciphers="+cfg.SSH.Ciphers)
+	// Add custom algorithm lists if specified
+	if ciphers := cfg.SSH.CipherList(); len(ciphers) > 0 {
+		args = append(args, "-o", "Ciphers="+strings.Join(ciphers, ","))
+	}
+	if macs := cfg.SSH.MACList(); len(macs) > 0 {
+		args = append(args, "-o", "MACs="+strings.Join(macs, ","))
+	}
+	if kex := cfg.SSH.KexList(); len(kex) > 0 {
+		args = append(args, "-o", "KexAlgorithms="+strings.Join(kex, ","))
 	}
 
-	// Add private key
+	// Originate from a specific local address on multi-homed machines
+	if cfg.SSH.BindAddress != "" {
+		args = append(args, "-b", cfg.SSH.BindAddress)
+	}
+
+	// Add private key, and its certificate if any
 	args = append(args, "-i", cfg.SSH.PrivateKeyPath)
+	if cfg.SSH.CertificatePath != "" {
+		args = append(args, "-o", "CertificateFile="+config.ExpandPath(cfg.SSH.CertificatePath))
+	}
 
 	// Add port
 	args = append(args, "-p", fmt.Sprintf("%d", cfg.CloudServer.Port))
@@ -337,10 +1145,20 @@ func (t *Tunnel) buildSSHArgs() []string {
 	// Add reverse port forwarding
 	reverseForward := fmt.Sprintf("%d:localhost:22", cfg.LocalServer.ReversePort)
 	args = append(args, "-R", reverseForward)
+	for _, forward := range cfg.LocalServer.RemoteForwards {
+		spec := fmt.Sprintf("%s:%s", remoteBindSpec(forward.BindAddr, forward.RemotePort), net.JoinHostPort(forward.LocalHost, strconv.Itoa(forward.LocalPort)))
+		args = append(args, "-R", spec)
+	}
+
+	// Add local forwards
+	for _, forward := range cfg.LocalServer.LocalForwards {
+		spec := fmt.Sprintf("%s:%s", bindSpec(forward.BindAddr, forward.LocalPort), net.JoinHostPort(forward.RemoteHost, strconv.Itoa(forward.RemotePort)))
+		args = append(args, "-L", spec)
+	}
 
 	// Add SOCKS proxy if configured
 	if cfg.LocalServer.SOCKSPort > 0 {
-		args = append(args, "-D", fmt.Sprintf("%d", cfg.LocalServer.SOCKSPort))
+		args = append(args, "-D", bindSpec(cfg.LocalServer.SOCKSBindAddr, cfg.LocalServer.SOCKSPort))
 	}
 
 	// Add destination
@@ -350,29 +1168,158 @@ func (t *Tunnel) buildSSHArgs() []string {
 	return args
 }
 
-// monitor monitors the tunnel process
-func (t *Tunnel) monitor() {
-	defer func() {
+// bindSpec formats a local listen address for ssh -L/-D, defaulting to
+// config.DefaultBindAddr. IPv6 addresses are bracketed.
+func bindSpec(bindAddr string, port int) string {
+	if bindAddr == "" {
+		bindAddr = config.DefaultBindAddr
+	}
+	if bindAddr == "*" {
+		return fmt.Sprintf("*:%d", port)
+	}
+	return net.JoinHostPort(bindAddr, strconv.Itoa(port))
+}
+
+// remoteBindSpec formats a cloud server listen address for ssh -R. Without
+// a bind address only the port is given, leaving the choice to sshd.
+func remoteBindSpec(bindAddr string, port int) string {
+	if bindAddr == "" {
+		return strconv.Itoa(port)
+	}
+	if bindAddr == "*" {
+		return fmt.Sprintf("*:%d", port)
+	}
+	return net.JoinHostPort(bindAddr, strconv.Itoa(port))
+}
+
+// wait waits for the current SSH process to exit
+func (t *Tunnel) wait() error {
+	t.mu.RLock()
+	process, output := t.Process, t.output
+	t.mu.RUnlock()
+
+	err := process.Wait()
+	if output != nil {
+		output.Close()
+	}
+	return err
+}
+
+// supervise monitors the tunnel process. When it exits unexpectedly, or is
+// killed by watchHealth after a failed health check, and auto-reconnect is
+// enabled, it is restarted with exponential backoff until the tunnel is
+// stopped.
+func (t *Tunnel) supervise() {
+	for {
+		err := t.wait()
+
 		t.mu.Lock()
-		if t.Status == StatusRunning {
+		if t.ctx.Err() != nil {
+			// Process was cancelled
 			t.Status = StatusStopped
+			t.NextRetry = time.Time{}
+			t.changed()
+			t.mu.Unlock()
+			logger.Debugf("Tunnel '%s' process was cancelled", t.ID)
+			return
+		}
+
+		if t.unhealthy != nil {
+			t.Error = fmt.Errorf("SSH process restarted after a failed health check: %w", t.unhealthy)
+			t.unhealthy = nil
+		} else {
+			t.Error = fmt.Errorf("SSH process exited unexpectedly: %w", newSSHExitError(err, t.output))
+		}
+		t.LastError = t.Error.Error()
+		t.emit(EventError, t.Error)
+		logger.Errorf("Tunnel '%s': %v", t.ID, t.Error)
+
+		if !t.Config.Service.AutoReconnect {
+			t.Status = StatusError
+			t.changed()
+			t.mu.Unlock()
+			return
+		}
+
+		// A connection that stayed up for a while starts a fresh backoff
+		if time.Since(t.StartTime) >= reconnectResetAfter {
+			t.ReconnectAttempt = 0
 		}
 		t.mu.Unlock()
-	}()
 
-	// Wait for process to complete
-	err := t.Process.Wait()
+		if !t.reconnect() {
+			return
+		}
+	}
+}
 
-	t.mu.Lock()
-	if err != nil && t.ctx.Err() == nil {
-		// Process exited unexpectedly
-		t.Status = StatusError
-		t.Error = fmt.Errorf("SSH process exited unexpectedly: %w", err)
-		logger.Errorf("Tunnel '%s' process exited unexpectedly: %v", t.ID, err)
-	} else if t.ctx.Err() != nil {
-		// Process was cancelled
-		t.Status = StatusStopped
-		logger.Debugf("Tunnel '%s' process was cancelled", t.ID)
+// reconnect waits out the backoff and respawns the SSH process, retrying
+// until it starts. It returns false if the tunnel was stopped meanwhile.
+func (t *Tunnel) reconnect() bool {
+	for {
+		t.mu.Lock()
+		t.ReconnectAttempt++
+		backoff := t.backoff
+		if backoff == nil {
+			backoff = reconnectBackoff
+		}
+		delay := backoff(t.Config, t.ReconnectAttempt)
+		if errors.Is(t.Error, ErrHostUnresolved) {
+			// Dynamic DNS records lag; retry steadily instead of backing off
+			delay = dnsRetryDelay(t.Config)
+		}
+		t.NextRetry = time.Now().Add(delay)
+		t.Status = StatusReconnecting
+		t.emit(EventReconnecting, t.Error)
+		attempt := t.ReconnectAttempt
+		t.mu.Unlock()
+
+		logger.Warnf("Tunnel '%s' reconnecting in %s (attempt %d)", t.ID, delay, attempt)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-t.ctx.Done():
+			timer.Stop()
+			t.mu.Lock()
+			t.Status = StatusStopped
+			t.NextRetry = time.Time{}
+			t.changed()
+			t.mu.Unlock()
+			return false
+		case <-timer.C:
+		}
+
+		// Short-lived certificates may have expired while disconnected
+		t.mu.RLock()
+		cfg, runner := t.Config, t.runner
+		t.mu.RUnlock()
+		if err := renewCertificate(t.ctx, runner, cfg); err != nil {
+			logger.Warnf("%v", err)
+		}
+
+		addrs, err := t.resolveCloudServer()
+		t.mu.Lock()
+		if err != nil {
+			t.Error = err
+			t.LastError = err.Error()
+			t.mu.Unlock()
+			logger.Warnf("Tunnel '%s' reconnect attempt %d failed: %v", t.ID, attempt, err)
+			continue
+		}
+		t.setResolvedAddrs(addrs)
+		t.mu.Unlock()
+
+		if err := t.spawn(); err != nil {
+			logger.Errorf("Tunnel '%s' reconnect attempt %d failed: %v", t.ID, attempt, err)
+			continue
+		}
+
+		t.mu.Lock()
+		t.ReconnectCount++
+		t.changed()
+		t.mu.Unlock()
+
+		logger.Infof("Tunnel '%s' reconnected (attempt %d)", t.ID, attempt)
+		return true
 	}
-	t.mu.Unlock()
 }
@@ -0,0 +1,606 @@
+package tunnel
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/lerndmina/SSH-Tunnel/internal/audit"
+	"github.com/lerndmina/SSH-Tunnel/internal/config"
+	"github.com/lerndmina/SSH-Tunnel/internal/process"
+	"github.com/lerndmina/SSH-Tunnel/internal/ssh"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestHelperProcess stands in for the ssh binary in tests. It is not a real
+// test and does nothing unless run by helperCommand.
+func TestHelperProcess(t *testing.T) {
+	if os.Getenv("GO_WANT_HELPER_PROCESS") != "1" {
+		return
+	}
+
+	switch os.Getenv("HELPER_MODE") {
+	case "flap":
+		fmt.Fprintln(os.Stderr, "ssh: connect to host 203.0.113.1 port 22: Connection refused")
+		os.Exit(255)
+	case "run":
+		time.Sleep(time.Minute)
+	case "forwardfail":
+		time.Sleep(300 * time.Millisecond)
+		fmt.Fprintln(os.Stderr, "Error: remote port forwarding failed for listen port 2222")
+		os.Exit(255)
+	}
+	os.Exit(0)
+}
+
+// helperCommand returns a commandFunc running TestHelperProcess in the given mode
+func helperCommand(mode string) commandFunc {
+	return func(ctx context.Context, name string, args ...string) *exec.Cmd {
+		cmd := exec.CommandContext(ctx, os.Args[0], "-test.run=TestHelperProcess", "--")
+		cmd.Env = append(os.Environ(), "GO_WANT_HELPER_PROCESS=1", "HELPER_MODE="+mode)
+		return cmd
+	}
+}
+
+// newTestManager creates a tunnel manager with a single saved tunnel config
+func newTestManager(t *testing.T, cfg *config.Config) *Manager {
+	t.Helper()
+
+	configManager, err := config.NewManager(t.TempDir())
+	require.NoError(t, err)
+	require.NoError(t, configManager.SaveConfig(cfg))
+
+	return NewManagerWithConfig(configManager)
+}
+
+// testConfig returns a minimal tunnel configuration
+func testConfig(name string) *config.Config {
+	return &config.Config{
+		TunnelName:  name,
+		CloudServer: config.CloudServerConfig{IP: "203.0.113.1", Port: 22, User: "tunnel"},
+		LocalServer: config.LocalServerConfig{User: "pi", ReversePort: 2222},
+		Service:     config.ServiceConfig{AutoReconnect: true},
+	}
+}
+
+// waitForStatus polls until cond holds for the tunnel's status
+func waitForStatus(t *testing.T, m *Manager, name string, cond func(*TunnelStatus) bool) *TunnelStatus {
+	t.Helper()
+
+	var status *TunnelStatus
+	require.Eventually(t, func() bool {
+		var err error
+		status, err = m.GetStatus(name)
+		require.NoError(t, err)
+		return cond(status)
+	}, 10*time.Second, 10*time.Millisecond)
+
+	return status
+}
+
+func TestReconnectStateDuringFlap(t *testing.T) {
+	m := newTestManager(t, testConfig("flappy"))
+	m.command = helperCommand("flap")
+	m.backoff = func(cfg *config.Config, attempt int) time.Duration {
+		if attempt < 3 {
+			return 10 * time.Millisecond
+		}
+		return time.Hour
+	}
+
+	require.NoError(t, m.Start("flappy"))
+	defer m.Stop("flappy")
+
+	// The third attempt waits long enough to inspect
+	status := waitForStatus(t, m, "flappy", func(s *TunnelStatus) bool {
+		return s.ReconnectAttempt == 3
+	})
+
+	assert.Equal(t, StatusReconnecting, status.Status)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), status.NextRetry, time.Minute)
+	require.Error(t, status.Error)
+	assert.Contains(t, status.Error.Error(), "exited unexpectedly")
+	assert.ErrorIs(t, status.Error, ErrConnectionRefused)
+	var exitErr *SSHExitError
+	require.ErrorAs(t, status.Error, &exitErr)
+	assert.Equal(t, 255, exitErr.ExitCode)
+
+	// Stopping during the backoff ends the supervision loop
+	require.NoError(t, m.Stop("flappy"))
+	status, err := m.GetStatus("flappy")
+	require.NoError(t, err)
+	assert.Equal(t, StatusStopped, status.Status)
+}
+
+func TestReconnectCountAndLastErrorSurviveRecovery(t *testing.T) {
+	m := newTestManager(t, testConfig("flaky"))
+	spawns := 0
+	m.command = func(ctx context.Context, name string, args ...string) *exec.Cmd {
+		// Fail once, then stay up
+		if spawns++; spawns == 1 {
+			return helperCommand("flap")(ctx, name, args...)
+		}
+		return helperCommand("run")(ctx, name, args...)
+	}
+	m.backoff = func(cfg *config.Config, attempt int) time.Duration {
+		return 10 * time.Millisecond
+	}
+
+	require.NoError(t, m.Start("flaky"))
+	t.Cleanup(func() { m.Stop("flaky") })
+
+	status := waitForStatus(t, m, "flaky", func(s *TunnelStatus) bool {
+		return s.Status == StatusRunning && s.ReconnectCount == 1
+	})
+	assert.NoError(t, status.Error)
+	assert.Contains(t, status.LastError, "exited unexpectedly")
+	assert.Contains(t, status.LastError, "Connection refused")
+}
+
+func TestStartRejectsInvalidConfig(t *testing.T) {
+	cfg := testConfig("broken")
+	cfg.SSH.PrivateKeyPath = filepath.Join(t.TempDir(), "id_missing")
+	m := newTestManager(t, cfg)
+	spawned := false
+	m.command = func(ctx context.Context, name string, args ...string) *exec.Cmd {
+		spawned = true
+		return helperCommand("run")(ctx, name, args...)
+	}
+
+	err := m.Start("broken")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid configuration for tunnel 'broken'")
+	assert.Contains(t, err.Error(), "ssh.private_key_path")
+	assert.Contains(t, err.Error(), "does not exist")
+	assert.False(t, spawned, "SSH was started despite the invalid config")
+
+	status, err := m.GetStatus("broken")
+	require.NoError(t, err)
+	assert.Equal(t, StatusStopped, status.Status)
+}
+
+func TestNoReconnectWhenDisabled(t *testing.T) {
+	cfg := testConfig("once")
+	cfg.Service.AutoReconnect = false
+	m := newTestManager(t, cfg)
+	m.command = helperCommand("flap")
+
+	require.NoError(t, m.Start("once"))
+
+	status := waitForStatus(t, m, "once", func(s *TunnelStatus) bool {
+		return s.Status == StatusError
+	})
+	assert.Zero(t, status.ReconnectAttempt)
+	assert.True(t, status.NextRetry.IsZero())
+}
+
+func TestReconnectBackoff(t *testing.T) {
+	cfg := &config.Config{Service: config.ServiceConfig{RestartSec: 2}}
+
+	assert.Equal(t, 2*time.Second, reconnectBackoff(cfg, 1))
+	assert.Equal(t, 4*time.Second, reconnectBackoff(cfg, 2))
+	assert.Equal(t, 16*time.Second, reconnectBackoff(cfg, 4))
+	assert.Equal(t, maxReconnectDelay, reconnectBackoff(cfg, 20))
+	assert.Equal(t, defaultReconnectDelay, reconnectBackoff(&config.Config{}, 1))
+}
+
+// argValues returns the values passed to an SSH flag such as -D or -L
+func argValues(args []string, flag string) []string {
+	var values []string
+	for i := 0; i < len(args)-1; i++ {
+		if args[i] == flag {
+			values = append(values, args[i+1])
+		}
+	}
+	return values
+}
+
+func TestBuildSSHArgsBindAddress(t *testing.T) {
+	tests := []struct {
+		name     string
+		bindAddr string
+		want     string
+	}{
+		{"default", "", "127.0.0.1:1080"},
+		{"lan", "192.168.1.10", "192.168.1.10:1080"},
+		{"all", "*", "*:1080"},
+		{"ipv6", "::1", "[::1]:1080"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig("bind")
+			cfg.LocalServer.SOCKSPort = 1080
+			cfg.LocalServer.SOCKSBindAddr = tt.bindAddr
+
+			assert.Equal(t, []string{tt.want}, argValues(BuildSSHArgs(cfg), "-D"))
+		})
+	}
+}
+
+func TestBuildSSHArgsOutboundBindAddress(t *testing.T) {
+	cfg := testConfig("multihomed")
+	assert.Empty(t, argValues(BuildSSHArgs(cfg), "-b"))
+
+	cfg.SSH.BindAddress = "192.0.2.7"
+	args := BuildSSHArgs(cfg)
+	assert.Equal(t, []string{"192.0.2.7"}, argValues(args, "-b"))
+	assert.Equal(t, cfg.CloudServer.User+"@"+cfg.CloudServer.IP, args[len(args)-1], "options come before the destination")
+}
+
+func TestBuildSSHArgsLocalForwards(t *testing.T) {
+	cfg := testConfig("forwards")
+	cfg.LocalServer.LocalForwards = []config.ForwardConfig{
+		{LocalPort: 5432, RemoteHost: "db.internal", RemotePort: 5432},
+		{BindAddr: "0.0.0.0", LocalPort: 8080, RemoteHost: "fd00::10", RemotePort: 80},
+	}
+
+	assert.Equal(t, []string{
+		"127.0.0.1:5432:db.internal:5432",
+		"0.0.0.0:8080:[fd00::10]:80",
+	}, argValues(BuildSSHArgs(cfg), "-L"))
+	assert.Empty(t, argValues(BuildSSHArgs(cfg), "-D"))
+}
+
+func TestBuildSSHArgsAlgorithms(t *testing.T) {
+	cfg := testConfig("hardened")
+	cfg.SSH.Ciphers = "chacha20-poly1305@openssh.com, aes256-gcm@openssh.com"
+	cfg.SSH.MACs = "hmac-sha2-512-etm@openssh.com"
+	cfg.SSH.KexAlgorithms = "curve25519-sha256"
+
+	assert.Equal(t, []string{
+		"ServerAliveInterval=0",
+		"ServerAliveCountMax=0",
+		"ExitOnForwardFailure=yes",
+		"ConnectTimeout=0",
+		"StrictHostKeyChecking=accept-new",
+		"Ciphers=chacha20-poly1305@openssh.com,aes256-gcm@openssh.com",
+		"MACs=hmac-sha2-512-etm@openssh.com",
+		"KexAlgorithms=curve25519-sha256",
+	}, argValues(BuildSSHArgs(cfg), "-o"))
+}
+
+func TestBuildSSHArgsHostKeyChecking(t *testing.T) {
+	cfg := testConfig("verified")
+	assert.Contains(t, argValues(BuildSSHArgs(cfg), "-o"), "StrictHostKeyChecking=accept-new")
+
+	cfg.SSH.KnownHostsFile = "/etc/ssh-tunnel/known_hosts"
+	opts := argValues(BuildSSHArgs(cfg), "-o")
+	assert.Contains(t, opts, "StrictHostKeyChecking=yes")
+	assert.Contains(t, opts, "UserKnownHostsFile=/etc/ssh-tunnel/known_hosts")
+
+	cfg.SSH.InsecureSkipHostKeyCheck = true
+	opts = argValues(BuildSSHArgs(cfg), "-o")
+	assert.Contains(t, opts, "StrictHostKeyChecking=no")
+	assert.Contains(t, opts, "UserKnownHostsFile=/dev/null")
+
+	cfg.SSH.InsecureSkipHostKeyCheck = false
+	ssh.SkipAllHostKeyChecks(true)
+	t.Cleanup(func() { ssh.SkipAllHostKeyChecks(false) })
+	assert.Contains(t, argValues(BuildSSHArgs(cfg), "-o"), "StrictHostKeyChecking=no")
+}
+
+func TestBuildSSHArgsConfigFile(t *testing.T) {
+	cfg := testConfig("custom")
+	assert.Empty(t, argValues(BuildSSHArgs(cfg), "-F"))
+
+	cfg.SSH.ConfigFile = "/etc/ssh-tunnel/ssh_config"
+	args := BuildSSHArgs(cfg)
+
+	// -F comes before every -o so the tool's options are layered on top
+	// of the file's
+	require.GreaterOrEqual(t, len(args), 2)
+	assert.Equal(t, []string{"-F", "/etc/ssh-tunnel/ssh_config"}, args[:2])
+	assert.Equal(t, []string{"/etc/ssh-tunnel/ssh_config"}, argValues(args, "-F"))
+	assert.Less(t, slices.Index(args, "-F"), slices.Index(args, "-o"))
+}
+
+func TestResolveNativeTargetFromConfigFile(t *testing.T) {
+	sshConfig := filepath.Join(t.TempDir(), "ssh_config")
+	require.NoError(t, os.WriteFile(sshConfig, []byte(`Host cloud
+    HostName 198.51.100.7
+    Port 2200
+    User ops
+    IdentityFile /keys/cloud
+`), 0600))
+
+	cfg := testConfig("alias")
+	cfg.CloudServer = config.CloudServerConfig{IP: "cloud", User: "tunnel"}
+	cfg.SSH.ConfigFile = sshConfig
+
+	target, err := ResolveNativeTarget(cfg)
+	require.NoError(t, err)
+	assert.Equal(t, NativeTarget{Host: "198.51.100.7", Port: 2200, User: "tunnel", KeyPath: "/keys/cloud"}, target)
+}
+
+func TestStartRejectsUnknownAlgorithm(t *testing.T) {
+	m := newTestManager(t, testConfig("weak"))
+	m.command = helperCommand("run")
+
+	// Edited after saving, as a hand-edited file would be
+	cfg, err := m.configManager.GetConfig("weak")
+	require.NoError(t, err)
+	cfg.SSH.MACs = "hmac-sha2-256,hmac-sha3-256"
+
+	err = m.Start("weak")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `unknown algorithm "hmac-sha3-256"`)
+	status, err := m.GetStatus("weak")
+	require.NoError(t, err)
+	assert.Equal(t, StatusStopped, status.Status)
+}
+
+func TestTTLStopsTunnel(t *testing.T) {
+	m := newTestManager(t, testConfig("debug"))
+	m.command = helperCommand("run")
+
+	events := m.Subscribe()
+	defer m.Unsubscribe(events)
+
+	require.NoError(t, m.StartWithTTL(context.Background(), "debug", 100*time.Millisecond))
+	status, err := m.GetStatus("debug")
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(100*time.Millisecond), status.ExpiresAt, time.Second)
+
+	assert.Equal(t, EventStarted, nextEvent(t, events).Type)
+	assert.Equal(t, EventExpired, nextEvent(t, events).Type)
+	assert.Equal(t, EventStopped, nextEvent(t, events).Type)
+	waitForStatus(t, m, "debug", func(s *TunnelStatus) bool { return s.Status == StatusStopped })
+}
+
+func TestMaxLifetimeFromConfig(t *testing.T) {
+	cfg := testConfig("debug")
+	cfg.Service.MaxLifetime = 100 * time.Millisecond
+	m := newTestManager(t, cfg)
+	m.command = helperCommand("run")
+
+	require.NoError(t, m.Start("debug"))
+	waitForStatus(t, m, "debug", func(s *TunnelStatus) bool { return s.Status == StatusStopped })
+}
+
+func TestStoppedTunnelDoesNotExpireLater(t *testing.T) {
+	m := newTestManager(t, testConfig("debug"))
+	m.command = helperCommand("run")
+
+	require.NoError(t, m.StartWithTTL(context.Background(), "debug", 200*time.Millisecond))
+	require.NoError(t, m.Stop("debug"))
+
+	// A restart without a lifetime is not cut short by the old timer
+	require.NoError(t, m.Start("debug"))
+	t.Cleanup(func() { m.Stop("debug") })
+	time.Sleep(400 * time.Millisecond)
+
+	status, err := m.GetStatus("debug")
+	require.NoError(t, err)
+	assert.Equal(t, StatusRunning, status.Status)
+	assert.True(t, status.ExpiresAt.IsZero())
+}
+
+func TestStartAndStopAreAudited(t *testing.T) {
+	m := newTestManager(t, testConfig("home"))
+	m.command = helperCommand("run")
+
+	require.NoError(t, m.Start("home"))
+	require.NoError(t, m.Stop("home"))
+
+	records, err := audit.Read(m.configManager.Audit().Path())
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	assert.Equal(t, audit.ActionConfigSave, records[0].Action)
+
+	start := records[1]
+	assert.Equal(t, audit.ActionTunnelStart, start.Action)
+	assert.Equal(t, "home", start.Tunnel)
+	assert.NotEmpty(t, start.User)
+	assert.WithinDuration(t, time.Now(), start.Time, time.Minute)
+	assert.Empty(t, start.Error)
+
+	assert.Equal(t, audit.ActionTunnelStop, records[2].Action)
+	assert.Equal(t, "home", records[2].Tunnel)
+}
+
+func TestFailedStartIsAudited(t *testing.T) {
+	m := newTestManager(t, testConfig("home"))
+	m.command = helperCommand("run")
+	require.NoError(t, m.Start("home"))
+	t.Cleanup(func() { m.Stop("home") })
+
+	err := m.Start("home")
+	require.Error(t, err)
+
+	records, err := audit.Read(m.configManager.Audit().Path())
+	require.NoError(t, err)
+	last := records[len(records)-1]
+	assert.Equal(t, audit.ActionTunnelStart, last.Action)
+	assert.Contains(t, last.Error, "already running")
+}
+
+// fakeProcesses is a process.Enumerator over a fixed process table
+type fakeProcesses struct {
+	processes []process.Process
+	killed    []int
+}
+
+func (f *fakeProcesses) Processes() ([]process.Process, error) {
+	return f.processes, nil
+}
+
+func (f *fakeProcesses) StartTime(pid int) (time.Time, error) {
+	for _, proc := range f.processes {
+		if proc.PID == pid {
+			return proc.Started, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("no process %d", pid)
+}
+
+func (f *fakeProcesses) Kill(pid int) error {
+	f.killed = append(f.killed, pid)
+	return nil
+}
+
+func TestForceStopKillsOrphanedProcesses(t *testing.T) {
+	m := newTestManager(t, testConfig("orphan"))
+	cfg, err := m.configManager.GetConfig("orphan")
+	require.NoError(t, err)
+
+	args := BuildSSHArgs(cfg)
+	other := testConfig("other")
+	other.LocalServer.ReversePort = 2223
+
+	procs := &fakeProcesses{processes: []process.Process{
+		{PID: 100, Args: append([]string{"ssh"}, args...)},
+		{PID: 101, Args: append([]string{"/usr/bin/ssh"}, args...)},
+		{PID: 102, Args: append([]string{"ssh"}, BuildSSHArgs(other)...)},
+		{PID: 103, Args: append([]string{"autossh"}, args...)},
+		{PID: 104, Args: append([]string{"ssh"}, args[:len(args)-1]...)},
+		{PID: 1},
+	}}
+	m.processes = procs
+
+	killed, err := m.ForceStop("orphan")
+	require.NoError(t, err)
+	assert.Equal(t, []int{100, 101}, killed)
+	assert.Equal(t, []int{100, 101}, procs.killed)
+}
+
+func TestForceStopWithNothingRunning(t *testing.T) {
+	m := newTestManager(t, testConfig("idle"))
+	procs := &fakeProcesses{}
+	m.processes = procs
+
+	_, err := m.ForceStop("idle")
+	assert.ErrorContains(t, err, "no SSH process found for tunnel 'idle'")
+	assert.Empty(t, procs.killed)
+}
+
+func TestForceStopRemovesStaleLock(t *testing.T) {
+	m := newTestManager(t, testConfig("crashed"))
+	cfg, err := m.configManager.GetConfig("crashed")
+	require.NoError(t, err)
+	m.processes = &fakeProcesses{processes: []process.Process{
+		{PID: 200, Args: append([]string{"ssh"}, BuildSSHArgs(cfg)...)},
+	}}
+
+	// A lock left by a manager that crashed
+	lockPath := filepath.Join(LockDir(m.configManager.GetConfigPath()), "crashed.lock")
+	require.NoError(t, os.MkdirAll(filepath.Dir(lockPath), 0700))
+	require.NoError(t, os.WriteFile(lockPath, []byte("0\n0\n"), 0600))
+
+	_, err = m.ForceStop("crashed")
+	require.NoError(t, err)
+	assert.NoFileExists(t, lockPath)
+}
+
+func TestProcessesLabelsTunnelProcesses(t *testing.T) {
+	lab := testConfig("lab")
+	lab.LocalServer.ReversePort = 2223
+	m := newTestManager(t, testConfig("home"))
+	require.NoError(t, m.configManager.SaveConfig(lab))
+	home, err := m.configManager.GetConfig("home")
+	require.NoError(t, err)
+	lab, err = m.configManager.GetConfig("lab")
+	require.NoError(t, err)
+
+	// lab's process started before its keepalive setting changed
+	oldLab := *lab
+	oldLab.Performance.KeepAliveInterval = 60
+	stranger := testConfig("stranger")
+	stranger.LocalServer.ReversePort = 2299
+	started := time.Now().Add(-time.Hour)
+
+	m.processes = &fakeProcesses{processes: []process.Process{
+		{PID: 100, Args: append([]string{"/usr/bin/ssh"}, BuildSSHArgs(home)...), Started: started},
+		{PID: 101, Args: append([]string{"ssh"}, BuildSSHArgs(&oldLab)...)},
+		{PID: 102, Args: append([]string{"ssh"}, BuildSSHArgs(stranger)...)},
+		{PID: 103, Args: []string{"ssh", "-R", "2222:localhost:22", "me@example.com"}}, // interactive ssh
+		{PID: 104, Args: append([]string{"autossh"}, BuildSSHArgs(home)...)},
+		{PID: 1, Args: []string{"/sbin/init"}},
+	}}
+
+	processes, err := m.Processes()
+	require.NoError(t, err)
+	require.Len(t, processes, 3)
+
+	assert.Equal(t, 100, processes[0].PID)
+	assert.Equal(t, "home", processes[0].Tunnel)
+	assert.False(t, processes[0].Outdated)
+	assert.Equal(t, started, processes[0].Started)
+	assert.Equal(t, "2222:localhost:22", processes[0].Forward)
+	assert.Equal(t, home.CloudServer.User+"@"+home.CloudServer.IP, processes[0].Destination)
+
+	assert.Equal(t, 101, processes[1].PID)
+	assert.Equal(t, "lab", processes[1].Tunnel)
+	assert.True(t, processes[1].Outdated)
+
+	assert.Equal(t, 102, processes[2].PID)
+	assert.Empty(t, processes[2].Tunnel, "no config runs this process")
+	assert.Equal(t, "2299:localhost:22", processes[2].Forward)
+}
+
+func TestSetLocalForwardsAddsForwardsWithoutSaving(t *testing.T) {
+	cfg := testConfig("adhoc")
+	cfg.LocalServer.LocalForwards = []config.ForwardConfig{{LocalPort: 8080, RemoteHost: "web.internal", RemotePort: 80}}
+	m := newTestManager(t, cfg)
+
+	argsCh := make(chan []string, 1)
+	run := helperCommand("run")
+	m.command = func(ctx context.Context, name string, args ...string) *exec.Cmd {
+		argsCh <- args
+		return run(ctx, name, args...)
+	}
+	m.SetLocalForwards([]config.ForwardConfig{{LocalPort: 5432, RemoteHost: "db.internal", RemotePort: 5432}})
+
+	require.NoError(t, m.Start("adhoc"))
+	defer m.Stop("adhoc")
+
+	assert.Equal(t, []string{
+		"127.0.0.1:8080:web.internal:80",
+		"127.0.0.1:5432:db.internal:5432",
+	}, argValues(<-argsCh, "-L"))
+
+	// Neither the loaded nor the saved configuration has the extra forward
+	saved, err := m.configManager.GetConfig("adhoc")
+	require.NoError(t, err)
+	assert.Len(t, saved.LocalServer.LocalForwards, 1)
+	saved, err = m.configManager.ReloadConfig("adhoc")
+	require.NoError(t, err)
+	assert.Len(t, saved.LocalServer.LocalForwards, 1)
+}
+
+func TestSetRemoteForwardsMergesWithConfiguredForwards(t *testing.T) {
+	cfg := testConfig("expose")
+	cfg.LocalServer.RemoteForwards = []config.RemoteForwardConfig{{RemotePort: 8080, LocalHost: "localhost", LocalPort: 80}}
+	m := newTestManager(t, cfg)
+
+	argsCh := make(chan []string, 1)
+	run := helperCommand("run")
+	m.command = func(ctx context.Context, name string, args ...string) *exec.Cmd {
+		argsCh <- args
+		return run(ctx, name, args...)
+	}
+	m.SetRemoteForwards([]config.RemoteForwardConfig{
+		{RemotePort: 9000, LocalHost: "localhost", LocalPort: 3000},
+		{BindAddr: "::", RemotePort: 9001, LocalHost: "fd00::5", LocalPort: 443},
+	})
+
+	require.NoError(t, m.Start("expose"))
+	defer m.Stop("expose")
+
+	assert.Equal(t, []string{
+		"2222:localhost:22",
+		"8080:localhost:80",
+		"9000:localhost:3000",
+		"[::]:9001:[fd00::5]:443",
+	}, argValues(<-argsCh, "-R"))
+
+	saved, err := m.configManager.ReloadConfig("expose")
+	require.NoError(t, err)
+	assert.Len(t, saved.LocalServer.RemoteForwards, 1)
+}
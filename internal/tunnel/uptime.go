@@ -0,0 +1,38 @@
+package tunnel
+
+import (
+	"fmt"
+	"time"
+)
+
+// UptimeHuman returns how long a running tunnel has been up, like
+// "2d 3h 14m", or "-" if it is not running
+func (s *TunnelStatus) UptimeHuman() string {
+	if s == nil || s.Status != StatusRunning || s.StartTime.IsZero() {
+		return "-"
+	}
+	return HumanDuration(time.Since(s.StartTime))
+}
+
+// HumanDuration formats a duration in days, hours and minutes, like
+// "2d 3h 14m", starting from its largest nonzero unit. Durations under a
+// minute are given in seconds.
+func HumanDuration(d time.Duration) string {
+	if d < time.Minute {
+		if d < 0 {
+			d = 0
+		}
+		return fmt.Sprintf("%ds", int(d/time.Second))
+	}
+
+	minutes := int(d / time.Minute)
+	days, hours := minutes/(24*60), minutes/60%24
+	minutes %= 60
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%dd %dh %dm", days, hours, minutes)
+	case hours > 0:
+		return fmt.Sprintf("%dh %dm", hours, minutes)
+	}
+	return fmt.Sprintf("%dm", minutes)
+}
@@ -0,0 +1,40 @@
+package tunnel
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHumanDuration(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{-time.Second, "0s"},
+		{0, "0s"},
+		{1500 * time.Millisecond, "1s"},
+		{59 * time.Second, "59s"},
+		{time.Minute, "1m"},
+		{14*time.Minute + 59*time.Second, "14m"},
+		{time.Hour, "1h 0m"},
+		{3*time.Hour + 14*time.Minute, "3h 14m"},
+		{24 * time.Hour, "1d 0h 0m"},
+		{2*24*time.Hour + 3*time.Hour + 14*time.Minute, "2d 3h 14m"},
+		{400 * 24 * time.Hour, "400d 0h 0m"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, HumanDuration(tt.d), "%s", tt.d)
+	}
+}
+
+func TestUptimeHuman(t *testing.T) {
+	running := &TunnelStatus{Status: StatusRunning, StartTime: time.Now().Add(-(3*time.Hour + 14*time.Minute + 5*time.Second))}
+	assert.Equal(t, "3h 14m", running.UptimeHuman())
+
+	stopped := &TunnelStatus{Status: StatusStopped, StartTime: running.StartTime}
+	assert.Equal(t, "-", stopped.UptimeHuman())
+	assert.Equal(t, "-", (&TunnelStatus{Status: StatusRunning}).UptimeHuman())
+	assert.Equal(t, "-", (*TunnelStatus)(nil).UptimeHuman())
+}
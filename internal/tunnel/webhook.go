@@ -0,0 +1,122 @@
+package tunnel
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/lerndmina/SSH-Tunnel/internal/config"
+	"github.com/lerndmina/SSH-Tunnel/pkg/logger"
+)
+
+// DefaultWebhookTimeout bounds each webhook request unless
+// Notifications.WebhookTimeoutSec is set
+const DefaultWebhookTimeout = 10 * time.Second
+
+// webhookRetryDelay is the pause before the first retry of a failed webhook
+// request; it doubles for each further retry
+var webhookRetryDelay = time.Second
+
+// webhookPayload is the JSON body posted to a tunnel's webhook in the raw
+// format
+type webhookPayload struct {
+	Tunnel  string    `json:"tunnel"`
+	Event   EventType `json:"event"`
+	Time    time.Time `json:"time"`
+	Message string    `json:"message"`
+	Error   string    `json:"error,omitempty"`
+	Attempt int       `json:"attempt,omitempty"`
+}
+
+// webhookTimeout returns the time limit for each webhook request
+func webhookTimeout(n config.NotificationConfig) time.Duration {
+	if n.WebhookTimeoutSec > 0 {
+		return time.Duration(n.WebhookTimeoutSec) * time.Second
+	}
+	return DefaultWebhookTimeout
+}
+
+// notifies reports whether an event is worth a notification. Health checks
+// are only reported when they fail.
+func notifies(event TunnelEvent) bool {
+	return event.Type != EventHealthCheck || event.Err != nil
+}
+
+// notify posts an event to the tunnel's webhook, if notifications are
+// enabled, without waiting for the request. It is called with t.mu held.
+func (t *Tunnel) notify(event TunnelEvent) {
+	if t.Config == nil || !notifies(event) {
+		return
+	}
+	n := t.Config.Notifications
+	if !n.Enabled || n.WebhookURL == "" {
+		return
+	}
+
+	go func() {
+		if err := sendWebhook(context.Background(), http.DefaultClient, n, event); err != nil {
+			logger.Warnf("Webhook notification for tunnel '%s' failed: %v", event.Tunnel, err)
+		}
+	}()
+}
+
+// sendWebhook posts an event to the webhook in its payload format, with the
+// configured headers, retrying failed requests up to WebhookRetries times.
+// Requests that fail to connect, time out or get a non-2xx response count as
+// failed.
+func sendWebhook(ctx context.Context, client *http.Client, n config.NotificationConfig, event TunnelEvent) error {
+	body, err := webhookBody(n.WebhookFormat(), event)
+	if err != nil {
+		return err
+	}
+
+	delay := webhookRetryDelay
+	for attempt := 0; ; attempt++ {
+		err = postWebhook(ctx, client, n, body)
+		if err == nil || attempt >= n.WebhookRetries {
+			break
+		}
+
+		logger.Debugf("Webhook for tunnel '%s' failed, retrying in %s: %v", event.Tunnel, delay, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+	if err != nil && n.WebhookRetries > 0 {
+		return fmt.Errorf("giving up after %d attempts: %w", n.WebhookRetries+1, err)
+	}
+	return err
+}
+
+// postWebhook makes a single webhook request
+func postWebhook(ctx context.Context, client *http.Client, n config.NotificationConfig, body []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout(n))
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("invalid webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range n.WebhookHeaders {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package tunnel
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lerndmina/SSH-Tunnel/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// noWebhookRetryDelay retries failed webhook requests straight away for the
+// rest of the test
+func noWebhookRetryDelay(t *testing.T) {
+	saved := webhookRetryDelay
+	webhookRetryDelay = 0
+	t.Cleanup(func() { webhookRetryDelay = saved })
+}
+
+func TestWebhookSendsHeadersAndPayload(t *testing.T) {
+	var got *http.Request
+	var payload webhookPayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+	}))
+	defer server.Close()
+
+	n := config.NotificationConfig{
+		Enabled:        true,
+		WebhookURL:     server.URL,
+		WebhookHeaders: map[string]string{"Authorization": "Bearer s3cret", "X-Source": "ssh-tunnel"},
+	}
+	event := TunnelEvent{Type: EventError, Tunnel: "home", Time: time.Now(), Err: errors.New("ssh exited")}
+	require.NoError(t, sendWebhook(context.Background(), server.Client(), n, event))
+
+	require.NotNil(t, got)
+	assert.Equal(t, http.MethodPost, got.Method)
+	assert.Equal(t, "Bearer s3cret", got.Header.Get("Authorization"))
+	assert.Equal(t, "ssh-tunnel", got.Header.Get("X-Source"))
+	assert.Equal(t, "application/json", got.Header.Get("Content-Type"))
+	assert.Equal(t, "home", payload.Tunnel)
+	assert.Equal(t, EventError, payload.Event)
+	assert.Equal(t, "ssh exited", payload.Error)
+}
+
+func TestWebhookRetriesUpToConfiguredCount(t *testing.T) {
+	noWebhookRetryDelay(t)
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	n := config.NotificationConfig{Enabled: true, WebhookURL: server.URL, WebhookRetries: 2}
+	err := sendWebhook(context.Background(), server.Client(), n, TunnelEvent{Type: EventStopped, Tunnel: "home"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "502")
+	assert.Equal(t, int32(3), requests.Load(), "one request and two retries")
+}
+
+func TestWebhookStopsRetryingOnSuccess(t *testing.T) {
+	noWebhookRetryDelay(t)
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	n := config.NotificationConfig{Enabled: true, WebhookURL: server.URL, WebhookRetries: 5}
+	require.NoError(t, sendWebhook(context.Background(), server.Client(), n, TunnelEvent{Type: EventStarted, Tunnel: "home"}))
+	assert.Equal(t, int32(2), requests.Load())
+}
+
+func TestWebhookTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	assert.Equal(t, DefaultWebhookTimeout, webhookTimeout(config.NotificationConfig{}))
+	n := config.NotificationConfig{Enabled: true, WebhookURL: server.URL, WebhookTimeoutSec: 1}
+	start := time.Now()
+	err := sendWebhook(context.Background(), server.Client(), n, TunnelEvent{Type: EventStarted, Tunnel: "home"})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
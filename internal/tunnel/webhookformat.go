@@ -0,0 +1,115 @@
+package tunnel
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/lerndmina/SSH-Tunnel/internal/config"
+)
+
+// Colors of chat notifications, by how bad the event is
+const (
+	colorGood    = 0x2EB67D // started
+	colorWarning = 0xECB22E // reconnecting
+	colorDanger  = 0xE01E5A // errors, failed health checks, expiry
+	colorNeutral = 0x8D8D8D // stopped
+)
+
+// eventColor returns the color a chat notification for the event is shown in
+func eventColor(event TunnelEvent) int {
+	switch event.Type {
+	case EventStarted:
+		return colorGood
+	case EventReconnecting:
+		return colorWarning
+	case EventStopped:
+		return colorNeutral
+	}
+	if event.Type == EventHealthCheck && event.Err == nil {
+		return colorGood
+	}
+	return colorDanger
+}
+
+// slackPayload is a Slack incoming webhook message
+type slackPayload struct {
+	Text        string            `json:"text"`
+	Attachments []slackAttachment `json:"attachments"`
+}
+
+// slackAttachment is the colored block under a Slack message
+type slackAttachment struct {
+	Color    string `json:"color"`
+	Fallback string `json:"fallback"`
+	Title    string `json:"title"`
+	Text     string `json:"text,omitempty"`
+	Ts       int64  `json:"ts"`
+}
+
+// discordPayload is a Discord webhook message
+type discordPayload struct {
+	Content string         `json:"content"`
+	Embeds  []discordEmbed `json:"embeds"`
+}
+
+// discordEmbed is the colored block under a Discord message
+type discordEmbed struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Color       int    `json:"color"`
+	Timestamp   string `json:"timestamp"`
+}
+
+// webhookBody encodes an event in the given payload format
+func webhookBody(format string, event TunnelEvent) ([]byte, error) {
+	message := event.String()
+	title := fmt.Sprintf("%s: %s", event.Tunnel, event.Type)
+	if event.Type == EventReconnecting {
+		title += fmt.Sprintf(" (attempt %d)", event.Attempt)
+	}
+	detail := ""
+	if event.Err != nil {
+		detail = event.Err.Error()
+	}
+
+	var payload any
+	switch format {
+	case config.WebhookFormatSlack:
+		payload = slackPayload{
+			Text: message,
+			Attachments: []slackAttachment{{
+				Color:    fmt.Sprintf("#%06X", eventColor(event)),
+				Fallback: message,
+				Title:    title,
+				Text:     detail,
+				Ts:       event.Time.Unix(),
+			}},
+		}
+	case config.WebhookFormatDiscord:
+		payload = discordPayload{
+			Content: message,
+			Embeds: []discordEmbed{{
+				Title:       title,
+				Description: detail,
+				Color:       eventColor(event),
+				Timestamp:   event.Time.UTC().Format(time.RFC3339),
+			}},
+		}
+	default:
+		payload = webhookPayload{
+			Tunnel:  event.Tunnel,
+			Event:   event.Type,
+			Time:    event.Time,
+			Message: message,
+			Error:   detail,
+			Attempt: event.Attempt,
+		}
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode webhook payload: %w", err)
+	}
+	return body, nil
+}
@@ -0,0 +1,89 @@
+package tunnel
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/lerndmina/SSH-Tunnel/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// postedJSON sends event to a test server in the given format and returns
+// the decoded request body
+func postedJSON(t *testing.T, format string, event TunnelEvent) map[string]any {
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var err error
+		body, err = io.ReadAll(r.Body)
+		assert.NoError(t, err)
+	}))
+	defer server.Close()
+
+	n := config.NotificationConfig{Enabled: true, WebhookURL: server.URL, Format: format}
+	require.NoError(t, sendWebhook(context.Background(), server.Client(), n, event))
+
+	var decoded map[string]any
+	require.NoError(t, json.Unmarshal(body, &decoded))
+	return decoded
+}
+
+var failedEvent = TunnelEvent{
+	Type:   EventError,
+	Tunnel: "home",
+	Time:   time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC),
+	Err:    errors.New("ssh exited with status 255"),
+}
+
+func TestSlackWebhookPayload(t *testing.T) {
+	payload := postedJSON(t, config.WebhookFormatSlack, failedEvent)
+
+	assert.Equal(t, "tunnel 'home' error: ssh exited with status 255", payload["text"])
+	attachments, ok := payload["attachments"].([]any)
+	require.True(t, ok)
+	require.Len(t, attachments, 1)
+	attachment := attachments[0].(map[string]any)
+	assert.Equal(t, "#E01E5A", attachment["color"])
+	assert.Equal(t, "home: error", attachment["title"])
+	assert.Equal(t, "ssh exited with status 255", attachment["text"])
+	assert.Equal(t, float64(failedEvent.Time.Unix()), attachment["ts"])
+}
+
+func TestDiscordWebhookPayload(t *testing.T) {
+	event := TunnelEvent{Type: EventReconnecting, Tunnel: "home", Time: failedEvent.Time, Attempt: 2}
+	payload := postedJSON(t, config.WebhookFormatDiscord, event)
+
+	assert.Equal(t, "tunnel 'home' reconnecting (attempt 2)", payload["content"])
+	embeds, ok := payload["embeds"].([]any)
+	require.True(t, ok)
+	require.Len(t, embeds, 1)
+	embed := embeds[0].(map[string]any)
+	assert.Equal(t, float64(colorWarning), embed["color"])
+	assert.Equal(t, "home: reconnecting (attempt 2)", embed["title"])
+	assert.Equal(t, "2026-03-01T12:00:00Z", embed["timestamp"])
+	assert.NotContains(t, embed, "description")
+}
+
+func TestRawWebhookPayload(t *testing.T) {
+	payload := postedJSON(t, config.WebhookFormatRaw, failedEvent)
+
+	assert.Equal(t, "home", payload["tunnel"])
+	assert.Equal(t, "error", payload["event"])
+	assert.Equal(t, "ssh exited with status 255", payload["error"])
+	assert.NotContains(t, payload, "text")
+	assert.NotContains(t, payload, "content")
+}
+
+func TestEventColors(t *testing.T) {
+	assert.Equal(t, colorGood, eventColor(TunnelEvent{Type: EventStarted}))
+	assert.Equal(t, colorNeutral, eventColor(TunnelEvent{Type: EventStopped}))
+	assert.Equal(t, colorWarning, eventColor(TunnelEvent{Type: EventReconnecting}))
+	assert.Equal(t, colorDanger, eventColor(TunnelEvent{Type: EventExpired}))
+	assert.Equal(t, colorDanger, eventColor(TunnelEvent{Type: EventHealthCheck, Err: errors.New("port closed")}))
+}
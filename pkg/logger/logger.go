@@ -1,9 +1,11 @@
 package logger
 
 import (
+	"io"
 	"os"
 
 	"github.com/sirupsen/logrus"
+	"golang.org/x/term"
 )
 
 // LogLevel represents logging levels
@@ -29,31 +31,62 @@ var log = logrus.New()
 func init() {
 	// Set default configuration
 	log.SetOutput(os.Stdout)
+	SetColor(ColorAllowed(os.Stdout))
+	log.SetLevel(logrus.InfoLevel)
+}
+
+// ColorAllowed reports whether ANSI colors may be written to f: it must be a
+// terminal, and the NO_COLOR environment variable must be unset or empty
+// (see https://no-color.org)
+func ColorAllowed(f *os.File) bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	return term.IsTerminal(int(f.Fd()))
+}
+
+// SetOutput sets where log entries are written (default standard output)
+func SetOutput(w io.Writer) {
+	log.SetOutput(w)
+}
+
+// SetColor enables or disables ANSI colors in log output
+func SetColor(enabled bool) {
 	log.SetFormatter(&logrus.TextFormatter{
 		FullTimestamp: true,
-		ForceColors:   true,
+		ForceColors:   enabled,
+		DisableColors: !enabled,
 	})
-	log.SetLevel(logrus.InfoLevel)
 }
 
-// SetLevel sets the logging level
-func SetLevel(level LogLevel) {
-	switch level {
+// String returns the lower-case name of the level
+func (l LogLevel) String() string {
+	return l.logrusLevel().String()
+}
+
+// logrusLevel maps a LogLevel onto the underlying logrus level
+func (l LogLevel) logrusLevel() logrus.Level {
+	switch l {
 	case PanicLevel:
-		log.SetLevel(logrus.PanicLevel)
+		return logrus.PanicLevel
 	case FatalLevel:
-		log.SetLevel(logrus.FatalLevel)
+		return logrus.FatalLevel
 	case ErrorLevel:
-		log.SetLevel(logrus.ErrorLevel)
+		return logrus.ErrorLevel
 	case WarnLevel:
-		log.SetLevel(logrus.WarnLevel)
-	case InfoLevel:
-		log.SetLevel(logrus.InfoLevel)
+		return logrus.WarnLevel
 	case DebugLevel:
-		log.SetLevel(logrus.DebugLevel)
+		return logrus.DebugLevel
+	default:
+		return logrus.InfoLevel
 	}
 }
 
+// SetLevel sets the logging level
+func SetLevel(level LogLevel) {
+	log.SetLevel(level.logrusLevel())
+}
+
 // SetFormatter sets the log formatter
 func SetFormatter(formatter logrus.Formatter) {
 	log.SetFormatter(formatter)
@@ -109,6 +142,11 @@ func Fatalf(format string, args ...interface{}) {
 	log.Fatalf(format, args...)
 }
 
+// Log logs a message at the given level with the provided fields attached
+func Log(level LogLevel, fields logrus.Fields, args ...interface{}) {
+	log.WithFields(fields).Log(level.logrusLevel(), args...)
+}
+
 // WithField creates an entry with a single field
 func WithField(key string, value interface{}) *logrus.Entry {
 	return log.WithField(key, value)
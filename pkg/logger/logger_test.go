@@ -0,0 +1,41 @@
+package logger
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetColor(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stdout)
+	defer SetColor(ColorAllowed(os.Stdout))
+
+	SetColor(false)
+	Warnf("plain %d", 1)
+	assert.Contains(t, buf.String(), "plain 1")
+	assert.NotContains(t, buf.String(), "\x1b[")
+
+	buf.Reset()
+	SetColor(true)
+	Warnf("colored %d", 2)
+	assert.Contains(t, buf.String(), "\x1b[")
+}
+
+func TestColorAllowedHonoursNoColor(t *testing.T) {
+	t.Setenv("NO_COLOR", "1")
+	assert.False(t, ColorAllowed(os.Stdout))
+}
+
+func TestColorAllowedRejectsFiles(t *testing.T) {
+	t.Setenv("NO_COLOR", "")
+	file, err := os.CreateTemp(t.TempDir(), "log")
+	require.NoError(t, err)
+	defer file.Close()
+
+	assert.False(t, ColorAllowed(file))
+}
@@ -0,0 +1,78 @@
+package sshtunnel_test
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/lerndmina/SSH-Tunnel/pkg/sshtunnel"
+)
+
+// This example creates a tunnel configuration, starts the tunnel, reports its
+// status and stops it again. It is compiled but not run, as starting a tunnel
+// needs a reachable SSH server.
+func Example() {
+	configManager, err := sshtunnel.NewConfigManager("")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	cfg := &sshtunnel.Config{
+		TunnelName: "home",
+		CloudServer: sshtunnel.CloudServerConfig{
+			IP:   "203.0.113.10",
+			Port: 22,
+			User: "tunneluser",
+		},
+		LocalServer: sshtunnel.LocalServerConfig{
+			User:        "me",
+			ReversePort: 2222,
+			SOCKSPort:   1080,
+		},
+		SSH: sshtunnel.SSHConfig{
+			PrivateKeyPath: "~/.ssh/id_ed25519",
+		},
+		Service: sshtunnel.ServiceConfig{
+			AutoReconnect: true,
+		},
+	}
+	if err := configManager.SaveConfig(cfg); err != nil {
+		log.Fatal(err)
+	}
+
+	manager := sshtunnel.NewManager(configManager)
+	if err := manager.Start("home"); err != nil {
+		log.Fatal(err)
+	}
+
+	status, err := manager.GetStatus("home")
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("%s is %s (pid %d)\n", status.Name, status.Status, status.PID)
+
+	if err := manager.Stop("home"); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// This example prints tunnel state changes as they happen
+func ExampleManager_Subscribe() {
+	configManager, err := sshtunnel.NewConfigManager("")
+	if err != nil {
+		log.Fatal(err)
+	}
+	manager := sshtunnel.NewManager(configManager)
+
+	events := manager.Subscribe()
+	defer manager.Unsubscribe(events)
+
+	if err := manager.Start("home"); err != nil {
+		log.Fatal(err)
+	}
+	for event := range events {
+		fmt.Println(event)
+		if event.Type == sshtunnel.EventError {
+			break
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package sshtunnel
+
+import (
+	"github.com/lerndmina/SSH-Tunnel/internal/config"
+	"github.com/lerndmina/SSH-Tunnel/internal/ssh"
+	"github.com/lerndmina/SSH-Tunnel/internal/templates"
+	"github.com/lerndmina/SSH-Tunnel/internal/tunnel"
+)
+
+// This package is the supported way to use SSH-Tunnel as a Go library. The
+// types below are aliases of the implementations in internal/, so values can
+// be passed freely between this package and the CLI internals; only the
+// names and signatures listed here are kept stable.
+
+// Configuration types
+type (
+	// Config is a tunnel configuration
+	Config = config.Config
+	// CloudServerConfig holds the cloud server connection details
+	CloudServerConfig = config.CloudServerConfig
+	// LocalServerConfig holds the local side of the tunnel
+	LocalServerConfig = config.LocalServerConfig
+	// ForwardConfig describes a local port forward (ssh -L)
+	ForwardConfig = config.ForwardConfig
+	// RemoteForwardConfig describes a remote port forward (ssh -R)
+	RemoteForwardConfig = config.RemoteForwardConfig
+	// SSHConfig holds key paths and SSH options
+	SSHConfig = config.SSHConfig
+	// ServiceConfig holds reconnect and hook settings
+	ServiceConfig = config.ServiceConfig
+	// PerformanceConfig holds keep-alive and timeout settings
+	PerformanceConfig = config.PerformanceConfig
+	// ConfigManager loads and saves tunnel configurations in a config
+	// directory
+	ConfigManager = config.Manager
+	// ConfigStore holds tunnel configurations for a ConfigManager
+	ConfigStore = config.Store
+	// HTTPStore reads tunnel configurations from an HTTP server, caching
+	// them locally
+	HTTPStore = config.HTTPStore
+)
+
+// ErrReadOnlyStore is returned when saving to a read-only ConfigStore
+var ErrReadOnlyStore = config.ErrReadOnlyStore
+
+// Tunnel management types
+type (
+	// Manager starts, stops and supervises tunnels
+	Manager = tunnel.Manager
+	// TunnelStatus is a snapshot of a tunnel's state
+	TunnelStatus = tunnel.TunnelStatus
+	// Status is the state of a tunnel
+	Status = tunnel.Status
+	// TunnelEvent describes a change in a tunnel's state
+	TunnelEvent = tunnel.TunnelEvent
+	// EventType identifies a tunnel state change
+	EventType = tunnel.EventType
+	// CommandRunner runs hook commands
+	CommandRunner = tunnel.CommandRunner
+	// SSHExitError describes why a tunnel's SSH process exited
+	SSHExitError = tunnel.SSHExitError
+)
+
+// Tunnel states
+const (
+	StatusStopped      = tunnel.StatusStopped
+	StatusStarting     = tunnel.StatusStarting
+	StatusRunning      = tunnel.StatusRunning
+	StatusStopping     = tunnel.StatusStopping
+	StatusError        = tunnel.StatusError
+	StatusReconnecting = tunnel.StatusReconnecting
+)
+
+// Event types
+const (
+	EventStarted      = tunnel.EventStarted
+	EventStopped      = tunnel.EventStopped
+	EventError        = tunnel.EventError
+	EventReconnecting = tunnel.EventReconnecting
+	EventHealthCheck  = tunnel.EventHealthCheck
+	EventExpired      = tunnel.EventExpired
+)
+
+// ErrAlreadyRunning is wrapped by Start errors when another process is
+// already running the tunnel
+var ErrAlreadyRunning = tunnel.ErrAlreadyRunning
+
+// Failures recognised in SSH's output when its process exits, for use with
+// errors.Is on TunnelStatus.Error
+var (
+	ErrAuthFailed        = tunnel.ErrAuthFailed
+	ErrConnectionRefused = tunnel.ErrConnectionRefused
+	ErrForwardFailed     = tunnel.ErrForwardFailed
+	ErrHostKeyMismatch   = tunnel.ErrHostKeyMismatch
+)
+
+// Key and template types
+type (
+	// KeyManager generates SSH keys and deploys them to servers
+	KeyManager = ssh.KeyManager
+	// RemoteInfo is the account and platform KeyManager.ProbeRemote
+	// reports
+	RemoteInfo = ssh.RemoteInfo
+	// Template is a reusable configuration template
+	Template = templates.Template
+	// TemplateVariable is a variable substituted into a template
+	TemplateVariable = templates.Variable
+	// TemplateForward is a templated local port forward
+	TemplateForward = templates.Forward
+	// TemplateManager lists built-in templates and renders configurations
+	// from them
+	TemplateManager = templates.Manager
+)
+
+// NewConfigManager opens the config directory at configPath, creating it if
+// needed, and loads the tunnel configurations in it. An empty path uses
+// ~/.ssh-tunnel-manager, as the CLI does.
+func NewConfigManager(configPath string) (*ConfigManager, error) {
+	return config.NewManager(configPath)
+}
+
+// NewConfigManagerWithStore is NewConfigManager keeping the tunnel
+// configurations in store instead of the config directory's tunnels
+// directory, e.g. NewMemoryStore() to embed or test without writing them
+// to disk
+func NewConfigManagerWithStore(configPath string, store ConfigStore) (*ConfigManager, error) {
+	return config.NewManagerWithStore(configPath, store)
+}
+
+// NewMemoryStore returns a ConfigStore keeping tunnel configurations in
+// memory
+func NewMemoryStore() ConfigStore {
+	return config.NewMemoryStore()
+}
+
+// NewHTTPStore returns a read-only ConfigStore for the tunnels at rawURL,
+// sending token as a bearer token if set and caching documents in cache,
+// which may be nil
+func NewHTTPStore(rawURL, token string, cache ConfigStore) (*HTTPStore, error) {
+	return config.NewHTTPStore(rawURL, token, cache)
+}
+
+// NewManager creates a tunnel manager for the tunnels in configManager
+func NewManager(configManager *ConfigManager) *Manager {
+	return tunnel.NewManagerWithConfig(configManager)
+}
+
+// NewKeyManager creates a key manager with default timeouts
+func NewKeyManager() *KeyManager {
+	return ssh.NewKeyManager()
+}
+
+// NewTemplateManager creates a template manager holding the built-in
+// templates
+func NewTemplateManager() *TemplateManager {
+	return templates.NewManager()
+}
+
+// BuildSSHArgs returns the ssh arguments a tunnel is started with
+func BuildSSHArgs(cfg *Config) []string {
+	return tunnel.BuildSSHArgs(cfg)
+}
@@ -0,0 +1,45 @@
+package sshtunnel
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFacadeRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+
+	configManager, err := NewConfigManager(dir)
+	require.NoError(t, err)
+
+	cfg := &Config{
+		TunnelName:  "home",
+		CloudServer: CloudServerConfig{IP: "203.0.113.10", Port: 22, User: "tunneluser"},
+		LocalServer: LocalServerConfig{User: "me", ReversePort: 2222},
+	}
+	require.NoError(t, configManager.SaveConfig(cfg))
+
+	reloaded, err := NewConfigManager(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"home"}, reloaded.ListConfigs())
+
+	manager := NewManager(reloaded)
+	status, err := manager.GetStatus("home")
+	require.NoError(t, err)
+	assert.Equal(t, StatusStopped, status.Status)
+
+	assert.Error(t, manager.Start("missing"))
+	assert.Contains(t, BuildSSHArgs(cfg), "2222:localhost:22")
+}
+
+func TestFacadeMemoryStore(t *testing.T) {
+	store := NewMemoryStore()
+	configManager, err := NewConfigManagerWithStore(t.TempDir(), store)
+	require.NoError(t, err)
+	require.NoError(t, configManager.SaveConfig(&Config{TunnelName: "home", LocalServer: LocalServerConfig{ReversePort: 2222}}))
+
+	names, err := store.List()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"home"}, names)
+}